@@ -0,0 +1,792 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/prometheus/common/model"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringP("file", "f", "", "Path to the tailnet manifest in YAML format")
+	if err := applyCmd.MarkFlagRequired("file"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	applyCmd.Flags().Bool("dry-run", false, "Print the changes without applying them")
+	applyCmd.Flags().
+		Bool("prune", false, "Remove the users, pre auth keys, API keys and DNS records missing from the manifest")
+
+	rootCmd.AddCommand(exportCmd)
+}
+
+// tailnetManifest is the declarative state of a tailnet, applied with
+// `headscale apply` and produced by `headscale export`.
+type tailnetManifest struct {
+	Users      []manifestUser      `json:"users,omitempty"       yaml:"users,omitempty"`
+	Nodes      []manifestNode      `json:"nodes,omitempty"       yaml:"nodes,omitempty"`
+	APIKeys    []manifestAPIKey    `json:"api_keys,omitempty"    yaml:"api_keys,omitempty"`
+	DNSRecords []manifestDNSRecord `json:"dns_records,omitempty" yaml:"dns_records,omitempty"`
+
+	// Policy is the policy in HuJSON format, it is left unchanged when
+	// empty.
+	Policy string `json:"policy,omitempty" yaml:"policy,omitempty"`
+}
+
+// manifestUser is a user, identified by its name. The display name, email
+// and picture URL are only used when the user is created.
+type manifestUser struct {
+	Name        string               `json:"name"                    yaml:"name"`
+	DisplayName string               `json:"display_name,omitempty"  yaml:"display_name,omitempty"`
+	Email       string               `json:"email,omitempty"         yaml:"email,omitempty"`
+	PictureURL  string               `json:"picture_url,omitempty"   yaml:"picture_url,omitempty"`
+	PreAuthKeys []manifestPreAuthKey `json:"pre_auth_keys,omitempty" yaml:"pre_auth_keys,omitempty"`
+}
+
+// manifestPreAuthKey is a pre auth key of a user, identified by its
+// description. A key which differs from the manifest is replaced, as keys
+// cannot be changed.
+type manifestPreAuthKey struct {
+	Description string   `json:"description"         yaml:"description"`
+	Reusable    bool     `json:"reusable,omitempty"  yaml:"reusable,omitempty"`
+	Ephemeral   bool     `json:"ephemeral,omitempty" yaml:"ephemeral,omitempty"`
+	Tags        []string `json:"tags,omitempty"      yaml:"tags,omitempty"`
+	MaxUses     uint32   `json:"max_uses,omitempty"  yaml:"max_uses,omitempty"`
+
+	// Expiration is a duration (e.g. 90d) or a RFC 3339 time, used when
+	// the key is created.
+	Expiration string `json:"expiration,omitempty" yaml:"expiration,omitempty"`
+}
+
+// manifestNode is a node, identified by its name. Its tags and approved
+// routes are only changed when they are set.
+type manifestNode struct {
+	Name           string    `json:"name"                      yaml:"name"`
+	Tags           *[]string `json:"tags,omitempty"            yaml:"tags,omitempty"`
+	ApprovedRoutes *[]string `json:"approved_routes,omitempty" yaml:"approved_routes,omitempty"`
+}
+
+// manifestAPIKey is an API key, identified by its prefix. API keys cannot
+// be created by apply, as their secret is only shown when they are created.
+type manifestAPIKey struct {
+	Prefix     string `json:"prefix"               yaml:"prefix"`
+	Expiration string `json:"expiration,omitempty" yaml:"expiration,omitempty"`
+}
+
+type manifestDNSRecord struct {
+	Name  string `json:"name"  yaml:"name"`
+	Type  string `json:"type"  yaml:"type"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// tailnetState is the state of the tailnet read from the server.
+type tailnetState struct {
+	users       []*v1.User
+	preAuthKeys map[uint64][]*v1.PreAuthKey
+	nodes       []*v1.Node
+	apiKeys     []*v1.ApiKey
+	dnsRecords  []*v1.DNSRecord
+	policy      string
+}
+
+// tailnetChange is a change of the tailnet planned by apply.
+type tailnetChange struct {
+	// summary describes the change, prefixed with + when something is
+	// created, ~ when it is changed and - when it is removed.
+	summary string
+	apply   func(ctx context.Context, client v1.HeadscaleServiceClient, result *applyResult) error
+}
+
+type applyResult struct {
+	DryRun  bool     `json:"dry_run"`
+	Changes []string `json:"changes"`
+
+	// Notes are the differences apply cannot reconcile.
+	Notes []string `json:"notes,omitempty"`
+
+	// PreAuthKeys are the keys created, which are only shown once.
+	PreAuthKeys []appliedPreAuthKey `json:"pre_auth_keys,omitempty"`
+
+	userIDs map[string]uint64
+}
+
+type appliedPreAuthKey struct {
+	User        string `json:"user"`
+	Description string `json:"description"`
+	Key         string `json:"key"`
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply a declarative manifest of the tailnet",
+	Long: `
+	Reconciles the users, pre auth keys, node tags and approved routes, API keys,
+	DNS records and policy of the tailnet with a manifest, as produced by
+	"headscale export". Nothing is removed unless --prune is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		path, _ := cmd.Flags().GetString("file")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		prune, _ := cmd.Flags().GetBool("prune")
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error reading the manifest: %s", err), output)
+		}
+
+		var manifest tailnetManifest
+		if err := yaml.Unmarshal(b, &manifest); err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error parsing the manifest: %s", err), output)
+		}
+
+		// The API key used by this command is never pruned.
+		var ownAPIKey string
+		if cfg, err := types.LoadCLIConfig(); err == nil {
+			ownAPIKey, _, _ = strings.Cut(cfg.CLI.APIKey, ".")
+		}
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		state, err := loadTailnetState(ctx, client)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error reading the tailnet: %s", err), output)
+		}
+
+		changes, notes, err := planTailnet(state, &manifest, prune, ownAPIKey, time.Now())
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error in the manifest: %s", err), output)
+		}
+
+		result := applyResult{
+			DryRun:  dryRun,
+			Changes: []string{},
+			Notes:   notes,
+			userIDs: make(map[string]uint64),
+		}
+		for _, user := range state.users {
+			result.userIDs[user.GetName()] = user.GetId()
+		}
+
+		for _, change := range changes {
+			if !dryRun {
+				if err := change.apply(ctx, client, &result); err != nil {
+					ErrorOutput(err, fmt.Sprintf("Error applying %q: %s", change.summary, err), output)
+				}
+			}
+			result.Changes = append(result.Changes, change.summary)
+		}
+
+		SuccessOutput(result, applyResultText(result), output)
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the tailnet as a declarative manifest",
+	Long: `
+	Prints the users, pre auth keys, node tags and approved routes, API keys,
+	DNS records and policy of the tailnet as a manifest for "headscale apply".
+	Pre auth keys without a description are not exported, as apply identifies
+	keys by their description.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		state, err := loadTailnetState(ctx, client)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error reading the tailnet: %s", err), output)
+		}
+
+		manifest := exportTailnet(state, time.Now())
+
+		b, err := yaml.Marshal(manifest)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error encoding the manifest: %s", err), output)
+		}
+
+		SuccessOutput(manifest, strings.TrimSuffix(string(b), "\n"), output)
+	},
+}
+
+func applyResultText(result applyResult) string {
+	var sb strings.Builder
+	for _, change := range result.Changes {
+		sb.WriteString(change + "\n")
+	}
+	for _, note := range result.Notes {
+		sb.WriteString("! " + note + "\n")
+	}
+	for _, key := range result.PreAuthKeys {
+		fmt.Fprintf(&sb, "pre auth key %s/%s: %s\n", key.User, key.Description, key.Key)
+	}
+
+	switch {
+	case len(result.Changes) == 0:
+		sb.WriteString("No changes.")
+	case result.DryRun:
+		fmt.Fprintf(&sb, "Dry run, %d changes not applied.", len(result.Changes))
+	default:
+		fmt.Fprintf(&sb, "Applied %d changes.", len(result.Changes))
+	}
+
+	return sb.String()
+}
+
+func loadTailnetState(ctx context.Context, client v1.HeadscaleServiceClient) (*tailnetState, error) {
+	users, err := client.ListUsers(ctx, &v1.ListUsersRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("listing users: %w", err)
+	}
+
+	state := &tailnetState{
+		users:       users.GetUsers(),
+		preAuthKeys: make(map[uint64][]*v1.PreAuthKey),
+	}
+
+	for _, user := range state.users {
+		keys, err := client.ListPreAuthKeys(ctx, &v1.ListPreAuthKeysRequest{User: user.GetId()})
+		if err != nil {
+			return nil, fmt.Errorf("listing pre auth keys of user %s: %w", user.GetName(), err)
+		}
+		state.preAuthKeys[user.GetId()] = keys.GetPreAuthKeys()
+	}
+
+	nodes, err := client.ListNodes(ctx, &v1.ListNodesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("listing nodes: %w", err)
+	}
+	state.nodes = nodes.GetNodes()
+
+	apiKeys, err := client.ListApiKeys(ctx, &v1.ListApiKeysRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("listing API keys: %w", err)
+	}
+	state.apiKeys = apiKeys.GetApiKeys()
+
+	records, err := client.ListDNSRecords(ctx, &v1.ListDNSRecordsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("listing DNS records: %w", err)
+	}
+	state.dnsRecords = records.GetRecords()
+
+	policy, err := client.GetPolicy(ctx, &v1.GetPolicyRequest{})
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, fmt.Errorf("reading policy: %w", err)
+	}
+	state.policy = policy.GetPolicy()
+
+	return state, nil
+}
+
+// planTailnet returns the changes reconciling the tailnet with the
+// manifest, and the differences which cannot be reconciled. With prune, the
+// users, pre auth keys, API keys and DNS records missing from the manifest
+// are removed, except the API key with the prefix keepAPIKey.
+func planTailnet(
+	state *tailnetState,
+	manifest *tailnetManifest,
+	prune bool,
+	keepAPIKey string,
+	now time.Time,
+) ([]tailnetChange, []string, error) {
+	var changes []tailnetChange
+	var notes []string
+
+	users := make(map[string]*v1.User)
+	for _, user := range state.users {
+		users[user.GetName()] = user
+	}
+
+	manifestUsers := make(map[string]bool)
+	for _, mu := range manifest.Users {
+		if mu.Name == "" {
+			return nil, nil, errors.New("user without a name")
+		}
+		if manifestUsers[mu.Name] {
+			return nil, nil, fmt.Errorf("user %s is listed twice", mu.Name)
+		}
+		manifestUsers[mu.Name] = true
+
+		if _, ok := users[mu.Name]; !ok {
+			changes = append(changes, tailnetChange{
+				summary: "+ user " + mu.Name,
+				apply: func(ctx context.Context, client v1.HeadscaleServiceClient, result *applyResult) error {
+					resp, err := client.CreateUser(ctx, &v1.CreateUserRequest{
+						Name:        mu.Name,
+						DisplayName: mu.DisplayName,
+						Email:       mu.Email,
+						PictureUrl:  mu.PictureURL,
+					})
+					if err != nil {
+						return err
+					}
+					result.userIDs[mu.Name] = resp.GetUser().GetId()
+
+					return nil
+				},
+			})
+		}
+	}
+
+	if manifest.Policy != "" && strings.TrimSpace(manifest.Policy) != strings.TrimSpace(state.policy) {
+		changes = append(changes, tailnetChange{
+			summary: "~ policy",
+			apply: func(ctx context.Context, client v1.HeadscaleServiceClient, _ *applyResult) error {
+				_, err := client.SetPolicy(ctx, &v1.SetPolicyRequest{Policy: manifest.Policy})
+				return err
+			},
+		})
+	}
+
+	for _, mu := range manifest.Users {
+		var existing []*v1.PreAuthKey
+		if user, ok := users[mu.Name]; ok {
+			existing = state.preAuthKeys[user.GetId()]
+		}
+
+		keyChanges, err := planPreAuthKeys(mu, existing, prune, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, keyChanges...)
+	}
+
+	nodeChanges, nodeNotes, err := planNodes(state.nodes, manifest.Nodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes = append(changes, nodeChanges...)
+	notes = append(notes, nodeNotes...)
+
+	apiKeys := make(map[string]bool)
+	for _, mk := range manifest.APIKeys {
+		apiKeys[mk.Prefix] = true
+		if !slices.ContainsFunc(state.apiKeys, func(key *v1.ApiKey) bool {
+			return key.GetPrefix() == mk.Prefix && !isExpired(key.GetExpiration(), now)
+		}) {
+			notes = append(notes, fmt.Sprintf("API key %s does not exist or has expired, create keys with headscale apikeys create", mk.Prefix))
+		}
+	}
+	if prune {
+		for _, key := range state.apiKeys {
+			if apiKeys[key.GetPrefix()] || key.GetPrefix() == keepAPIKey || isExpired(key.GetExpiration(), now) {
+				continue
+			}
+
+			changes = append(changes, tailnetChange{
+				summary: "- API key " + key.GetPrefix(),
+				apply: func(ctx context.Context, client v1.HeadscaleServiceClient, _ *applyResult) error {
+					_, err := client.ExpireApiKey(ctx, &v1.ExpireApiKeyRequest{Prefix: key.GetPrefix()})
+					return err
+				},
+			})
+		}
+	}
+
+	dnsChange, err := planDNSRecords(state.dnsRecords, manifest.DNSRecords, prune)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dnsChange != nil {
+		changes = append(changes, *dnsChange)
+	}
+
+	if prune {
+		owners := make(map[uint64]bool)
+		for _, node := range state.nodes {
+			owners[node.GetUser().GetId()] = true
+		}
+
+		for _, user := range state.users {
+			if manifestUsers[user.GetName()] {
+				continue
+			}
+
+			if owners[user.GetId()] {
+				notes = append(notes, fmt.Sprintf("user %s is not removed, it owns nodes", user.GetName()))
+				continue
+			}
+
+			changes = append(changes, tailnetChange{
+				summary: "- user " + user.GetName(),
+				apply: func(ctx context.Context, client v1.HeadscaleServiceClient, _ *applyResult) error {
+					_, err := client.DeleteUser(ctx, &v1.DeleteUserRequest{Id: user.GetId()})
+					return err
+				},
+			})
+		}
+	}
+
+	return changes, notes, nil
+}
+
+func planPreAuthKeys(
+	mu manifestUser,
+	existing []*v1.PreAuthKey,
+	prune bool,
+	now time.Time,
+) ([]tailnetChange, error) {
+	var changes []tailnetChange
+
+	current := make(map[string]*v1.PreAuthKey)
+	for _, key := range existing {
+		if key.GetDescription() != "" && !isExpired(key.GetExpiration(), now) {
+			if _, ok := current[key.GetDescription()]; !ok {
+				current[key.GetDescription()] = key
+			}
+		}
+	}
+
+	listed := make(map[string]bool)
+	for _, mk := range mu.PreAuthKeys {
+		if mk.Description == "" {
+			return nil, fmt.Errorf("pre auth key of user %s without a description", mu.Name)
+		}
+		if listed[mk.Description] {
+			return nil, fmt.Errorf("pre auth key %s/%s is listed twice", mu.Name, mk.Description)
+		}
+		listed[mk.Description] = true
+
+		name := mu.Name + "/" + mk.Description
+		key, ok := current[mk.Description]
+		if ok && preAuthKeyMatches(key, mk) {
+			continue
+		}
+
+		expiration, err := parseManifestExpiration(mk.Expiration, now)
+		if err != nil {
+			return nil, fmt.Errorf("pre auth key %s: %w", name, err)
+		}
+
+		create := func(ctx context.Context, client v1.HeadscaleServiceClient, result *applyResult) error {
+			resp, err := client.CreatePreAuthKey(ctx, &v1.CreatePreAuthKeyRequest{
+				User:        result.userIDs[mu.Name],
+				Reusable:    mk.Reusable,
+				Ephemeral:   mk.Ephemeral,
+				Expiration:  timestamppb.New(expiration),
+				AclTags:     mk.Tags,
+				Description: mk.Description,
+				MaxUses:     mk.MaxUses,
+			})
+			if err != nil {
+				return err
+			}
+
+			result.PreAuthKeys = append(result.PreAuthKeys, appliedPreAuthKey{
+				User:        mu.Name,
+				Description: mk.Description,
+				Key:         resp.GetPreAuthKey().GetKey(),
+			})
+
+			return nil
+		}
+
+		if !ok {
+			changes = append(changes, tailnetChange{
+				summary: "+ pre auth key " + name,
+				apply:   create,
+			})
+
+			continue
+		}
+
+		changes = append(changes, tailnetChange{
+			summary: "~ pre auth key " + name + " (replaced)",
+			apply: func(ctx context.Context, client v1.HeadscaleServiceClient, result *applyResult) error {
+				if err := expirePreAuthKey(ctx, client, key); err != nil {
+					return err
+				}
+
+				return create(ctx, client, result)
+			},
+		})
+	}
+
+	if prune {
+		for _, key := range existing {
+			if listed[key.GetDescription()] || isExpired(key.GetExpiration(), now) {
+				continue
+			}
+
+			name := key.GetDescription()
+			if name == "" {
+				name = key.GetPrefix()
+			}
+
+			changes = append(changes, tailnetChange{
+				summary: "- pre auth key " + mu.Name + "/" + name,
+				apply: func(ctx context.Context, client v1.HeadscaleServiceClient, _ *applyResult) error {
+					return expirePreAuthKey(ctx, client, key)
+				},
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+func expirePreAuthKey(ctx context.Context, client v1.HeadscaleServiceClient, key *v1.PreAuthKey) error {
+	_, err := client.ExpirePreAuthKey(ctx, &v1.ExpirePreAuthKeyRequest{
+		User: key.GetUser().GetId(),
+		Key:  key.GetPrefix(),
+	})
+
+	return err
+}
+
+func preAuthKeyMatches(key *v1.PreAuthKey, mk manifestPreAuthKey) bool {
+	return key.GetReusable() == mk.Reusable &&
+		key.GetEphemeral() == mk.Ephemeral &&
+		key.GetMaxUses() == mk.MaxUses &&
+		sameStrings(key.GetAclTags(), mk.Tags)
+}
+
+func planNodes(nodes []*v1.Node, manifestNodes []manifestNode) ([]tailnetChange, []string, error) {
+	var changes []tailnetChange
+	var notes []string
+
+	byName := make(map[string]*v1.Node)
+	for _, node := range nodes {
+		byName[node.GetGivenName()] = node
+	}
+
+	listed := make(map[string]bool)
+	for _, mn := range manifestNodes {
+		if listed[mn.Name] {
+			return nil, nil, fmt.Errorf("node %s is listed twice", mn.Name)
+		}
+		listed[mn.Name] = true
+
+		var routes []string
+		if mn.ApprovedRoutes != nil {
+			for _, route := range *mn.ApprovedRoutes {
+				prefix, err := netip.ParsePrefix(route)
+				if err != nil {
+					return nil, nil, fmt.Errorf("node %s: invalid route %q: %w", mn.Name, route, err)
+				}
+				routes = append(routes, prefix.String())
+			}
+		}
+
+		node, ok := byName[mn.Name]
+		if !ok {
+			notes = append(notes, fmt.Sprintf("node %s does not exist", mn.Name))
+			continue
+		}
+
+		if mn.Tags != nil && !sameStrings(node.GetForcedTags(), *mn.Tags) {
+			tags := *mn.Tags
+			changes = append(changes, tailnetChange{
+				summary: fmt.Sprintf("~ node %s: tags %v -> %v", mn.Name, sorted(node.GetForcedTags()), sorted(tags)),
+				apply: func(ctx context.Context, client v1.HeadscaleServiceClient, _ *applyResult) error {
+					_, err := client.SetTags(ctx, &v1.SetTagsRequest{NodeId: node.GetId(), Tags: tags})
+					return err
+				},
+			})
+		}
+
+		if mn.ApprovedRoutes != nil && !sameStrings(node.GetApprovedRoutes(), routes) {
+			changes = append(changes, tailnetChange{
+				summary: fmt.Sprintf("~ node %s: approved routes %v -> %v", mn.Name, sorted(node.GetApprovedRoutes()), sorted(routes)),
+				apply: func(ctx context.Context, client v1.HeadscaleServiceClient, _ *applyResult) error {
+					_, err := client.SetApprovedRoutes(ctx, &v1.SetApprovedRoutesRequest{NodeId: node.GetId(), Routes: routes})
+					return err
+				},
+			})
+		}
+	}
+
+	return changes, notes, nil
+}
+
+// planDNSRecords returns the change setting the DNS records, or nil when
+// they are already the ones of the manifest.
+func planDNSRecords(
+	current []*v1.DNSRecord,
+	manifestRecords []manifestDNSRecord,
+	prune bool,
+) (*tailnetChange, error) {
+	key := func(name, typ, value string) string {
+		return name + " " + typ + " " + value
+	}
+
+	have := make(map[string]bool)
+	for _, record := range current {
+		have[key(record.GetName(), record.GetType(), record.GetValue())] = true
+	}
+
+	want := make(map[string]bool)
+	var desired []*v1.DNSRecord
+	var lines []string
+	for _, mr := range manifestRecords {
+		record := types.DNSRecord{Name: mr.Name, Type: mr.Type, Value: mr.Value}
+		if err := record.Validate(); err != nil {
+			return nil, err
+		}
+
+		k := key(mr.Name, mr.Type, mr.Value)
+		if want[k] {
+			continue
+		}
+		want[k] = true
+		desired = append(desired, record.Proto())
+
+		if !have[k] {
+			lines = append(lines, "+ DNS record "+k)
+		}
+	}
+
+	for _, record := range current {
+		k := key(record.GetName(), record.GetType(), record.GetValue())
+		if want[k] {
+			continue
+		}
+
+		if prune {
+			lines = append(lines, "- DNS record "+k)
+		} else {
+			desired = append(desired, record)
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	return &tailnetChange{
+		summary: strings.Join(lines, "\n"),
+		apply: func(ctx context.Context, client v1.HeadscaleServiceClient, _ *applyResult) error {
+			_, err := client.SetDNSRecords(ctx, &v1.SetDNSRecordsRequest{Records: desired})
+			return err
+		},
+	}, nil
+}
+
+// exportTailnet returns the manifest of the tailnet.
+func exportTailnet(state *tailnetState, now time.Time) *tailnetManifest {
+	manifest := &tailnetManifest{Policy: state.policy}
+
+	for _, user := range state.users {
+		mu := manifestUser{
+			Name:        user.GetName(),
+			DisplayName: user.GetDisplayName(),
+			Email:       user.GetEmail(),
+			PictureURL:  user.GetProfilePicUrl(),
+		}
+
+		for _, key := range state.preAuthKeys[user.GetId()] {
+			if key.GetDescription() == "" || isExpired(key.GetExpiration(), now) {
+				continue
+			}
+
+			mk := manifestPreAuthKey{
+				Description: key.GetDescription(),
+				Reusable:    key.GetReusable(),
+				Ephemeral:   key.GetEphemeral(),
+				Tags:        key.GetAclTags(),
+				MaxUses:     key.GetMaxUses(),
+			}
+			if key.GetExpiration() != nil {
+				mk.Expiration = key.GetExpiration().AsTime().UTC().Format(time.RFC3339)
+			}
+			mu.PreAuthKeys = append(mu.PreAuthKeys, mk)
+		}
+
+		manifest.Users = append(manifest.Users, mu)
+	}
+
+	for _, node := range state.nodes {
+		mn := manifestNode{Name: node.GetGivenName()}
+		if tags := node.GetForcedTags(); len(tags) > 0 {
+			tags = sorted(tags)
+			mn.Tags = &tags
+		}
+		if routes := node.GetApprovedRoutes(); len(routes) > 0 {
+			routes = sorted(routes)
+			mn.ApprovedRoutes = &routes
+		}
+
+		if mn.Tags != nil || mn.ApprovedRoutes != nil {
+			manifest.Nodes = append(manifest.Nodes, mn)
+		}
+	}
+
+	for _, key := range state.apiKeys {
+		if isExpired(key.GetExpiration(), now) {
+			continue
+		}
+
+		mk := manifestAPIKey{Prefix: key.GetPrefix()}
+		if key.GetExpiration() != nil {
+			mk.Expiration = key.GetExpiration().AsTime().UTC().Format(time.RFC3339)
+		}
+		manifest.APIKeys = append(manifest.APIKeys, mk)
+	}
+
+	for _, record := range state.dnsRecords {
+		manifest.DNSRecords = append(manifest.DNSRecords, manifestDNSRecord{
+			Name:  record.GetName(),
+			Type:  record.GetType(),
+			Value: record.GetValue(),
+		})
+	}
+
+	return manifest
+}
+
+// parseManifestExpiration parses an expiration given as a duration from
+// now, e.g. 90d, or as a RFC 3339 time.
+func parseManifestExpiration(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		s = DefaultPreAuthKeyExpiry
+	}
+
+	expiration, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		duration, err := model.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expiration %q, expected a duration or a RFC 3339 time", s)
+		}
+		expiration = now.Add(time.Duration(duration))
+	}
+
+	if !expiration.After(now) {
+		return time.Time{}, fmt.Errorf("expiration %s is in the past", expiration.Format(time.RFC3339))
+	}
+
+	return expiration.UTC(), nil
+}
+
+func isExpired(expiration *timestamppb.Timestamp, now time.Time) bool {
+	return expiration != nil && !expiration.AsTime().IsZero() && expiration.AsTime().Before(now)
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+
+	return s
+}
+
+func sameStrings(a, b []string) bool {
+	return slices.Equal(sorted(a), sorted(b))
+}
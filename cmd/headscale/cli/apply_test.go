@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+)
+
+func testTailnetState(now time.Time) *tailnetState {
+	alice := &v1.User{Id: 1, Name: "alice", DisplayName: "Alice"}
+	bob := &v1.User{Id: 2, Name: "bob"}
+	future := timestamppb.New(now.Add(24 * time.Hour))
+	past := timestamppb.New(now.Add(-time.Hour))
+
+	return &tailnetState{
+		users: []*v1.User{alice, bob},
+		preAuthKeys: map[uint64][]*v1.PreAuthKey{
+			1: {
+				{User: alice, Prefix: "ci0000000000", Description: "ci", Reusable: true, AclTags: []string{"tag:ci"}, Expiration: future},
+				{User: alice, Prefix: "old000000000", Description: "old", Expiration: past},
+				{User: alice, Prefix: "anon00000000", Expiration: future},
+			},
+		},
+		nodes: []*v1.Node{
+			{Id: 1, GivenName: "web-1", User: alice, ForcedTags: []string{"tag:web"}, ApprovedRoutes: []string{"10.0.0.0/24"}},
+			{Id: 2, GivenName: "laptop", User: alice},
+		},
+		apiKeys: []*v1.ApiKey{
+			{Prefix: "admin00", Expiration: future},
+			{Prefix: "cicd000", Expiration: future},
+			{Prefix: "gone000", Expiration: past},
+		},
+		dnsRecords: []*v1.DNSRecord{
+			{Name: "grafana.example.com", Type: "A", Value: "100.64.0.5"},
+		},
+		policy: `{"acls": []}`,
+	}
+}
+
+func summaries(changes []tailnetChange) []string {
+	var s []string
+	for _, change := range changes {
+		s = append(s, change.summary)
+	}
+
+	return s
+}
+
+func TestExportThenApplyHasNoChanges(t *testing.T) {
+	now := time.Now()
+	state := testTailnetState(now)
+
+	manifest := exportTailnet(state, now)
+
+	// The manifest survives being written out.
+	b, err := yaml.Marshal(manifest)
+	require.NoError(t, err)
+	var parsed tailnetManifest
+	require.NoError(t, yaml.Unmarshal(b, &parsed))
+
+	assert.Len(t, parsed.Users, 2)
+	assert.Len(t, parsed.Users[0].PreAuthKeys, 1, "expired keys and keys without description are not exported")
+	assert.Len(t, parsed.Nodes, 1, "nodes without tags or routes are not exported")
+	assert.Len(t, parsed.APIKeys, 2)
+
+	changes, notes, err := planTailnet(state, &parsed, false, "", now)
+	require.NoError(t, err)
+	assert.Empty(t, summaries(changes))
+	assert.Empty(t, notes)
+
+	// The key without a description is only pruned.
+	changes, _, err = planTailnet(state, &parsed, true, "", now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"- pre auth key alice/anon00000000"}, summaries(changes))
+}
+
+func TestPlanTailnet(t *testing.T) {
+	now := time.Now()
+	state := testTailnetState(now)
+
+	manifest := tailnetManifest{
+		Users: []manifestUser{
+			{
+				Name: "alice",
+				PreAuthKeys: []manifestPreAuthKey{
+					{Description: "ci", Reusable: true, Tags: []string{"tag:ci", "tag:build"}},
+					{Description: "servers", Expiration: "90d"},
+				},
+			},
+			{Name: "carol"},
+		},
+		Nodes: []manifestNode{
+			{Name: "web-1", Tags: &[]string{"tag:web", "tag:prod"}, ApprovedRoutes: &[]string{"10.0.0.0/24"}},
+			{Name: "laptop", ApprovedRoutes: &[]string{"0.0.0.0/0", "::/0"}},
+			{Name: "missing", Tags: &[]string{}},
+		},
+		APIKeys: []manifestAPIKey{
+			{Prefix: "cicd000"},
+			{Prefix: "gone000"},
+		},
+		DNSRecords: []manifestDNSRecord{
+			{Name: "prometheus.example.com", Type: "AAAA", Value: "fd7a:115c:a1e0::5"},
+		},
+		Policy: `{"acls": [{"action": "accept", "src": ["*"], "dst": ["*:*"]}]}`,
+	}
+
+	changes, notes, err := planTailnet(state, &manifest, false, "", now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"+ user carol",
+		"~ policy",
+		"~ pre auth key alice/ci (replaced)",
+		"+ pre auth key alice/servers",
+		"~ node web-1: tags [tag:web] -> [tag:prod tag:web]",
+		"~ node laptop: approved routes [] -> [0.0.0.0/0 ::/0]",
+		"+ DNS record prometheus.example.com AAAA fd7a:115c:a1e0::5",
+	}, summaries(changes))
+	assert.Equal(t, []string{
+		"node missing does not exist",
+		"API key gone000 does not exist or has expired, create keys with headscale apikeys create",
+	}, notes)
+
+	changes, notes, err = planTailnet(state, &manifest, true, "admin00", now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"+ user carol",
+		"~ policy",
+		"~ pre auth key alice/ci (replaced)",
+		"+ pre auth key alice/servers",
+		"- pre auth key alice/anon00000000",
+		"~ node web-1: tags [tag:web] -> [tag:prod tag:web]",
+		"~ node laptop: approved routes [] -> [0.0.0.0/0 ::/0]",
+		"+ DNS record prometheus.example.com AAAA fd7a:115c:a1e0::5\n- DNS record grafana.example.com A 100.64.0.5",
+		"- user bob",
+	}, summaries(changes))
+	assert.Len(t, notes, 2)
+}
+
+func TestPlanTailnetInvalid(t *testing.T) {
+	now := time.Now()
+	state := testTailnetState(now)
+
+	tests := []struct {
+		name     string
+		manifest tailnetManifest
+	}{
+		{
+			name:     "duplicate-user",
+			manifest: tailnetManifest{Users: []manifestUser{{Name: "alice"}, {Name: "alice"}}},
+		},
+		{
+			name: "key-without-description",
+			manifest: tailnetManifest{Users: []manifestUser{
+				{Name: "alice", PreAuthKeys: []manifestPreAuthKey{{Reusable: true}}},
+			}},
+		},
+		{
+			name: "key-expired",
+			manifest: tailnetManifest{Users: []manifestUser{
+				{Name: "alice", PreAuthKeys: []manifestPreAuthKey{{Description: "new", Expiration: "2020-01-01T00:00:00Z"}}},
+			}},
+		},
+		{
+			name:     "invalid-route",
+			manifest: tailnetManifest{Nodes: []manifestNode{{Name: "web-1", ApprovedRoutes: &[]string{"10.0.0.0"}}}},
+		},
+		{
+			name:     "invalid-dns-record",
+			manifest: tailnetManifest{DNSRecords: []manifestDNSRecord{{Name: "a.example.com", Type: "A", Value: "fd7a::1"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := planTailnet(state, &tt.manifest, false, "", now)
+			assert.Error(t, err)
+		})
+	}
+}
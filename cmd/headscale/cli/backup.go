@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/juanfont/headscale/hscontrol"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const backupFileMode = 0o600
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+
+	createBackupCmd.Flags().StringP("file", "f", "", "Path of the backup to write")
+	if err := createBackupCmd.MarkFlagRequired("file"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	backupCmd.AddCommand(createBackupCmd)
+
+	restoreBackupCmd.Flags().StringP("file", "f", "", "Path of the backup to restore")
+	if err := restoreBackupCmd.MarkFlagRequired("file"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	restoreBackupCmd.Flags().Bool("force", false, "Replace private key files holding other keys than the backup")
+	backupCmd.AddCommand(restoreBackupCmd)
+}
+
+// backupResult describes a backup that was created or restored.
+type backupResult struct {
+	File             string `json:"file"`
+	Version          int    `json:"version"`
+	HeadscaleVersion string `json:"headscale_version"`
+	Migration        string `json:"migration"`
+	Users            int    `json:"users"`
+	Nodes            int    `json:"nodes"`
+}
+
+func newBackupResult(file string, backup *types.Backup) backupResult {
+	return backupResult{
+		File:             file,
+		Version:          backup.Version,
+		HeadscaleVersion: backup.HeadscaleVersion,
+		Migration:        backup.Migration,
+		Users:            len(backup.Users),
+		Nodes:            len(backup.Nodes),
+	}
+}
+
+// openDatabase opens the database of the configuration, like the server
+// does, and returns the configuration with it.
+func openDatabase() (*types.Config, *db.HSDatabase, error) {
+	cfg, err := types.LoadServerConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading configuration: %w", err)
+	}
+
+	hsdb, err := db.NewHeadscaleDatabase(cfg.Database, cfg.BaseDomain)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening database: %w", err)
+	}
+
+	return cfg, hsdb, nil
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Create and restore backups of the server",
+	Long: `
+	Backups hold the database and the private keys of the server. They are
+	written and restored with the database of the configuration file, on the
+	server running headscale.`,
+}
+
+var createBackupCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Write a backup of the server",
+	Long: `
+	Writes a backup of the database and of the private keys of the server.
+	The backup can be created while headscale is running. It holds the private
+	keys of the server, keep it safe.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		path, _ := cmd.Flags().GetString("file")
+
+		cfg, hsdb, err := openDatabase()
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error opening the database: %s", err), output)
+		}
+		defer hsdb.Close()
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, backupFileMode)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error creating the backup file: %s", err), output)
+		}
+
+		backup, err := hscontrol.WriteBackup(cfg, hsdb, f)
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+			ErrorOutput(err, fmt.Sprintf("Error writing the backup: %s", err), output)
+		}
+
+		SuccessOutput(
+			newBackupResult(path, backup),
+			fmt.Sprintf("Backup of %d users and %d nodes written to %s", len(backup.Users), len(backup.Nodes), path),
+			output,
+		)
+	},
+}
+
+var restoreBackupCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a backup to an empty database",
+	Long: `
+	Restores a backup to the database of the configuration, which must be empty,
+	and writes the private keys of the backup to the paths of the configuration.
+	The database can use another backend than the one the backup was created
+	from. Stop headscale before restoring a backup.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		path, _ := cmd.Flags().GetString("file")
+		force, _ := cmd.Flags().GetBool("force")
+
+		f, err := os.Open(path)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error opening the backup: %s", err), output)
+		}
+		defer f.Close()
+
+		backup, err := hscontrol.ReadBackup(f)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error reading the backup: %s", err), output)
+		}
+
+		cfg, hsdb, err := openDatabase()
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error opening the database: %s", err), output)
+		}
+		defer hsdb.Close()
+
+		if err := hscontrol.RestoreBackup(cfg, hsdb, backup, force); err != nil {
+			msg := fmt.Sprintf("Error restoring the backup: %s", err)
+			switch {
+			case errors.Is(err, types.ErrBackupPrivateKey):
+				msg += ", use --force to replace it"
+			case errors.Is(err, types.ErrBackupMigration):
+				msg += ", restore the backup with the version of headscale it was created with, " + backup.HeadscaleVersion
+			}
+			ErrorOutput(err, msg, output)
+		}
+
+		SuccessOutput(
+			newBackupResult(path, backup),
+			fmt.Sprintf("Restored %d users and %d nodes from %s", len(backup.Users), len(backup.Nodes), path),
+			output,
+		)
+	},
+}
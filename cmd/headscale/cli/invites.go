@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/prometheus/common/model"
+	"github.com/pterm/pterm"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const DefaultInviteExpiry = "7d"
+
+func init() {
+	rootCmd.AddCommand(invitesCmd)
+	invitesCmd.AddCommand(listInvitesCmd)
+
+	createInviteCmd.Flags().
+		StringP("email", "m", "", "Email of the invited person, required without OIDC")
+	createInviteCmd.Flags().
+		StringSliceP("tags", "t", []string{}, "Tags of the pre-auth key given with the invite")
+	createInviteCmd.Flags().
+		StringP("expires", "e", DefaultInviteExpiry, "Human-readable expiration of the invite (e.g. 30m, 24h, 7d)")
+	invitesCmd.AddCommand(createInviteCmd)
+
+	revokeInviteCmd.Flags().Uint64P("id", "i", 0, "Invite ID")
+	if err := revokeInviteCmd.MarkFlagRequired("id"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	invitesCmd.AddCommand(revokeInviteCmd)
+}
+
+var invitesCmd = &cobra.Command{
+	Use:     "invites",
+	Short:   "Handle the invites to onboard users",
+	Aliases: []string{"invite", "inv"},
+}
+
+var listInvitesCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List the invites",
+	Aliases: []string{"ls", "show"},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.ListInvites(ctx, &v1.ListInvitesRequest{})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Error getting the list of invites: %s", err),
+				output,
+			)
+		}
+
+		if output != "" {
+			SuccessOutput(response.GetInvites(), "", output)
+		}
+
+		tableData := pterm.TableData{
+			{"ID", "Prefix", "Email", "Tags", "Status", "User", "Expiration", "Created"},
+		}
+		for _, invite := range response.GetInvites() {
+			expiration := "-"
+			if invite.GetExpiration() != nil {
+				expiration = ColourTime(invite.GetExpiration().AsTime())
+			}
+
+			user := "-"
+			if invite.GetUserId() != 0 {
+				user = strconv.FormatUint(invite.GetUserId(), util.Base10)
+			}
+
+			tableData = append(tableData, []string{
+				strconv.FormatUint(invite.GetId(), util.Base10),
+				invite.GetPrefix(),
+				invite.GetEmail(),
+				strings.Join(invite.GetTags(), ", "),
+				invite.GetStatus(),
+				user,
+				expiration,
+				invite.GetCreatedAt().AsTime().Format(HeadscaleDateTimeFormat),
+			})
+		}
+		err = pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Failed to render pterm table: %s", err),
+				output,
+			)
+		}
+	},
+}
+
+var createInviteCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a new invite",
+	Long: `
+Creates a one-time invite link. Opening it shows how to install Tailscale,
+and accepting it logs the invited person in with OIDC, or creates a local
+user with the email of the invite, and gives them a pre-auth key with the
+tags of the invite.
+The link is only visible on creation and cannot be retrieved again.`,
+	Aliases: []string{"c", "new"},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		email, _ := cmd.Flags().GetString("email")
+		tags, _ := cmd.Flags().GetStringSlice("tags")
+
+		request := &v1.CreateInviteRequest{
+			Email: email,
+			Tags:  tags,
+		}
+
+		durationStr, _ := cmd.Flags().GetString("expires")
+		duration, err := model.ParseDuration(durationStr)
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Could not parse duration: %s\n", err),
+				output,
+			)
+		}
+		request.Expiration = timestamppb.New(time.Now().UTC().Add(time.Duration(duration)))
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.CreateInvite(ctx, request)
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot create invite: %s\n", err),
+				output,
+			)
+		}
+
+		SuccessOutput(response, response.GetUrl(), output)
+	},
+}
+
+var revokeInviteCmd = &cobra.Command{
+	Use:     "revoke",
+	Short:   "Revoke an invite, and expire the pre-auth key given with it",
+	Aliases: []string{"expire"},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		id, _ := cmd.Flags().GetUint64("id")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.RevokeInvite(ctx, &v1.RevokeInviteRequest{Id: id})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot revoke invite: %s\n", err),
+				output,
+			)
+		}
+
+		SuccessOutput(response.GetInvite(), "Invite revoked", output)
+	},
+}
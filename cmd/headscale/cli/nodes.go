@@ -1,8 +1,10 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/netip"
 	"slices"
 	"strconv"
@@ -23,6 +25,10 @@ func init() {
 	rootCmd.AddCommand(nodeCmd)
 	listNodesCmd.Flags().StringP("user", "u", "", "Filter by user")
 	listNodesCmd.Flags().BoolP("tags", "t", false, "Show tags")
+	listNodesCmd.Flags().BoolP("labels", "l", false, "Show labels")
+	listNodesCmd.Flags().StringP("filter", "f", "", `Filter expression, e.g. "tag:db && !online"`)
+	listNodesCmd.Flags().String("order-by", "", `Sort order, e.g. "last_seen desc"`)
+	listNodesCmd.Flags().Int("limit", 0, "Maximum number of nodes to list (0 for all)")
 
 	listNodesCmd.Flags().StringP("namespace", "n", "", "User")
 	listNodesNamespaceFlag := listNodesCmd.Flags().Lookup("namespace")
@@ -97,6 +103,10 @@ func init() {
 	tagCmd.Flags().StringSliceP("tags", "t", []string{}, "List of tags to add to the node")
 	nodeCmd.AddCommand(tagCmd)
 
+	labelNodeCmd.Flags().Uint64P("identifier", "i", 0, "Node identifier (ID)")
+	labelNodeCmd.MarkFlagRequired("identifier")
+	nodeCmd.AddCommand(labelNodeCmd)
+
 	approveRoutesCmd.Flags().Uint64P("identifier", "i", 0, "Node identifier (ID)")
 	approveRoutesCmd.MarkFlagRequired("identifier")
 	approveRoutesCmd.Flags().StringSliceP("routes", "r", []string{}, `List of routes that will be approved (comma-separated, e.g. "10.0.0.0/8,192.168.0.0/24" or empty string to remove all approved routes)`)
@@ -157,6 +167,10 @@ var registerNodeCmd = &cobra.Command{
 	},
 }
 
+// listNodesPageSize is the number of nodes fetched per request by
+// "nodes list".
+const listNodesPageSize = 500
+
 var listNodesCmd = &cobra.Command{
 	Use:     "list",
 	Short:   "List nodes",
@@ -171,29 +185,51 @@ var listNodesCmd = &cobra.Command{
 		if err != nil {
 			ErrorOutput(err, fmt.Sprintf("Error getting tags flag: %s", err), output)
 		}
+		showLabels, _ := cmd.Flags().GetBool("labels")
+		filter, _ := cmd.Flags().GetString("filter")
+		orderBy, _ := cmd.Flags().GetString("order-by")
+		limit, _ := cmd.Flags().GetInt("limit")
 
 		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
 		defer cancel()
 		defer conn.Close()
 
 		request := &v1.ListNodesRequest{
-			User: user,
+			User:     user,
+			Filter:   filter,
+			OrderBy:  orderBy,
+			PageSize: listNodesPageSize,
 		}
 
-		response, err := client.ListNodes(ctx, request)
-		if err != nil {
-			ErrorOutput(
-				err,
-				fmt.Sprintf("Cannot get nodes: %s", status.Convert(err).Message()),
-				output,
-			)
+		// Fetch the nodes page by page, until the last page or the limit.
+		var nodes []*v1.Node
+		for {
+			response, err := client.ListNodes(ctx, request)
+			if err != nil {
+				ErrorOutput(
+					err,
+					fmt.Sprintf("Cannot get nodes: %s", status.Convert(err).Message()),
+					output,
+				)
+			}
+
+			nodes = append(nodes, response.GetNodes()...)
+			if limit > 0 && len(nodes) >= limit {
+				nodes = nodes[:limit]
+				break
+			}
+
+			if response.GetNextPageToken() == "" {
+				break
+			}
+			request.PageToken = response.GetNextPageToken()
 		}
 
 		if output != "" {
-			SuccessOutput(response.GetNodes(), "", output)
+			SuccessOutput(nodes, "", output)
 		}
 
-		tableData, err := nodesToPtables(user, showTags, response.GetNodes())
+		tableData, err := nodesToPtables(user, showTags, showLabels, nodes)
 		if err != nil {
 			ErrorOutput(err, fmt.Sprintf("Error converting to table: %s", err), output)
 		}
@@ -585,6 +621,7 @@ be assigned to nodes.`,
 func nodesToPtables(
 	currentUser string,
 	showTags bool,
+	showLabels bool,
 	nodes []*v1.Node,
 ) (pterm.TableData, error) {
 	tableHeader := []string{
@@ -608,6 +645,9 @@ func nodesToPtables(
 			"ValidTags",
 		}...)
 	}
+	if showLabels {
+		tableHeader = append(tableHeader, "Labels")
+	}
 	tableData := pterm.TableData{tableHeader}
 
 	for _, node := range nodes {
@@ -717,6 +757,9 @@ func nodesToPtables(
 		if showTags {
 			nodeData = append(nodeData, []string{forcedTags, invalidTags, validTags}...)
 		}
+		if showLabels {
+			nodeData = append(nodeData, formatLabels(node.GetLabels()))
+		}
 		tableData = append(
 			tableData,
 			nodeData,
@@ -726,6 +769,16 @@ func nodesToPtables(
 	return tableData, nil
 }
 
+// formatLabels formats labels as "key=value" pairs, sorted by key.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
 func nodeRoutesToPtables(
 	nodes []*v1.Node,
 ) (pterm.TableData, error) {
@@ -869,3 +922,61 @@ var approveRoutesCmd = &cobra.Command{
 		}
 	},
 }
+
+var errInvalidLabelArg = errors.New("invalid label argument")
+
+var labelNodeCmd = &cobra.Command{
+	Use:   "label KEY=VALUE... KEY-...",
+	Short: "Set or remove the labels of a node",
+	Long: `Set or remove the labels of a node.
+
+"key=value" sets the label key to value, "key-" removes the label key.
+Other labels of the node are kept.`,
+	Aliases: []string{"labels"},
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		identifier, err := cmd.Flags().GetUint64("identifier")
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Error converting ID to integer: %s", err),
+				output,
+			)
+		}
+
+		request := &v1.LabelNodeRequest{
+			NodeId: identifier,
+			Labels: map[string]string{},
+		}
+		for _, arg := range args {
+			if key, value, ok := strings.Cut(arg, "="); ok {
+				request.Labels[key] = value
+			} else if key, ok := strings.CutSuffix(arg, "-"); ok {
+				request.Remove = append(request.Remove, key)
+			} else {
+				ErrorOutput(
+					errInvalidLabelArg,
+					fmt.Sprintf("Invalid label %q, expected key=value or key-", arg),
+					output,
+				)
+			}
+		}
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.LabelNode(ctx, request)
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot label node: %s", status.Convert(err).Message()),
+				output,
+			)
+		}
+
+		SuccessOutput(response.GetNode(), "Node updated", output)
+	},
+}
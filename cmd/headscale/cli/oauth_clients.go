@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/prometheus/common/model"
+	"github.com/pterm/pterm"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func init() {
+	rootCmd.AddCommand(oauthClientsCmd)
+	oauthClientsCmd.AddCommand(listOAuthClientsCmd)
+
+	createOAuthClientCmd.Flags().
+		StringSliceP("scope", "s", []string{}, "Scopes granted to the client (all, users, nodes, auth_keys, policy, optionally suffixed with :read)")
+	if err := createOAuthClientCmd.MarkFlagRequired("scope"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	createOAuthClientCmd.Flags().
+		StringSliceP("tags", "t", []string{}, "Tags the client can give to the pre-auth keys it creates")
+	createOAuthClientCmd.Flags().
+		StringP("description", "d", "", "Description of the client")
+	createOAuthClientCmd.Flags().
+		StringP("expiration", "e", "", "Human-readable expiration of the client (e.g. 30d), never expires if empty")
+	oauthClientsCmd.AddCommand(createOAuthClientCmd)
+
+	deleteOAuthClientCmd.Flags().StringP("client-id", "i", "", "OAuth client ID")
+	if err := deleteOAuthClientCmd.MarkFlagRequired("client-id"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	oauthClientsCmd.AddCommand(deleteOAuthClientCmd)
+}
+
+var oauthClientsCmd = &cobra.Command{
+	Use:     "oauth-clients",
+	Short:   "Handle the OAuth clients in Headscale",
+	Aliases: []string{"oauth-client", "oauth"},
+}
+
+var listOAuthClientsCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List the OAuth clients for headscale",
+	Aliases: []string{"ls", "show"},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.ListOAuthClients(ctx, &v1.ListOAuthClientsRequest{})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Error getting the list of OAuth clients: %s", err),
+				output,
+			)
+		}
+
+		if output != "" {
+			SuccessOutput(response.GetOauthClients(), "", output)
+		}
+
+		tableData := pterm.TableData{
+			{"ID", "Client ID", "Scopes", "Tags", "Description", "Expiration", "Last seen", "Created"},
+		}
+		for _, oauthClient := range response.GetOauthClients() {
+			expiration := "-"
+			if oauthClient.GetExpiration() != nil {
+				expiration = ColourTime(oauthClient.GetExpiration().AsTime())
+			}
+
+			lastSeen := "-"
+			if oauthClient.GetLastSeen() != nil {
+				lastSeen = oauthClient.GetLastSeen().AsTime().Format(HeadscaleDateTimeFormat)
+			}
+
+			tableData = append(tableData, []string{
+				strconv.FormatUint(oauthClient.GetId(), util.Base10),
+				oauthClient.GetClientId(),
+				strings.Join(oauthClient.GetScopes(), ", "),
+				strings.Join(oauthClient.GetTags(), ", "),
+				oauthClient.GetDescription(),
+				expiration,
+				lastSeen,
+				oauthClient.GetCreatedAt().AsTime().Format(HeadscaleDateTimeFormat),
+			})
+		}
+		err = pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Failed to render pterm table: %s", err),
+				output,
+			)
+		}
+	},
+}
+
+var createOAuthClientCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a new OAuth client",
+	Long: `
+Creates a new OAuth client, which exchanges its client ID and secret
+at /oauth/token for access tokens to the API, valid for one hour.
+The secret is only visible on creation and cannot be retrieved again.`,
+	Aliases: []string{"c", "new"},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		tags, _ := cmd.Flags().GetStringSlice("tags")
+		description, _ := cmd.Flags().GetString("description")
+
+		request := &v1.CreateOAuthClientRequest{
+			Scopes:      scopes,
+			Tags:        tags,
+			Description: description,
+		}
+
+		if durationStr, _ := cmd.Flags().GetString("expiration"); durationStr != "" {
+			duration, err := model.ParseDuration(durationStr)
+			if err != nil {
+				ErrorOutput(
+					err,
+					fmt.Sprintf("Could not parse duration: %s\n", err),
+					output,
+				)
+			}
+
+			request.Expiration = timestamppb.New(time.Now().UTC().Add(time.Duration(duration)))
+		}
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.CreateOAuthClient(ctx, request)
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot create OAuth client: %s\n", err),
+				output,
+			)
+		}
+
+		SuccessOutput(
+			response,
+			fmt.Sprintf(
+				"Client ID: %s\nClient secret: %s",
+				response.GetOauthClient().GetClientId(),
+				response.GetClientSecret(),
+			),
+			output,
+		)
+	},
+}
+
+var deleteOAuthClientCmd = &cobra.Command{
+	Use:     "delete",
+	Short:   "Delete an OAuth client, its access tokens stop working",
+	Aliases: []string{"remove", "del"},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		clientID, _ := cmd.Flags().GetString("client-id")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.DeleteOAuthClient(ctx, &v1.DeleteOAuthClientRequest{
+			ClientId: clientID,
+		})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot delete OAuth client: %s\n", err),
+				output,
+			)
+		}
+
+		SuccessOutput(response, "OAuth client deleted", output)
+	},
+}
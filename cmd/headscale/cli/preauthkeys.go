@@ -11,6 +11,7 @@ import (
 	"github.com/pterm/pterm"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -34,6 +35,7 @@ func init() {
 	preauthkeysCmd.AddCommand(listPreAuthKeys)
 	preauthkeysCmd.AddCommand(createPreAuthKeyCmd)
 	preauthkeysCmd.AddCommand(expirePreAuthKeyCmd)
+	preauthkeysCmd.AddCommand(listPreAuthKeyNodesCmd)
 	createPreAuthKeyCmd.PersistentFlags().
 		Bool("reusable", false, "Make the preauthkey reusable")
 	createPreAuthKeyCmd.PersistentFlags().
@@ -42,6 +44,18 @@ func init() {
 		StringP("expiration", "e", DefaultPreAuthKeyExpiry, "Human-readable expiration of the key (e.g. 30m, 24h)")
 	createPreAuthKeyCmd.Flags().
 		StringSlice("tags", []string{}, "Tags to automatically assign to node")
+	createPreAuthKeyCmd.Flags().
+		String("description", "", "Description of the preauthkey")
+	createPreAuthKeyCmd.Flags().
+		Uint32("max-uses", 0, "Number of nodes the preauthkey can register (default once, unlimited if reusable)")
+	createPreAuthKeyCmd.Flags().
+		String("hostname", "", "Glob the hostname of the nodes must match (e.g. 'web-*')")
+	createPreAuthKeyCmd.Flags().
+		StringSlice("os", []string{}, "Operating systems the nodes may run (e.g. linux,windows)")
+	createPreAuthKeyCmd.Flags().
+		String("node-expiry", "", "Human-readable longest expiry of the nodes (e.g. 30d)")
+	createPreAuthKeyCmd.Flags().
+		StringSlice("approve-routes", []string{}, "Routes to approve for the nodes")
 }
 
 var preauthkeysCmd = &cobra.Command{
@@ -88,10 +102,13 @@ var listPreAuthKeys = &cobra.Command{
 		tableData := pterm.TableData{
 			{
 				"ID",
-				"Key",
+				"Prefix",
+				"Description",
 				"Reusable",
 				"Ephemeral",
 				"Used",
+				"Uses",
+				"Nodes",
 				"Expiration",
 				"Created",
 				"Tags",
@@ -111,12 +128,25 @@ var listPreAuthKeys = &cobra.Command{
 
 			aclTags = strings.TrimLeft(aclTags, ",")
 
+			uses := strconv.FormatUint(uint64(key.GetUseCount()), 10)
+			if key.GetMaxUses() > 0 {
+				uses += "/" + strconv.FormatUint(uint64(key.GetMaxUses()), 10)
+			}
+
+			nodeIDs := make([]string, 0, len(key.GetNodeIds()))
+			for _, id := range key.GetNodeIds() {
+				nodeIDs = append(nodeIDs, strconv.FormatUint(id, 10))
+			}
+
 			tableData = append(tableData, []string{
 				strconv.FormatUint(key.GetId(), 10),
-				key.GetKey(),
+				key.GetPrefix(),
+				key.GetDescription(),
 				strconv.FormatBool(key.GetReusable()),
 				strconv.FormatBool(key.GetEphemeral()),
 				strconv.FormatBool(key.GetUsed()),
+				uses,
+				strings.Join(nodeIDs, ","),
 				expiration,
 				key.GetCreatedAt().AsTime().Format("2006-01-02 15:04:05"),
 				aclTags,
@@ -150,11 +180,37 @@ var createPreAuthKeyCmd = &cobra.Command{
 		ephemeral, _ := cmd.Flags().GetBool("ephemeral")
 		tags, _ := cmd.Flags().GetStringSlice("tags")
 
+		description, _ := cmd.Flags().GetString("description")
+		maxUses, _ := cmd.Flags().GetUint32("max-uses")
+		hostname, _ := cmd.Flags().GetString("hostname")
+		allowedOS, _ := cmd.Flags().GetStringSlice("os")
+		approveRoutes, _ := cmd.Flags().GetStringSlice("approve-routes")
+
 		request := &v1.CreatePreAuthKeyRequest{
-			User:      user,
-			Reusable:  reusable,
-			Ephemeral: ephemeral,
-			AclTags:   tags,
+			User:        user,
+			Reusable:    reusable,
+			Ephemeral:   ephemeral,
+			AclTags:     tags,
+			Description: description,
+			MaxUses:     maxUses,
+			Constraints: &v1.PreAuthKeyConstraints{
+				HostnamePattern: hostname,
+				AllowedOs:       allowedOS,
+				ApprovedRoutes:  approveRoutes,
+			},
+		}
+
+		if nodeExpiryStr, _ := cmd.Flags().GetString("node-expiry"); nodeExpiryStr != "" {
+			nodeExpiry, err := model.ParseDuration(nodeExpiryStr)
+			if err != nil {
+				ErrorOutput(
+					err,
+					fmt.Sprintf("Could not parse node expiry: %s\n", err),
+					output,
+				)
+			}
+
+			request.Constraints.NodeExpiry = durationpb.New(time.Duration(nodeExpiry))
 		}
 
 		durationStr, _ := cmd.Flags().GetString("expiration")
@@ -194,8 +250,8 @@ var createPreAuthKeyCmd = &cobra.Command{
 }
 
 var expirePreAuthKeyCmd = &cobra.Command{
-	Use:     "expire KEY",
-	Short:   "Expire a preauthkey",
+	Use:     "expire PREFIX",
+	Short:   "Expire a preauthkey, by its prefix or full key",
 	Aliases: []string{"revoke", "exp", "e"},
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
@@ -232,3 +288,56 @@ var expirePreAuthKeyCmd = &cobra.Command{
 		SuccessOutput(response, "Key expired", output)
 	},
 }
+
+var listPreAuthKeyNodesCmd = &cobra.Command{
+	Use:   "nodes ID",
+	Short: "List the nodes registered with a preauthkey",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errMissingParameter
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error parsing preauthkey ID: %s", err), output)
+		}
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.ListNodesByPreAuthKey(ctx, &v1.ListNodesByPreAuthKeyRequest{
+			Id: id,
+		})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Error getting the nodes of the key: %s", err),
+				output,
+			)
+		}
+
+		if output != "" {
+			SuccessOutput(response.GetNodes(), "", output)
+		}
+
+		tableData, err := nodesToPtables("", false, false, response.GetNodes())
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error converting to table: %s", err), output)
+		}
+
+		err = pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Failed to render pterm table: %s", err),
+				output,
+			)
+		}
+	},
+}
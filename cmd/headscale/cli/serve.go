@@ -1,8 +1,10 @@
 package cli
 
 import (
-	"errors"
-	"net/http"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -24,8 +26,33 @@ var serveCmd = &cobra.Command{
 			log.Fatal().Caller().Err(err).Msg("Error initializing")
 		}
 
-		err = app.Serve()
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		// Handle common process-killing signals so we can gracefully shut down:
+		ctx, stop := signal.NotifyContext(context.Background(),
+			syscall.SIGINT,
+			syscall.SIGTERM,
+			syscall.SIGQUIT)
+		defer stop()
+
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		defer signal.Stop(sighup)
+
+		go func() {
+			for {
+				select {
+				case <-sighup:
+					log.Info().
+						Str("signal", syscall.SIGHUP.String()).
+						Msg("Received SIGHUP, reloading ACL and Config")
+					app.ReloadPolicy()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		err = app.Serve(ctx)
+		if err != nil {
 			log.Fatal().Caller().Err(err).Msg("Headscale ran into an error and had to shut down.")
 		}
 	},
@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 
 	survey "github.com/AlecAivazis/survey/v2"
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
@@ -49,10 +51,31 @@ func init() {
 	listUsersCmd.Flags().StringP("email", "e", "", "Email")
 	userCmd.AddCommand(destroyUserCmd)
 	usernameAndIDFlag(destroyUserCmd)
+	destroyUserCmd.Flags().String("transfer-to", "", "Name or ID of the user receiving the nodes and pre auth keys")
+	destroyUserCmd.Flags().Bool("delete-nodes", false, "Delete the nodes of the user")
+	destroyUserCmd.Flags().Bool("expire-nodes", false, "Expire the nodes moved with --transfer-to")
+	destroyUserCmd.MarkFlagsMutuallyExclusive("transfer-to", "delete-nodes")
+	userCmd.AddCommand(disableUserCmd)
+	usernameAndIDFlag(disableUserCmd)
+	userCmd.AddCommand(enableUserCmd)
+	usernameAndIDFlag(enableUserCmd)
+	userCmd.AddCommand(userQuotaCmd)
+	usernameAndIDFlag(userQuotaCmd)
+	userQuotaCmd.Flags().Int32("max-nodes", 0, "Maximum number of nodes, 0 is unlimited")
+	userQuotaCmd.Flags().Int32("max-ephemeral-nodes", 0, "Maximum number of ephemeral nodes, 0 is unlimited")
+	userQuotaCmd.Flags().Int32("max-pre-auth-keys", 0, "Maximum number of active pre auth keys, 0 is unlimited")
+	userQuotaCmd.Flags().Int32("max-routes", 0, "Maximum number of approved routes, 0 is unlimited")
 	userCmd.AddCommand(renameUserCmd)
 	usernameAndIDFlag(renameUserCmd)
 	renameUserCmd.Flags().StringP("new-name", "r", "", "New username")
 	renameNodeCmd.MarkFlagRequired("new-name")
+	userCmd.AddCommand(mergeUsersCmd)
+	mergeUsersCmd.Flags().String("from", "", "Name or ID of the user to merge, which is deleted")
+	mergeUsersCmd.Flags().String("into", "", "Name or ID of the user receiving the nodes and pre auth keys")
+	mergeUsersCmd.MarkFlagRequired("from")
+	mergeUsersCmd.MarkFlagRequired("into")
+	userCmd.AddCommand(listUserLinksCmd)
+	usernameAndIDFlag(listUserLinksCmd)
 }
 
 var errMissingParameter = errors.New("missing parameters")
@@ -130,8 +153,16 @@ var destroyUserCmd = &cobra.Command{
 	Use:     "destroy --identifier ID or --name NAME",
 	Short:   "Destroys a user",
 	Aliases: []string{"delete"},
+	Long: `
+	Destroys a user and its pre auth keys. A user with nodes is only destroyed
+	with --transfer-to, which moves its nodes and pre auth keys to another
+	user, optionally expiring the nodes with --expire-nodes, or with
+	--delete-nodes, which deletes its nodes.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		output, _ := cmd.Flags().GetString("output")
+		transferTo, _ := cmd.Flags().GetString("transfer-to")
+		deleteNodes, _ := cmd.Flags().GetBool("delete-nodes")
+		expireNodes, _ := cmd.Flags().GetBool("expire-nodes")
 
 		id, username := usernameAndIDFromFlag(cmd)
 		request := &v1.ListUsersRequest{
@@ -162,15 +193,40 @@ var destroyUserCmd = &cobra.Command{
 		}
 
 		user := users.GetUsers()[0]
+		deleteRequest := &v1.DeleteUserRequest{
+			Id:          user.GetId(),
+			DeleteNodes: deleteNodes,
+			ExpireNodes: expireNodes,
+		}
+
+		message := fmt.Sprintf(
+			"Do you want to remove the user %q (%d) and any associated preauthkeys?",
+			user.GetName(), user.GetId(),
+		)
+		switch {
+		case transferTo != "":
+			target, err := findUser(ctx, client, transferTo)
+			if err != nil {
+				ErrorOutput(err, fmt.Sprintf("Error: %s", status.Convert(err).Message()), output)
+			}
+			deleteRequest.TransferTo = target.GetId()
+
+			message = fmt.Sprintf(
+				"Do you want to move the nodes and pre auth keys of %q (%d) to %q (%d), and remove %q?",
+				user.GetName(), user.GetId(), target.GetName(), target.GetId(), user.GetName(),
+			)
+		case deleteNodes:
+			message = fmt.Sprintf(
+				"Do you want to remove the user %q (%d), its nodes and any associated preauthkeys?",
+				user.GetName(), user.GetId(),
+			)
+		}
 
 		confirm := false
 		force, _ := cmd.Flags().GetBool("force")
 		if !force {
 			prompt := &survey.Confirm{
-				Message: fmt.Sprintf(
-					"Do you want to remove the user %q (%d) and any associated preauthkeys?",
-					user.GetName(), user.GetId(),
-				),
+				Message: message,
 			}
 			err := survey.AskOne(prompt, &confirm)
 			if err != nil {
@@ -179,9 +235,7 @@ var destroyUserCmd = &cobra.Command{
 		}
 
 		if confirm || force {
-			request := &v1.DeleteUserRequest{Id: user.GetId()}
-
-			response, err := client.DeleteUser(ctx, request)
+			response, err := client.DeleteUser(ctx, deleteRequest)
 			if err != nil {
 				ErrorOutput(
 					err,
@@ -242,8 +296,15 @@ var listUsersCmd = &cobra.Command{
 			SuccessOutput(response.GetUsers(), "", output)
 		}
 
-		tableData := pterm.TableData{{"ID", "Name", "Username", "Email", "Created"}}
+		tableData := pterm.TableData{
+			{"ID", "Name", "Username", "Email", "Created", "Disabled", "Nodes", "Ephemeral", "Keys", "Routes"},
+		}
 		for _, user := range response.GetUsers() {
+			var disabled string
+			if user.GetDisabledAt() != nil {
+				disabled = user.GetDisabledAt().AsTime().Format("2006-01-02 15:04:05")
+			}
+
 			tableData = append(
 				tableData,
 				[]string{
@@ -252,6 +313,11 @@ var listUsersCmd = &cobra.Command{
 					user.GetName(),
 					user.GetEmail(),
 					user.GetCreatedAt().AsTime().Format("2006-01-02 15:04:05"),
+					disabled,
+					quotaUsage(user.GetUsage().GetNodes(), user.GetQuota().GetMaxNodes()),
+					quotaUsage(user.GetUsage().GetEphemeralNodes(), user.GetQuota().GetMaxEphemeralNodes()),
+					quotaUsage(user.GetUsage().GetPreAuthKeys(), user.GetQuota().GetMaxPreAuthKeys()),
+					quotaUsage(user.GetUsage().GetRoutes(), user.GetQuota().GetMaxRoutes()),
 				},
 			)
 		}
@@ -323,3 +389,292 @@ var renameUserCmd = &cobra.Command{
 		SuccessOutput(response.GetUser(), "User renamed", output)
 	},
 }
+
+// findUser returns the user with the given ID, or else with the given
+// name.
+func findUser(ctx context.Context, client v1.HeadscaleServiceClient, nameOrID string) (*v1.User, error) {
+	request := &v1.ListUsersRequest{Name: nameOrID}
+	if id, err := strconv.ParseUint(nameOrID, 10, 64); err == nil {
+		request = &v1.ListUsersRequest{Id: id}
+	}
+
+	response, err := client.ListUsers(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(response.GetUsers()) {
+	case 0:
+		return nil, fmt.Errorf("user %q not found", nameOrID)
+	case 1:
+		return response.GetUsers()[0], nil
+	default:
+		return nil, fmt.Errorf("several users are named %q, use the ID", nameOrID)
+	}
+}
+
+var mergeUsersCmd = &cobra.Command{
+	Use:   "merge --from USER --into USER",
+	Short: "Merges a user into another",
+	Long: `
+	Moves the nodes and pre auth keys of a user to another user, and deletes
+	the merged user. If only the merged user has an OIDC identity, it moves to
+	the other user, whose next OIDC logins use it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		fromFlag, _ := cmd.Flags().GetString("from")
+		intoFlag, _ := cmd.Flags().GetString("into")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		from, err := findUser(ctx, client, fromFlag)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error: %s", status.Convert(err).Message()), output)
+		}
+
+		into, err := findUser(ctx, client, intoFlag)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error: %s", status.Convert(err).Message()), output)
+		}
+
+		confirm := false
+		force, _ := cmd.Flags().GetBool("force")
+		if !force {
+			prompt := &survey.Confirm{
+				Message: fmt.Sprintf(
+					"Do you want to move the nodes and pre auth keys of %q (%d) to %q (%d), and remove %q?",
+					from.GetName(), from.GetId(), into.GetName(), into.GetId(), from.GetName(),
+				),
+			}
+			err := survey.AskOne(prompt, &confirm)
+			if err != nil {
+				return
+			}
+		}
+
+		if !confirm && !force {
+			SuccessOutput(map[string]string{"Result": "Users not merged"}, "Users not merged", output)
+		}
+
+		response, err := client.MergeUsers(ctx, &v1.MergeUsersRequest{
+			FromId: from.GetId(),
+			IntoId: into.GetId(),
+		})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot merge users: %s", status.Convert(err).Message()),
+				output,
+			)
+		}
+
+		SuccessOutput(response.GetUser(), "Users merged", output)
+	},
+}
+
+// userFromFlag returns the user selected with the flags of
+// usernameAndIDFlag.
+func userFromFlag(ctx context.Context, client v1.HeadscaleServiceClient, cmd *cobra.Command) (*v1.User, error) {
+	id, username := usernameAndIDFromFlag(cmd)
+
+	response, err := client.ListUsers(ctx, &v1.ListUsersRequest{Name: username, Id: id})
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(response.GetUsers()) {
+	case 0:
+		return nil, errors.New("user not found")
+	case 1:
+		return response.GetUsers()[0], nil
+	default:
+		return nil, errors.New("several users match, use the ID")
+	}
+}
+
+var disableUserCmd = &cobra.Command{
+	Use:   "disable --identifier ID or --name NAME",
+	Short: "Disables a user",
+	Long: `
+	Disables a user and expires its nodes. A disabled user cannot log in or
+	register nodes, its nodes, pre auth keys and history are kept.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		user, err := userFromFlag(ctx, client, cmd)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error: %s", status.Convert(err).Message()), output)
+		}
+
+		response, err := client.DisableUser(ctx, &v1.DisableUserRequest{Id: user.GetId()})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot disable user: %s", status.Convert(err).Message()),
+				output,
+			)
+		}
+
+		SuccessOutput(response.GetUser(), "User disabled", output)
+	},
+}
+
+var enableUserCmd = &cobra.Command{
+	Use:   "enable --identifier ID or --name NAME",
+	Short: "Enables a disabled user",
+	Long: `
+	Enables a disabled user. Its nodes stay expired until they log in again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		user, err := userFromFlag(ctx, client, cmd)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error: %s", status.Convert(err).Message()), output)
+		}
+
+		response, err := client.EnableUser(ctx, &v1.EnableUserRequest{Id: user.GetId()})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot enable user: %s", status.Convert(err).Message()),
+				output,
+			)
+		}
+
+		SuccessOutput(response.GetUser(), "User enabled", output)
+	},
+}
+
+// quotaUsage formats the usage of a quota as used/limit, or only used
+// without a limit.
+func quotaUsage(used, limit int32) string {
+	if limit == 0 {
+		return strconv.Itoa(int(used))
+	}
+
+	return fmt.Sprintf("%d/%d", used, limit)
+}
+
+var userQuotaCmd = &cobra.Command{
+	Use:   "quota --identifier ID or --name NAME",
+	Short: "Sets the quota of a user",
+	Long: `
+	Sets the limits on the nodes, ephemeral nodes, active pre auth keys and
+	approved routes of a user, replacing its previous limits. The limits that
+	are not given use the default from the configuration, 0 is unlimited.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		quota := &v1.QuotaLimits{}
+		for flag, limit := range map[string]**int32{
+			"max-nodes":           &quota.MaxNodes,
+			"max-ephemeral-nodes": &quota.MaxEphemeralNodes,
+			"max-pre-auth-keys":   &quota.MaxPreAuthKeys,
+			"max-routes":          &quota.MaxRoutes,
+		} {
+			if cmd.Flags().Changed(flag) {
+				value, _ := cmd.Flags().GetInt32(flag)
+				*limit = &value
+			}
+		}
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		user, err := userFromFlag(ctx, client, cmd)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error: %s", status.Convert(err).Message()), output)
+		}
+
+		response, err := client.SetUserQuota(ctx, &v1.SetUserQuotaRequest{
+			Id:    user.GetId(),
+			Quota: quota,
+		})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot set user quota: %s", status.Convert(err).Message()),
+				output,
+			)
+		}
+
+		SuccessOutput(response.GetUser(), "User quota set", output)
+	},
+}
+
+var listUserLinksCmd = &cobra.Command{
+	Use:   "links",
+	Short: "List the identities linked to users",
+	Long: `
+	Lists the users merged into other users, and the OIDC logins linked to
+	existing users by their email.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		request := &v1.ListUserLinksRequest{}
+
+		id, _ := cmd.Flags().GetInt64("identifier")
+		username, _ := cmd.Flags().GetString("name")
+		switch {
+		case id > 0:
+			request.UserId = uint64(id)
+		case username != "":
+			user, err := findUser(ctx, client, username)
+			if err != nil {
+				ErrorOutput(err, fmt.Sprintf("Error: %s", status.Convert(err).Message()), output)
+			}
+			request.UserId = user.GetId()
+		}
+
+		response, err := client.ListUserLinks(ctx, request)
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot get user links: %s", status.Convert(err).Message()),
+				output,
+			)
+		}
+
+		if output != "" {
+			SuccessOutput(response.GetLinks(), "", output)
+		}
+
+		tableData := pterm.TableData{{"ID", "User ID", "Kind", "Source", "Email", "Created"}}
+		for _, link := range response.GetLinks() {
+			tableData = append(
+				tableData,
+				[]string{
+					strconv.FormatUint(link.GetId(), 10),
+					strconv.FormatUint(link.GetUserId(), 10),
+					link.GetKind(),
+					link.GetSource(),
+					link.GetEmail(),
+					link.GetCreatedAt().AsTime().Format(HeadscaleDateTimeFormat),
+				},
+			)
+		}
+		err = pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Failed to render pterm table: %s", err),
+				output,
+			)
+		}
+	},
+}
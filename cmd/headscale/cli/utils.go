@@ -11,6 +11,7 @@ import (
 	"github.com/juanfont/headscale/hscontrol"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -32,6 +33,8 @@ func newHeadscaleServerWithConfig() (*hscontrol.Headscale, error) {
 		)
 	}
 
+	zerolog.SetGlobalLevel(cfg.Log.Level)
+
 	app, err := hscontrol.NewHeadscale(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("creating new headscale: %w", err)
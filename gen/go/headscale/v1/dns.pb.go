@@ -0,0 +1,324 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: headscale/v1/dns.proto
+
+package v1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// DNSRecord is an extra DNS record served to the nodes, an A or AAAA
+// record.
+type DNSRecord struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DNSRecord) Reset() {
+	*x = DNSRecord{}
+	mi := &file_headscale_v1_dns_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DNSRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSRecord) ProtoMessage() {}
+
+func (x *DNSRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_headscale_v1_dns_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSRecord.ProtoReflect.Descriptor instead.
+func (*DNSRecord) Descriptor() ([]byte, []int) {
+	return file_headscale_v1_dns_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DNSRecord) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type ListDNSRecordsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDNSRecordsRequest) Reset() {
+	*x = ListDNSRecordsRequest{}
+	mi := &file_headscale_v1_dns_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDNSRecordsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDNSRecordsRequest) ProtoMessage() {}
+
+func (x *ListDNSRecordsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_headscale_v1_dns_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDNSRecordsRequest.ProtoReflect.Descriptor instead.
+func (*ListDNSRecordsRequest) Descriptor() ([]byte, []int) {
+	return file_headscale_v1_dns_proto_rawDescGZIP(), []int{1}
+}
+
+type ListDNSRecordsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Records       []*DNSRecord           `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDNSRecordsResponse) Reset() {
+	*x = ListDNSRecordsResponse{}
+	mi := &file_headscale_v1_dns_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDNSRecordsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDNSRecordsResponse) ProtoMessage() {}
+
+func (x *ListDNSRecordsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_headscale_v1_dns_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDNSRecordsResponse.ProtoReflect.Descriptor instead.
+func (*ListDNSRecordsResponse) Descriptor() ([]byte, []int) {
+	return file_headscale_v1_dns_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListDNSRecordsResponse) GetRecords() []*DNSRecord {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+type SetDNSRecordsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Records       []*DNSRecord           `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetDNSRecordsRequest) Reset() {
+	*x = SetDNSRecordsRequest{}
+	mi := &file_headscale_v1_dns_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDNSRecordsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDNSRecordsRequest) ProtoMessage() {}
+
+func (x *SetDNSRecordsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_headscale_v1_dns_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDNSRecordsRequest.ProtoReflect.Descriptor instead.
+func (*SetDNSRecordsRequest) Descriptor() ([]byte, []int) {
+	return file_headscale_v1_dns_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SetDNSRecordsRequest) GetRecords() []*DNSRecord {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+type SetDNSRecordsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Records       []*DNSRecord           `protobuf:"bytes,1,rep,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetDNSRecordsResponse) Reset() {
+	*x = SetDNSRecordsResponse{}
+	mi := &file_headscale_v1_dns_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDNSRecordsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDNSRecordsResponse) ProtoMessage() {}
+
+func (x *SetDNSRecordsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_headscale_v1_dns_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDNSRecordsResponse.ProtoReflect.Descriptor instead.
+func (*SetDNSRecordsResponse) Descriptor() ([]byte, []int) {
+	return file_headscale_v1_dns_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SetDNSRecordsResponse) GetRecords() []*DNSRecord {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+var File_headscale_v1_dns_proto protoreflect.FileDescriptor
+
+const file_headscale_v1_dns_proto_rawDesc = "" +
+	"\n" +
+	"\x16headscale/v1/dns.proto\x12\fheadscale.v1\"I\n" +
+	"\tDNSRecord\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\"\x17\n" +
+	"\x15ListDNSRecordsRequest\"K\n" +
+	"\x16ListDNSRecordsResponse\x121\n" +
+	"\arecords\x18\x01 \x03(\v2\x17.headscale.v1.DNSRecordR\arecords\"I\n" +
+	"\x14SetDNSRecordsRequest\x121\n" +
+	"\arecords\x18\x01 \x03(\v2\x17.headscale.v1.DNSRecordR\arecords\"J\n" +
+	"\x15SetDNSRecordsResponse\x121\n" +
+	"\arecords\x18\x01 \x03(\v2\x17.headscale.v1.DNSRecordR\arecordsB)Z'github.com/juanfont/headscale/gen/go/v1b\x06proto3"
+
+var (
+	file_headscale_v1_dns_proto_rawDescOnce sync.Once
+	file_headscale_v1_dns_proto_rawDescData []byte
+)
+
+func file_headscale_v1_dns_proto_rawDescGZIP() []byte {
+	file_headscale_v1_dns_proto_rawDescOnce.Do(func() {
+		file_headscale_v1_dns_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_headscale_v1_dns_proto_rawDesc), len(file_headscale_v1_dns_proto_rawDesc)))
+	})
+	return file_headscale_v1_dns_proto_rawDescData
+}
+
+var file_headscale_v1_dns_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_headscale_v1_dns_proto_goTypes = []any{
+	(*DNSRecord)(nil),              // 0: headscale.v1.DNSRecord
+	(*ListDNSRecordsRequest)(nil),  // 1: headscale.v1.ListDNSRecordsRequest
+	(*ListDNSRecordsResponse)(nil), // 2: headscale.v1.ListDNSRecordsResponse
+	(*SetDNSRecordsRequest)(nil),   // 3: headscale.v1.SetDNSRecordsRequest
+	(*SetDNSRecordsResponse)(nil),  // 4: headscale.v1.SetDNSRecordsResponse
+}
+var file_headscale_v1_dns_proto_depIdxs = []int32{
+	0, // 0: headscale.v1.ListDNSRecordsResponse.records:type_name -> headscale.v1.DNSRecord
+	0, // 1: headscale.v1.SetDNSRecordsRequest.records:type_name -> headscale.v1.DNSRecord
+	0, // 2: headscale.v1.SetDNSRecordsResponse.records:type_name -> headscale.v1.DNSRecord
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_headscale_v1_dns_proto_init() }
+func file_headscale_v1_dns_proto_init() {
+	if File_headscale_v1_dns_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_headscale_v1_dns_proto_rawDesc), len(file_headscale_v1_dns_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_headscale_v1_dns_proto_goTypes,
+		DependencyIndexes: file_headscale_v1_dns_proto_depIdxs,
+		MessageInfos:      file_headscale_v1_dns_proto_msgTypes,
+	}.Build()
+	File_headscale_v1_dns_proto = out.File
+	file_headscale_v1_dns_proto_goTypes = nil
+	file_headscale_v1_dns_proto_depIdxs = nil
+}
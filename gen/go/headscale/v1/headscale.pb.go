@@ -25,7 +25,7 @@ var File_headscale_v1_headscale_proto protoreflect.FileDescriptor
 
 const file_headscale_v1_headscale_proto_rawDesc = "" +
 	"\n" +
-	"\x1cheadscale/v1/headscale.proto\x12\fheadscale.v1\x1a\x1cgoogle/api/annotations.proto\x1a\x17headscale/v1/user.proto\x1a\x1dheadscale/v1/preauthkey.proto\x1a\x17headscale/v1/node.proto\x1a\x19headscale/v1/apikey.proto\x1a\x19headscale/v1/policy.proto2\xa3\x16\n" +
+	"\x1cheadscale/v1/headscale.proto\x12\fheadscale.v1\x1a\x1cgoogle/api/annotations.proto\x1a\x17headscale/v1/user.proto\x1a\x1dheadscale/v1/preauthkey.proto\x1a\x17headscale/v1/node.proto\x1a\x19headscale/v1/apikey.proto\x1a\x1fheadscale/v1/oauth_client.proto\x1a\x19headscale/v1/invite.proto\x1a\x19headscale/v1/policy.proto\x1a\x16headscale/v1/dns.proto2\xf5$\n" +
 	"\x10HeadscaleService\x12h\n" +
 	"\n" +
 	"CreateUser\x12\x1f.headscale.v1.CreateUserRequest\x1a .headscale.v1.CreateUserResponse\"\x17\x82\xd3\xe4\x93\x02\x11:\x01*\"\f/api/v1/user\x12\x80\x01\n" +
@@ -33,13 +33,22 @@ const file_headscale_v1_headscale_proto_rawDesc = "" +
 	"RenameUser\x12\x1f.headscale.v1.RenameUserRequest\x1a .headscale.v1.RenameUserResponse\"/\x82\xd3\xe4\x93\x02)\"'/api/v1/user/{old_id}/rename/{new_name}\x12j\n" +
 	"\n" +
 	"DeleteUser\x12\x1f.headscale.v1.DeleteUserRequest\x1a .headscale.v1.DeleteUserResponse\"\x19\x82\xd3\xe4\x93\x02\x13*\x11/api/v1/user/{id}\x12b\n" +
-	"\tListUsers\x12\x1e.headscale.v1.ListUsersRequest\x1a\x1f.headscale.v1.ListUsersResponse\"\x14\x82\xd3\xe4\x93\x02\x0e\x12\f/api/v1/user\x12\x80\x01\n" +
+	"\tListUsers\x12\x1e.headscale.v1.ListUsersRequest\x1a\x1f.headscale.v1.ListUsersResponse\"\x14\x82\xd3\xe4\x93\x02\x0e\x12\f/api/v1/user\x12\x7f\n" +
+	"\n" +
+	"MergeUsers\x12\x1f.headscale.v1.MergeUsersRequest\x1a .headscale.v1.MergeUsersResponse\".\x82\xd3\xe4\x93\x02(\"&/api/v1/user/{from_id}/merge/{into_id}\x12t\n" +
+	"\rListUserLinks\x12\".headscale.v1.ListUserLinksRequest\x1a#.headscale.v1.ListUserLinksResponse\"\x1a\x82\xd3\xe4\x93\x02\x14\x12\x12/api/v1/user/links\x12u\n" +
+	"\vDisableUser\x12 .headscale.v1.DisableUserRequest\x1a!.headscale.v1.DisableUserResponse\"!\x82\xd3\xe4\x93\x02\x1b\"\x19/api/v1/user/{id}/disable\x12q\n" +
+	"\n" +
+	"EnableUser\x12\x1f.headscale.v1.EnableUserRequest\x1a .headscale.v1.EnableUserResponse\" \x82\xd3\xe4\x93\x02\x1a\"\x18/api/v1/user/{id}/enable\x12y\n" +
+	"\fSetUserQuota\x12!.headscale.v1.SetUserQuotaRequest\x1a\".headscale.v1.SetUserQuotaResponse\"\"\x82\xd3\xe4\x93\x02\x1c:\x01*\"\x17/api/v1/user/{id}/quota\x12\x80\x01\n" +
 	"\x10CreatePreAuthKey\x12%.headscale.v1.CreatePreAuthKeyRequest\x1a&.headscale.v1.CreatePreAuthKeyResponse\"\x1d\x82\xd3\xe4\x93\x02\x17:\x01*\"\x12/api/v1/preauthkey\x12\x87\x01\n" +
 	"\x10ExpirePreAuthKey\x12%.headscale.v1.ExpirePreAuthKeyRequest\x1a&.headscale.v1.ExpirePreAuthKeyResponse\"$\x82\xd3\xe4\x93\x02\x1e:\x01*\"\x19/api/v1/preauthkey/expire\x12z\n" +
-	"\x0fListPreAuthKeys\x12$.headscale.v1.ListPreAuthKeysRequest\x1a%.headscale.v1.ListPreAuthKeysResponse\"\x1a\x82\xd3\xe4\x93\x02\x14\x12\x12/api/v1/preauthkey\x12}\n" +
+	"\x0fListPreAuthKeys\x12$.headscale.v1.ListPreAuthKeysRequest\x1a%.headscale.v1.ListPreAuthKeysResponse\"\x1a\x82\xd3\xe4\x93\x02\x14\x12\x12/api/v1/preauthkey\x12\x97\x01\n" +
+	"\x15ListNodesByPreAuthKey\x12*.headscale.v1.ListNodesByPreAuthKeyRequest\x1a+.headscale.v1.ListNodesByPreAuthKeyResponse\"%\x82\xd3\xe4\x93\x02\x1f\x12\x1d/api/v1/preauthkey/{id}/nodes\x12}\n" +
 	"\x0fDebugCreateNode\x12$.headscale.v1.DebugCreateNodeRequest\x1a%.headscale.v1.DebugCreateNodeResponse\"\x1d\x82\xd3\xe4\x93\x02\x17:\x01*\"\x12/api/v1/debug/node\x12f\n" +
 	"\aGetNode\x12\x1c.headscale.v1.GetNodeRequest\x1a\x1d.headscale.v1.GetNodeResponse\"\x1e\x82\xd3\xe4\x93\x02\x18\x12\x16/api/v1/node/{node_id}\x12n\n" +
-	"\aSetTags\x12\x1c.headscale.v1.SetTagsRequest\x1a\x1d.headscale.v1.SetTagsResponse\"&\x82\xd3\xe4\x93\x02 :\x01*\"\x1b/api/v1/node/{node_id}/tags\x12\x96\x01\n" +
+	"\aSetTags\x12\x1c.headscale.v1.SetTagsRequest\x1a\x1d.headscale.v1.SetTagsResponse\"&\x82\xd3\xe4\x93\x02 :\x01*\"\x1b/api/v1/node/{node_id}/tags\x12v\n" +
+	"\tLabelNode\x12\x1e.headscale.v1.LabelNodeRequest\x1a\x1f.headscale.v1.LabelNodeResponse\"(\x82\xd3\xe4\x93\x02\":\x01*\"\x1d/api/v1/node/{node_id}/labels\x12\x96\x01\n" +
 	"\x11SetApprovedRoutes\x12&.headscale.v1.SetApprovedRoutesRequest\x1a'.headscale.v1.SetApprovedRoutesResponse\"0\x82\xd3\xe4\x93\x02*:\x01*\"%/api/v1/node/{node_id}/approve_routes\x12t\n" +
 	"\fRegisterNode\x12!.headscale.v1.RegisterNodeRequest\x1a\".headscale.v1.RegisterNodeResponse\"\x1d\x82\xd3\xe4\x93\x02\x17\"\x15/api/v1/node/register\x12o\n" +
 	"\n" +
@@ -54,111 +63,179 @@ const file_headscale_v1_headscale_proto_rawDesc = "" +
 	"\fCreateApiKey\x12!.headscale.v1.CreateApiKeyRequest\x1a\".headscale.v1.CreateApiKeyResponse\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\"\x0e/api/v1/apikey\x12w\n" +
 	"\fExpireApiKey\x12!.headscale.v1.ExpireApiKeyRequest\x1a\".headscale.v1.ExpireApiKeyResponse\" \x82\xd3\xe4\x93\x02\x1a:\x01*\"\x15/api/v1/apikey/expire\x12j\n" +
 	"\vListApiKeys\x12 .headscale.v1.ListApiKeysRequest\x1a!.headscale.v1.ListApiKeysResponse\"\x16\x82\xd3\xe4\x93\x02\x10\x12\x0e/api/v1/apikey\x12v\n" +
-	"\fDeleteApiKey\x12!.headscale.v1.DeleteApiKeyRequest\x1a\".headscale.v1.DeleteApiKeyResponse\"\x1f\x82\xd3\xe4\x93\x02\x19*\x17/api/v1/apikey/{prefix}\x12d\n" +
+	"\fDeleteApiKey\x12!.headscale.v1.DeleteApiKeyRequest\x1a\".headscale.v1.DeleteApiKeyResponse\"\x1f\x82\xd3\xe4\x93\x02\x19*\x17/api/v1/apikey/{prefix}\x12\x84\x01\n" +
+	"\x11CreateOAuthClient\x12&.headscale.v1.CreateOAuthClientRequest\x1a'.headscale.v1.CreateOAuthClientResponse\"\x1e\x82\xd3\xe4\x93\x02\x18:\x01*\"\x13/api/v1/oauthclient\x12~\n" +
+	"\x10ListOAuthClients\x12%.headscale.v1.ListOAuthClientsRequest\x1a&.headscale.v1.ListOAuthClientsResponse\"\x1b\x82\xd3\xe4\x93\x02\x15\x12\x13/api/v1/oauthclient\x12\x8d\x01\n" +
+	"\x11DeleteOAuthClient\x12&.headscale.v1.DeleteOAuthClientRequest\x1a'.headscale.v1.DeleteOAuthClientResponse\"'\x82\xd3\xe4\x93\x02!*\x1f/api/v1/oauthclient/{client_id}\x12p\n" +
+	"\fCreateInvite\x12!.headscale.v1.CreateInviteRequest\x1a\".headscale.v1.CreateInviteResponse\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\"\x0e/api/v1/invite\x12j\n" +
+	"\vListInvites\x12 .headscale.v1.ListInvitesRequest\x1a!.headscale.v1.ListInvitesResponse\"\x16\x82\xd3\xe4\x93\x02\x10\x12\x0e/api/v1/invite\x12y\n" +
+	"\fRevokeInvite\x12!.headscale.v1.RevokeInviteRequest\x1a\".headscale.v1.RevokeInviteResponse\"\"\x82\xd3\xe4\x93\x02\x1c\"\x1a/api/v1/invite/{id}/revoke\x12d\n" +
 	"\tGetPolicy\x12\x1e.headscale.v1.GetPolicyRequest\x1a\x1f.headscale.v1.GetPolicyResponse\"\x16\x82\xd3\xe4\x93\x02\x10\x12\x0e/api/v1/policy\x12g\n" +
-	"\tSetPolicy\x12\x1e.headscale.v1.SetPolicyRequest\x1a\x1f.headscale.v1.SetPolicyResponse\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\x1a\x0e/api/v1/policyB)Z'github.com/juanfont/headscale/gen/go/v1b\x06proto3"
+	"\tSetPolicy\x12\x1e.headscale.v1.SetPolicyRequest\x1a\x1f.headscale.v1.SetPolicyResponse\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\x1a\x0e/api/v1/policy\x12x\n" +
+	"\x0eListDNSRecords\x12#.headscale.v1.ListDNSRecordsRequest\x1a$.headscale.v1.ListDNSRecordsResponse\"\x1b\x82\xd3\xe4\x93\x02\x15\x12\x13/api/v1/dns/records\x12x\n" +
+	"\rSetDNSRecords\x12\".headscale.v1.SetDNSRecordsRequest\x1a#.headscale.v1.SetDNSRecordsResponse\"\x1e\x82\xd3\xe4\x93\x02\x18:\x01*\x1a\x13/api/v1/dns/recordsB)Z'github.com/juanfont/headscale/gen/go/v1b\x06proto3"
 
 var file_headscale_v1_headscale_proto_goTypes = []any{
-	(*CreateUserRequest)(nil),         // 0: headscale.v1.CreateUserRequest
-	(*RenameUserRequest)(nil),         // 1: headscale.v1.RenameUserRequest
-	(*DeleteUserRequest)(nil),         // 2: headscale.v1.DeleteUserRequest
-	(*ListUsersRequest)(nil),          // 3: headscale.v1.ListUsersRequest
-	(*CreatePreAuthKeyRequest)(nil),   // 4: headscale.v1.CreatePreAuthKeyRequest
-	(*ExpirePreAuthKeyRequest)(nil),   // 5: headscale.v1.ExpirePreAuthKeyRequest
-	(*ListPreAuthKeysRequest)(nil),    // 6: headscale.v1.ListPreAuthKeysRequest
-	(*DebugCreateNodeRequest)(nil),    // 7: headscale.v1.DebugCreateNodeRequest
-	(*GetNodeRequest)(nil),            // 8: headscale.v1.GetNodeRequest
-	(*SetTagsRequest)(nil),            // 9: headscale.v1.SetTagsRequest
-	(*SetApprovedRoutesRequest)(nil),  // 10: headscale.v1.SetApprovedRoutesRequest
-	(*RegisterNodeRequest)(nil),       // 11: headscale.v1.RegisterNodeRequest
-	(*DeleteNodeRequest)(nil),         // 12: headscale.v1.DeleteNodeRequest
-	(*ExpireNodeRequest)(nil),         // 13: headscale.v1.ExpireNodeRequest
-	(*RenameNodeRequest)(nil),         // 14: headscale.v1.RenameNodeRequest
-	(*ListNodesRequest)(nil),          // 15: headscale.v1.ListNodesRequest
-	(*MoveNodeRequest)(nil),           // 16: headscale.v1.MoveNodeRequest
-	(*BackfillNodeIPsRequest)(nil),    // 17: headscale.v1.BackfillNodeIPsRequest
-	(*CreateApiKeyRequest)(nil),       // 18: headscale.v1.CreateApiKeyRequest
-	(*ExpireApiKeyRequest)(nil),       // 19: headscale.v1.ExpireApiKeyRequest
-	(*ListApiKeysRequest)(nil),        // 20: headscale.v1.ListApiKeysRequest
-	(*DeleteApiKeyRequest)(nil),       // 21: headscale.v1.DeleteApiKeyRequest
-	(*GetPolicyRequest)(nil),          // 22: headscale.v1.GetPolicyRequest
-	(*SetPolicyRequest)(nil),          // 23: headscale.v1.SetPolicyRequest
-	(*CreateUserResponse)(nil),        // 24: headscale.v1.CreateUserResponse
-	(*RenameUserResponse)(nil),        // 25: headscale.v1.RenameUserResponse
-	(*DeleteUserResponse)(nil),        // 26: headscale.v1.DeleteUserResponse
-	(*ListUsersResponse)(nil),         // 27: headscale.v1.ListUsersResponse
-	(*CreatePreAuthKeyResponse)(nil),  // 28: headscale.v1.CreatePreAuthKeyResponse
-	(*ExpirePreAuthKeyResponse)(nil),  // 29: headscale.v1.ExpirePreAuthKeyResponse
-	(*ListPreAuthKeysResponse)(nil),   // 30: headscale.v1.ListPreAuthKeysResponse
-	(*DebugCreateNodeResponse)(nil),   // 31: headscale.v1.DebugCreateNodeResponse
-	(*GetNodeResponse)(nil),           // 32: headscale.v1.GetNodeResponse
-	(*SetTagsResponse)(nil),           // 33: headscale.v1.SetTagsResponse
-	(*SetApprovedRoutesResponse)(nil), // 34: headscale.v1.SetApprovedRoutesResponse
-	(*RegisterNodeResponse)(nil),      // 35: headscale.v1.RegisterNodeResponse
-	(*DeleteNodeResponse)(nil),        // 36: headscale.v1.DeleteNodeResponse
-	(*ExpireNodeResponse)(nil),        // 37: headscale.v1.ExpireNodeResponse
-	(*RenameNodeResponse)(nil),        // 38: headscale.v1.RenameNodeResponse
-	(*ListNodesResponse)(nil),         // 39: headscale.v1.ListNodesResponse
-	(*MoveNodeResponse)(nil),          // 40: headscale.v1.MoveNodeResponse
-	(*BackfillNodeIPsResponse)(nil),   // 41: headscale.v1.BackfillNodeIPsResponse
-	(*CreateApiKeyResponse)(nil),      // 42: headscale.v1.CreateApiKeyResponse
-	(*ExpireApiKeyResponse)(nil),      // 43: headscale.v1.ExpireApiKeyResponse
-	(*ListApiKeysResponse)(nil),       // 44: headscale.v1.ListApiKeysResponse
-	(*DeleteApiKeyResponse)(nil),      // 45: headscale.v1.DeleteApiKeyResponse
-	(*GetPolicyResponse)(nil),         // 46: headscale.v1.GetPolicyResponse
-	(*SetPolicyResponse)(nil),         // 47: headscale.v1.SetPolicyResponse
+	(*CreateUserRequest)(nil),             // 0: headscale.v1.CreateUserRequest
+	(*RenameUserRequest)(nil),             // 1: headscale.v1.RenameUserRequest
+	(*DeleteUserRequest)(nil),             // 2: headscale.v1.DeleteUserRequest
+	(*ListUsersRequest)(nil),              // 3: headscale.v1.ListUsersRequest
+	(*MergeUsersRequest)(nil),             // 4: headscale.v1.MergeUsersRequest
+	(*ListUserLinksRequest)(nil),          // 5: headscale.v1.ListUserLinksRequest
+	(*DisableUserRequest)(nil),            // 6: headscale.v1.DisableUserRequest
+	(*EnableUserRequest)(nil),             // 7: headscale.v1.EnableUserRequest
+	(*SetUserQuotaRequest)(nil),           // 8: headscale.v1.SetUserQuotaRequest
+	(*CreatePreAuthKeyRequest)(nil),       // 9: headscale.v1.CreatePreAuthKeyRequest
+	(*ExpirePreAuthKeyRequest)(nil),       // 10: headscale.v1.ExpirePreAuthKeyRequest
+	(*ListPreAuthKeysRequest)(nil),        // 11: headscale.v1.ListPreAuthKeysRequest
+	(*ListNodesByPreAuthKeyRequest)(nil),  // 12: headscale.v1.ListNodesByPreAuthKeyRequest
+	(*DebugCreateNodeRequest)(nil),        // 13: headscale.v1.DebugCreateNodeRequest
+	(*GetNodeRequest)(nil),                // 14: headscale.v1.GetNodeRequest
+	(*SetTagsRequest)(nil),                // 15: headscale.v1.SetTagsRequest
+	(*LabelNodeRequest)(nil),              // 16: headscale.v1.LabelNodeRequest
+	(*SetApprovedRoutesRequest)(nil),      // 17: headscale.v1.SetApprovedRoutesRequest
+	(*RegisterNodeRequest)(nil),           // 18: headscale.v1.RegisterNodeRequest
+	(*DeleteNodeRequest)(nil),             // 19: headscale.v1.DeleteNodeRequest
+	(*ExpireNodeRequest)(nil),             // 20: headscale.v1.ExpireNodeRequest
+	(*RenameNodeRequest)(nil),             // 21: headscale.v1.RenameNodeRequest
+	(*ListNodesRequest)(nil),              // 22: headscale.v1.ListNodesRequest
+	(*MoveNodeRequest)(nil),               // 23: headscale.v1.MoveNodeRequest
+	(*BackfillNodeIPsRequest)(nil),        // 24: headscale.v1.BackfillNodeIPsRequest
+	(*CreateApiKeyRequest)(nil),           // 25: headscale.v1.CreateApiKeyRequest
+	(*ExpireApiKeyRequest)(nil),           // 26: headscale.v1.ExpireApiKeyRequest
+	(*ListApiKeysRequest)(nil),            // 27: headscale.v1.ListApiKeysRequest
+	(*DeleteApiKeyRequest)(nil),           // 28: headscale.v1.DeleteApiKeyRequest
+	(*CreateOAuthClientRequest)(nil),      // 29: headscale.v1.CreateOAuthClientRequest
+	(*ListOAuthClientsRequest)(nil),       // 30: headscale.v1.ListOAuthClientsRequest
+	(*DeleteOAuthClientRequest)(nil),      // 31: headscale.v1.DeleteOAuthClientRequest
+	(*CreateInviteRequest)(nil),           // 32: headscale.v1.CreateInviteRequest
+	(*ListInvitesRequest)(nil),            // 33: headscale.v1.ListInvitesRequest
+	(*RevokeInviteRequest)(nil),           // 34: headscale.v1.RevokeInviteRequest
+	(*GetPolicyRequest)(nil),              // 35: headscale.v1.GetPolicyRequest
+	(*SetPolicyRequest)(nil),              // 36: headscale.v1.SetPolicyRequest
+	(*ListDNSRecordsRequest)(nil),         // 37: headscale.v1.ListDNSRecordsRequest
+	(*SetDNSRecordsRequest)(nil),          // 38: headscale.v1.SetDNSRecordsRequest
+	(*CreateUserResponse)(nil),            // 39: headscale.v1.CreateUserResponse
+	(*RenameUserResponse)(nil),            // 40: headscale.v1.RenameUserResponse
+	(*DeleteUserResponse)(nil),            // 41: headscale.v1.DeleteUserResponse
+	(*ListUsersResponse)(nil),             // 42: headscale.v1.ListUsersResponse
+	(*MergeUsersResponse)(nil),            // 43: headscale.v1.MergeUsersResponse
+	(*ListUserLinksResponse)(nil),         // 44: headscale.v1.ListUserLinksResponse
+	(*DisableUserResponse)(nil),           // 45: headscale.v1.DisableUserResponse
+	(*EnableUserResponse)(nil),            // 46: headscale.v1.EnableUserResponse
+	(*SetUserQuotaResponse)(nil),          // 47: headscale.v1.SetUserQuotaResponse
+	(*CreatePreAuthKeyResponse)(nil),      // 48: headscale.v1.CreatePreAuthKeyResponse
+	(*ExpirePreAuthKeyResponse)(nil),      // 49: headscale.v1.ExpirePreAuthKeyResponse
+	(*ListPreAuthKeysResponse)(nil),       // 50: headscale.v1.ListPreAuthKeysResponse
+	(*ListNodesByPreAuthKeyResponse)(nil), // 51: headscale.v1.ListNodesByPreAuthKeyResponse
+	(*DebugCreateNodeResponse)(nil),       // 52: headscale.v1.DebugCreateNodeResponse
+	(*GetNodeResponse)(nil),               // 53: headscale.v1.GetNodeResponse
+	(*SetTagsResponse)(nil),               // 54: headscale.v1.SetTagsResponse
+	(*LabelNodeResponse)(nil),             // 55: headscale.v1.LabelNodeResponse
+	(*SetApprovedRoutesResponse)(nil),     // 56: headscale.v1.SetApprovedRoutesResponse
+	(*RegisterNodeResponse)(nil),          // 57: headscale.v1.RegisterNodeResponse
+	(*DeleteNodeResponse)(nil),            // 58: headscale.v1.DeleteNodeResponse
+	(*ExpireNodeResponse)(nil),            // 59: headscale.v1.ExpireNodeResponse
+	(*RenameNodeResponse)(nil),            // 60: headscale.v1.RenameNodeResponse
+	(*ListNodesResponse)(nil),             // 61: headscale.v1.ListNodesResponse
+	(*MoveNodeResponse)(nil),              // 62: headscale.v1.MoveNodeResponse
+	(*BackfillNodeIPsResponse)(nil),       // 63: headscale.v1.BackfillNodeIPsResponse
+	(*CreateApiKeyResponse)(nil),          // 64: headscale.v1.CreateApiKeyResponse
+	(*ExpireApiKeyResponse)(nil),          // 65: headscale.v1.ExpireApiKeyResponse
+	(*ListApiKeysResponse)(nil),           // 66: headscale.v1.ListApiKeysResponse
+	(*DeleteApiKeyResponse)(nil),          // 67: headscale.v1.DeleteApiKeyResponse
+	(*CreateOAuthClientResponse)(nil),     // 68: headscale.v1.CreateOAuthClientResponse
+	(*ListOAuthClientsResponse)(nil),      // 69: headscale.v1.ListOAuthClientsResponse
+	(*DeleteOAuthClientResponse)(nil),     // 70: headscale.v1.DeleteOAuthClientResponse
+	(*CreateInviteResponse)(nil),          // 71: headscale.v1.CreateInviteResponse
+	(*ListInvitesResponse)(nil),           // 72: headscale.v1.ListInvitesResponse
+	(*RevokeInviteResponse)(nil),          // 73: headscale.v1.RevokeInviteResponse
+	(*GetPolicyResponse)(nil),             // 74: headscale.v1.GetPolicyResponse
+	(*SetPolicyResponse)(nil),             // 75: headscale.v1.SetPolicyResponse
+	(*ListDNSRecordsResponse)(nil),        // 76: headscale.v1.ListDNSRecordsResponse
+	(*SetDNSRecordsResponse)(nil),         // 77: headscale.v1.SetDNSRecordsResponse
 }
 var file_headscale_v1_headscale_proto_depIdxs = []int32{
 	0,  // 0: headscale.v1.HeadscaleService.CreateUser:input_type -> headscale.v1.CreateUserRequest
 	1,  // 1: headscale.v1.HeadscaleService.RenameUser:input_type -> headscale.v1.RenameUserRequest
 	2,  // 2: headscale.v1.HeadscaleService.DeleteUser:input_type -> headscale.v1.DeleteUserRequest
 	3,  // 3: headscale.v1.HeadscaleService.ListUsers:input_type -> headscale.v1.ListUsersRequest
-	4,  // 4: headscale.v1.HeadscaleService.CreatePreAuthKey:input_type -> headscale.v1.CreatePreAuthKeyRequest
-	5,  // 5: headscale.v1.HeadscaleService.ExpirePreAuthKey:input_type -> headscale.v1.ExpirePreAuthKeyRequest
-	6,  // 6: headscale.v1.HeadscaleService.ListPreAuthKeys:input_type -> headscale.v1.ListPreAuthKeysRequest
-	7,  // 7: headscale.v1.HeadscaleService.DebugCreateNode:input_type -> headscale.v1.DebugCreateNodeRequest
-	8,  // 8: headscale.v1.HeadscaleService.GetNode:input_type -> headscale.v1.GetNodeRequest
-	9,  // 9: headscale.v1.HeadscaleService.SetTags:input_type -> headscale.v1.SetTagsRequest
-	10, // 10: headscale.v1.HeadscaleService.SetApprovedRoutes:input_type -> headscale.v1.SetApprovedRoutesRequest
-	11, // 11: headscale.v1.HeadscaleService.RegisterNode:input_type -> headscale.v1.RegisterNodeRequest
-	12, // 12: headscale.v1.HeadscaleService.DeleteNode:input_type -> headscale.v1.DeleteNodeRequest
-	13, // 13: headscale.v1.HeadscaleService.ExpireNode:input_type -> headscale.v1.ExpireNodeRequest
-	14, // 14: headscale.v1.HeadscaleService.RenameNode:input_type -> headscale.v1.RenameNodeRequest
-	15, // 15: headscale.v1.HeadscaleService.ListNodes:input_type -> headscale.v1.ListNodesRequest
-	16, // 16: headscale.v1.HeadscaleService.MoveNode:input_type -> headscale.v1.MoveNodeRequest
-	17, // 17: headscale.v1.HeadscaleService.BackfillNodeIPs:input_type -> headscale.v1.BackfillNodeIPsRequest
-	18, // 18: headscale.v1.HeadscaleService.CreateApiKey:input_type -> headscale.v1.CreateApiKeyRequest
-	19, // 19: headscale.v1.HeadscaleService.ExpireApiKey:input_type -> headscale.v1.ExpireApiKeyRequest
-	20, // 20: headscale.v1.HeadscaleService.ListApiKeys:input_type -> headscale.v1.ListApiKeysRequest
-	21, // 21: headscale.v1.HeadscaleService.DeleteApiKey:input_type -> headscale.v1.DeleteApiKeyRequest
-	22, // 22: headscale.v1.HeadscaleService.GetPolicy:input_type -> headscale.v1.GetPolicyRequest
-	23, // 23: headscale.v1.HeadscaleService.SetPolicy:input_type -> headscale.v1.SetPolicyRequest
-	24, // 24: headscale.v1.HeadscaleService.CreateUser:output_type -> headscale.v1.CreateUserResponse
-	25, // 25: headscale.v1.HeadscaleService.RenameUser:output_type -> headscale.v1.RenameUserResponse
-	26, // 26: headscale.v1.HeadscaleService.DeleteUser:output_type -> headscale.v1.DeleteUserResponse
-	27, // 27: headscale.v1.HeadscaleService.ListUsers:output_type -> headscale.v1.ListUsersResponse
-	28, // 28: headscale.v1.HeadscaleService.CreatePreAuthKey:output_type -> headscale.v1.CreatePreAuthKeyResponse
-	29, // 29: headscale.v1.HeadscaleService.ExpirePreAuthKey:output_type -> headscale.v1.ExpirePreAuthKeyResponse
-	30, // 30: headscale.v1.HeadscaleService.ListPreAuthKeys:output_type -> headscale.v1.ListPreAuthKeysResponse
-	31, // 31: headscale.v1.HeadscaleService.DebugCreateNode:output_type -> headscale.v1.DebugCreateNodeResponse
-	32, // 32: headscale.v1.HeadscaleService.GetNode:output_type -> headscale.v1.GetNodeResponse
-	33, // 33: headscale.v1.HeadscaleService.SetTags:output_type -> headscale.v1.SetTagsResponse
-	34, // 34: headscale.v1.HeadscaleService.SetApprovedRoutes:output_type -> headscale.v1.SetApprovedRoutesResponse
-	35, // 35: headscale.v1.HeadscaleService.RegisterNode:output_type -> headscale.v1.RegisterNodeResponse
-	36, // 36: headscale.v1.HeadscaleService.DeleteNode:output_type -> headscale.v1.DeleteNodeResponse
-	37, // 37: headscale.v1.HeadscaleService.ExpireNode:output_type -> headscale.v1.ExpireNodeResponse
-	38, // 38: headscale.v1.HeadscaleService.RenameNode:output_type -> headscale.v1.RenameNodeResponse
-	39, // 39: headscale.v1.HeadscaleService.ListNodes:output_type -> headscale.v1.ListNodesResponse
-	40, // 40: headscale.v1.HeadscaleService.MoveNode:output_type -> headscale.v1.MoveNodeResponse
-	41, // 41: headscale.v1.HeadscaleService.BackfillNodeIPs:output_type -> headscale.v1.BackfillNodeIPsResponse
-	42, // 42: headscale.v1.HeadscaleService.CreateApiKey:output_type -> headscale.v1.CreateApiKeyResponse
-	43, // 43: headscale.v1.HeadscaleService.ExpireApiKey:output_type -> headscale.v1.ExpireApiKeyResponse
-	44, // 44: headscale.v1.HeadscaleService.ListApiKeys:output_type -> headscale.v1.ListApiKeysResponse
-	45, // 45: headscale.v1.HeadscaleService.DeleteApiKey:output_type -> headscale.v1.DeleteApiKeyResponse
-	46, // 46: headscale.v1.HeadscaleService.GetPolicy:output_type -> headscale.v1.GetPolicyResponse
-	47, // 47: headscale.v1.HeadscaleService.SetPolicy:output_type -> headscale.v1.SetPolicyResponse
-	24, // [24:48] is the sub-list for method output_type
-	0,  // [0:24] is the sub-list for method input_type
+	4,  // 4: headscale.v1.HeadscaleService.MergeUsers:input_type -> headscale.v1.MergeUsersRequest
+	5,  // 5: headscale.v1.HeadscaleService.ListUserLinks:input_type -> headscale.v1.ListUserLinksRequest
+	6,  // 6: headscale.v1.HeadscaleService.DisableUser:input_type -> headscale.v1.DisableUserRequest
+	7,  // 7: headscale.v1.HeadscaleService.EnableUser:input_type -> headscale.v1.EnableUserRequest
+	8,  // 8: headscale.v1.HeadscaleService.SetUserQuota:input_type -> headscale.v1.SetUserQuotaRequest
+	9,  // 9: headscale.v1.HeadscaleService.CreatePreAuthKey:input_type -> headscale.v1.CreatePreAuthKeyRequest
+	10, // 10: headscale.v1.HeadscaleService.ExpirePreAuthKey:input_type -> headscale.v1.ExpirePreAuthKeyRequest
+	11, // 11: headscale.v1.HeadscaleService.ListPreAuthKeys:input_type -> headscale.v1.ListPreAuthKeysRequest
+	12, // 12: headscale.v1.HeadscaleService.ListNodesByPreAuthKey:input_type -> headscale.v1.ListNodesByPreAuthKeyRequest
+	13, // 13: headscale.v1.HeadscaleService.DebugCreateNode:input_type -> headscale.v1.DebugCreateNodeRequest
+	14, // 14: headscale.v1.HeadscaleService.GetNode:input_type -> headscale.v1.GetNodeRequest
+	15, // 15: headscale.v1.HeadscaleService.SetTags:input_type -> headscale.v1.SetTagsRequest
+	16, // 16: headscale.v1.HeadscaleService.LabelNode:input_type -> headscale.v1.LabelNodeRequest
+	17, // 17: headscale.v1.HeadscaleService.SetApprovedRoutes:input_type -> headscale.v1.SetApprovedRoutesRequest
+	18, // 18: headscale.v1.HeadscaleService.RegisterNode:input_type -> headscale.v1.RegisterNodeRequest
+	19, // 19: headscale.v1.HeadscaleService.DeleteNode:input_type -> headscale.v1.DeleteNodeRequest
+	20, // 20: headscale.v1.HeadscaleService.ExpireNode:input_type -> headscale.v1.ExpireNodeRequest
+	21, // 21: headscale.v1.HeadscaleService.RenameNode:input_type -> headscale.v1.RenameNodeRequest
+	22, // 22: headscale.v1.HeadscaleService.ListNodes:input_type -> headscale.v1.ListNodesRequest
+	23, // 23: headscale.v1.HeadscaleService.MoveNode:input_type -> headscale.v1.MoveNodeRequest
+	24, // 24: headscale.v1.HeadscaleService.BackfillNodeIPs:input_type -> headscale.v1.BackfillNodeIPsRequest
+	25, // 25: headscale.v1.HeadscaleService.CreateApiKey:input_type -> headscale.v1.CreateApiKeyRequest
+	26, // 26: headscale.v1.HeadscaleService.ExpireApiKey:input_type -> headscale.v1.ExpireApiKeyRequest
+	27, // 27: headscale.v1.HeadscaleService.ListApiKeys:input_type -> headscale.v1.ListApiKeysRequest
+	28, // 28: headscale.v1.HeadscaleService.DeleteApiKey:input_type -> headscale.v1.DeleteApiKeyRequest
+	29, // 29: headscale.v1.HeadscaleService.CreateOAuthClient:input_type -> headscale.v1.CreateOAuthClientRequest
+	30, // 30: headscale.v1.HeadscaleService.ListOAuthClients:input_type -> headscale.v1.ListOAuthClientsRequest
+	31, // 31: headscale.v1.HeadscaleService.DeleteOAuthClient:input_type -> headscale.v1.DeleteOAuthClientRequest
+	32, // 32: headscale.v1.HeadscaleService.CreateInvite:input_type -> headscale.v1.CreateInviteRequest
+	33, // 33: headscale.v1.HeadscaleService.ListInvites:input_type -> headscale.v1.ListInvitesRequest
+	34, // 34: headscale.v1.HeadscaleService.RevokeInvite:input_type -> headscale.v1.RevokeInviteRequest
+	35, // 35: headscale.v1.HeadscaleService.GetPolicy:input_type -> headscale.v1.GetPolicyRequest
+	36, // 36: headscale.v1.HeadscaleService.SetPolicy:input_type -> headscale.v1.SetPolicyRequest
+	37, // 37: headscale.v1.HeadscaleService.ListDNSRecords:input_type -> headscale.v1.ListDNSRecordsRequest
+	38, // 38: headscale.v1.HeadscaleService.SetDNSRecords:input_type -> headscale.v1.SetDNSRecordsRequest
+	39, // 39: headscale.v1.HeadscaleService.CreateUser:output_type -> headscale.v1.CreateUserResponse
+	40, // 40: headscale.v1.HeadscaleService.RenameUser:output_type -> headscale.v1.RenameUserResponse
+	41, // 41: headscale.v1.HeadscaleService.DeleteUser:output_type -> headscale.v1.DeleteUserResponse
+	42, // 42: headscale.v1.HeadscaleService.ListUsers:output_type -> headscale.v1.ListUsersResponse
+	43, // 43: headscale.v1.HeadscaleService.MergeUsers:output_type -> headscale.v1.MergeUsersResponse
+	44, // 44: headscale.v1.HeadscaleService.ListUserLinks:output_type -> headscale.v1.ListUserLinksResponse
+	45, // 45: headscale.v1.HeadscaleService.DisableUser:output_type -> headscale.v1.DisableUserResponse
+	46, // 46: headscale.v1.HeadscaleService.EnableUser:output_type -> headscale.v1.EnableUserResponse
+	47, // 47: headscale.v1.HeadscaleService.SetUserQuota:output_type -> headscale.v1.SetUserQuotaResponse
+	48, // 48: headscale.v1.HeadscaleService.CreatePreAuthKey:output_type -> headscale.v1.CreatePreAuthKeyResponse
+	49, // 49: headscale.v1.HeadscaleService.ExpirePreAuthKey:output_type -> headscale.v1.ExpirePreAuthKeyResponse
+	50, // 50: headscale.v1.HeadscaleService.ListPreAuthKeys:output_type -> headscale.v1.ListPreAuthKeysResponse
+	51, // 51: headscale.v1.HeadscaleService.ListNodesByPreAuthKey:output_type -> headscale.v1.ListNodesByPreAuthKeyResponse
+	52, // 52: headscale.v1.HeadscaleService.DebugCreateNode:output_type -> headscale.v1.DebugCreateNodeResponse
+	53, // 53: headscale.v1.HeadscaleService.GetNode:output_type -> headscale.v1.GetNodeResponse
+	54, // 54: headscale.v1.HeadscaleService.SetTags:output_type -> headscale.v1.SetTagsResponse
+	55, // 55: headscale.v1.HeadscaleService.LabelNode:output_type -> headscale.v1.LabelNodeResponse
+	56, // 56: headscale.v1.HeadscaleService.SetApprovedRoutes:output_type -> headscale.v1.SetApprovedRoutesResponse
+	57, // 57: headscale.v1.HeadscaleService.RegisterNode:output_type -> headscale.v1.RegisterNodeResponse
+	58, // 58: headscale.v1.HeadscaleService.DeleteNode:output_type -> headscale.v1.DeleteNodeResponse
+	59, // 59: headscale.v1.HeadscaleService.ExpireNode:output_type -> headscale.v1.ExpireNodeResponse
+	60, // 60: headscale.v1.HeadscaleService.RenameNode:output_type -> headscale.v1.RenameNodeResponse
+	61, // 61: headscale.v1.HeadscaleService.ListNodes:output_type -> headscale.v1.ListNodesResponse
+	62, // 62: headscale.v1.HeadscaleService.MoveNode:output_type -> headscale.v1.MoveNodeResponse
+	63, // 63: headscale.v1.HeadscaleService.BackfillNodeIPs:output_type -> headscale.v1.BackfillNodeIPsResponse
+	64, // 64: headscale.v1.HeadscaleService.CreateApiKey:output_type -> headscale.v1.CreateApiKeyResponse
+	65, // 65: headscale.v1.HeadscaleService.ExpireApiKey:output_type -> headscale.v1.ExpireApiKeyResponse
+	66, // 66: headscale.v1.HeadscaleService.ListApiKeys:output_type -> headscale.v1.ListApiKeysResponse
+	67, // 67: headscale.v1.HeadscaleService.DeleteApiKey:output_type -> headscale.v1.DeleteApiKeyResponse
+	68, // 68: headscale.v1.HeadscaleService.CreateOAuthClient:output_type -> headscale.v1.CreateOAuthClientResponse
+	69, // 69: headscale.v1.HeadscaleService.ListOAuthClients:output_type -> headscale.v1.ListOAuthClientsResponse
+	70, // 70: headscale.v1.HeadscaleService.DeleteOAuthClient:output_type -> headscale.v1.DeleteOAuthClientResponse
+	71, // 71: headscale.v1.HeadscaleService.CreateInvite:output_type -> headscale.v1.CreateInviteResponse
+	72, // 72: headscale.v1.HeadscaleService.ListInvites:output_type -> headscale.v1.ListInvitesResponse
+	73, // 73: headscale.v1.HeadscaleService.RevokeInvite:output_type -> headscale.v1.RevokeInviteResponse
+	74, // 74: headscale.v1.HeadscaleService.GetPolicy:output_type -> headscale.v1.GetPolicyResponse
+	75, // 75: headscale.v1.HeadscaleService.SetPolicy:output_type -> headscale.v1.SetPolicyResponse
+	76, // 76: headscale.v1.HeadscaleService.ListDNSRecords:output_type -> headscale.v1.ListDNSRecordsResponse
+	77, // 77: headscale.v1.HeadscaleService.SetDNSRecords:output_type -> headscale.v1.SetDNSRecordsResponse
+	39, // [39:78] is the sub-list for method output_type
+	0,  // [0:39] is the sub-list for method input_type
 	0,  // [0:0] is the sub-list for extension type_name
 	0,  // [0:0] is the sub-list for extension extendee
 	0,  // [0:0] is the sub-list for field type_name
@@ -173,7 +250,10 @@ func file_headscale_v1_headscale_proto_init() {
 	file_headscale_v1_preauthkey_proto_init()
 	file_headscale_v1_node_proto_init()
 	file_headscale_v1_apikey_proto_init()
+	file_headscale_v1_oauth_client_proto_init()
+	file_headscale_v1_invite_proto_init()
 	file_headscale_v1_policy_proto_init()
+	file_headscale_v1_dns_proto_init()
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
@@ -9,6 +9,7 @@ package v1
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
 	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
@@ -23,16 +24,26 @@ const (
 )
 
 type PreAuthKey struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	User          *User                  `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
-	Id            uint64                 `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
-	Key           string                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
-	Reusable      bool                   `protobuf:"varint,4,opt,name=reusable,proto3" json:"reusable,omitempty"`
-	Ephemeral     bool                   `protobuf:"varint,5,opt,name=ephemeral,proto3" json:"ephemeral,omitempty"`
-	Used          bool                   `protobuf:"varint,6,opt,name=used,proto3" json:"used,omitempty"`
-	Expiration    *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=expiration,proto3" json:"expiration,omitempty"`
-	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
-	AclTags       []string               `protobuf:"bytes,9,rep,name=acl_tags,json=aclTags,proto3" json:"acl_tags,omitempty"`
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	User        *User                  `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Id          uint64                 `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	Key         string                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Reusable    bool                   `protobuf:"varint,4,opt,name=reusable,proto3" json:"reusable,omitempty"`
+	Ephemeral   bool                   `protobuf:"varint,5,opt,name=ephemeral,proto3" json:"ephemeral,omitempty"`
+	Used        bool                   `protobuf:"varint,6,opt,name=used,proto3" json:"used,omitempty"`
+	Expiration  *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=expiration,proto3" json:"expiration,omitempty"`
+	CreatedAt   *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	AclTags     []string               `protobuf:"bytes,9,rep,name=acl_tags,json=aclTags,proto3" json:"acl_tags,omitempty"`
+	Prefix      string                 `protobuf:"bytes,10,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Description string                 `protobuf:"bytes,11,opt,name=description,proto3" json:"description,omitempty"`
+	// max_uses is the number of nodes the key can register, 0 is unlimited
+	// for reusable keys.
+	MaxUses     uint32                 `protobuf:"varint,12,opt,name=max_uses,json=maxUses,proto3" json:"max_uses,omitempty"`
+	UseCount    uint32                 `protobuf:"varint,13,opt,name=use_count,json=useCount,proto3" json:"use_count,omitempty"`
+	Constraints *PreAuthKeyConstraints `protobuf:"bytes,14,opt,name=constraints,proto3" json:"constraints,omitempty"`
+	// node_ids are the IDs of the nodes registered with the key, only set
+	// when listing keys.
+	NodeIds       []uint64 `protobuf:"varint,15,rep,packed,name=node_ids,json=nodeIds,proto3" json:"node_ids,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -130,6 +141,122 @@ func (x *PreAuthKey) GetAclTags() []string {
 	return nil
 }
 
+func (x *PreAuthKey) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *PreAuthKey) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *PreAuthKey) GetMaxUses() uint32 {
+	if x != nil {
+		return x.MaxUses
+	}
+	return 0
+}
+
+func (x *PreAuthKey) GetUseCount() uint32 {
+	if x != nil {
+		return x.UseCount
+	}
+	return 0
+}
+
+func (x *PreAuthKey) GetConstraints() *PreAuthKeyConstraints {
+	if x != nil {
+		return x.Constraints
+	}
+	return nil
+}
+
+func (x *PreAuthKey) GetNodeIds() []uint64 {
+	if x != nil {
+		return x.NodeIds
+	}
+	return nil
+}
+
+// PreAuthKeyConstraints limit which nodes can register with a pre auth key,
+// and how they are registered.
+type PreAuthKeyConstraints struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// hostname_pattern is a glob the hostname of the node must match.
+	HostnamePattern string `protobuf:"bytes,1,opt,name=hostname_pattern,json=hostnamePattern,proto3" json:"hostname_pattern,omitempty"`
+	// allowed_os is the list of operating systems the node may run.
+	AllowedOs []string `protobuf:"bytes,2,rep,name=allowed_os,json=allowedOs,proto3" json:"allowed_os,omitempty"`
+	// node_expiry is the longest a registered node is valid for.
+	NodeExpiry *durationpb.Duration `protobuf:"bytes,3,opt,name=node_expiry,json=nodeExpiry,proto3" json:"node_expiry,omitempty"`
+	// approved_routes are approved for the node when it registers.
+	ApprovedRoutes []string `protobuf:"bytes,4,rep,name=approved_routes,json=approvedRoutes,proto3" json:"approved_routes,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *PreAuthKeyConstraints) Reset() {
+	*x = PreAuthKeyConstraints{}
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PreAuthKeyConstraints) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PreAuthKeyConstraints) ProtoMessage() {}
+
+func (x *PreAuthKeyConstraints) ProtoReflect() protoreflect.Message {
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PreAuthKeyConstraints.ProtoReflect.Descriptor instead.
+func (*PreAuthKeyConstraints) Descriptor() ([]byte, []int) {
+	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PreAuthKeyConstraints) GetHostnamePattern() string {
+	if x != nil {
+		return x.HostnamePattern
+	}
+	return ""
+}
+
+func (x *PreAuthKeyConstraints) GetAllowedOs() []string {
+	if x != nil {
+		return x.AllowedOs
+	}
+	return nil
+}
+
+func (x *PreAuthKeyConstraints) GetNodeExpiry() *durationpb.Duration {
+	if x != nil {
+		return x.NodeExpiry
+	}
+	return nil
+}
+
+func (x *PreAuthKeyConstraints) GetApprovedRoutes() []string {
+	if x != nil {
+		return x.ApprovedRoutes
+	}
+	return nil
+}
+
 type CreatePreAuthKeyRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	User          uint64                 `protobuf:"varint,1,opt,name=user,proto3" json:"user,omitempty"`
@@ -137,13 +264,16 @@ type CreatePreAuthKeyRequest struct {
 	Ephemeral     bool                   `protobuf:"varint,3,opt,name=ephemeral,proto3" json:"ephemeral,omitempty"`
 	Expiration    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=expiration,proto3" json:"expiration,omitempty"`
 	AclTags       []string               `protobuf:"bytes,5,rep,name=acl_tags,json=aclTags,proto3" json:"acl_tags,omitempty"`
+	Description   string                 `protobuf:"bytes,6,opt,name=description,proto3" json:"description,omitempty"`
+	MaxUses       uint32                 `protobuf:"varint,7,opt,name=max_uses,json=maxUses,proto3" json:"max_uses,omitempty"`
+	Constraints   *PreAuthKeyConstraints `protobuf:"bytes,8,opt,name=constraints,proto3" json:"constraints,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *CreatePreAuthKeyRequest) Reset() {
 	*x = CreatePreAuthKeyRequest{}
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[1]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -155,7 +285,7 @@ func (x *CreatePreAuthKeyRequest) String() string {
 func (*CreatePreAuthKeyRequest) ProtoMessage() {}
 
 func (x *CreatePreAuthKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[1]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -168,7 +298,7 @@ func (x *CreatePreAuthKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreatePreAuthKeyRequest.ProtoReflect.Descriptor instead.
 func (*CreatePreAuthKeyRequest) Descriptor() ([]byte, []int) {
-	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{1}
+	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *CreatePreAuthKeyRequest) GetUser() uint64 {
@@ -206,6 +336,27 @@ func (x *CreatePreAuthKeyRequest) GetAclTags() []string {
 	return nil
 }
 
+func (x *CreatePreAuthKeyRequest) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *CreatePreAuthKeyRequest) GetMaxUses() uint32 {
+	if x != nil {
+		return x.MaxUses
+	}
+	return 0
+}
+
+func (x *CreatePreAuthKeyRequest) GetConstraints() *PreAuthKeyConstraints {
+	if x != nil {
+		return x.Constraints
+	}
+	return nil
+}
+
 type CreatePreAuthKeyResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	PreAuthKey    *PreAuthKey            `protobuf:"bytes,1,opt,name=pre_auth_key,json=preAuthKey,proto3" json:"pre_auth_key,omitempty"`
@@ -215,7 +366,7 @@ type CreatePreAuthKeyResponse struct {
 
 func (x *CreatePreAuthKeyResponse) Reset() {
 	*x = CreatePreAuthKeyResponse{}
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[2]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -227,7 +378,7 @@ func (x *CreatePreAuthKeyResponse) String() string {
 func (*CreatePreAuthKeyResponse) ProtoMessage() {}
 
 func (x *CreatePreAuthKeyResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[2]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -240,7 +391,7 @@ func (x *CreatePreAuthKeyResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreatePreAuthKeyResponse.ProtoReflect.Descriptor instead.
 func (*CreatePreAuthKeyResponse) Descriptor() ([]byte, []int) {
-	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{2}
+	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *CreatePreAuthKeyResponse) GetPreAuthKey() *PreAuthKey {
@@ -260,7 +411,7 @@ type ExpirePreAuthKeyRequest struct {
 
 func (x *ExpirePreAuthKeyRequest) Reset() {
 	*x = ExpirePreAuthKeyRequest{}
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[3]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -272,7 +423,7 @@ func (x *ExpirePreAuthKeyRequest) String() string {
 func (*ExpirePreAuthKeyRequest) ProtoMessage() {}
 
 func (x *ExpirePreAuthKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[3]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -285,7 +436,7 @@ func (x *ExpirePreAuthKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ExpirePreAuthKeyRequest.ProtoReflect.Descriptor instead.
 func (*ExpirePreAuthKeyRequest) Descriptor() ([]byte, []int) {
-	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{3}
+	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *ExpirePreAuthKeyRequest) GetUser() uint64 {
@@ -310,7 +461,7 @@ type ExpirePreAuthKeyResponse struct {
 
 func (x *ExpirePreAuthKeyResponse) Reset() {
 	*x = ExpirePreAuthKeyResponse{}
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[4]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -322,7 +473,7 @@ func (x *ExpirePreAuthKeyResponse) String() string {
 func (*ExpirePreAuthKeyResponse) ProtoMessage() {}
 
 func (x *ExpirePreAuthKeyResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[4]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -335,7 +486,7 @@ func (x *ExpirePreAuthKeyResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ExpirePreAuthKeyResponse.ProtoReflect.Descriptor instead.
 func (*ExpirePreAuthKeyResponse) Descriptor() ([]byte, []int) {
-	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{4}
+	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{5}
 }
 
 type ListPreAuthKeysRequest struct {
@@ -347,7 +498,7 @@ type ListPreAuthKeysRequest struct {
 
 func (x *ListPreAuthKeysRequest) Reset() {
 	*x = ListPreAuthKeysRequest{}
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[5]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -359,7 +510,7 @@ func (x *ListPreAuthKeysRequest) String() string {
 func (*ListPreAuthKeysRequest) ProtoMessage() {}
 
 func (x *ListPreAuthKeysRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[5]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -372,7 +523,7 @@ func (x *ListPreAuthKeysRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListPreAuthKeysRequest.ProtoReflect.Descriptor instead.
 func (*ListPreAuthKeysRequest) Descriptor() ([]byte, []int) {
-	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{5}
+	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *ListPreAuthKeysRequest) GetUser() uint64 {
@@ -391,7 +542,7 @@ type ListPreAuthKeysResponse struct {
 
 func (x *ListPreAuthKeysResponse) Reset() {
 	*x = ListPreAuthKeysResponse{}
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[6]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -403,7 +554,7 @@ func (x *ListPreAuthKeysResponse) String() string {
 func (*ListPreAuthKeysResponse) ProtoMessage() {}
 
 func (x *ListPreAuthKeysResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_headscale_v1_preauthkey_proto_msgTypes[6]
+	mi := &file_headscale_v1_preauthkey_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -416,7 +567,7 @@ func (x *ListPreAuthKeysResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListPreAuthKeysResponse.ProtoReflect.Descriptor instead.
 func (*ListPreAuthKeysResponse) Descriptor() ([]byte, []int) {
-	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{6}
+	return file_headscale_v1_preauthkey_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *ListPreAuthKeysResponse) GetPreAuthKeys() []*PreAuthKey {
@@ -430,7 +581,7 @@ var File_headscale_v1_preauthkey_proto protoreflect.FileDescriptor
 
 const file_headscale_v1_preauthkey_proto_rawDesc = "" +
 	"\n" +
-	"\x1dheadscale/v1/preauthkey.proto\x12\fheadscale.v1\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x17headscale/v1/user.proto\"\xb6\x02\n" +
+	"\x1dheadscale/v1/preauthkey.proto\x12\fheadscale.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x17headscale/v1/user.proto\"\x8a\x04\n" +
 	"\n" +
 	"PreAuthKey\x12&\n" +
 	"\x04user\x18\x01 \x01(\v2\x12.headscale.v1.UserR\x04user\x12\x0e\n" +
@@ -444,7 +595,21 @@ const file_headscale_v1_preauthkey_proto_rawDesc = "" +
 	"expiration\x129\n" +
 	"\n" +
 	"created_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x19\n" +
-	"\bacl_tags\x18\t \x03(\tR\aaclTags\"\xbe\x01\n" +
+	"\bacl_tags\x18\t \x03(\tR\aaclTags\x12\x16\n" +
+	"\x06prefix\x18\n" +
+	" \x01(\tR\x06prefix\x12 \n" +
+	"\vdescription\x18\v \x01(\tR\vdescription\x12\x19\n" +
+	"\bmax_uses\x18\f \x01(\rR\amaxUses\x12\x1b\n" +
+	"\tuse_count\x18\r \x01(\rR\buseCount\x12E\n" +
+	"\vconstraints\x18\x0e \x01(\v2#.headscale.v1.PreAuthKeyConstraintsR\vconstraints\x12\x19\n" +
+	"\bnode_ids\x18\x0f \x03(\x04R\anodeIds\"\xc6\x01\n" +
+	"\x15PreAuthKeyConstraints\x12)\n" +
+	"\x10hostname_pattern\x18\x01 \x01(\tR\x0fhostnamePattern\x12\x1d\n" +
+	"\n" +
+	"allowed_os\x18\x02 \x03(\tR\tallowedOs\x12:\n" +
+	"\vnode_expiry\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\n" +
+	"nodeExpiry\x12'\n" +
+	"\x0fapproved_routes\x18\x04 \x03(\tR\x0eapprovedRoutes\"\xc2\x02\n" +
 	"\x17CreatePreAuthKeyRequest\x12\x12\n" +
 	"\x04user\x18\x01 \x01(\x04R\x04user\x12\x1a\n" +
 	"\breusable\x18\x02 \x01(\bR\breusable\x12\x1c\n" +
@@ -452,7 +617,10 @@ const file_headscale_v1_preauthkey_proto_rawDesc = "" +
 	"\n" +
 	"expiration\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
 	"expiration\x12\x19\n" +
-	"\bacl_tags\x18\x05 \x03(\tR\aaclTags\"V\n" +
+	"\bacl_tags\x18\x05 \x03(\tR\aaclTags\x12 \n" +
+	"\vdescription\x18\x06 \x01(\tR\vdescription\x12\x19\n" +
+	"\bmax_uses\x18\a \x01(\rR\amaxUses\x12E\n" +
+	"\vconstraints\x18\b \x01(\v2#.headscale.v1.PreAuthKeyConstraintsR\vconstraints\"V\n" +
 	"\x18CreatePreAuthKeyResponse\x12:\n" +
 	"\fpre_auth_key\x18\x01 \x01(\v2\x18.headscale.v1.PreAuthKeyR\n" +
 	"preAuthKey\"?\n" +
@@ -477,30 +645,35 @@ func file_headscale_v1_preauthkey_proto_rawDescGZIP() []byte {
 	return file_headscale_v1_preauthkey_proto_rawDescData
 }
 
-var file_headscale_v1_preauthkey_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_headscale_v1_preauthkey_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_headscale_v1_preauthkey_proto_goTypes = []any{
 	(*PreAuthKey)(nil),               // 0: headscale.v1.PreAuthKey
-	(*CreatePreAuthKeyRequest)(nil),  // 1: headscale.v1.CreatePreAuthKeyRequest
-	(*CreatePreAuthKeyResponse)(nil), // 2: headscale.v1.CreatePreAuthKeyResponse
-	(*ExpirePreAuthKeyRequest)(nil),  // 3: headscale.v1.ExpirePreAuthKeyRequest
-	(*ExpirePreAuthKeyResponse)(nil), // 4: headscale.v1.ExpirePreAuthKeyResponse
-	(*ListPreAuthKeysRequest)(nil),   // 5: headscale.v1.ListPreAuthKeysRequest
-	(*ListPreAuthKeysResponse)(nil),  // 6: headscale.v1.ListPreAuthKeysResponse
-	(*User)(nil),                     // 7: headscale.v1.User
-	(*timestamppb.Timestamp)(nil),    // 8: google.protobuf.Timestamp
+	(*PreAuthKeyConstraints)(nil),    // 1: headscale.v1.PreAuthKeyConstraints
+	(*CreatePreAuthKeyRequest)(nil),  // 2: headscale.v1.CreatePreAuthKeyRequest
+	(*CreatePreAuthKeyResponse)(nil), // 3: headscale.v1.CreatePreAuthKeyResponse
+	(*ExpirePreAuthKeyRequest)(nil),  // 4: headscale.v1.ExpirePreAuthKeyRequest
+	(*ExpirePreAuthKeyResponse)(nil), // 5: headscale.v1.ExpirePreAuthKeyResponse
+	(*ListPreAuthKeysRequest)(nil),   // 6: headscale.v1.ListPreAuthKeysRequest
+	(*ListPreAuthKeysResponse)(nil),  // 7: headscale.v1.ListPreAuthKeysResponse
+	(*User)(nil),                     // 8: headscale.v1.User
+	(*timestamppb.Timestamp)(nil),    // 9: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),      // 10: google.protobuf.Duration
 }
 var file_headscale_v1_preauthkey_proto_depIdxs = []int32{
-	7, // 0: headscale.v1.PreAuthKey.user:type_name -> headscale.v1.User
-	8, // 1: headscale.v1.PreAuthKey.expiration:type_name -> google.protobuf.Timestamp
-	8, // 2: headscale.v1.PreAuthKey.created_at:type_name -> google.protobuf.Timestamp
-	8, // 3: headscale.v1.CreatePreAuthKeyRequest.expiration:type_name -> google.protobuf.Timestamp
-	0, // 4: headscale.v1.CreatePreAuthKeyResponse.pre_auth_key:type_name -> headscale.v1.PreAuthKey
-	0, // 5: headscale.v1.ListPreAuthKeysResponse.pre_auth_keys:type_name -> headscale.v1.PreAuthKey
-	6, // [6:6] is the sub-list for method output_type
-	6, // [6:6] is the sub-list for method input_type
-	6, // [6:6] is the sub-list for extension type_name
-	6, // [6:6] is the sub-list for extension extendee
-	0, // [0:6] is the sub-list for field type_name
+	8,  // 0: headscale.v1.PreAuthKey.user:type_name -> headscale.v1.User
+	9,  // 1: headscale.v1.PreAuthKey.expiration:type_name -> google.protobuf.Timestamp
+	9,  // 2: headscale.v1.PreAuthKey.created_at:type_name -> google.protobuf.Timestamp
+	1,  // 3: headscale.v1.PreAuthKey.constraints:type_name -> headscale.v1.PreAuthKeyConstraints
+	10, // 4: headscale.v1.PreAuthKeyConstraints.node_expiry:type_name -> google.protobuf.Duration
+	9,  // 5: headscale.v1.CreatePreAuthKeyRequest.expiration:type_name -> google.protobuf.Timestamp
+	1,  // 6: headscale.v1.CreatePreAuthKeyRequest.constraints:type_name -> headscale.v1.PreAuthKeyConstraints
+	0,  // 7: headscale.v1.CreatePreAuthKeyResponse.pre_auth_key:type_name -> headscale.v1.PreAuthKey
+	0,  // 8: headscale.v1.ListPreAuthKeysResponse.pre_auth_keys:type_name -> headscale.v1.PreAuthKey
+	9,  // [9:9] is the sub-list for method output_type
+	9,  // [9:9] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_headscale_v1_preauthkey_proto_init() }
@@ -515,7 +688,7 @@ func file_headscale_v1_preauthkey_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_headscale_v1_preauthkey_proto_rawDesc), len(file_headscale_v1_preauthkey_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   7,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
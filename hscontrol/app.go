@@ -10,12 +10,12 @@ import (
 	"net/http"
 	_ "net/http/pprof" // nolint
 	"os"
-	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -35,9 +35,9 @@ import (
 	"github.com/juanfont/headscale/hscontrol/routes"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
-	zerolog "github.com/philip-bui/grpc-zerolog"
 	"github.com/pkg/profile"
-	zl "github.com/rs/zerolog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
@@ -56,7 +56,6 @@ import (
 	"tailscale.com/types/dnstype"
 	"tailscale.com/types/key"
 	"tailscale.com/util/dnsname"
-	zcache "zgo.at/zcache/v2"
 )
 
 var (
@@ -74,9 +73,6 @@ const (
 	updateInterval     = 5 * time.Second
 	privateKeyFileMode = 0o600
 	headscaleDirPerm   = 0o700
-
-	registerCacheExpiration = time.Minute * 15
-	registerCacheCleanup    = time.Minute * 20
 )
 
 // Headscale represents the base app of the service.
@@ -85,6 +81,7 @@ type Headscale struct {
 	db              *db.HSDatabase
 	ipAlloc         *db.IPAllocator
 	noisePrivateKey *key.MachinePrivate
+	oauthSigningKey []byte
 	ephemeralGC     *db.EphemeralGarbageCollector
 
 	DERPMap    *tailcfg.DERPMap
@@ -95,67 +92,128 @@ type Headscale struct {
 	extraRecordMan *dns.ExtraRecordsMan
 	primaryRoutes  *routes.PrimaryRoutes
 
+	nodeStore    *db.NodeStore
 	mapper       *mapper.Mapper
 	nodeNotifier *notifier.Notifier
 
-	registrationCache *zcache.Cache[types.RegistrationID, types.RegisterNode]
-
-	authProvider AuthProvider
+	authProvider     AuthProvider
+	hooks            *hooks
+	workloadIdentity *workloadIdentity
+	cluster          *cluster
 
 	pollNetMapStreamWG sync.WaitGroup
+
+	// registry holds the metrics of this instance, logger is the
+	// logger of this instance, so several instances can run in the
+	// same process.
+	registry *prometheus.Registry
+	metrics  *metrics
+	logger   zerolog.Logger
 }
 
 var (
-	profilingEnabled = envknob.Bool("HEADSCALE_DEBUG_PROFILING_ENABLED")
-	profilingPath    = envknob.String("HEADSCALE_DEBUG_PROFILING_PATH")
-	tailsqlEnabled   = envknob.Bool("HEADSCALE_DEBUG_TAILSQL_ENABLED")
-	tailsqlStateDir  = envknob.String("HEADSCALE_DEBUG_TAILSQL_STATE_DIR")
-	tailsqlTSKey     = envknob.String("TS_AUTHKEY")
-	dumpConfig       = envknob.Bool("HEADSCALE_DEBUG_DUMP_CONFIG")
+	tailsqlEnabled  = envknob.Bool("HEADSCALE_DEBUG_TAILSQL_ENABLED")
+	tailsqlStateDir = envknob.String("HEADSCALE_DEBUG_TAILSQL_STATE_DIR")
+	tailsqlTSKey    = envknob.String("TS_AUTHKEY")
 )
 
+// profiling is set while a Headscale instance runs the profiler, which
+// is global to the process.
+var profiling atomic.Bool
+
 func NewHeadscale(cfg *types.Config) (*Headscale, error) {
 	var err error
-	if profilingEnabled {
+	if cfg.Debug.Profiling {
 		runtime.SetBlockProfileRate(1)
 	}
 
+	logger := log.Logger
+	if cfg.Log.Logger != nil {
+		logger = *cfg.Log.Logger
+	}
+	logger = logger.Level(cfg.Log.Level)
+
+	registry := prometheus.NewRegistry()
+
 	noisePrivateKey, err := readOrCreatePrivateKey(cfg.NoisePrivateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read or create Noise protocol private key: %w", err)
 	}
 
-	registrationCache := zcache.New[types.RegistrationID, types.RegisterNode](
-		registerCacheExpiration,
-		registerCacheCleanup,
-	)
+	noiseKeyText, err := noisePrivateKey.MarshalText()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Noise protocol private key: %w", err)
+	}
 
 	app := Headscale{
 		cfg:                cfg,
 		noisePrivateKey:    noisePrivateKey,
-		registrationCache:  registrationCache,
+		oauthSigningKey:    oauthSigningKey(noiseKeyText),
 		pollNetMapStreamWG: sync.WaitGroup{},
-		nodeNotifier:       notifier.NewNotifier(cfg),
+		nodeNotifier:       notifier.NewNotifier(cfg, registry),
 		primaryRoutes:      routes.New(),
+		registry:           registry,
+		metrics:            newMetrics(registry),
+		logger:             logger,
 	}
 
 	app.db, err = db.NewHeadscaleDatabase(
 		cfg.Database,
 		cfg.BaseDomain,
-		registrationCache,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("new database: %w", err)
 	}
+	app.db.SetDefaultQuota(cfg.Quota)
+
+	app.nodeStore, err = db.NewNodeStore(app.db, cfg.Tuning.NodeStorePersistInterval, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	app.hooks = &hooks{
+		Hooks:     cfg.Hooks,
+		db:        app.db,
+		nodeStore: app.nodeStore,
+	}
+
+	if len(cfg.WorkloadIdentity.Issuers) > 0 {
+		app.workloadIdentity = newWorkloadIdentity(cfg.WorkloadIdentity)
+	}
 
 	app.ipAlloc, err = db.NewIPAllocator(app.db, cfg.PrefixV4, cfg.PrefixV6, cfg.IPAllocation)
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.Cluster.Enabled {
+		app.cluster, err = newCluster(&app)
+		if err != nil {
+			return nil, err
+		}
+
+		app.ipAlloc.ReserveInDatabase(app.db)
+	}
+
 	app.ephemeralGC = db.NewEphemeralGarbageCollector(func(ni types.NodeID) {
+		// In a cluster, the leader deletes the ephemeral nodes which are
+		// not connected to any instance.
+		if app.cluster != nil && (!app.isLeader() || app.nodeNotifier.IsConnected(ni)) {
+			return
+		}
+
+		node, ok := app.nodeStore.GetNode(ni)
 		if err := app.db.DeleteEphemeralNode(ni); err != nil {
-			log.Err(err).Uint64("node.id", ni.Uint64()).Msgf("failed to delete ephemeral node")
+			app.logger.Err(err).Uint64("node.id", ni.Uint64()).Msgf("failed to delete ephemeral node")
+			return
+		}
+		app.nodeStore.DeleteNode(ni)
+
+		ctx := types.NotifyCtx(context.Background(), "ephemeral-gc", ni.String())
+		app.nodeNotifier.NotifyAll(ctx, types.UpdatePeerRemoved(ni))
+
+		if ok {
+			app.hooks.nodeRemoved(node)
 		}
 	})
 
@@ -164,7 +222,7 @@ func NewHeadscale(cfg *types.Config) (*Headscale, error) {
 	}
 
 	var authProvider AuthProvider
-	authProvider = NewAuthProviderWeb(cfg.ServerURL)
+	authProvider = NewAuthProviderWeb(cfg.ServerURL, cfg.RegistrationApproval.Enabled)
 	if cfg.OIDC.Issuer != "" {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
@@ -173,18 +231,24 @@ func NewHeadscale(cfg *types.Config) (*Headscale, error) {
 			cfg.ServerURL,
 			&cfg.OIDC,
 			app.db,
+			app.nodeStore,
 			app.nodeNotifier,
 			app.ipAlloc,
 			app.polMan,
+			app.hooks,
 		)
 		if err != nil {
 			if cfg.OIDC.OnlyStartIfOIDCIsAvailable {
 				return nil, err
 			} else {
-				log.Warn().Err(err).Msg("failed to set up OIDC provider, falling back to CLI based authentication")
+				app.logger.Warn().Err(err).Msg("failed to set up OIDC provider, falling back to CLI based authentication")
 			}
 		} else {
 			authProvider = oidcProvider
+
+			if cfg.RegistrationApproval.Enabled && len(cfg.RegistrationApproval.OIDCAdminValues) > 0 {
+				oidcProvider.enableAdminLogin(&cfg.RegistrationApproval, app.startAdminSession)
+			}
 		}
 	}
 	app.authProvider = authProvider
@@ -259,6 +323,13 @@ func (h *Headscale) scheduledTasks(ctx context.Context) {
 		derpTickerChan = derpTicker.C
 	}
 
+	backupTickerChan := make(<-chan time.Time)
+	if h.cfg.Backup.Interval > 0 {
+		backupTicker := time.NewTicker(h.cfg.Backup.Interval)
+		defer backupTicker.Stop()
+		backupTickerChan = backupTicker.C
+	}
+
 	var extraRecordsUpdate <-chan []tailcfg.DNSRecord
 	if h.extraRecordMan != nil {
 		extraRecordsUpdate = h.extraRecordMan.UpdateCh()
@@ -269,10 +340,15 @@ func (h *Headscale) scheduledTasks(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Info().Caller().Msg("scheduled task worker is shutting down.")
+			h.logger.Info().Caller().Msg("scheduled task worker is shutting down.")
 			return
 
 		case <-expireTicker.C:
+			// In a cluster, the leader expires the nodes of every instance.
+			if !h.isLeader() {
+				continue
+			}
+
 			var update types.StateUpdate
 			var changed bool
 
@@ -281,19 +357,31 @@ func (h *Headscale) scheduledTasks(ctx context.Context) {
 
 				return nil
 			}); err != nil {
-				log.Error().Err(err).Msg("database error while expiring nodes")
+				h.logger.Error().Err(err).Msg("database error while expiring nodes")
 				continue
 			}
 
+			if err := h.db.DeleteExpiredRegistrations(); err != nil {
+				h.logger.Error().Err(err).Msg("database error while deleting expired registrations")
+			}
+
 			if changed {
-				log.Trace().Interface("nodes", update.ChangePatches).Msgf("expiring nodes")
+				h.logger.Trace().Interface("nodes", update.ChangePatches).Msgf("expiring nodes")
+
+				expired := make([]types.NodeID, 0, len(update.ChangePatches))
+				for _, patch := range update.ChangePatches {
+					expired = append(expired, types.NodeID(patch.NodeID))
+				}
+				if err := h.nodeStore.Reload(expired...); err != nil {
+					h.logger.Error().Err(err).Msg("failed to reload expired nodes")
+				}
 
 				ctx := types.NotifyCtx(context.Background(), "expire-expired", "na")
 				h.nodeNotifier.NotifyAll(ctx, update)
 			}
 
 		case <-derpTickerChan:
-			log.Info().Msg("Fetching DERPMap updates")
+			h.logger.Info().Msg("Fetching DERPMap updates")
 			h.DERPMap = derp.GetDERPMap(h.cfg.DERP)
 			if h.cfg.DERP.ServerEnabled && h.cfg.DERP.AutomaticallyAddEmbeddedDerpRegion {
 				region, _ := h.DERPServer.GenerateRegion()
@@ -306,16 +394,31 @@ func (h *Headscale) scheduledTasks(ctx context.Context) {
 				DERPMap: h.DERPMap,
 			})
 
-		case records, ok := <-extraRecordsUpdate:
+		case _, ok := <-extraRecordsUpdate:
 			if !ok {
 				continue
 			}
-			h.cfg.TailcfgDNSConfig.ExtraRecords = records
+			if err := h.updateExtraRecords(); err != nil {
+				h.logger.Error().Err(err).Msg("failed to load DNS records from database")
+			}
 
 			ctx := types.NotifyCtx(context.Background(), "dns-extrarecord", "all")
 			// TODO(kradalby): We can probably do better than sending a full update here,
 			// but for now this will ensure that all of the nodes get the new records.
 			h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+
+		case <-backupTickerChan:
+			// In a cluster, the leader backs up the shared database.
+			if !h.isLeader() {
+				continue
+			}
+
+			path, err := h.backupToDirectory()
+			if err != nil {
+				h.logger.Error().Err(err).Msg("failed to write scheduled backup")
+				continue
+			}
+			h.logger.Info().Str("path", path).Msg("wrote scheduled backup")
 		}
 	}
 }
@@ -332,7 +435,7 @@ func (h *Headscale) grpcAuthenticationInterceptor(ctx context.Context,
 	// the server
 	client, _ := peer.FromContext(ctx)
 
-	log.Trace().
+	h.logger.Trace().
 		Caller().
 		Str("client_address", client.Addr.String()).
 		Msg("Client is trying to authenticate")
@@ -362,13 +465,29 @@ func (h *Headscale) grpcAuthenticationInterceptor(ctx context.Context,
 		)
 	}
 
-	valid, err := h.db.ValidateAPIKey(strings.TrimPrefix(token, AuthPrefix))
+	token = strings.TrimPrefix(token, AuthPrefix)
+
+	if isOAuthAccessToken(token) {
+		ctx, err := h.authorizeOAuthAccessToken(ctx, token, info.FullMethod)
+		if err != nil {
+			h.logger.Info().
+				Err(err).
+				Str("client_address", client.Addr.String()).
+				Msg("invalid OAuth access token")
+
+			return ctx, err
+		}
+
+		return handler(ctx, req)
+	}
+
+	valid, err := h.db.ValidateAPIKey(token)
 	if err != nil {
 		return ctx, status.Error(codes.Internal, "failed to validate token")
 	}
 
 	if !valid {
-		log.Info().
+		h.logger.Info().
 			Str("client_address", client.Addr.String()).
 			Msg("invalid token")
 
@@ -383,7 +502,7 @@ func (h *Headscale) httpAuthenticationMiddleware(next http.Handler) http.Handler
 		writer http.ResponseWriter,
 		req *http.Request,
 	) {
-		log.Trace().
+		h.logger.Trace().
 			Caller().
 			Str("client_address", req.RemoteAddr).
 			Msg("HTTP authentication invoked")
@@ -391,14 +510,14 @@ func (h *Headscale) httpAuthenticationMiddleware(next http.Handler) http.Handler
 		authHeader := req.Header.Get("authorization")
 
 		if !strings.HasPrefix(authHeader, AuthPrefix) {
-			log.Error().
+			h.logger.Error().
 				Caller().
 				Str("client_address", req.RemoteAddr).
 				Msg(`missing "Bearer " prefix in "Authorization" header`)
 			writer.WriteHeader(http.StatusUnauthorized)
 			_, err := writer.Write([]byte("Unauthorized"))
 			if err != nil {
-				log.Error().
+				h.logger.Error().
 					Caller().
 					Err(err).
 					Msg("Failed to write response")
@@ -407,9 +526,25 @@ func (h *Headscale) httpAuthenticationMiddleware(next http.Handler) http.Handler
 			return
 		}
 
-		valid, err := h.db.ValidateAPIKey(strings.TrimPrefix(authHeader, AuthPrefix))
+		token := strings.TrimPrefix(authHeader, AuthPrefix)
+
+		var (
+			valid bool
+			err   error
+		)
+		// The scopes of OAuth access tokens are checked by the local
+		// gRPC server, which knows which method is called.
+		if isOAuthAccessToken(token) {
+			_, _, err = h.validateOAuthAccessToken(token)
+			valid = err == nil
+			if errors.Is(err, errOAuthAccessTokenInvalid) || errors.Is(err, errOAuthAccessTokenExpired) {
+				err = nil
+			}
+		} else {
+			valid, err = h.db.ValidateAPIKey(token)
+		}
 		if err != nil {
-			log.Error().
+			h.logger.Error().
 				Caller().
 				Err(err).
 				Str("client_address", req.RemoteAddr).
@@ -418,7 +553,7 @@ func (h *Headscale) httpAuthenticationMiddleware(next http.Handler) http.Handler
 			writer.WriteHeader(http.StatusInternalServerError)
 			_, err := writer.Write([]byte("Unauthorized"))
 			if err != nil {
-				log.Error().
+				h.logger.Error().
 					Caller().
 					Err(err).
 					Msg("Failed to write response")
@@ -428,14 +563,14 @@ func (h *Headscale) httpAuthenticationMiddleware(next http.Handler) http.Handler
 		}
 
 		if !valid {
-			log.Info().
+			h.logger.Info().
 				Str("client_address", req.RemoteAddr).
 				Msg("invalid token")
 
 			writer.WriteHeader(http.StatusUnauthorized)
 			_, err := writer.Write([]byte("Unauthorized"))
 			if err != nil {
-				log.Error().
+				h.logger.Error().
 					Caller().
 					Err(err).
 					Msg("Failed to write response")
@@ -461,7 +596,7 @@ func (h *Headscale) ensureUnixSocketIsAbsent() error {
 
 func (h *Headscale) createRouter(grpcMux *grpcRuntime.ServeMux) *mux.Router {
 	router := mux.NewRouter()
-	router.Use(prometheusMiddleware)
+	router.Use(h.prometheusMiddleware)
 
 	router.HandleFunc(ts2021UpgradePath, h.NoiseUpgradeHandler).
 		Methods(http.MethodPost, http.MethodGet)
@@ -474,6 +609,21 @@ func (h *Headscale) createRouter(grpcMux *grpcRuntime.ServeMux) *mux.Router {
 	if provider, ok := h.authProvider.(*AuthProviderOIDC); ok {
 		router.HandleFunc("/oidc/callback", provider.OIDCCallbackHandler).Methods(http.MethodGet)
 	}
+	if h.cfg.RegistrationApproval.Enabled {
+		router.HandleFunc(adminLoginPath, h.AdminLoginHandler).Methods(http.MethodGet, http.MethodPost)
+		if provider, ok := h.authProvider.(*AuthProviderOIDC); ok {
+			router.HandleFunc(adminLoginPath+"/oidc", provider.AdminLoginHandler).Methods(http.MethodGet)
+		}
+		router.HandleFunc("/admin/logout", h.AdminLogoutHandler).Methods(http.MethodPost)
+		router.HandleFunc(adminRegistrationsPath, h.PendingRegistrationsHandler).Methods(http.MethodGet)
+		router.HandleFunc(adminRegistrationsPath+"/{registration_id}/approve", h.ApproveRegistrationHandler).
+			Methods(http.MethodPost)
+		router.HandleFunc(adminRegistrationsPath+"/{registration_id}/reject", h.RejectRegistrationHandler).
+			Methods(http.MethodPost)
+	}
+	router.HandleFunc(invitePath+"/{token}", h.InviteHandler).Methods(http.MethodGet)
+	router.HandleFunc(invitePath+"/{token}", h.AcceptInviteHandler).Methods(http.MethodPost)
+
 	router.HandleFunc("/apple", h.AppleConfigMessage).Methods(http.MethodGet)
 	router.HandleFunc("/apple/{platform}", h.ApplePlatformConfig).
 		Methods(http.MethodGet)
@@ -485,6 +635,7 @@ func (h *Headscale) createRouter(grpcMux *grpcRuntime.ServeMux) *mux.Router {
 		Methods(http.MethodGet)
 
 	router.HandleFunc("/verify", h.VerifyHandler).Methods(http.MethodPost)
+	router.HandleFunc("/oauth/token", h.OAuthTokenHandler).Methods(http.MethodPost)
 
 	if h.cfg.DERP.ServerEnabled {
 		router.HandleFunc("/derp", h.DERPServer.DERPHandler)
@@ -497,7 +648,7 @@ func (h *Headscale) createRouter(grpcMux *grpcRuntime.ServeMux) *mux.Router {
 	apiRouter.Use(h.httpAuthenticationMiddleware)
 	apiRouter.PathPrefix("/v1/").HandlerFunc(grpcMux.ServeHTTP)
 
-	router.PathPrefix("/").HandlerFunc(notFoundHandler)
+	router.PathPrefix("/").HandlerFunc(h.notFoundHandler)
 
 	return router
 }
@@ -506,12 +657,22 @@ func (h *Headscale) createRouter(grpcMux *grpcRuntime.ServeMux) *mux.Router {
 // Maybe we should attempt a new in memory state and not go via the DB?
 // Maybe this should be implemented as an event bus?
 // A bool is returned indicating if a full update was sent to all nodes
-func usersChangedHook(db *db.HSDatabase, polMan policy.PolicyManager, notif *notifier.Notifier) error {
+func usersChangedHook(
+	db *db.HSDatabase,
+	store *db.NodeStore,
+	polMan policy.PolicyManager,
+	notif *notifier.Notifier,
+) error {
 	users, err := db.ListUsers()
 	if err != nil {
 		return err
 	}
 
+	// Nodes carry their user, reload them to pick up renamed users.
+	if err := store.Reload(); err != nil {
+		return err
+	}
+
 	changed, err := polMan.SetUsers(users)
 	if err != nil {
 		return err
@@ -519,25 +680,23 @@ func usersChangedHook(db *db.HSDatabase, polMan policy.PolicyManager, notif *not
 
 	if changed {
 		ctx := types.NotifyCtx(context.Background(), "acl-users-change", "all")
-		notif.NotifyAll(ctx, types.UpdateFull())
+		notif.NotifyPolicyChange(ctx, polMan, store.ListNodes())
 	}
 
 	return nil
 }
 
 // TODO(kradalby): Do a variant of this, and polman which only updates the node that has changed.
-// Maybe we should attempt a new in memory state and not go via the DB?
 // Maybe this should be implemented as an event bus?
+// The nodes are read from the NodeStore, callers changing nodes in the
+// database must update the store before calling the hook.
 // A bool is returned indicating if a full update was sent to all nodes
 func nodesChangedHook(
-	db *db.HSDatabase,
+	store *db.NodeStore,
 	polMan policy.PolicyManager,
 	notif *notifier.Notifier,
 ) (bool, error) {
-	nodes, err := db.ListNodes()
-	if err != nil {
-		return false, err
-	}
+	nodes := store.ListNodes()
 
 	filterChanged, err := polMan.SetNodes(nodes)
 	if err != nil {
@@ -546,7 +705,7 @@ func nodesChangedHook(
 
 	if filterChanged {
 		ctx := types.NotifyCtx(context.Background(), "acl-nodes-change", "all")
-		notif.NotifyAll(ctx, types.UpdateFull())
+		notif.NotifyPolicyChange(ctx, polMan, nodes)
 
 		return true, nil
 	}
@@ -554,35 +713,78 @@ func nodesChangedHook(
 	return false, nil
 }
 
+// autoApproveRoutes approves the routes of node that the policy auto
+// approves, like policy.AutoApproveRoutes, unless approving them exceeds
+// the route quota of its user, then none of them are approved. It reports
+// whether routes were approved.
+func autoApproveRoutes(
+	tx *gorm.DB,
+	polMan policy.PolicyManager,
+	node *types.Node,
+	defaults types.Quota,
+) (bool, error) {
+	approved := node.ApprovedRoutes
+	if !policy.AutoApproveRoutes(polMan, node) {
+		return false, nil
+	}
+
+	err := db.CheckRouteQuota(tx, node.ID, node.ApprovedRoutes, defaults)
+	if errors.Is(err, db.ErrQuotaExceeded) {
+		log.Warn().
+			Err(err).
+			Uint64("node.id", node.ID.Uint64()).
+			Str("node", node.Hostname).
+			Msg("not auto approving routes exceeding the route quota")
+
+		node.ApprovedRoutes = approved
+
+		return false, nil
+	}
+	if err != nil {
+		node.ApprovedRoutes = approved
+
+		return false, fmt.Errorf("checking route quota: %w", err)
+	}
+
+	return true, nil
+}
+
 // Serve launches the HTTP and gRPC server service Headscale and the API.
-func (h *Headscale) Serve() error {
+// It serves until ctx is done, then shuts down gracefully.
+func (h *Headscale) Serve(ctx context.Context) error {
 	capver.CanOldCodeBeCleanedUp()
 
-	if profilingEnabled {
-		if profilingPath != "" {
-			err := os.MkdirAll(profilingPath, os.ModePerm)
-			if err != nil {
-				log.Fatal().Err(err).Msg("failed to create profiling directory")
-			}
+	if h.cfg.Debug.Profiling {
+		if profiling.CompareAndSwap(false, true) {
+			defer profiling.Store(false)
+
+			if h.cfg.Debug.ProfilingPath != "" {
+				err := os.MkdirAll(h.cfg.Debug.ProfilingPath, os.ModePerm)
+				if err != nil {
+					h.logger.Fatal().Err(err).Msg("failed to create profiling directory")
+				}
 
-			defer profile.Start(profile.ProfilePath(profilingPath)).Stop()
+				defer profile.Start(profile.ProfilePath(h.cfg.Debug.ProfilingPath)).Stop()
+			} else {
+				defer profile.Start().Stop()
+			}
 		} else {
-			defer profile.Start().Stop()
+			h.logger.Warn().Msg("profiling is already running in this process, not profiling this instance")
 		}
 	}
 
-	if dumpConfig {
+	if h.cfg.Debug.DumpConfig {
 		spew.Dump(h.cfg)
 	}
 
-	log.Info().Str("version", types.Version).Str("commit", types.GitCommitHash).Msg("Starting Headscale")
-	log.Info().
+	h.logger.Info().Str("version", types.Version).Str("commit", types.GitCommitHash).Msg("Starting Headscale")
+	h.logger.Info().
 		Str("minimum_version", capver.TailscaleVersion(capver.MinSupportedCapabilityVersion)).
 		Msg("Clients with a lower minimum version will be rejected")
 
 	// Fetch an initial DERP Map before we start serving
 	h.DERPMap = derp.GetDERPMap(h.cfg.DERP)
-	h.mapper = mapper.NewMapper(h.db, h.cfg, h.DERPMap, h.nodeNotifier, h.polMan, h.primaryRoutes)
+	h.mapper = mapper.NewMapper(h.nodeStore, h.cfg, h.DERPMap, h.nodeNotifier, h.polMan, h.primaryRoutes, h.registry)
 
 	if h.cfg.DERP.ServerEnabled {
 		// When embedded DERP is enabled we always need a STUN server
@@ -606,6 +808,12 @@ func (h *Headscale) Serve() error {
 		return errEmptyInitialDERPMap
 	}
 
+	if h.cluster != nil {
+		if err := h.cluster.start(); err != nil {
+			return fmt.Errorf("joining the headscale cluster: %w", err)
+		}
+	}
+
 	// Start ephemeral node garbage collector and schedule all nodes
 	// that are already in the database and ephemeral. If they are still
 	// around between restarts, they will reconnect and the GC will
@@ -624,28 +832,25 @@ func (h *Headscale) Serve() error {
 		if err != nil {
 			return fmt.Errorf("setting up extrarecord manager: %w", err)
 		}
-		h.cfg.TailcfgDNSConfig.ExtraRecords = h.extraRecordMan.Records()
 		go h.extraRecordMan.Run()
 		defer h.extraRecordMan.Close()
 	}
 
+	if err := h.updateExtraRecords(); err != nil {
+		return fmt.Errorf("loading DNS records from database: %w", err)
+	}
+
 	// Start all scheduled tasks, e.g. expiring nodes, derp updates and
 	// records updates
 	scheduleCtx, scheduleCancel := context.WithCancel(context.Background())
 	defer scheduleCancel()
 	go h.scheduledTasks(scheduleCtx)
 
-	if zl.GlobalLevel() == zl.TraceLevel {
-		zerolog.RespLog = true
-	} else {
-		zerolog.RespLog = false
-	}
-
 	// Prepare group for running listeners
 	errorGroup := new(errgroup.Group)
 
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
+	// The servers outlive ctx, to shut down gracefully once it is done.
+	serveCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	//
@@ -690,15 +895,23 @@ func (h *Headscale) Serve() error {
 
 	// Connect to the gRPC server over localhost to skip
 	// the authentication.
-	err = v1.RegisterHeadscaleServiceHandler(ctx, grpcGatewayMux, grpcGatewayConn)
+	err = v1.RegisterHeadscaleServiceHandler(serveCtx, grpcGatewayMux, grpcGatewayConn)
 	if err != nil {
 		return fmt.Errorf("registering Headscale API service to gRPC: %w", err)
 	}
 
 	// Start the local gRPC server without TLS and without authentication
+	// Requests forwarded by the gRPC gateway keep their authorization
+	// header, so the scopes of OAuth access tokens are checked here.
 	grpcSocket := grpc.NewServer(
-	// Uncomment to debug grpc communication.
-	// zerolog.UnaryInterceptor(),
+		grpc.UnaryInterceptor(
+			grpcMiddleware.ChainUnaryServer(
+				h.grpcOAuthScopeInterceptor,
+				UnaryErrorInterceptor,
+			),
+		),
+		// Uncomment to debug grpc communication.
+		// zerolog.UnaryInterceptor(),
 	)
 
 	v1.RegisterHeadscaleServiceServer(grpcSocket, newHeadscaleV1APIServer(h))
@@ -730,13 +943,16 @@ func (h *Headscale) Serve() error {
 
 	var grpcServer *grpc.Server
 	var grpcListener net.Listener
-	if tlsConfig != nil || h.cfg.GRPCAllowInsecure {
-		log.Info().Msgf("Enabling remote gRPC at %s", h.cfg.GRPCAddr)
+	// An empty gRPC address disables the remote gRPC listener, the API is
+	// then only available over the unix socket, or in-process.
+	if h.cfg.GRPCAddr != "" && (tlsConfig != nil || h.cfg.GRPCAllowInsecure) {
+		h.logger.Info().Msgf("Enabling remote gRPC at %s", h.cfg.GRPCAddr)
 
 		grpcOptions := []grpc.ServerOption{
 			grpc.UnaryInterceptor(
 				grpcMiddleware.ChainUnaryServer(
 					h.grpcAuthenticationInterceptor,
+					UnaryErrorInterceptor,
 					// Uncomment to debug grpc communication.
 					// zerolog.NewUnaryServerInterceptor(),
 				),
@@ -748,7 +964,7 @@ func (h *Headscale) Serve() error {
 				grpc.Creds(credentials.NewTLS(tlsConfig)),
 			)
 		} else {
-			log.Warn().Msg("gRPC is running without security")
+			h.logger.Warn().Msg("gRPC is running without security")
 		}
 
 		grpcServer = grpc.NewServer(grpcOptions...)
@@ -763,7 +979,7 @@ func (h *Headscale) Serve() error {
 
 		errorGroup.Go(func() error { return grpcServer.Serve(grpcListener) })
 
-		log.Info().
+		h.logger.Info().
 			Msgf("listening and serving gRPC on: %s", h.cfg.GRPCAddr)
 	}
 
@@ -798,7 +1014,7 @@ func (h *Headscale) Serve() error {
 
 	errorGroup.Go(func() error { return httpServer.Serve(httpListener) })
 
-	log.Info().
+	h.logger.Info().
 		Msgf("listening and serving HTTP on: %s", h.cfg.Addr)
 
 	debugHTTPListener, err := net.Listen("tcp", h.cfg.MetricsAddr)
@@ -809,155 +1025,149 @@ func (h *Headscale) Serve() error {
 	debugHTTPServer := h.debugHTTPServer()
 	errorGroup.Go(func() error { return debugHTTPServer.Serve(debugHTTPListener) })
 
-	log.Info().
+	h.logger.Info().
 		Msgf("listening and serving debug and metrics on: %s", h.cfg.MetricsAddr)
 
 	var tailsqlContext context.Context
 	if tailsqlEnabled {
 		if h.cfg.Database.Type != types.DatabaseSqlite {
-			log.Fatal().
+			h.logger.Fatal().
 				Str("type", h.cfg.Database.Type).
 				Msgf("tailsql only support %q", types.DatabaseSqlite)
 		}
 		if tailsqlTSKey == "" {
-			log.Fatal().Msg("tailsql requires TS_AUTHKEY to be set")
+			h.logger.Fatal().Msg("tailsql requires TS_AUTHKEY to be set")
 		}
 		tailsqlContext = context.Background()
-		go runTailSQLService(ctx, util.TSLogfWrapper(), tailsqlStateDir, h.cfg.Database.Sqlite.Path)
-	}
-
-	// Handle common process-killing signals so we can gracefully shut down:
-	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc,
-		syscall.SIGHUP,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGQUIT,
-		syscall.SIGHUP)
-	sigFunc := func(c chan os.Signal) {
-		// Wait for a SIGINT or SIGKILL:
-		for {
-			sig := <-c
-			switch sig {
-			case syscall.SIGHUP:
-				log.Info().
-					Str("signal", sig.String()).
-					Msg("Received SIGHUP, reloading ACL and Config")
-
-				if h.cfg.Policy.IsEmpty() {
-					continue
-				}
+		go runTailSQLService(serveCtx, util.TSLogfWrapper(), tailsqlStateDir, h.cfg.Database.Sqlite.Path)
+	}
 
-				if err := h.loadPolicyManager(); err != nil {
-					log.Error().Err(err).Msg("failed to reload Policy")
-				}
+	errorGroup.Go(func() error {
+		<-ctx.Done()
 
-				pol, err := h.policyBytes()
-				if err != nil {
-					log.Error().Err(err).Msg("failed to get policy blob")
-				}
+		info := func(msg string) { h.logger.Info().Msg(msg) }
+		h.logger.Info().Msg("Shutting down gracefully")
 
-				changed, err := h.polMan.SetPolicy(pol)
-				if err != nil {
-					log.Error().Err(err).Msg("failed to set new policy")
-				}
+		scheduleCancel()
+		h.ephemeralGC.Close()
 
-				if changed {
-					log.Info().
-						Msg("ACL policy successfully reloaded, notifying nodes of change")
+		// Gracefully shut down servers
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			types.HTTPShutdownTimeout,
+		)
+		defer cancel()
+		info("shutting down debug http server")
+		if err := debugHTTPServer.Shutdown(ctx); err != nil {
+			h.logger.Error().Err(err).Msg("failed to shutdown prometheus http")
+		}
+		info("shutting down main http server")
+		if err := httpServer.Shutdown(ctx); err != nil {
+			h.logger.Error().Err(err).Msg("failed to shutdown http")
+		}
 
-					err = h.autoApproveNodes()
-					if err != nil {
-						log.Error().Err(err).Msg("failed to approve routes after new policy")
-					}
+		info("closing node notifier")
+		h.nodeNotifier.Close()
 
-					ctx := types.NotifyCtx(context.Background(), "acl-sighup", "na")
-					h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
-				}
-			default:
-				info := func(msg string) { log.Info().Msg(msg) }
-				log.Info().
-					Str("signal", sig.String()).
-					Msg("Received signal to stop, shutting down gracefully")
-
-				scheduleCancel()
-				h.ephemeralGC.Close()
-
-				// Gracefully shut down servers
-				ctx, cancel := context.WithTimeout(
-					context.Background(),
-					types.HTTPShutdownTimeout,
-				)
-				info("shutting down debug http server")
-				if err := debugHTTPServer.Shutdown(ctx); err != nil {
-					log.Error().Err(err).Msg("failed to shutdown prometheus http")
-				}
-				info("shutting down main http server")
-				if err := httpServer.Shutdown(ctx); err != nil {
-					log.Error().Err(err).Msg("failed to shutdown http")
-				}
+		info("waiting for netmap stream to close")
+		h.pollNetMapStreamWG.Wait()
 
-				info("closing node notifier")
-				h.nodeNotifier.Close()
+		if h.cluster != nil {
+			info("leaving the headscale cluster")
+			h.cluster.stop()
+		}
 
-				info("waiting for netmap stream to close")
-				h.pollNetMapStreamWG.Wait()
+		info("persisting node store")
+		if err := h.nodeStore.Close(); err != nil {
+			h.logger.Error().Err(err).Msg("failed to persist node store")
+		}
 
-				info("shutting down grpc server (socket)")
-				grpcSocket.GracefulStop()
+		info("shutting down grpc server (socket)")
+		grpcSocket.GracefulStop()
 
-				if grpcServer != nil {
-					info("shutting down grpc server (external)")
-					grpcServer.GracefulStop()
-					grpcListener.Close()
-				}
+		if grpcServer != nil {
+			info("shutting down grpc server (external)")
+			grpcServer.GracefulStop()
+			grpcListener.Close()
+		}
 
-				if tailsqlContext != nil {
-					info("shutting down tailsql")
-					tailsqlContext.Done()
-				}
+		if tailsqlContext != nil {
+			info("shutting down tailsql")
+			tailsqlContext.Done()
+		}
 
-				// Close network listeners
-				info("closing network listeners")
-				debugHTTPListener.Close()
-				httpListener.Close()
-				grpcGatewayConn.Close()
+		// Close network listeners
+		info("closing network listeners")
+		debugHTTPListener.Close()
+		httpListener.Close()
+		grpcGatewayConn.Close()
 
-				// Stop listening (and unlink the socket if unix type):
-				info("closing socket listener")
-				socketListener.Close()
+		// Stop listening (and unlink the socket if unix type):
+		info("closing socket listener")
+		socketListener.Close()
 
-				// Close db connections
-				info("closing database connection")
-				err = h.db.Close()
-				if err != nil {
-					log.Error().Err(err).Msg("failed to close db")
-				}
+		// Close db connections
+		info("closing database connection")
+		if err := h.db.Close(); err != nil {
+			h.logger.Error().Err(err).Msg("failed to close db")
+		}
 
-				log.Info().
-					Msg("Headscale stopped")
+		h.logger.Info().
+			Msg("Headscale stopped")
 
-				// And we're done:
-				cancel()
+		return nil
+	})
 
-				return
-			}
-		}
+	// The HTTP servers return http.ErrServerClosed once shut down.
+	if err := errorGroup.Wait(); !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
-	errorGroup.Go(func() error {
-		sigFunc(sigc)
 
-		return nil
-	})
+	return nil
+}
+
+// ReloadPolicy reloads the policy from its file or the database, and
+// updates the nodes if it changed.
+func (h *Headscale) ReloadPolicy() {
+	if h.cfg.Policy.IsEmpty() {
+		return
+	}
+
+	if err := h.loadPolicyManager(); err != nil {
+		h.logger.Error().Err(err).Msg("failed to reload Policy")
+	}
+
+	pol, err := h.policyBytes()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to get policy blob")
+	}
+
+	changed, err := h.polMan.SetPolicy(pol)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to set new policy")
+	}
+
+	if changed {
+		h.logger.Info().
+			Msg("ACL policy successfully reloaded, notifying nodes of change")
+
+		err = h.autoApproveNodes()
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to approve routes after new policy")
+		}
+
+		ctx := types.NotifyCtx(context.Background(), "acl-sighup", "na")
+		h.nodeNotifier.NotifyPolicyChange(ctx, h.polMan, h.nodeStore.ListNodes())
 
-	return errorGroup.Wait()
+		h.hooks.policyChanged(pol)
+	}
 }
 
 func (h *Headscale) getTLSSettings() (*tls.Config, error) {
 	var err error
 	if h.cfg.TLS.LetsEncrypt.Hostname != "" {
 		if !strings.HasPrefix(h.cfg.ServerURL, "https://") {
-			log.Warn().
+			h.logger.Warn().
 				Msg("Listening with TLS but ServerURL does not start with https://")
 		}
 
@@ -991,7 +1201,7 @@ func (h *Headscale) getTLSSettings() (*tls.Config, error) {
 
 			go func() {
 				err := server.ListenAndServe()
-				log.Fatal().
+				h.logger.Fatal().
 					Caller().
 					Err(err).
 					Msg("failed to set up a HTTP server")
@@ -1004,13 +1214,13 @@ func (h *Headscale) getTLSSettings() (*tls.Config, error) {
 		}
 	} else if h.cfg.TLS.CertPath == "" {
 		if !strings.HasPrefix(h.cfg.ServerURL, "http://") {
-			log.Warn().Msg("Listening without TLS but ServerURL does not start with http://")
+			h.logger.Warn().Msg("Listening without TLS but ServerURL does not start with http://")
 		}
 
 		return nil, err
 	} else {
 		if !strings.HasPrefix(h.cfg.ServerURL, "https://") {
-			log.Warn().Msg("Listening with TLS but ServerURL does not start with https://")
+			h.logger.Warn().Msg("Listening with TLS but ServerURL does not start with https://")
 		}
 
 		tlsConfig := &tls.Config{
@@ -1025,11 +1235,11 @@ func (h *Headscale) getTLSSettings() (*tls.Config, error) {
 	}
 }
 
-func notFoundHandler(
+func (h *Headscale) notFoundHandler(
 	writer http.ResponseWriter,
 	req *http.Request,
 ) {
-	log.Trace().
+	h.logger.Trace().
 		Interface("header", req.Header).
 		Interface("proto", req.Proto).
 		Interface("url", req.URL).
@@ -1081,6 +1291,34 @@ func readOrCreatePrivateKey(path string) (*key.MachinePrivate, error) {
 	return &machineKey, nil
 }
 
+// updateExtraRecords sets the extra DNS records served to the nodes, the
+// records of the configuration, or of the extra records file, followed by
+// the records managed through the API.
+func (h *Headscale) updateExtraRecords() error {
+	if h.cfg.TailcfgDNSConfig == nil {
+		return nil
+	}
+
+	records := h.cfg.DNSConfig.ExtraRecords
+	if h.extraRecordMan != nil {
+		records = h.extraRecordMan.Records()
+	}
+
+	dbRecords, err := h.db.ListDNSRecords()
+	if err != nil {
+		return err
+	}
+
+	records = slices.Clone(records)
+	for _, record := range dbRecords {
+		records = append(records, record.Tailcfg())
+	}
+
+	h.cfg.TailcfgDNSConfig.ExtraRecords = records
+
+	return nil
+}
+
 // policyBytes returns the appropriate policy for the
 // current configuration as a []byte array.
 func (h *Headscale) policyBytes() ([]byte, error) {
@@ -1093,8 +1331,8 @@ func (h *Headscale) policyBytes() ([]byte, error) {
 			return nil, nil
 		}
 
-		absPath := util.AbsolutePathFromConfigPath(path)
-		policyFile, err := os.Open(absPath)
+		// The path is made absolute when the configuration is loaded.
+		policyFile, err := os.Open(path)
 		if err != nil {
 			return nil, err
 		}
@@ -1155,7 +1393,7 @@ func (h *Headscale) loadPolicyManager() error {
 			errOut = fmt.Errorf("creating policy manager: %w", err)
 			return
 		}
-		log.Info().Msgf("Using policy manager version: %d", h.polMan.Version())
+		h.logger.Info().Msgf("Using policy manager version: %d", h.polMan.Version())
 
 		if len(nodes) > 0 {
 			_, err = h.polMan.SSHPolicy(nodes[0])
@@ -1171,7 +1409,8 @@ func (h *Headscale) loadPolicyManager() error {
 
 // autoApproveNodes mass approves routes on all nodes. It is _only_ intended for
 // use when the policy is replaced. It is not sending or reporting any changes
-// or updates as we send full updates after replacing the policy.
+// or updates as the nodes affected by the new policy, including the changed
+// routes, are notified after replacing the policy.
 // TODO(kradalby): This is kind of messy, maybe this is another +1
 // for an event bus. See example comments here.
 func (h *Headscale) autoApproveNodes() error {
@@ -1182,7 +1421,11 @@ func (h *Headscale) autoApproveNodes() error {
 		}
 
 		for _, node := range nodes {
-			changed := policy.AutoApproveRoutes(h.polMan, node)
+			changed, err := autoApproveRoutes(tx, h.polMan, node, h.db.DefaultQuota())
+			if err != nil {
+				return err
+			}
+
 			if changed {
 				err = tx.Save(node).Error
 				if err != nil {
@@ -1199,5 +1442,9 @@ func (h *Headscale) autoApproveNodes() error {
 		return fmt.Errorf("auto approving routes for nodes: %w", err)
 	}
 
+	if err := h.nodeStore.Reload(); err != nil {
+		return fmt.Errorf("reloading nodes after auto approving routes: %w", err)
+	}
+
 	return nil
 }
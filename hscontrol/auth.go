@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/notifier"
 	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
@@ -29,12 +31,7 @@ func (h *Headscale) handleRegister(
 	regReq tailcfg.RegisterRequest,
 	machineKey key.MachinePublic,
 ) (*tailcfg.RegisterResponse, error) {
-	node, err := h.db.GetNodeByNodeKey(regReq.NodeKey)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("looking up node in database: %w", err)
-	}
-
-	if node != nil {
+	if node, ok := h.nodeStore.GetNodeByNodeKey(regReq.NodeKey); ok {
 		resp, err := h.handleExistingNode(node, regReq, machineKey)
 		if err != nil {
 			return nil, fmt.Errorf("handling existing node: %w", err)
@@ -47,8 +44,17 @@ func (h *Headscale) handleRegister(
 		return h.waitForFollowup(ctx, regReq)
 	}
 
+	if regReq.Auth != nil && isWorkloadIdentityToken(regReq.Auth.AuthKey) && h.workloadIdentity != nil {
+		resp, err := h.handleRegisterWithWorkloadIdentity(ctx, regReq, machineKey)
+		if err != nil {
+			return nil, fmt.Errorf("handling register with workload identity: %w", err)
+		}
+
+		return resp, nil
+	}
+
 	if regReq.Auth != nil && regReq.Auth.AuthKey != "" {
-		resp, err := h.handleRegisterWithAuthKey(regReq, machineKey)
+		resp, err := h.handleRegisterWithAuthKey(ctx, regReq, machineKey)
 		if err != nil {
 			return nil, fmt.Errorf("handling register with auth key: %w", err)
 		}
@@ -89,9 +95,12 @@ func (h *Headscale) handleExistingNode(
 				if err != nil {
 					return nil, fmt.Errorf("deleting ephemeral node: %w", err)
 				}
+				h.nodeStore.DeleteNode(node.ID)
 
 				ctx := types.NotifyCtx(context.Background(), "logout-ephemeral", "na")
 				h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerRemoved(node.ID))
+
+				h.hooks.nodeRemoved(node)
 			}
 
 			expired = true
@@ -102,6 +111,10 @@ func (h *Headscale) handleExistingNode(
 			return nil, fmt.Errorf("setting node expiry: %w", err)
 		}
 
+		if err := h.nodeStore.Reload(node.ID); err != nil {
+			return nil, fmt.Errorf("reloading node: %w", err)
+		}
+
 		ctx := types.NotifyCtx(context.Background(), "logout-expiry", "na")
 		h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdateExpire(node.ID, requestExpiry), node.ID)
 	}
@@ -138,19 +151,35 @@ func (h *Headscale) waitForFollowup(
 		return nil, NewHTTPError(http.StatusUnauthorized, "invalid registration ID", err)
 	}
 
-	if reg, ok := h.registrationCache.Get(followupReg); ok {
-		select {
-		case <-ctx.Done():
-			return nil, NewHTTPError(http.StatusUnauthorized, "registration timed out", err)
-		case node := <-reg.Registered:
-			if node == nil {
-				return nil, NewHTTPError(http.StatusUnauthorized, "node not found", nil)
-			}
-			return nodeToRegisterResponse(node), nil
+	node, err := h.db.WaitForRegistration(ctx, followupReg)
+	switch {
+	case err == nil:
+		return nodeToRegisterResponse(node), nil
+	case errors.Is(err, db.ErrNodeNotFoundRegistrationCache):
+		return nil, NewHTTPError(http.StatusNotFound, "followup registration not found", nil)
+	case errors.Is(err, db.ErrRegistrationRejected):
+		var rejected db.RegistrationRejectedError
+		if errors.As(err, &rejected) {
+			return nil, NewHTTPError(http.StatusForbidden, rejected.Reason, err)
 		}
+
+		return nil, NewHTTPError(http.StatusUnauthorized, "node not found", err)
+	case ctx.Err() != nil:
+		return nil, NewHTTPError(http.StatusUnauthorized, "registration timed out", err)
+	default:
+		return nil, err
 	}
+}
 
-	return nil, NewHTTPError(http.StatusNotFound, "followup registration not found", nil)
+// quotaHTTPError returns a QuotaError in err as an HTTPError, so that the
+// client is told which quota is reached.
+func quotaHTTPError(err error) error {
+	var quotaErr db.QuotaError
+	if errors.As(err, &quotaErr) {
+		return NewHTTPError(http.StatusForbidden, quotaErr.Error(), err)
+	}
+
+	return err
 }
 
 // canUsePreAuthKey checks if a pre auth key can be used.
@@ -161,6 +190,17 @@ func canUsePreAuthKey(pak *types.PreAuthKey) error {
 	if pak.Expiration != nil && pak.Expiration.Before(time.Now()) {
 		return NewHTTPError(http.StatusUnauthorized, "authkey expired", nil)
 	}
+	if pak.User.IsDisabled() {
+		return NewHTTPError(http.StatusUnauthorized, "user is disabled", db.ErrUserDisabled)
+	}
+
+	if pak.MaxUses > 0 {
+		if pak.UseCount >= pak.MaxUses {
+			return NewHTTPError(http.StatusUnauthorized, "authkey has reached its usage limit", nil)
+		}
+
+		return nil
+	}
 
 	// we don't need to check if has been used before
 	if pak.Reusable {
@@ -175,12 +215,13 @@ func canUsePreAuthKey(pak *types.PreAuthKey) error {
 }
 
 func (h *Headscale) handleRegisterWithAuthKey(
+	ctx context.Context,
 	regReq tailcfg.RegisterRequest,
 	machineKey key.MachinePublic,
 ) (*tailcfg.RegisterResponse, error) {
 	pak, err := h.db.GetPreAuthKey(regReq.Auth.AuthKey)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, db.ErrPreAuthKeyNotFound) {
 			return nil, NewHTTPError(http.StatusUnauthorized, "invalid pre auth key", nil)
 		}
 		return nil, err
@@ -191,6 +232,10 @@ func (h *Headscale) handleRegisterWithAuthKey(
 		return nil, err
 	}
 
+	if err := pak.Constraints.Allows(regReq.Hostinfo); err != nil {
+		return nil, NewHTTPError(http.StatusUnauthorized, err.Error(), err)
+	}
+
 	nodeToRegister := types.Node{
 		Hostname:       regReq.Hostinfo.Hostname,
 		UserID:         pak.User.ID,
@@ -204,21 +249,90 @@ func (h *Headscale) handleRegisterWithAuthKey(
 		// TODO(kradalby): This should not be set on the node,
 		// they should be looked up through the key, which is
 		// attached to the node.
-		ForcedTags: pak.Proto().GetAclTags(),
-		AuthKey:    pak,
-		AuthKeyID:  &pak.ID,
+		ForcedTags:     pak.Proto().GetAclTags(),
+		AuthKey:        pak,
+		AuthKeyID:      &pak.ID,
+		ApprovedRoutes: slices.Clone(pak.Constraints.ApprovedRoutes),
 	}
 
 	if !regReq.Expiry.IsZero() {
 		nodeToRegister.Expiry = &regReq.Expiry
 	}
 
+	if pak.Constraints.NodeExpiry > 0 {
+		expiry := time.Now().Add(pak.Constraints.NodeExpiry)
+		if nodeToRegister.Expiry == nil || nodeToRegister.Expiry.After(expiry) {
+			nodeToRegister.Expiry = &expiry
+		}
+	}
+
+	if err := h.hooks.admit(ctx, &nodeToRegister, &pak.User, util.RegisterMethodAuthKey); err != nil {
+		return nil, err
+	}
+
+	// A node registering again to the same user is updated, not added, and
+	// does not use the key again if it was registered with it.
+	oldNode, _ := h.nodeStore.GetNodeByMachineKey(machineKey)
+	existing := oldNode != nil && oldNode.UserID == pak.User.ID
+	reauth := existing && oldNode.AuthKeyID != nil && *oldNode.AuthKeyID == pak.ID
+
+	node, err := h.registerNode(nodeToRegister, existing, func(tx *gorm.DB) error {
+		if reauth {
+			return nil
+		}
+
+		err := db.UsePreAuthKey(tx, pak)
+		if errors.Is(err, db.ErrPreAuthKeyExhausted) {
+			return NewHTTPError(http.StatusUnauthorized, "authkey has reached its usage limit", err)
+		}
+		if err != nil {
+			return fmt.Errorf("using pre auth key: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tailcfg.RegisterResponse{
+		MachineAuthorized: true,
+		NodeKeyExpired:    node.IsExpired(),
+		User:              *pak.User.TailscaleUser(),
+		Login:             *pak.User.TailscaleLogin(),
+	}, nil
+}
+
+// registerNode adds a node registered with an auth key or a workload
+// identity token. use is called in the transaction registering the node,
+// existing tells that the node replaces a node of the same user, which is
+// then updated and not added.
+func (h *Headscale) registerNode(
+	nodeToRegister types.Node,
+	existing bool,
+	use func(tx *gorm.DB) error,
+) (*types.Node, error) {
+	// The IPs are not given back when the registration fails, so the quota
+	// is checked before allocating them, and again when registering.
+	err := h.db.Read(func(rx *gorm.DB) error {
+		return db.CheckNodeQuota(rx, &nodeToRegister, h.db.DefaultQuota())
+	})
+	if err != nil {
+		return nil, quotaHTTPError(err)
+	}
+
 	ipv4, ipv6, err := h.ipAlloc.Next()
 	if err != nil {
 		return nil, fmt.Errorf("allocating IPs: %w", err)
 	}
 
+	h.nodeStore.DiscardPending(nodeToRegister.MachineKey)
+
 	node, err := db.Write(h.db.DB, func(tx *gorm.DB) (*types.Node, error) {
+		if err := db.CheckNodeQuota(tx, &nodeToRegister, h.db.DefaultQuota()); err != nil {
+			return nil, err
+		}
+
 		node, err := db.RegisterNode(tx,
 			nodeToRegister,
 			ipv4, ipv6,
@@ -227,22 +341,122 @@ func (h *Headscale) handleRegisterWithAuthKey(
 			return nil, fmt.Errorf("registering node: %w", err)
 		}
 
-		if !pak.Reusable {
-			err = db.UsePreAuthKey(tx, pak)
-			if err != nil {
-				return nil, fmt.Errorf("using pre auth key: %w", err)
-			}
+		if err := use(tx); err != nil {
+			return nil, err
 		}
 
 		return node, nil
 	})
 	if err != nil {
+		return nil, quotaHTTPError(err)
+	}
+
+	if err := h.registrar().finishRegistration(node, !existing); err != nil {
 		return nil, err
 	}
 
-	updateSent, err := nodesChangedHook(h.db, h.polMan, h.nodeNotifier)
+	return node, nil
+}
+
+// registerFromAuthPath registers the node waiting in the registration cache
+// under registrationID to user, as approved by an admin, and wakes up the
+// client waiting for it.
+func (h *Headscale) registerFromAuthPath(
+	ctx context.Context,
+	registrationID types.RegistrationID,
+	user *types.User,
+	expiry *time.Time,
+	method string,
+) (*types.Node, error) {
+	node, _, err := h.registrar().registerFromAuthPath(ctx, registrationID, user, expiry, method)
+
+	return node, err
+}
+
+// registrar holds what registering a node touches, so the registration
+// paths of Headscale and of the OIDC provider share one implementation.
+type registrar struct {
+	db        *db.HSDatabase
+	nodeStore *db.NodeStore
+	notifier  *notifier.Notifier
+	ipAlloc   *db.IPAllocator
+	polMan    policy.PolicyManager
+	hooks     *hooks
+}
+
+func (h *Headscale) registrar() registrar {
+	return registrar{
+		db:        h.db,
+		nodeStore: h.nodeStore,
+		notifier:  h.nodeNotifier,
+		ipAlloc:   h.ipAlloc,
+		polMan:    h.polMan,
+		hooks:     h.hooks,
+	}
+}
+
+// registerFromAuthPath registers the node waiting in the registration cache
+// under registrationID to user, after the registration hook admitted it.
+// It reports whether the node is new, or an existing node logging in again.
+func (r registrar) registerFromAuthPath(
+	ctx context.Context,
+	registrationID types.RegistrationID,
+	user *types.User,
+	expiry *time.Time,
+	method string,
+) (*types.Node, bool, error) {
+	expiry, err := r.hooks.admitCached(ctx, registrationID, user, method, expiry)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The IPs are not given back when the registration fails, so the quota
+	// is checked before allocating them.
+	if err := r.db.CheckAuthPathQuota(registrationID, types.UserID(user.ID)); err != nil {
+		return nil, false, quotaHTTPError(err)
+	}
+
+	ipv4, ipv6, err := r.ipAlloc.Next()
+	if err != nil {
+		return nil, false, fmt.Errorf("allocating IPs: %w", err)
+	}
+
+	if reg, err := r.db.GetPendingRegistration(registrationID); err == nil {
+		r.nodeStore.DiscardPending(reg.Node.MachineKey)
+	}
+
+	node, newNode, err := r.db.HandleNodeFromAuthPath(
+		registrationID,
+		types.UserID(user.ID),
+		expiry,
+		method,
+		ipv4, ipv6,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("nodes changed hook: %w", err)
+		return nil, false, quotaHTTPError(err)
+	}
+
+	if err := r.finishRegistration(node, newNode); err != nil {
+		return nil, false, err
+	}
+
+	return node, newNode, nil
+}
+
+// finishRegistration makes a node just written to the database known to the
+// node store and the policy, approves its routes and tells the other nodes
+// about it.
+func (r registrar) finishRegistration(node *types.Node, newNode bool) error {
+	if _, err := r.nodeStore.LoadNode(node.ID); err != nil {
+		return fmt.Errorf("loading registered node: %w", err)
+	}
+
+	// Send an update to all nodes if this is a new node that they need to know
+	// about.
+	// If this is a refresh, just send new expiry updates.
+	updateSent, err := nodesChangedHook(r.nodeStore, r.polMan, r.notifier)
+	if err != nil {
+		return fmt.Errorf("updating resources using node: %w", err)
 	}
 
 	// This is a bit of a back and forth, but we have a bit of a chicken and egg
@@ -256,22 +470,32 @@ func (h *Headscale) handleRegisterWithAuthKey(
 	// ensure we send an update.
 	// This works, but might be another good candidate for doing some sort of
 	// eventbus.
-	routesChanged := policy.AutoApproveRoutes(h.polMan, node)
-	if err := h.db.DB.Save(node).Error; err != nil {
-		return nil, fmt.Errorf("saving auto approved routes to node: %w", err)
+	routesChanged, err := autoApproveRoutes(r.db.DB, r.polMan, node, r.db.DefaultQuota())
+	if err != nil {
+		return err
+	}
+
+	if err := r.db.DB.Save(node).Error; err != nil {
+		return fmt.Errorf("saving auto approved routes to node: %w", err)
+	}
+
+	if err := r.nodeStore.Reload(node.ID); err != nil {
+		return fmt.Errorf("reloading node: %w", err)
 	}
 
 	if !updateSent || routesChanged {
-		ctx := types.NotifyCtx(context.Background(), "node updated", node.Hostname)
-		h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(node.ID))
+		ctx := types.NotifyCtx(context.Background(), "node-registered-self", node.Hostname)
+		r.notifier.NotifyByNodeID(ctx, types.UpdateSelf(node.ID), node.ID)
+
+		ctx = types.NotifyCtx(context.Background(), "node-registered-peers", node.Hostname)
+		r.notifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
 	}
 
-	return &tailcfg.RegisterResponse{
-		MachineAuthorized: true,
-		NodeKeyExpired:    node.IsExpired(),
-		User:              *pak.User.TailscaleUser(),
-		Login:             *pak.User.TailscaleLogin(),
-	}, nil
+	if newNode {
+		r.hooks.nodeAdded(node)
+	}
+
+	return nil
 }
 
 func (h *Headscale) handleRegisterInteractive(
@@ -283,25 +507,22 @@ func (h *Headscale) handleRegisterInteractive(
 		return nil, fmt.Errorf("generating registration ID: %w", err)
 	}
 
-	nodeToRegister := types.RegisterNode{
-		Node: types.Node{
-			Hostname:   regReq.Hostinfo.Hostname,
-			MachineKey: machineKey,
-			NodeKey:    regReq.NodeKey,
-			Hostinfo:   regReq.Hostinfo,
-			LastSeen:   ptr.To(time.Now()),
-		},
-		Registered: make(chan *types.Node),
+	nodeToRegister := types.Node{
+		Hostname:   regReq.Hostinfo.Hostname,
+		MachineKey: machineKey,
+		NodeKey:    regReq.NodeKey,
+		Hostinfo:   regReq.Hostinfo,
+		LastSeen:   ptr.To(time.Now()),
 	}
 
 	if !regReq.Expiry.IsZero() {
-		nodeToRegister.Node.Expiry = &regReq.Expiry
+		nodeToRegister.Expiry = &regReq.Expiry
 	}
 
-	h.registrationCache.Set(
-		registrationId,
-		nodeToRegister,
-	)
+	err = h.db.CreatePendingRegistration(registrationId, nodeToRegister)
+	if err != nil {
+		return nil, err
+	}
 
 	return &tailcfg.RegisterResponse{
 		AuthURL: h.authProvider.AuthURL(registrationId),
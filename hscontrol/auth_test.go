@@ -1,12 +1,22 @@
 package hscontrol
 
 import (
+	"context"
 	"net/http"
+	"net/netip"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/ptr"
 )
 
 func TestCanUsePreAuthKey(t *testing.T) {
@@ -102,6 +112,28 @@ func TestCanUsePreAuthKey(t *testing.T) {
 			wantErr: true,
 			err:     NewHTTPError(http.StatusUnauthorized, "authkey already used", nil),
 		},
+		{
+			name: "key with uses left",
+			pak: &types.PreAuthKey{
+				Reusable:   false,
+				MaxUses:    3,
+				UseCount:   2,
+				Expiration: &future,
+			},
+			wantErr: false,
+		},
+		{
+			name: "key with no uses left",
+			pak: &types.PreAuthKey{
+				Reusable:   true,
+				Used:       true,
+				MaxUses:    3,
+				UseCount:   3,
+				Expiration: &future,
+			},
+			wantErr: true,
+			err:     NewHTTPError(http.StatusUnauthorized, "authkey has reached its usage limit", nil),
+		},
 	}
 
 	for _, tt := range tests {
@@ -128,3 +160,87 @@ func TestCanUsePreAuthKey(t *testing.T) {
 		})
 	}
 }
+
+func TestAutoApproveRoutesQuota(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	h.db.SetDefaultQuota(types.Quota{MaxRoutes: 1})
+
+	user, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	routes := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("10.0.1.0/24"),
+	}
+
+	node, err := h.db.RegisterNode(types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "router",
+		UserID:         user.ID,
+		User:           *user,
+		RegisterMethod: util.RegisterMethodCLI,
+		Hostinfo:       &tailcfg.Hostinfo{RoutableIPs: routes},
+	}, ptr.To(netip.MustParseAddr("100.64.0.1")), nil)
+	require.NoError(t, err)
+
+	polMan, err := policy.NewPolicyManager([]byte(`{
+		"acls": [{"action": "accept", "src": ["*"], "dst": ["*:*"]}],
+		"autoApprovers": {"routes": {"10.0.0.0/8": ["alice@"]}}
+	}`), []types.User{*user}, types.Nodes{node})
+	require.NoError(t, err)
+
+	// Approving both routes exceeds the quota, none of them is approved.
+	changed, err := autoApproveRoutes(h.db.DB, polMan, node, h.db.DefaultQuota())
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Empty(t, node.ApprovedRoutes)
+
+	_, err = h.db.SetUserQuota(types.UserID(user.ID), types.UserQuota{MaxRoutes: ptr.To(2)})
+	require.NoError(t, err)
+
+	changed, err = autoApproveRoutes(h.db.DB, polMan, node, h.db.DefaultQuota())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, routes, node.ApprovedRoutes)
+}
+
+func TestOverQuotaRegistrationKeepsIPs(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	h.db.SetDefaultQuota(types.Quota{MaxNodes: 1})
+
+	var err error
+	h.ipAlloc, err = db.NewIPAllocator(h.db, ptr.To(netip.MustParsePrefix("100.64.0.0/10")), nil, types.IPAllocationStrategySequential)
+	require.NoError(t, err)
+
+	user, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	pak, err := h.db.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, nil)
+	require.NoError(t, err)
+
+	register := func() error {
+		_, err := h.handleRegister(context.Background(), tailcfg.RegisterRequest{
+			NodeKey:  key.NewNode().Public(),
+			Auth:     &tailcfg.RegisterResponseAuth{AuthKey: pak.Key},
+			Hostinfo: &tailcfg.Hostinfo{Hostname: "laptop"},
+		}, key.NewMachine().Public())
+
+		return err
+	}
+
+	require.NoError(t, register())
+	require.ErrorIs(t, register(), db.ErrQuotaExceeded)
+
+	id := addPendingRegistration(t, h, "phone")
+	_, err = h.registerFromAuthPath(context.Background(), id, user, nil, util.RegisterMethodCLI)
+	require.ErrorIs(t, err, db.ErrQuotaExceeded)
+
+	_, err = h.db.WaitForRegistration(context.Background(), id)
+	require.ErrorIs(t, err, db.ErrRegistrationRejected)
+
+	// The rejected registrations did not use any IP.
+	ipv4, _, err := h.ipAlloc.Next()
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("100.64.0.2"), *ipv4)
+}
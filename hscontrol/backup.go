@@ -0,0 +1,213 @@
+package hscontrol
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"tailscale.com/types/key"
+)
+
+const (
+	backupFilePrefix = "headscale-"
+	backupFileSuffix = ".json.gz"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+// WriteBackup writes a backup of the database and of the private keys of
+// the server to w, as gzip compressed JSON.
+func WriteBackup(cfg *types.Config, hsdb *db.HSDatabase, w io.Writer) (*types.Backup, error) {
+	backup, err := hsdb.Backup()
+	if err != nil {
+		return nil, err
+	}
+
+	backup.Version = types.BackupVersion
+	backup.CreatedAt = time.Now().UTC()
+	backup.HeadscaleVersion = types.Version
+
+	backup.NoisePrivateKey, err = readPrivateKeyFile(cfg.NoisePrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DERP.ServerEnabled {
+		backup.DERPPrivateKey, err = readPrivateKeyFile(cfg.DERP.ServerPrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(backup); err != nil {
+		return nil, fmt.Errorf("writing backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("writing backup: %w", err)
+	}
+
+	return backup, nil
+}
+
+// ReadBackup reads a backup written by WriteBackup.
+func ReadBackup(r io.Reader) (*types.Backup, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading backup: %w", err)
+	}
+	defer gz.Close()
+
+	var backup types.Backup
+	if err := json.NewDecoder(gz).Decode(&backup); err != nil {
+		return nil, fmt.Errorf("reading backup: %w", err)
+	}
+
+	if backup.Version != types.BackupVersion {
+		return nil, fmt.Errorf("%w: %d, this version of headscale reads version %d", types.ErrBackupVersion, backup.Version, types.BackupVersion)
+	}
+
+	return &backup, nil
+}
+
+// RestoreBackup restores the backup to the database, which must be empty,
+// and writes the private keys of the backup to the paths of the
+// configuration. Existing key files holding another key are only replaced
+// with force.
+func RestoreBackup(cfg *types.Config, hsdb *db.HSDatabase, backup *types.Backup, force bool) error {
+	type keyFile struct {
+		path string
+		key  string
+	}
+
+	var keys []keyFile
+	if backup.NoisePrivateKey != "" {
+		keys = append(keys, keyFile{cfg.NoisePrivateKeyPath, backup.NoisePrivateKey})
+	}
+	if backup.DERPPrivateKey != "" && cfg.DERP.ServerPrivateKeyPath != "" {
+		keys = append(keys, keyFile{cfg.DERP.ServerPrivateKeyPath, backup.DERPPrivateKey})
+	}
+
+	// The keys are checked before the database is written, so that a
+	// conflicting key file does not leave a half restored server.
+	for _, k := range keys {
+		var machineKey key.MachinePrivate
+		if err := machineKey.UnmarshalText([]byte(k.key)); err != nil {
+			return fmt.Errorf("parsing private key of backup: %w", err)
+		}
+
+		existing, err := readPrivateKeyFile(k.path)
+		if err != nil {
+			return err
+		}
+		if existing != "" && existing != k.key && !force {
+			return fmt.Errorf("%w: %s", types.ErrBackupPrivateKey, k.path)
+		}
+	}
+
+	if err := hsdb.Restore(backup); err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if err := util.EnsureDir(filepath.Dir(k.path)); err != nil {
+			return fmt.Errorf("ensuring private key directory: %w", err)
+		}
+
+		if err := os.WriteFile(k.path, []byte(k.key), privateKeyFileMode); err != nil {
+			return fmt.Errorf("writing private key to %q: %w", k.path, err)
+		}
+	}
+
+	return nil
+}
+
+// readPrivateKeyFile returns the content of a private key file, or an
+// empty string if it does not exist.
+func readPrivateKeyFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("reading private key file: %w", err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// backupToDirectory writes a backup to the backup directory, and removes
+// the oldest backups beyond the retention. It returns the path of the
+// backup.
+func (h *Headscale) backupToDirectory() (string, error) {
+	dir := h.cfg.Backup.Directory
+	if err := util.EnsureDir(dir); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, backupFilePrefix+time.Now().UTC().Format(backupTimeFormat)+backupFileSuffix)
+
+	// The backup is written to a temporary file first, so that the
+	// directory only holds complete backups. The file is only readable
+	// by headscale, as it holds the private keys.
+	f, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return "", fmt.Errorf("creating backup file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := WriteBackup(h.cfg, h.db, f); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("writing backup: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", fmt.Errorf("writing backup: %w", err)
+	}
+
+	return path, pruneBackups(dir, h.cfg.Backup.Retention)
+}
+
+// pruneBackups removes the oldest backups of dir, keeping retention
+// backups. Zero keeps all backups.
+func pruneBackups(dir string, retention int) error {
+	if retention <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("listing backups: %w", err)
+	}
+
+	// The names hold the time of the backup, their order is the order of
+	// the backups.
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	slices.Sort(backups)
+
+	for len(backups) > retention {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return fmt.Errorf("removing backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
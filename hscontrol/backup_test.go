@@ -0,0 +1,134 @@
+package hscontrol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupToDirectory(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	_, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	h.cfg.Backup = types.BackupConfig{
+		Directory: filepath.Join(t.TempDir(), "backups"),
+		Retention: 1,
+	}
+
+	path, err := h.backupToDirectory()
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(h.cfg.Backup.Directory)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "the temporary file is removed")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(privateKeyFileMode), info.Mode().Perm())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	backup, err := ReadBackup(f)
+	require.NoError(t, err)
+	assert.Equal(t, types.BackupVersion, backup.Version)
+	assert.NotEmpty(t, backup.Migration)
+	require.Len(t, backup.Users, 1)
+	assert.Equal(t, "alice", backup.Users[0].Name)
+
+	noiseKey, err := readPrivateKeyFile(h.cfg.NoisePrivateKeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, noiseKey, backup.NoisePrivateKey)
+}
+
+func TestRestoreBackup(t *testing.T) {
+	source := newOAuthTestHeadscale(t)
+	_, err := source.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = WriteBackup(source.cfg, source.db, &buf)
+	require.NoError(t, err)
+
+	backup, err := ReadBackup(&buf)
+	require.NoError(t, err)
+
+	// The target created its own noise key when it started.
+	target := newOAuthTestHeadscale(t)
+
+	err = RestoreBackup(target.cfg, target.db, backup, false)
+	require.ErrorIs(t, err, types.ErrBackupPrivateKey)
+
+	users, err := target.db.ListUsers()
+	require.NoError(t, err)
+	assert.Empty(t, users, "nothing is restored when a key differs")
+
+	require.NoError(t, RestoreBackup(target.cfg, target.db, backup, true))
+
+	users, err = target.db.ListUsers()
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "alice", users[0].Name)
+
+	noiseKey, err := readPrivateKeyFile(target.cfg.NoisePrivateKeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, backup.NoisePrivateKey, noiseKey)
+}
+
+func TestReadBackupVersion(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(`{"version": 99}`))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	_, err = ReadBackup(&buf)
+	require.ErrorIs(t, err, types.ErrBackupVersion)
+
+	_, err = ReadBackup(bytes.NewReader([]byte("not a backup")))
+	require.Error(t, err)
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+
+	names := []string{
+		"headscale-20261016T000000Z.json.gz",
+		"headscale-20261018T000000Z.json.gz",
+		"headscale-20261015T000000Z.json.gz",
+		"headscale-20261017T000000Z.json.gz",
+		"notes.txt",
+	}
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+
+	require.NoError(t, pruneBackups(dir, 2))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var remaining []string
+	for _, entry := range entries {
+		remaining = append(remaining, entry.Name())
+	}
+	assert.Equal(t, []string{
+		"headscale-20261017T000000Z.json.gz",
+		"headscale-20261018T000000Z.json.gz",
+		"notes.txt",
+	}, remaining)
+
+	// Zero keeps all backups.
+	require.NoError(t, pruneBackups(dir, 0))
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
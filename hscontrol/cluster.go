@@ -0,0 +1,555 @@
+package hscontrol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/notifier"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/samber/lo"
+	"tailscale.com/tailcfg"
+)
+
+const (
+	// clusterQueueSize is the number of updates waiting to be published to,
+	// or applied from, the other headscale instances. When a queue is full,
+	// the instances reload their state instead.
+	clusterQueueSize = 1024
+
+	// clusterHeartbeatsPerTTL is the number of heartbeats an instance can
+	// miss before the nodes connected to it are considered offline.
+	clusterHeartbeatsPerTTL = 3
+)
+
+// clusterMessage is published to the headscale instances sharing the
+// database.
+type clusterMessage struct {
+	// Instance is the instance publishing the message.
+	Instance string `json:"instance"`
+
+	notifier.Forwarded
+
+	// Resync is set when updates could not be published, the instances
+	// then reload their state and send a full update to their nodes.
+	Resync bool `json:"resync,omitempty"`
+}
+
+// cluster runs headscale as one of several instances sharing a PostgreSQL
+// database. The updates given to the notifier are published to the other
+// instances, which reload the changed nodes from the database and send the
+// update to the nodes connected to them. The instances record which nodes
+// are connected to them in the database, and elect a leader running the
+// tasks which must only run once, like expiring nodes.
+type cluster struct {
+	h         *Headscale
+	instance  string
+	heartbeat time.Duration
+
+	leader *db.Leader
+
+	outbox    chan notifier.Forwarded
+	inbox     chan clusterMessage
+	resyncOut atomic.Bool
+	resyncIn  atomic.Bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newCluster(h *Headscale) (*cluster, error) {
+	instance := h.cfg.Cluster.InstanceID
+	if instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("getting hostname for cluster instance ID: %w", err)
+		}
+
+		suffix, err := util.GenerateRandomStringDNSSafe(6)
+		if err != nil {
+			return nil, fmt.Errorf("generating cluster instance ID: %w", err)
+		}
+
+		instance = hostname + "-" + suffix
+	}
+
+	return &cluster{
+		h:         h,
+		instance:  instance,
+		heartbeat: h.cfg.Cluster.HeartbeatInterval,
+		outbox:    make(chan notifier.Forwarded, clusterQueueSize),
+		inbox:     make(chan clusterMessage, clusterQueueSize),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// ttl is how long the connections of an instance are considered alive
+// without a heartbeat.
+func (c *cluster) ttl() time.Duration {
+	return clusterHeartbeatsPerTTL * c.heartbeat
+}
+
+// start joins the cluster. It must be called before nodes connect.
+func (c *cluster) start() error {
+	if err := c.h.db.DeleteNodeConnections(c.instance); err != nil {
+		return fmt.Errorf("removing previous node connections: %w", err)
+	}
+
+	ctx := notifier.ForwardedCtx(types.NotifyCtx(context.Background(), "cluster-start", c.instance))
+	if err := c.loadRemoteConnections(ctx); err != nil {
+		return err
+	}
+
+	c.h.nodeNotifier.Forward(c.forward)
+	c.h.db.Subscribe(c.receive)
+
+	// The leader is elected before run starts, as run reads it.
+	c.leader = c.h.db.ElectLeader(c.heartbeat, c.leadershipChanged)
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.run(runCtx)
+
+	c.h.logger.Info().Str("instance", c.instance).Msg("joined the headscale cluster")
+
+	return nil
+}
+
+// stop leaves the cluster, after publishing the pending updates. It must be
+// called after the poll sessions have been closed.
+func (c *cluster) stop() {
+	c.leader.Stop()
+	c.cancel()
+	<-c.done
+
+	if err := c.h.db.DeleteNodeConnections(c.instance); err != nil {
+		c.h.logger.Error().Err(err).Msg("removing node connections of the instance")
+	}
+
+	// The other instances reload which nodes are still online.
+	c.publishMessage(clusterMessage{Resync: true})
+}
+
+// isLeader reports if this instance runs the tasks which must only run once
+// among the headscale instances, which it always does when not clustered.
+func (h *Headscale) isLeader() bool {
+	return h.cluster == nil || h.cluster.leader.IsLeader()
+}
+
+// nodeConnected records that the node has a poll session on this instance.
+func (c *cluster) nodeConnected(id types.NodeID) {
+	if err := c.h.db.ConnectNode(c.instance, id); err != nil {
+		c.h.logger.Error().Err(err).Uint64("node.id", id.Uint64()).Msg("recording node connection")
+	}
+}
+
+// nodeDisconnected records that the poll session of the node on this
+// instance is closed, and reports if the node is still connected to
+// another instance, in which case it is still online.
+func (c *cluster) nodeDisconnected(id types.NodeID) bool {
+	elsewhere, err := c.h.db.DisconnectNode(c.instance, id, c.ttl())
+	if err != nil {
+		c.h.logger.Error().Err(err).Uint64("node.id", id.Uint64()).Msg("removing node connection")
+
+		return false
+	}
+
+	if elsewhere {
+		c.h.nodeNotifier.SetRemoteConnected(id, true)
+	}
+
+	return elsewhere
+}
+
+// forward queues an update given to the notifier to be published.
+func (c *cluster) forward(f notifier.Forwarded) {
+	select {
+	case c.outbox <- f:
+	default:
+		c.resyncOut.Store(true)
+	}
+}
+
+// receive queues a message published by another instance to be applied.
+func (c *cluster) receive(payload string) {
+	if payload == "" {
+		c.resyncIn.Store(true)
+
+		return
+	}
+
+	var msg clusterMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		c.h.logger.Error().Err(err).Msg("decoding cluster message")
+
+		return
+	}
+
+	if msg.Instance == c.instance {
+		return
+	}
+
+	select {
+	case c.inbox <- msg:
+	default:
+		c.resyncIn.Store(true)
+	}
+}
+
+func (c *cluster) run(ctx context.Context) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case f := <-c.outbox:
+					c.publish(f)
+				default:
+					return
+				}
+			}
+
+		case f := <-c.outbox:
+			c.publish(f)
+
+		case msg := <-c.inbox:
+			c.apply(msg)
+
+		case <-ticker.C:
+			if c.resyncOut.Swap(false) {
+				c.publishMessage(clusterMessage{Resync: true})
+			}
+
+			if c.resyncIn.Swap(false) {
+				c.resync()
+			}
+
+			c.beat()
+		}
+	}
+}
+
+func (c *cluster) publish(f notifier.Forwarded) {
+	// The other instances read the changed nodes from the database, the
+	// changes the NodeStore has not persisted yet are written first.
+	if f.PolicyChange || f.Update.Type == types.StatePeerChanged || f.Update.Type == types.StateSelfUpdate {
+		if err := c.h.nodeStore.Flush(); err != nil {
+			c.h.logger.Error().Err(err).Msg("persisting nodes before publishing update")
+		}
+	}
+
+	c.publishMessage(clusterMessage{Forwarded: f})
+}
+
+func (c *cluster) publishMessage(msg clusterMessage) {
+	msg.Instance = c.instance
+
+	payload, err := json.Marshal(msg)
+	if err == nil {
+		err = c.h.db.Publish(string(payload))
+	}
+
+	if errors.Is(err, db.ErrPublishTooLarge) {
+		payload, _ = json.Marshal(clusterMessage{Instance: c.instance, Resync: true})
+		err = c.h.db.Publish(string(payload))
+	}
+
+	if err != nil {
+		c.h.logger.Error().Err(err).Msg("publishing cluster message")
+	}
+}
+
+// apply updates the state of this instance with an update published by
+// another instance, and sends it to the nodes connected to this instance.
+func (c *cluster) apply(msg clusterMessage) {
+	ctx := notifier.ForwardedCtx(types.NotifyCtx(context.Background(), "cluster", msg.Instance))
+
+	if msg.Resync {
+		c.resync()
+
+		return
+	}
+
+	if msg.PolicyChange {
+		if err := c.reloadState(ctx); err != nil {
+			c.h.logger.Error().Err(err).Msg("reloading state for policy change")
+		}
+
+		c.h.nodeNotifier.NotifyPolicyChange(ctx, c.h.polMan, c.h.nodeStore.ListNodes())
+
+		return
+	}
+
+	update := msg.Update
+	switch update.Type {
+	case types.StatePeerChanged, types.StateSelfUpdate:
+		c.reloadNodes(ctx, update.ChangeNodes...)
+	case types.StatePeerChangedPatch:
+		c.patchNodes(ctx, update.ChangePatches)
+	case types.StatePeerRemoved:
+		c.removeNodes(ctx, update.Removed)
+	case types.StateFullUpdate:
+		// The DNS records managed through the API might have changed.
+		if err := c.h.updateExtraRecords(); err != nil {
+			c.h.logger.Error().Err(err).Msg("reloading DNS records")
+		}
+	}
+
+	if msg.NodeID != 0 {
+		c.h.nodeNotifier.NotifyByNodeID(ctx, update, msg.NodeID)
+	} else {
+		c.h.nodeNotifier.NotifyWithIgnore(ctx, update, msg.Ignored...)
+	}
+}
+
+// resync reloads the state of this instance from the database, and sends a
+// full update to the nodes connected to it, when updates were missed.
+func (c *cluster) resync() {
+	ctx := notifier.ForwardedCtx(types.NotifyCtx(context.Background(), "cluster-resync", c.instance))
+
+	c.h.logger.Info().Msg("resynchronising with the headscale cluster")
+
+	if err := c.reloadState(ctx); err != nil {
+		c.h.logger.Error().Err(err).Msg("reloading state")
+	}
+
+	if err := c.loadRemoteConnections(ctx); err != nil {
+		c.h.logger.Error().Err(err).Msg("reloading node connections")
+	}
+
+	if err := c.h.updateExtraRecords(); err != nil {
+		c.h.logger.Error().Err(err).Msg("reloading DNS records")
+	}
+
+	c.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+}
+
+// reloadState reloads the users, the nodes and the policy from the database.
+func (c *cluster) reloadState(ctx context.Context) error {
+	if err := c.h.nodeStore.Reload(); err != nil {
+		return fmt.Errorf("reloading nodes: %w", err)
+	}
+
+	users, err := c.h.db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("listing users: %w", err)
+	}
+
+	if _, err := c.h.polMan.SetUsers(users); err != nil {
+		return fmt.Errorf("updating policy manager users: %w", err)
+	}
+
+	nodes := c.h.nodeStore.ListNodes()
+	if _, err := c.h.polMan.SetNodes(nodes); err != nil {
+		return fmt.Errorf("updating policy manager nodes: %w", err)
+	}
+
+	// A policy file is reloaded by every instance on SIGHUP.
+	if c.h.cfg.Policy.Mode == types.PolicyModeDB {
+		pol, err := c.h.policyBytes()
+		if err != nil {
+			return fmt.Errorf("loading policy: %w", err)
+		}
+
+		if _, err := c.h.polMan.SetPolicy(pol); err != nil {
+			return fmt.Errorf("setting policy: %w", err)
+		}
+	}
+
+	c.updatePrimaryRoutes(ctx, lo.Map(nodes, func(node *types.Node, _ int) types.NodeID {
+		return node.ID
+	})...)
+
+	return nil
+}
+
+// reloadNodes reloads changed nodes from the database.
+func (c *cluster) reloadNodes(ctx context.Context, ids ...types.NodeID) {
+	if err := c.h.nodeStore.Reload(ids...); err != nil {
+		c.h.logger.Error().Err(err).Msg("reloading changed nodes")
+
+		return
+	}
+
+	if _, err := c.h.polMan.SetNodes(c.h.nodeStore.ListNodes()); err != nil {
+		c.h.logger.Error().Err(err).Msg("updating policy manager nodes")
+	}
+
+	c.updatePrimaryRoutes(ctx, ids...)
+}
+
+// patchNodes applies the changes another instance has received from the
+// nodes connected to it. They are not written to the database again.
+func (c *cluster) patchNodes(ctx context.Context, patches []*tailcfg.PeerChange) {
+	var missing []types.NodeID
+	for _, patch := range patches {
+		_, ok := c.h.nodeStore.PatchNode(types.NodeID(patch.NodeID), func(node *types.Node) {
+			lastSeen := node.LastSeen
+			node.ApplyPeerChange(patch)
+			if patch.LastSeen == nil {
+				node.LastSeen = lastSeen
+			}
+			if patch.KeyExpiry != nil {
+				node.Expiry = patch.KeyExpiry
+			}
+		})
+		if !ok {
+			missing = append(missing, types.NodeID(patch.NodeID))
+		}
+	}
+
+	if len(missing) > 0 {
+		c.reloadNodes(ctx, missing...)
+	}
+
+	for _, patch := range patches {
+		if patch.Online == nil {
+			continue
+		}
+
+		id := types.NodeID(patch.NodeID)
+		c.setRemoteConnected(ctx, id, *patch.Online)
+
+		// The node might have reconnected to this instance before the
+		// other instance saw it disconnect.
+		if !*patch.Online && c.h.nodeNotifier.IsConnected(id) {
+			online := true
+			patch.Online = &online
+		}
+	}
+}
+
+// removeNodes forgets nodes deleted by another instance.
+func (c *cluster) removeNodes(ctx context.Context, ids []types.NodeID) {
+	c.h.nodeStore.DeleteNode(ids...)
+
+	var affected []types.NodeID
+	for _, id := range ids {
+		c.h.nodeNotifier.SetRemoteConnected(id, false)
+		c.h.ephemeralGC.Cancel(id)
+		affected = append(affected, c.h.primaryRoutes.SetRoutesAffected(id)...)
+	}
+
+	if _, err := c.h.polMan.SetNodes(c.h.nodeStore.ListNodes()); err != nil {
+		c.h.logger.Error().Err(err).Msg("updating policy manager nodes")
+	}
+
+	if len(affected) > 0 {
+		c.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(lo.Uniq(affected)...))
+	}
+}
+
+// setRemoteConnected records that a node has connected to, or disconnected
+// from, another instance.
+func (c *cluster) setRemoteConnected(ctx context.Context, id types.NodeID, connected bool) {
+	c.h.nodeNotifier.SetRemoteConnected(id, connected)
+	c.updatePrimaryRoutes(ctx, id)
+
+	node, ok := c.h.nodeStore.GetNode(id)
+	if ok && node.IsEphemeral() {
+		if c.h.nodeNotifier.IsConnected(id) {
+			c.h.ephemeralGC.Cancel(id)
+		} else {
+			c.h.ephemeralGC.Schedule(id, c.h.cfg.EphemeralNodeInactivityTimeout)
+		}
+	}
+}
+
+// updatePrimaryRoutes updates the subnet routes the nodes serve, which are
+// only served by the nodes connected to any instance. Every instance picks
+// the primary routes on its own, see docs/ref/cluster.md.
+func (c *cluster) updatePrimaryRoutes(ctx context.Context, ids ...types.NodeID) {
+	var affected []types.NodeID
+	for _, id := range ids {
+		var routes []netip.Prefix
+		if node, ok := c.h.nodeStore.GetNode(id); ok && c.h.nodeNotifier.IsConnected(id) {
+			routes = node.SubnetRoutes()
+		}
+
+		affected = append(affected, c.h.primaryRoutes.SetRoutesAffected(id, routes...)...)
+	}
+
+	if len(affected) > 0 {
+		c.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(lo.Uniq(affected)...))
+	}
+}
+
+// loadRemoteConnections reloads the nodes connected to other instances
+// from the database.
+func (c *cluster) loadRemoteConnections(ctx context.Context) error {
+	ids, err := c.h.db.ConnectedNodes(c.instance, c.ttl())
+	if err != nil {
+		return err
+	}
+
+	changed := lo.Union(ids, c.h.nodeNotifier.RemoteConnected())
+	for _, id := range changed {
+		c.h.nodeNotifier.SetRemoteConnected(id, lo.Contains(ids, id))
+	}
+
+	c.updatePrimaryRoutes(ctx, changed...)
+
+	return nil
+}
+
+// beat records that the nodes connected to this instance are still
+// connected. The leader also marks the nodes of instances which stopped
+// without disconnecting them offline.
+func (c *cluster) beat() {
+	if err := c.h.db.TouchNodeConnections(c.instance); err != nil {
+		c.h.logger.Error().Err(err).Msg("refreshing node connections")
+	}
+
+	if !c.leader.IsLeader() {
+		return
+	}
+
+	ids, err := c.h.db.DeleteStaleNodeConnections(c.ttl())
+	if err != nil {
+		c.h.logger.Error().Err(err).Msg("removing stale node connections")
+
+		return
+	}
+
+	ctx := notifier.ForwardedCtx(types.NotifyCtx(context.Background(), "cluster-stale", c.instance))
+	for _, id := range ids {
+		c.setRemoteConnected(ctx, id, false)
+
+		if node, ok := c.h.nodeStore.GetNode(id); ok && !c.h.nodeNotifier.IsConnected(id) {
+			c.h.updateNodeOnlineStatus(false, node)
+		}
+	}
+}
+
+// leadershipChanged takes over the ephemeral nodes which are not connected
+// to any instance, when this instance becomes the leader.
+func (c *cluster) leadershipChanged(leader bool) {
+	if !leader {
+		return
+	}
+
+	nodes, err := c.h.db.ListEphemeralNodes()
+	if err != nil {
+		c.h.logger.Error().Err(err).Msg("listing ephemeral nodes")
+
+		return
+	}
+
+	for _, node := range nodes {
+		if !c.h.nodeNotifier.IsConnected(node.ID) {
+			c.h.ephemeralGC.Schedule(node.ID, c.h.cfg.EphemeralNodeInactivityTimeout)
+		}
+	}
+}
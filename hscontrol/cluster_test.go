@@ -0,0 +1,137 @@
+package hscontrol
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/notifier"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// newClusterTestHeadscales returns two instances sharing a database, the
+// messages they publish are given to the other with apply.
+func newClusterTestHeadscales(t *testing.T) (*Headscale, *Headscale) {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	newInstance := func(instance string) *Headscale {
+		h, err := NewHeadscale(&types.Config{
+			NoisePrivateKeyPath: tmpDir + "/noise_private.key",
+			Database: types.DatabaseConfig{
+				Type: "sqlite3",
+				Sqlite: types.SqliteConfig{
+					Path: tmpDir + "/headscale_test.db",
+				},
+			},
+			Cluster: types.ClusterConfig{
+				Enabled:           true,
+				InstanceID:        instance,
+				HeartbeatInterval: time.Second,
+			},
+			Policy: types.PolicyConfig{
+				Mode: types.PolicyModeDB,
+			},
+			Tuning: types.Tuning{
+				BatchChangeDelay: time.Hour,
+			},
+		})
+		require.NoError(t, err)
+
+		return h
+	}
+
+	return newInstance("a"), newInstance("b")
+}
+
+func TestClusterApply(t *testing.T) {
+	a, b := newClusterTestHeadscales(t)
+
+	user, err := a.db.CreateUser(types.User{Name: "test"})
+	require.NoError(t, err)
+
+	regID, err := types.NewRegistrationID()
+	require.NoError(t, err)
+	require.NoError(t, a.db.CreatePendingRegistration(regID, types.Node{
+		Hostname:   "laptop",
+		MachineKey: key.NewMachine().Public(),
+		NodeKey:    key.NewNode().Public(),
+		Hostinfo:   &tailcfg.Hostinfo{Hostname: "laptop"},
+	}))
+
+	ipv4, ipv6, err := a.ipAlloc.Next()
+	require.NoError(t, err)
+	node, _, err := a.db.HandleNodeFromAuthPath(regID, types.UserID(user.ID), nil, util.RegisterMethodCLI, ipv4, ipv6)
+	require.NoError(t, err)
+
+	// The node registered on a is loaded by b.
+	_, ok := b.nodeStore.GetNode(node.ID)
+	require.False(t, ok)
+
+	b.cluster.apply(clusterMessage{
+		Instance:  "a",
+		Forwarded: notifier.Forwarded{Update: types.UpdatePeerChanged(node.ID)},
+	})
+	got, ok := b.nodeStore.GetNode(node.ID)
+	require.True(t, ok)
+	assert.Equal(t, "laptop", got.Hostname)
+
+	// The node connects to a, b sees it online.
+	online := true
+	b.cluster.apply(clusterMessage{
+		Instance: "a",
+		Forwarded: notifier.Forwarded{
+			Update:  types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: tailcfg.NodeID(node.ID), Online: &online}),
+			Ignored: []types.NodeID{node.ID},
+		},
+	})
+	assert.True(t, b.nodeNotifier.IsConnected(node.ID))
+	assert.False(t, b.nodeNotifier.IsConnected(node.ID+1))
+
+	// The node is deleted on a, b forgets it.
+	b.cluster.apply(clusterMessage{
+		Instance:  "a",
+		Forwarded: notifier.Forwarded{Update: types.UpdatePeerRemoved(node.ID)},
+	})
+	_, ok = b.nodeStore.GetNode(node.ID)
+	assert.False(t, ok)
+	assert.False(t, b.nodeNotifier.IsConnected(node.ID))
+}
+
+func TestClusterReceive(t *testing.T) {
+	_, b := newClusterTestHeadscales(t)
+
+	own, err := json.Marshal(clusterMessage{Instance: "b", Forwarded: notifier.Forwarded{PolicyChange: true}})
+	require.NoError(t, err)
+	other, err := json.Marshal(clusterMessage{Instance: "a", Forwarded: notifier.Forwarded{PolicyChange: true}})
+	require.NoError(t, err)
+
+	// The messages published by the instance itself are skipped.
+	b.cluster.receive(string(own))
+	b.cluster.receive(string(other))
+	require.Len(t, b.cluster.inbox, 1)
+	assert.Equal(t, "a", (<-b.cluster.inbox).Instance)
+
+	// Missed messages make the instance resynchronise.
+	assert.False(t, b.cluster.resyncIn.Load())
+	b.cluster.receive("")
+	assert.True(t, b.cluster.resyncIn.Load())
+}
+
+func TestClusterNodeConnections(t *testing.T) {
+	a, b := newClusterTestHeadscales(t)
+
+	a.cluster.nodeConnected(1)
+	b.cluster.nodeConnected(1)
+
+	// The node is still online, connected to b.
+	assert.True(t, a.cluster.nodeDisconnected(1))
+	assert.True(t, a.nodeNotifier.IsConnected(1))
+
+	assert.False(t, b.cluster.nodeDisconnected(1))
+}
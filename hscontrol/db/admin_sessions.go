@@ -0,0 +1,81 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+)
+
+var ErrAdminSessionInvalid = errors.New("admin session is invalid")
+
+// CreateAdminSession creates a session for subject, valid until
+// expiration, and removes the expired sessions. apiKeyID is the API key
+// the admin logged in with, or nil.
+func (hsdb *HSDatabase) CreateAdminSession(
+	subject string,
+	apiKeyID *uint64,
+	expiration time.Time,
+) (*types.AdminSession, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) (*types.AdminSession, error) {
+		if err := tx.Where("expiration < ?", time.Now()).Delete(&types.AdminSession{}).Error; err != nil {
+			return nil, fmt.Errorf("removing expired admin sessions: %w", err)
+		}
+
+		now := time.Now().UTC()
+		session := types.AdminSession{
+			Subject:    subject,
+			APIKeyID:   apiKeyID,
+			CreatedAt:  &now,
+			Expiration: expiration,
+		}
+
+		if err := tx.Create(&session).Error; err != nil {
+			return nil, fmt.Errorf("failed to save admin session to database: %w", err)
+		}
+
+		return &session, nil
+	})
+}
+
+// GetAdminSession returns the session with the given ID if it is still
+// valid, i.e. it has not expired, and the API key it was created with
+// still exists and has not expired.
+func (hsdb *HSDatabase) GetAdminSession(id uint64) (*types.AdminSession, error) {
+	var session types.AdminSession
+	if err := hsdb.DB.First(&session, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAdminSessionInvalid
+		}
+
+		return nil, err
+	}
+
+	if session.Expiration.Before(time.Now()) {
+		return nil, ErrAdminSessionInvalid
+	}
+
+	if session.APIKeyID != nil {
+		var key types.APIKey
+		if err := hsdb.DB.First(&key, *session.APIKeyID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrAdminSessionInvalid
+			}
+
+			return nil, err
+		}
+
+		if key.Expiration != nil && key.Expiration.Before(time.Now()) {
+			return nil, ErrAdminSessionInvalid
+		}
+	}
+
+	return &session, nil
+}
+
+// DestroyAdminSession removes the session with the given ID.
+func (hsdb *HSDatabase) DestroyAdminSession(id uint64) error {
+	return hsdb.DB.Delete(&types.AdminSession{}, id).Error
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminSessions(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	expiry := time.Now().Add(time.Hour)
+
+	oidcSession, err := db.CreateAdminSession("admin@example.com", nil, expiry)
+	require.NoError(t, err)
+
+	got, err := db.GetAdminSession(oidcSession.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "admin@example.com", got.Subject)
+
+	require.NoError(t, db.DestroyAdminSession(oidcSession.ID))
+	_, err = db.GetAdminSession(oidcSession.ID)
+	require.ErrorIs(t, err, ErrAdminSessionInvalid)
+
+	_, key, err := db.CreateAPIKey(&expiry)
+	require.NoError(t, err)
+
+	keySession, err := db.CreateAdminSession("api key", &key.ID, expiry)
+	require.NoError(t, err)
+
+	_, err = db.GetAdminSession(keySession.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, db.ExpireAPIKey(key))
+	_, err = db.GetAdminSession(keySession.ID)
+	require.ErrorIs(t, err, ErrAdminSessionInvalid)
+
+	_, key, err = db.CreateAPIKey(&expiry)
+	require.NoError(t, err)
+
+	keySession, err = db.CreateAdminSession("api key", &key.ID, expiry)
+	require.NoError(t, err)
+
+	require.NoError(t, db.DestroyAPIKey(*key))
+	_, err = db.GetAdminSession(keySession.ID)
+	require.ErrorIs(t, err, ErrAdminSessionInvalid)
+
+	expired, err := db.CreateAdminSession("admin@example.com", nil, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	_, err = db.GetAdminSession(expired.ID)
+	require.ErrorIs(t, err, ErrAdminSessionInvalid)
+}
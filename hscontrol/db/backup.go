@@ -0,0 +1,144 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// backupTables are the tables restored from a backup with their IDs,
+// whose sequences are reset on PostgreSQL.
+var backupTables = []string{"users", "pre_auth_keys", "nodes", "api_keys", "oauth_clients", "dns_records", "user_links", "invites"}
+
+// Migration returns the ID of the last schema migration applied to the
+// database.
+func (hsdb *HSDatabase) Migration() (string, error) {
+	return Read(hsdb.DB, migration)
+}
+
+// migration relies on the migration IDs being timestamps, which sort as
+// strings.
+func migration(tx *gorm.DB) (string, error) {
+	var id string
+	if err := tx.Table("migrations").Select("MAX(id)").Scan(&id).Error; err != nil {
+		return "", fmt.Errorf("reading schema migration: %w", err)
+	}
+
+	return id, nil
+}
+
+// Backup returns the state of the database, read in one transaction.
+// The private keys of the server are not part of the database and are
+// left empty.
+func (hsdb *HSDatabase) Backup() (*types.Backup, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) (*types.Backup, error) {
+		var (
+			backup types.Backup
+			err    error
+		)
+
+		backup.Migration, err = migration(rx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, table := range []struct {
+			name string
+			dest any
+		}{
+			{"users", &backup.Users},
+			{"pre auth keys", &backup.PreAuthKeys},
+			{"nodes", &backup.Nodes},
+			{"API keys", &backup.APIKeys},
+			{"OAuth clients", &backup.OAuthClients},
+			{"DNS records", &backup.DNSRecords},
+			{"user links", &backup.UserLinks},
+			{"invites", &backup.Invites},
+		} {
+			if err := rx.Order("id").Find(table.dest).Error; err != nil {
+				return nil, fmt.Errorf("reading %s: %w", table.name, err)
+			}
+		}
+
+		var policy types.Policy
+		err = rx.Order("id DESC").Limit(1).Find(&policy).Error
+		if err != nil {
+			return nil, fmt.Errorf("reading policy: %w", err)
+		}
+		backup.Policy = policy.Data
+
+		return &backup, nil
+	})
+}
+
+// Restore writes the state of a backup to the database, keeping the IDs
+// of the backup. The database must be empty and at the same schema
+// migration as the backup.
+func (hsdb *HSDatabase) Restore(backup *types.Backup) error {
+	return hsdb.Write(func(tx *gorm.DB) error {
+		current, err := migration(tx)
+		if err != nil {
+			return err
+		}
+		if backup.Migration != current {
+			return fmt.Errorf("%w: backup is at migration %s, database is at %s", types.ErrBackupMigration, backup.Migration, current)
+		}
+
+		for _, model := range []any{&types.User{}, &types.Node{}, &types.PreAuthKey{}, &types.APIKey{}} {
+			var count int64
+			if err := tx.Model(model).Count(&count).Error; err != nil {
+				return fmt.Errorf("checking database is empty: %w", err)
+			}
+			if count > 0 {
+				return types.ErrBackupNotEmpty
+			}
+		}
+
+		for _, table := range []struct {
+			name string
+			rows any
+			n    int
+		}{
+			{"users", &backup.Users, len(backup.Users)},
+			{"pre auth keys", &backup.PreAuthKeys, len(backup.PreAuthKeys)},
+			{"nodes", &backup.Nodes, len(backup.Nodes)},
+			{"API keys", &backup.APIKeys, len(backup.APIKeys)},
+			{"OAuth clients", &backup.OAuthClients, len(backup.OAuthClients)},
+			{"DNS records", &backup.DNSRecords, len(backup.DNSRecords)},
+			{"user links", &backup.UserLinks, len(backup.UserLinks)},
+			{"invites", &backup.Invites, len(backup.Invites)},
+		} {
+			if table.n == 0 {
+				continue
+			}
+
+			if err := tx.Omit(clause.Associations).CreateInBatches(table.rows, 100).Error; err != nil {
+				return fmt.Errorf("restoring %s: %w", table.name, err)
+			}
+		}
+
+		if backup.Policy != "" {
+			if err := tx.Create(&types.Policy{Data: backup.Policy}).Error; err != nil {
+				return fmt.Errorf("restoring policy: %w", err)
+			}
+		}
+
+		// Inserting rows with their IDs does not advance the sequences of
+		// PostgreSQL.
+		if hsdb.cfg.Type == types.DatabasePostgres {
+			for _, table := range backupTables {
+				err := tx.Exec(fmt.Sprintf(
+					"SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM %[1]s), false)",
+					table,
+				)).Error
+				if err != nil {
+					return fmt.Errorf("resetting %s sequence: %w", table, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
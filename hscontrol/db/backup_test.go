@@ -0,0 +1,144 @@
+package db
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/ptr"
+)
+
+// createBackupTestData fills the database with one row of every table of
+// a backup.
+func createBackupTestData(t *testing.T, hsdb *HSDatabase) {
+	t.Helper()
+
+	user, err := hsdb.CreateUser(types.User{Name: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	pak, err := hsdb.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, []string{"tag:ci"})
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		DiscoKey:       key.NewDisco().Public(),
+		Hostname:       "web-1",
+		GivenName:      "web-1",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodAuthKey,
+		AuthKeyID:      ptr.To(pak.ID),
+		IPv4:           ptr.To(netip.MustParseAddr("100.64.0.1")),
+		IPv6:           ptr.To(netip.MustParseAddr("fd7a:115c:a1e0::1")),
+		Hostinfo:       &tailcfg.Hostinfo{Hostname: "web-1"},
+		ForcedTags:     []string{"tag:web"},
+		ApprovedRoutes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+	}
+	require.NoError(t, hsdb.DB.Save(&node).Error)
+
+	_, _, err = hsdb.CreateAPIKey(ptr.To(time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+
+	_, _, err = hsdb.CreateOAuthClient(OAuthClientOptions{Scopes: []string{types.OAuthScopeAll}})
+	require.NoError(t, err)
+
+	_, err = hsdb.SetDNSRecords([]types.DNSRecord{{Name: "grafana.example.com", Type: "A", Value: "100.64.0.5"}})
+	require.NoError(t, err)
+
+	_, err = hsdb.SetPolicy(`{"acls": []}`)
+	require.NoError(t, err)
+}
+
+// testRestore restores a backup of source, passed through JSON as in an
+// archive, to target and checks that target holds the same state.
+func testRestore(t *testing.T, source, target *HSDatabase) {
+	t.Helper()
+
+	backup, err := source.Backup()
+	require.NoError(t, err)
+	assert.Len(t, backup.Users, 1)
+	assert.Len(t, backup.PreAuthKeys, 1)
+	assert.Len(t, backup.Nodes, 1)
+	assert.Len(t, backup.APIKeys, 1)
+	assert.Len(t, backup.OAuthClients, 1)
+	assert.Len(t, backup.DNSRecords, 1)
+	assert.JSONEq(t, `{"acls": []}`, backup.Policy)
+
+	b, err := json.Marshal(backup)
+	require.NoError(t, err)
+	var archived types.Backup
+	require.NoError(t, json.Unmarshal(b, &archived))
+
+	require.NoError(t, target.Restore(&archived))
+
+	restored, err := target.Backup()
+	require.NoError(t, err)
+
+	want, err := source.ListNodes()
+	require.NoError(t, err)
+	got, err := target.ListNodes()
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, want[0].ID, got[0].ID)
+	assert.Equal(t, want[0].MachineKey, got[0].MachineKey)
+	assert.Equal(t, want[0].NodeKey, got[0].NodeKey)
+	assert.Equal(t, want[0].IPv4, got[0].IPv4)
+	assert.Equal(t, want[0].IPv6, got[0].IPv6)
+	assert.Equal(t, want[0].ForcedTags, got[0].ForcedTags)
+	assert.Equal(t, want[0].ApprovedRoutes, got[0].ApprovedRoutes)
+	assert.Equal(t, want[0].AuthKeyID, got[0].AuthKeyID)
+	assert.Equal(t, "alice", got[0].User.Name)
+
+	assert.Equal(t, backup.PreAuthKeys[0].Hash, restored.PreAuthKeys[0].Hash)
+	assert.Equal(t, backup.APIKeys[0].Hash, restored.APIKeys[0].Hash)
+	assert.Equal(t, backup.OAuthClients[0].Hash, restored.OAuthClients[0].Hash)
+	assert.Equal(t, backup.DNSRecords, restored.DNSRecords)
+	assert.Equal(t, backup.Policy, restored.Policy)
+
+	// New rows get IDs after the restored ones.
+	user, err := target.CreateUser(types.User{Name: "bob"})
+	require.NoError(t, err)
+	assert.Greater(t, user.ID, backup.Users[0].ID)
+
+	// The database is not empty anymore.
+	err = target.Restore(&archived)
+	require.ErrorIs(t, err, types.ErrBackupNotEmpty)
+}
+
+func TestBackupRestore(t *testing.T) {
+	source, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	createBackupTestData(t, source)
+
+	target, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	testRestore(t, source, target)
+}
+
+func TestBackupRestorePostgres(t *testing.T) {
+	source, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	createBackupTestData(t, source)
+
+	testRestore(t, source, newPostgresTestDB(t))
+}
+
+func TestRestoreMigrationMismatch(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	current, err := hsdb.Migration()
+	require.NoError(t, err)
+	assert.NotEmpty(t, current)
+
+	err = hsdb.Restore(&types.Backup{Migration: "202312101416"})
+	require.ErrorIs(t, err, types.ErrBackupMigration)
+}
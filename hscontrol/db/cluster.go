@@ -0,0 +1,153 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	clusterChannel = "headscale_cluster"
+
+	// MaxPublishSize is the size of the largest payload which can be
+	// published, notifications of PostgreSQL must be shorter than 8000
+	// bytes.
+	MaxPublishSize = 7999
+)
+
+var ErrPublishTooLarge = errors.New("published payload is too large")
+
+// Publish sends payload to the subscribers of every headscale instance
+// sharing the database, including this one.
+func (hsdb *HSDatabase) Publish(payload string) error {
+	if len(payload) > MaxPublishSize {
+		return ErrPublishTooLarge
+	}
+
+	if hsdb.cfg.Type != types.DatabasePostgres {
+		hsdb.listener.dispatch(clusterChannel, payload)
+
+		return nil
+	}
+
+	return hsdb.DB.Exec("SELECT pg_notify(?, ?)", clusterChannel, payload).Error
+}
+
+// Subscribe calls fn with every payload published by the headscale
+// instances sharing the database. fn is called with an empty payload when
+// payloads might have been missed, e.g. after the connection listening for
+// them was lost.
+func (hsdb *HSDatabase) Subscribe(fn func(payload string)) {
+	hsdb.listener.subscribe(clusterChannel, fn)
+}
+
+// ConnectNode records that the node has a poll session open on instance.
+func (hsdb *HSDatabase) ConnectNode(instance string, nodeID types.NodeID) error {
+	conn := types.NodeConnection{
+		NodeID:    nodeID,
+		Instance:  instance,
+		UpdatedAt: time.Now(),
+	}
+
+	return hsdb.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&conn).Error
+}
+
+// DisconnectNode records that the poll session of the node on instance has
+// been closed. It reports if the node is still connected to another
+// instance, seen within ttl.
+func (hsdb *HSDatabase) DisconnectNode(instance string, nodeID types.NodeID, ttl time.Duration) (bool, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) (bool, error) {
+		err := tx.Delete(&types.NodeConnection{}, "node_id = ? AND instance = ?", nodeID, instance).Error
+		if err != nil {
+			return false, err
+		}
+
+		var count int64
+		err = tx.Model(&types.NodeConnection{}).
+			Where("node_id = ? AND updated_at > ?", nodeID, time.Now().Add(-ttl)).
+			Count(&count).Error
+		if err != nil {
+			return false, err
+		}
+
+		return count > 0, nil
+	})
+}
+
+// TouchNodeConnections records that the nodes connected to instance are
+// still connected.
+func (hsdb *HSDatabase) TouchNodeConnections(instance string) error {
+	return hsdb.DB.Model(&types.NodeConnection{}).
+		Where("instance = ?", instance).
+		Update("updated_at", time.Now()).Error
+}
+
+// DeleteNodeConnections removes the connections recorded for instance,
+// e.g. when it starts, as its previous sessions are gone.
+func (hsdb *HSDatabase) DeleteNodeConnections(instance string) error {
+	return hsdb.DB.Delete(&types.NodeConnection{}, "instance = ?", instance).Error
+}
+
+// ConnectedNodes returns the nodes connected to instances other than
+// instance, seen within ttl.
+func (hsdb *HSDatabase) ConnectedNodes(instance string, ttl time.Duration) ([]types.NodeID, error) {
+	var ids []types.NodeID
+	err := hsdb.DB.Model(&types.NodeConnection{}).
+		Distinct("node_id").
+		Where("instance <> ? AND updated_at > ?", instance, time.Now().Add(-ttl)).
+		Pluck("node_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("listing connected nodes: %w", err)
+	}
+
+	return ids, nil
+}
+
+// DeleteStaleNodeConnections removes the connections not seen within ttl,
+// of instances which have stopped without closing them, and returns the
+// nodes which are no longer connected to any instance.
+func (hsdb *HSDatabase) DeleteStaleNodeConnections(ttl time.Duration) ([]types.NodeID, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) ([]types.NodeID, error) {
+		stale := time.Now().Add(-ttl)
+
+		var ids []types.NodeID
+		err := tx.Model(&types.NodeConnection{}).
+			Distinct("node_id").
+			Where("updated_at <= ?", stale).
+			Pluck("node_id", &ids).Error
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ids) == 0 {
+			return nil, nil
+		}
+
+		if err := tx.Delete(&types.NodeConnection{}, "updated_at <= ?", stale).Error; err != nil {
+			return nil, fmt.Errorf("deleting stale node connections: %w", err)
+		}
+
+		var connected []types.NodeID
+		err = tx.Model(&types.NodeConnection{}).
+			Distinct("node_id").
+			Where("node_id IN ?", ids).
+			Pluck("node_id", &connected).Error
+		if err != nil {
+			return nil, err
+		}
+
+		disconnected := make([]types.NodeID, 0, len(ids))
+		for _, id := range ids {
+			if !slices.Contains(connected, id) {
+				disconnected = append(disconnected, id)
+			}
+		}
+
+		return disconnected, nil
+	})
+}
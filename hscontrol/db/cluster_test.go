@@ -0,0 +1,178 @@
+package db
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeConnections(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	ttl := time.Minute
+
+	require.NoError(t, db.ConnectNode("a", 1))
+	require.NoError(t, db.ConnectNode("a", 2))
+	require.NoError(t, db.ConnectNode("b", 2))
+	require.NoError(t, db.ConnectNode("b", 3))
+
+	connected, err := db.ConnectedNodes("a", ttl)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []types.NodeID{2, 3}, connected)
+
+	// Node 2 is still connected to b.
+	elsewhere, err := db.DisconnectNode("a", 2, ttl)
+	require.NoError(t, err)
+	assert.True(t, elsewhere)
+
+	elsewhere, err = db.DisconnectNode("a", 1, ttl)
+	require.NoError(t, err)
+	assert.False(t, elsewhere)
+
+	connected, err = db.ConnectedNodes("c", ttl)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []types.NodeID{2, 3}, connected)
+
+	require.NoError(t, db.DeleteNodeConnections("b"))
+
+	connected, err = db.ConnectedNodes("c", ttl)
+	require.NoError(t, err)
+	assert.Empty(t, connected)
+}
+
+func TestDeleteStaleNodeConnections(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	ttl := time.Minute
+
+	require.NoError(t, db.ConnectNode("stopped", 1))
+	require.NoError(t, db.ConnectNode("stopped", 2))
+	require.NoError(t, db.ConnectNode("running", 2))
+
+	err = db.DB.Model(&types.NodeConnection{}).
+		Where("instance = ?", "stopped").
+		Update("updated_at", time.Now().Add(-2*ttl)).Error
+	require.NoError(t, err)
+
+	connected, err := db.ConnectedNodes("other", ttl)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []types.NodeID{2}, connected)
+
+	// Node 2 is still connected to the running instance.
+	disconnected, err := db.DeleteStaleNodeConnections(ttl)
+	require.NoError(t, err)
+	assert.Equal(t, []types.NodeID{1}, disconnected)
+
+	var count int64
+	require.NoError(t, db.DB.Model(&types.NodeConnection{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// The running instance keeps its connections alive.
+	require.NoError(t, db.TouchNodeConnections("running"))
+	disconnected, err = db.DeleteStaleNodeConnections(ttl)
+	require.NoError(t, err)
+	assert.Empty(t, disconnected)
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	got := make(chan string, 1)
+	db.Subscribe(func(payload string) {
+		got <- payload
+	})
+
+	require.NoError(t, db.Publish("hello"))
+	assert.Equal(t, "hello", <-got)
+
+	large := make([]byte, MaxPublishSize+1)
+	require.ErrorIs(t, db.Publish(string(large)), ErrPublishTooLarge)
+}
+
+func TestElectLeaderSQLite(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	var changes []bool
+	leader := db.ElectLeader(time.Second, func(leader bool) {
+		changes = append(changes, leader)
+	})
+	assert.True(t, leader.IsLeader())
+
+	leader.Stop()
+	assert.False(t, leader.IsLeader())
+	assert.Equal(t, []bool{true, false}, changes)
+}
+
+func TestIPAllocatorReserveInDatabase(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	prefix4 := netip.MustParsePrefix("100.64.0.0/10")
+	prefix6 := netip.MustParsePrefix("fd7a:115c:a1e0::/48")
+
+	// Two allocators on the same database, as two headscale instances
+	// sharing it would have.
+	alloc1, err := NewIPAllocator(db, &prefix4, &prefix6, types.IPAllocationStrategySequential)
+	require.NoError(t, err)
+	alloc1.ReserveInDatabase(db)
+
+	alloc2, err := NewIPAllocator(db, &prefix4, &prefix6, types.IPAllocationStrategySequential)
+	require.NoError(t, err)
+	alloc2.ReserveInDatabase(db)
+
+	seen := make(map[netip.Addr]bool)
+	for range 5 {
+		for _, alloc := range []*IPAllocator{alloc1, alloc2} {
+			v4, v6, err := alloc.Next()
+			require.NoError(t, err)
+
+			assert.False(t, seen[*v4], "%s handed out twice", v4)
+			assert.False(t, seen[*v6], "%s handed out twice", v6)
+			seen[*v4] = true
+			seen[*v6] = true
+		}
+	}
+
+	var count int64
+	require.NoError(t, db.DB.Model(&types.IPReservation{}).Count(&count).Error)
+	assert.Equal(t, int64(20), count)
+}
+
+func TestIPAllocatorReserveInDatabaseSkipsNodeIPs(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	prefix4 := netip.MustParsePrefix("100.64.0.0/10")
+	prefix6 := netip.MustParsePrefix("fd7a:115c:a1e0::/48")
+
+	alloc1, err := NewIPAllocator(db, &prefix4, &prefix6, types.IPAllocationStrategySequential)
+	require.NoError(t, err)
+	alloc1.ReserveInDatabase(db)
+
+	alloc2, err := NewIPAllocator(db, &prefix4, &prefix6, types.IPAllocationStrategySequential)
+	require.NoError(t, err)
+	alloc2.ReserveInDatabase(db)
+
+	// Another instance hands out IPs to a node, and its reservation
+	// expires once the node is stored.
+	v4, v6, err := alloc2.Next()
+	require.NoError(t, err)
+
+	user := types.User{Name: "user"}
+	require.NoError(t, db.DB.Save(&user).Error)
+	require.NoError(t, db.DB.Save(&types.Node{User: user, IPv4: v4, IPv6: v6}).Error)
+	require.NoError(t, db.DB.Where("1 = 1").Delete(&types.IPReservation{}).Error)
+
+	got4, got6, err := alloc1.Next()
+	require.NoError(t, err)
+	assert.NotEqual(t, *v4, *got4)
+	assert.NotEqual(t, *v6, *got6)
+}
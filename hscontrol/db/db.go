@@ -24,7 +24,6 @@ import (
 	"gorm.io/gorm/schema"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/util/set"
-	"zgo.at/zcache/v2"
 )
 
 func init() {
@@ -43,9 +42,12 @@ type KV struct {
 type HSDatabase struct {
 	DB       *gorm.DB
 	cfg      *types.DatabaseConfig
-	regCache *zcache.Cache[types.RegistrationID, types.RegisterNode]
+	listener *listener
 
 	baseDomain string
+
+	// quota is the default quota of the users.
+	quota types.Quota
 }
 
 // TODO(kradalby): assemble this struct from toptions or something typed
@@ -53,7 +55,6 @@ type HSDatabase struct {
 func NewHeadscaleDatabase(
 	cfg types.DatabaseConfig,
 	baseDomain string,
-	regCache *zcache.Cache[types.RegistrationID, types.RegisterNode],
 ) (*HSDatabase, error) {
 	dbConn, err := openDB(cfg)
 	if err != nil {
@@ -708,7 +709,9 @@ AND auth_key_id NOT IN (
 					for _, user := range users {
 						user.ProviderIdentifier.String = types.CleanIdentifier(user.ProviderIdentifier.String)
 
-						err := tx.Save(user).Error
+						// Only update the column, the columns of the user
+						// added by later migrations do not exist yet.
+						err := tx.Model(&user).Update("provider_identifier", user.ProviderIdentifier).Error
 						if err != nil {
 							return fmt.Errorf("saving user: %w", err)
 						}
@@ -718,6 +721,258 @@ AND auth_key_id NOT IN (
 				},
 				Rollback: func(db *gorm.DB) error { return nil },
 			},
+			// Store pre auth keys as a prefix and a hash of the rest of
+			// the key, like API keys, instead of in plaintext.
+			{
+				ID: "202510181200",
+				Migrate: func(tx *gorm.DB) error {
+					for _, column := range []string{"prefix", "hash"} {
+						if !tx.Migrator().HasColumn(&types.PreAuthKey{}, column) {
+							err := tx.Migrator().AddColumn(&types.PreAuthKey{}, column)
+							if err != nil {
+								return fmt.Errorf("adding column %s to types.PreAuthKey: %w", column, err)
+							}
+						}
+					}
+
+					err := hashPlaintextPreAuthKeys(tx)
+					if err != nil {
+						return err
+					}
+
+					if !tx.Migrator().HasIndex(&types.PreAuthKey{}, "Prefix") {
+						err := tx.Migrator().CreateIndex(&types.PreAuthKey{}, "Prefix")
+						if err != nil {
+							return fmt.Errorf("creating index on pre auth key prefix: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			// Add usage limits, descriptions and constraints to pre auth
+			// keys, and count the nodes already registered with them.
+			{
+				ID: "202510181300",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.PreAuthKey{})
+					if err != nil {
+						return fmt.Errorf("automigrating types.PreAuthKey: %w", err)
+					}
+
+					err = tx.Exec(`
+UPDATE pre_auth_keys
+SET use_count = (
+    SELECT COUNT(*) FROM nodes WHERE nodes.auth_key_id = pre_auth_keys.id
+);
+					`).Error
+					if err != nil {
+						return fmt.Errorf("counting pre auth key uses: %w", err)
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Add OAuth clients, exchanging their secret for
+				// short-lived access tokens to the API.
+				ID: "202510181400",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.OAuthClient{})
+					if err != nil {
+						return fmt.Errorf("automigrating types.OAuthClient: %w", err)
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Nodes registered with a workload identity token can be
+				// ephemeral without a pre auth key.
+				ID: "202510181500",
+				Migrate: func(tx *gorm.DB) error {
+					if !tx.Migrator().HasColumn(&types.Node{}, "ephemeral") {
+						err := tx.Migrator().AddColumn(&types.Node{}, "Ephemeral")
+						if err != nil {
+							return fmt.Errorf("adding ephemeral column to nodes: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Pending registrations and OIDC logins are stored in the
+				// database, so they survive restarts and can be completed
+				// by any instance.
+				ID: "202510181600",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.PendingRegistration{}, &types.OIDCLogin{})
+					if err != nil {
+						return fmt.Errorf("automigrating pending registrations: %w", err)
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Node connections and IP reservations let several
+				// headscale instances share the database.
+				ID: "202510181700",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.NodeConnection{}, &types.IPReservation{})
+					if err != nil {
+						return fmt.Errorf("automigrating node connections: %w", err)
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// DNS records managed through the API.
+				ID: "202510181800",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.DNSRecord{})
+					if err != nil {
+						return fmt.Errorf("automigrating DNS records: %w", err)
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Records of the identities linked to users.
+				ID: "202510181900",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.UserLink{})
+					if err != nil {
+						return fmt.Errorf("automigrating user links: %w", err)
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Users can be disabled without deleting them.
+				ID: "202510182000",
+				Migrate: func(tx *gorm.DB) error {
+					if !tx.Migrator().HasColumn(&types.User{}, "disabled_at") {
+						err := tx.Migrator().AddColumn(&types.User{}, "DisabledAt")
+						if err != nil {
+							return fmt.Errorf("adding disabled_at column to users: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Users can have their own quota, and registrations
+				// rejected for a reason, such as a quota, tell it to the
+				// client.
+				ID: "202510182100",
+				Migrate: func(tx *gorm.DB) error {
+					for _, column := range []string{
+						"quota_max_nodes",
+						"quota_max_ephemeral_nodes",
+						"quota_max_pre_auth_keys",
+						"quota_max_routes",
+					} {
+						if !tx.Migrator().HasColumn(&types.User{}, column) {
+							err := tx.Migrator().AddColumn(&types.User{}, column)
+							if err != nil {
+								return fmt.Errorf("adding %s column to users: %w", column, err)
+							}
+						}
+					}
+
+					if !tx.Migrator().HasColumn(&types.PendingRegistration{}, "reject_reason") {
+						err := tx.Migrator().AddColumn(&types.PendingRegistration{}, "RejectReason")
+						if err != nil {
+							return fmt.Errorf("adding reject_reason column to pending registrations: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Invite links to onboard users.
+				ID: "202510182200",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.Invite{})
+					if err != nil {
+						return fmt.Errorf("automigrating invites: %w", err)
+					}
+
+					if !tx.Migrator().HasColumn(&types.OIDCLogin{}, "invite_id") {
+						err := tx.Migrator().AddColumn(&types.OIDCLogin{}, "InviteID")
+						if err != nil {
+							return fmt.Errorf("adding invite_id column to OIDC logins: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Labels on nodes, set by CLI/API.
+				ID: "202510182300",
+				Migrate: func(tx *gorm.DB) error {
+					if !tx.Migrator().HasColumn(&types.Node{}, "labels") {
+						err := tx.Migrator().AddColumn(&types.Node{}, "Labels")
+						if err != nil {
+							return fmt.Errorf("adding labels column to nodes: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Sessions of the admins approving registrations.
+				ID: "202510190000",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.AdminSession{})
+					if err != nil {
+						return fmt.Errorf("automigrating admin sessions: %w", err)
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			{
+				// Index the IPs of the nodes, the IP allocator checks the
+				// IPs it reserves are not used by a node.
+				ID: "202510190100",
+				Migrate: func(tx *gorm.DB) error {
+					for _, idx := range []string{
+						"CREATE INDEX IF NOT EXISTS idx_nodes_ipv4 ON nodes (ipv4);",
+						"CREATE INDEX IF NOT EXISTS idx_nodes_ipv6 ON nodes (ipv6);",
+					} {
+						err := tx.Exec(idx).Error
+						if err != nil {
+							return fmt.Errorf("creating node IP index: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
 		},
 	)
 
@@ -728,14 +983,76 @@ AND auth_key_id NOT IN (
 	db := HSDatabase{
 		DB:       dbConn,
 		cfg:      &cfg,
-		regCache: regCache,
+		listener: newListener(),
 
 		baseDomain: baseDomain,
 	}
 
+	if cfg.Type == types.DatabasePostgres {
+		db.listener.start(postgresDSN(cfg), registrationChannel, clusterChannel)
+	}
+
 	return &db, err
 }
 
+// hashPlaintextPreAuthKeys replaces the plaintext pre auth keys by their
+// prefix and hash, and drops the plaintext keys.
+func hashPlaintextPreAuthKeys(tx *gorm.DB) error {
+	// HasColumn can not be used, the sqlite migrator finds a "key"
+	// column in "PRIMARY KEY".
+	columns, err := tx.Migrator().ColumnTypes(&types.PreAuthKey{})
+	if err != nil {
+		return fmt.Errorf("listing pre auth key columns: %w", err)
+	}
+
+	if !slices.ContainsFunc(columns, func(c gorm.ColumnType) bool {
+		return c.Name() == "key"
+	}) {
+		return nil
+	}
+
+	var keys []struct {
+		ID  uint64
+		Key string
+	}
+	err = tx.Table("pre_auth_keys").Select("id", "key").Where("key IS NOT NULL AND key != ''").Scan(&keys).Error
+	if err != nil {
+		return fmt.Errorf("fetching pre auth keys: %w", err)
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		prefix, hash, err := hashPreAuthKey(key.Key)
+		if err != nil {
+			return err
+		}
+
+		// Keys sharing a prefix can not be told apart, they are left
+		// without prefix and can not be used anymore.
+		if seen[prefix] {
+			log.Warn().Uint64("preauthkey.id", key.ID).Msg("pre auth key shares its prefix with another key, disabling it")
+
+			continue
+		}
+		seen[prefix] = true
+
+		err = tx.Model(&types.PreAuthKey{}).Where("id = ?", key.ID).Updates(map[string]any{
+			"prefix": prefix,
+			"hash":   hash,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("saving hashed pre auth key: %w", err)
+		}
+	}
+
+	err = tx.Migrator().DropColumn(&types.PreAuthKey{}, "key")
+	if err != nil {
+		return fmt.Errorf("dropping plaintext pre auth keys: %w", err)
+	}
+
+	return nil
+}
+
 func openDB(cfg types.DatabaseConfig) (*gorm.DB, error) {
 	// TODO(kradalby): Integrate this with zerolog
 	var dbLogger logger.Interface
@@ -795,35 +1112,17 @@ func openDB(cfg types.DatabaseConfig) (*gorm.DB, error) {
 		return db, err
 
 	case types.DatabasePostgres:
-		dbString := fmt.Sprintf(
-			"host=%s dbname=%s user=%s",
-			cfg.Postgres.Host,
-			cfg.Postgres.Name,
-			cfg.Postgres.User,
-		)
-
 		log.Info().
 			Str("database", types.DatabasePostgres).
-			Str("path", dbString).
+			Str("path", fmt.Sprintf(
+				"host=%s dbname=%s user=%s",
+				cfg.Postgres.Host,
+				cfg.Postgres.Name,
+				cfg.Postgres.User,
+			)).
 			Msg("Opening database")
 
-		if sslEnabled, err := strconv.ParseBool(cfg.Postgres.Ssl); err == nil {
-			if !sslEnabled {
-				dbString += " sslmode=disable"
-			}
-		} else {
-			dbString += fmt.Sprintf(" sslmode=%s", cfg.Postgres.Ssl)
-		}
-
-		if cfg.Postgres.Port != 0 {
-			dbString += fmt.Sprintf(" port=%d", cfg.Postgres.Port)
-		}
-
-		if cfg.Postgres.Pass != "" {
-			dbString += fmt.Sprintf(" password=%s", cfg.Postgres.Pass)
-		}
-
-		db, err := gorm.Open(postgres.Open(dbString), &gorm.Config{
+		db, err := gorm.Open(postgres.Open(postgresDSN(cfg)), &gorm.Config{
 			Logger: dbLogger,
 		})
 		if err != nil {
@@ -847,6 +1146,34 @@ func openDB(cfg types.DatabaseConfig) (*gorm.DB, error) {
 	)
 }
 
+// postgresDSN returns the connection string of the PostgreSQL database.
+func postgresDSN(cfg types.DatabaseConfig) string {
+	dbString := fmt.Sprintf(
+		"host=%s dbname=%s user=%s",
+		cfg.Postgres.Host,
+		cfg.Postgres.Name,
+		cfg.Postgres.User,
+	)
+
+	if sslEnabled, err := strconv.ParseBool(cfg.Postgres.Ssl); err == nil {
+		if !sslEnabled {
+			dbString += " sslmode=disable"
+		}
+	} else {
+		dbString += fmt.Sprintf(" sslmode=%s", cfg.Postgres.Ssl)
+	}
+
+	if cfg.Postgres.Port != 0 {
+		dbString += fmt.Sprintf(" port=%d", cfg.Postgres.Port)
+	}
+
+	if cfg.Postgres.Pass != "" {
+		dbString += fmt.Sprintf(" password=%s", cfg.Postgres.Pass)
+	}
+
+	return dbString
+}
+
 func runMigrations(cfg types.DatabaseConfig, dbConn *gorm.DB, migrations *gormigrate.Gormigrate) error {
 	// Turn off foreign keys for the duration of the migration if using sqlite to
 	// prevent data loss due to the way the GORM migrator handles certain schema
@@ -923,6 +1250,8 @@ func (hsdb *HSDatabase) PingDB(ctx context.Context) error {
 }
 
 func (hsdb *HSDatabase) Close() error {
+	hsdb.listener.stop()
+
 	db, err := hsdb.DB.DB()
 	if err != nil {
 		return err
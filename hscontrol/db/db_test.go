@@ -12,7 +12,6 @@ import (
 	"sort"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -21,7 +20,6 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
-	"zgo.at/zcache/v2"
 )
 
 // TestMigrationsSQLite is the main function for testing migrations,
@@ -188,13 +186,28 @@ func TestMigrationsSQLite(t *testing.T) {
 					sort.Sort(sort.StringSlice(a))
 					sort.Sort(sort.StringSlice(b))
 					return slices.Equal(a, b)
-				}), cmpopts.IgnoreFields(types.PreAuthKey{}, "Key", "UserID", "User", "CreatedAt", "Expiration")); diff != "" {
+				}), cmpopts.IgnoreFields(types.PreAuthKey{}, "Prefix", "Hash", "UserID", "User", "CreatedAt", "Expiration")); diff != "" {
 					t.Errorf("TestMigrations() mismatch (-want +got):\n%s", diff)
 				}
 
 				if h.DB.Migrator().HasTable("pre_auth_key_acl_tags") {
 					t.Errorf("TestMigrations() table pre_auth_key_acl_tags should not exist")
 				}
+
+				// Keys are only stored hashed, but still valid.
+				columns, err := h.DB.Migrator().ColumnTypes(&types.PreAuthKey{})
+				require.NoError(t, err)
+				for _, column := range columns {
+					assert.NotEqual(t, "key", column.Name())
+				}
+
+				pak, err := h.GetPreAuthKey("09b28f8c3351984874d46dace0a70177a8721933a950b663")
+				require.NoError(t, err)
+				assert.Equal(t, uint64(1), pak.ID)
+				assert.Equal(t, "09b28f8c3351", pak.Prefix)
+
+				_, err = h.GetPreAuthKey("09b28f8c3351984874d46dace0a70177a8721933a950b664")
+				assert.ErrorIs(t, err, ErrPreAuthKeyNotFound)
 			},
 		},
 		{
@@ -254,7 +267,7 @@ func TestMigrationsSQLite(t *testing.T) {
 				Sqlite: types.SqliteConfig{
 					Path: dbPath,
 				},
-			}, "", emptyCache())
+			}, "")
 			if err != nil && tt.wantErr != err.Error() {
 				t.Errorf("TestMigrations() unexpected error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -295,10 +308,6 @@ func testCopyOfDatabase(t *testing.T, src string) (string, error) {
 	return dst, err
 }
 
-func emptyCache() *zcache.Cache[types.RegistrationID, types.RegisterNode] {
-	return zcache.New[types.RegistrationID, types.RegisterNode](time.Minute, time.Hour)
-}
-
 // requireConstraintFailed checks if the error is a constraint failure with
 // either SQLite and PostgreSQL error messages.
 func requireConstraintFailed(t *testing.T, err error) {
@@ -483,7 +492,6 @@ func dbForTest(t *testing.T) *HSDatabase {
 			},
 		},
 		"",
-		emptyCache(),
 	)
 	if err != nil {
 		t.Fatalf("setting up database: %s", err)
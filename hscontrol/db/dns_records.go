@@ -0,0 +1,53 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+)
+
+// ListDNSRecords returns the extra DNS records managed through the API,
+// ordered by name, type and value.
+func (hsdb *HSDatabase) ListDNSRecords() ([]types.DNSRecord, error) {
+	return Read(hsdb.DB, ListDNSRecords)
+}
+
+func ListDNSRecords(tx *gorm.DB) ([]types.DNSRecord, error) {
+	var records []types.DNSRecord
+	if err := tx.Order("name, type, value").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("listing DNS records: %w", err)
+	}
+
+	return records, nil
+}
+
+// SetDNSRecords replaces the extra DNS records managed through the API,
+// and returns them ordered by name, type and value. Duplicate records are
+// stored once.
+func (hsdb *HSDatabase) SetDNSRecords(records []types.DNSRecord) ([]types.DNSRecord, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) ([]types.DNSRecord, error) {
+		if err := tx.Where("1 = 1").Delete(&types.DNSRecord{}).Error; err != nil {
+			return nil, fmt.Errorf("deleting DNS records: %w", err)
+		}
+
+		seen := make(map[types.DNSRecord]bool)
+		for _, record := range records {
+			record.ID = 0
+			if seen[record] {
+				continue
+			}
+			seen[record] = true
+
+			if err := record.Validate(); err != nil {
+				return nil, err
+			}
+
+			if err := tx.Create(&record).Error; err != nil {
+				return nil, fmt.Errorf("creating DNS record: %w", err)
+			}
+		}
+
+		return ListDNSRecords(tx)
+	})
+}
@@ -0,0 +1,280 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"tailscale.com/util/set"
+)
+
+// InviteKeyExpiration is how long the pre-auth key given when an invite is
+// accepted can be used to register nodes.
+const InviteKeyExpiration = 24 * time.Hour
+
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteInvalid  = errors.New("invite is invalid")
+	ErrInviteUsed     = errors.New("invite has already been accepted")
+	ErrInviteRevoked  = errors.New("invite has been revoked")
+	ErrInviteExpired  = errors.New("invite has expired")
+	ErrInviteEmail    = errors.New("email does not match the invite")
+)
+
+// InviteOptions describes the Invite to create.
+type InviteOptions struct {
+	Email      string
+	Tags       []string
+	Expiration *time.Time
+}
+
+// CreateInvite creates a new Invite and returns it with its token, the
+// token is only stored hashed. Tokens are generated and hashed like
+// pre-auth keys.
+func (hsdb *HSDatabase) CreateInvite(opts InviteOptions) (string, *types.Invite, error) {
+	if opts.Email != "" {
+		addr, err := mail.ParseAddress(opts.Email)
+		if err != nil || addr.Address != opts.Email {
+			return "", nil, fmt.Errorf("%w: invalid email %q", ErrInviteInvalid, opts.Email)
+		}
+	}
+
+	tags := set.SetOf(opts.Tags).Slice()
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "tag:") {
+			return "", nil, fmt.Errorf(
+				"%w: '%s' did not begin with 'tag:'",
+				ErrInviteInvalid,
+				tag,
+			)
+		}
+	}
+
+	token, err := generateKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix, hash, err := hashPreAuthKey(token)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	invite := types.Invite{
+		Prefix:     prefix,
+		Hash:       hash,
+		Email:      opts.Email,
+		Tags:       tags,
+		CreatedAt:  &now,
+		Expiration: opts.Expiration,
+	}
+
+	if err := hsdb.DB.Save(&invite).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to save invite to database: %w", err)
+	}
+
+	return token, &invite, nil
+}
+
+// ListInvites returns the list of Invites.
+func (hsdb *HSDatabase) ListInvites() ([]types.Invite, error) {
+	invites := []types.Invite{}
+	if err := hsdb.DB.Order("id").Find(&invites).Error; err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// GetInvite returns the Invite for a given token, after comparing the
+// token against its hash. The caller is responsible for checking if the
+// invite can still be accepted.
+// A token is hashed even if there is no invite with its prefix, so that
+// the time taken does not tell if a prefix exists.
+func (hsdb *HSDatabase) GetInvite(token string) (*types.Invite, error) {
+	prefix, secret := splitPreAuthKey(token)
+
+	invite := types.Invite{}
+	if err := hsdb.DB.First(&invite, "prefix = ?", prefix).Error; err != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyPreAuthKeyHash, []byte(secret))
+
+		return nil, ErrInviteNotFound
+	}
+
+	if err := bcrypt.CompareHashAndPassword(invite.Hash, []byte(secret)); err != nil {
+		return nil, ErrInviteNotFound
+	}
+
+	return &invite, nil
+}
+
+func (hsdb *HSDatabase) GetInviteByID(id uint64) (*types.Invite, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) (*types.Invite, error) {
+		return getInvite(rx, id)
+	})
+}
+
+// getInvite returns the Invite with the given ID.
+func getInvite(tx *gorm.DB, id uint64) (*types.Invite, error) {
+	invite := types.Invite{}
+	if err := tx.First(&invite, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInviteNotFound
+		}
+
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// CheckInvite returns an error if the Invite can not be accepted anymore.
+func CheckInvite(invite *types.Invite) error {
+	switch invite.Status() {
+	case types.InviteStatusRevoked:
+		return ErrInviteRevoked
+	case types.InviteStatusAccepted:
+		return ErrInviteUsed
+	case types.InviteStatusExpired:
+		return ErrInviteExpired
+	}
+
+	return nil
+}
+
+// AcceptInvite accepts the Invite with the given ID as user. When user is
+// nil, the invite is accepted as the local user with the email of the
+// invite, which is created if it does not exist.
+// It returns the user and a reusable pre-auth key with the tags of the
+// invite, expiring after InviteKeyExpiration.
+func (hsdb *HSDatabase) AcceptInvite(id uint64, user *types.User) (*types.User, *types.PreAuthKey, error) {
+	var key *types.PreAuthKey
+	user, err := Write(hsdb.DB, func(tx *gorm.DB) (*types.User, error) {
+		invite, err := getInvite(tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := CheckInvite(invite); err != nil {
+			return nil, err
+		}
+
+		if user == nil {
+			user, err = inviteLocalUser(tx, invite)
+			if err != nil {
+				return nil, err
+			}
+		} else if invite.Email != "" && !strings.EqualFold(invite.Email, user.Email) {
+			return nil, ErrInviteEmail
+		}
+
+		if user.IsDisabled() {
+			return nil, ErrUserDisabled
+		}
+
+		// Only one acceptance can win, if the invite is opened twice
+		// at the same time.
+		now := time.Now().UTC()
+		res := tx.Model(&types.Invite{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invite.ID).
+			Updates(map[string]any{"accepted_at": now, "user_id": user.ID})
+		if res.Error != nil {
+			return nil, fmt.Errorf("failed to update invite in the database: %w", res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return nil, ErrInviteUsed
+		}
+
+		if err := checkPreAuthKeyQuota(tx, user, hsdb.quota); err != nil {
+			return nil, err
+		}
+
+		expiration := now.Add(InviteKeyExpiration)
+		key, err = CreatePreAuthKeyWithOptions(tx, types.UserID(user.ID), PreAuthKeyOptions{
+			Reusable:    true,
+			Expiration:  &expiration,
+			Tags:        invite.Tags,
+			Description: "invite " + invite.Prefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tx.Model(&types.Invite{}).Where("id = ?", invite.ID).Update("pre_auth_key_id", key.ID).Error; err != nil {
+			return nil, fmt.Errorf("failed to update invite in the database: %w", err)
+		}
+
+		return user, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, key, nil
+}
+
+// inviteLocalUser returns the local user with the email of the invite,
+// creating it, named after the email, if it does not exist.
+func inviteLocalUser(tx *gorm.DB, invite *types.Invite) (*types.User, error) {
+	if invite.Email == "" {
+		return nil, fmt.Errorf("%w: an invite without email can only be accepted with OIDC", ErrInviteInvalid)
+	}
+
+	user, err := GetLocalUserByEmail(tx, invite.Email)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	return CreateUser(tx, types.User{
+		Name:  invite.Email,
+		Email: invite.Email,
+	})
+}
+
+// RevokeInvite revokes the Invite with the given ID, so it can not be
+// accepted anymore. If it has been accepted, the pre-auth key given with
+// it is expired, the nodes registered with the key are kept.
+func (hsdb *HSDatabase) RevokeInvite(id uint64) (*types.Invite, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) (*types.Invite, error) {
+		invite, err := getInvite(tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if invite.RevokedAt != nil {
+			return invite, nil
+		}
+
+		now := time.Now().UTC()
+		if err := tx.Model(invite).Update("revoked_at", now).Error; err != nil {
+			return nil, fmt.Errorf("failed to revoke invite: %w", err)
+		}
+		invite.RevokedAt = &now
+
+		if invite.PreAuthKeyID != nil {
+			key := types.PreAuthKey{}
+			err := tx.First(&key, "id = ?", *invite.PreAuthKeyID).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+			case err != nil:
+				return nil, err
+			default:
+				if err := ExpirePreAuthKey(tx, &key); err != nil {
+					return nil, fmt.Errorf("expiring invite pre auth key: %w", err)
+				}
+			}
+		}
+
+		return invite, nil
+	})
+}
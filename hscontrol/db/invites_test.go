@@ -0,0 +1,122 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInvite(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	token, invite, err := db.CreateInvite(InviteOptions{
+		Email: "alice@example.com",
+		Tags:  []string{"tag:contractor", "tag:contractor"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tag:contractor"}, invite.Tags)
+	assert.Equal(t, types.InviteStatusPending, invite.Status())
+
+	got, err := db.GetInvite(token)
+	require.NoError(t, err)
+	assert.Equal(t, invite.ID, got.ID)
+
+	_, err = db.GetInvite(invite.Prefix + "wrong")
+	require.ErrorIs(t, err, ErrInviteNotFound)
+
+	_, _, err = db.CreateInvite(InviteOptions{Email: "not an email"})
+	require.ErrorIs(t, err, ErrInviteInvalid)
+
+	_, _, err = db.CreateInvite(InviteOptions{Tags: []string{"contractor"}})
+	require.ErrorIs(t, err, ErrInviteInvalid)
+}
+
+func TestAcceptInvite(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	_, invite, err := db.CreateInvite(InviteOptions{
+		Email: "alice@example.com",
+		Tags:  []string{"tag:contractor"},
+	})
+	require.NoError(t, err)
+
+	user, key, err := db.AcceptInvite(invite.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", user.Name)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.Equal(t, user.ID, key.UserID)
+	assert.True(t, key.Reusable)
+	assert.Equal(t, []string{"tag:contractor"}, key.Tags)
+
+	got, err := db.GetInviteByID(invite.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.InviteStatusAccepted, got.Status())
+	assert.Equal(t, user.ID, *got.UserID)
+	assert.Equal(t, key.ID, *got.PreAuthKeyID)
+
+	_, _, err = db.AcceptInvite(invite.ID, nil)
+	require.ErrorIs(t, err, ErrInviteUsed)
+
+	// A second invite for the same email is accepted as the same local
+	// user.
+	_, again, err := db.CreateInvite(InviteOptions{Email: "alice@example.com"})
+	require.NoError(t, err)
+	sameUser, _, err := db.AcceptInvite(again.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, sameUser.ID)
+
+	// Invites are only accepted as users with their email.
+	bob, err := db.CreateUser(types.User{Name: "bob", Email: "bob@example.com"})
+	require.NoError(t, err)
+	_, other, err := db.CreateInvite(InviteOptions{Email: "carol@example.com"})
+	require.NoError(t, err)
+	_, _, err = db.AcceptInvite(other.ID, bob)
+	require.ErrorIs(t, err, ErrInviteEmail)
+
+	past := time.Now().Add(-time.Minute)
+	_, expired, err := db.CreateInvite(InviteOptions{Email: "dave@example.com", Expiration: &past})
+	require.NoError(t, err)
+	_, _, err = db.AcceptInvite(expired.ID, nil)
+	require.ErrorIs(t, err, ErrInviteExpired)
+
+	_, noEmail, err := db.CreateInvite(InviteOptions{})
+	require.NoError(t, err)
+	_, _, err = db.AcceptInvite(noEmail.ID, nil)
+	require.ErrorIs(t, err, ErrInviteInvalid)
+}
+
+func TestRevokeInvite(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	_, pending, err := db.CreateInvite(InviteOptions{Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	revoked, err := db.RevokeInvite(pending.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.InviteStatusRevoked, revoked.Status())
+
+	_, _, err = db.AcceptInvite(pending.ID, nil)
+	require.ErrorIs(t, err, ErrInviteRevoked)
+
+	// Revoking an accepted invite expires the key given with it.
+	_, accepted, err := db.CreateInvite(InviteOptions{Email: "bob@example.com"})
+	require.NoError(t, err)
+	_, key, err := db.AcceptInvite(accepted.ID, nil)
+	require.NoError(t, err)
+
+	_, err = db.RevokeInvite(accepted.ID)
+	require.NoError(t, err)
+
+	got, err := db.GetPreAuthKey(key.Key)
+	require.NoError(t, err)
+	assert.True(t, got.Expiration.Before(time.Now()))
+
+	_, err = db.RevokeInvite(1000)
+	require.ErrorIs(t, err, ErrInviteNotFound)
+}
@@ -7,13 +7,16 @@ import (
 	"fmt"
 	"math/big"
 	"net/netip"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/rs/zerolog/log"
 	"go4.org/netipx"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"tailscale.com/net/tsaddr"
 )
 
@@ -41,8 +44,22 @@ type IPAllocator struct {
 	// database fails, the IP will be allocated here
 	// until the next restart of Headscale.
 	usedIPs netipx.IPSetBuilder
+
+	// db is set when the IPs handed out are reserved in the
+	// database, which is shared with other headscale instances.
+	db *HSDatabase
 }
 
+const (
+	// ipReservationExpiration is how long an IP handed out is reserved,
+	// the node it was handed out to is stored in the meantime.
+	ipReservationExpiration = 10 * time.Minute
+
+	// ipReservationAttempts is how many times handing out IPs is tried
+	// when other headscale instances reserve the same IPs.
+	ipReservationAttempts = 10
+)
+
 // NewIPAllocator returns a new IPAllocator singleton which
 // can be used to hand out unique IP addresses within the
 // provided IPv4 and IPv6 prefix. It needs to be created
@@ -129,10 +146,139 @@ func NewIPAllocator(
 	return &ret, nil
 }
 
+// ReserveInDatabase makes the allocator reserve the IPs it hands out in
+// the database, and skip the IPs used or reserved by the other headscale
+// instances sharing the database.
+func (i *IPAllocator) ReserveInDatabase(db *HSDatabase) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.db = db
+}
+
 func (i *IPAllocator) Next() (*netip.Addr, *netip.Addr, error) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
+	if i.db == nil {
+		return i.nextPair()
+	}
+
+	// The IPs are reserved through the primary key of the reservations,
+	// the IPs used by the other instances are only loaded when one of the
+	// IPs handed out conflicts with them.
+	for range ipReservationAttempts {
+		ret4, ret6, err := i.nextPair()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = i.reserve(ret4, ret6)
+		if errors.Is(err, errIPReserved) {
+			if err := i.loadUsedIPs(); err != nil {
+				return nil, nil, err
+			}
+
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return ret4, ret6, nil
+	}
+
+	return nil, nil, ErrCouldNotAllocateIP
+}
+
+// loadUsedIPs adds the IPs of the nodes in the database, and the IPs
+// reserved by other headscale instances, to the used IPs.
+func (i *IPAllocator) loadUsedIPs() error {
+	var addrs []sql.NullString
+	err := i.db.Read(func(rx *gorm.DB) error {
+		var v4s, v6s, reserved []sql.NullString
+		if err := rx.Model(&types.Node{}).Pluck("ipv4", &v4s).Error; err != nil {
+			return err
+		}
+		if err := rx.Model(&types.Node{}).Pluck("ipv6", &v6s).Error; err != nil {
+			return err
+		}
+		err := rx.Model(&types.IPReservation{}).
+			Where("expiration > ?", time.Now()).
+			Pluck("ip", &reserved).Error
+		if err != nil {
+			return err
+		}
+
+		addrs = slices.Concat(v4s, v6s, reserved)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading used IP addresses from database: %w", err)
+	}
+
+	for _, addrStr := range addrs {
+		if addrStr.Valid {
+			addr, err := netip.ParseAddr(addrStr.String)
+			if err != nil {
+				return fmt.Errorf("parsing IP address from database: %w", err)
+			}
+
+			i.usedIPs.Add(addr)
+		}
+	}
+
+	return nil
+}
+
+// reserve reserves the IPs in the database, it fails with errIPReserved,
+// reserving none of them, if another headscale instance has reserved one
+// of them first, or given it to a node.
+func (i *IPAllocator) reserve(ips ...*netip.Addr) error {
+	return i.db.Write(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Delete(&types.IPReservation{}, "expiration <= ?", now).Error; err != nil {
+			return fmt.Errorf("deleting expired IP reservations: %w", err)
+		}
+
+		for _, ip := range ips {
+			if ip == nil {
+				continue
+			}
+
+			var used int64
+			err := tx.Model(&types.Node{}).
+				Where("ipv4 = ? OR ipv6 = ?", ip.String(), ip.String()).
+				Count(&used).Error
+			if err != nil {
+				return fmt.Errorf("checking if IP address is used: %w", err)
+			}
+
+			if used > 0 {
+				return errIPReserved
+			}
+
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&types.IPReservation{
+				IP:         ip.String(),
+				Expiration: now.Add(ipReservationExpiration),
+			})
+			if res.Error != nil {
+				return fmt.Errorf("reserving IP address: %w", res.Error)
+			}
+
+			if res.RowsAffected == 0 {
+				return errIPReserved
+			}
+		}
+
+		return nil
+	})
+}
+
+// nextPair hands out the next IPv4 and IPv6 addresses, if the prefixes
+// are set. It must be called with mu held.
+func (i *IPAllocator) nextPair() (*netip.Addr, *netip.Addr, error) {
 	var err error
 	var ret4 *netip.Addr
 	var ret6 *netip.Addr
@@ -156,7 +302,10 @@ func (i *IPAllocator) Next() (*netip.Addr, *netip.Addr, error) {
 	return ret4, ret6, nil
 }
 
-var ErrCouldNotAllocateIP = errors.New("failed to allocate IP")
+var (
+	ErrCouldNotAllocateIP = errors.New("failed to allocate IP")
+	errIPReserved         = errors.New("IP reserved by another instance")
+)
 
 func (i *IPAllocator) nextLocked(prev netip.Addr, prefix *netip.Prefix) (*netip.Addr, error) {
 	i.mu.Lock()
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+)
+
+// leaderLockID is the key of the PostgreSQL advisory lock held by the
+// leader of the headscale instances sharing the database.
+const leaderLockID int64 = 0x68736c6561646572 // "hsleader"
+
+// Leader elects one leader among the headscale instances sharing a
+// PostgreSQL database, the one holding an advisory lock on its own
+// connection. The lock is released by PostgreSQL when the connection of
+// the leader is lost, letting another instance take over.
+// On SQLite, which cannot be shared, the instance is always the leader.
+type Leader struct {
+	leader   atomic.Bool
+	onChange func(leader bool)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ElectLeader campaigns to become the leader every interval, until Stop is
+// called. onChange is called when the instance becomes or stops being the
+// leader.
+func (hsdb *HSDatabase) ElectLeader(interval time.Duration, onChange func(leader bool)) *Leader {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Leader{
+		onChange: onChange,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	if hsdb.cfg.Type != types.DatabasePostgres {
+		close(l.done)
+		l.set(true)
+
+		return l
+	}
+
+	go func() {
+		defer close(l.done)
+		defer l.set(false)
+
+		dsn := postgresDSN(*hsdb.cfg)
+		for {
+			err := l.campaign(ctx, dsn, interval)
+			l.set(false)
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Warn().Err(err).Msg("lost connection campaigning for leadership, reconnecting")
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+
+	return l
+}
+
+// campaign tries to take the leader lock every interval, and checks the
+// lock is still held once taken, until its connection fails.
+func (l *Leader) campaign(ctx context.Context, dsn string, interval time.Duration) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if l.IsLeader() {
+			if err := conn.Ping(ctx); err != nil {
+				return err
+			}
+		} else {
+			var locked bool
+			err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", leaderLockID).Scan(&locked)
+			if err != nil {
+				return err
+			}
+
+			l.set(locked)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *Leader) set(leader bool) {
+	if l.leader.Swap(leader) == leader {
+		return
+	}
+
+	log.Info().Bool("leader", leader).Msg("leadership of the headscale instances changed")
+
+	if l.onChange != nil {
+		l.onChange(leader)
+	}
+}
+
+// IsLeader reports if this instance is the leader.
+func (l *Leader) IsLeader() bool {
+	return l.leader.Load()
+}
+
+// Stop stops campaigning, and gives up the leadership.
+func (l *Leader) Stop() {
+	l.cancel()
+	<-l.done
+	l.set(false)
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+)
+
+// listenerRetryInterval is how long the listener waits before connecting
+// to PostgreSQL again after losing its connection.
+const listenerRetryInterval = time.Second
+
+// listener wakes up the goroutines waiting for a notification, sent by this
+// headscale instance or, on PostgreSQL, by another instance sharing the
+// database, with LISTEN/NOTIFY, and calls the subscribers of its channel.
+type listener struct {
+	mu          sync.Mutex
+	waiters     map[string]map[chan struct{}]struct{}
+	subscribers map[string][]func(payload string)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newListener() *listener {
+	return &listener{
+		waiters:     make(map[string]map[chan struct{}]struct{}),
+		subscribers: make(map[string][]func(payload string)),
+	}
+}
+
+func listenerKey(channel, payload string) string {
+	return channel + "\x00" + payload
+}
+
+// wait returns a channel receiving a value when a notification with the
+// payload is sent on channel, and a function to stop waiting.
+func (l *listener) wait(channel, payload string) (<-chan struct{}, func()) {
+	key := listenerKey(channel, payload)
+	c := make(chan struct{}, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.waiters[key] == nil {
+		l.waiters[key] = make(map[chan struct{}]struct{})
+	}
+	l.waiters[key][c] = struct{}{}
+
+	return c, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(l.waiters[key], c)
+		if len(l.waiters[key]) == 0 {
+			delete(l.waiters, key)
+		}
+	}
+}
+
+// subscribe calls fn with the payload of every notification sent on
+// channel, and with an empty payload when notifications might have been
+// missed. fn is called from the goroutine receiving the notifications.
+func (l *listener) subscribe(channel string, fn func(payload string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.subscribers[channel] = append(l.subscribers[channel], fn)
+}
+
+func (l *listener) dispatch(channel, payload string) {
+	l.mu.Lock()
+	for c := range l.waiters[listenerKey(channel, payload)] {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+	subscribers := l.subscribers[channel]
+	l.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(payload)
+	}
+}
+
+// dispatchAll wakes up every waiter, which check again what they are
+// waiting for, and tells the subscribers, as notifications might have been
+// missed.
+func (l *listener) dispatchAll() {
+	l.mu.Lock()
+	for _, waiters := range l.waiters {
+		for c := range waiters {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}
+	var subscribers []func(string)
+	for _, fns := range l.subscribers {
+		subscribers = append(subscribers, fns...)
+	}
+	l.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn("")
+	}
+}
+
+// start listens on the channels of PostgreSQL with its own connection, so
+// notifications of other instances are dispatched, until stop is called.
+func (l *listener) start(dsn string, channels ...string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.done = make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+
+		for {
+			err := l.listen(ctx, dsn, channels)
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Warn().Err(err).Msg("lost connection listening for database notifications, reconnecting")
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(listenerRetryInterval):
+			}
+		}
+	}()
+}
+
+func (l *listener) listen(ctx context.Context, dsn string, channels []string) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+	}
+
+	// Notifications sent while not listening are lost.
+	l.dispatchAll()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		l.dispatch(notification.Channel, notification.Payload)
+	}
+}
+
+func (l *listener) stop() {
+	if l.cancel == nil {
+		return
+	}
+
+	l.cancel()
+	<-l.done
+}
+
+// notify wakes up the waiters for the payload on channel, on every headscale
+// instance sharing the database.
+func (hsdb *HSDatabase) notify(channel, payload string) {
+	if hsdb.cfg.Type == types.DatabasePostgres {
+		err := hsdb.DB.Exec("SELECT pg_notify(?, ?)", channel, payload).Error
+		if err == nil {
+			return
+		}
+
+		log.Error().Err(err).Str("channel", channel).Msg("sending database notification")
+	}
+
+	hsdb.listener.dispatch(channel, payload)
+}
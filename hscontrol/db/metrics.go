@@ -0,0 +1,53 @@
+package db
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const prometheusNamespace = "headscale"
+
+// nodeStoreMetrics holds the metrics of a NodeStore.
+type nodeStoreMetrics struct {
+	nodes           prometheus.Gauge
+	pendingWrites   prometheus.Gauge
+	persisted       prometheus.Counter
+	persistDuration prometheus.Histogram
+	applyDuration   prometheus.Histogram
+}
+
+// newNodeStoreMetrics creates the node store metrics and registers them
+// with reg. If reg is nil, the metrics are not registered.
+func newNodeStoreMetrics(reg prometheus.Registerer) *nodeStoreMetrics {
+	factory := promauto.With(reg)
+
+	return &nodeStoreMetrics{
+		nodes: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "nodestore_nodes",
+			Help:      "number of nodes in the node store",
+		}),
+		pendingWrites: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "nodestore_pending_writes",
+			Help:      "number of nodes with changes not yet persisted to the database",
+		}),
+		persisted: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "nodestore_persisted_total",
+			Help:      "total count of node changes persisted to the database by the node store",
+		}),
+		persistDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "nodestore_persist_duration_seconds",
+			Help:      "histogram of time spent persisting a batch of node changes",
+			Buckets:   []float64{0.001, 0.01, 0.1, 0.3, 0.5, 1, 3, 5, 10},
+		}),
+		applyDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "nodestore_apply_duration_seconds",
+			Help:      "histogram of time spent publishing a new node store snapshot",
+			Buckets:   []float64{0.0001, 0.001, 0.01, 0.1, 0.3, 0.5, 1},
+		}),
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/netip"
 	"slices"
 	"sort"
@@ -89,7 +90,7 @@ func ListNodes(tx *gorm.DB, nodeIDs ...types.NodeID) (types.Nodes, error) {
 func (hsdb *HSDatabase) ListEphemeralNodes() (types.Nodes, error) {
 	return Read(hsdb.DB, func(rx *gorm.DB) (types.Nodes, error) {
 		nodes := types.Nodes{}
-		if err := rx.Joins("AuthKey").Where(`"AuthKey"."ephemeral" = true`).Find(&nodes).Error; err != nil {
+		if err := rx.Joins("AuthKey").Where(`"AuthKey"."ephemeral" = true OR nodes.ephemeral = true`).Find(&nodes).Error; err != nil {
 			return nil, err
 		}
 
@@ -224,6 +225,47 @@ func SetTags(
 	return nil
 }
 
+// SetLabels sets the labels in set on the node, and removes the labels
+// with the keys in remove. The other labels of the node are kept.
+func SetLabels(
+	tx *gorm.DB,
+	nodeID types.NodeID,
+	set map[string]string,
+	remove []string,
+) error {
+	node, err := GetNodeByID(tx, nodeID)
+	if err != nil {
+		return err
+	}
+
+	labels := maps.Clone(node.Labels)
+	if labels == nil {
+		labels = make(map[string]string, len(set))
+	}
+
+	for _, key := range remove {
+		delete(labels, key)
+	}
+
+	for key, value := range set {
+		if err := types.ValidateNodeLabel(key, value); err != nil {
+			return err
+		}
+		labels[key] = value
+	}
+
+	b, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&types.Node{}).Where("id = ?", nodeID).Update("labels", string(b)).Error; err != nil {
+		return fmt.Errorf("updating labels: %w", err)
+	}
+
+	return nil
+}
+
 // SetTags takes a Node struct pointer and update the forced tags.
 func SetApprovedRoutes(
 	tx *gorm.DB,
@@ -355,76 +397,139 @@ func (hsdb *HSDatabase) HandleNodeFromAuthPath(
 ) (*types.Node, bool, error) {
 	var newNode bool
 	node, err := Write(hsdb.DB, func(tx *gorm.DB) (*types.Node, error) {
-		if reg, ok := hsdb.regCache.Get(registrationID); ok {
-			if node, _ := GetNodeByNodeKey(tx, reg.Node.NodeKey); node == nil {
-				user, err := GetUserByID(tx, userID)
-				if err != nil {
-					return nil, fmt.Errorf(
-						"failed to find user in register node from auth callback, %w",
-						err,
-					)
-				}
-
-				log.Debug().
-					Str("registration_id", registrationID.String()).
-					Str("username", user.Username()).
-					Str("registrationMethod", registrationMethod).
-					Str("expiresAt", fmt.Sprintf("%v", nodeExpiry)).
-					Msg("Registering node from API/CLI or auth callback")
-
-				// TODO(kradalby): This looks quite wrong? why ID 0?
-				// Why not always?
-				// Registration of expired node with different user
-				if reg.Node.ID != 0 &&
-					reg.Node.UserID != user.ID {
-					return nil, ErrDifferentRegisteredUser
-				}
-
-				reg.Node.UserID = user.ID
-				reg.Node.User = *user
-				reg.Node.RegisterMethod = registrationMethod
-
-				if nodeExpiry != nil {
-					reg.Node.Expiry = nodeExpiry
-				}
+		reg, err := GetPendingRegistration(tx, registrationID)
+		if err != nil {
+			return nil, err
+		}
 
-				node, err := RegisterNode(
-					tx,
-					reg.Node,
-					ipv4, ipv6,
-				)
+		user, err := GetUserByID(tx, userID)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to find user in register node from auth callback, %w",
+				err,
+			)
+		}
 
-				if err == nil {
-					hsdb.regCache.Delete(registrationID)
-				}
+		if user.IsDisabled() {
+			return nil, ErrUserDisabled
+		}
 
-				// Signal to waiting clients that the machine has been registered.
-				select {
-				case reg.Registered <- node:
-				default:
-				}
-				close(reg.Registered)
+		if node, _ := GetNodeByNodeKey(tx, reg.Node.NodeKey); node != nil {
+			// If the node is already registered, this is a refresh.
+			if node.User.IsDisabled() {
+				return nil, ErrUserDisabled
+			}
 
-				newNode = true
-				return node, err
-			} else {
-				// If the node is already registered, this is a refresh.
+			if nodeExpiry != nil {
 				err := NodeSetExpiry(tx, node.ID, *nodeExpiry)
 				if err != nil {
 					return nil, err
 				}
-				return node, nil
 			}
+
+			return node, completePendingRegistration(tx, registrationID, node.ID)
 		}
 
-		return nil, ErrNodeNotFoundRegistrationCache
+		log.Debug().
+			Str("registration_id", registrationID.String()).
+			Str("username", user.Username()).
+			Str("registrationMethod", registrationMethod).
+			Str("expiresAt", fmt.Sprintf("%v", nodeExpiry)).
+			Msg("Registering node from API/CLI or auth callback")
+
+		// TODO(kradalby): This looks quite wrong? why ID 0?
+		// Why not always?
+		// Registration of expired node with different user
+		if reg.Node.ID != 0 &&
+			reg.Node.UserID != user.ID {
+			return nil, ErrDifferentRegisteredUser
+		}
+
+		reg.Node.UserID = user.ID
+		reg.Node.User = *user
+		reg.Node.RegisterMethod = registrationMethod
+
+		if nodeExpiry != nil {
+			reg.Node.Expiry = nodeExpiry
+		}
+
+		if err := CheckNodeQuota(tx, &reg.Node, hsdb.quota); err != nil {
+			return nil, err
+		}
+
+		node, err := RegisterNode(
+			tx,
+			reg.Node,
+			ipv4, ipv6,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		newNode = true
+
+		return node, completePendingRegistration(tx, registrationID, node.ID)
+	})
+	if err != nil {
+		return nil, false, hsdb.rejectOverQuota(registrationID, err)
+	}
+
+	// Signal to waiting clients that the machine has been registered.
+	hsdb.notify(registrationChannel, registrationID.String())
+
+	return node, newNode, nil
+}
+
+// CheckAuthPathQuota fails with a QuotaError if registering the node
+// waiting under registrationID to the user exceeds the quota of the user,
+// as HandleNodeFromAuthPath would, so that it can be checked before
+// allocating IPs for the node.
+func (hsdb *HSDatabase) CheckAuthPathQuota(registrationID types.RegistrationID, userID types.UserID) error {
+	err := hsdb.Read(func(rx *gorm.DB) error {
+		reg, err := GetPendingRegistration(rx, registrationID)
+		if err != nil {
+			return err
+		}
+
+		// A refresh of a registered node is not counted.
+		if node, _ := GetNodeByNodeKey(rx, reg.Node.NodeKey); node != nil {
+			return nil
+		}
+
+		user, err := GetUserByID(rx, userID)
+		if err != nil {
+			return err
+		}
+
+		reg.Node.UserID = user.ID
+		reg.Node.User = *user
+
+		return CheckNodeQuota(rx, &reg.Node, hsdb.quota)
 	})
 
-	return node, newNode, err
+	return hsdb.rejectOverQuota(registrationID, err)
+}
+
+// rejectOverQuota rejects the registration if err is a QuotaError, so the
+// client waiting for it is told that the quota of the user is reached. It
+// returns err.
+func (hsdb *HSDatabase) rejectOverQuota(registrationID types.RegistrationID, err error) error {
+	var quotaErr QuotaError
+	if errors.As(err, &quotaErr) {
+		if err := hsdb.RejectPendingRegistration(registrationID, quotaErr.Error()); err != nil {
+			return err
+		}
+	}
+
+	return err
 }
 
 func (hsdb *HSDatabase) RegisterNode(node types.Node, ipv4 *netip.Addr, ipv6 *netip.Addr) (*types.Node, error) {
 	return Write(hsdb.DB, func(tx *gorm.DB) (*types.Node, error) {
+		if err := CheckNodeQuota(tx, &node, hsdb.quota); err != nil {
+			return nil, err
+		}
+
 		return RegisterNode(tx, node, ipv4, ipv6)
 	})
 }
@@ -0,0 +1,567 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"tailscale.com/types/key"
+)
+
+// nodeStorePersistColumns are the node columns that are updated from the
+// poll endpoint updates and that are persisted asynchronously by the
+// NodeStore. Any other change to a node, including its keys, has to be
+// written to the database by the caller before the NodeStore is told
+// about it.
+var nodeStorePersistColumns = []string{
+	"endpoints",
+	"host_info",
+	"last_seen",
+}
+
+var ErrNodeStoreClosed = errors.New("node store is closed")
+
+// nodeSnapshot is an immutable index of all the nodes known to headscale.
+// The maps of a snapshot are never modified after it has been published,
+// writers create a new snapshot and swap it in when nodes are added or
+// removed, or their keys change. Other changes only swap the node in its
+// cell, so they do not cost a copy of every node.
+type nodeSnapshot struct {
+	byID         map[types.NodeID]*nodeCell
+	byNodeKey    map[key.NodePublic]types.NodeID
+	byMachineKey map[key.MachinePublic]types.NodeID
+
+	// sorted contains all the node IDs ordered by ID.
+	sorted []types.NodeID
+}
+
+// nodeCell holds the current version of a node. The node it points to is
+// never modified, a new version is stored instead.
+type nodeCell struct {
+	atomic.Pointer[types.Node]
+}
+
+func newNodeCell(node *types.Node) *nodeCell {
+	cell := &nodeCell{}
+	cell.Store(node)
+
+	return cell
+}
+
+func newNodeSnapshot(cells map[types.NodeID]*nodeCell) *nodeSnapshot {
+	snap := &nodeSnapshot{
+		byID:         cells,
+		byNodeKey:    make(map[key.NodePublic]types.NodeID, len(cells)),
+		byMachineKey: make(map[key.MachinePublic]types.NodeID, len(cells)),
+		sorted:       make([]types.NodeID, 0, len(cells)),
+	}
+
+	for id, cell := range cells {
+		node := cell.Load()
+		snap.byNodeKey[node.NodeKey] = id
+		snap.byMachineKey[node.MachineKey] = id
+		snap.sorted = append(snap.sorted, id)
+	}
+
+	slices.Sort(snap.sorted)
+
+	return snap
+}
+
+// node returns the current version of the node with the given ID.
+func (snap *nodeSnapshot) node(id types.NodeID) (*types.Node, bool) {
+	cell, ok := snap.byID[id]
+	if !ok {
+		return nil, false
+	}
+
+	return cell.Load(), true
+}
+
+// NodeStore is an in-memory, authoritative copy of all nodes in the
+// database. It is intended to serve the hot read paths, like generating
+// map responses, instead of hitting the database for every update.
+//
+// Readers always get a copy of the node, so they are free to modify it.
+// Writers publish new versions of the nodes copy-on-write.
+//
+// Changes made through UpdateNode are persisted to the database in batches
+// in the background, every other mutation must be written to the database
+// first and then applied with PutNode, Reload or DeleteNode.
+type NodeStore struct {
+	db      *HSDatabase
+	metrics *nodeStoreMetrics
+
+	snap atomic.Pointer[nodeSnapshot]
+
+	// writeMu serialises all writers, including the
+	// background persistence.
+	writeMu sync.Mutex
+	dirty   map[types.NodeID]struct{}
+	closed  bool
+
+	persistInterval time.Duration
+	cancelCh        chan struct{}
+	doneCh          chan struct{}
+}
+
+// NewNodeStore creates a NodeStore populated with all the nodes in the
+// database. Changes made with UpdateNode are written to the database every
+// persistInterval, a zero interval persists them immediately. The metrics
+// of the store are registered with reg, unless it is nil.
+func NewNodeStore(hsdb *HSDatabase, persistInterval time.Duration, reg prometheus.Registerer) (*NodeStore, error) {
+	store := &NodeStore{
+		db:              hsdb,
+		metrics:         newNodeStoreMetrics(reg),
+		dirty:           make(map[types.NodeID]struct{}),
+		persistInterval: persistInterval,
+		cancelCh:        make(chan struct{}),
+		doneCh:          make(chan struct{}),
+	}
+
+	nodes, err := hsdb.ListNodes()
+	if err != nil {
+		return nil, fmt.Errorf("loading nodes into node store: %w", err)
+	}
+
+	byID := make(map[types.NodeID]*nodeCell, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = newNodeCell(node)
+	}
+	store.snap.Store(newNodeSnapshot(byID))
+
+	if persistInterval > 0 {
+		go store.persistWorker()
+	} else {
+		close(store.doneCh)
+	}
+
+	return store, nil
+}
+
+// GetNode returns a copy of the node with the given ID.
+func (s *NodeStore) GetNode(id types.NodeID) (*types.Node, bool) {
+	node, ok := s.snap.Load().node(id)
+	if !ok {
+		return nil, false
+	}
+
+	return cloneNode(node), true
+}
+
+// GetNodeByNodeKey returns a copy of the node with the given node key.
+func (s *NodeStore) GetNodeByNodeKey(nodeKey key.NodePublic) (*types.Node, bool) {
+	snap := s.snap.Load()
+
+	id, ok := snap.byNodeKey[nodeKey]
+	if !ok {
+		return nil, false
+	}
+
+	node, _ := snap.node(id)
+
+	return cloneNode(node), true
+}
+
+// GetNodeByMachineKey returns a copy of the node with the given machine key.
+func (s *NodeStore) GetNodeByMachineKey(machineKey key.MachinePublic) (*types.Node, bool) {
+	snap := s.snap.Load()
+
+	id, ok := snap.byMachineKey[machineKey]
+	if !ok {
+		return nil, false
+	}
+
+	node, _ := snap.node(id)
+
+	return cloneNode(node), true
+}
+
+// HasNodeKey reports if a node with the given node key exists, without
+// copying the node.
+func (s *NodeStore) HasNodeKey(nodeKey key.NodePublic) bool {
+	_, ok := s.snap.Load().byNodeKey[nodeKey]
+	return ok
+}
+
+// ListNodes returns copies of either all nodes if no parameters are given
+// or the given nodes if at least one node ID is given, ordered by ID.
+func (s *NodeStore) ListNodes(nodeIDs ...types.NodeID) types.Nodes {
+	snap := s.snap.Load()
+
+	if len(nodeIDs) == 0 {
+		nodes := make(types.Nodes, 0, len(snap.sorted))
+		for _, id := range snap.sorted {
+			node, _ := snap.node(id)
+			nodes = append(nodes, cloneNode(node))
+		}
+
+		return nodes
+	}
+
+	nodes := make(types.Nodes, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		if node, ok := snap.node(id); ok {
+			nodes = append(nodes, cloneNode(node))
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	return nodes
+}
+
+// ListPeers returns copies of the peers of node, regardless of any Policy or
+// if the node is expired.
+// If no peer IDs are given, all peers are returned.
+// If at least one peer ID is given, only these peer nodes will be returned.
+func (s *NodeStore) ListPeers(nodeID types.NodeID, peerIDs ...types.NodeID) types.Nodes {
+	nodes := s.ListNodes(peerIDs...)
+
+	return slices.DeleteFunc(nodes, func(node *types.Node) bool {
+		return node.ID == nodeID
+	})
+}
+
+// PutNode adds or replaces a node in the store. The node must already have
+// been written to the database, and any pending change to it is discarded.
+func (s *NodeStore) PutNode(node *types.Node) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	delete(s.dirty, node.ID)
+	s.apply(map[types.NodeID]*types.Node{node.ID: cloneNode(node)}, nil)
+}
+
+// DeleteNode removes nodes from the store. The nodes must already have
+// been removed from the database.
+func (s *NodeStore) DeleteNode(nodeIDs ...types.NodeID) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	for _, id := range nodeIDs {
+		delete(s.dirty, id)
+	}
+	s.apply(nil, nodeIDs)
+}
+
+// UpdateNode applies fn to a copy of the node with the given ID and
+// publishes the result. The updated node is returned.
+// Only the fields written by endpoint updates (keys, endpoints,
+// hostinfo and last seen) are persisted by the store, the database
+// will be updated in the next batch. Changes to the keys of the node
+// must be written to the database by the caller.
+func (s *NodeStore) UpdateNode(id types.NodeID, fn func(node *types.Node)) (*types.Node, bool) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	curr, ok := s.snap.Load().node(id)
+	if !ok {
+		return nil, false
+	}
+
+	node := cloneNode(curr)
+	fn(node)
+	node.ID = id
+
+	s.apply(map[types.NodeID]*types.Node{id: node}, nil)
+	s.dirty[id] = struct{}{}
+	s.metrics.pendingWrites.Set(float64(len(s.dirty)))
+
+	// Once the store is closed, there is no background persistence left
+	// to write the change.
+	if s.persistInterval <= 0 || s.closed {
+		if err := s.persistLocked(); err != nil {
+			log.Error().Err(err).Uint64("node.id", id.Uint64()).Msg("failed to persist node")
+		}
+	}
+
+	return cloneNode(node), true
+}
+
+// PatchNode applies fn to a copy of the node with the given ID and
+// publishes the result, like UpdateNode, but without persisting it. It is
+// used for changes persisted by another headscale instance sharing the
+// database.
+func (s *NodeStore) PatchNode(id types.NodeID, fn func(node *types.Node)) (*types.Node, bool) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	curr, ok := s.snap.Load().node(id)
+	if !ok {
+		return nil, false
+	}
+
+	node := cloneNode(curr)
+	fn(node)
+	node.ID = id
+
+	s.apply(map[types.NodeID]*types.Node{id: node}, nil)
+
+	return cloneNode(node), true
+}
+
+// DiscardPending discards the changes to the node with the given machine
+// key that have not yet been persisted. It is called before a node is
+// (re-)registered, so that a batch written while the registration is
+// written to the database does not overwrite it with the state of the
+// previous registration.
+func (s *NodeStore) DiscardPending(machineKey key.MachinePublic) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if id, ok := s.snap.Load().byMachineKey[machineKey]; ok {
+		delete(s.dirty, id)
+		s.metrics.pendingWrites.Set(float64(len(s.dirty)))
+	}
+}
+
+// LoadNode reads the node with the given ID from the database and replaces
+// it in the store, discarding any change that has not yet been persisted.
+// It is used after a node has been (re-)registered.
+func (s *NodeStore) LoadNode(id types.NodeID) (*types.Node, error) {
+	node, err := s.db.GetNodeByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.PutNode(node)
+
+	return node, nil
+}
+
+// Reload reads the given nodes, or all nodes if none are given, from
+// the database and replaces them in the store. It is used after the
+// database has been changed outside of the store.
+// Changes that have been made with UpdateNode, but not yet persisted,
+// are kept.
+func (s *NodeStore) Reload(nodeIDs ...types.NodeID) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	nodes, err := s.db.ListNodes(nodeIDs...)
+	if err != nil {
+		return fmt.Errorf("reloading nodes into node store: %w", err)
+	}
+
+	snap := s.snap.Load()
+	found := make(map[types.NodeID]*types.Node, len(nodes))
+	for _, node := range nodes {
+		if curr, ok := snap.node(node.ID); ok {
+			if _, dirty := s.dirty[node.ID]; dirty {
+				mergePendingChanges(node, curr)
+			}
+		}
+		found[node.ID] = node
+	}
+
+	var removed []types.NodeID
+	if len(nodeIDs) == 0 {
+		cells := make(map[types.NodeID]*nodeCell, len(found))
+		for id, node := range found {
+			cells[id] = newNodeCell(node)
+		}
+
+		for id := range snap.byID {
+			if _, ok := found[id]; !ok {
+				removed = append(removed, id)
+			}
+		}
+
+		s.snap.Store(newNodeSnapshot(cells))
+		s.metrics.nodes.Set(float64(len(cells)))
+	} else {
+		for _, id := range nodeIDs {
+			if _, ok := found[id]; !ok {
+				removed = append(removed, id)
+			}
+		}
+
+		s.apply(found, removed)
+	}
+
+	for _, id := range removed {
+		delete(s.dirty, id)
+	}
+
+	return nil
+}
+
+// apply publishes the given nodes and removes the given nodes. Nodes
+// that exist and keep their keys are swapped in their cell, otherwise a
+// new snapshot is published. It must be called with writeMu held.
+func (s *NodeStore) apply(put map[types.NodeID]*types.Node, remove []types.NodeID) {
+	start := time.Now()
+	defer func() {
+		s.metrics.applyDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	curr := s.snap.Load()
+
+	if len(remove) == 0 && sameKeys(curr, put) {
+		for id, node := range put {
+			curr.byID[id].Store(node)
+		}
+
+		return
+	}
+
+	next := maps.Clone(curr.byID)
+	for _, id := range remove {
+		delete(next, id)
+	}
+	for id, node := range put {
+		next[id] = newNodeCell(node)
+	}
+
+	s.snap.Store(newNodeSnapshot(next))
+
+	s.metrics.nodes.Set(float64(len(next)))
+}
+
+// sameKeys reports whether all the nodes exist in the snapshot with the
+// same node and machine keys, so that its indexes stay valid.
+func sameKeys(snap *nodeSnapshot, nodes map[types.NodeID]*types.Node) bool {
+	for id, node := range nodes {
+		curr, ok := snap.node(id)
+		if !ok || curr.NodeKey != node.NodeKey || curr.MachineKey != node.MachineKey {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Flush writes all pending changes to the database.
+func (s *NodeStore) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return s.persistLocked()
+}
+
+// Close stops the background persistence and writes all pending
+// changes to the database.
+func (s *NodeStore) Close() error {
+	s.writeMu.Lock()
+	if s.closed {
+		s.writeMu.Unlock()
+		return ErrNodeStoreClosed
+	}
+	s.closed = true
+	close(s.cancelCh)
+	s.writeMu.Unlock()
+
+	<-s.doneCh
+
+	return s.Flush()
+}
+
+func (s *NodeStore) persistWorker() {
+	defer close(s.doneCh)
+
+	ticker := time.NewTicker(s.persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.cancelCh:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Error().Err(err).Msg("failed to persist node store changes")
+			}
+		}
+	}
+}
+
+// persistLocked writes the pending changes in one transaction. It must be
+// called with writeMu held.
+func (s *NodeStore) persistLocked() error {
+	if len(s.dirty) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	snap := s.snap.Load()
+
+	err := s.db.Write(func(tx *gorm.DB) error {
+		for id := range s.dirty {
+			node, ok := snap.node(id)
+			if !ok {
+				continue
+			}
+
+			if err := tx.Model(&types.Node{ID: id}).
+				Select(nodeStorePersistColumns).
+				Updates(node).Error; err != nil {
+				return fmt.Errorf("persisting node %d: %w", id, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.metrics.persisted.Add(float64(len(s.dirty)))
+	s.metrics.persistDuration.Observe(time.Since(start).Seconds())
+	clear(s.dirty)
+	s.metrics.pendingWrites.Set(0)
+
+	return nil
+}
+
+// mergePendingChanges copies the fields that have not yet been
+// persisted from pending to node.
+func mergePendingChanges(node, pending *types.Node) {
+	node.Endpoints = pending.Endpoints
+	node.Hostinfo = pending.Hostinfo
+	node.LastSeen = pending.LastSeen
+}
+
+// cloneNode returns a copy of the node that can be modified without
+// changing the original. The AuthKey and User are considered read-only
+// and are shared.
+func cloneNode(node *types.Node) *types.Node {
+	ret := *node
+
+	ret.Endpoints = slices.Clone(node.Endpoints)
+	ret.ForcedTags = slices.Clone(node.ForcedTags)
+	ret.Labels = maps.Clone(node.Labels)
+	ret.ApprovedRoutes = slices.Clone(node.ApprovedRoutes)
+	ret.Hostinfo = node.Hostinfo.Clone()
+
+	if node.IPv4 != nil {
+		ip := *node.IPv4
+		ret.IPv4 = &ip
+	}
+	if node.IPv6 != nil {
+		ip := *node.IPv6
+		ret.IPv6 = &ip
+	}
+	if node.Expiry != nil {
+		expiry := *node.Expiry
+		ret.Expiry = &expiry
+	}
+	if node.LastSeen != nil {
+		lastSeen := *node.LastSeen
+		ret.LastSeen = &lastSeen
+	}
+	if node.IsOnline != nil {
+		online := *node.IsOnline
+		ret.IsOnline = &online
+	}
+
+	return &ret
+}
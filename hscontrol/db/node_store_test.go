@@ -0,0 +1,324 @@
+package db
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/ptr"
+)
+
+// createTestNodes creates count nodes owned by a single user and
+// returns the database they were created in.
+func createTestNodes(tb testing.TB, count int) *HSDatabase {
+	tb.Helper()
+
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(tb, err)
+
+	user, err := hsdb.CreateUser(types.User{Name: "nodestore"})
+	require.NoError(tb, err)
+
+	for i := range count {
+		node := types.Node{
+			MachineKey:     key.NewMachine().Public(),
+			NodeKey:        key.NewNode().Public(),
+			DiscoKey:       key.NewDisco().Public(),
+			Hostname:       fmt.Sprintf("node-%d", i),
+			GivenName:      fmt.Sprintf("node-%d", i),
+			UserID:         user.ID,
+			RegisterMethod: util.RegisterMethodAuthKey,
+			IPv4:           ptr.To(netip.AddrFrom4([4]byte{100, 64, byte(i >> 8), byte(i)})),
+			Hostinfo: &tailcfg.Hostinfo{
+				Hostname: fmt.Sprintf("node-%d", i),
+				NetInfo:  &tailcfg.NetInfo{PreferredDERP: 1},
+			},
+		}
+		require.NoError(tb, hsdb.DB.Save(&node).Error)
+	}
+
+	return hsdb
+}
+
+func TestNodeStoreRead(t *testing.T) {
+	hsdb := createTestNodes(t, 3)
+
+	store, err := NewNodeStore(hsdb, time.Hour, nil)
+	require.NoError(t, err)
+	defer store.Close()
+
+	nodes := store.ListNodes()
+	require.Len(t, nodes, 3)
+	assert.Equal(t, types.NodeID(1), nodes[0].ID)
+	assert.Equal(t, "nodestore", nodes[0].User.Name)
+
+	peers := store.ListPeers(1)
+	require.Len(t, peers, 2)
+	assert.Equal(t, "node-1", peers[0].Hostname)
+
+	peers = store.ListPeers(1, 1, 3, 4)
+	require.Len(t, peers, 1)
+	assert.Equal(t, types.NodeID(3), peers[0].ID)
+
+	node, ok := store.GetNode(2)
+	require.True(t, ok)
+
+	byKey, ok := store.GetNodeByNodeKey(node.NodeKey)
+	require.True(t, ok)
+	assert.Equal(t, node.ID, byKey.ID)
+	assert.True(t, store.HasNodeKey(node.NodeKey))
+
+	byMachine, ok := store.GetNodeByMachineKey(node.MachineKey)
+	require.True(t, ok)
+	assert.Equal(t, node.ID, byMachine.ID)
+
+	_, ok = store.GetNode(42)
+	assert.False(t, ok)
+
+	// Nodes returned by the store are copies and can be
+	// modified without changing the store.
+	node.Hostname = "changed"
+	node.Hostinfo.NetInfo.PreferredDERP = 999
+	node.IPv4 = nil
+
+	again, ok := store.GetNode(2)
+	require.True(t, ok)
+	assert.Equal(t, "node-1", again.Hostname)
+	assert.Equal(t, 1, again.Hostinfo.NetInfo.PreferredDERP)
+	assert.NotNil(t, again.IPv4)
+}
+
+func TestNodeStoreUpdateNodePersists(t *testing.T) {
+	hsdb := createTestNodes(t, 2)
+
+	store, err := NewNodeStore(hsdb, time.Hour, nil)
+	require.NoError(t, err)
+
+	endpoints := []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:41641")}
+	lastSeen := time.Now().UTC().Truncate(time.Second)
+
+	updated, ok := store.UpdateNode(1, func(node *types.Node) {
+		node.Endpoints = endpoints
+		node.LastSeen = &lastSeen
+		node.Hostinfo.NetInfo.PreferredDERP = 2
+		// Not persisted by the store.
+		node.Hostname = "ignored"
+	})
+	require.True(t, ok)
+	assert.Equal(t, endpoints, updated.Endpoints)
+
+	_, ok = store.UpdateNode(42, func(node *types.Node) {})
+	assert.False(t, ok)
+
+	// The store is updated immediately, but not the database.
+	node, ok := store.GetNode(1)
+	require.True(t, ok)
+	assert.Equal(t, endpoints, node.Endpoints)
+
+	dbNode, err := hsdb.GetNodeByID(1)
+	require.NoError(t, err)
+	assert.Empty(t, dbNode.Endpoints)
+
+	// Reloading keeps the changes that are not yet persisted.
+	require.NoError(t, store.Reload(1))
+	node, ok = store.GetNode(1)
+	require.True(t, ok)
+	assert.Equal(t, endpoints, node.Endpoints)
+
+	require.NoError(t, store.Close())
+	require.ErrorIs(t, store.Close(), ErrNodeStoreClosed)
+
+	dbNode, err = hsdb.GetNodeByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, endpoints, dbNode.Endpoints)
+	assert.Equal(t, 2, dbNode.Hostinfo.NetInfo.PreferredDERP)
+	require.NotNil(t, dbNode.LastSeen)
+	assert.True(t, lastSeen.Equal(*dbNode.LastSeen))
+	assert.Equal(t, "node-0", dbNode.Hostname)
+
+	// Changes made after the store is closed are written immediately.
+	_, ok = store.UpdateNode(2, func(node *types.Node) {
+		node.Endpoints = endpoints
+	})
+	require.True(t, ok)
+
+	dbNode, err = hsdb.GetNodeByID(2)
+	require.NoError(t, err)
+	assert.Equal(t, endpoints, dbNode.Endpoints)
+}
+
+func TestNodeStoreKeysNotPersisted(t *testing.T) {
+	hsdb := createTestNodes(t, 1)
+
+	store, err := NewNodeStore(hsdb, time.Hour, nil)
+	require.NoError(t, err)
+	defer store.Close()
+
+	before, ok := store.GetNode(1)
+	require.True(t, ok)
+
+	// A pending change with the key of the previous registration.
+	store.UpdateNode(1, func(node *types.Node) {
+		node.LastSeen = ptr.To(time.Now())
+	})
+
+	// The node re-registers with a new key.
+	newKey := key.NewNode().Public()
+	store.DiscardPending(before.MachineKey)
+	require.NoError(t, hsdb.DB.Model(&types.Node{ID: 1}).Select("node_key").Updates(&types.Node{NodeKey: newKey}).Error)
+
+	require.NoError(t, store.Flush())
+	dbNode, err := hsdb.GetNodeByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, newKey, dbNode.NodeKey)
+
+	// Reloading a node with pending changes takes its key from the
+	// database.
+	store.UpdateNode(1, func(node *types.Node) {
+		node.LastSeen = ptr.To(time.Now())
+	})
+	require.NoError(t, store.Reload(1))
+	assert.True(t, store.HasNodeKey(newKey))
+	assert.False(t, store.HasNodeKey(before.NodeKey))
+
+	require.NoError(t, store.Flush())
+	dbNode, err = hsdb.GetNodeByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, newKey, dbNode.NodeKey)
+}
+
+func TestNodeStorePersistInterval(t *testing.T) {
+	hsdb := createTestNodes(t, 1)
+
+	store, err := NewNodeStore(hsdb, 10*time.Millisecond, nil)
+	require.NoError(t, err)
+	defer store.Close()
+
+	endpoints := []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:41641")}
+	store.UpdateNode(1, func(node *types.Node) {
+		node.Endpoints = endpoints
+	})
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		dbNode, err := hsdb.GetNodeByID(1)
+		assert.NoError(c, err)
+		assert.Equal(c, endpoints, dbNode.Endpoints)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNodeStoreReload(t *testing.T) {
+	hsdb := createTestNodes(t, 3)
+
+	store, err := NewNodeStore(hsdb, 0, nil)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, hsdb.DB.Model(&types.Node{ID: 1}).Update("given_name", "renamed").Error)
+	require.NoError(t, store.Reload(1))
+
+	node, ok := store.GetNode(1)
+	require.True(t, ok)
+	assert.Equal(t, "renamed", node.GivenName)
+
+	node, ok = store.GetNode(3)
+	require.True(t, ok)
+	require.NoError(t, hsdb.DeleteNode(node))
+
+	// Reloading a node that no longer exists removes it.
+	require.NoError(t, store.Reload(3))
+	_, ok = store.GetNode(3)
+	assert.False(t, ok)
+	assert.False(t, store.HasNodeKey(node.NodeKey))
+
+	node, ok = store.GetNode(2)
+	require.True(t, ok)
+	require.NoError(t, hsdb.DeleteNode(node))
+	store.DeleteNode(2)
+	assert.Len(t, store.ListNodes(), 1)
+
+	loaded, err := store.LoadNode(1)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", loaded.GivenName)
+
+	_, err = store.LoadNode(2)
+	require.Error(t, err)
+}
+
+func BenchmarkListPeers(b *testing.B) {
+	hsdb := createTestNodes(b, 500)
+
+	store, err := NewNodeStore(hsdb, time.Hour, nil)
+	require.NoError(b, err)
+	defer store.Close()
+
+	b.Run("database", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := hsdb.ListPeers(1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("nodestore", func(b *testing.B) {
+		for b.Loop() {
+			store.ListPeers(1)
+		}
+	})
+}
+
+func BenchmarkGetNodeByID(b *testing.B) {
+	hsdb := createTestNodes(b, 500)
+
+	store, err := NewNodeStore(hsdb, time.Hour, nil)
+	require.NoError(b, err)
+	defer store.Close()
+
+	b.Run("database", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := hsdb.GetNodeByID(250); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("nodestore", func(b *testing.B) {
+		for b.Loop() {
+			store.GetNode(250)
+		}
+	})
+}
+
+func BenchmarkEndpointUpdate(b *testing.B) {
+	hsdb := createTestNodes(b, 500)
+
+	store, err := NewNodeStore(hsdb, time.Hour, nil)
+	require.NoError(b, err)
+	defer store.Close()
+
+	b.Run("database", func(b *testing.B) {
+		node, err := hsdb.GetNodeByID(250)
+		require.NoError(b, err)
+
+		for b.Loop() {
+			node.LastSeen = ptr.To(time.Now())
+			if err := hsdb.DB.Save(node).Error; err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("nodestore", func(b *testing.B) {
+		for b.Loop() {
+			store.UpdateNode(250, func(node *types.Node) {
+				node.LastSeen = ptr.To(time.Now())
+			})
+		}
+	})
+}
@@ -917,3 +917,46 @@ func TestListNodes(t *testing.T) {
 	assert.Equal(t, "test1", nodes[0].Hostname)
 	assert.Equal(t, "test2", nodes[1].Hostname)
 }
+
+func TestSetLabels(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	user, err := db.CreateUser(types.User{Name: "test"})
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "test",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodAuthKey,
+		Labels:         map[string]string{"team": "data"},
+	}
+	require.NoError(t, db.DB.Save(&node).Error)
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		return SetLabels(tx, node.ID, map[string]string{"env": "prod", "k8s.io/zone": "eu-1"}, []string{"team"})
+	})
+	require.NoError(t, err)
+
+	got, err := db.GetNodeByID(node.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "k8s.io/zone": "eu-1"}, got.Labels)
+
+	for _, labels := range []map[string]string{
+		{"": "x"},
+		{"-env": "x"},
+		{"env": "a b"},
+		{"env": "a&&b"},
+	} {
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			return SetLabels(tx, node.ID, labels, nil)
+		})
+		require.ErrorIs(t, err, types.ErrNodeLabelInvalid, "labels %v", labels)
+	}
+
+	got, err = db.GetNodeByID(node.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "k8s.io/zone": "eu-1"}, got.Labels)
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"tailscale.com/util/set"
+)
+
+const (
+	oauthClientIDLength     = 16
+	oauthClientSecretLength = 48
+
+	// OAuthClientSecretPrefix starts every OAuth client secret, to make
+	// them recognisable.
+	OAuthClientSecretPrefix = "hsoc_"
+)
+
+var (
+	ErrOAuthClientNotFound     = errors.New("OAuth client not found")
+	ErrOAuthClientInvalidScope = errors.New("OAuth client scope is invalid")
+	ErrOAuthClientTagInvalid   = errors.New("OAuth client tag is invalid")
+)
+
+// OAuthClientOptions describes the OAuthClient to create.
+type OAuthClientOptions struct {
+	Scopes      []string
+	Tags        []string
+	Description string
+	Expiration  *time.Time
+}
+
+// CreateOAuthClient creates a new OAuthClient and returns it with its
+// secret, the secret is only stored hashed.
+func (hsdb *HSDatabase) CreateOAuthClient(
+	opts OAuthClientOptions,
+) (string, *types.OAuthClient, error) {
+	if len(opts.Scopes) == 0 {
+		return "", nil, fmt.Errorf("%w: at least one scope is required", ErrOAuthClientInvalidScope)
+	}
+
+	if err := types.ValidateOAuthScopes(opts.Scopes); err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrOAuthClientInvalidScope, err)
+	}
+
+	tags := set.SetOf(opts.Tags).Slice()
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "tag:") {
+			return "", nil, fmt.Errorf(
+				"%w: '%s' did not begin with 'tag:'",
+				ErrOAuthClientTagInvalid,
+				tag,
+			)
+		}
+	}
+
+	clientID, err := util.GenerateRandomStringDNSSafe(oauthClientIDLength)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := util.GenerateRandomStringURLSafe(oauthClientSecretLength)
+	if err != nil {
+		return "", nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", nil, err
+	}
+
+	client := types.OAuthClient{
+		ClientID:    clientID,
+		Hash:        hash,
+		Scopes:      set.SetOf(opts.Scopes).Slice(),
+		Tags:        tags,
+		Description: opts.Description,
+		Expiration:  opts.Expiration,
+	}
+
+	if err := hsdb.DB.Save(&client).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to save OAuth client to database: %w", err)
+	}
+
+	// Secret to return to user, this will only be visible _once_
+	return OAuthClientSecretPrefix + secret, &client, nil
+}
+
+// ListOAuthClients returns the list of OAuthClients.
+func (hsdb *HSDatabase) ListOAuthClients() ([]types.OAuthClient, error) {
+	clients := []types.OAuthClient{}
+	if err := hsdb.DB.Find(&clients).Error; err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// GetOAuthClient returns the OAuthClient with the given client ID.
+func (hsdb *HSDatabase) GetOAuthClient(clientID string) (*types.OAuthClient, error) {
+	client := types.OAuthClient{}
+	if err := hsdb.DB.First(&client, "client_id = ?", clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthClientNotFound
+		}
+
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// DestroyOAuthClient destroys an OAuthClient, access tokens issued to it
+// stop being accepted.
+func (hsdb *HSDatabase) DestroyOAuthClient(client types.OAuthClient) error {
+	if result := hsdb.DB.Unscoped().Delete(client); result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+// ValidateOAuthClient returns the OAuthClient with the given client ID if
+// the secret matches and the client has not expired.
+// The secret is hashed even if there is no such client, so that the time
+// taken does not tell if a client ID exists.
+func (hsdb *HSDatabase) ValidateOAuthClient(clientID, secret string) (*types.OAuthClient, error) {
+	secret = strings.TrimPrefix(secret, OAuthClientSecretPrefix)
+
+	client, err := hsdb.GetOAuthClient(clientID)
+	if err != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyOAuthClientHash, []byte(secret))
+
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword(client.Hash, []byte(secret)); err != nil {
+		return nil, ErrOAuthClientNotFound
+	}
+
+	if client.IsExpired() {
+		return nil, ErrOAuthClientNotFound
+	}
+
+	now := time.Now()
+	if err := hsdb.DB.Model(client).Update("last_seen", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to update OAuth client last seen: %w", err)
+	}
+	client.LastSeen = &now
+
+	return client, nil
+}
+
+// dummyOAuthClientHash is compared against secrets of unknown clients.
+var dummyOAuthClientHash, _ = bcrypt.GenerateFromPassword(
+	[]byte(strings.Repeat("0", oauthClientSecretLength)),
+	bcrypt.DefaultCost,
+)
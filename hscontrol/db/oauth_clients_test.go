@@ -0,0 +1,83 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateOAuthClient(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	secret, client, err := db.CreateOAuthClient(OAuthClientOptions{
+		Scopes:      []string{"auth_keys", "nodes:read"},
+		Tags:        []string{"tag:ci", "tag:ci"},
+		Description: "ci",
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, OAuthClientSecretPrefix))
+	assert.NotEmpty(t, client.ClientID)
+	assert.Equal(t, []string{"tag:ci"}, client.Tags)
+
+	clients, err := db.ListOAuthClients()
+	require.NoError(t, err)
+	require.Len(t, clients, 1)
+	assert.Equal(t, client.ClientID, clients[0].ClientID)
+	assert.ElementsMatch(t, []string{"auth_keys", "nodes:read"}, clients[0].Scopes)
+	assert.Equal(t, "ci", clients[0].Description)
+
+	_, _, err = db.CreateOAuthClient(OAuthClientOptions{})
+	require.ErrorIs(t, err, ErrOAuthClientInvalidScope)
+
+	_, _, err = db.CreateOAuthClient(OAuthClientOptions{Scopes: []string{"devices"}})
+	require.ErrorIs(t, err, ErrOAuthClientInvalidScope)
+
+	_, _, err = db.CreateOAuthClient(OAuthClientOptions{Scopes: []string{"all"}, Tags: []string{"ci"}})
+	require.ErrorIs(t, err, ErrOAuthClientTagInvalid)
+}
+
+func TestValidateOAuthClient(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	secret, client, err := db.CreateOAuthClient(OAuthClientOptions{Scopes: []string{"all"}})
+	require.NoError(t, err)
+
+	got, err := db.ValidateOAuthClient(client.ClientID, secret)
+	require.NoError(t, err)
+	assert.Equal(t, client.ID, got.ID)
+	assert.NotNil(t, got.LastSeen)
+
+	past := time.Now().Add(-time.Minute)
+	expiredSecret, expired, err := db.CreateOAuthClient(OAuthClientOptions{
+		Scopes:     []string{"all"},
+		Expiration: &past,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		clientID string
+		secret   string
+	}{
+		{name: "wrong-secret", clientID: client.ClientID, secret: OAuthClientSecretPrefix + "wrong"},
+		{name: "unknown-client", clientID: "unknown", secret: secret},
+		{name: "expired", clientID: expired.ClientID, secret: expiredSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.ValidateOAuthClient(tt.clientID, tt.secret)
+			assert.ErrorIs(t, err, ErrOAuthClientNotFound)
+		})
+	}
+
+	require.NoError(t, db.DestroyOAuthClient(*client))
+
+	_, err = db.ValidateOAuthClient(client.ClientID, secret)
+	assert.ErrorIs(t, err, ErrOAuthClientNotFound)
+}
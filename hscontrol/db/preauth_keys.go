@@ -9,27 +9,66 @@ import (
 	"time"
 
 	"github.com/juanfont/headscale/hscontrol/types"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"tailscale.com/util/set"
 )
 
+const (
+	preAuthKeyLength       = 48
+	preAuthKeyPrefixLength = 12
+)
+
 var (
 	ErrPreAuthKeyNotFound          = errors.New("AuthKey not found")
 	ErrPreAuthKeyExpired           = errors.New("AuthKey expired")
 	ErrSingleUseAuthKeyHasBeenUsed = errors.New("AuthKey has already been used")
 	ErrUserMismatch                = errors.New("user mismatch")
 	ErrPreAuthKeyACLTagInvalid     = errors.New("AuthKey tag is invalid")
+	ErrPreAuthKeyExhausted         = errors.New("AuthKey has reached its usage limit")
 )
 
+// PreAuthKeyOptions describes the PreAuthKey to create.
+type PreAuthKeyOptions struct {
+	Reusable    bool
+	Ephemeral   bool
+	Expiration  *time.Time
+	Tags        []string
+	Description string
+	MaxUses     uint
+	Constraints types.PreAuthKeyConstraints
+}
+
 func (hsdb *HSDatabase) CreatePreAuthKey(
 	uid types.UserID,
 	reusable bool,
 	ephemeral bool,
 	expiration *time.Time,
 	aclTags []string,
+) (*types.PreAuthKey, error) {
+	return hsdb.CreatePreAuthKeyWithOptions(uid, PreAuthKeyOptions{
+		Reusable:   reusable,
+		Ephemeral:  ephemeral,
+		Expiration: expiration,
+		Tags:       aclTags,
+	})
+}
+
+func (hsdb *HSDatabase) CreatePreAuthKeyWithOptions(
+	uid types.UserID,
+	opts PreAuthKeyOptions,
 ) (*types.PreAuthKey, error) {
 	return Write(hsdb.DB, func(tx *gorm.DB) (*types.PreAuthKey, error) {
-		return CreatePreAuthKey(tx, uid, reusable, ephemeral, expiration, aclTags)
+		user, err := GetUserByID(tx, uid)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkPreAuthKeyQuota(tx, user, hsdb.quota); err != nil {
+			return nil, err
+		}
+
+		return CreatePreAuthKeyWithOptions(tx, uid, opts)
 	})
 }
 
@@ -41,14 +80,33 @@ func CreatePreAuthKey(
 	ephemeral bool,
 	expiration *time.Time,
 	aclTags []string,
+) (*types.PreAuthKey, error) {
+	return CreatePreAuthKeyWithOptions(tx, uid, PreAuthKeyOptions{
+		Reusable:   reusable,
+		Ephemeral:  ephemeral,
+		Expiration: expiration,
+		Tags:       aclTags,
+	})
+}
+
+// CreatePreAuthKeyWithOptions creates a new PreAuthKey in a user, with a
+// description, usage limit and constraints, and returns it.
+func CreatePreAuthKeyWithOptions(
+	tx *gorm.DB,
+	uid types.UserID,
+	opts PreAuthKeyOptions,
 ) (*types.PreAuthKey, error) {
 	user, err := GetUserByID(tx, uid)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := opts.Constraints.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Remove duplicates
-	aclTags = set.SetOf(aclTags).Slice()
+	aclTags := set.SetOf(opts.Tags).Slice()
 
 	// TODO(kradalby): factor out and create a reusable tag validation,
 	// check if there is one in Tailscale's lib.
@@ -69,15 +127,26 @@ func CreatePreAuthKey(
 		return nil, err
 	}
 
+	prefix, hash, err := hashPreAuthKey(kstr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The full key is returned to the user, this will only be visible _once_
 	key := types.PreAuthKey{
-		Key:        kstr,
-		UserID:     user.ID,
-		User:       *user,
-		Reusable:   reusable,
-		Ephemeral:  ephemeral,
-		CreatedAt:  &now,
-		Expiration: expiration,
-		Tags:       aclTags,
+		Prefix:      prefix,
+		Hash:        hash,
+		Key:         kstr,
+		UserID:      user.ID,
+		User:        *user,
+		Reusable:    opts.Reusable,
+		Ephemeral:   opts.Ephemeral,
+		Description: opts.Description,
+		MaxUses:     opts.MaxUses,
+		CreatedAt:   &now,
+		Expiration:  opts.Expiration,
+		Tags:        aclTags,
+		Constraints: opts.Constraints,
 	}
 
 	if err := tx.Save(&key).Error; err != nil {
@@ -114,11 +183,35 @@ func (hsdb *HSDatabase) GetPreAuthKey(key string) (*types.PreAuthKey, error) {
 	})
 }
 
-// GetPreAuthKey returns a PreAuthKey for a given key. The caller is responsible
-// for checking if the key is usable (expired or used).
+// GetPreAuthKey returns a PreAuthKey for a given key, after comparing the
+// key against its hash. The caller is responsible for checking if the key is
+// usable (expired or used).
+// A key is hashed even if there is no key with its prefix, so that the time
+// taken does not tell if a prefix exists.
 func GetPreAuthKey(tx *gorm.DB, key string) (*types.PreAuthKey, error) {
+	prefix, secret := splitPreAuthKey(key)
+
+	pak, err := GetPreAuthKeyByPrefix(tx, prefix)
+	if err != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyPreAuthKeyHash, []byte(secret))
+
+		return nil, ErrPreAuthKeyNotFound
+	}
+
+	if err := bcrypt.CompareHashAndPassword(pak.Hash, []byte(secret)); err != nil {
+		return nil, ErrPreAuthKeyNotFound
+	}
+
+	return pak, nil
+}
+
+// GetPreAuthKeyByPrefix returns the PreAuthKey with the given prefix, or
+// the PreAuthKey of the given full key, without checking the key.
+func GetPreAuthKeyByPrefix(tx *gorm.DB, prefix string) (*types.PreAuthKey, error) {
+	prefix, _ = splitPreAuthKey(prefix)
+
 	pak := types.PreAuthKey{}
-	if err := tx.Preload("User").First(&pak, "key = ?", key).Error; err != nil {
+	if err := tx.Preload("User").First(&pak, "prefix = ?", prefix).Error; err != nil {
 		return nil, ErrPreAuthKeyNotFound
 	}
 
@@ -143,16 +236,59 @@ func (hsdb *HSDatabase) ExpirePreAuthKey(k *types.PreAuthKey) error {
 	})
 }
 
-// UsePreAuthKey marks a PreAuthKey as used.
+// UsePreAuthKey records that a node has been registered with a PreAuthKey,
+// and marks it as used once it can not register more nodes. It fails with
+// ErrPreAuthKeyExhausted if the key has been used up in the meantime.
 func UsePreAuthKey(tx *gorm.DB, k *types.PreAuthKey) error {
-	k.Used = true
-	if err := tx.Save(k).Error; err != nil {
-		return fmt.Errorf("failed to update key used status in the database: %w", err)
+	res := tx.Model(&types.PreAuthKey{}).
+		Where("id = ? AND used = ?", k.ID, false).
+		Where("max_uses = 0 OR use_count < max_uses").
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if res.Error != nil {
+		return fmt.Errorf("failed to update key use count in the database: %w", res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrPreAuthKeyExhausted
+	}
+
+	k.UseCount++
+
+	if (k.MaxUses == 0 && !k.Reusable) || (k.MaxUses > 0 && k.UseCount >= k.MaxUses) {
+		k.Used = true
+		if err := tx.Model(&types.PreAuthKey{}).Where("id = ?", k.ID).Update("used", true).Error; err != nil {
+			return fmt.Errorf("failed to update key used status in the database: %w", err)
+		}
 	}
 
 	return nil
 }
 
+func (hsdb *HSDatabase) ListNodesByPreAuthKey(id uint64) (types.Nodes, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) (types.Nodes, error) {
+		return ListNodesByPreAuthKey(rx, id)
+	})
+}
+
+// ListNodesByPreAuthKey returns the nodes registered with the PreAuthKey.
+func ListNodesByPreAuthKey(tx *gorm.DB, id uint64) (types.Nodes, error) {
+	if err := tx.First(&types.PreAuthKey{}, "id = ?", id).Error; err != nil {
+		return nil, ErrPreAuthKeyNotFound
+	}
+
+	nodes := types.Nodes{}
+	if err := tx.
+		Preload("AuthKey").
+		Preload("AuthKey.User").
+		Preload("User").
+		Where(&types.Node{AuthKeyID: &id}).
+		Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
 // MarkExpirePreAuthKey marks a PreAuthKey as expired.
 func ExpirePreAuthKey(tx *gorm.DB, k *types.PreAuthKey) error {
 	if err := tx.Model(&k).Update("Expiration", time.Now()).Error; err != nil {
@@ -163,11 +299,38 @@ func ExpirePreAuthKey(tx *gorm.DB, k *types.PreAuthKey) error {
 }
 
 func generateKey() (string, error) {
-	size := 24
-	bytes := make([]byte, size)
+	bytes := make([]byte, preAuthKeyLength/2)
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
 	}
 
 	return hex.EncodeToString(bytes), nil
 }
+
+// splitPreAuthKey splits a key in its prefix, stored in the database, and
+// its secret, only stored hashed.
+func splitPreAuthKey(key string) (string, string) {
+	if len(key) <= preAuthKeyPrefixLength {
+		return key, ""
+	}
+
+	return key[:preAuthKeyPrefixLength], key[preAuthKeyPrefixLength:]
+}
+
+// hashPreAuthKey returns the prefix and the hash of the secret of key.
+func hashPreAuthKey(key string) (string, []byte, error) {
+	prefix, secret := splitPreAuthKey(key)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", nil, fmt.Errorf("hashing pre auth key: %w", err)
+	}
+
+	return prefix, hash, nil
+}
+
+// dummyPreAuthKeyHash is compared against keys with an unknown prefix.
+var dummyPreAuthKeyHash, _ = bcrypt.GenerateFromPassword(
+	[]byte(strings.Repeat("0", preAuthKeyLength-preAuthKeyPrefixLength)),
+	bcrypt.DefaultCost,
+)
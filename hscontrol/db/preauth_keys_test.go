@@ -1,13 +1,17 @@
 package db
 
 import (
+	"fmt"
+	"net/netip"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 	"tailscale.com/types/ptr"
 
 	"gopkg.in/check.v1"
@@ -27,6 +31,7 @@ func (*Suite) TestCreatePreAuthKey(c *check.C) {
 	// Did we get a valid key?
 	c.Assert(key.Key, check.NotNil)
 	c.Assert(len(key.Key), check.Equals, 48)
+	c.Assert(key.Prefix, check.Equals, key.Key[:12])
 
 	// Make sure the User association is populated
 	c.Assert(key.User.ID, check.Equals, user.ID)
@@ -41,6 +46,49 @@ func (*Suite) TestCreatePreAuthKey(c *check.C) {
 
 	// Make sure the User association is populated
 	c.Assert((keys)[0].User.ID, check.Equals, user.ID)
+
+	// Only the prefix and hash of the key are stored
+	c.Assert((keys)[0].Key, check.Equals, "")
+	c.Assert((keys)[0].Prefix, check.Equals, key.Prefix)
+}
+
+func TestGetPreAuthKey(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	user, err := db.CreateUser(types.User{Name: "test"})
+	require.NoError(t, err)
+
+	key, err := db.CreatePreAuthKey(types.UserID(user.ID), false, false, nil, nil)
+	require.NoError(t, err)
+
+	got, err := db.GetPreAuthKey(key.Key)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, got.ID)
+	assert.Equal(t, user.ID, got.User.ID)
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "wrong-secret", key: key.Prefix + strings.Repeat("0", 36)},
+		{name: "prefix-only", key: key.Prefix},
+		{name: "unknown-prefix", key: "000000000000" + key.Key[12:]},
+		{name: "empty", key: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.GetPreAuthKey(tt.key)
+			assert.ErrorIs(t, err, ErrPreAuthKeyNotFound)
+		})
+	}
+
+	byPrefix, err := Read(db.DB, func(rx *gorm.DB) (*types.PreAuthKey, error) {
+		return GetPreAuthKeyByPrefix(rx, key.Prefix)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, byPrefix.ID)
 }
 
 func (*Suite) TestPreAuthKeyACLTags(c *check.C) {
@@ -83,3 +131,102 @@ func TestCannotDeleteAssignedPreAuthKey(t *testing.T) {
 	err = db.DB.Delete(key).Error
 	require.ErrorContains(t, err, "constraint failed: FOREIGN KEY constraint failed")
 }
+
+func TestUsePreAuthKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     PreAuthKeyOptions
+		wantUses int
+	}{
+		{
+			name:     "single-use",
+			opts:     PreAuthKeyOptions{},
+			wantUses: 1,
+		},
+		{
+			name:     "max-uses",
+			opts:     PreAuthKeyOptions{MaxUses: 3},
+			wantUses: 3,
+		},
+		{
+			name:     "reusable-max-uses",
+			opts:     PreAuthKeyOptions{Reusable: true, MaxUses: 2},
+			wantUses: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := newSQLiteTestDB()
+			require.NoError(t, err)
+
+			user, err := db.CreateUser(types.User{Name: "test"})
+			require.NoError(t, err)
+
+			pak, err := db.CreatePreAuthKeyWithOptions(types.UserID(user.ID), tt.opts)
+			require.NoError(t, err)
+
+			for range tt.wantUses {
+				assert.False(t, pak.Used)
+				require.NoError(t, db.Write(func(tx *gorm.DB) error {
+					return UsePreAuthKey(tx, pak)
+				}))
+			}
+
+			assert.True(t, pak.Used)
+
+			err = db.Write(func(tx *gorm.DB) error {
+				return UsePreAuthKey(tx, pak)
+			})
+			require.ErrorIs(t, err, ErrPreAuthKeyExhausted)
+
+			stored, err := db.GetPreAuthKey(pak.Key)
+			require.NoError(t, err)
+			assert.True(t, stored.Used)
+			assert.Equal(t, uint(tt.wantUses), stored.UseCount)
+		})
+	}
+}
+
+func TestListNodesByPreAuthKey(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	user, err := db.CreateUser(types.User{Name: "test"})
+	require.NoError(t, err)
+
+	pak, err := db.CreatePreAuthKeyWithOptions(types.UserID(user.ID), PreAuthKeyOptions{
+		Reusable:    true,
+		Description: "fleet",
+		Constraints: types.PreAuthKeyConstraints{
+			AllowedOS:      []string{"linux"},
+			ApprovedRoutes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+		},
+	})
+	require.NoError(t, err)
+
+	other, err := db.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, nil)
+	require.NoError(t, err)
+
+	for index, key := range []*types.PreAuthKey{pak, pak, other} {
+		node := types.Node{
+			Hostname:       fmt.Sprintf("node-%d", index),
+			UserID:         user.ID,
+			RegisterMethod: util.RegisterMethodAuthKey,
+			AuthKeyID:      ptr.To(key.ID),
+		}
+		require.NoError(t, db.DB.Save(&node).Error)
+	}
+
+	nodes, err := db.ListNodesByPreAuthKey(pak.ID)
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	assert.Equal(t, "node-0", nodes[0].Hostname)
+	assert.Equal(t, "node-1", nodes[1].Hostname)
+	assert.Equal(t, "fleet", nodes[0].AuthKey.Description)
+	assert.Equal(t, []string{"linux"}, nodes[0].AuthKey.Constraints.AllowedOS)
+	assert.Equal(t, pak.Constraints.ApprovedRoutes, nodes[0].AuthKey.Constraints.ApprovedRoutes)
+
+	_, err = db.ListNodesByPreAuthKey(12345)
+	assert.ErrorIs(t, err, ErrPreAuthKeyNotFound)
+}
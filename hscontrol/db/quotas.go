@@ -0,0 +1,319 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+	"tailscale.com/net/tsaddr"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrInvalidQuota  = errors.New("invalid quota")
+)
+
+// QuotaError tells which quota of a user an operation exceeds. Its message
+// is meant for the user.
+type QuotaError struct {
+	User     string
+	Resource string
+	Limit    int
+}
+
+func (e QuotaError) Error() string {
+	return fmt.Sprintf("user %q has reached its limit of %d %s", e.User, e.Limit, e.Resource)
+}
+
+func (e QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// SetDefaultQuota sets the quota of the users without their own.
+func (hsdb *HSDatabase) SetDefaultQuota(quota types.Quota) {
+	hsdb.quota = quota
+}
+
+// DefaultQuota returns the quota of the users without their own.
+func (hsdb *HSDatabase) DefaultQuota() types.Quota {
+	return hsdb.quota
+}
+
+// UserQuota returns the quota that applies to the user.
+func (hsdb *HSDatabase) UserQuota(user *types.User) types.Quota {
+	return hsdb.quota.Override(user.Quota)
+}
+
+func (hsdb *HSDatabase) SetUserQuota(uid types.UserID, quota types.UserQuota) (*types.User, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) (*types.User, error) {
+		return SetUserQuota(tx, uid, quota)
+	})
+}
+
+// SetUserQuota replaces the quota of a User, the limits that are not set
+// use the default quota.
+func SetUserQuota(tx *gorm.DB, uid types.UserID, quota types.UserQuota) (*types.User, error) {
+	user, err := GetUserByID(tx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, limit := range []*int{quota.MaxNodes, quota.MaxEphemeralNodes, quota.MaxPreAuthKeys, quota.MaxRoutes} {
+		if limit != nil && *limit < 0 {
+			return nil, fmt.Errorf("%w: limits must not be negative", ErrInvalidQuota)
+		}
+	}
+
+	user.Quota = quota
+	if err := tx.Model(user).Updates(map[string]any{
+		"quota_max_nodes":           quota.MaxNodes,
+		"quota_max_ephemeral_nodes": quota.MaxEphemeralNodes,
+		"quota_max_pre_auth_keys":   quota.MaxPreAuthKeys,
+		"quota_max_routes":          quota.MaxRoutes,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("setting user quota: %w", err)
+	}
+
+	return user, nil
+}
+
+func (hsdb *HSDatabase) GetQuotaUsage(uid types.UserID) (types.QuotaUsage, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) (types.QuotaUsage, error) {
+		return GetQuotaUsage(rx, uid)
+	})
+}
+
+// GetQuotaUsage returns how much of its quota a User uses.
+func GetQuotaUsage(tx *gorm.DB, uid types.UserID) (types.QuotaUsage, error) {
+	var usage types.QuotaUsage
+
+	nodes, err := ListNodesByUser(tx, uid)
+	if err != nil {
+		return usage, err
+	}
+
+	for _, node := range nodes {
+		usage.Nodes++
+		if node.IsEphemeral() {
+			usage.EphemeralNodes++
+		}
+		usage.Routes += countRoutes(node.ApprovedRoutes)
+	}
+
+	keys, err := ListPreAuthKeysByUser(tx, uid)
+	if err != nil {
+		return usage, err
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		if preAuthKeyActive(&key, now) {
+			usage.PreAuthKeys++
+		}
+	}
+
+	return usage, nil
+}
+
+// preAuthKeyActive reports whether a pre auth key can still register nodes.
+func preAuthKeyActive(key *types.PreAuthKey, now time.Time) bool {
+	switch {
+	case key.Expiration != nil && key.Expiration.Before(now):
+		return false
+	case key.MaxUses > 0:
+		return key.UseCount < key.MaxUses
+	default:
+		return key.Reusable || !key.Used
+	}
+}
+
+// countRoutes counts the routes, an exit node counting as one route.
+func countRoutes(routes []netip.Prefix) int {
+	n := 0
+	exit := false
+	for _, route := range routes {
+		if tsaddr.IsExitRoute(route) {
+			exit = true
+			continue
+		}
+		n++
+	}
+	if exit {
+		n++
+	}
+
+	return n
+}
+
+// CheckNodeQuota fails with a QuotaError if registering node exceeds the
+// quota of its user, the routes approved on it included. A node replacing a
+// node of the same user with the same machine key is not counted, only the
+// routes it approves in addition to the routes of the replaced node are.
+func CheckNodeQuota(tx *gorm.DB, node *types.Node, defaults types.Quota) error {
+	old, _ := GetNodeByMachineKey(tx, node.MachineKey)
+	replacing := old != nil && old.UserID == node.UserID
+
+	user, err := GetUserByID(tx, types.UserID(node.UserID))
+	if err != nil {
+		return err
+	}
+
+	quota := defaults.Override(user.Quota)
+	checkNodes := !replacing && (quota.MaxNodes > 0 || (quota.MaxEphemeralNodes > 0 && node.IsEphemeral()))
+	checkRoutes := quota.MaxRoutes > 0 && len(node.ApprovedRoutes) > 0
+	if !checkNodes && !checkRoutes {
+		return nil
+	}
+
+	usage, err := GetQuotaUsage(tx, types.UserID(user.ID))
+	if err != nil {
+		return err
+	}
+
+	if checkNodes {
+		if quota.MaxNodes > 0 && usage.Nodes >= quota.MaxNodes {
+			return QuotaError{User: user.Username(), Resource: "nodes", Limit: quota.MaxNodes}
+		}
+
+		if node.IsEphemeral() && quota.MaxEphemeralNodes > 0 && usage.EphemeralNodes >= quota.MaxEphemeralNodes {
+			return QuotaError{User: user.Username(), Resource: "ephemeral nodes", Limit: quota.MaxEphemeralNodes}
+		}
+	}
+
+	if checkRoutes {
+		var oldRoutes []netip.Prefix
+		if replacing {
+			oldRoutes = old.ApprovedRoutes
+		}
+
+		if exceedsRouteQuota(usage, quota, oldRoutes, node.ApprovedRoutes) {
+			return QuotaError{User: user.Username(), Resource: "routes", Limit: quota.MaxRoutes}
+		}
+	}
+
+	return nil
+}
+
+// checkPreAuthKeyQuota fails with a QuotaError if the user cannot have
+// another active pre auth key.
+func checkPreAuthKeyQuota(tx *gorm.DB, user *types.User, defaults types.Quota) error {
+	quota := defaults.Override(user.Quota)
+	if quota.MaxPreAuthKeys == 0 {
+		return nil
+	}
+
+	usage, err := GetQuotaUsage(tx, types.UserID(user.ID))
+	if err != nil {
+		return err
+	}
+
+	if usage.PreAuthKeys >= quota.MaxPreAuthKeys {
+		return QuotaError{User: user.Username(), Resource: "active pre auth keys", Limit: quota.MaxPreAuthKeys}
+	}
+
+	return nil
+}
+
+// CheckRouteQuota fails with a QuotaError if approving routes on the node
+// exceeds the quota of its user.
+func CheckRouteQuota(tx *gorm.DB, nodeID types.NodeID, routes []netip.Prefix, defaults types.Quota) error {
+	node, err := GetNodeByID(tx, nodeID)
+	if err != nil {
+		return err
+	}
+
+	quota := defaults.Override(node.User.Quota)
+	if quota.MaxRoutes == 0 {
+		return nil
+	}
+
+	usage, err := GetQuotaUsage(tx, types.UserID(node.UserID))
+	if err != nil {
+		return err
+	}
+
+	if exceedsRouteQuota(usage, quota, node.ApprovedRoutes, routes) {
+		return QuotaError{User: node.User.Username(), Resource: "routes", Limit: quota.MaxRoutes}
+	}
+
+	return nil
+}
+
+// exceedsRouteQuota reports whether replacing the approved routes old of a
+// node by routes exceeds the route quota. Only more routes than the node
+// has already are checked, so that routes can be removed from a user above
+// its quota.
+func exceedsRouteQuota(usage types.QuotaUsage, quota types.Quota, old, routes []netip.Prefix) bool {
+	added := countRoutes(routes) - countRoutes(old)
+
+	return quota.MaxRoutes > 0 && added > 0 && usage.Routes+added > quota.MaxRoutes
+}
+
+// checkTransferQuota fails with a QuotaError if moving the nodes and pre
+// auth keys of the user from to the user to exceeds the quota of to.
+func checkTransferQuota(tx *gorm.DB, from, to types.UserID, defaults types.Quota) error {
+	if from == to {
+		return nil
+	}
+
+	moved, err := GetQuotaUsage(tx, from)
+	if err != nil {
+		return err
+	}
+
+	return checkMoveQuota(tx, to, moved, defaults)
+}
+
+// CheckMoveNodeQuota fails with a QuotaError if moving node to the user to
+// exceeds the quota of to.
+func CheckMoveNodeQuota(tx *gorm.DB, node *types.Node, to types.UserID, defaults types.Quota) error {
+	if types.UserID(node.UserID) == to {
+		return nil
+	}
+
+	moved := types.QuotaUsage{Nodes: 1, Routes: countRoutes(node.ApprovedRoutes)}
+	if node.IsEphemeral() {
+		moved.EphemeralNodes = 1
+	}
+
+	return checkMoveQuota(tx, to, moved, defaults)
+}
+
+// checkMoveQuota fails with a QuotaError if giving the user to the moved
+// nodes, pre auth keys and routes exceeds its quota.
+func checkMoveQuota(tx *gorm.DB, to types.UserID, moved types.QuotaUsage, defaults types.Quota) error {
+	user, err := GetUserByID(tx, to)
+	if err != nil {
+		return err
+	}
+
+	quota := defaults.Override(user.Quota)
+	if quota == (types.Quota{}) {
+		return nil
+	}
+
+	usage, err := GetQuotaUsage(tx, to)
+	if err != nil {
+		return err
+	}
+
+	for _, check := range []struct {
+		resource    string
+		used, moved int
+		limit       int
+	}{
+		{"nodes", usage.Nodes, moved.Nodes, quota.MaxNodes},
+		{"ephemeral nodes", usage.EphemeralNodes, moved.EphemeralNodes, quota.MaxEphemeralNodes},
+		{"active pre auth keys", usage.PreAuthKeys, moved.PreAuthKeys, quota.MaxPreAuthKeys},
+		{"routes", usage.Routes, moved.Routes, quota.MaxRoutes},
+	} {
+		if check.limit > 0 && check.moved > 0 && check.used+check.moved > check.limit {
+			return QuotaError{User: user.Username(), Resource: check.resource, Limit: check.limit}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package db
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/types/key"
+	"tailscale.com/types/ptr"
+)
+
+func TestNodeQuota(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	hsdb.SetDefaultQuota(types.Quota{MaxNodes: 1})
+
+	user, node := createUserWithNode(t, hsdb, "alice")
+
+	// The same node registering again is not counted.
+	_, err = hsdb.RegisterNode(*node, nil, nil)
+	require.NoError(t, err)
+
+	_, err = hsdb.RegisterNode(types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "phone",
+		UserID:         user.ID,
+		User:           *user,
+		RegisterMethod: util.RegisterMethodCLI,
+	}, nil, nil)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.EqualError(t, err, `user "alice" has reached its limit of 1 nodes`)
+
+	_, err = hsdb.SetUserQuota(types.UserID(user.ID), types.UserQuota{MaxNodes: ptr.To(0)})
+	require.NoError(t, err)
+
+	_, err = hsdb.RegisterNode(types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "phone",
+		UserID:         user.ID,
+		User:           *user,
+		RegisterMethod: util.RegisterMethodCLI,
+	}, nil, nil)
+	require.NoError(t, err)
+}
+
+func TestEphemeralNodeQuota(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	hsdb.SetDefaultQuota(types.Quota{MaxEphemeralNodes: 1})
+
+	user, err := hsdb.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	register := func(ephemeral bool) error {
+		_, err := hsdb.RegisterNode(types.Node{
+			MachineKey:     key.NewMachine().Public(),
+			NodeKey:        key.NewNode().Public(),
+			Hostname:       "node",
+			UserID:         user.ID,
+			User:           *user,
+			Ephemeral:      ephemeral,
+			RegisterMethod: util.RegisterMethodCLI,
+		}, nil, nil)
+
+		return err
+	}
+
+	require.NoError(t, register(true))
+	require.NoError(t, register(false))
+	require.ErrorIs(t, register(true), ErrQuotaExceeded)
+
+	usage, err := hsdb.GetQuotaUsage(types.UserID(user.ID))
+	require.NoError(t, err)
+	assert.Equal(t, types.QuotaUsage{Nodes: 2, EphemeralNodes: 1}, usage)
+}
+
+func TestPreAuthKeyQuota(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	hsdb.SetDefaultQuota(types.Quota{MaxPreAuthKeys: 1})
+
+	user, err := hsdb.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	pak, err := hsdb.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, nil)
+	require.NoError(t, err)
+
+	_, err = hsdb.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, nil)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// Expired keys are not counted.
+	require.NoError(t, hsdb.ExpirePreAuthKey(pak))
+
+	_, err = hsdb.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, nil)
+	require.NoError(t, err)
+}
+
+func TestRouteQuota(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	quota := types.Quota{MaxRoutes: 2}
+
+	_, node := createUserWithNode(t, hsdb, "alice")
+
+	exit := []netip.Prefix{tsaddr.AllIPv4(), tsaddr.AllIPv6()}
+	subnet := netip.MustParsePrefix("10.0.0.0/24")
+	other := netip.MustParsePrefix("10.0.1.0/24")
+
+	err = hsdb.Write(func(tx *gorm.DB) error {
+		// An exit node counts as one route.
+		routes := append([]netip.Prefix{subnet}, exit...)
+		if err := CheckRouteQuota(tx, node.ID, routes, quota); err != nil {
+			return err
+		}
+
+		return SetApprovedRoutes(tx, node.ID, routes)
+	})
+	require.NoError(t, err)
+
+	err = hsdb.Read(func(rx *gorm.DB) error {
+		return CheckRouteQuota(rx, node.ID, []netip.Prefix{subnet, other, tsaddr.AllIPv4(), tsaddr.AllIPv6()}, quota)
+	})
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// Removing routes is allowed.
+	err = hsdb.Read(func(rx *gorm.DB) error {
+		return CheckRouteQuota(rx, node.ID, []netip.Prefix{other}, quota)
+	})
+	require.NoError(t, err)
+}
+
+func TestRouteQuotaOnRegistration(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	hsdb.SetDefaultQuota(types.Quota{MaxRoutes: 1})
+
+	user, err := hsdb.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "router",
+		UserID:         user.ID,
+		User:           *user,
+		RegisterMethod: util.RegisterMethodAuthKey,
+		ApprovedRoutes: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/24"),
+			netip.MustParsePrefix("10.0.1.0/24"),
+		},
+	}
+
+	// Routes approved by a pre auth key count against the quota.
+	_, err = hsdb.RegisterNode(node, nil, nil)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	node.ApprovedRoutes = node.ApprovedRoutes[:1]
+	_, err = hsdb.RegisterNode(node, nil, nil)
+	require.NoError(t, err)
+
+	// The node registering again with the same routes is not counted.
+	_, err = hsdb.RegisterNode(node, nil, nil)
+	require.NoError(t, err)
+}
+
+func TestTransferQuota(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	hsdb.SetDefaultQuota(types.Quota{MaxNodes: 1})
+
+	alice, _ := createUserWithNode(t, hsdb, "alice")
+	bob, _ := createUserWithNode(t, hsdb, "bob")
+
+	_, err = hsdb.MergeUsers(types.UserID(alice.ID), types.UserID(bob.ID))
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	_, err = hsdb.DestroyUserWithOptions(types.UserID(alice.ID), DestroyUserOptions{
+		TransferTo: types.UserID(bob.ID),
+	})
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	_, err = hsdb.SetUserQuota(types.UserID(bob.ID), types.UserQuota{MaxNodes: ptr.To(2)})
+	require.NoError(t, err)
+
+	_, err = hsdb.MergeUsers(types.UserID(alice.ID), types.UserID(bob.ID))
+	require.NoError(t, err)
+}
+
+func TestNodeQuotaRejectsPendingRegistration(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+	hsdb.SetDefaultQuota(types.Quota{MaxNodes: 1})
+
+	user, _ := createUserWithNode(t, hsdb, "alice")
+
+	id := newPendingRegistration(t, hsdb, "phone")
+	_, _, err = hsdb.HandleNodeFromAuthPath(id, types.UserID(user.ID), nil, util.RegisterMethodCLI, nil, nil)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	_, err = hsdb.WaitForRegistration(context.Background(), id)
+	require.ErrorIs(t, err, ErrRegistrationRejected)
+
+	var rejected RegistrationRejectedError
+	require.ErrorAs(t, err, &rejected)
+	assert.Equal(t, `user "alice" has reached its limit of 1 nodes`, rejected.Reason)
+}
+
+func TestSetUserQuotaInvalid(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	user, err := hsdb.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	_, err = hsdb.SetUserQuota(types.UserID(user.ID), types.UserQuota{MaxRoutes: ptr.To(-1)})
+	require.ErrorIs(t, err, ErrInvalidQuota)
+
+	updated, err := hsdb.SetUserQuota(types.UserID(user.ID), types.UserQuota{MaxRoutes: ptr.To(3)})
+	require.NoError(t, err)
+	assert.Equal(t, 3, hsdb.UserQuota(updated).MaxRoutes)
+
+	got, err := hsdb.GetUserByID(types.UserID(user.ID))
+	require.NoError(t, err)
+	assert.Equal(t, ptr.To(3), got.Quota.MaxRoutes)
+	assert.Nil(t, got.Quota.MaxNodes)
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+)
+
+const (
+	// PendingRegistrationExpiration is how long a node waits for an
+	// interactive login, and an OIDC login for its callback.
+	PendingRegistrationExpiration = 15 * time.Minute
+
+	// registrationPollInterval is how often a client waiting for its
+	// registration checks it, in case a notification was missed.
+	registrationPollInterval = 5 * time.Second
+
+	registrationChannel = "headscale_registration"
+)
+
+var (
+	ErrRegistrationRejected = errors.New("registration rejected")
+	ErrOIDCLoginNotFound    = errors.New("OIDC login not found")
+)
+
+// RegistrationRejectedError is returned by WaitForRegistration when the
+// registration is rejected for a reason the client is told about.
+type RegistrationRejectedError struct {
+	Reason string
+}
+
+func (e RegistrationRejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrRegistrationRejected, e.Reason)
+}
+
+func (e RegistrationRejectedError) Is(target error) bool {
+	return target == ErrRegistrationRejected
+}
+
+// CreatePendingRegistration stores a node waiting for an interactive login.
+func (hsdb *HSDatabase) CreatePendingRegistration(id types.RegistrationID, node types.Node) error {
+	reg := types.PendingRegistration{
+		ID:         id,
+		Node:       node,
+		Expiration: time.Now().Add(PendingRegistrationExpiration),
+	}
+
+	if err := hsdb.DB.Create(&reg).Error; err != nil {
+		return fmt.Errorf("creating pending registration: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingRegistration returns a registration still waiting for a login.
+func GetPendingRegistration(tx *gorm.DB, id types.RegistrationID) (*types.PendingRegistration, error) {
+	var reg types.PendingRegistration
+	if err := tx.First(&reg, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFoundRegistrationCache
+		}
+
+		return nil, err
+	}
+
+	if !reg.IsOpen() {
+		return nil, ErrNodeNotFoundRegistrationCache
+	}
+
+	return &reg, nil
+}
+
+func (hsdb *HSDatabase) GetPendingRegistration(id types.RegistrationID) (*types.PendingRegistration, error) {
+	return GetPendingRegistration(hsdb.DB, id)
+}
+
+// ListPendingRegistrations returns the registrations waiting for a login.
+func (hsdb *HSDatabase) ListPendingRegistrations() ([]types.PendingRegistration, error) {
+	var regs []types.PendingRegistration
+	err := hsdb.DB.
+		Where("registered_node_id IS NULL AND rejected = ? AND expiration > ?", false, time.Now()).
+		Order("created_at").
+		Find(&regs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return regs, nil
+}
+
+// SavePendingRegistrationNode replaces the node of a registration waiting
+// for a login, e.g. to change its hostname or tags before it is approved.
+func (hsdb *HSDatabase) SavePendingRegistrationNode(id types.RegistrationID, node types.Node) error {
+	return hsdb.Write(func(tx *gorm.DB) error {
+		reg, err := GetPendingRegistration(tx, id)
+		if err != nil {
+			return err
+		}
+
+		reg.Node = node
+
+		return tx.Save(reg).Error
+	})
+}
+
+// RejectPendingRegistration ends a registration waiting for a login, and
+// lets the client waiting for it know, with the reason if it is set.
+func (hsdb *HSDatabase) RejectPendingRegistration(id types.RegistrationID, reason string) error {
+	err := hsdb.Write(func(tx *gorm.DB) error {
+		if _, err := GetPendingRegistration(tx, id); err != nil {
+			return err
+		}
+
+		return tx.Model(&types.PendingRegistration{}).Where("id = ?", id).Updates(map[string]any{
+			"rejected":      true,
+			"reject_reason": reason,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	hsdb.notify(registrationChannel, id.String())
+
+	return nil
+}
+
+// completePendingRegistration records the node registered for the
+// registration, for the client waiting for it.
+func completePendingRegistration(tx *gorm.DB, id types.RegistrationID, nodeID types.NodeID) error {
+	return tx.Model(&types.PendingRegistration{}).
+		Where("id = ?", id).
+		Update("registered_node_id", nodeID.Uint64()).Error
+}
+
+// WaitForRegistration waits until the registration is completed, on this or
+// another headscale instance, and returns the registered node.
+// It fails with ErrRegistrationRejected if the registration is rejected, and
+// ErrNodeNotFoundRegistrationCache if it is unknown or expired.
+func (hsdb *HSDatabase) WaitForRegistration(ctx context.Context, id types.RegistrationID) (*types.Node, error) {
+	notified, stop := hsdb.listener.wait(registrationChannel, id.String())
+	defer stop()
+
+	ticker := time.NewTicker(registrationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var reg types.PendingRegistration
+		if err := hsdb.DB.First(&reg, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrNodeNotFoundRegistrationCache
+			}
+
+			return nil, err
+		}
+
+		switch {
+		case reg.RegisteredNodeID != nil:
+			return hsdb.GetNodeByID(types.NodeID(*reg.RegisteredNodeID))
+		case reg.Rejected && reg.RejectReason != "":
+			return nil, RegistrationRejectedError{Reason: reg.RejectReason}
+		case reg.Rejected:
+			return nil, ErrRegistrationRejected
+		case !reg.IsOpen():
+			return nil, ErrNodeNotFoundRegistrationCache
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-notified:
+		case <-ticker.C:
+		}
+	}
+}
+
+// CreateOIDCLogin stores an OIDC login waiting for its callback.
+func (hsdb *HSDatabase) CreateOIDCLogin(login types.OIDCLogin) error {
+	login.Expiration = time.Now().Add(PendingRegistrationExpiration)
+
+	if err := hsdb.DB.Create(&login).Error; err != nil {
+		return fmt.Errorf("creating OIDC login: %w", err)
+	}
+
+	return nil
+}
+
+// GetOIDCLogin returns the OIDC login started with state.
+func (hsdb *HSDatabase) GetOIDCLogin(state string) (*types.OIDCLogin, error) {
+	var login types.OIDCLogin
+	err := hsdb.DB.First(&login, "state = ? AND expiration > ?", state, time.Now()).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOIDCLoginNotFound
+		}
+
+		return nil, err
+	}
+
+	return &login, nil
+}
+
+func (hsdb *HSDatabase) DeleteOIDCLogin(state string) error {
+	return hsdb.DB.Delete(&types.OIDCLogin{}, "state = ?", state).Error
+}
+
+// DeleteExpiredRegistrations removes the pending registrations and OIDC
+// logins which have expired.
+func (hsdb *HSDatabase) DeleteExpiredRegistrations() error {
+	return hsdb.Write(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		if err := tx.Where("expiration < ?", now).Delete(&types.PendingRegistration{}).Error; err != nil {
+			return fmt.Errorf("deleting expired pending registrations: %w", err)
+		}
+
+		if err := tx.Where("expiration < ?", now).Delete(&types.OIDCLogin{}).Error; err != nil {
+			return fmt.Errorf("deleting expired OIDC logins: %w", err)
+		}
+
+		return nil
+	})
+}
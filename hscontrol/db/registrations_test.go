@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+func newPendingRegistration(t *testing.T, db *HSDatabase, hostname string) types.RegistrationID {
+	t.Helper()
+
+	id, err := types.NewRegistrationID()
+	require.NoError(t, err)
+
+	err = db.CreatePendingRegistration(id, types.Node{
+		Hostname:   hostname,
+		MachineKey: key.NewMachine().Public(),
+		NodeKey:    key.NewNode().Public(),
+		Hostinfo:   &tailcfg.Hostinfo{Hostname: hostname},
+	})
+	require.NoError(t, err)
+
+	return id
+}
+
+func TestPendingRegistrationCompleted(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	user, err := db.CreateUser(types.User{Name: "test"})
+	require.NoError(t, err)
+
+	id := newPendingRegistration(t, db, "laptop")
+
+	regs, err := db.ListPendingRegistrations()
+	require.NoError(t, err)
+	require.Len(t, regs, 1)
+	assert.Equal(t, id, regs[0].ID)
+	assert.Equal(t, "laptop", regs[0].Node.Hostname)
+
+	type result struct {
+		node *types.Node
+		err  error
+	}
+	waited := make(chan result, 1)
+	go func() {
+		node, err := db.WaitForRegistration(context.Background(), id)
+		waited <- result{node, err}
+	}()
+
+	node, newNode, err := db.HandleNodeFromAuthPath(id, types.UserID(user.ID), nil, util.RegisterMethodCLI, nil, nil)
+	require.NoError(t, err)
+	assert.True(t, newNode)
+
+	select {
+	case res := <-waited:
+		require.NoError(t, res.err)
+		assert.Equal(t, node.ID, res.node.ID)
+	case <-time.After(registrationPollInterval / 2):
+		t.Fatal("waiting client not woken up by the notification")
+	}
+
+	regs, err = db.ListPendingRegistrations()
+	require.NoError(t, err)
+	assert.Empty(t, regs)
+
+	_, _, err = db.HandleNodeFromAuthPath(id, types.UserID(user.ID), nil, util.RegisterMethodCLI, nil, nil)
+	require.ErrorIs(t, err, ErrNodeNotFoundRegistrationCache)
+}
+
+func TestPendingRegistrationRejected(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	id := newPendingRegistration(t, db, "laptop")
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := db.WaitForRegistration(context.Background(), id)
+		waited <- err
+	}()
+
+	require.NoError(t, db.RejectPendingRegistration(id, ""))
+
+	select {
+	case err := <-waited:
+		require.ErrorIs(t, err, ErrRegistrationRejected)
+	case <-time.After(registrationPollInterval / 2):
+		t.Fatal("waiting client not woken up by the notification")
+	}
+
+	require.ErrorIs(t, db.RejectPendingRegistration(id, ""), ErrNodeNotFoundRegistrationCache)
+}
+
+func TestPendingRegistrationExpired(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	id := newPendingRegistration(t, db, "laptop")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = db.WaitForRegistration(ctx, id)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	err = db.DB.Model(&types.PendingRegistration{}).
+		Where("id = ?", id).
+		Update("expiration", time.Now().Add(-time.Minute)).Error
+	require.NoError(t, err)
+
+	_, err = db.GetPendingRegistration(id)
+	require.ErrorIs(t, err, ErrNodeNotFoundRegistrationCache)
+
+	_, err = db.WaitForRegistration(context.Background(), id)
+	require.ErrorIs(t, err, ErrNodeNotFoundRegistrationCache)
+
+	require.NoError(t, db.CreateOIDCLogin(types.OIDCLogin{State: "state", RegistrationID: id}))
+	require.NoError(t, db.DeleteExpiredRegistrations())
+
+	_, err = db.WaitForRegistration(context.Background(), id)
+	require.ErrorIs(t, err, ErrNodeNotFoundRegistrationCache)
+
+	login, err := db.GetOIDCLogin("state")
+	require.NoError(t, err)
+	assert.Equal(t, id, login.RegistrationID)
+
+	require.NoError(t, db.DeleteOIDCLogin("state"))
+	_, err = db.GetOIDCLogin("state")
+	require.ErrorIs(t, err, ErrOIDCLoginNotFound)
+}
@@ -66,7 +66,6 @@ func newSQLiteTestDB() (*HSDatabase, error) {
 			},
 		},
 		"",
-		emptyCache(),
 	)
 	if err != nil {
 		return nil, err
@@ -120,7 +119,6 @@ func newHeadscaleDBFromPostgresURL(t *testing.T, pu *url.URL) *HSDatabase {
 			},
 		},
 		"",
-		emptyCache(),
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+)
+
+// CreateUserLink records that an identity was linked to a user.
+func CreateUserLink(tx *gorm.DB, link types.UserLink) error {
+	if err := tx.Create(&link).Error; err != nil {
+		return fmt.Errorf("recording user link: %w", err)
+	}
+
+	return nil
+}
+
+// LinkUser saves the user, which was linked to another identity, and
+// records the link.
+func (hsdb *HSDatabase) LinkUser(user *types.User, link types.UserLink) error {
+	return hsdb.Write(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+
+		return CreateUserLink(tx, link)
+	})
+}
+
+func (hsdb *HSDatabase) ListUserLinks(uid types.UserID) ([]types.UserLink, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) ([]types.UserLink, error) {
+		return ListUserLinks(rx, uid)
+	})
+}
+
+// ListUserLinks returns the identities linked to the user, or to all users
+// when uid is zero, oldest first.
+func ListUserLinks(tx *gorm.DB, uid types.UserID) ([]types.UserLink, error) {
+	query := tx.Order("id")
+	if uid != 0 {
+		query = query.Where("user_id = ?", uid)
+	}
+
+	var links []types.UserLink
+	if err := query.Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("listing user links: %w", err)
+	}
+
+	return links, nil
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/types/key"
+)
+
+func TestMergeUsers(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	from, err := hsdb.CreateUser(types.User{Name: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+	into, err := hsdb.CreateUser(types.User{
+		Name:               "alice-oidc",
+		Email:              "alice@example.com",
+		Provider:           util.RegisterMethodOIDC,
+		ProviderIdentifier: sql.NullString{String: "https://idp.example.com/alice", Valid: true},
+	})
+	require.NoError(t, err)
+
+	pak, err := hsdb.CreatePreAuthKey(types.UserID(from.ID), true, false, nil, nil)
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "laptop",
+		GivenName:      "laptop",
+		UserID:         from.ID,
+		RegisterMethod: util.RegisterMethodCLI,
+	}
+	require.NoError(t, hsdb.DB.Save(&node).Error)
+
+	merged, err := hsdb.MergeUsers(types.UserID(from.ID), types.UserID(into.ID))
+	require.NoError(t, err)
+	assert.Equal(t, into.ID, merged.ID)
+	assert.Equal(t, "https://idp.example.com/alice", merged.ProviderIdentifier.String)
+
+	_, err = hsdb.GetUserByID(types.UserID(from.ID))
+	require.ErrorIs(t, err, ErrUserNotFound)
+
+	got, err := hsdb.GetNodeByID(node.ID)
+	require.NoError(t, err)
+	assert.Equal(t, into.ID, got.UserID)
+
+	keys, err := hsdb.ListPreAuthKeys(types.UserID(into.ID))
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, pak.ID, keys[0].ID)
+
+	links, err := hsdb.ListUserLinks(types.UserID(into.ID))
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, types.UserLinkMerge, links[0].Kind)
+	assert.Equal(t, "alice (1)", links[0].Source)
+	assert.Equal(t, "alice@example.com", links[0].Email)
+}
+
+func TestMergeUsersMovesOIDCIdentity(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	from, err := hsdb.CreateUser(types.User{
+		Name:               "alice-oidc",
+		Email:              "alice@example.com",
+		DisplayName:        "Alice",
+		Provider:           util.RegisterMethodOIDC,
+		ProviderIdentifier: sql.NullString{String: "https://idp.example.com/alice", Valid: true},
+	})
+	require.NoError(t, err)
+	into, err := hsdb.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	merged, err := hsdb.MergeUsers(types.UserID(from.ID), types.UserID(into.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", merged.Name)
+	assert.Equal(t, "Alice", merged.DisplayName)
+	assert.Equal(t, "alice@example.com", merged.Email)
+	assert.Equal(t, util.RegisterMethodOIDC, merged.Provider)
+
+	// The next login with the identity finds the user it was merged into.
+	user, err := hsdb.GetUserByOIDCIdentifier("https://idp.example.com/alice")
+	require.NoError(t, err)
+	assert.Equal(t, into.ID, user.ID)
+}
+
+func TestMergeUsersErrors(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	alice, err := hsdb.CreateUser(types.User{
+		Name:               "alice",
+		ProviderIdentifier: sql.NullString{String: "https://idp.example.com/alice", Valid: true},
+	})
+	require.NoError(t, err)
+	bob, err := hsdb.CreateUser(types.User{
+		Name:               "bob",
+		ProviderIdentifier: sql.NullString{String: "https://idp.example.com/bob", Valid: true},
+	})
+	require.NoError(t, err)
+
+	_, err = hsdb.MergeUsers(types.UserID(alice.ID), types.UserID(alice.ID))
+	require.ErrorIs(t, err, ErrUserMergeSelf)
+
+	_, err = hsdb.MergeUsers(types.UserID(alice.ID), 9999)
+	require.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = hsdb.MergeUsers(types.UserID(alice.ID), types.UserID(bob.ID))
+	require.ErrorIs(t, err, ErrUserMergeOIDC)
+
+	users, err := hsdb.ListUsers()
+	require.NoError(t, err)
+	assert.Len(t, users, 2)
+}
+
+func TestGetLocalUserByEmail(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	alice, err := hsdb.CreateUser(types.User{Name: "alice", Email: "Alice@example.com"})
+	require.NoError(t, err)
+	_, err = hsdb.CreateUser(types.User{
+		Name:               "bob",
+		Email:              "bob@example.com",
+		ProviderIdentifier: sql.NullString{String: "https://idp.example.com/bob", Valid: true},
+	})
+	require.NoError(t, err)
+	_, err = hsdb.CreateUser(types.User{Name: "carol1", Email: "carol@example.com"})
+	require.NoError(t, err)
+	_, err = hsdb.CreateUser(types.User{Name: "carol2", Email: "carol@example.com"})
+	require.NoError(t, err)
+
+	user, err := hsdb.GetLocalUserByEmail("alice@EXAMPLE.com")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, user.ID)
+
+	// Users with an OIDC identity are not linked again.
+	_, err = hsdb.GetLocalUserByEmail("bob@example.com")
+	require.ErrorIs(t, err, ErrUserNotFound)
+
+	// The user is ambiguous.
+	_, err = hsdb.GetLocalUserByEmail("carol@example.com")
+	require.ErrorIs(t, err, ErrUserNotFound)
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
@@ -13,6 +15,11 @@ var (
 	ErrUserExists        = errors.New("user already exists")
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserStillHasNodes = errors.New("user not empty: node(s) found")
+	ErrUserMergeSelf     = errors.New("cannot merge a user into itself")
+	ErrUserMergeOIDC     = errors.New("cannot merge two users with an OIDC identity")
+	ErrUserDisabled      = errors.New("user is disabled")
+
+	ErrInvalidDestroyUser = errors.New("invalid options to destroy user")
 )
 
 func (hsdb *HSDatabase) CreateUser(user types.User) (*types.User, error) {
@@ -109,6 +116,282 @@ func RenameUser(tx *gorm.DB, uid types.UserID, newName string) error {
 	return nil
 }
 
+func (hsdb *HSDatabase) MergeUsers(from, into types.UserID) (*types.User, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) (*types.User, error) {
+		if err := checkTransferQuota(tx, from, into, hsdb.quota); err != nil {
+			return nil, err
+		}
+
+		return MergeUsers(tx, from, into)
+	})
+}
+
+// MergeUsers moves the nodes and pre auth keys of the user from to the user
+// into, and deletes from. If only from has an OIDC identity, the identity
+// moves to into, so that its OIDC logins use into. The merge is recorded as
+// a UserLink.
+func MergeUsers(tx *gorm.DB, from, into types.UserID) (*types.User, error) {
+	if from == into {
+		return nil, ErrUserMergeSelf
+	}
+
+	src, err := GetUserByID(tx, from)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := GetUserByID(tx, into)
+	if err != nil {
+		return nil, err
+	}
+
+	// The identity of from would be lost, and its next login would
+	// create the user again.
+	if src.ProviderIdentifier.Valid && dst.ProviderIdentifier.Valid {
+		return nil, ErrUserMergeOIDC
+	}
+
+	if err := moveUserResources(tx, src.ID, dst.ID); err != nil {
+		return nil, err
+	}
+
+	// from is deleted before its identity moves, the identifier is
+	// unique.
+	if err := tx.Unscoped().Delete(src).Error; err != nil {
+		return nil, fmt.Errorf("deleting merged user: %w", err)
+	}
+
+	if src.ProviderIdentifier.Valid {
+		dst.ProviderIdentifier = src.ProviderIdentifier
+		dst.Provider = src.Provider
+		dst.Email = cmp.Or(dst.Email, src.Email)
+		dst.DisplayName = cmp.Or(dst.DisplayName, src.DisplayName)
+		dst.ProfilePicURL = cmp.Or(dst.ProfilePicURL, src.ProfilePicURL)
+
+		if err := tx.Save(dst).Error; err != nil {
+			return nil, fmt.Errorf("moving OIDC identity: %w", err)
+		}
+	}
+
+	err = CreateUserLink(tx, types.UserLink{
+		UserID: dst.ID,
+		Kind:   types.UserLinkMerge,
+		Source: fmt.Sprintf("%s (%d)", src.Name, src.ID),
+		Email:  src.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// moveUserResources moves the nodes and pre auth keys of the user from to
+// the user to.
+func moveUserResources(tx *gorm.DB, from, to uint) error {
+	if err := tx.Model(&types.Node{}).Where("user_id = ?", from).Update("user_id", to).Error; err != nil {
+		return fmt.Errorf("moving nodes: %w", err)
+	}
+
+	if err := tx.Model(&types.PreAuthKey{}).Where("user_id = ?", from).Update("user_id", to).Error; err != nil {
+		return fmt.Errorf("moving pre auth keys: %w", err)
+	}
+
+	return nil
+}
+
+// DestroyUserOptions tells DestroyUserWithOptions what to do with the
+// nodes of the user. Without options, a user with nodes is not destroyed.
+type DestroyUserOptions struct {
+	// TransferTo moves the nodes and pre auth keys of the user to
+	// another user.
+	TransferTo types.UserID
+
+	// DeleteNodes deletes the nodes of the user.
+	DeleteNodes bool
+
+	// ExpireNodes expires the nodes moved with TransferTo, so that they
+	// have to log in again.
+	ExpireNodes bool
+}
+
+func (o DestroyUserOptions) validate(uid types.UserID) error {
+	switch {
+	case o.TransferTo != 0 && o.DeleteNodes:
+		return fmt.Errorf("%w: nodes cannot be both transferred and deleted", ErrInvalidDestroyUser)
+	case o.ExpireNodes && o.TransferTo == 0:
+		return fmt.Errorf("%w: only transferred nodes can be expired, the nodes of a deleted user are deleted", ErrInvalidDestroyUser)
+	case o.TransferTo == uid:
+		return fmt.Errorf("%w: cannot transfer nodes to the user being deleted", ErrInvalidDestroyUser)
+	}
+
+	return nil
+}
+
+func (hsdb *HSDatabase) DestroyUserWithOptions(uid types.UserID, opts DestroyUserOptions) (types.Nodes, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) (types.Nodes, error) {
+		if opts.TransferTo != 0 {
+			if err := checkTransferQuota(tx, uid, opts.TransferTo, hsdb.quota); err != nil {
+				return nil, err
+			}
+		}
+
+		return DestroyUserWithOptions(tx, uid, opts)
+	})
+}
+
+// DestroyUserWithOptions destroys a User after transferring or deleting its
+// nodes as set in opts. It returns the nodes that were transferred or
+// deleted, as they were before.
+func DestroyUserWithOptions(tx *gorm.DB, uid types.UserID, opts DestroyUserOptions) (types.Nodes, error) {
+	if err := opts.validate(uid); err != nil {
+		return nil, err
+	}
+
+	user, err := GetUserByID(tx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := ListNodesByUser(tx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.TransferTo != 0:
+		target, err := GetUserByID(tx, opts.TransferTo)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := moveUserResources(tx, user.ID, target.ID); err != nil {
+			return nil, err
+		}
+
+		if opts.ExpireNodes {
+			now := time.Now()
+			for _, node := range nodes {
+				if err := NodeSetExpiry(tx, node.ID, now); err != nil {
+					return nil, fmt.Errorf("expiring node %d: %w", node.ID, err)
+				}
+			}
+		}
+
+	case opts.DeleteNodes:
+		for _, node := range nodes {
+			if err := DeleteNode(tx, node); err != nil {
+				return nil, fmt.Errorf("deleting node %d: %w", node.ID, err)
+			}
+		}
+	}
+
+	if err := DestroyUser(tx, uid); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+func (hsdb *HSDatabase) DisableUser(uid types.UserID) (*types.User, types.Nodes, error) {
+	var nodes types.Nodes
+	user, err := Write(hsdb.DB, func(tx *gorm.DB) (*types.User, error) {
+		var (
+			user *types.User
+			err  error
+		)
+		user, nodes, err = DisableUser(tx, uid)
+
+		return user, err
+	})
+
+	return user, nodes, err
+}
+
+// DisableUser disables a User and expires its nodes that have not expired
+// yet. A disabled user keeps its nodes and history, but cannot log in or
+// register nodes. It returns the nodes it expired.
+func DisableUser(tx *gorm.DB, uid types.UserID) (*types.User, types.Nodes, error) {
+	user, err := GetUserByID(tx, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if user.DisabledAt == nil {
+		user.DisabledAt = &now
+		if err := tx.Model(user).Update("disabled_at", now).Error; err != nil {
+			return nil, nil, fmt.Errorf("disabling user: %w", err)
+		}
+	}
+
+	nodes, err := ListNodesByUser(tx, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var expired types.Nodes
+	for _, node := range nodes {
+		if node.IsExpired() {
+			continue
+		}
+
+		if err := NodeSetExpiry(tx, node.ID, now); err != nil {
+			return nil, nil, fmt.Errorf("expiring node %d: %w", node.ID, err)
+		}
+		node.Expiry = &now
+		expired = append(expired, node)
+	}
+
+	return user, expired, nil
+}
+
+func (hsdb *HSDatabase) EnableUser(uid types.UserID) (*types.User, error) {
+	return Write(hsdb.DB, func(tx *gorm.DB) (*types.User, error) {
+		return EnableUser(tx, uid)
+	})
+}
+
+// EnableUser enables a disabled User. Its nodes stay expired until they log
+// in again.
+func EnableUser(tx *gorm.DB, uid types.UserID) (*types.User, error) {
+	user, err := GetUserByID(tx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	user.DisabledAt = nil
+	if err := tx.Model(user).Update("disabled_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("enabling user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (hsdb *HSDatabase) GetLocalUserByEmail(email string) (*types.User, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) (*types.User, error) {
+		return GetLocalUserByEmail(rx, email)
+	})
+}
+
+// GetLocalUserByEmail returns the user without OIDC identity with the given
+// email, compared case-insensitively. ErrUserNotFound is returned when no
+// user or several users have the email.
+func GetLocalUserByEmail(tx *gorm.DB, email string) (*types.User, error) {
+	var users []types.User
+	err := tx.Where("(provider_identifier IS NULL OR provider_identifier = '') AND LOWER(email) = LOWER(?)", email).
+		Limit(2).
+		Find(&users).Error
+	if err != nil {
+		return nil, fmt.Errorf("finding user by email: %w", err)
+	}
+
+	if len(users) != 1 {
+		return nil, ErrUserNotFound
+	}
+
+	return &users[0], nil
+}
+
 func (hsdb *HSDatabase) GetUserByID(uid types.UserID) (*types.User, error) {
 	return Read(hsdb.DB, func(rx *gorm.DB) (*types.User, error) {
 		return GetUserByID(rx, uid)
@@ -2,11 +2,15 @@ package db
 
 import (
 	"strings"
+	"testing"
 
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/check.v1"
 	"gorm.io/gorm"
+	"tailscale.com/types/key"
 	"tailscale.com/types/ptr"
 )
 
@@ -39,7 +43,7 @@ func (s *Suite) TestDestroyUserErrors(c *check.C) {
 	err = db.DestroyUser(types.UserID(user.ID))
 	c.Assert(err, check.IsNil)
 
-	result := db.DB.Preload("User").First(&pak, "key = ?", pak.Key)
+	result := db.DB.Preload("User").First(&pak, "prefix = ?", pak.Prefix)
 	// destroying a user also deletes all associated preauthkeys
 	c.Assert(result.Error, check.Equals, gorm.ErrRecordNotFound)
 
@@ -131,3 +135,145 @@ func (s *Suite) TestSetMachineUser(c *check.C) {
 	c.Assert(node.UserID, check.Equals, newUser.ID)
 	c.Assert(node.User.Name, check.Equals, newUser.Name)
 }
+
+func createUserWithNode(t *testing.T, hsdb *HSDatabase, name string) (*types.User, *types.Node) {
+	t.Helper()
+
+	user, err := hsdb.CreateUser(types.User{Name: name})
+	require.NoError(t, err)
+
+	_, err = hsdb.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, nil)
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       name + "-laptop",
+		GivenName:      name + "-laptop",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodCLI,
+	}
+	require.NoError(t, hsdb.DB.Save(&node).Error)
+
+	return user, &node
+}
+
+func TestDestroyUserWithOptions(t *testing.T) {
+	t.Run("transfer", func(t *testing.T) {
+		hsdb, err := newSQLiteTestDB()
+		require.NoError(t, err)
+
+		from, node := createUserWithNode(t, hsdb, "alice")
+		to, err := hsdb.CreateUser(types.User{Name: "bob"})
+		require.NoError(t, err)
+
+		nodes, err := hsdb.DestroyUserWithOptions(types.UserID(from.ID), DestroyUserOptions{
+			TransferTo:  types.UserID(to.ID),
+			ExpireNodes: true,
+		})
+		require.NoError(t, err)
+		require.Len(t, nodes, 1)
+
+		_, err = hsdb.GetUserByID(types.UserID(from.ID))
+		require.ErrorIs(t, err, ErrUserNotFound)
+
+		got, err := hsdb.GetNodeByID(node.ID)
+		require.NoError(t, err)
+		assert.Equal(t, to.ID, got.UserID)
+		assert.True(t, got.IsExpired())
+
+		keys, err := hsdb.ListPreAuthKeys(types.UserID(to.ID))
+		require.NoError(t, err)
+		assert.Len(t, keys, 1)
+	})
+
+	t.Run("delete-nodes", func(t *testing.T) {
+		hsdb, err := newSQLiteTestDB()
+		require.NoError(t, err)
+
+		user, node := createUserWithNode(t, hsdb, "alice")
+
+		nodes, err := hsdb.DestroyUserWithOptions(types.UserID(user.ID), DestroyUserOptions{
+			DeleteNodes: true,
+		})
+		require.NoError(t, err)
+		require.Len(t, nodes, 1)
+		assert.Equal(t, node.ID, nodes[0].ID)
+
+		_, err = hsdb.GetNodeByID(node.ID)
+		require.Error(t, err)
+
+		_, err = hsdb.GetUserByID(types.UserID(user.ID))
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		hsdb, err := newSQLiteTestDB()
+		require.NoError(t, err)
+
+		user, node := createUserWithNode(t, hsdb, "alice")
+		other, err := hsdb.CreateUser(types.User{Name: "bob"})
+		require.NoError(t, err)
+
+		_, err = hsdb.DestroyUserWithOptions(types.UserID(user.ID), DestroyUserOptions{})
+		require.ErrorIs(t, err, ErrUserStillHasNodes)
+
+		_, err = hsdb.DestroyUserWithOptions(types.UserID(user.ID), DestroyUserOptions{
+			TransferTo:  types.UserID(other.ID),
+			DeleteNodes: true,
+		})
+		require.ErrorIs(t, err, ErrInvalidDestroyUser)
+
+		_, err = hsdb.DestroyUserWithOptions(types.UserID(user.ID), DestroyUserOptions{
+			ExpireNodes: true,
+		})
+		require.ErrorIs(t, err, ErrInvalidDestroyUser)
+
+		_, err = hsdb.DestroyUserWithOptions(types.UserID(user.ID), DestroyUserOptions{
+			TransferTo: types.UserID(user.ID),
+		})
+		require.ErrorIs(t, err, ErrInvalidDestroyUser)
+
+		_, err = hsdb.DestroyUserWithOptions(types.UserID(user.ID), DestroyUserOptions{
+			TransferTo: 9999,
+		})
+		require.ErrorIs(t, err, ErrUserNotFound)
+
+		// Nothing changed after the failed attempts.
+		got, err := hsdb.GetNodeByID(node.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, got.UserID)
+	})
+}
+
+func TestDisableUser(t *testing.T) {
+	hsdb, err := newSQLiteTestDB()
+	require.NoError(t, err)
+
+	user, node := createUserWithNode(t, hsdb, "alice")
+
+	disabled, expired, err := hsdb.DisableUser(types.UserID(user.ID))
+	require.NoError(t, err)
+	assert.True(t, disabled.IsDisabled())
+	require.Len(t, expired, 1)
+	assert.Equal(t, node.ID, expired[0].ID)
+
+	got, err := hsdb.GetNodeByID(node.ID)
+	require.NoError(t, err)
+	assert.True(t, got.IsExpired())
+	assert.True(t, got.User.IsDisabled())
+
+	// Disabling again does not expire the nodes again.
+	_, expired, err = hsdb.DisableUser(types.UserID(user.ID))
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	enabled, err := hsdb.EnableUser(types.UserID(user.ID))
+	require.NoError(t, err)
+	assert.False(t, enabled.IsDisabled())
+
+	got, err = hsdb.GetNodeByID(node.ID)
+	require.NoError(t, err)
+	assert.True(t, got.IsExpired())
+	assert.False(t, got.User.IsDisabled())
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/arl/statsviz"
 	"github.com/juanfont/headscale/hscontrol/types"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tsweb"
 )
@@ -19,6 +18,16 @@ func (h *Headscale) debugHTTPServer() *http.Server {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(h.nodeNotifier.String()))
 	}))
+	debug.Handle("notifier-lagging", "Poll sessions lagging behind on updates", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		laggingJSON, err := json.MarshalIndent(h.nodeNotifier.LaggingSessions(), "", "  ")
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(laggingJSON)
+	}))
 	debug.Handle("config", "Current configuration", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		config, err := json.MarshalIndent(h.cfg, "", "  ")
 		if err != nil {
@@ -52,11 +61,7 @@ func (h *Headscale) debugHTTPServer() *http.Server {
 		w.Write(filterJSON)
 	}))
 	debug.Handle("ssh", "SSH Policy per node", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		nodes, err := h.db.ListNodes()
-		if err != nil {
-			httpError(w, err)
-			return
-		}
+		nodes := h.nodeStore.ListNodes()
 
 		sshPol := make(map[string]*tailcfg.SSHPolicy)
 		for _, node := range nodes {
@@ -91,7 +96,12 @@ func (h *Headscale) debugHTTPServer() *http.Server {
 		w.Write(dmJSON)
 	}))
 	debug.Handle("registration-cache", "Pending registrations", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		registrationsJSON, err := json.MarshalIndent(h.registrationCache.Items(), "", "  ")
+		registrations, err := h.db.ListPendingRegistrations()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		registrationsJSON, err := json.MarshalIndent(registrations, "", "  ")
 		if err != nil {
 			httpError(w, err)
 			return
@@ -117,7 +127,7 @@ func (h *Headscale) debugHTTPServer() *http.Server {
 	}
 
 	debug.URL("/metrics", "Prometheus metrics")
-	debugMux.Handle("/metrics", promhttp.Handler())
+	debugMux.Handle("/metrics", h.MetricsHandler())
 
 	debugHTTPServer := &http.Server{
 		Addr:         h.cfg.MetricsAddr,
@@ -14,8 +14,8 @@ import (
 	"time"
 
 	"github.com/puzpuzpuz/xsync/v3"
-	"github.com/rs/zerolog/log"
 	"github.com/samber/lo"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -26,6 +26,7 @@ import (
 
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
 	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/nodefilter"
 	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/routes"
 	"github.com/juanfont/headscale/hscontrol/types"
@@ -43,6 +44,86 @@ func newHeadscaleV1APIServer(h *Headscale) v1.HeadscaleServiceServer {
 	}
 }
 
+// APIServer returns the implementation of the headscale gRPC API, without
+// authentication, for applications serving it in-process.
+func (h *Headscale) APIServer() v1.HeadscaleServiceServer {
+	return newHeadscaleV1APIServer(h)
+}
+
+// UnaryErrorInterceptor converts the errors returned by the API to gRPC
+// status errors with a matching code, so clients can tell missing and
+// conflicting resources apart from other failures.
+func UnaryErrorInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	resp, err := handler(ctx, req)
+
+	return resp, grpcStatusError(err)
+}
+
+func grpcStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, db.ErrUserNotFound),
+		errors.Is(err, db.ErrNodeNotFound),
+		errors.Is(err, db.ErrPreAuthKeyNotFound),
+		errors.Is(err, db.ErrOAuthClientNotFound),
+		errors.Is(err, db.ErrInviteNotFound),
+		errors.Is(err, types.ErrPolicyNotFound),
+		errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, db.ErrUserExists),
+		strings.Contains(err.Error(), "UNIQUE constraint failed"),
+		strings.Contains(err.Error(), "violates unique constraint"):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, db.ErrOAuthClientInvalidScope),
+		errors.Is(err, db.ErrOAuthClientTagInvalid),
+		errors.Is(err, types.ErrDNSRecordInvalid),
+		errors.Is(err, db.ErrUserMergeSelf),
+		errors.Is(err, db.ErrUserMergeOIDC),
+		errors.Is(err, db.ErrInvalidDestroyUser),
+		errors.Is(err, db.ErrInvalidQuota),
+		errors.Is(err, db.ErrInviteInvalid),
+		errors.Is(err, types.ErrNodeLabelInvalid),
+		errors.Is(err, nodefilter.ErrInvalidFilter),
+		errors.Is(err, nodefilter.ErrInvalidOrder),
+		errors.Is(err, nodefilter.ErrInvalidPageSize),
+		errors.Is(err, nodefilter.ErrInvalidPageToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, db.ErrUserStillHasNodes),
+		errors.Is(err, db.ErrUserDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrRegistrationDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	var quotaErr db.QuotaError
+	if errors.As(err, &quotaErr) {
+		return status.Error(codes.ResourceExhausted, quotaErr.Error())
+	}
+
+	return err
+}
+
+// lookupUser returns the user with the given ID if set, or by name.
+func (api headscaleV1APIServer) lookupUser(name string, id uint64) (*types.User, error) {
+	if id != 0 {
+		return api.h.db.GetUserByID(types.UserID(id))
+	}
+
+	return api.h.db.GetUserByName(name)
+}
+
 func (api headscaleV1APIServer) CreateUser(
 	ctx context.Context,
 	request *v1.CreateUserRequest,
@@ -58,7 +139,7 @@ func (api headscaleV1APIServer) CreateUser(
 		return nil, err
 	}
 
-	err = usersChangedHook(api.h.db, api.h.polMan, api.h.nodeNotifier)
+	err = usersChangedHook(api.h.db, api.h.nodeStore, api.h.polMan, api.h.nodeNotifier)
 	if err != nil {
 		return nil, fmt.Errorf("updating resources using user: %w", err)
 	}
@@ -80,6 +161,10 @@ func (api headscaleV1APIServer) RenameUser(
 		return nil, err
 	}
 
+	if err := api.h.nodeStore.Reload(); err != nil {
+		return nil, fmt.Errorf("reloading nodes: %w", err)
+	}
+
 	newUser, err := api.h.db.GetUserByName(request.GetNewName())
 	if err != nil {
 		return nil, err
@@ -97,19 +182,81 @@ func (api headscaleV1APIServer) DeleteUser(
 		return nil, err
 	}
 
-	err = api.h.db.DestroyUser(types.UserID(user.ID))
+	nodes, err := api.h.db.DestroyUserWithOptions(types.UserID(user.ID), db.DestroyUserOptions{
+		TransferTo:  types.UserID(request.GetTransferTo()),
+		DeleteNodes: request.GetDeleteNodes(),
+		ExpireNodes: request.GetExpireNodes(),
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	err = usersChangedHook(api.h.db, api.h.polMan, api.h.nodeNotifier)
+	// The hook reloads the node store, which drops the deleted nodes and
+	// picks up the new user of the transferred ones.
+	err = usersChangedHook(api.h.db, api.h.nodeStore, api.h.polMan, api.h.nodeNotifier)
 	if err != nil {
 		return nil, fmt.Errorf("updating resources using user: %w", err)
 	}
 
+	if len(nodes) > 0 {
+		ctx = types.NotifyCtx(ctx, "cli-deleteuser", user.Name)
+		if request.GetDeleteNodes() {
+			api.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerRemoved(nodes.IDs()...))
+
+			for _, node := range nodes {
+				api.h.hooks.nodeRemoved(node)
+			}
+		} else {
+			// The transferred nodes and their peers show the new user,
+			// and expired nodes have to log in again.
+			api.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+		}
+	}
+
 	return &v1.DeleteUserResponse{}, nil
 }
 
+func (api headscaleV1APIServer) DisableUser(
+	ctx context.Context,
+	request *v1.DisableUserRequest,
+) (*v1.DisableUserResponse, error) {
+	user, nodes, err := api.h.db.DisableUser(types.UserID(request.GetId()))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) > 0 {
+		if err := api.h.nodeStore.Reload(nodes.IDs()...); err != nil {
+			return nil, fmt.Errorf("reloading nodes: %w", err)
+		}
+	}
+
+	ctx = types.NotifyCtx(ctx, "cli-disableuser", user.Name)
+	for _, node := range nodes {
+		api.h.nodeNotifier.NotifyByNodeID(ctx, types.UpdateSelf(node.ID), node.ID)
+		api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdateExpire(node.ID, *node.Expiry), node.ID)
+	}
+
+	api.h.logger.Info().
+		Str("user", user.Name).
+		Int("expired_nodes", len(nodes)).
+		Msg("user disabled")
+
+	return &v1.DisableUserResponse{User: user.Proto()}, nil
+}
+
+func (api headscaleV1APIServer) EnableUser(
+	ctx context.Context,
+	request *v1.EnableUserRequest,
+) (*v1.EnableUserResponse, error) {
+	user, err := api.h.db.EnableUser(types.UserID(request.GetId()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.EnableUserResponse{User: user.Proto()}, nil
+}
+
 func (api headscaleV1APIServer) ListUsers(
 	ctx context.Context,
 	request *v1.ListUsersRequest,
@@ -133,7 +280,10 @@ func (api headscaleV1APIServer) ListUsers(
 
 	response := make([]*v1.User, len(users))
 	for index, user := range users {
-		response[index] = user.Proto()
+		response[index], err = api.userWithQuota(&user)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	sort.Slice(response, func(i, j int) bool {
@@ -143,6 +293,79 @@ func (api headscaleV1APIServer) ListUsers(
 	return &v1.ListUsersResponse{Users: response}, nil
 }
 
+// userWithQuota returns the user with the quota that applies to it and its
+// usage.
+func (api headscaleV1APIServer) userWithQuota(user *types.User) (*v1.User, error) {
+	usage, err := api.h.db.GetQuotaUsage(types.UserID(user.ID))
+	if err != nil {
+		return nil, fmt.Errorf("getting quota usage of user %d: %w", user.ID, err)
+	}
+
+	proto := user.Proto()
+	proto.Quota = api.h.db.UserQuota(user).Proto()
+	proto.Usage = usage.Proto()
+
+	return proto, nil
+}
+
+func (api headscaleV1APIServer) SetUserQuota(
+	ctx context.Context,
+	request *v1.SetUserQuotaRequest,
+) (*v1.SetUserQuotaResponse, error) {
+	user, err := api.h.db.SetUserQuota(
+		types.UserID(request.GetId()),
+		types.UserQuotaFromProto(request.GetQuota()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	proto, err := api.userWithQuota(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.SetUserQuotaResponse{User: proto}, nil
+}
+
+func (api headscaleV1APIServer) MergeUsers(
+	ctx context.Context,
+	request *v1.MergeUsersRequest,
+) (*v1.MergeUsersResponse, error) {
+	user, err := api.h.db.MergeUsers(types.UserID(request.GetFromId()), types.UserID(request.GetIntoId()))
+	if err != nil {
+		return nil, err
+	}
+
+	err = usersChangedHook(api.h.db, api.h.nodeStore, api.h.polMan, api.h.nodeNotifier)
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using user: %w", err)
+	}
+
+	// The peers of the moved nodes show their new user.
+	ctx = types.NotifyCtx(ctx, "cli-mergeusers", user.Name)
+	api.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+
+	return &v1.MergeUsersResponse{User: user.Proto()}, nil
+}
+
+func (api headscaleV1APIServer) ListUserLinks(
+	ctx context.Context,
+	request *v1.ListUserLinksRequest,
+) (*v1.ListUserLinksResponse, error) {
+	links, err := api.h.db.ListUserLinks(types.UserID(request.GetUserId()))
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*v1.UserLink, len(links))
+	for index, link := range links {
+		response[index] = link.Proto()
+	}
+
+	return &v1.ListUserLinksResponse{Links: response}, nil
+}
+
 func (api headscaleV1APIServer) CreatePreAuthKey(
 	ctx context.Context,
 	request *v1.CreatePreAuthKeyRequest,
@@ -161,17 +384,46 @@ func (api headscaleV1APIServer) CreatePreAuthKey(
 		}
 	}
 
+	// OAuth clients can only create tagged keys, with the tags they own.
+	if client, ok := oauthClientFromContext(ctx); ok {
+		if len(request.GetAclTags()) == 0 {
+			return nil, status.Error(codes.PermissionDenied, "OAuth clients can only create tagged pre auth keys")
+		}
+
+		for _, tag := range request.GetAclTags() {
+			if !slices.Contains(client.Tags, tag) {
+				return nil, status.Errorf(codes.PermissionDenied, "OAuth client %s does not own tag %q", client.ClientID, tag)
+			}
+		}
+
+		// Routes approved through a key are not checked against the
+		// autoApprovers of the policy, so only admins may set them.
+		if len(request.GetConstraints().GetApprovedRoutes()) > 0 {
+			return nil, status.Error(codes.PermissionDenied, "OAuth clients cannot create pre auth keys with approved routes")
+		}
+	}
+
+	constraints, err := preAuthKeyConstraintsFromProto(request.GetConstraints())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	user, err := api.h.db.GetUserByID(types.UserID(request.GetUser()))
 	if err != nil {
 		return nil, err
 	}
 
-	preAuthKey, err := api.h.db.CreatePreAuthKey(
+	preAuthKey, err := api.h.db.CreatePreAuthKeyWithOptions(
 		types.UserID(user.ID),
-		request.GetReusable(),
-		request.GetEphemeral(),
-		&expiration,
-		request.AclTags,
+		db.PreAuthKeyOptions{
+			Reusable:    request.GetReusable(),
+			Ephemeral:   request.GetEphemeral(),
+			Expiration:  &expiration,
+			Tags:        request.AclTags,
+			Description: request.GetDescription(),
+			MaxUses:     uint(request.GetMaxUses()),
+			Constraints: constraints,
+		},
 	)
 	if err != nil {
 		return nil, err
@@ -180,12 +432,31 @@ func (api headscaleV1APIServer) CreatePreAuthKey(
 	return &v1.CreatePreAuthKeyResponse{PreAuthKey: preAuthKey.Proto()}, nil
 }
 
+func preAuthKeyConstraintsFromProto(c *v1.PreAuthKeyConstraints) (types.PreAuthKeyConstraints, error) {
+	constraints := types.PreAuthKeyConstraints{
+		HostnamePattern: c.GetHostnamePattern(),
+		AllowedOS:       c.GetAllowedOs(),
+		NodeExpiry:      c.GetNodeExpiry().AsDuration(),
+	}
+
+	for _, route := range c.GetApprovedRoutes() {
+		prefix, err := netip.ParsePrefix(route)
+		if err != nil {
+			return constraints, fmt.Errorf("parsing approved route: %w", err)
+		}
+
+		constraints.ApprovedRoutes = append(constraints.ApprovedRoutes, prefix.Masked())
+	}
+
+	return constraints, constraints.Validate()
+}
+
 func (api headscaleV1APIServer) ExpirePreAuthKey(
 	ctx context.Context,
 	request *v1.ExpirePreAuthKeyRequest,
 ) (*v1.ExpirePreAuthKeyResponse, error) {
 	err := api.h.db.Write(func(tx *gorm.DB) error {
-		preAuthKey, err := db.GetPreAuthKey(tx, request.Key)
+		preAuthKey, err := db.GetPreAuthKeyByPrefix(tx, request.GetKey())
 		if err != nil {
 			return err
 		}
@@ -217,9 +488,19 @@ func (api headscaleV1APIServer) ListPreAuthKeys(
 		return nil, err
 	}
 
+	// The nodes of all keys are found in one pass, rather than the
+	// caller asking for the nodes of every key.
+	nodesByKey := make(map[uint64][]uint64)
+	for _, node := range api.h.nodeStore.ListNodes() {
+		if node.AuthKeyID != nil && node.UserID == user.ID {
+			nodesByKey[*node.AuthKeyID] = append(nodesByKey[*node.AuthKeyID], node.ID.Uint64())
+		}
+	}
+
 	response := make([]*v1.PreAuthKey, len(preAuthKeys))
 	for index, key := range preAuthKeys {
 		response[index] = key.Proto()
+		response[index].NodeIds = nodesByKey[key.ID]
 	}
 
 	sort.Slice(response, func(i, j int) bool {
@@ -229,11 +510,35 @@ func (api headscaleV1APIServer) ListPreAuthKeys(
 	return &v1.ListPreAuthKeysResponse{PreAuthKeys: response}, nil
 }
 
+func (api headscaleV1APIServer) ListNodesByPreAuthKey(
+	ctx context.Context,
+	request *v1.ListNodesByPreAuthKeyRequest,
+) (*v1.ListNodesByPreAuthKeyResponse, error) {
+	nodes, err := api.h.db.ListNodesByPreAuthKey(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) == 0 {
+		return &v1.ListNodesByPreAuthKeyResponse{}, nil
+	}
+
+	ids := make([]types.NodeID, len(nodes))
+	for index, node := range nodes {
+		ids[index] = node.ID
+	}
+
+	isLikelyConnected := api.h.nodeNotifier.LikelyConnectedMap()
+	response := nodesToProto(api.h.polMan, isLikelyConnected, api.h.primaryRoutes, api.h.nodeStore.ListNodes(ids...))
+
+	return &v1.ListNodesByPreAuthKeyResponse{Nodes: response}, nil
+}
+
 func (api headscaleV1APIServer) RegisterNode(
 	ctx context.Context,
 	request *v1.RegisterNodeRequest,
 ) (*v1.RegisterNodeResponse, error) {
-	log.Trace().
+	api.h.logger.Trace().
 		Str("user", request.GetUser()).
 		Str("registration_id", request.GetKey()).
 		Msg("Registering node")
@@ -243,53 +548,16 @@ func (api headscaleV1APIServer) RegisterNode(
 		return nil, err
 	}
 
-	ipv4, ipv6, err := api.h.ipAlloc.Next()
-	if err != nil {
-		return nil, err
-	}
-
-	user, err := api.h.db.GetUserByName(request.GetUser())
+	user, err := api.lookupUser(request.GetUser(), request.GetUserId())
 	if err != nil {
 		return nil, fmt.Errorf("looking up user: %w", err)
 	}
 
-	node, _, err := api.h.db.HandleNodeFromAuthPath(
-		registrationId,
-		types.UserID(user.ID),
-		nil,
-		util.RegisterMethodCLI,
-		ipv4, ipv6,
-	)
+	node, err := api.h.registerFromAuthPath(ctx, registrationId, user, nil, util.RegisterMethodCLI)
 	if err != nil {
 		return nil, err
 	}
 
-	updateSent, err := nodesChangedHook(api.h.db, api.h.polMan, api.h.nodeNotifier)
-	if err != nil {
-		return nil, fmt.Errorf("updating resources using node: %w", err)
-	}
-
-	// This is a bit of a back and forth, but we have a bit of a chicken and egg
-	// dependency here.
-	// Because the way the policy manager works, we need to have the node
-	// in the database, then add it to the policy manager and then we can
-	// approve the route. This means we get this dance where the node is
-	// first added to the database, then we add it to the policy manager via
-	// nodesChangedHook and then we can auto approve the routes.
-	// As that only approves the struct object, we need to save it again and
-	// ensure we send an update.
-	// This works, but might be another good candidate for doing some sort of
-	// eventbus.
-	routesChanged := policy.AutoApproveRoutes(api.h.polMan, node)
-	if err := api.h.db.DB.Save(node).Error; err != nil {
-		return nil, fmt.Errorf("saving auto approved routes to node: %w", err)
-	}
-
-	if !updateSent || routesChanged {
-		ctx = types.NotifyCtx(context.Background(), "web-node-login", node.Hostname)
-		api.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(node.ID))
-	}
-
 	return &v1.RegisterNodeResponse{Node: node.Proto()}, nil
 }
 
@@ -297,9 +565,9 @@ func (api headscaleV1APIServer) GetNode(
 	ctx context.Context,
 	request *v1.GetNodeRequest,
 ) (*v1.GetNodeResponse, error) {
-	node, err := api.h.db.GetNodeByID(types.NodeID(request.GetNodeId()))
-	if err != nil {
-		return nil, err
+	node, ok := api.h.nodeStore.GetNode(types.NodeID(request.GetNodeId()))
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
 	}
 
 	resp := node.Proto()
@@ -336,10 +604,14 @@ func (api headscaleV1APIServer) SetTags(
 		}, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	if err := api.h.nodeStore.Reload(node.ID); err != nil {
+		return nil, fmt.Errorf("reloading node: %w", err)
+	}
+
 	ctx = types.NotifyCtx(ctx, "cli-settags", node.Hostname)
 	api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
 
-	log.Trace().
+	api.h.logger.Trace().
 		Str("node", node.Hostname).
 		Strs("tags", request.GetTags()).
 		Msg("Changing tags of node")
@@ -347,6 +619,35 @@ func (api headscaleV1APIServer) SetTags(
 	return &v1.SetTagsResponse{Node: node.Proto()}, nil
 }
 
+func (api headscaleV1APIServer) LabelNode(
+	ctx context.Context,
+	request *v1.LabelNodeRequest,
+) (*v1.LabelNodeResponse, error) {
+	node, err := db.Write(api.h.db.DB, func(tx *gorm.DB) (*types.Node, error) {
+		err := db.SetLabels(tx, types.NodeID(request.GetNodeId()), request.GetLabels(), request.GetRemove())
+		if err != nil {
+			return nil, err
+		}
+
+		return db.GetNodeByID(tx, types.NodeID(request.GetNodeId()))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Labels are not part of the netmap, peers are not notified.
+	if err := api.h.nodeStore.Reload(node.ID); err != nil {
+		return nil, fmt.Errorf("reloading node: %w", err)
+	}
+
+	api.h.logger.Trace().
+		Str("node", node.Hostname).
+		Interface("labels", node.Labels).
+		Msg("Changing labels of node")
+
+	return &v1.LabelNodeResponse{Node: node.Proto()}, nil
+}
+
 func (api headscaleV1APIServer) SetApprovedRoutes(
 	ctx context.Context,
 	request *v1.SetApprovedRoutesRequest,
@@ -370,20 +671,32 @@ func (api headscaleV1APIServer) SetApprovedRoutes(
 	routes = slices.Compact(routes)
 
 	node, err := db.Write(api.h.db.DB, func(tx *gorm.DB) (*types.Node, error) {
-		err := db.SetApprovedRoutes(tx, types.NodeID(request.GetNodeId()), routes)
+		err := db.CheckRouteQuota(tx, types.NodeID(request.GetNodeId()), routes, api.h.db.DefaultQuota())
+		if err != nil {
+			return nil, err
+		}
+
+		err = db.SetApprovedRoutes(tx, types.NodeID(request.GetNodeId()), routes)
 		if err != nil {
 			return nil, err
 		}
 
 		return db.GetNodeByID(tx, types.NodeID(request.GetNodeId()))
 	})
+	if errors.Is(err, db.ErrQuotaExceeded) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	if api.h.primaryRoutes.SetRoutes(node.ID, node.SubnetRoutes()...) {
+	if err := api.h.nodeStore.Reload(node.ID); err != nil {
+		return nil, fmt.Errorf("reloading node: %w", err)
+	}
+
+	if affected := api.h.primaryRoutes.SetRoutesAffected(node.ID, node.SubnetRoutes()...); len(affected) > 0 {
 		ctx := types.NotifyCtx(ctx, "poll-primary-change", node.Hostname)
-		api.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+		api.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(lo.Uniq(append(affected, node.ID))...))
 	} else {
 		ctx = types.NotifyCtx(ctx, "cli-approveroutes", node.Hostname)
 		api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
@@ -421,10 +734,13 @@ func (api headscaleV1APIServer) DeleteNode(
 	if err != nil {
 		return nil, err
 	}
+	api.h.nodeStore.DeleteNode(node.ID)
 
 	ctx = types.NotifyCtx(ctx, "cli-deletenode", node.Hostname)
 	api.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerRemoved(node.ID))
 
+	api.h.hooks.nodeRemoved(node)
+
 	return &v1.DeleteNodeResponse{}, nil
 }
 
@@ -447,6 +763,10 @@ func (api headscaleV1APIServer) ExpireNode(
 		return nil, err
 	}
 
+	if err := api.h.nodeStore.Reload(node.ID); err != nil {
+		return nil, fmt.Errorf("reloading node: %w", err)
+	}
+
 	ctx = types.NotifyCtx(ctx, "cli-expirenode-self", node.Hostname)
 	api.h.nodeNotifier.NotifyByNodeID(
 		ctx,
@@ -456,7 +776,7 @@ func (api headscaleV1APIServer) ExpireNode(
 	ctx = types.NotifyCtx(ctx, "cli-expirenode-peers", node.Hostname)
 	api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdateExpire(node.ID, now), node.ID)
 
-	log.Trace().
+	api.h.logger.Trace().
 		Str("node", node.Hostname).
 		Time("expiry", *node.Expiry).
 		Msg("node expired")
@@ -484,10 +804,14 @@ func (api headscaleV1APIServer) RenameNode(
 		return nil, err
 	}
 
+	if err := api.h.nodeStore.Reload(node.ID); err != nil {
+		return nil, fmt.Errorf("reloading node: %w", err)
+	}
+
 	ctx = types.NotifyCtx(ctx, "cli-renamenode", node.Hostname)
 	api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
 
-	log.Trace().
+	api.h.logger.Trace().
 		Str("node", node.Hostname).
 		Str("new_name", request.GetNewName()).
 		Msg("node renamed")
@@ -499,40 +823,48 @@ func (api headscaleV1APIServer) ListNodes(
 	ctx context.Context,
 	request *v1.ListNodesRequest,
 ) (*v1.ListNodesResponse, error) {
-	// TODO(kradalby): it looks like this can be simplified a lot,
-	// the filtering of nodes by user, vs nodes as a whole can
-	// probably be done once.
-	// TODO(kradalby): This should be done in one tx.
+	filter, err := nodefilter.Parse(request.GetFilter())
+	if err != nil {
+		return nil, err
+	}
 
-	isLikelyConnected := api.h.nodeNotifier.LikelyConnectedMap()
-	if request.GetUser() != "" {
-		user, err := api.h.db.GetUserByName(request.GetUser())
+	nodes := api.h.nodeStore.ListNodes()
+	if request.GetUser() != "" || request.GetUserId() != 0 {
+		user, err := api.lookupUser(request.GetUser(), request.GetUserId())
 		if err != nil {
 			return nil, err
 		}
 
-		nodes, err := db.Read(api.h.db.DB, func(rx *gorm.DB) (types.Nodes, error) {
-			return db.ListNodesByUser(rx, types.UserID(user.ID))
+		nodes = slices.DeleteFunc(nodes, func(node *types.Node) bool {
+			return node.UserID != user.ID
 		})
-		if err != nil {
-			return nil, err
-		}
+	}
 
-		response := nodesToProto(api.h.polMan, isLikelyConnected, api.h.primaryRoutes, nodes)
-		return &v1.ListNodesResponse{Nodes: response}, nil
+	isLikelyConnected := api.h.nodeNotifier.LikelyConnectedMap()
+	response := nodesToProto(api.h.polMan, isLikelyConnected, api.h.primaryRoutes, nodes)
+
+	now := time.Now()
+	response = slices.DeleteFunc(response, func(node *v1.Node) bool {
+		return !filter.Match(node, now)
+	})
+
+	if err := nodefilter.Sort(response, request.GetOrderBy()); err != nil {
+		return nil, err
 	}
 
-	nodes, err := api.h.db.ListNodes()
+	// The page token is only valid for the same nodes in the same order.
+	query := fmt.Sprintf("%s\x00%d\x00%s\x00%s",
+		request.GetUser(), request.GetUserId(), request.GetFilter(), request.GetOrderBy())
+	page, next, err := nodefilter.Page(response, request.GetPageSize(), request.GetPageToken(), query)
 	if err != nil {
 		return nil, err
 	}
 
-	sort.Slice(nodes, func(i, j int) bool {
-		return nodes[i].ID < nodes[j].ID
-	})
-
-	response := nodesToProto(api.h.polMan, isLikelyConnected, api.h.primaryRoutes, nodes)
-	return &v1.ListNodesResponse{Nodes: response}, nil
+	return &v1.ListNodesResponse{
+		Nodes:         page,
+		NextPageToken: next,
+		TotalSize:     int32(len(response)),
+	}, nil
 }
 
 func nodesToProto(polMan policy.PolicyManager, isLikelyConnected *xsync.MapOf[types.NodeID, bool], pr *routes.PrimaryRoutes, nodes types.Nodes) []*v1.Node {
@@ -570,6 +902,11 @@ func (api headscaleV1APIServer) MoveNode(
 			return nil, err
 		}
 
+		err = db.CheckMoveNodeQuota(tx, node, types.UserID(request.GetUser()), api.h.db.DefaultQuota())
+		if err != nil {
+			return nil, err
+		}
+
 		err = db.AssignNodeToUser(tx, node, types.UserID(request.GetUser()))
 		if err != nil {
 			return nil, err
@@ -581,6 +918,10 @@ func (api headscaleV1APIServer) MoveNode(
 		return nil, err
 	}
 
+	if err := api.h.nodeStore.Reload(node.ID); err != nil {
+		return nil, fmt.Errorf("reloading node: %w", err)
+	}
+
 	ctx = types.NotifyCtx(ctx, "cli-movenode-self", node.Hostname)
 	api.h.nodeNotifier.NotifyByNodeID(
 		ctx,
@@ -596,7 +937,7 @@ func (api headscaleV1APIServer) BackfillNodeIPs(
 	ctx context.Context,
 	request *v1.BackfillNodeIPsRequest,
 ) (*v1.BackfillNodeIPsResponse, error) {
-	log.Trace().Msg("Backfill called")
+	api.h.logger.Trace().Msg("Backfill called")
 
 	if !request.Confirmed {
 		return nil, errors.New("not confirmed, aborting")
@@ -607,6 +948,10 @@ func (api headscaleV1APIServer) BackfillNodeIPs(
 		return nil, err
 	}
 
+	if err := api.h.nodeStore.Reload(); err != nil {
+		return nil, fmt.Errorf("reloading nodes: %w", err)
+	}
+
 	return &v1.BackfillNodeIPsResponse{Changes: changes}, nil
 }
 
@@ -691,6 +1036,129 @@ func (api headscaleV1APIServer) DeleteApiKey(
 	return &v1.DeleteApiKeyResponse{}, nil
 }
 
+func (api headscaleV1APIServer) CreateOAuthClient(
+	ctx context.Context,
+	request *v1.CreateOAuthClientRequest,
+) (*v1.CreateOAuthClientResponse, error) {
+	opts := db.OAuthClientOptions{
+		Scopes:      request.GetScopes(),
+		Tags:        request.GetTags(),
+		Description: request.GetDescription(),
+	}
+
+	if request.GetExpiration() != nil {
+		expiration := request.GetExpiration().AsTime()
+		opts.Expiration = &expiration
+	}
+
+	secret, client, err := api.h.db.CreateOAuthClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.CreateOAuthClientResponse{
+		OauthClient:  client.Proto(),
+		ClientSecret: secret,
+	}, nil
+}
+
+func (api headscaleV1APIServer) ListOAuthClients(
+	ctx context.Context,
+	request *v1.ListOAuthClientsRequest,
+) (*v1.ListOAuthClientsResponse, error) {
+	clients, err := api.h.db.ListOAuthClients()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*v1.OAuthClient, len(clients))
+	for index, client := range clients {
+		response[index] = client.Proto()
+	}
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].Id < response[j].Id
+	})
+
+	return &v1.ListOAuthClientsResponse{OauthClients: response}, nil
+}
+
+func (api headscaleV1APIServer) DeleteOAuthClient(
+	ctx context.Context,
+	request *v1.DeleteOAuthClientRequest,
+) (*v1.DeleteOAuthClientResponse, error) {
+	client, err := api.h.db.GetOAuthClient(request.GetClientId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := api.h.db.DestroyOAuthClient(*client); err != nil {
+		return nil, err
+	}
+
+	return &v1.DeleteOAuthClientResponse{}, nil
+}
+
+func (api headscaleV1APIServer) CreateInvite(
+	ctx context.Context,
+	request *v1.CreateInviteRequest,
+) (*v1.CreateInviteResponse, error) {
+	// Without OIDC, the invite is accepted as a local user named after
+	// the email.
+	if _, oidc := api.h.authProvider.(*AuthProviderOIDC); !oidc && request.GetEmail() == "" {
+		return nil, fmt.Errorf("%w: an email is required when OIDC is not configured", db.ErrInviteInvalid)
+	}
+
+	opts := db.InviteOptions{
+		Email: request.GetEmail(),
+		Tags:  request.GetTags(),
+	}
+
+	if request.GetExpiration() != nil {
+		expiration := request.GetExpiration().AsTime()
+		opts.Expiration = &expiration
+	}
+
+	token, invite, err := api.h.db.CreateInvite(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.CreateInviteResponse{
+		Invite: invite.Proto(),
+		Url:    api.h.InviteURL(token),
+	}, nil
+}
+
+func (api headscaleV1APIServer) ListInvites(
+	ctx context.Context,
+	request *v1.ListInvitesRequest,
+) (*v1.ListInvitesResponse, error) {
+	invites, err := api.h.db.ListInvites()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*v1.Invite, len(invites))
+	for index, invite := range invites {
+		response[index] = invite.Proto()
+	}
+
+	return &v1.ListInvitesResponse{Invites: response}, nil
+}
+
+func (api headscaleV1APIServer) RevokeInvite(
+	ctx context.Context,
+	request *v1.RevokeInviteRequest,
+) (*v1.RevokeInviteResponse, error) {
+	invite, err := api.h.db.RevokeInvite(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.RevokeInviteResponse{Invite: invite.Proto()}, nil
+}
+
 func (api headscaleV1APIServer) GetPolicy(
 	_ context.Context,
 	_ *v1.GetPolicyRequest,
@@ -708,10 +1176,10 @@ func (api headscaleV1APIServer) GetPolicy(
 		}, nil
 	case types.PolicyModeFile:
 		// Read the file and return the contents as-is.
-		absPath := util.AbsolutePathFromConfigPath(api.h.cfg.Policy.Path)
-		f, err := os.Open(absPath)
+		path := api.h.cfg.Policy.Path
+		f, err := os.Open(path)
 		if err != nil {
-			return nil, fmt.Errorf("reading policy from path %q: %w", absPath, err)
+			return nil, fmt.Errorf("reading policy from path %q: %w", path, err)
 		}
 
 		defer f.Close()
@@ -742,10 +1210,7 @@ func (api headscaleV1APIServer) SetPolicy(
 	// a scenario where they might be allowed if the server has no nodes
 	// yet, but it should help for the general case and for hot reloading
 	// configurations.
-	nodes, err := api.h.db.ListNodes()
-	if err != nil {
-		return nil, fmt.Errorf("loading nodes from database to validate policy: %w", err)
-	}
+	nodes := api.h.nodeStore.ListNodes()
 	changed, err := api.h.polMan.SetPolicy([]byte(p))
 	if err != nil {
 		return nil, fmt.Errorf("setting policy: %w", err)
@@ -771,7 +1236,9 @@ func (api headscaleV1APIServer) SetPolicy(
 		}
 
 		ctx := types.NotifyCtx(context.Background(), "acl-update", "na")
-		api.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+		api.h.nodeNotifier.NotifyPolicyChange(ctx, api.h.polMan, api.h.nodeStore.ListNodes())
+
+		api.h.hooks.policyChanged([]byte(p))
 	}
 
 	response := &v1.SetPolicyResponse{
@@ -782,12 +1249,62 @@ func (api headscaleV1APIServer) SetPolicy(
 	return response, nil
 }
 
+func (api headscaleV1APIServer) ListDNSRecords(
+	_ context.Context,
+	_ *v1.ListDNSRecordsRequest,
+) (*v1.ListDNSRecordsResponse, error) {
+	records, err := api.h.db.ListDNSRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &v1.ListDNSRecordsResponse{}
+	for _, record := range records {
+		response.Records = append(response.Records, record.Proto())
+	}
+
+	return response, nil
+}
+
+func (api headscaleV1APIServer) SetDNSRecords(
+	_ context.Context,
+	request *v1.SetDNSRecordsRequest,
+) (*v1.SetDNSRecordsResponse, error) {
+	records := make([]types.DNSRecord, 0, len(request.GetRecords()))
+	for _, record := range request.GetRecords() {
+		records = append(records, types.DNSRecord{
+			Name:  record.GetName(),
+			Type:  record.GetType(),
+			Value: record.GetValue(),
+		})
+	}
+
+	records, err := api.h.db.SetDNSRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := api.h.updateExtraRecords(); err != nil {
+		return nil, err
+	}
+
+	ctx := types.NotifyCtx(context.Background(), "grpc-dns-records", "all")
+	api.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+
+	response := &v1.SetDNSRecordsResponse{}
+	for _, record := range records {
+		response.Records = append(response.Records, record.Proto())
+	}
+
+	return response, nil
+}
+
 // The following service calls are for testing and debugging
 func (api headscaleV1APIServer) DebugCreateNode(
 	ctx context.Context,
 	request *v1.DebugCreateNodeRequest,
 ) (*v1.DebugCreateNodeResponse, error) {
-	user, err := api.h.db.GetUserByName(request.GetUser())
+	user, err := api.lookupUser(request.GetUser(), request.GetUserId())
 	if err != nil {
 		return nil, err
 	}
@@ -797,7 +1314,7 @@ func (api headscaleV1APIServer) DebugCreateNode(
 		return nil, err
 	}
 
-	log.Trace().
+	api.h.logger.Trace().
 		Caller().
 		Interface("route-prefix", routes).
 		Interface("route-str", request.GetRoutes()).
@@ -814,31 +1331,28 @@ func (api headscaleV1APIServer) DebugCreateNode(
 		return nil, err
 	}
 
-	newNode := types.RegisterNode{
-		Node: types.Node{
-			NodeKey:    key.NewNode().Public(),
-			MachineKey: key.NewMachine().Public(),
-			Hostname:   request.GetName(),
-			User:       *user,
+	newNode := types.Node{
+		NodeKey:    key.NewNode().Public(),
+		MachineKey: key.NewMachine().Public(),
+		Hostname:   request.GetName(),
+		User:       *user,
 
-			Expiry:   &time.Time{},
-			LastSeen: &time.Time{},
+		Expiry:   &time.Time{},
+		LastSeen: &time.Time{},
 
-			Hostinfo: &hostinfo,
-		},
-		Registered: make(chan *types.Node),
+		Hostinfo: &hostinfo,
 	}
 
-	log.Debug().
+	api.h.logger.Debug().
 		Str("registration_id", registrationId.String()).
-		Msg("adding debug machine via CLI, appending to registration cache")
+		Msg("adding debug machine via CLI, appending to pending registrations")
 
-	api.h.registrationCache.Set(
-		registrationId,
-		newNode,
-	)
+	err = api.h.db.CreatePendingRegistration(registrationId, newNode)
+	if err != nil {
+		return nil, err
+	}
 
-	return &v1.DebugCreateNodeResponse{Node: newNode.Node.Proto()}, nil
+	return &v1.DebugCreateNodeResponse{Node: newNode.Proto()}, nil
 }
 
 func (api headscaleV1APIServer) mustEmbedUnimplementedHeadscaleServiceServer() {}
@@ -1,6 +1,27 @@
 package hscontrol
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/ptr"
+)
 
 func Test_validateTag(t *testing.T) {
 	type args struct {
@@ -40,3 +61,457 @@ func Test_validateTag(t *testing.T) {
 		})
 	}
 }
+
+func Test_grpcStatusError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{
+			name: "nil",
+			err:  nil,
+			want: codes.OK,
+		},
+		{
+			name: "wrapped user not found",
+			err:  fmt.Errorf("looking up user: %w", db.ErrUserNotFound),
+			want: codes.NotFound,
+		},
+		{
+			name: "record not found",
+			err:  gorm.ErrRecordNotFound,
+			want: codes.NotFound,
+		},
+		{
+			name: "policy not found",
+			err:  fmt.Errorf("loading ACL from database: %w", types.ErrPolicyNotFound),
+			want: codes.NotFound,
+		},
+		{
+			name: "invalid DNS record",
+			err:  fmt.Errorf("%w: name is empty", types.ErrDNSRecordInvalid),
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "unique constraint",
+			err:  errors.New("creating user: UNIQUE constraint failed: users.name"),
+			want: codes.AlreadyExists,
+		},
+		{
+			name: "quota exceeded",
+			err: NewHTTPError(http.StatusForbidden, "quota", fmt.Errorf("registering node: %w", db.QuotaError{
+				User: "alice", Resource: "nodes", Limit: 1,
+			})),
+			want: codes.ResourceExhausted,
+		},
+		{
+			name: "status is kept",
+			err:  status.Error(codes.InvalidArgument, "invalid tag"),
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "other",
+			err:  errors.New("database is locked"),
+			want: codes.Unknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(grpcStatusError(tt.err)); got != tt.want {
+				t.Errorf("grpcStatusError() code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDNSRecords(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	h.cfg.DNSConfig.ExtraRecords = []tailcfg.DNSRecord{
+		{Name: "config.example.com", Type: "A", Value: "100.64.0.1"},
+	}
+	h.cfg.TailcfgDNSConfig = &tailcfg.DNSConfig{}
+	api := headscaleV1APIServer{h: h}
+
+	_, err := api.SetDNSRecords(context.Background(), &v1.SetDNSRecordsRequest{
+		Records: []*v1.DNSRecord{
+			{Name: "grafana.example.com", Type: "A", Value: "100.64.0.5"},
+			{Name: "grafana.example.com", Type: "AAAA", Value: "fd7a:115c:a1e0::5"},
+			{Name: "grafana.example.com", Type: "A", Value: "100.64.0.5"},
+		},
+	})
+	require.NoError(t, err)
+
+	listed, err := api.ListDNSRecords(context.Background(), &v1.ListDNSRecordsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, listed.GetRecords(), 2)
+
+	assert.Equal(t, []tailcfg.DNSRecord{
+		{Name: "config.example.com", Type: "A", Value: "100.64.0.1"},
+		{Name: "grafana.example.com", Type: "A", Value: "100.64.0.5"},
+		{Name: "grafana.example.com", Type: "AAAA", Value: "fd7a:115c:a1e0::5"},
+	}, h.cfg.TailcfgDNSConfig.ExtraRecords)
+
+	_, err = api.SetDNSRecords(context.Background(), &v1.SetDNSRecordsRequest{
+		Records: []*v1.DNSRecord{{Name: "bad.example.com", Type: "CNAME", Value: "example.com"}},
+	})
+	require.ErrorIs(t, err, types.ErrDNSRecordInvalid)
+
+	// Removing the records keeps the records of the configuration.
+	_, err = api.SetDNSRecords(context.Background(), &v1.SetDNSRecordsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, h.cfg.TailcfgDNSConfig.ExtraRecords, 1)
+}
+
+func TestMergeUsers(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := headscaleV1APIServer{h: h}
+
+	from, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+	into, err := h.db.CreateUser(types.User{Name: "alice2"})
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "laptop",
+		GivenName:      "laptop",
+		UserID:         from.ID,
+		RegisterMethod: util.RegisterMethodCLI,
+	}
+	require.NoError(t, h.db.DB.Save(&node).Error)
+	_, err = h.nodeStore.LoadNode(node.ID)
+	require.NoError(t, err)
+
+	resp, err := api.MergeUsers(context.Background(), &v1.MergeUsersRequest{
+		FromId: uint64(from.ID),
+		IntoId: uint64(into.ID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "alice2", resp.GetUser().GetName())
+
+	stored, ok := h.nodeStore.GetNode(node.ID)
+	require.True(t, ok)
+	assert.Equal(t, "alice2", stored.User.Name)
+
+	links, err := api.ListUserLinks(context.Background(), &v1.ListUserLinksRequest{UserId: uint64(into.ID)})
+	require.NoError(t, err)
+	require.Len(t, links.GetLinks(), 1)
+	assert.Equal(t, types.UserLinkMerge, links.GetLinks()[0].GetKind())
+
+	_, err = api.MergeUsers(context.Background(), &v1.MergeUsersRequest{
+		FromId: uint64(into.ID),
+		IntoId: uint64(into.ID),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(grpcStatusError(err)))
+}
+
+func TestDeleteUserDeleteNodes(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := headscaleV1APIServer{h: h}
+
+	user, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "laptop",
+		GivenName:      "laptop",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodCLI,
+	}
+	require.NoError(t, h.db.DB.Save(&node).Error)
+	_, err = h.nodeStore.LoadNode(node.ID)
+	require.NoError(t, err)
+
+	_, err = api.DeleteUser(context.Background(), &v1.DeleteUserRequest{Id: uint64(user.ID)})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(grpcStatusError(err)))
+
+	_, err = api.DeleteUser(context.Background(), &v1.DeleteUserRequest{
+		Id:          uint64(user.ID),
+		DeleteNodes: true,
+	})
+	require.NoError(t, err)
+
+	_, ok := h.nodeStore.GetNode(node.ID)
+	assert.False(t, ok)
+}
+
+func TestDisableUser(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := headscaleV1APIServer{h: h}
+
+	user, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "laptop",
+		GivenName:      "laptop",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodCLI,
+	}
+	require.NoError(t, h.db.DB.Save(&node).Error)
+	_, err = h.nodeStore.LoadNode(node.ID)
+	require.NoError(t, err)
+
+	resp, err := api.DisableUser(context.Background(), &v1.DisableUserRequest{Id: uint64(user.ID)})
+	require.NoError(t, err)
+	assert.NotNil(t, resp.GetUser().GetDisabledAt())
+
+	stored, ok := h.nodeStore.GetNode(node.ID)
+	require.True(t, ok)
+	assert.True(t, stored.IsExpired())
+
+	enabled, err := api.EnableUser(context.Background(), &v1.EnableUserRequest{Id: uint64(user.ID)})
+	require.NoError(t, err)
+	assert.Nil(t, enabled.GetUser().GetDisabledAt())
+}
+
+func TestSetUserQuota(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	h.db.SetDefaultQuota(types.Quota{MaxNodes: 5, MaxPreAuthKeys: 1})
+	api := headscaleV1APIServer{h: h}
+
+	user, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	expiration := timestamppb.New(time.Now().Add(time.Hour))
+	pak, err := api.CreatePreAuthKey(context.Background(), &v1.CreatePreAuthKeyRequest{
+		User:       uint64(user.ID),
+		Reusable:   true,
+		Expiration: expiration,
+	})
+	require.NoError(t, err)
+
+	_, err = api.CreatePreAuthKey(context.Background(), &v1.CreatePreAuthKeyRequest{User: uint64(user.ID), Expiration: expiration})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(grpcStatusError(err)))
+
+	resp, err := api.SetUserQuota(context.Background(), &v1.SetUserQuotaRequest{
+		Id:    uint64(user.ID),
+		Quota: &v1.QuotaLimits{MaxPreAuthKeys: ptr.To(int32(0))},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(5), resp.GetUser().GetQuota().GetMaxNodes())
+	assert.Equal(t, int32(0), resp.GetUser().GetQuota().GetMaxPreAuthKeys())
+
+	_, err = api.CreatePreAuthKey(context.Background(), &v1.CreatePreAuthKeyRequest{User: uint64(user.ID), Expiration: expiration})
+	require.NoError(t, err)
+
+	users, err := api.ListUsers(context.Background(), &v1.ListUsersRequest{Id: uint64(user.ID)})
+	require.NoError(t, err)
+	require.Len(t, users.GetUsers(), 1)
+	assert.Equal(t, int32(2), users.GetUsers()[0].GetUsage().GetPreAuthKeys())
+
+	// Registering a node above the quota tells the client why.
+	_, err = api.SetUserQuota(context.Background(), &v1.SetUserQuotaRequest{
+		Id:    uint64(user.ID),
+		Quota: &v1.QuotaLimits{MaxNodes: ptr.To(int32(1))},
+	})
+	require.NoError(t, err)
+
+	register := func() (*tailcfg.RegisterResponse, error) {
+		return h.handleRegister(context.Background(), tailcfg.RegisterRequest{
+			NodeKey:  key.NewNode().Public(),
+			Auth:     &tailcfg.RegisterResponseAuth{AuthKey: pak.GetPreAuthKey().GetKey()},
+			Hostinfo: &tailcfg.Hostinfo{Hostname: "laptop"},
+		}, key.NewMachine().Public())
+	}
+
+	_, err = register()
+	require.NoError(t, err)
+
+	_, err = register()
+	var httpErr HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, `user "alice" has reached its limit of 1 nodes`, httpErr.Msg)
+}
+
+func TestMoveNodeQuota(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := headscaleV1APIServer{h: h}
+
+	alice, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+	bob, err := h.db.CreateUser(types.User{Name: "bob", Quota: types.UserQuota{MaxNodes: ptr.To(1)}})
+	require.NoError(t, err)
+
+	newNode := func(user *types.User, hostname string) types.Node {
+		node := types.Node{
+			MachineKey:     key.NewMachine().Public(),
+			NodeKey:        key.NewNode().Public(),
+			Hostname:       hostname,
+			GivenName:      hostname,
+			UserID:         user.ID,
+			RegisterMethod: util.RegisterMethodCLI,
+		}
+		require.NoError(t, h.db.DB.Save(&node).Error)
+		_, err := h.nodeStore.LoadNode(node.ID)
+		require.NoError(t, err)
+
+		return node
+	}
+
+	newNode(bob, "bob-laptop")
+	node := newNode(alice, "alice-laptop")
+
+	_, err = api.MoveNode(context.Background(), &v1.MoveNodeRequest{NodeId: uint64(node.ID), User: uint64(bob.ID)})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(grpcStatusError(err)))
+
+	stored, err := h.db.GetNodeByID(node.ID)
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, stored.UserID)
+
+	_, err = api.SetUserQuota(context.Background(), &v1.SetUserQuotaRequest{
+		Id:    uint64(bob.ID),
+		Quota: &v1.QuotaLimits{MaxNodes: ptr.To(int32(2))},
+	})
+	require.NoError(t, err)
+
+	resp, err := api.MoveNode(context.Background(), &v1.MoveNodeRequest{NodeId: uint64(node.ID), User: uint64(bob.ID)})
+	require.NoError(t, err)
+	assert.Equal(t, "bob", resp.GetNode().GetUser().GetName())
+}
+
+func TestLabelNode(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := headscaleV1APIServer{h: h}
+
+	user, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "db1",
+		GivenName:      "db1",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodCLI,
+	}
+	require.NoError(t, h.db.DB.Save(&node).Error)
+	_, err = h.nodeStore.LoadNode(node.ID)
+	require.NoError(t, err)
+
+	resp, err := api.LabelNode(context.Background(), &v1.LabelNodeRequest{
+		NodeId: uint64(node.ID),
+		Labels: map[string]string{"env": "prod", "team": "data"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "data"}, resp.GetNode().GetLabels())
+
+	resp, err = api.LabelNode(context.Background(), &v1.LabelNodeRequest{
+		NodeId: uint64(node.ID),
+		Remove: []string{"team"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, resp.GetNode().GetLabels())
+
+	stored, ok := h.nodeStore.GetNode(node.ID)
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"env": "prod"}, stored.Labels)
+
+	_, err = api.LabelNode(context.Background(), &v1.LabelNodeRequest{
+		NodeId: uint64(node.ID),
+		Labels: map[string]string{"bad key": "x"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(grpcStatusError(err)))
+}
+
+func TestListNodesFilterAndPages(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := headscaleV1APIServer{h: h}
+
+	alice, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+	bob, err := h.db.CreateUser(types.User{Name: "bob"})
+	require.NoError(t, err)
+
+	for i, user := range []*types.User{alice, alice, alice, bob} {
+		node := types.Node{
+			MachineKey:     key.NewMachine().Public(),
+			NodeKey:        key.NewNode().Public(),
+			Hostname:       fmt.Sprintf("node%d", i),
+			GivenName:      fmt.Sprintf("node%d", i),
+			UserID:         user.ID,
+			RegisterMethod: util.RegisterMethodCLI,
+		}
+		if i%2 == 0 {
+			node.Labels = map[string]string{"env": "prod"}
+		}
+		require.NoError(t, h.db.DB.Save(&node).Error)
+		_, err = h.nodeStore.LoadNode(node.ID)
+		require.NoError(t, err)
+	}
+
+	resp, err := api.ListNodes(context.Background(), &v1.ListNodesRequest{
+		Filter: "label:env=prod && user:alice",
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.GetNodes(), 2)
+	assert.Equal(t, "node0", resp.GetNodes()[0].GetGivenName())
+	assert.Equal(t, "node2", resp.GetNodes()[1].GetGivenName())
+
+	req := &v1.ListNodesRequest{OrderBy: "name desc", PageSize: 3}
+	resp, err = api.ListNodes(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, resp.GetNodes(), 3)
+	assert.Equal(t, int32(4), resp.GetTotalSize())
+	assert.Equal(t, "node3", resp.GetNodes()[0].GetGivenName())
+	require.NotEmpty(t, resp.GetNextPageToken())
+
+	req.PageToken = resp.GetNextPageToken()
+	resp, err = api.ListNodes(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, resp.GetNodes(), 1)
+	assert.Equal(t, "node0", resp.GetNodes()[0].GetGivenName())
+	assert.Empty(t, resp.GetNextPageToken())
+
+	// A token can not be used with another filter.
+	req.Filter = "online"
+	_, err = api.ListNodes(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(grpcStatusError(err)))
+
+	_, err = api.ListNodes(context.Background(), &v1.ListNodesRequest{Filter: "tag:db &&"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(grpcStatusError(err)))
+}
+
+func TestListPreAuthKeysNodeIDs(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := headscaleV1APIServer{h: h}
+
+	user, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	pak, err := h.db.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, nil)
+	require.NoError(t, err)
+	unused, err := h.db.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, nil)
+	require.NoError(t, err)
+
+	var ids []uint64
+	for i := range 2 {
+		node := types.Node{
+			MachineKey:     key.NewMachine().Public(),
+			NodeKey:        key.NewNode().Public(),
+			Hostname:       fmt.Sprintf("node%d", i),
+			GivenName:      fmt.Sprintf("node%d", i),
+			UserID:         user.ID,
+			AuthKeyID:      &pak.ID,
+			RegisterMethod: util.RegisterMethodAuthKey,
+		}
+		require.NoError(t, h.db.DB.Save(&node).Error)
+		_, err = h.nodeStore.LoadNode(node.ID)
+		require.NoError(t, err)
+		ids = append(ids, node.ID.Uint64())
+	}
+
+	resp, err := api.ListPreAuthKeys(context.Background(), &v1.ListPreAuthKeysRequest{User: uint64(user.ID)})
+	require.NoError(t, err)
+	require.Len(t, resp.GetPreAuthKeys(), 2)
+	assert.Equal(t, pak.ID, resp.GetPreAuthKeys()[0].GetId())
+	assert.Equal(t, ids, resp.GetPreAuthKeys()[0].GetNodeIds())
+	assert.Equal(t, unused.ID, resp.GetPreAuthKeys()[1].GetId())
+	assert.Empty(t, resp.GetPreAuthKeys()[1].GetNodeIds())
+}
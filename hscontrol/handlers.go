@@ -94,12 +94,7 @@ func (h *Headscale) derpRequestIsAllowed(
 		return false, fmt.Errorf("cannot parse derpAdmitClientRequest: %w", err)
 	}
 
-	nodes, err := h.db.ListNodes()
-	if err != nil {
-		return false, fmt.Errorf("cannot list nodes: %w", err)
-	}
-
-	return nodes.ContainsNodeKey(derpAdmitClientRequest.NodePublic), nil
+	return h.nodeStore.HasNodeKey(derpAdmitClientRequest.NodePublic), nil
 }
 
 // see https://github.com/tailscale/tailscale/blob/964282d34f06ecc06ce644769c66b0b31d118340/derp/derp_server.go#L1159, Derp use verifyClientsURL to verify whether a client is allowed to connect to the DERP server.
@@ -190,11 +185,14 @@ var codeStyleRegisterWebAPI = styles.Props{
 
 type AuthProviderWeb struct {
 	serverURL string
+	// approval is set when admins can approve registrations on the web.
+	approval bool
 }
 
-func NewAuthProviderWeb(serverURL string) *AuthProviderWeb {
+func NewAuthProviderWeb(serverURL string, approval bool) *AuthProviderWeb {
 	return &AuthProviderWeb{
 		serverURL: serverURL,
+		approval:  approval,
 	}
 }
 
@@ -228,5 +226,10 @@ func (a *AuthProviderWeb) RegisterHandler(
 
 	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
 	writer.WriteHeader(http.StatusOK)
-	writer.Write([]byte(templates.RegisterWeb(registrationId).Render()))
+	var approvalURL string
+	if a.approval {
+		approvalURL = strings.TrimSuffix(a.serverURL, "/") + adminRegistrationsPath
+	}
+
+	writer.Write([]byte(templates.RegisterWeb(registrationId, approvalURL).Render()))
 }
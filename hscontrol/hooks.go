@@ -0,0 +1,159 @@
+package hscontrol
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+)
+
+// ErrRegistrationDenied is returned when the registration hook denies the
+// registration of a node.
+var ErrRegistrationDenied = errors.New("registration denied")
+
+// hooks calls the hooks set by the application embedding Headscale.
+type hooks struct {
+	types.Hooks
+
+	db        *db.HSDatabase
+	nodeStore *db.NodeStore
+}
+
+// admit asks the registration hook to admit node, registered to user with
+// the given method, and applies its decision to node.
+func (hk *hooks) admit(ctx context.Context, node *types.Node, user *types.User, method string) error {
+	if hk.Registration == nil {
+		return nil
+	}
+
+	req := &types.RegistrationRequest{
+		MachineKey: node.MachineKey,
+		NodeKey:    node.NodeKey,
+		Hostinfo:   node.Hostinfo.Clone(),
+		User:       user.Proto(),
+		AuthMethod: method,
+		Hostname:   node.Hostname,
+		Tags:       slices.Clone(node.ForcedTags),
+		Expiry:     node.Expiry,
+	}
+
+	decision, err := hk.Registration.AdmitRegistration(ctx, req)
+	if err != nil {
+		return fmt.Errorf("registration hook: %w", err)
+	}
+
+	if decision == nil {
+		return nil
+	}
+
+	if decision.Deny {
+		return NewHTTPError(
+			http.StatusUnauthorized,
+			cmp.Or(decision.Reason, ErrRegistrationDenied.Error()),
+			ErrRegistrationDenied,
+		)
+	}
+
+	if decision.Hostname != "" {
+		node.Hostname = decision.Hostname
+	}
+
+	if decision.Tags != nil {
+		node.ForcedTags = decision.Tags
+	}
+
+	if decision.Expiry != nil {
+		node.Expiry = decision.Expiry
+	}
+
+	return nil
+}
+
+// admitCached asks the registration hook to admit the node waiting for the
+// pending registration registrationID, and applies its decision to the
+// pending node. expiry is the expiry the caller registers the node with, if
+// any, and the expiry to register the node with is returned.
+// Nodes reauthenticating are not new, and are admitted without asking.
+func (hk *hooks) admitCached(
+	ctx context.Context,
+	registrationID types.RegistrationID,
+	user *types.User,
+	method string,
+	expiry *time.Time,
+) (*time.Time, error) {
+	if hk.Registration == nil {
+		return expiry, nil
+	}
+
+	// A registration that does not exist fails when it is registered,
+	// any other error must not let the node in without asking.
+	reg, err := hk.db.GetPendingRegistration(registrationID)
+	if errors.Is(err, db.ErrNodeNotFoundRegistrationCache) {
+		return expiry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("looking up pending registration: %w", err)
+	}
+
+	if _, ok := hk.nodeStore.GetNodeByNodeKey(reg.Node.NodeKey); ok {
+		return expiry, nil
+	}
+
+	node := reg.Node
+	if expiry != nil {
+		node.Expiry = expiry
+	}
+
+	if err := hk.admit(ctx, &node, user, method); err != nil {
+		if errors.Is(err, ErrRegistrationDenied) {
+			// Let the client waiting for the registration know
+			// that it is over.
+			if err := hk.db.RejectPendingRegistration(registrationID, ""); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, err
+	}
+
+	reg.Node.Hostname = node.Hostname
+	reg.Node.ForcedTags = node.ForcedTags
+	if err := hk.db.SavePendingRegistrationNode(registrationID, reg.Node); err != nil {
+		return nil, err
+	}
+
+	return node.Expiry, nil
+}
+
+func (hk *hooks) nodeAdded(node *types.Node) {
+	if hk.NodeAdded != nil {
+		hk.NodeAdded(node.Proto())
+	}
+}
+
+func (hk *hooks) nodeRemoved(node *types.Node) {
+	if hk.NodeRemoved != nil {
+		hk.NodeRemoved(node.Proto())
+	}
+}
+
+func (hk *hooks) nodeOnlineChanged(node *types.Node, online bool) {
+	switch {
+	case online && hk.NodeOnline != nil:
+		hk.NodeOnline(node.Proto())
+	case !online && hk.NodeOffline != nil:
+		hk.NodeOffline(node.Proto())
+	}
+}
+
+func (hk *hooks) policyChanged(policy []byte) {
+	if hk.PolicyChanged != nil {
+		hk.PolicyChanged(string(policy))
+	}
+}
@@ -0,0 +1,44 @@
+package hscontrol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmitCachedLookupError(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+
+	called := false
+	h.hooks.Registration = types.RegistrationHookFunc(
+		func(context.Context, *types.RegistrationRequest) (*types.RegistrationDecision, error) {
+			called = true
+			return &types.RegistrationDecision{}, nil
+		},
+	)
+
+	user := &types.User{Name: "alice"}
+	expiry := time.Now().Add(time.Hour)
+
+	// A registration that does not exist is left to fail when it is
+	// registered.
+	regID, err := types.NewRegistrationID()
+	require.NoError(t, err)
+
+	got, err := h.hooks.admitCached(context.Background(), regID, user, util.RegisterMethodCLI, &expiry)
+	require.NoError(t, err)
+	assert.Equal(t, &expiry, got)
+	assert.False(t, called)
+
+	// Failing to look up the registration does not skip the hook.
+	require.NoError(t, h.db.Close())
+
+	_, err = h.hooks.admitCached(context.Background(), regID, user, util.RegisterMethodCLI, &expiry)
+	require.Error(t, err)
+	assert.False(t, called)
+}
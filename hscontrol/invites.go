@@ -0,0 +1,120 @@
+package hscontrol
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/templates"
+	"github.com/juanfont/headscale/hscontrol/types"
+)
+
+const invitePath = "/invite"
+
+// InviteURL returns the URL of the invite with the given token.
+func (h *Headscale) InviteURL(token string) string {
+	return fmt.Sprintf("%s%s/%s", strings.TrimSuffix(h.cfg.ServerURL, "/"), invitePath, token)
+}
+
+// InviteHandler shows the landing page of an invite, telling how to install
+// Tailscale. The invite is only accepted with a POST, so that link previews
+// do not use it up.
+// Listens in /invite/{token}.
+func (h *Headscale) InviteHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	token := mux.Vars(req)["token"]
+
+	invite, err := h.usableInvite(token)
+	if err != nil {
+		httpError(writer, err)
+		return
+	}
+
+	_, oidc := h.authProvider.(*AuthProviderOIDC)
+	writeHTML(writer, http.StatusOK, templates.Invite(invite.Email, oidc, invitePath+"/"+token).Render())
+}
+
+// AcceptInviteHandler accepts an invite. With OIDC, the invited person is
+// sent to log in first, and the invite is accepted in the callback.
+// Otherwise it is accepted as a local user with the email of the invite.
+// Listens in POST /invite/{token}.
+func (h *Headscale) AcceptInviteHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	invite, err := h.usableInvite(mux.Vars(req)["token"])
+	if err != nil {
+		httpError(writer, err)
+		return
+	}
+
+	if provider, ok := h.authProvider.(*AuthProviderOIDC); ok {
+		provider.redirectToProvider(writer, req, types.OIDCLogin{InviteID: &invite.ID})
+		return
+	}
+
+	user, key, err := h.db.AcceptInvite(invite.ID, nil)
+	if err != nil {
+		httpError(writer, inviteHTTPError(err))
+		return
+	}
+
+	err = usersChangedHook(h.db, h.nodeStore, h.polMan, h.nodeNotifier)
+	if err != nil {
+		httpError(writer, fmt.Errorf("updating resources using user: %w", err))
+		return
+	}
+
+	h.logger.Info().
+		Uint64("invite.id", invite.ID).
+		Uint("user.id", user.ID).
+		Str("user.name", user.Name).
+		Msg("invite accepted as local user")
+
+	writeInviteAccepted(writer, h.cfg.ServerURL, user, key)
+}
+
+// usableInvite returns the invite of the token, if it can still be
+// accepted.
+func (h *Headscale) usableInvite(token string) (*types.Invite, error) {
+	invite, err := h.db.GetInvite(token)
+	if err != nil {
+		return nil, inviteHTTPError(err)
+	}
+
+	if err := db.CheckInvite(invite); err != nil {
+		return nil, inviteHTTPError(err)
+	}
+
+	return invite, nil
+}
+
+func writeInviteAccepted(writer http.ResponseWriter, serverURL string, user *types.User, key *types.PreAuthKey) {
+	writeHTML(writer, http.StatusOK,
+		templates.InviteAccepted(serverURL, user.Display(), key.Key, *key.Expiration).Render())
+}
+
+// inviteHTTPError turns the errors of looking up and accepting an invite
+// into errors shown to the invited person.
+func inviteHTTPError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrInviteNotFound):
+		return NewHTTPError(http.StatusNotFound, "invite not found", err)
+	case errors.Is(err, db.ErrInviteUsed),
+		errors.Is(err, db.ErrInviteRevoked),
+		errors.Is(err, db.ErrInviteExpired):
+		return NewHTTPError(http.StatusGone, err.Error(), err)
+	case errors.Is(err, db.ErrInviteEmail),
+		errors.Is(err, db.ErrUserDisabled):
+		return NewHTTPError(http.StatusForbidden, err.Error(), err)
+	case errors.Is(err, db.ErrInviteInvalid):
+		return NewHTTPError(http.StatusBadRequest, err.Error(), err)
+	}
+
+	return quotaHTTPError(err)
+}
@@ -0,0 +1,102 @@
+package hscontrol
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func inviteRequest(t *testing.T, handler http.HandlerFunc, method, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, invitePath+"/"+token, nil)
+	req = mux.SetURLVars(req, map[string]string{"token": token})
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	return rec
+}
+
+func TestInviteLocalUser(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	h.cfg.ServerURL = "https://headscale.example.com"
+	api := headscaleV1APIServer{h: h}
+
+	// Without OIDC, an invite is accepted as a local user named after its
+	// email.
+	_, err := api.CreateInvite(context.Background(), &v1.CreateInviteRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(grpcStatusError(err)))
+
+	created, err := api.CreateInvite(context.Background(), &v1.CreateInviteRequest{
+		Email: "alice@example.com",
+		Tags:  []string{"tag:contractor"},
+	})
+	require.NoError(t, err)
+
+	token, found := strings.CutPrefix(created.GetUrl(), "https://headscale.example.com/invite/")
+	require.True(t, found, created.GetUrl())
+
+	rec := inviteRequest(t, h.InviteHandler, http.MethodGet, token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "alice@example.com")
+
+	// Opening the landing page does not accept the invite.
+	listed, err := api.ListInvites(context.Background(), &v1.ListInvitesRequest{})
+	require.NoError(t, err)
+	require.Len(t, listed.GetInvites(), 1)
+	assert.Equal(t, types.InviteStatusPending, listed.GetInvites()[0].GetStatus())
+
+	rec = inviteRequest(t, h.AcceptInviteHandler, http.MethodPost, token)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "--authkey ")
+
+	user, err := h.db.GetUserByName("alice@example.com")
+	require.NoError(t, err)
+
+	keys, err := h.db.ListPreAuthKeys(types.UserID(user.ID))
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, []string{"tag:contractor"}, keys[0].Tags)
+
+	listed, err = api.ListInvites(context.Background(), &v1.ListInvitesRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, types.InviteStatusAccepted, listed.GetInvites()[0].GetStatus())
+	assert.Equal(t, uint64(user.ID), listed.GetInvites()[0].GetUserId())
+
+	// The link can only be used once.
+	rec = inviteRequest(t, h.AcceptInviteHandler, http.MethodPost, token)
+	assert.Equal(t, http.StatusGone, rec.Code)
+
+	rec = inviteRequest(t, h.InviteHandler, http.MethodGet, "0123456789abcdef")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRevokeInvite(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := headscaleV1APIServer{h: h}
+
+	created, err := api.CreateInvite(context.Background(), &v1.CreateInviteRequest{Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	revoked, err := api.RevokeInvite(context.Background(), &v1.RevokeInviteRequest{Id: created.GetInvite().GetId()})
+	require.NoError(t, err)
+	assert.Equal(t, types.InviteStatusRevoked, revoked.GetInvite().GetStatus())
+
+	token := created.GetUrl()[strings.LastIndex(created.GetUrl(), "/")+1:]
+	rec := inviteRequest(t, h.AcceptInviteHandler, http.MethodPost, token)
+	assert.Equal(t, http.StatusGone, rec.Code)
+
+	_, err = api.RevokeInvite(context.Background(), &v1.RevokeInviteRequest{Id: 1000})
+	assert.Equal(t, codes.NotFound, status.Code(grpcStatusError(err)))
+}
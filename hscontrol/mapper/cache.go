@@ -0,0 +1,325 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sync"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/deephash"
+)
+
+// peerKey identifies a marshalled peer as seen by a set of viewers.
+// The same peer is rendered differently depending on the capability
+// version of the viewer, the routes the viewer is allowed to use and
+// if the peer is online.
+type peerKey struct {
+	id     types.NodeID
+	capVer tailcfg.CapabilityVersion
+	online bool
+	routes string
+}
+
+// viewKey identifies the complete, marshalled, list of peers of a node.
+// Nodes with the same view, for example all nodes with the same tag,
+// share the list.
+type viewKey struct {
+	policyVersion uint64
+	nodesVersion  uint64
+	view          deephash.Sum
+}
+
+// filterKey identifies the marshalled packet filter of a node. The
+// reduced filter only depends on the addresses and routes of the node.
+type filterKey struct {
+	policyVersion uint64
+	node          deephash.Sum
+}
+
+// cacheVersion is the version of the cache at the time the data used
+// to build a cache entry was read. Entries are only stored if the cache
+// has not been invalidated in the meantime.
+type cacheVersion struct {
+	policy uint64
+	nodes  uint64
+}
+
+// mapResponseCache holds pre-marshalled parts of map responses that
+// can be shared between nodes so full map responses mostly splice
+// cached bytes instead of converting and marshalling every peer.
+//
+// The cache is invalidated from the updates passing through the
+// notifier: a full update invalidates everything, as it is sent
+// when the policy changes, while peer updates only invalidate the
+// peers that changed.
+type mapResponseCache struct {
+	mu      sync.Mutex
+	metrics *cacheMetrics
+
+	policyVersion uint64
+	nodesVersion  uint64
+
+	peers   map[peerKey][]byte
+	views   map[viewKey][]byte
+	filters map[filterKey]*cachedFilter
+}
+
+func newMapResponseCache(metrics *cacheMetrics) *mapResponseCache {
+	return &mapResponseCache{
+		metrics: metrics,
+		peers:   make(map[peerKey][]byte),
+		views:   make(map[viewKey][]byte),
+		filters: make(map[filterKey]*cachedFilter),
+	}
+}
+
+// invalidate removes the entries made stale by the given update.
+func (c *mapResponseCache) invalidate(update types.StateUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var changed []types.NodeID
+
+	switch update.Type {
+	case types.StateFullUpdate:
+		c.policyVersion++
+		c.nodesVersion++
+		clear(c.peers)
+		clear(c.views)
+		clear(c.filters)
+		c.metrics.invalidations.WithLabelValues("full").Inc()
+
+		return
+	case types.StatePeerChanged, types.StateSelfUpdate:
+		changed = update.ChangeNodes
+	case types.StatePeerRemoved:
+		changed = update.Removed
+	case types.StatePeerChangedPatch:
+		for _, patch := range update.ChangePatches {
+			changed = append(changed, types.NodeID(patch.NodeID))
+		}
+	default:
+		return
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+
+	c.nodesVersion++
+	clear(c.views)
+
+	for key := range c.peers {
+		for _, id := range changed {
+			if key.id == id {
+				delete(c.peers, key)
+				break
+			}
+		}
+	}
+	c.metrics.invalidations.WithLabelValues("peers").Inc()
+}
+
+func (c *mapResponseCache) version() cacheVersion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return cacheVersion{policy: c.policyVersion, nodes: c.nodesVersion}
+}
+
+// cachedPeer is a peer that is about to be added to a peer list, with
+// the routes the viewer is allowed to use.
+type cachedPeer struct {
+	node   *types.Node
+	routes []netip.Prefix
+}
+
+func (p cachedPeer) key(capVer tailcfg.CapabilityVersion) peerKey {
+	key := peerKey{
+		id:     p.node.ID,
+		capVer: capVer,
+		online: p.node.IsOnline != nil && *p.node.IsOnline,
+	}
+	if len(p.routes) > 0 {
+		key.routes = fmt.Sprint(p.routes)
+	}
+
+	return key
+}
+
+// peerList returns the marshalled JSON array of the given peers, which
+// must be sorted by ID. Peers missing from the cache are converted with
+// render and stored if the cache has not been invalidated since ver.
+func (c *mapResponseCache) peerList(
+	ver cacheVersion,
+	capVer tailcfg.CapabilityVersion,
+	peers []cachedPeer,
+	render func(cachedPeer) (*tailcfg.Node, error),
+) ([]byte, error) {
+	keys := make([]peerKey, len(peers))
+	for i, peer := range peers {
+		keys[i] = peer.key(capVer)
+	}
+
+	vKey := viewKey{
+		policyVersion: ver.policy,
+		nodesVersion:  ver.nodes,
+		view:          deephash.Hash(&keys),
+	}
+
+	c.mu.Lock()
+	if list, ok := c.views[vKey]; ok {
+		c.mu.Unlock()
+		c.metrics.requests.WithLabelValues("view", "hit").Inc()
+
+		return list, nil
+	}
+
+	entries := make([][]byte, len(peers))
+	for i, key := range keys {
+		entries[i] = c.peers[key]
+	}
+	c.mu.Unlock()
+	c.metrics.requests.WithLabelValues("view", "miss").Inc()
+
+	fresh := make(map[peerKey][]byte)
+	for i, peer := range peers {
+		if entries[i] != nil {
+			c.metrics.requests.WithLabelValues("peer", "hit").Inc()
+			continue
+		}
+		c.metrics.requests.WithLabelValues("peer", "miss").Inc()
+
+		tailPeer, err := render(peer)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := json.Marshal(tailPeer)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling peer: %w", err)
+		}
+
+		entries[i] = entry
+		fresh[keys[i]] = entry
+	}
+
+	list := append([]byte{'['}, bytes.Join(entries, []byte{','})...)
+	list = append(list, ']')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.policyVersion == ver.policy && c.nodesVersion == ver.nodes {
+		for key, entry := range fresh {
+			c.peers[key] = entry
+		}
+		c.views[vKey] = list
+	}
+
+	return list, nil
+}
+
+// cachedFilter is the reduced packet filter of a node, it must not be
+// modified as it is shared between nodes.
+type cachedFilter struct {
+	// chunks is the filter split in named chunks.
+	chunks map[string][]tailcfg.FilterRule
+
+	// chunksJSON is the marshalled PacketFilters replacing all the
+	// named packet filters of a client with chunks.
+	chunksJSON []byte
+}
+
+func newCachedFilter(rules []tailcfg.FilterRule) (*cachedFilter, error) {
+	filter := &cachedFilter{
+		chunks: packetFilterChunks(rules),
+	}
+
+	var err error
+	filter.chunksJSON, err = json.Marshal(fullPacketFilters(filter.chunks))
+	if err != nil {
+		return nil, fmt.Errorf("marshalling packet filter: %w", err)
+	}
+
+	return filter, nil
+}
+
+// filter returns the reduced packet filter of the node. The filter is
+// computed with reduce if it is not cached and stored if the cache has
+// not been invalidated since ver.
+func (c *mapResponseCache) filter(
+	ver cacheVersion,
+	node *types.Node,
+	reduce func() []tailcfg.FilterRule,
+) (*cachedFilter, error) {
+	nodeState := struct {
+		Addrs  []netip.Prefix
+		Routes []netip.Prefix
+	}{
+		Addrs: node.Prefixes(),
+	}
+	if node.Hostinfo != nil {
+		nodeState.Routes = node.Hostinfo.RoutableIPs
+	}
+
+	key := filterKey{
+		policyVersion: ver.policy,
+		node:          deephash.Hash(&nodeState),
+	}
+
+	c.mu.Lock()
+	if filter, ok := c.filters[key]; ok {
+		c.mu.Unlock()
+		c.metrics.requests.WithLabelValues("filter", "hit").Inc()
+
+		return filter, nil
+	}
+	c.mu.Unlock()
+	c.metrics.requests.WithLabelValues("filter", "miss").Inc()
+
+	filter, err := newCachedFilter(reduce())
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.policyVersion == ver.policy {
+		c.filters[key] = filter
+	}
+
+	return filter, nil
+}
+
+// spliceJSONObject appends the given pre-marshalled fields to the
+// marshalled JSON object obj.
+func spliceJSONObject(obj []byte, fields ...[]byte) ([]byte, error) {
+	obj = bytes.TrimSpace(obj)
+	if len(obj) < 2 || obj[0] != '{' || obj[len(obj)-1] != '}' {
+		return nil, fmt.Errorf("splicing map response: %q is not a JSON object", obj)
+	}
+
+	size := len(obj)
+	for _, field := range fields {
+		size += len(field) + 1
+	}
+
+	out := make([]byte, 0, size)
+	out = append(out, obj[:len(obj)-1]...)
+	empty := len(obj) == 2
+
+	for _, field := range fields {
+		if !empty {
+			out = append(out, ',')
+		}
+		out = append(out, field...)
+		empty = false
+	}
+
+	return append(out, '}'), nil
+}
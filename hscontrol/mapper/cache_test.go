@@ -0,0 +1,76 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+)
+
+func TestMapResponseCacheInvalidate(t *testing.T) {
+	cache := newMapResponseCache(newCacheMetrics(nil))
+
+	renders := 0
+	render := func(peer cachedPeer) (*tailcfg.Node, error) {
+		renders++
+
+		return &tailcfg.Node{ID: peer.node.ID.NodeID()}, nil
+	}
+
+	peers := []cachedPeer{
+		{node: &types.Node{ID: 1}},
+		{node: &types.Node{ID: 2}},
+	}
+
+	list, err := cache.peerList(cache.version(), 0, peers, render)
+	require.NoError(t, err)
+	assert.Equal(t, 2, renders)
+
+	// The same view is served from the cache.
+	again, err := cache.peerList(cache.version(), 0, peers, render)
+	require.NoError(t, err)
+	assert.Equal(t, 2, renders)
+	assert.Equal(t, list, again)
+
+	// A different capability version renders the peers again.
+	_, err = cache.peerList(cache.version(), 1, peers, render)
+	require.NoError(t, err)
+	assert.Equal(t, 4, renders)
+
+	// A changed peer is rendered again, the other is reused.
+	cache.invalidate(types.UpdatePeerChanged(1))
+	_, err = cache.peerList(cache.version(), 0, peers, render)
+	require.NoError(t, err)
+	assert.Equal(t, 5, renders)
+
+	// DERP updates do not change the peers.
+	cache.invalidate(types.StateUpdate{Type: types.StateDERPUpdated})
+	_, err = cache.peerList(cache.version(), 0, peers, render)
+	require.NoError(t, err)
+	assert.Equal(t, 5, renders)
+
+	// Entries built from data read before an invalidation are not stored.
+	stale := cache.version()
+	cache.invalidate(types.UpdateFull())
+	_, err = cache.peerList(stale, 0, peers, render)
+	require.NoError(t, err)
+	assert.Equal(t, 7, renders)
+	_, err = cache.peerList(cache.version(), 0, peers, render)
+	require.NoError(t, err)
+	assert.Equal(t, 9, renders)
+}
+
+func TestSpliceJSONObject(t *testing.T) {
+	got, err := spliceJSONObject([]byte(`{}`), []byte(`"A":1`), []byte(`"B":[]`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"A":1,"B":[]}`, string(got))
+
+	got, err = spliceJSONObject([]byte(`{"A":1}`), []byte(`"B":{"base":null}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"A":1,"B":{"base":null}}`, string(got))
+
+	_, err = spliceJSONObject([]byte(`[]`), []byte(`"A":1`))
+	require.Error(t, err)
+}
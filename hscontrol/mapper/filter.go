@@ -0,0 +1,138 @@
+package mapper
+
+import (
+	"sync"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/deephash"
+	"tailscale.com/util/set"
+)
+
+// All supported clients understand named packet filters, MapResponse.PacketFilters
+// was added in capability version 81.
+const (
+	// packetFilterClearAll is the PacketFilters key that clears all the
+	// named packet filters the client has.
+	packetFilterClearAll = "*"
+
+	packetFilterChunkPrefix  = "acl-"
+	packetFilterChunkNameLen = 16
+)
+
+// packetFilterChunks splits the reduced packet filter of a node into
+// named chunks, one for every compiled ACL entry. Chunks are named after
+// their content, so an ACL entry that did not change keeps its name, and
+// is not sent again, when other parts of the policy change.
+func packetFilterChunks(rules []tailcfg.FilterRule) map[string][]tailcfg.FilterRule {
+	chunks := make(map[string][]tailcfg.FilterRule, len(rules))
+	for _, rule := range rules {
+		sum := deephash.Hash(&rule).String()
+		chunks[packetFilterChunkPrefix+sum[:packetFilterChunkNameLen]] = []tailcfg.FilterRule{rule}
+	}
+
+	return chunks
+}
+
+// fullPacketFilters returns the PacketFilters replacing all the named
+// packet filters of a client with chunks.
+func fullPacketFilters(chunks map[string][]tailcfg.FilterRule) map[string][]tailcfg.FilterRule {
+	filters := make(map[string][]tailcfg.FilterRule, len(chunks)+1)
+	filters[packetFilterClearAll] = nil
+	for name, chunk := range chunks {
+		filters[name] = chunk
+	}
+
+	return filters
+}
+
+// packetFilterTracker keeps track of the named packet filter chunks
+// that has been sent to each node, so only the chunks that changed are
+// sent when the filter changes.
+type packetFilterTracker struct {
+	mu   sync.Mutex
+	sent map[types.NodeID]set.Set[string]
+}
+
+func newPacketFilterTracker() *packetFilterTracker {
+	return &packetFilterTracker{
+		sent: make(map[types.NodeID]set.Set[string]),
+	}
+}
+
+// reset records that the node has been sent all of chunks, replacing
+// anything it had before.
+func (t *packetFilterTracker) reset(nodeID types.NodeID, chunks map[string][]tailcfg.FilterRule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.resetLocked(nodeID, chunks)
+}
+
+func (t *packetFilterTracker) resetLocked(nodeID types.NodeID, chunks map[string][]tailcfg.FilterRule) {
+	names := make(set.Set[string], len(chunks))
+	for name := range chunks {
+		names.Add(name)
+	}
+
+	t.sent[nodeID] = names
+}
+
+// update returns the PacketFilters bringing the node from the chunks it
+// was previously sent to chunks, and records chunks as sent. Added and
+// changed chunks are included, removed chunks are deleted with a nil
+// value. If nothing changed, nil is returned and the PacketFilters should
+// be omitted. If it is not known what the node has, all chunks are sent.
+func (t *packetFilterTracker) update(
+	nodeID types.NodeID,
+	chunks map[string][]tailcfg.FilterRule,
+) map[string][]tailcfg.FilterRule {
+	// The chunks are compared and recorded under the same lock, so that
+	// concurrent updates of a node do not lose what the other sent.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev, ok := t.sent[nodeID]
+	if !ok {
+		t.resetLocked(nodeID, chunks)
+
+		return fullPacketFilters(chunks)
+	}
+
+	var filters map[string][]tailcfg.FilterRule
+	for name, chunk := range chunks {
+		if !prev.Contains(name) {
+			if filters == nil {
+				filters = make(map[string][]tailcfg.FilterRule)
+			}
+			filters[name] = chunk
+		}
+	}
+
+	for name := range prev {
+		if _, ok := chunks[name]; !ok {
+			if filters == nil {
+				filters = make(map[string][]tailcfg.FilterRule)
+			}
+			filters[name] = nil
+		}
+	}
+
+	if filters != nil {
+		t.resetLocked(nodeID, chunks)
+	}
+
+	return filters
+}
+
+// forget removes what has been sent to the nodes, they will be sent
+// all chunks on the next update. It is used when nodes disconnect or are
+// removed.
+func (t *packetFilterTracker) forget(nodeIDs ...types.NodeID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, id := range nodeIDs {
+		delete(t.sent, id)
+	}
+}
@@ -0,0 +1,104 @@
+package mapper
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+)
+
+func TestPacketFilterTracker(t *testing.T) {
+	ruleA := tailcfg.FilterRule{
+		SrcIPs:   []string{"100.64.0.1/32"},
+		DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.2/32", Ports: tailcfg.PortRangeAny}},
+	}
+	ruleB := tailcfg.FilterRule{
+		SrcIPs:   []string{"100.64.0.2/32"},
+		DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny}},
+	}
+	ruleC := tailcfg.FilterRule{
+		SrcIPs:   []string{"100.64.0.3/32"},
+		DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny}},
+	}
+
+	chunksAB := packetFilterChunks([]tailcfg.FilterRule{ruleA, ruleB})
+	chunksAC := packetFilterChunks([]tailcfg.FilterRule{ruleA, ruleC})
+	require.Len(t, chunksAB, 2)
+
+	nameOf := func(chunks map[string][]tailcfg.FilterRule, rule tailcfg.FilterRule) string {
+		for name, chunk := range chunks {
+			if cmp.Equal(chunk, []tailcfg.FilterRule{rule}) {
+				return name
+			}
+		}
+		t.Fatalf("rule %v not found in chunks", rule)
+
+		return ""
+	}
+
+	// Unchanged rules keep their name.
+	assert.Equal(t, nameOf(chunksAB, ruleA), nameOf(chunksAC, ruleA))
+
+	tracker := newPacketFilterTracker()
+	const nodeID = types.NodeID(1)
+
+	// A node that has not been sent anything gets everything.
+	got := tracker.update(nodeID, chunksAB)
+	assert.Equal(t, fullPacketFilters(chunksAB), got)
+	assert.Contains(t, got, packetFilterClearAll)
+
+	// Nothing changed.
+	assert.Nil(t, tracker.update(nodeID, chunksAB))
+
+	// Only the changed ACL entry is sent.
+	got = tracker.update(nodeID, chunksAC)
+	want := map[string][]tailcfg.FilterRule{
+		nameOf(chunksAB, ruleB): nil,
+		nameOf(chunksAC, ruleC): {ruleC},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("update() unexpected result (-want +got):\n%s", diff)
+	}
+
+	// Removing all rules deletes all chunks.
+	got = tracker.update(nodeID, packetFilterChunks(nil))
+	assert.ElementsMatch(t, slices.Collect(maps.Keys(chunksAC)), slices.Collect(maps.Keys(got)))
+	for _, chunk := range got {
+		assert.Nil(t, chunk)
+	}
+
+	// A forgotten node gets everything again.
+	tracker.forget(nodeID)
+	assert.Equal(t, fullPacketFilters(chunksAB), tracker.update(nodeID, chunksAB))
+}
+
+func TestSetPacketFilters(t *testing.T) {
+	m := &Mapper{filters: newPacketFilterTracker()}
+	node := &types.Node{ID: 1}
+	rules := []tailcfg.FilterRule{
+		{
+			SrcIPs:   []string{"100.64.0.2/32"},
+			DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny}},
+		},
+	}
+
+	// Clients get chunks, and nothing if the filter did not change.
+	var resp tailcfg.MapResponse
+	m.setPacketFilters(&resp, node, rules, true)
+	assert.Nil(t, resp.PacketFilter)
+	assert.Equal(t, fullPacketFilters(packetFilterChunks(rules)), resp.PacketFilters)
+
+	resp = tailcfg.MapResponse{}
+	m.setPacketFilters(&resp, node, rules, false)
+	assert.Nil(t, resp.PacketFilters)
+
+	// An empty filter on a full update only clears the previous filters.
+	resp = tailcfg.MapResponse{}
+	m.setPacketFilters(&resp, node, nil, true)
+	assert.Equal(t, map[string][]tailcfg.FilterRule{packetFilterClearAll: nil}, resp.PacketFilters)
+}
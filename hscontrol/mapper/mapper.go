@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"cmp"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -23,6 +24,7 @@ import (
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 	"tailscale.com/envknob"
 	"tailscale.com/smallzstd"
@@ -53,12 +55,14 @@ var debugDumpMapResponsePath = envknob.String("HEADSCALE_DEBUG_DUMP_MAPRESPONSE_
 type Mapper struct {
 	// Configuration
 	// TODO(kradalby): figure out if this is the format we want this in
-	db      *db.HSDatabase
+	nodes   *db.NodeStore
 	cfg     *types.Config
 	derpMap *tailcfg.DERPMap
 	notif   *notifier.Notifier
 	polMan  policy.PolicyManager
 	primary *routes.PrimaryRoutes
+	cache   *mapResponseCache
+	filters *packetFilterTracker
 
 	uid     string
 	created time.Time
@@ -71,27 +75,51 @@ type patch struct {
 }
 
 func NewMapper(
-	db *db.HSDatabase,
+	nodes *db.NodeStore,
 	cfg *types.Config,
 	derpMap *tailcfg.DERPMap,
 	notif *notifier.Notifier,
 	polMan policy.PolicyManager,
 	primary *routes.PrimaryRoutes,
+	reg prometheus.Registerer,
 ) *Mapper {
 	uid, _ := util.GenerateRandomStringDNSSafe(mapperIDLength)
 
-	return &Mapper{
-		db:      db,
+	m := &Mapper{
+		nodes:   nodes,
 		cfg:     cfg,
 		derpMap: derpMap,
 		notif:   notif,
 		polMan:  polMan,
 		primary: primary,
+		cache:   newMapResponseCache(newCacheMetrics(reg)),
+		filters: newPacketFilterTracker(),
 
 		uid:     uid,
 		created: time.Now(),
 		seq:     0,
 	}
+
+	if notif != nil {
+		notif.OnUpdate(m.invalidate)
+	}
+
+	return m
+}
+
+// invalidate drops the state derived from the nodes changed by update.
+func (m *Mapper) invalidate(update types.StateUpdate) {
+	m.cache.invalidate(update)
+
+	if update.Type == types.StatePeerRemoved {
+		m.filters.forget(update.Removed...)
+	}
+}
+
+// NodeDisconnected drops the state kept for the node while it is
+// connected, it is sent everything again when it reconnects.
+func (m *Mapper) NodeDisconnected(nodeID types.NodeID) {
+	m.filters.forget(nodeID)
 }
 
 func (m *Mapper) String() string {
@@ -188,26 +216,126 @@ func (m *Mapper) fullMapResponse(
 		return nil, err
 	}
 
+	filter, _ := m.polMan.Filter()
+	m.setPacketFilters(resp, node, policy.ReduceFilterRules(node, filter), true)
+
 	return resp, nil
 }
 
+// fullMapResponseJSON creates the marshalled, complete, MapResponse for
+// a node. It is equivalent to fullMapResponse, but the peers and the packet
+// filter are spliced in from the cache, which is shared between all nodes
+// with the same view of the tailnet.
+func (m *Mapper) fullMapResponseJSON(
+	ver cacheVersion,
+	node *types.Node,
+	peers types.Nodes,
+	capVer tailcfg.CapabilityVersion,
+) ([]byte, error) {
+	resp, err := m.baseWithConfigMapResponse(node, capVer)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, matchers := m.polMan.Filter()
+
+	sshPolicy, err := m.polMan.SSHPolicy(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(filter) > 0 {
+		peers = policy.ReduceNodes(node, peers, matchers)
+	}
+
+	resp.DNSConfig = generateDNSConfig(m.cfg, node)
+	resp.UserProfiles = generateUserProfiles(node, peers)
+	resp.SSHPolicy = sshPolicy
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling map response: %w", err)
+	}
+
+	var fields [][]byte
+
+	// Peers is always returned sorted by Node.ID.
+	if len(peers) > 0 {
+		sorted := slices.Clone(peers)
+		slices.SortStableFunc(sorted, func(a, b *types.Node) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+
+		cached := make([]cachedPeer, len(sorted))
+		for i, peer := range sorted {
+			cached[i] = cachedPeer{
+				node:   peer,
+				routes: policy.ReduceRoutes(node, m.primary.PrimaryRoutes(peer.ID), matchers),
+			}
+		}
+
+		list, err := m.cache.peerList(ver, capVer, cached, func(peer cachedPeer) (*tailcfg.Node, error) {
+			return tailNode(
+				peer.node, capVer, m.polMan,
+				func(types.NodeID) []netip.Prefix {
+					return peer.routes
+				},
+				m.cfg)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, append([]byte(`"Peers":`), list...))
+	}
+
+	cached, err := m.cache.filter(ver, node, func() []tailcfg.FilterRule {
+		return policy.ReduceFilterRules(node, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.filters.reset(node.ID, cached.chunks)
+	fields = append(fields, append([]byte(`"PacketFilters":`), cached.chunksJSON...))
+
+	return spliceJSONObject(body, fields...)
+}
+
 // FullMapResponse returns a MapResponse for the given node.
 func (m *Mapper) FullMapResponse(
 	mapRequest tailcfg.MapRequest,
 	node *types.Node,
 	messages ...string,
 ) ([]byte, error) {
+	// The version must be read before the peers, so anything
+	// rendered from peers that changed while building the response
+	// is not stored in the cache.
+	ver := m.cache.version()
+
 	peers, err := m.ListPeers(node.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := m.fullMapResponse(node, peers, mapRequest.Version)
+	// The debug dump needs the complete response object.
+	if debugDumpMapResponsePath != "" {
+		resp, err := m.fullMapResponse(node, peers, mapRequest.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		return m.marshalMapResponse(mapRequest, resp, node, mapRequest.Compress, messages...)
+	}
+
+	jsonBody, err := m.fullMapResponseJSON(ver, node, peers, mapRequest.Version)
 	if err != nil {
 		return nil, err
 	}
 
-	return m.marshalMapResponse(mapRequest, resp, node, mapRequest.Compress, messages...)
+	atomic.AddUint64(&m.seq, 1)
+
+	return encodeMapResponse(jsonBody, mapRequest.Compress), nil
 }
 
 // ReadOnlyMapResponse returns a MapResponse for the given node.
@@ -292,6 +420,9 @@ func (m *Mapper) PeerChangedResponse(
 		return nil, err
 	}
 
+	filter, _ := m.polMan.Filter()
+	m.setPacketFilters(&resp, node, policy.ReduceFilterRules(node, filter), false)
+
 	resp.PeersRemoved = removedIDs
 
 	// Sending patches as a part of a PeersChanged response
@@ -401,6 +532,12 @@ func (m *Mapper) marshalMapResponse(
 		}
 	}
 
+	return encodeMapResponse(jsonBody, compression), nil
+}
+
+// encodeMapResponse compresses the marshalled map response if requested
+// and prefixes it with its size.
+func encodeMapResponse(jsonBody []byte, compression string) []byte {
 	var respBody []byte
 	if compression == util.ZstdCompression {
 		respBody = zstdEncode(jsonBody)
@@ -412,7 +549,7 @@ func (m *Mapper) marshalMapResponse(
 	binary.LittleEndian.PutUint32(data, uint32(len(respBody)))
 	data = append(data, respBody...)
 
-	return data, nil
+	return data
 }
 
 func zstdEncode(in []byte) []byte {
@@ -497,10 +634,7 @@ func (m *Mapper) baseWithConfigMapResponse(
 // If no peer IDs are given, all peers are returned.
 // If at least one peer ID is given, only these peer nodes will be returned.
 func (m *Mapper) ListPeers(nodeID types.NodeID, peerIDs ...types.NodeID) (types.Nodes, error) {
-	peers, err := m.db.ListPeers(nodeID, peerIDs...)
-	if err != nil {
-		return nil, err
-	}
+	peers := m.nodes.ListPeers(nodeID, peerIDs...)
 
 	for _, peer := range peers {
 		online := m.notif.IsLikelyConnected(peer.ID)
@@ -510,13 +644,10 @@ func (m *Mapper) ListPeers(nodeID types.NodeID, peerIDs ...types.NodeID) (types.
 	return peers, nil
 }
 
-// ListNodes queries the database for either all nodes if no parameters are given
+// ListNodes returns either all nodes if no parameters are given
 // or for the given nodes if at least one node ID is given as parameter
 func (m *Mapper) ListNodes(nodeIDs ...types.NodeID) (types.Nodes, error) {
-	nodes, err := m.db.ListNodes(nodeIDs...)
-	if err != nil {
-		return nil, err
-	}
+	nodes := m.nodes.ListNodes(nodeIDs...)
 
 	for _, node := range nodes {
 		online := m.notif.IsLikelyConnected(node.ID)
@@ -585,13 +716,25 @@ func appendPeerChanges(
 	resp.UserProfiles = profiles
 	resp.SSHPolicy = sshPolicy
 
-	// CapVer 81: 2023-11-17: MapResponse.PacketFilters (incremental packet filter updates)
-	// Currently, we do not send incremental package filters, however using the
-	// new PacketFilters field and "base" allows us to send a full update when we
-	// have to send an empty list, avoiding the hack in the else block.
-	resp.PacketFilters = map[string][]tailcfg.FilterRule{
-		"base": policy.ReduceFilterRules(node, filter),
+	return nil
+}
+
+// setPacketFilters sets the reduced packet filter of the node in resp,
+// split in named chunks. Unless full is set, only the chunks that changed
+// since the previous response are sent.
+func (m *Mapper) setPacketFilters(
+	resp *tailcfg.MapResponse,
+	node *types.Node,
+	rules []tailcfg.FilterRule,
+	full bool,
+) {
+	chunks := packetFilterChunks(rules)
+	if full {
+		m.filters.reset(node.ID, chunks)
+		resp.PacketFilters = fullPacketFilters(chunks)
+
+		return
 	}
 
-	return nil
+	resp.PacketFilters = m.filters.update(node.ID, chunks)
 }
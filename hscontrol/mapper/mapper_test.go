@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/netip"
 	"testing"
@@ -296,7 +297,7 @@ func Test_fullMapResponse(t *testing.T) {
 					},
 				},
 				ControlTime:   &time.Time{},
-				PacketFilters: map[string][]tailcfg.FilterRule{"base": tailcfg.FilterAllowAll},
+				PacketFilters: fullPacketFilters(packetFilterChunks(tailcfg.FilterAllowAll)),
 				Debug: &tailcfg.Debug{
 					DisableLogTail: true,
 				},
@@ -331,7 +332,7 @@ func Test_fullMapResponse(t *testing.T) {
 					{ID: tailcfg.UserID(user2.ID), LoginName: "user2", DisplayName: "user2"},
 				},
 				ControlTime:   &time.Time{},
-				PacketFilters: map[string][]tailcfg.FilterRule{"base": tailcfg.FilterAllowAll},
+				PacketFilters: fullPacketFilters(packetFilterChunks(tailcfg.FilterAllowAll)),
 				Debug: &tailcfg.Debug{
 					DisableLogTail: true,
 				},
@@ -377,20 +378,18 @@ func Test_fullMapResponse(t *testing.T) {
 				DNSConfig:       &tailcfg.DNSConfig{},
 				Domain:          "",
 				CollectServices: "false",
-				PacketFilters: map[string][]tailcfg.FilterRule{
-					"base": {
-						{
-							SrcIPs: []string{"100.64.0.2/32"},
-							DstPorts: []tailcfg.NetPortRange{
-								{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny},
-							},
-						},
-						{
-							SrcIPs:   []string{"100.64.0.1/32"},
-							DstPorts: []tailcfg.NetPortRange{{IP: "192.168.0.0/24", Ports: tailcfg.PortRangeAny}},
+				PacketFilters: fullPacketFilters(packetFilterChunks([]tailcfg.FilterRule{
+					{
+						SrcIPs: []string{"100.64.0.2/32"},
+						DstPorts: []tailcfg.NetPortRange{
+							{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny},
 						},
 					},
-				},
+					{
+						SrcIPs:   []string{"100.64.0.1/32"},
+						DstPorts: []tailcfg.NetPortRange{{IP: "192.168.0.0/24", Ports: tailcfg.PortRangeAny}},
+					},
+				})),
 				SSHPolicy: nil,
 				UserProfiles: []tailcfg.UserProfile{
 					{ID: tailcfg.UserID(user1.ID), LoginName: "user1", DisplayName: "user1"},
@@ -423,6 +422,7 @@ func Test_fullMapResponse(t *testing.T) {
 				nil,
 				polMan,
 				primary,
+				nil,
 			)
 
 			got, err := mappy.fullMapResponse(
@@ -446,6 +446,47 @@ func Test_fullMapResponse(t *testing.T) {
 			); diff != "" {
 				t.Errorf("fullMapResponse() unexpected result (-want +got):\n%s", diff)
 			}
+
+			if tt.wantErr {
+				return
+			}
+
+			// The spliced response must marshal to the same JSON as the
+			// complete one, both when it is built and when it is served
+			// from the cache.
+			for _, capVer := range []tailcfg.CapabilityVersion{0, tailcfg.CurrentCapabilityVersion} {
+				full, err := mappy.fullMapResponse(tt.node, tt.peers, capVer)
+				require.NoError(t, err)
+
+				wantJSON := mapResponseJSONObject(t, full)
+				for _, pass := range []string{"miss", "hit"} {
+					body, err := mappy.fullMapResponseJSON(mappy.cache.version(), tt.node, tt.peers, capVer)
+					require.NoError(t, err)
+
+					var spliced map[string]any
+					require.NoError(t, json.Unmarshal(body, &spliced))
+					delete(spliced, "ControlTime")
+
+					if diff := cmp.Diff(wantJSON, spliced); diff != "" {
+						t.Errorf("fullMapResponseJSON(capver %d) cache %s unexpected result (-want +got):\n%s", capVer, pass, diff)
+					}
+				}
+			}
 		})
 	}
 }
+
+// mapResponseJSONObject returns the map response as a generic JSON
+// object, without the ControlTime.
+func mapResponseJSONObject(t *testing.T, resp *tailcfg.MapResponse) map[string]any {
+	t.Helper()
+
+	body, err := json.Marshal(resp)
+	require.NoError(t, err)
+
+	var obj map[string]any
+	require.NoError(t, json.Unmarshal(body, &obj))
+	delete(obj, "ControlTime")
+
+	return obj
+}
@@ -0,0 +1,33 @@
+package mapper
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const prometheusNamespace = "headscale"
+
+// cacheMetrics holds the metrics of a map response cache.
+type cacheMetrics struct {
+	requests      *prometheus.CounterVec
+	invalidations *prometheus.CounterVec
+}
+
+// newCacheMetrics creates the map response cache metrics and registers
+// them with reg. If reg is nil, the metrics are not registered.
+func newCacheMetrics(reg prometheus.Registerer) *cacheMetrics {
+	factory := promauto.With(reg)
+
+	return &cacheMetrics{
+		requests: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "mapresponse_cache_requests_total",
+			Help:      "total count of map response cache lookups",
+		}, []string{"type", "result"}),
+		invalidations: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "mapresponse_cache_invalidations_total",
+			Help:      "total count of map response cache invalidations",
+		}, []string{"type"}),
+	}
+}
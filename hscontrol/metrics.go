@@ -7,71 +7,91 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"tailscale.com/envknob"
 )
 
 var debugHighCardinalityMetrics = envknob.Bool("HEADSCALE_DEBUG_HIGH_CARDINALITY_METRICS")
 
-var mapResponseLastSentSeconds *prometheus.GaugeVec
+const prometheusNamespace = "headscale"
+
+// metrics holds the metrics of a Headscale instance. Every instance has
+// its own metrics, registered with its own registry, so multiple instances
+// can live in one process.
+type metrics struct {
+	mapResponseLastSentSeconds *prometheus.GaugeVec
+	mapResponseSent            *prometheus.CounterVec
+	mapResponseUpdateReceived  *prometheus.CounterVec
+	mapResponseEndpointUpdates *prometheus.CounterVec
+	mapResponseReadOnly        *prometheus.CounterVec
+	mapResponseEnded           *prometheus.CounterVec
+	mapResponseClosed          *prometheus.CounterVec
+	httpDuration               *prometheus.HistogramVec
+	httpCounter                *prometheus.CounterVec
+}
+
+// newMetrics creates the metrics of a Headscale instance and registers
+// them with reg. If reg is nil, the metrics are not registered.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	factory := promauto.With(reg)
+
+	m := &metrics{
+		mapResponseSent: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "mapresponse_sent_total",
+			Help:      "total count of mapresponses sent to clients",
+		}, []string{"status", "type"}),
+		mapResponseUpdateReceived: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "mapresponse_updates_received_total",
+			Help:      "total count of mapresponse updates received on update channel",
+		}, []string{"type"}),
+		mapResponseEndpointUpdates: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "mapresponse_endpoint_updates_total",
+			Help:      "total count of endpoint updates received",
+		}, []string{"status"}),
+		mapResponseReadOnly: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "mapresponse_readonly_requests_total",
+			Help:      "total count of readonly requests received",
+		}, []string{"status"}),
+		mapResponseEnded: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "mapresponse_ended_total",
+			Help:      "total count of new mapsessions ended",
+		}, []string{"reason"}),
+		mapResponseClosed: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "mapresponse_closed_total",
+			Help:      "total count of calls to mapresponse close",
+		}, []string{"return"}),
+		httpDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "http_duration_seconds",
+			Help:      "Duration of HTTP requests.",
+		}, []string{"path"}),
+		httpCounter: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of http requests processed",
+		}, []string{"code", "method", "path"},
+		),
+	}
 
-func init() {
 	if debugHighCardinalityMetrics {
-		mapResponseLastSentSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		m.mapResponseLastSentSeconds = factory.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: prometheusNamespace,
 			Name:      "mapresponse_last_sent_seconds",
 			Help:      "last sent metric to node.id",
 		}, []string{"type", "id"})
 	}
-}
 
-const prometheusNamespace = "headscale"
-
-var (
-	mapResponseSent = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: prometheusNamespace,
-		Name:      "mapresponse_sent_total",
-		Help:      "total count of mapresponses sent to clients",
-	}, []string{"status", "type"})
-	mapResponseUpdateReceived = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: prometheusNamespace,
-		Name:      "mapresponse_updates_received_total",
-		Help:      "total count of mapresponse updates received on update channel",
-	}, []string{"type"})
-	mapResponseEndpointUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: prometheusNamespace,
-		Name:      "mapresponse_endpoint_updates_total",
-		Help:      "total count of endpoint updates received",
-	}, []string{"status"})
-	mapResponseReadOnly = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: prometheusNamespace,
-		Name:      "mapresponse_readonly_requests_total",
-		Help:      "total count of readonly requests received",
-	}, []string{"status"})
-	mapResponseEnded = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: prometheusNamespace,
-		Name:      "mapresponse_ended_total",
-		Help:      "total count of new mapsessions ended",
-	}, []string{"reason"})
-	mapResponseClosed = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: prometheusNamespace,
-		Name:      "mapresponse_closed_total",
-		Help:      "total count of calls to mapresponse close",
-	}, []string{"return"})
-	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: prometheusNamespace,
-		Name:      "http_duration_seconds",
-		Help:      "Duration of HTTP requests.",
-	}, []string{"path"})
-	httpCounter = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: prometheusNamespace,
-		Name:      "http_requests_total",
-		Help:      "Total number of http requests processed",
-	}, []string{"code", "method", "path"},
-	)
-)
+	return m
+}
 
 // prometheusMiddleware implements mux.MiddlewareFunc.
-func prometheusMiddleware(next http.Handler) http.Handler {
+func (h *Headscale) prometheusMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		route := mux.CurrentRoute(r)
 		path, _ := route.GetPathTemplate()
@@ -85,10 +105,10 @@ func prometheusMiddleware(next http.Handler) http.Handler {
 
 		rw := &respWriterProm{ResponseWriter: w}
 
-		timer := prometheus.NewTimer(httpDuration.WithLabelValues(path))
+		timer := prometheus.NewTimer(h.metrics.httpDuration.WithLabelValues(path))
 		next.ServeHTTP(rw, r)
 		timer.ObserveDuration()
-		httpCounter.WithLabelValues(strconv.Itoa(rw.status), r.Method, path).Inc()
+		h.metrics.httpCounter.WithLabelValues(strconv.Itoa(rw.status), r.Method, path).Inc()
 	})
 }
 
@@ -113,3 +133,13 @@ func (r *respWriterProm) Write(b []byte) (int, error) {
 	r.written += int64(n)
 	return n, err
 }
+
+// MetricsHandler serves the metrics of the instance in the Prometheus
+// format, together with the metrics registered globally, like the ones
+// of the Go runtime and the process.
+func (h *Headscale) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(
+		prometheus.Gatherers{prometheus.DefaultGatherer, h.registry},
+		promhttp.HandlerOpts{},
+	)
+}
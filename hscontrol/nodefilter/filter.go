@@ -0,0 +1,431 @@
+// Package nodefilter implements the filter expressions, sort orders and
+// page tokens of the ListNodes API.
+//
+// A filter combines terms with "&&", "||", "!" and parentheses, e.g.
+// "tag:db && !online" or "(os:linux || os:windows) && seen>30d". The
+// terms are:
+//
+//	online, offline, expired
+//	tag:db              the node has the tag, "*" matches any characters
+//	user:alice          the user name, email or ID
+//	label:env           the node has the label
+//	label:env=prod      the node has the label with the value
+//	os:linux            the operating system of the node
+//	name:web-*          the given name or hostname of the node
+//	version:1.80.*      the Tailscale version of the node, also with <, <=, >, >=
+//	seen<24h, seen>30d  the node was last seen less, or more, than 24h ago
+//	expires<7d          the node expires in less than 7 days, or has expired
+//	expires>7d          the node expires in more than 7 days, or never
+package nodefilter
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/prometheus/common/model"
+	"tailscale.com/util/cmpver"
+)
+
+var ErrInvalidFilter = errors.New("invalid node filter")
+
+const (
+	// maxFilterLength and maxFilterDepth bound the work of parsing a
+	// filter, the parser recurses on every "(" and "!".
+	maxFilterLength = 4096
+	maxFilterDepth  = 64
+)
+
+// Filter is a parsed filter expression.
+type Filter struct {
+	root expr
+}
+
+// Match reports whether the node matches the filter, at time now. An
+// empty filter matches every node.
+func (f *Filter) Match(node *v1.Node, now time.Time) bool {
+	if f == nil || f.root == nil {
+		return true
+	}
+
+	return f.root.match(node, now)
+}
+
+type expr interface {
+	match(node *v1.Node, now time.Time) bool
+}
+
+type andExpr struct{ left, right expr }
+
+func (e andExpr) match(node *v1.Node, now time.Time) bool {
+	return e.left.match(node, now) && e.right.match(node, now)
+}
+
+type orExpr struct{ left, right expr }
+
+func (e orExpr) match(node *v1.Node, now time.Time) bool {
+	return e.left.match(node, now) || e.right.match(node, now)
+}
+
+type notExpr struct{ expr expr }
+
+func (e notExpr) match(node *v1.Node, now time.Time) bool {
+	return !e.expr.match(node, now)
+}
+
+type termExpr func(node *v1.Node, now time.Time) bool
+
+func (e termExpr) match(node *v1.Node, now time.Time) bool {
+	return e(node, now)
+}
+
+// Parse parses a filter expression.
+func Parse(filter string) (*Filter, error) {
+	if len(filter) > maxFilterLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidFilter, maxFilterLength)
+	}
+
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return &Filter{}, nil
+	}
+
+	p := parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.tokens[p.pos])
+	}
+
+	return &Filter{root: root}, nil
+}
+
+func tokenize(filter string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(' || c == ')' || c == '!':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(filter) || filter[i+1] != c {
+				return nil, fmt.Errorf("%w: expected %q at position %d", ErrInvalidFilter, string([]byte{c, c}), i)
+			}
+			tokens = append(tokens, filter[i:i+2])
+			i += 2
+		default:
+			start := i
+			for i < len(filter) && !strings.ContainsRune(" \t\n()!&|", rune(filter[i])) {
+				i++
+			}
+			tokens = append(tokens, filter[start:i])
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+
+	// depth is how many "(" and "!" the current token is nested in.
+	depth int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	token := p.peek()
+	p.pos++
+
+	if token == "!" || token == "(" {
+		p.depth++
+		defer func() { p.depth-- }()
+
+		if p.depth > maxFilterDepth {
+			return nil, fmt.Errorf("%w: nested deeper than %d", ErrInvalidFilter, maxFilterDepth)
+		}
+	}
+
+	switch token {
+	case "":
+		return nil, fmt.Errorf("%w: unexpected end of filter", ErrInvalidFilter)
+	case "!":
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return notExpr{inner}, nil
+	case "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("%w: missing %q", ErrInvalidFilter, ")")
+		}
+		p.pos++
+
+		return inner, nil
+	case ")", "&&", "||":
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, token)
+	}
+
+	return parseTerm(token)
+}
+
+var termRegex = regexp.MustCompile(`^([a-z_]+)(:|<=|>=|<|>)(.*)$`)
+
+func parseTerm(term string) (expr, error) {
+	switch term {
+	case "online":
+		return termExpr(func(node *v1.Node, _ time.Time) bool { return node.GetOnline() }), nil
+	case "offline":
+		return termExpr(func(node *v1.Node, _ time.Time) bool { return !node.GetOnline() }), nil
+	case "expired":
+		return termExpr(func(node *v1.Node, now time.Time) bool { return isExpired(node, now) }), nil
+	}
+
+	m := termRegex.FindStringSubmatch(term)
+	if m == nil {
+		return nil, fmt.Errorf("%w: unknown term %q", ErrInvalidFilter, term)
+	}
+	field, op, value := m[1], m[2], m[3]
+
+	if value == "" {
+		return nil, fmt.Errorf("%w: %q has no value", ErrInvalidFilter, term)
+	}
+
+	switch field {
+	case "tag", "user", "label", "os", "name":
+		if op != ":" {
+			return nil, fmt.Errorf("%w: %q only supports %q", ErrInvalidFilter, field, ":")
+		}
+	case "seen", "expires":
+		if op != "<" && op != ">" {
+			return nil, fmt.Errorf("%w: %q only supports %q and %q", ErrInvalidFilter, field, "<", ">")
+		}
+	}
+
+	switch field {
+	case "tag":
+		if !strings.HasPrefix(value, "tag:") {
+			value = "tag:" + value
+		}
+		match := glob(value, false)
+
+		return termExpr(func(node *v1.Node, _ time.Time) bool {
+			return slices.ContainsFunc(node.GetValidTags(), match) ||
+				slices.ContainsFunc(node.GetForcedTags(), match)
+		}), nil
+
+	case "user":
+		match := glob(value, true)
+
+		return termExpr(func(node *v1.Node, _ time.Time) bool {
+			user := node.GetUser()
+			return match(user.GetName()) ||
+				(user.GetEmail() != "" && match(user.GetEmail())) ||
+				value == strconv.FormatUint(user.GetId(), 10)
+		}), nil
+
+	case "label":
+		key, pattern, hasValue := strings.Cut(value, "=")
+		match := glob(pattern, false)
+
+		return termExpr(func(node *v1.Node, _ time.Time) bool {
+			got, ok := node.GetLabels()[key]
+			return ok && (!hasValue || match(got))
+		}), nil
+
+	case "os":
+		match := glob(value, true)
+
+		return termExpr(func(node *v1.Node, _ time.Time) bool {
+			return match(node.GetOs())
+		}), nil
+
+	case "name":
+		match := glob(value, true)
+
+		return termExpr(func(node *v1.Node, _ time.Time) bool {
+			return match(node.GetGivenName()) || match(node.GetName())
+		}), nil
+
+	case "version":
+		return versionTerm(op, value), nil
+
+	case "seen", "expires":
+		duration, err := model.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidFilter, term, err)
+		}
+
+		if field == "seen" {
+			return seenTerm(op, time.Duration(duration)), nil
+		}
+
+		return expiresTerm(op, time.Duration(duration)), nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, field)
+}
+
+// glob returns a function matching strings against pattern, in which "*"
+// matches any characters.
+func glob(pattern string, foldCase bool) func(string) bool {
+	if !strings.Contains(pattern, "*") {
+		if foldCase {
+			return func(s string) bool { return strings.EqualFold(s, pattern) }
+		}
+
+		return func(s string) bool { return s == pattern }
+	}
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	re := "^" + strings.Join(parts, ".*") + "$"
+	if foldCase {
+		re = "(?i)" + re
+	}
+
+	return regexp.MustCompile(re).MatchString
+}
+
+func versionTerm(op, value string) expr {
+	if op == ":" {
+		match := glob(value, false)
+
+		return termExpr(func(node *v1.Node, _ time.Time) bool {
+			return match(shortVersion(node.GetClientVersion()))
+		})
+	}
+
+	return termExpr(func(node *v1.Node, _ time.Time) bool {
+		version := shortVersion(node.GetClientVersion())
+		if version == "" {
+			return false
+		}
+
+		return compare(cmpver.Compare(version, value), op)
+	})
+}
+
+// shortVersion strips the commit hashes from a Tailscale version, e.g.
+// "1.80.0-t1234abcd-g5678efab" is "1.80.0".
+func shortVersion(version string) string {
+	short, _, _ := strings.Cut(version, "-")
+	return short
+}
+
+func seenTerm(op string, duration time.Duration) expr {
+	return termExpr(func(node *v1.Node, now time.Time) bool {
+		// Online nodes are being seen now, nodes never seen have been
+		// seen longer ago than any duration.
+		if node.GetOnline() {
+			return op == "<"
+		}
+		if node.GetLastSeen() == nil {
+			return op == ">"
+		}
+
+		return compare(cmp.Compare(now.Sub(node.GetLastSeen().AsTime()), duration), op)
+	})
+}
+
+func expiresTerm(op string, duration time.Duration) expr {
+	return termExpr(func(node *v1.Node, now time.Time) bool {
+		if !hasExpiry(node) {
+			return op == ">"
+		}
+
+		return compare(cmp.Compare(node.GetExpiry().AsTime().Sub(now), duration), op)
+	})
+}
+
+func compare(result int, op string) bool {
+	switch op {
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	}
+
+	return result == 0
+}
+
+func hasExpiry(node *v1.Node) bool {
+	return node.GetExpiry() != nil && !node.GetExpiry().AsTime().IsZero()
+}
+
+func isExpired(node *v1.Node, now time.Time) bool {
+	return hasExpiry(node) && node.GetExpiry().AsTime().Before(now)
+}
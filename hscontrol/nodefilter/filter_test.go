@@ -0,0 +1,149 @@
+package nodefilter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"tag:db &&",
+		"tag:db & online",
+		"tag:db | online",
+		"(online",
+		"online)",
+		"!",
+		"&& online",
+		"unknown",
+		"foo:bar",
+		"tag:",
+		"tag<db",
+		"seen:1h",
+		"seen<tomorrow",
+		"expires>=1d",
+	}
+
+	for _, filter := range tests {
+		t.Run(filter, func(t *testing.T) {
+			_, err := Parse(filter)
+			require.ErrorIs(t, err, ErrInvalidFilter)
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + "online" + strings.Repeat(")", depth)
+	}
+
+	_, err := Parse(nested(maxFilterDepth))
+	require.NoError(t, err)
+
+	_, err = Parse(strings.Repeat("!", maxFilterDepth) + "online")
+	require.NoError(t, err)
+
+	_, err = Parse(nested(maxFilterDepth + 1))
+	require.ErrorIs(t, err, ErrInvalidFilter)
+
+	_, err = Parse(strings.Repeat("!", maxFilterDepth+1) + "online")
+	require.ErrorIs(t, err, ErrInvalidFilter)
+
+	// A long run of parentheses is rejected before it is parsed.
+	_, err = Parse(strings.Repeat("(", 4<<20))
+	require.ErrorIs(t, err, ErrInvalidFilter)
+
+	// Terms chained with operators are not nested, only the length of
+	// the filter bounds them.
+	chain := strings.Repeat("online && ", maxFilterLength/20) + "online"
+	_, err = Parse(chain)
+	require.NoError(t, err)
+
+	_, err = Parse(chain + strings.Repeat(" ", maxFilterLength))
+	require.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	db := &v1.Node{
+		Id:            1,
+		Name:          "db-1.internal",
+		GivenName:     "db-1",
+		User:          &v1.User{Id: 1, Name: "alice", Email: "alice@example.com"},
+		ValidTags:     []string{"tag:db"},
+		Labels:        map[string]string{"env": "prod", "zone": "eu-west-1"},
+		Os:            "linux",
+		ClientVersion: "1.80.2-t1234abcd-g5678efab",
+		LastSeen:      timestamppb.New(now.Add(-48 * time.Hour)),
+		Expiry:        timestamppb.New(now.Add(3 * 24 * time.Hour)),
+	}
+	laptop := &v1.Node{
+		Id:            2,
+		Name:          "laptop",
+		GivenName:     "laptop",
+		User:          &v1.User{Id: 2, Name: "bob"},
+		ForcedTags:    []string{"tag:dev"},
+		Labels:        map[string]string{"env": "dev"},
+		Os:            "windows",
+		ClientVersion: "1.72.0",
+		Online:        true,
+		Expiry:        timestamppb.New(now.Add(-time.Hour)),
+	}
+	nodes := []*v1.Node{db, laptop}
+
+	tests := []struct {
+		filter string
+		want   []uint64
+	}{
+		{"", []uint64{1, 2}},
+		{"online", []uint64{2}},
+		{"offline", []uint64{1}},
+		{"expired", []uint64{2}},
+		{"tag:db", []uint64{1}},
+		{"tag:tag:dev", []uint64{2}},
+		{"tag:*", []uint64{1, 2}},
+		{"user:alice", []uint64{1}},
+		{"user:ALICE@example.com", []uint64{1}},
+		{"user:2", []uint64{2}},
+		{"label:zone", []uint64{1}},
+		{"label:env=dev", []uint64{2}},
+		{"label:zone=eu-*", []uint64{1}},
+		{"os:Linux", []uint64{1}},
+		{"name:db-*", []uint64{1}},
+		{"name:laptop", []uint64{2}},
+		{"version:1.80.*", []uint64{1}},
+		{"version<1.80.0", []uint64{2}},
+		{"version>=1.80.2", []uint64{1}},
+		{"seen<1h", []uint64{2}},
+		{"seen>1d", []uint64{1}},
+		{"seen>3d", nil},
+		{"expires<7d", []uint64{1, 2}},
+		{"expires>1d", []uint64{1}},
+		{"tag:db && !online", []uint64{1}},
+		{"os:linux || os:windows", []uint64{1, 2}},
+		{"!(label:env=prod || tag:dev)", nil},
+		{"online || tag:db && offline", []uint64{1, 2}},
+		{"(online || tag:db) && offline", []uint64{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := Parse(tt.filter)
+			require.NoError(t, err)
+
+			var got []uint64
+			for _, node := range nodes {
+				if f.Match(node, now) {
+					got = append(got, node.GetId())
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package nodefilter
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MaxPageSize is the largest number of nodes returned in one page.
+const MaxPageSize = 1000
+
+var (
+	ErrInvalidOrder     = errors.New("invalid node order")
+	ErrInvalidPageSize  = errors.New("invalid page size")
+	ErrInvalidPageToken = errors.New("invalid page token")
+)
+
+var orderFields = map[string]func(a, b *v1.Node) int{
+	"id": func(a, b *v1.Node) int { return cmp.Compare(a.GetId(), b.GetId()) },
+	"name": func(a, b *v1.Node) int {
+		return strings.Compare(a.GetGivenName(), b.GetGivenName())
+	},
+	"hostname": func(a, b *v1.Node) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	},
+	"user": func(a, b *v1.Node) int {
+		return strings.Compare(a.GetUser().GetName(), b.GetUser().GetName())
+	},
+	"last_seen": func(a, b *v1.Node) int {
+		return compareTimestamps(a.GetLastSeen(), b.GetLastSeen())
+	},
+	"created_at": func(a, b *v1.Node) int {
+		return compareTimestamps(a.GetCreatedAt(), b.GetCreatedAt())
+	},
+	"expiry": func(a, b *v1.Node) int {
+		return compareTimestamps(a.GetExpiry(), b.GetExpiry())
+	},
+}
+
+// compareTimestamps orders unset timestamps first.
+func compareTimestamps(a, b *timestamppb.Timestamp) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	return a.AsTime().Compare(b.AsTime())
+}
+
+// Sort sorts the nodes by orderBy, a field optionally followed by " desc":
+// id, name, hostname, user, last_seen, created_at or expiry. Nodes are
+// sorted by ID if orderBy is empty, and by ID between equal nodes.
+func Sort(nodes []*v1.Node, orderBy string) error {
+	field, direction, _ := strings.Cut(strings.TrimSpace(orderBy), " ")
+	field = cmp.Or(field, "id")
+
+	compareField, ok := orderFields[field]
+	if !ok {
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidOrder, field)
+	}
+
+	sign := 1
+	switch strings.ToLower(strings.TrimSpace(direction)) {
+	case "", "asc":
+	case "desc":
+		sign = -1
+	default:
+		return fmt.Errorf("%w: unknown direction %q", ErrInvalidOrder, direction)
+	}
+
+	slices.SortStableFunc(nodes, func(a, b *v1.Node) int {
+		return sign * cmp.Or(compareField(a, b), cmp.Compare(a.GetId(), b.GetId()))
+	})
+
+	return nil
+}
+
+// Page returns the page of nodes starting at token, of at most size
+// nodes, and the token of the next page, which is empty on the last page.
+// All nodes are returned if size is zero.
+// A token can only be used with the same query, which identifies the
+// filter and order of the request.
+func Page(nodes []*v1.Node, size int32, token, query string) ([]*v1.Node, string, error) {
+	if size < 0 {
+		return nil, "", fmt.Errorf("%w: %d", ErrInvalidPageSize, size)
+	}
+
+	offset := 0
+	if token != "" {
+		var err error
+		offset, err = parsePageToken(token, query)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if offset >= len(nodes) {
+		return []*v1.Node{}, "", nil
+	}
+	nodes = nodes[offset:]
+
+	if size == 0 {
+		return nodes, "", nil
+	}
+	size = min(size, MaxPageSize)
+
+	if len(nodes) <= int(size) {
+		return nodes, "", nil
+	}
+
+	return nodes[:size], pageToken(offset+int(size), query), nil
+}
+
+// pageToken encodes the offset of the next page with a hash of the query.
+func pageToken(offset int, query string) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.Itoa(offset) + ":" + queryHash(query)),
+	)
+}
+
+func parsePageToken(token, query string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+
+	offsetStr, hash, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, ErrInvalidPageToken
+	}
+
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidPageToken
+	}
+
+	if hash != queryHash(query) {
+		return 0, fmt.Errorf("%w: the token is for another filter or order", ErrInvalidPageToken)
+	}
+
+	return offset, nil
+}
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,71 @@
+package nodefilter
+
+import (
+	"testing"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(nodes []*v1.Node) []uint64 {
+	ids := make([]uint64, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.GetId())
+	}
+
+	return ids
+}
+
+func TestSort(t *testing.T) {
+	nodes := []*v1.Node{
+		{Id: 3, GivenName: "b", User: &v1.User{Name: "bob"}},
+		{Id: 1, GivenName: "c", User: &v1.User{Name: "alice"}},
+		{Id: 2, GivenName: "a", User: &v1.User{Name: "alice"}},
+	}
+
+	require.NoError(t, Sort(nodes, ""))
+	assert.Equal(t, []uint64{1, 2, 3}, ids(nodes))
+
+	require.NoError(t, Sort(nodes, "name"))
+	assert.Equal(t, []uint64{2, 3, 1}, ids(nodes))
+
+	require.NoError(t, Sort(nodes, "user desc"))
+	assert.Equal(t, []uint64{3, 2, 1}, ids(nodes))
+
+	require.ErrorIs(t, Sort(nodes, "ip"), ErrInvalidOrder)
+	require.ErrorIs(t, Sort(nodes, "name down"), ErrInvalidOrder)
+}
+
+func TestPage(t *testing.T) {
+	nodes := []*v1.Node{{Id: 1}, {Id: 2}, {Id: 3}, {Id: 4}, {Id: 5}}
+
+	page, token, err := Page(nodes, 0, "", "q")
+	require.NoError(t, err)
+	assert.Len(t, page, 5)
+	assert.Empty(t, token)
+
+	var got []uint64
+	token = ""
+	for {
+		page, token, err = Page(nodes, 2, token, "q")
+		require.NoError(t, err)
+		got = append(got, ids(page)...)
+		if token == "" {
+			break
+		}
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, got)
+
+	_, token, err = Page(nodes, 2, "", "q")
+	require.NoError(t, err)
+
+	_, _, err = Page(nodes, 2, token, "other")
+	require.ErrorIs(t, err, ErrInvalidPageToken)
+
+	_, _, err = Page(nodes, 2, "not a token", "q")
+	require.ErrorIs(t, err, ErrInvalidPageToken)
+
+	_, _, err = Page(nodes, -1, "", "q")
+	require.ErrorIs(t, err, ErrInvalidPageSize)
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/http2"
-	"gorm.io/gorm"
 	"tailscale.com/control/controlbase"
 	"tailscale.com/control/controlhttp/controlhttpserver"
 	"tailscale.com/tailcfg"
@@ -55,14 +54,14 @@ func (h *Headscale) NoiseUpgradeHandler(
 	writer http.ResponseWriter,
 	req *http.Request,
 ) {
-	log.Trace().Caller().Msgf("Noise upgrade handler for client %s", req.RemoteAddr)
+	h.logger.Trace().Caller().Msgf("Noise upgrade handler for client %s", req.RemoteAddr)
 
 	upgrade := req.Header.Get("Upgrade")
 	if upgrade == "" {
 		// This probably means that the user is running Headscale behind an
 		// improperly configured reverse proxy. TS2021 requires WebSockets to
 		// be passed to Headscale. Let's give them a hint.
-		log.Warn().
+		h.logger.Warn().
 			Caller().
 			Msg("No Upgrade header in TS2021 request. If headscale is behind a reverse proxy, make sure it is configured to pass WebSockets through.")
 		http.Error(writer, "Internal error", http.StatusInternalServerError)
@@ -96,7 +95,7 @@ func (h *Headscale) NoiseUpgradeHandler(
 	// The HTTP2 server that exposes this router is created for
 	// a single hijacked connection from /ts2021, using netutil.NewOneConnListener
 	router := mux.NewRouter()
-	router.Use(prometheusMiddleware)
+	router.Use(h.prometheusMiddleware)
 
 	router.HandleFunc("/machine/register", noiseServer.NoiseRegistrationHandler).
 		Methods(http.MethodPost)
@@ -290,15 +289,12 @@ func (ns *noiseServer) NoiseRegistrationHandler(
 	writer.Write(respBody)
 }
 
-// getAndValidateNode retrieves the node from the database using the NodeKey
+// getAndValidateNode retrieves the node from the node store using the NodeKey
 // and validates that it matches the MachineKey from the Noise session.
 func (ns *noiseServer) getAndValidateNode(mapRequest tailcfg.MapRequest) (*types.Node, error) {
-	node, err := ns.headscale.db.GetNodeByNodeKey(mapRequest.NodeKey)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, NewHTTPError(http.StatusNotFound, "node not found", nil)
-		}
-		return nil, err
+	node, ok := ns.headscale.nodeStore.GetNodeByNodeKey(mapRequest.NodeKey)
+	if !ok {
+		return nil, NewHTTPError(http.StatusNotFound, "node not found", nil)
 	}
 
 	// Validate that the MachineKey in the Noise session matches the one associated with the NodeKey.
@@ -0,0 +1,85 @@
+package notifier
+
+import (
+	"context"
+	"slices"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/util/ctxkey"
+)
+
+// forwardedKey marks the updates forwarded by another headscale instance,
+// which must not be forwarded again.
+var forwardedKey = ctxkey.New("notify.forwarded", false)
+
+// Forwarded is an update forwarded to the other headscale instances sharing
+// the database, for them to send it to the nodes connected to them.
+type Forwarded struct {
+	Update types.StateUpdate `json:"update"`
+
+	// NodeID is set when the update is for this node only.
+	NodeID types.NodeID `json:"node_id,omitempty"`
+
+	// Ignored are the nodes the update is not sent to.
+	Ignored []types.NodeID `json:"ignored,omitempty"`
+
+	// PolicyChange is set, instead of Update, when the policy, the users
+	// or the nodes have changed. The receiving instance works out which
+	// of its nodes are affected.
+	PolicyChange bool `json:"policy_change,omitempty"`
+}
+
+// ForwardedCtx returns a context for giving the notifier an update
+// forwarded by another headscale instance, which is not forwarded again.
+func ForwardedCtx(ctx context.Context) context.Context {
+	return forwardedKey.WithValue(ctx, true)
+}
+
+// Forward makes the notifier call fn with the updates it is given, to be
+// forwarded to the other headscale instances sharing the database. fn must
+// not block. Updates given with a context from ForwardedCtx are not
+// forwarded, nor DERP map updates, as every instance updates its DERP map.
+func (n *Notifier) Forward(fn func(Forwarded)) {
+	n.hooksMu.Lock()
+	defer n.hooksMu.Unlock()
+
+	n.forward = fn
+}
+
+func (n *Notifier) forwardUpdate(ctx context.Context, f Forwarded) {
+	if forwardedKey.Value(ctx) || f.Update.Type == types.StateDERPUpdated {
+		return
+	}
+
+	n.hooksMu.RLock()
+	fn := n.forward
+	n.hooksMu.RUnlock()
+
+	if fn != nil {
+		fn(f)
+	}
+}
+
+// SetRemoteConnected records if the node is connected to another headscale
+// instance sharing the database. IsConnected, IsLikelyConnected and
+// LikelyConnectedMap report the nodes connected to any instance.
+func (n *Notifier) SetRemoteConnected(nodeID types.NodeID, connected bool) {
+	if connected {
+		n.remote.Store(nodeID, true)
+	} else {
+		n.remote.Delete(nodeID)
+	}
+}
+
+// RemoteConnected returns the nodes connected to other headscale instances,
+// ordered by ID.
+func (n *Notifier) RemoteConnected() []types.NodeID {
+	var ids []types.NodeID
+	n.remote.Range(func(id types.NodeID, _ bool) bool {
+		ids = append(ids, id)
+		return true
+	})
+	slices.Sort(ids)
+
+	return ids
+}
@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/juanfont/headscale/hscontrol/types"
+)
+
+func TestForward(t *testing.T) {
+	n := NewNotifier(&types.Config{
+		Tuning: types.Tuning{
+			NotifierSendTimeout:            time.Second,
+			BatchChangeDelay:               time.Second,
+			NodeMapSessionBufferedChanSize: 30,
+		},
+	}, nil)
+	defer n.Close()
+
+	var got []Forwarded
+	n.Forward(func(f Forwarded) {
+		got = append(got, f)
+	})
+
+	ctx := context.Background()
+	n.NotifyWithIgnore(ctx, types.UpdatePeerChanged(1), 2)
+	n.NotifyByNodeID(ctx, types.UpdateSelf(3), 3)
+	n.NotifyAll(ctx, types.UpdateFull())
+
+	// Updates forwarded by other instances, and DERP map updates, are not
+	// forwarded.
+	n.NotifyAll(ForwardedCtx(ctx), types.UpdatePeerRemoved(4))
+	n.NotifyAll(ctx, types.StateUpdate{Type: types.StateDERPUpdated})
+
+	want := []Forwarded{
+		{Update: types.UpdatePeerChanged(1), Ignored: []types.NodeID{2}},
+		{Update: types.UpdateSelf(3), NodeID: 3},
+		{Update: types.UpdateFull()},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Forward() unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestRemoteConnected(t *testing.T) {
+	n := NewNotifier(&types.Config{
+		Tuning: types.Tuning{
+			NotifierSendTimeout:            time.Second,
+			BatchChangeDelay:               time.Second,
+			NodeMapSessionBufferedChanSize: 30,
+		},
+	}, nil)
+	defer n.Close()
+
+	n.AddNode(1, make(chan types.StateUpdate, 1))
+	n.SetRemoteConnected(3, true)
+	n.SetRemoteConnected(2, true)
+
+	for id, want := range map[types.NodeID]bool{1: true, 2: true, 3: true, 4: false} {
+		if got := n.IsConnected(id); got != want {
+			t.Errorf("IsConnected(%d) = %t, want %t", id, got, want)
+		}
+	}
+
+	if diff := cmp.Diff([]types.NodeID{2, 3}, n.RemoteConnected()); diff != "" {
+		t.Errorf("RemoteConnected() unexpected result (-want +got):\n%s", diff)
+	}
+
+	n.SetRemoteConnected(2, false)
+	if n.IsConnected(2) {
+		t.Errorf("IsConnected(2) = true after disconnecting remotely")
+	}
+	if _, ok := n.LikelyConnectedMap().Load(3); !ok {
+		t.Errorf("LikelyConnectedMap() does not contain remotely connected node")
+	}
+}
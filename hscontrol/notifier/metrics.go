@@ -10,59 +10,106 @@ const prometheusNamespace = "headscale"
 
 var debugHighCardinalityMetrics = envknob.Bool("HEADSCALE_DEBUG_HIGH_CARDINALITY_METRICS")
 
-var notifierUpdateSent *prometheus.CounterVec
+// metrics holds the metrics of a Notifier. Every Notifier has its own
+// metrics so multiple headscale instances can live in one process.
+type metrics struct {
+	updateSent      *prometheus.CounterVec
+	queueDepth      *prometheus.GaugeVec
+	queueMerges     *prometheus.CounterVec
+	queueForcedFull *prometheus.CounterVec
 
-func init() {
+	waitersForLock        *prometheus.GaugeVec
+	waitForLock           *prometheus.HistogramVec
+	updateReceived        *prometheus.CounterVec
+	policyChangeSent      *prometheus.CounterVec
+	policyChangeDuration  prometheus.Histogram
+	nodeUpdateChans       prometheus.Gauge
+	batcherWaitersForLock *prometheus.GaugeVec
+	batcherChanges        *prometheus.GaugeVec
+	batcherPatches        *prometheus.GaugeVec
+}
+
+// newMetrics creates the notifier metrics and registers them with reg.
+// If reg is nil, the metrics are not registered.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	factory := promauto.With(reg)
+
+	// The node ID is only added to the queue metrics if high
+	// cardinality metrics are enabled.
+	queueLabels := []string{}
+	updateSentLabels := []string{"status", "type", "trigger"}
 	if debugHighCardinalityMetrics {
-		notifierUpdateSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		queueLabels = []string{"id"}
+		updateSentLabels = append(updateSentLabels, "id")
+	}
+
+	return &metrics{
+		updateSent: factory.NewCounterVec(prometheus.CounterOpts{
 			Namespace: prometheusNamespace,
 			Name:      "notifier_update_sent_total",
 			Help:      "total count of update sent on nodes channel",
-		}, []string{"status", "type", "trigger", "id"})
-	} else {
-		notifierUpdateSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		}, updateSentLabels),
+		queueDepth: factory.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: prometheusNamespace,
-			Name:      "notifier_update_sent_total",
-			Help:      "total count of update sent on nodes channel",
-		}, []string{"status", "type", "trigger"})
+			Name:      "notifier_queue_depth",
+			Help:      "gauge of updates pending delivery to nodes",
+		}, queueLabels),
+		queueMerges: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_queue_merges_total",
+			Help:      "total count of updates merged into updates pending delivery to nodes",
+		}, append([]string{"type"}, queueLabels...)),
+		queueForcedFull: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_queue_forced_full_total",
+			Help:      "total count of pending updates replaced by a full update as the node queue overflowed",
+		}, queueLabels),
+		waitersForLock: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_waiters_for_lock",
+			Help:      "gauge of waiters for the notifier lock",
+		}, []string{"type", "action"}),
+		waitForLock: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_wait_for_lock_seconds",
+			Help:      "histogram of time spent waiting for the notifier lock",
+			Buckets:   []float64{0.001, 0.01, 0.1, 0.3, 0.5, 1, 3, 5, 10},
+		}, []string{"action"}),
+		updateReceived: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_update_received_total",
+			Help:      "total count of updates received by notifier",
+		}, []string{"type", "trigger"}),
+		policyChangeSent: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_policy_change_sent_total",
+			Help:      "total count of nodes sent a full or incremental update, or skipped, after a policy, user or node change",
+		}, []string{"type"}),
+		policyChangeDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_policy_change_seconds",
+			Help:      "histogram of time spent determining the nodes affected by a policy, user or node change",
+			Buckets:   []float64{0.001, 0.01, 0.1, 0.3, 0.5, 1, 3, 5, 10},
+		}),
+		nodeUpdateChans: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_open_channels_total",
+			Help:      "total count open channels in notifier",
+		}),
+		batcherWaitersForLock: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_batcher_waiters_for_lock",
+			Help:      "gauge of waiters for the notifier batcher lock",
+		}, []string{"type", "action"}),
+		batcherChanges: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_batcher_changes_pending",
+			Help:      "gauge of full changes pending in the notifier batcher",
+		}, []string{}),
+		batcherPatches: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "notifier_batcher_patches_pending",
+			Help:      "gauge of patches pending in the notifier batcher",
+		}, []string{}),
 	}
 }
-
-var (
-	notifierWaitersForLock = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: prometheusNamespace,
-		Name:      "notifier_waiters_for_lock",
-		Help:      "gauge of waiters for the notifier lock",
-	}, []string{"type", "action"})
-	notifierWaitForLock = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: prometheusNamespace,
-		Name:      "notifier_wait_for_lock_seconds",
-		Help:      "histogram of time spent waiting for the notifier lock",
-		Buckets:   []float64{0.001, 0.01, 0.1, 0.3, 0.5, 1, 3, 5, 10},
-	}, []string{"action"})
-	notifierUpdateReceived = promauto.NewCounterVec(prometheus.CounterOpts{
-		Namespace: prometheusNamespace,
-		Name:      "notifier_update_received_total",
-		Help:      "total count of updates received by notifier",
-	}, []string{"type", "trigger"})
-	notifierNodeUpdateChans = promauto.NewGauge(prometheus.GaugeOpts{
-		Namespace: prometheusNamespace,
-		Name:      "notifier_open_channels_total",
-		Help:      "total count open channels in notifier",
-	})
-	notifierBatcherWaitersForLock = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: prometheusNamespace,
-		Name:      "notifier_batcher_waiters_for_lock",
-		Help:      "gauge of waiters for the notifier batcher lock",
-	}, []string{"type", "action"})
-	notifierBatcherChanges = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: prometheusNamespace,
-		Name:      "notifier_batcher_changes_pending",
-		Help:      "gauge of full changes pending in the notifier batcher",
-	}, []string{})
-	notifierBatcherPatches = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: prometheusNamespace,
-		Name:      "notifier_batcher_patches_pending",
-		Help:      "gauge of patches pending in the notifier batcher",
-	}, []string{})
-)
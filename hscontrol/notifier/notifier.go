@@ -8,7 +8,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/puzpuzpuz/xsync/v3"
 	"github.com/rs/zerolog/log"
 	"github.com/sasha-s/go-deadlock"
@@ -32,19 +34,32 @@ func init() {
 
 type Notifier struct {
 	l         deadlock.Mutex
-	nodes     map[types.NodeID]chan<- types.StateUpdate
+	nodes     map[types.NodeID]*nodeQueue
 	connected *xsync.MapOf[types.NodeID, bool]
+	remote    *xsync.MapOf[types.NodeID, bool]
 	b         *batcher
 	cfg       *types.Config
+	metrics   *metrics
 	closed    bool
+
+	views *policy.ViewTracker
+
+	hooksMu sync.RWMutex
+	hooks   []func(types.StateUpdate)
+	forward func(Forwarded)
 }
 
-func NewNotifier(cfg *types.Config) *Notifier {
+// NewNotifier creates a Notifier and registers its metrics with reg.
+// If reg is nil, the metrics are not registered.
+func NewNotifier(cfg *types.Config, reg prometheus.Registerer) *Notifier {
 	n := &Notifier{
-		nodes:     make(map[types.NodeID]chan<- types.StateUpdate),
+		nodes:     make(map[types.NodeID]*nodeQueue),
 		connected: xsync.NewMapOf[types.NodeID, bool](),
+		remote:    xsync.NewMapOf[types.NodeID, bool](),
 		cfg:       cfg,
+		metrics:   newMetrics(reg),
 		closed:    false,
+		views:     policy.NewViewTracker(),
 	}
 	b := newBatcher(cfg.Tuning.BatchChangeDelay, n)
 	n.b = b
@@ -55,21 +70,22 @@ func NewNotifier(cfg *types.Config) *Notifier {
 
 // Close stops the batcher and closes all channels.
 func (n *Notifier) Close() {
-	notifierWaitersForLock.WithLabelValues("lock", "close").Inc()
+	n.metrics.waitersForLock.WithLabelValues("lock", "close").Inc()
 	n.l.Lock()
 	defer n.l.Unlock()
-	notifierWaitersForLock.WithLabelValues("lock", "close").Dec()
+	n.metrics.waitersForLock.WithLabelValues("lock", "close").Dec()
 
 	n.closed = true
 	n.b.close()
 
 	// Close channels safely using the helper method
-	for nodeID, c := range n.nodes {
-		n.safeCloseChannel(nodeID, c)
+	for nodeID, q := range n.nodes {
+		q.stop()
+		n.safeCloseChannel(nodeID, q.ch)
 	}
 
 	// Clear node map after closing channels
-	n.nodes = make(map[types.NodeID]chan<- types.StateUpdate)
+	n.nodes = make(map[types.NodeID]*nodeQueue)
 }
 
 // safeCloseChannel closes a channel and panic recovers if already closed
@@ -93,11 +109,11 @@ func (n *Notifier) tracef(nID types.NodeID, msg string, args ...any) {
 
 func (n *Notifier) AddNode(nodeID types.NodeID, c chan<- types.StateUpdate) {
 	start := time.Now()
-	notifierWaitersForLock.WithLabelValues("lock", "add").Inc()
+	n.metrics.waitersForLock.WithLabelValues("lock", "add").Inc()
 	n.l.Lock()
 	defer n.l.Unlock()
-	notifierWaitersForLock.WithLabelValues("lock", "add").Dec()
-	notifierWaitForLock.WithLabelValues("add").Observe(time.Since(start).Seconds())
+	n.metrics.waitersForLock.WithLabelValues("lock", "add").Dec()
+	n.metrics.waitForLock.WithLabelValues("add").Observe(time.Since(start).Seconds())
 
 	if n.closed {
 		return
@@ -106,19 +122,31 @@ func (n *Notifier) AddNode(nodeID types.NodeID, c chan<- types.StateUpdate) {
 	// If a channel exists, it means the node has opened a new
 	// connection. Close the old channel and replace it.
 	if curr, ok := n.nodes[nodeID]; ok {
+		if curr.ch == c {
+			n.tracef(nodeID, "channel already present")
+			n.connected.Store(nodeID, true)
+
+			return
+		}
+
 		n.tracef(nodeID, "channel present, closing and replacing")
-		// Use the safeCloseChannel helper in a goroutine to avoid deadlocks
-		// if/when someone is waiting to send on this channel
-		go func(ch chan<- types.StateUpdate) {
-			n.safeCloseChannel(nodeID, ch)
+		// Stop the queue of the old session in a goroutine to not hold
+		// the lock while waiting for it to stop delivering updates.
+		go func(q *nodeQueue) {
+			q.stop()
+			n.safeCloseChannel(nodeID, q.ch)
 		}(curr)
+	} else {
+		n.metrics.nodeUpdateChans.Inc()
 	}
 
-	n.nodes[nodeID] = c
+	q := newNodeQueue(nodeID, c, n.cfg.Tuning.NotifierQueueSize, n.metrics)
+	go q.run()
+
+	n.nodes[nodeID] = q
 	n.connected.Store(nodeID, true)
 
 	n.tracef(nodeID, "added new channel")
-	notifierNodeUpdateChans.Inc()
 }
 
 // RemoveNode removes a node and a given channel from the notifier.
@@ -127,11 +155,11 @@ func (n *Notifier) AddNode(nodeID types.NodeID, c chan<- types.StateUpdate) {
 // RemoveNode reports if the node/chan was removed.
 func (n *Notifier) RemoveNode(nodeID types.NodeID, c chan<- types.StateUpdate) bool {
 	start := time.Now()
-	notifierWaitersForLock.WithLabelValues("lock", "remove").Inc()
+	n.metrics.waitersForLock.WithLabelValues("lock", "remove").Inc()
 	n.l.Lock()
 	defer n.l.Unlock()
-	notifierWaitersForLock.WithLabelValues("lock", "remove").Dec()
-	notifierWaitForLock.WithLabelValues("remove").Observe(time.Since(start).Seconds())
+	n.metrics.waitersForLock.WithLabelValues("lock", "remove").Dec()
+	n.metrics.waitForLock.WithLabelValues("remove").Observe(time.Since(start).Seconds())
 
 	if n.closed {
 		return true
@@ -143,18 +171,22 @@ func (n *Notifier) RemoveNode(nodeID types.NodeID, c chan<- types.StateUpdate) b
 
 	// If the channel exist, but it does not belong
 	// to the caller, ignore.
-	if curr, ok := n.nodes[nodeID]; ok {
-		if curr != c {
+	curr, ok := n.nodes[nodeID]
+	if ok {
+		if curr.ch != c {
 			n.tracef(nodeID, "channel has been replaced, not removing")
 			return false
 		}
+
+		curr.stop()
+		n.metrics.nodeUpdateChans.Dec()
 	}
 
 	delete(n.nodes, nodeID)
 	n.connected.Store(nodeID, false)
+	n.views.Forget(nodeID)
 
 	n.tracef(nodeID, "removed channel")
-	notifierNodeUpdateChans.Dec()
 
 	return true
 }
@@ -162,29 +194,64 @@ func (n *Notifier) RemoveNode(nodeID types.NodeID, c chan<- types.StateUpdate) b
 // IsConnected reports if a node is connected to headscale and has a
 // poll session open.
 func (n *Notifier) IsConnected(nodeID types.NodeID) bool {
-	notifierWaitersForLock.WithLabelValues("lock", "conncheck").Inc()
+	n.metrics.waitersForLock.WithLabelValues("lock", "conncheck").Inc()
 	n.l.Lock()
 	defer n.l.Unlock()
-	notifierWaitersForLock.WithLabelValues("lock", "conncheck").Dec()
+	n.metrics.waitersForLock.WithLabelValues("lock", "conncheck").Dec()
 
-	if val, ok := n.connected.Load(nodeID); ok {
-		return val
+	if val, ok := n.connected.Load(nodeID); ok && val {
+		return true
 	}
-	return false
+	_, ok := n.remote.Load(nodeID)
+	return ok
 }
 
 // IsLikelyConnected reports if a node is connected to headscale and has a
 // poll session open, but doesn't lock, so might be wrong.
 func (n *Notifier) IsLikelyConnected(nodeID types.NodeID) bool {
-	if val, ok := n.connected.Load(nodeID); ok {
-		return val
+	if val, ok := n.connected.Load(nodeID); ok && val {
+		return true
 	}
-	return false
+	_, ok := n.remote.Load(nodeID)
+	return ok
 }
 
 // LikelyConnectedMap returns a thread safe map of connected nodes
 func (n *Notifier) LikelyConnectedMap() *xsync.MapOf[types.NodeID, bool] {
-	return n.connected
+	if n.remote.Size() == 0 {
+		return n.connected
+	}
+
+	connected := xsync.NewMapOf[types.NodeID, bool]()
+	n.connected.Range(func(id types.NodeID, val bool) bool {
+		connected.Store(id, val)
+		return true
+	})
+	n.remote.Range(func(id types.NodeID, _ bool) bool {
+		connected.Store(id, true)
+		return true
+	})
+
+	return connected
+}
+
+// OnUpdate registers a function that is called with every update
+// given to the notifier, before it is sent to any node. It is used to
+// invalidate state derived from the nodes, like cached map responses.
+func (n *Notifier) OnUpdate(fn func(types.StateUpdate)) {
+	n.hooksMu.Lock()
+	defer n.hooksMu.Unlock()
+
+	n.hooks = append(n.hooks, fn)
+}
+
+func (n *Notifier) runHooks(update types.StateUpdate) {
+	n.hooksMu.RLock()
+	defer n.hooksMu.RUnlock()
+
+	for _, fn := range n.hooks {
+		fn(update)
+	}
 }
 
 func (n *Notifier) NotifyAll(ctx context.Context, update types.StateUpdate) {
@@ -200,7 +267,9 @@ func (n *Notifier) NotifyWithIgnore(
 		return
 	}
 
-	notifierUpdateReceived.WithLabelValues(update.Type.String(), types.NotifyOriginKey.Value(ctx)).Inc()
+	n.metrics.updateReceived.WithLabelValues(update.Type.String(), types.NotifyOriginKey.Value(ctx)).Inc()
+	n.runHooks(update)
+	n.forwardUpdate(ctx, Forwarded{Update: update, Ignored: ignoreNodeIDs})
 	n.b.addOrPassthrough(update)
 }
 
@@ -209,94 +278,164 @@ func (n *Notifier) NotifyByNodeID(
 	update types.StateUpdate,
 	nodeID types.NodeID,
 ) {
+	n.runHooks(update)
+	n.forwardUpdate(ctx, Forwarded{Update: update, NodeID: nodeID})
+
 	start := time.Now()
-	notifierWaitersForLock.WithLabelValues("lock", "notify").Inc()
+	n.metrics.waitersForLock.WithLabelValues("lock", "notify").Inc()
 	n.l.Lock()
 	defer n.l.Unlock()
-	notifierWaitersForLock.WithLabelValues("lock", "notify").Dec()
-	notifierWaitForLock.WithLabelValues("notify").Observe(time.Since(start).Seconds())
+	n.metrics.waitersForLock.WithLabelValues("lock", "notify").Dec()
+	n.metrics.waitForLock.WithLabelValues("notify").Observe(time.Since(start).Seconds())
 
 	if n.closed {
 		return
 	}
 
-	if c, ok := n.nodes[nodeID]; ok {
-		select {
-		case <-ctx.Done():
-			log.Error().
-				Err(ctx.Err()).
-				Uint64("node.id", nodeID.Uint64()).
-				Any("origin", types.NotifyOriginKey.Value(ctx)).
-				Any("origin-hostname", types.NotifyHostnameKey.Value(ctx)).
-				Msgf("update not sent, context cancelled")
-			if debugHighCardinalityMetrics {
-				notifierUpdateSent.WithLabelValues("cancelled", update.Type.String(), types.NotifyOriginKey.Value(ctx), nodeID.String()).Inc()
-			} else {
-				notifierUpdateSent.WithLabelValues("cancelled", update.Type.String(), types.NotifyOriginKey.Value(ctx)).Inc()
-			}
+	if q, ok := n.nodes[nodeID]; ok {
+		n.push(q, update, types.NotifyOriginKey.Value(ctx))
+		n.tracef(nodeID, "update queued, origin: %s, origin-hostname: %s", types.NotifyOriginKey.Value(ctx), types.NotifyHostnameKey.Value(ctx))
+	}
+}
 
-			return
-		case c <- update:
-			n.tracef(nodeID, "update successfully sent on chan, origin: %s, origin-hostname: %s", ctx.Value("origin"), ctx.Value("hostname"))
-			if debugHighCardinalityMetrics {
-				notifierUpdateSent.WithLabelValues("ok", update.Type.String(), types.NotifyOriginKey.Value(ctx), nodeID.String()).Inc()
-			} else {
-				notifierUpdateSent.WithLabelValues("ok", update.Type.String(), types.NotifyOriginKey.Value(ctx)).Inc()
-			}
+// SeedView records the view the node has of the tailnet when it connects
+// and is sent a full map response, so the next policy change only sends
+// it what changed. The view is forgotten when the node disconnects.
+func (n *Notifier) SeedView(
+	polMan policy.PolicyManager,
+	nodes types.Nodes,
+	nodeID types.NodeID,
+) {
+	if err := n.views.Seed(polMan, nodes, nodeID); err != nil {
+		log.Error().Err(err).Uint64("node.id", nodeID.Uint64()).Msg("failed to record the view of the node, it will get a full update on the next policy change")
+	}
+}
+
+// NotifyPolicyChange sends updates to the connected nodes whose packet
+// filter, SSH policy or visible peers changed after the policy, users or
+// nodes were updated. Nodes that are not affected are not sent anything.
+// If the affected nodes cannot be determined, all nodes get a full update.
+func (n *Notifier) NotifyPolicyChange(
+	ctx context.Context,
+	polMan policy.PolicyManager,
+	nodes types.Nodes,
+) {
+	if n.closed {
+		return
+	}
+
+	// The policy change can affect how any node is presented.
+	n.runHooks(types.UpdateFull())
+
+	// The other instances work out the changes for their own nodes.
+	n.forwardUpdate(ctx, Forwarded{PolicyChange: true})
+	ctx = ForwardedCtx(ctx)
+
+	start := time.Now()
+	n.metrics.waitersForLock.WithLabelValues("lock", "policy").Inc()
+	n.l.Lock()
+	viewers := make([]types.NodeID, 0, len(n.nodes))
+	for id := range n.nodes {
+		viewers = append(viewers, id)
+	}
+	n.l.Unlock()
+	n.metrics.waitersForLock.WithLabelValues("lock", "policy").Dec()
+
+	changes, err := n.views.Update(polMan, nodes, viewers)
+	n.metrics.policyChangeDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to determine nodes affected by policy change, sending full update")
+		n.metrics.policyChangeSent.WithLabelValues("full").Add(float64(len(viewers)))
+		n.NotifyAll(ctx, types.UpdateFull())
+
+		return
+	}
+
+	sort.Slice(viewers, func(i, j int) bool { return viewers[i] < viewers[j] })
+	for _, id := range viewers {
+		change, ok := changes[id]
+		if !ok {
+			n.metrics.policyChangeSent.WithLabelValues("skipped").Inc()
+			continue
+		}
+
+		if change.Full {
+			n.metrics.policyChangeSent.WithLabelValues("full").Inc()
+		} else {
+			n.metrics.policyChangeSent.WithLabelValues("incremental").Inc()
+		}
+
+		for _, update := range change.StateUpdates(id) {
+			n.metrics.updateReceived.WithLabelValues(update.Type.String(), types.NotifyOriginKey.Value(ctx)).Inc()
+			n.NotifyByNodeID(ctx, update, id)
 		}
 	}
 }
 
 func (n *Notifier) sendAll(update types.StateUpdate) {
 	start := time.Now()
-	notifierWaitersForLock.WithLabelValues("lock", "send-all").Inc()
+	n.metrics.waitersForLock.WithLabelValues("lock", "send-all").Inc()
 	n.l.Lock()
 	defer n.l.Unlock()
-	notifierWaitersForLock.WithLabelValues("lock", "send-all").Dec()
-	notifierWaitForLock.WithLabelValues("send-all").Observe(time.Since(start).Seconds())
+	n.metrics.waitersForLock.WithLabelValues("lock", "send-all").Dec()
+	n.metrics.waitForLock.WithLabelValues("send-all").Observe(time.Since(start).Seconds())
 
 	if n.closed {
 		return
 	}
 
-	for id, c := range n.nodes {
-		// Whenever an update is sent to all nodes, there is a chance that the node
-		// has disconnected and the goroutine that was supposed to consume the update
-		// has shut down the channel and is waiting for the lock held here in RemoveNode.
-		// This means that there is potential for a deadlock which would stop all updates
-		// going out to clients. This timeout prevents that from happening by moving on to the
-		// next node if the context is cancelled. After sendAll releases the lock, the add/remove
-		// call will succeed and the update will go to the correct nodes on the next call.
-		ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Tuning.NotifierSendTimeout)
-		defer cancel()
-		select {
-		case <-ctx.Done():
-			log.Error().
-				Err(ctx.Err()).
-				Uint64("node.id", id.Uint64()).
-				Msgf("update not sent, context cancelled")
-			if debugHighCardinalityMetrics {
-				notifierUpdateSent.WithLabelValues("cancelled", update.Type.String(), "send-all", id.String()).Inc()
-			} else {
-				notifierUpdateSent.WithLabelValues("cancelled", update.Type.String(), "send-all").Inc()
-			}
+	for _, q := range n.nodes {
+		n.push(q, update, "send-all")
+	}
+}
 
-			return
-		case c <- update:
-			if debugHighCardinalityMetrics {
-				notifierUpdateSent.WithLabelValues("ok", update.Type.String(), "send-all", id.String()).Inc()
-			} else {
-				notifierUpdateSent.WithLabelValues("ok", update.Type.String(), "send-all").Inc()
-			}
+// push queues the update for delivery to the node, it never blocks.
+func (n *Notifier) push(q *nodeQueue, update types.StateUpdate, trigger string) {
+	status := "queued"
+	if q.push(update) {
+		status = "ok"
+	}
+
+	if debugHighCardinalityMetrics {
+		n.metrics.updateSent.WithLabelValues(status, update.Type.String(), trigger, q.nodeID.String()).Inc()
+	} else {
+		n.metrics.updateSent.WithLabelValues(status, update.Type.String(), trigger).Inc()
+	}
+}
+
+// LaggingSessions returns the status of the nodes that have had updates
+// pending delivery for longer than the notifier send timeout, as their
+// poll session is not keeping up.
+func (n *Notifier) LaggingSessions() []QueueStatus {
+	n.metrics.waitersForLock.WithLabelValues("lock", "lagging").Inc()
+	n.l.Lock()
+	queues := make([]*nodeQueue, 0, len(n.nodes))
+	for _, q := range n.nodes {
+		queues = append(queues, q)
+	}
+	n.l.Unlock()
+	n.metrics.waitersForLock.WithLabelValues("lock", "lagging").Dec()
+
+	lagging := []QueueStatus{}
+	for _, q := range queues {
+		status := q.status()
+		if status.Pending > 0 && time.Since(status.PendingSince) > n.cfg.Tuning.NotifierSendTimeout {
+			lagging = append(lagging, status)
 		}
 	}
+
+	sort.Slice(lagging, func(i, j int) bool {
+		return lagging[i].NodeID < lagging[j].NodeID
+	})
+
+	return lagging
 }
 
 func (n *Notifier) String() string {
-	notifierWaitersForLock.WithLabelValues("lock", "string").Inc()
+	n.metrics.waitersForLock.WithLabelValues("lock", "string").Inc()
 	n.l.Lock()
 	defer n.l.Unlock()
-	notifierWaitersForLock.WithLabelValues("lock", "string").Dec()
+	n.metrics.waitersForLock.WithLabelValues("lock", "string").Dec()
 
 	var b strings.Builder
 	fmt.Fprintf(&b, "chans (%d):\n", len(n.nodes))
@@ -311,7 +450,9 @@ func (n *Notifier) String() string {
 	})
 
 	for _, key := range keys {
-		fmt.Fprintf(&b, "\t%d: %p\n", key, n.nodes[key])
+		if q, ok := n.nodes[key]; ok {
+			fmt.Fprintf(&b, "\t%d: %p (pending: %d)\n", key, q.ch, q.status().Pending)
+		}
 	}
 
 	b.WriteString("\n")
@@ -356,16 +497,16 @@ func (b *batcher) close() {
 // addOrPassthrough adds the update to the batcher, if it is not a
 // type that is currently batched, it will be sent immediately.
 func (b *batcher) addOrPassthrough(update types.StateUpdate) {
-	notifierBatcherWaitersForLock.WithLabelValues("lock", "add").Inc()
+	b.n.metrics.batcherWaitersForLock.WithLabelValues("lock", "add").Inc()
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	notifierBatcherWaitersForLock.WithLabelValues("lock", "add").Dec()
+	b.n.metrics.batcherWaitersForLock.WithLabelValues("lock", "add").Dec()
 
 	switch update.Type {
 	case types.StatePeerChanged:
 		b.changedNodeIDs.Add(update.ChangeNodes...)
 		b.nodesChanged = true
-		notifierBatcherChanges.WithLabelValues().Set(float64(b.changedNodeIDs.Len()))
+		b.n.metrics.batcherChanges.WithLabelValues().Set(float64(b.changedNodeIDs.Len()))
 
 	case types.StatePeerChangedPatch:
 		for _, newPatch := range update.ChangePatches {
@@ -377,7 +518,7 @@ func (b *batcher) addOrPassthrough(update types.StateUpdate) {
 			}
 		}
 		b.patchesChanged = true
-		notifierBatcherPatches.WithLabelValues().Set(float64(len(b.patches)))
+		b.n.metrics.batcherPatches.WithLabelValues().Set(float64(len(b.patches)))
 
 	default:
 		b.n.sendAll(update)
@@ -387,10 +528,10 @@ func (b *batcher) addOrPassthrough(update types.StateUpdate) {
 // flush sends all the accumulated patches to all
 // nodes in the notifier.
 func (b *batcher) flush() {
-	notifierBatcherWaitersForLock.WithLabelValues("lock", "flush").Inc()
+	b.n.metrics.batcherWaitersForLock.WithLabelValues("lock", "flush").Inc()
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	notifierBatcherWaitersForLock.WithLabelValues("lock", "flush").Dec()
+	b.n.metrics.batcherWaitersForLock.WithLabelValues("lock", "flush").Dec()
 
 	if b.nodesChanged || b.patchesChanged {
 		var patches []*tailcfg.PeerChange
@@ -422,10 +563,10 @@ func (b *batcher) flush() {
 		}
 
 		b.changedNodeIDs = set.Slice[types.NodeID]{}
-		notifierBatcherChanges.WithLabelValues().Set(0)
+		b.n.metrics.batcherChanges.WithLabelValues().Set(0)
 		b.nodesChanged = false
 		b.patches = make(map[types.NodeID]tailcfg.PeerChange, len(b.patches))
-		notifierBatcherPatches.WithLabelValues().Set(0)
+		b.n.metrics.batcherPatches.WithLabelValues().Set(0)
 		b.patchesChanged = false
 	}
 }
@@ -233,7 +233,7 @@ func TestBatcher(t *testing.T) {
 					// and have flakes.
 					NotifierSendTimeout: time.Second,
 				},
-			})
+			}, nil)
 
 			ch := make(chan types.StateUpdate, 30)
 			defer close(ch)
@@ -281,7 +281,7 @@ func TestIsLikelyConnectedRaceCondition(t *testing.T) {
 		},
 	}
 
-	notifier := NewNotifier(cfg)
+	notifier := NewNotifier(cfg, nil)
 	defer notifier.Close()
 
 	nodeID := types.NodeID(1)
@@ -0,0 +1,425 @@
+package notifier
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/set"
+)
+
+// defaultQueueSize is the number of pending changes a node can have
+// before they are replaced by a full update, if it is not configured.
+const defaultQueueSize = 1000
+
+// QueueStatus describes the updates that are pending delivery to the
+// poll session of a node.
+type QueueStatus struct {
+	NodeID types.NodeID
+
+	// Pending is the number of updates that has not been delivered.
+	Pending int
+
+	// PendingSince is when the oldest undelivered update was queued.
+	PendingSince time.Time `json:",omitzero"`
+
+	// LastDelivered is when an update was last delivered to the session.
+	LastDelivered time.Time `json:",omitzero"`
+
+	// Merges is the number of updates that has been merged into
+	// updates already pending.
+	Merges uint64
+
+	// ForcedFulls is the number of times the pending updates were
+	// replaced by a full update as the queue overflowed.
+	ForcedFulls uint64
+}
+
+// nodeQueue holds the updates pending delivery to the poll session of a
+// node. Updates are delivered directly to the channel of the session if
+// nothing is pending and the channel has room. Otherwise they are merged
+// with the pending updates, and delivered in the background as the session
+// catches up, so a slow session never blocks the producers.
+type nodeQueue struct {
+	nodeID  types.NodeID
+	ch      chan<- types.StateUpdate
+	maxSize int
+	metrics *metrics
+
+	mu sync.Mutex
+
+	closed bool
+
+	// Pending updates, merged by type. A full update makes all
+	// other pending updates, except DERP map updates, redundant.
+	full    bool
+	derp    *types.StateUpdate
+	self    bool
+	changed set.Set[types.NodeID]
+	removed set.Set[types.NodeID]
+	patches map[types.NodeID]tailcfg.PeerChange
+	message string
+
+	// inflight is the number of updates taken from the queue that the
+	// session has not received yet.
+	inflight int
+
+	pendingSince  time.Time
+	lastDelivered time.Time
+	merges        uint64
+	forcedFulls   uint64
+	reportedDepth int
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newNodeQueue(nodeID types.NodeID, ch chan<- types.StateUpdate, maxSize int, metrics *metrics) *nodeQueue {
+	if maxSize <= 0 {
+		maxSize = defaultQueueSize
+	}
+
+	return &nodeQueue{
+		nodeID:  nodeID,
+		ch:      ch,
+		maxSize: maxSize,
+		metrics: metrics,
+		changed: make(set.Set[types.NodeID]),
+		removed: make(set.Set[types.NodeID]),
+		patches: make(map[types.NodeID]tailcfg.PeerChange),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// push queues the update for delivery, it never blocks. It reports if
+// the update was delivered directly to the session.
+func (q *nodeQueue) push(update types.StateUpdate) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	if q.pendingCount() == 0 && q.inflight == 0 {
+		select {
+		case q.ch <- update:
+			q.lastDelivered = time.Now()
+
+			return true
+		default:
+		}
+	}
+
+	before := q.pendingCount()
+	q.merge(update)
+	if merged := before + 1 - q.pendingCount(); merged > 0 {
+		q.merges += uint64(merged)
+		q.metrics.queueMerges.WithLabelValues(q.labels(update.Type.String())...).Add(float64(merged))
+	}
+
+	if len(q.changed)+len(q.removed)+len(q.patches) > q.maxSize {
+		q.forceFull()
+	}
+
+	if q.pendingSince.IsZero() {
+		q.pendingSince = time.Now()
+	}
+	q.reportDepth()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return false
+}
+
+// merge adds the update to the pending updates.
+func (q *nodeQueue) merge(update types.StateUpdate) {
+	if update.Message != "" {
+		q.message = update.Message
+	}
+
+	switch update.Type {
+	case types.StateFullUpdate:
+		q.clearChanges()
+		q.full = true
+
+	case types.StateDERPUpdated:
+		q.derp = &update
+
+	case types.StatePeerChanged:
+		if q.full {
+			return
+		}
+
+		for _, id := range update.ChangeNodes {
+			q.removed.Delete(id)
+			// The changed node is sent in full, with the
+			// state it has when the response is created.
+			delete(q.patches, id)
+			q.changed.Add(id)
+		}
+
+	case types.StatePeerChangedPatch:
+		if q.full {
+			return
+		}
+
+		for _, patch := range update.ChangePatches {
+			id := types.NodeID(patch.NodeID)
+			if q.changed.Contains(id) || q.removed.Contains(id) {
+				continue
+			}
+
+			if curr, ok := q.patches[id]; ok {
+				overwritePatch(&curr, patch)
+				q.patches[id] = curr
+			} else {
+				q.patches[id] = *patch
+			}
+		}
+
+	case types.StatePeerRemoved:
+		for _, id := range update.Removed {
+			// The removal of the node itself ends the session
+			// and must be delivered, even if a full update is pending.
+			if q.full && id != q.nodeID {
+				continue
+			}
+
+			q.changed.Delete(id)
+			delete(q.patches, id)
+			q.removed.Add(id)
+		}
+
+	case types.StateSelfUpdate:
+		if q.full {
+			return
+		}
+
+		q.self = true
+	}
+}
+
+// forceFull replaces the pending changes with a full update.
+func (q *nodeQueue) forceFull() {
+	removedSelf := q.removed.Contains(q.nodeID)
+
+	q.clearChanges()
+	q.full = true
+	if removedSelf {
+		q.removed.Add(q.nodeID)
+	}
+
+	q.forcedFulls++
+	q.metrics.queueForcedFull.WithLabelValues(q.labels()...).Inc()
+}
+
+func (q *nodeQueue) clearChanges() {
+	q.self = false
+	clear(q.changed)
+	clear(q.removed)
+	clear(q.patches)
+}
+
+// pendingCount returns the number of updates the pending changes
+// would be delivered as.
+func (q *nodeQueue) pendingCount() int {
+	count := 0
+	if q.full {
+		count++
+	}
+	if q.derp != nil {
+		count++
+	}
+	if len(q.removed) > 0 {
+		count++
+	}
+	if len(q.changed) > 0 {
+		count++
+	}
+	if len(q.patches) > 0 {
+		count++
+	}
+	// Peer updates includes the node itself.
+	if q.self && len(q.changed) == 0 && len(q.removed) == 0 {
+		count++
+	}
+
+	return count
+}
+
+// take removes the pending changes from the queue and returns them
+// as the updates to deliver, in order.
+func (q *nodeQueue) take() []types.StateUpdate {
+	var updates []types.StateUpdate
+
+	// DERP map updates goes first as full updates include the DERP map.
+	if q.derp != nil {
+		updates = append(updates, *q.derp)
+		q.derp = nil
+	}
+
+	if q.full {
+		updates = append(updates, types.UpdateFull())
+		q.full = false
+	}
+
+	if len(q.removed) > 0 {
+		updates = append(updates, types.UpdatePeerRemoved(sortedIDs(q.removed)...))
+	}
+
+	if len(q.changed) > 0 {
+		update := types.UpdatePeerChanged(sortedIDs(q.changed)...)
+		update.Message = q.message
+		updates = append(updates, update)
+	}
+
+	if len(q.patches) > 0 {
+		ids := make([]types.NodeID, 0, len(q.patches))
+		for id := range q.patches {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+
+		patches := make([]*tailcfg.PeerChange, 0, len(ids))
+		for _, id := range ids {
+			patch := q.patches[id]
+			patches = append(patches, &patch)
+		}
+		updates = append(updates, types.UpdatePeerPatch(patches...))
+	}
+
+	if q.self && len(q.changed) == 0 && len(q.removed) == 0 {
+		update := types.UpdateSelf(q.nodeID)
+		update.Message = q.message
+		updates = append(updates, update)
+	}
+
+	q.clearChanges()
+	q.message = ""
+	q.inflight += len(updates)
+
+	return updates
+}
+
+// run delivers the pending updates to the session until the queue is
+// stopped.
+func (q *nodeQueue) run() {
+	defer close(q.stopped)
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.wake:
+		}
+
+		for {
+			q.mu.Lock()
+			updates := q.take()
+			q.mu.Unlock()
+
+			if len(updates) == 0 {
+				break
+			}
+
+			for _, update := range updates {
+				select {
+				case <-q.done:
+					return
+				case q.ch <- update:
+				}
+
+				q.mu.Lock()
+				q.inflight--
+				q.lastDelivered = time.Now()
+				if q.inflight == 0 && q.pendingCount() == 0 {
+					q.pendingSince = time.Time{}
+				}
+				q.reportDepth()
+				q.mu.Unlock()
+			}
+		}
+	}
+}
+
+// stop stops the delivery of updates, updates that has not been
+// delivered are dropped. The channel of the session is not closed.
+func (q *nodeQueue) stop() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.done)
+	<-q.stopped
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if debugHighCardinalityMetrics {
+		q.metrics.queueDepth.DeleteLabelValues(q.labels()...)
+	} else {
+		q.metrics.queueDepth.WithLabelValues().Sub(float64(q.reportedDepth))
+	}
+	q.reportedDepth = 0
+}
+
+// status returns the current status of the queue.
+func (q *nodeQueue) status() QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return QueueStatus{
+		NodeID:        q.nodeID,
+		Pending:       q.depth(),
+		PendingSince:  q.pendingSince,
+		LastDelivered: q.lastDelivered,
+		Merges:        q.merges,
+		ForcedFulls:   q.forcedFulls,
+	}
+}
+
+func (q *nodeQueue) depth() int {
+	return q.pendingCount() + q.inflight
+}
+
+// reportDepth updates the queue depth metric, it must be called
+// with the lock held.
+func (q *nodeQueue) reportDepth() {
+	depth := q.depth()
+	if depth == q.reportedDepth {
+		return
+	}
+
+	q.metrics.queueDepth.WithLabelValues(q.labels()...).Add(float64(depth - q.reportedDepth))
+	q.reportedDepth = depth
+}
+
+// labels returns the metric labels for the queue, the node ID is only
+// included if high cardinality metrics are enabled.
+func (q *nodeQueue) labels(values ...string) []string {
+	if debugHighCardinalityMetrics {
+		return append(values, q.nodeID.String())
+	}
+
+	return values
+}
+
+func sortedIDs(ids set.Set[types.NodeID]) []types.NodeID {
+	sorted := ids.Slice()
+	slices.Sort(sorted)
+
+	return sorted
+}
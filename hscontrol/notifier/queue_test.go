@@ -0,0 +1,157 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+)
+
+func TestNodeQueueMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []types.StateUpdate
+		want    []types.StateUpdate
+	}{
+		{
+			name: "collapse-patches",
+			updates: []types.StateUpdate{
+				types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: 2, DERPRegion: 5}),
+				types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: 2, Cap: 80}),
+				types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: 3, DERPRegion: 6}),
+			},
+			want: []types.StateUpdate{
+				types.UpdatePeerPatch(
+					&tailcfg.PeerChange{NodeID: 2, DERPRegion: 5, Cap: 80},
+					&tailcfg.PeerChange{NodeID: 3, DERPRegion: 6},
+				),
+			},
+		},
+		{
+			name: "changed-replaces-patch",
+			updates: []types.StateUpdate{
+				types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: 2, DERPRegion: 5}),
+				types.UpdatePeerChanged(2, 4),
+				types.UpdatePeerChanged(3),
+				types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: 3, DERPRegion: 6}),
+			},
+			want: []types.StateUpdate{
+				types.UpdatePeerChanged(2, 3, 4),
+			},
+		},
+		{
+			name: "removed-replaces-changed",
+			updates: []types.StateUpdate{
+				types.UpdatePeerChanged(2, 3),
+				types.UpdatePeerRemoved(2),
+				types.UpdateSelf(1),
+			},
+			want: []types.StateUpdate{
+				types.UpdatePeerRemoved(2),
+				types.UpdatePeerChanged(3),
+			},
+		},
+		{
+			name: "full-replaces-all",
+			updates: []types.StateUpdate{
+				types.UpdatePeerChanged(2),
+				types.UpdateSelf(1),
+				{Type: types.StateDERPUpdated},
+				types.UpdateFull(),
+				types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: 3, DERPRegion: 6}),
+				types.UpdatePeerRemoved(4),
+			},
+			want: []types.StateUpdate{
+				{Type: types.StateDERPUpdated},
+				types.UpdateFull(),
+			},
+		},
+		{
+			name: "full-keeps-self-removal",
+			updates: []types.StateUpdate{
+				types.UpdateFull(),
+				types.UpdatePeerRemoved(1, 2),
+			},
+			want: []types.StateUpdate{
+				types.UpdateFull(),
+				types.UpdatePeerRemoved(1),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newNodeQueue(1, make(chan types.StateUpdate), 0, newMetrics(nil))
+			for _, update := range tt.updates {
+				q.merge(update)
+			}
+
+			got := q.take()
+			if diff := cmp.Diff(tt.want, got, util.Comparers...); diff != "" {
+				t.Errorf("take() unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNodeQueueBackpressure(t *testing.T) {
+	n := NewNotifier(&types.Config{
+		Tuning: types.Tuning{
+			BatchChangeDelay:    time.Hour,
+			NotifierSendTimeout: time.Millisecond,
+			NotifierQueueSize:   3,
+		},
+	}, nil)
+	defer n.Close()
+
+	// The session does not read from the channel, but the
+	// producers must not block.
+	ch := make(chan types.StateUpdate, 1)
+	n.AddNode(1, ch)
+
+	ctx := context.Background()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.NotifyByNodeID(ctx, types.UpdatePeerChanged(2), 1)
+		for i := range 10 {
+			n.NotifyByNodeID(ctx, types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: tailcfg.NodeID(i + 3), DERPRegion: 1}), 1)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifying a stalled session blocked")
+	}
+
+	// The session is lagging behind, and the queue overflowed.
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		lagging := n.LaggingSessions()
+		if assert.Len(c, lagging, 1) {
+			assert.Equal(c, types.NodeID(1), lagging[0].NodeID)
+			assert.Equal(c, uint64(1), lagging[0].ForcedFulls)
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// When the session catches up, it gets the first update, that
+	// was delivered directly, and a full update replacing the rest.
+	// The first patch might have been taken by the delivery before
+	// the queue overflowed.
+	require.Equal(t, types.StatePeerChanged, (<-ch).Type)
+	next := <-ch
+	if next.Type == types.StatePeerChangedPatch {
+		next = <-ch
+	}
+	require.Equal(t, types.StateFullUpdate, next.Type)
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Empty(c, n.LaggingSessions())
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,379 @@
+package hscontrol
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// oauthAccessTokenPrefix starts every access token issued to an
+	// OAuth client, to tell them apart from API keys.
+	oauthAccessTokenPrefix   = "hsot_"
+	oauthAccessTokenLifetime = time.Hour
+)
+
+var (
+	errOAuthAccessTokenInvalid = errors.New("invalid OAuth access token")
+	errOAuthAccessTokenExpired = errors.New("OAuth access token expired")
+)
+
+// oauthMethodScopes is the scope an OAuth client needs to call each method
+// of the API. Methods not listed here need the "all" scope, e.g. the invite
+// methods, as invites create users and tagged pre auth keys, and
+// SetUserQuota, so that a client cannot lift the limits of its users.
+var oauthMethodScopes = map[string]string{
+	"CreateUser":    types.OAuthScopeUsers,
+	"RenameUser":    types.OAuthScopeUsers,
+	"DeleteUser":    types.OAuthScopeUsers,
+	"MergeUsers":    types.OAuthScopeUsers,
+	"DisableUser":   types.OAuthScopeUsers,
+	"EnableUser":    types.OAuthScopeUsers,
+	"ListUsers":     types.OAuthScopeUsers + types.OAuthScopeReadSuffix,
+	"ListUserLinks": types.OAuthScopeUsers + types.OAuthScopeReadSuffix,
+
+	"CreatePreAuthKey":      types.OAuthScopeAuthKeys,
+	"ExpirePreAuthKey":      types.OAuthScopeAuthKeys,
+	"ListPreAuthKeys":       types.OAuthScopeAuthKeys + types.OAuthScopeReadSuffix,
+	"ListNodesByPreAuthKey": types.OAuthScopeAuthKeys + types.OAuthScopeReadSuffix,
+
+	"DebugCreateNode":   types.OAuthScopeNodes,
+	"SetTags":           types.OAuthScopeNodes,
+	"LabelNode":         types.OAuthScopeNodes,
+	"SetApprovedRoutes": types.OAuthScopeNodes,
+	"RegisterNode":      types.OAuthScopeNodes,
+	"DeleteNode":        types.OAuthScopeNodes,
+	"ExpireNode":        types.OAuthScopeNodes,
+	"RenameNode":        types.OAuthScopeNodes,
+	"MoveNode":          types.OAuthScopeNodes,
+	"BackfillNodeIPs":   types.OAuthScopeNodes,
+	"GetNode":           types.OAuthScopeNodes + types.OAuthScopeReadSuffix,
+	"ListNodes":         types.OAuthScopeNodes + types.OAuthScopeReadSuffix,
+
+	"GetPolicy": types.OAuthScopePolicy + types.OAuthScopeReadSuffix,
+	"SetPolicy": types.OAuthScopePolicy,
+
+	"ListApiKeys":      types.OAuthScopeAll + types.OAuthScopeReadSuffix,
+	"ListDNSRecords":   types.OAuthScopeAll + types.OAuthScopeReadSuffix,
+	"ListOAuthClients": types.OAuthScopeAll + types.OAuthScopeReadSuffix,
+	"ListInvites":      types.OAuthScopeAll + types.OAuthScopeReadSuffix,
+}
+
+// oauthScopeForMethod returns the scope needed to call the gRPC method with
+// the given full name, e.g. "/headscale.v1.HeadscaleService/ListNodes".
+func oauthScopeForMethod(fullMethod string) string {
+	if scope, ok := oauthMethodScopes[path.Base(fullMethod)]; ok {
+		return scope
+	}
+
+	return types.OAuthScopeAll
+}
+
+// oauthAccessToken is the content of an access token, signed by headscale.
+type oauthAccessToken struct {
+	ClientID string   `json:"cid"`
+	Scopes   []string `json:"scp"`
+	Expiry   int64    `json:"exp"`
+}
+
+type oauthClientContextKey struct{}
+
+// oauthClientFromContext returns the OAuth client making an API request,
+// if the request was authenticated with an OAuth access token.
+func oauthClientFromContext(ctx context.Context) (*types.OAuthClient, bool) {
+	client, ok := ctx.Value(oauthClientContextKey{}).(*types.OAuthClient)
+
+	return client, ok
+}
+
+func isOAuthAccessToken(token string) bool {
+	return strings.HasPrefix(token, oauthAccessTokenPrefix)
+}
+
+// oauthSigningKey derives the key signing access tokens from the noise
+// private key, so tokens stay valid across restarts.
+func oauthSigningKey(noiseKey []byte) []byte {
+	mac := hmac.New(sha256.New, noiseKey)
+	mac.Write([]byte("headscale oauth access token"))
+
+	return mac.Sum(nil)
+}
+
+func (h *Headscale) signOAuthAccessToken(payload string) []byte {
+	mac := hmac.New(sha256.New, h.oauthSigningKey)
+	mac.Write([]byte(payload))
+
+	return mac.Sum(nil)
+}
+
+// issueOAuthAccessToken returns a signed access token for the client,
+// granting the given scopes.
+func (h *Headscale) issueOAuthAccessToken(
+	client *types.OAuthClient,
+	scopes []string,
+	expiry time.Time,
+) (string, error) {
+	content, err := json.Marshal(oauthAccessToken{
+		ClientID: client.ClientID,
+		Scopes:   scopes,
+		Expiry:   expiry.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("encoding access token: %w", err)
+	}
+
+	payload := oauthAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(content)
+	signature := base64.RawURLEncoding.EncodeToString(h.signOAuthAccessToken(payload))
+
+	return payload + "." + signature, nil
+}
+
+// validateOAuthAccessToken checks the signature and expiry of an access
+// token, and returns the client it was issued to, with the scopes it
+// grants. Tokens of deleted or expired clients are not valid.
+func (h *Headscale) validateOAuthAccessToken(token string) (*types.OAuthClient, []string, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found || !isOAuthAccessToken(payload) {
+		return nil, nil, errOAuthAccessTokenInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, h.signOAuthAccessToken(payload)) {
+		return nil, nil, errOAuthAccessTokenInvalid
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(payload, oauthAccessTokenPrefix))
+	if err != nil {
+		return nil, nil, errOAuthAccessTokenInvalid
+	}
+
+	var accessToken oauthAccessToken
+	if err := json.Unmarshal(content, &accessToken); err != nil {
+		return nil, nil, errOAuthAccessTokenInvalid
+	}
+
+	if time.Now().After(time.Unix(accessToken.Expiry, 0)) {
+		return nil, nil, errOAuthAccessTokenExpired
+	}
+
+	client, err := h.db.GetOAuthClient(accessToken.ClientID)
+	if err != nil {
+		if errors.Is(err, db.ErrOAuthClientNotFound) {
+			return nil, nil, errOAuthAccessTokenInvalid
+		}
+
+		return nil, nil, err
+	}
+
+	if client.IsExpired() {
+		return nil, nil, errOAuthAccessTokenExpired
+	}
+
+	return client, accessToken.Scopes, nil
+}
+
+// authorizeOAuthAccessToken checks that the access token allows calling the
+// gRPC method, and returns a context carrying the OAuth client.
+func (h *Headscale) authorizeOAuthAccessToken(
+	ctx context.Context,
+	token string,
+	fullMethod string,
+) (context.Context, error) {
+	client, scopes, err := h.validateOAuthAccessToken(token)
+	if err != nil {
+		if errors.Is(err, errOAuthAccessTokenInvalid) || errors.Is(err, errOAuthAccessTokenExpired) {
+			return ctx, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		return ctx, status.Error(codes.Internal, "failed to validate token")
+	}
+
+	scope := oauthScopeForMethod(fullMethod)
+	if !types.OAuthScopesAllow(scopes, scope) {
+		return ctx, status.Errorf(
+			codes.PermissionDenied,
+			"OAuth client %s needs the %q scope",
+			client.ClientID,
+			scope,
+		)
+	}
+
+	return context.WithValue(ctx, oauthClientContextKey{}, client), nil
+}
+
+// grpcOAuthScopeInterceptor checks the scopes of the OAuth access tokens
+// forwarded by the gRPC gateway to the local gRPC server. Requests without
+// an access token are let through, like all requests on the unix socket.
+func (h *Headscale) grpcOAuthScopeInterceptor(ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	meta, _ := metadata.FromIncomingContext(ctx)
+	for _, token := range meta.Get("authorization") {
+		token = strings.TrimPrefix(token, AuthPrefix)
+		if !isOAuthAccessToken(token) {
+			continue
+		}
+
+		var err error
+		ctx, err = h.authorizeOAuthAccessToken(ctx, token, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+// oauthTokenResponse is the response of the token endpoint, as described
+// in RFC 6749, section 5.1.
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// oauthErrorResponse is an error of the token endpoint, as described in
+// RFC 6749, section 5.2.
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthTokenHandler exchanges the ID and secret of an OAuth client for an
+// access token, with the client credentials grant of RFC 6749.
+// The client can request a subset of its scopes with the scope parameter.
+func (h *Headscale) OAuthTokenHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	if err := req.ParseForm(); err != nil {
+		writeOAuthError(writer, http.StatusBadRequest, "invalid_request", "failed to parse form")
+
+		return
+	}
+
+	if grantType := req.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		writeOAuthError(writer, http.StatusBadRequest, "unsupported_grant_type",
+			fmt.Sprintf("grant type %q is not supported", grantType))
+
+		return
+	}
+
+	clientID, clientSecret, ok := req.BasicAuth()
+	if !ok {
+		clientID = req.PostForm.Get("client_id")
+		clientSecret = req.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" || clientSecret == "" {
+		writeOAuthError(writer, http.StatusUnauthorized, "invalid_client", "client credentials are missing")
+
+		return
+	}
+
+	client, err := h.db.ValidateOAuthClient(clientID, clientSecret)
+	if err != nil {
+		if errors.Is(err, db.ErrOAuthClientNotFound) {
+			h.logger.Info().
+				Str("client_address", req.RemoteAddr).
+				Str("client_id", clientID).
+				Msg("invalid OAuth client credentials")
+
+			writeOAuthError(writer, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+
+			return
+		}
+
+		h.logger.Error().
+			Caller().
+			Err(err).
+			Msg("failed to validate OAuth client")
+		writeOAuthError(writer, http.StatusInternalServerError, "server_error", "")
+
+		return
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(req.PostForm.Get("scope")); len(requested) > 0 {
+		if err := types.ValidateOAuthScopes(requested); err != nil {
+			writeOAuthError(writer, http.StatusBadRequest, "invalid_scope", err.Error())
+
+			return
+		}
+
+		for _, scope := range requested {
+			if !types.OAuthScopesAllow(client.Scopes, scope) {
+				writeOAuthError(writer, http.StatusBadRequest, "invalid_scope",
+					fmt.Sprintf("scope %q is not granted to the client", scope))
+
+				return
+			}
+		}
+
+		scopes = requested
+	}
+
+	slices.Sort(scopes)
+
+	token, err := h.issueOAuthAccessToken(client, scopes, time.Now().Add(oauthAccessTokenLifetime))
+	if err != nil {
+		h.logger.Error().
+			Caller().
+			Err(err).
+			Msg("failed to issue OAuth access token")
+		writeOAuthError(writer, http.StatusInternalServerError, "server_error", "")
+
+		return
+	}
+
+	writeOAuthResponse(writer, http.StatusOK, oauthTokenResponse{
+		AccessToken: token,
+		TokenType:   strings.TrimSpace(AuthPrefix),
+		ExpiresIn:   int(oauthAccessTokenLifetime.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+func writeOAuthError(writer http.ResponseWriter, code int, oauthErr, description string) {
+	if code == http.StatusUnauthorized {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="headscale"`)
+	}
+
+	writeOAuthResponse(writer, code, oauthErrorResponse{
+		Error:            oauthErr,
+		ErrorDescription: description,
+	})
+}
+
+func writeOAuthResponse(writer http.ResponseWriter, code int, body any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(code)
+
+	if err := json.NewEncoder(writer).Encode(body); err != nil {
+		log.Error().
+			Caller().
+			Err(err).
+			Msg("Failed to write response")
+	}
+}
@@ -0,0 +1,260 @@
+package hscontrol
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func newOAuthTestHeadscale(t *testing.T) *Headscale {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	h, err := NewHeadscale(&types.Config{
+		NoisePrivateKeyPath: tmpDir + "/noise_private.key",
+		Database: types.DatabaseConfig{
+			Type: "sqlite3",
+			Sqlite: types.SqliteConfig{
+				Path: tmpDir + "/headscale_test.db",
+			},
+		},
+		Policy: types.PolicyConfig{
+			Mode: types.PolicyModeDB,
+		},
+		Tuning: types.Tuning{
+			BatchChangeDelay: time.Hour,
+		},
+	})
+	require.NoError(t, err)
+
+	return h
+}
+
+func requestOAuthToken(t *testing.T, h *Headscale, form url.Values) (int, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	h.OAuthTokenHandler(rec, req)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+
+	return rec.Code, body
+}
+
+func TestOAuthTokenHandler(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+
+	secret, client, err := h.db.CreateOAuthClient(db.OAuthClientOptions{
+		Scopes: []string{"nodes", "users:read"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		form      url.Values
+		wantCode  int
+		wantError string
+		wantScope string
+	}{
+		{
+			name: "all-scopes",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {client.ClientID},
+				"client_secret": {secret},
+			},
+			wantCode:  http.StatusOK,
+			wantScope: "nodes users:read",
+		},
+		{
+			name: "narrower-scope",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {client.ClientID},
+				"client_secret": {secret},
+				"scope":         {"nodes:read"},
+			},
+			wantCode:  http.StatusOK,
+			wantScope: "nodes:read",
+		},
+		{
+			name: "scope-not-granted",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {client.ClientID},
+				"client_secret": {secret},
+				"scope":         {"users"},
+			},
+			wantCode:  http.StatusBadRequest,
+			wantError: "invalid_scope",
+		},
+		{
+			name: "wrong-secret",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {client.ClientID},
+				"client_secret": {"wrong"},
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantError: "invalid_client",
+		},
+		{
+			name: "wrong-grant-type",
+			form: url.Values{
+				"grant_type":    {"password"},
+				"client_id":     {client.ClientID},
+				"client_secret": {secret},
+			},
+			wantCode:  http.StatusBadRequest,
+			wantError: "unsupported_grant_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := requestOAuthToken(t, h, tt.form)
+			assert.Equal(t, tt.wantCode, code)
+
+			if tt.wantError != "" {
+				assert.Equal(t, tt.wantError, body["error"])
+
+				return
+			}
+
+			assert.Equal(t, "Bearer", body["token_type"])
+			assert.Equal(t, tt.wantScope, body["scope"])
+			assert.EqualValues(t, oauthAccessTokenLifetime.Seconds(), body["expires_in"])
+			assert.True(t, isOAuthAccessToken(body["access_token"].(string)))
+		})
+	}
+}
+
+func TestOAuthAccessTokenAuthentication(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+
+	secret, client, err := h.db.CreateOAuthClient(db.OAuthClientOptions{
+		Scopes: []string{"nodes:read", "auth_keys"},
+		Tags:   []string{"tag:ci"},
+	})
+	require.NoError(t, err)
+
+	_, body := requestOAuthToken(t, h, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {client.ClientID},
+		"client_secret": {secret},
+	})
+	token := body["access_token"].(string)
+
+	expired, err := h.issueOAuthAccessToken(client, []string{"nodes:read"}, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	call := func(token, method string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", AuthPrefix+token))
+
+		_, err := h.grpcAuthenticationInterceptor(ctx, nil,
+			&grpc.UnaryServerInfo{FullMethod: "/headscale.v1.HeadscaleService/" + method},
+			func(ctx context.Context, _ any) (any, error) {
+				got, ok := oauthClientFromContext(ctx)
+				require.True(t, ok)
+				assert.Equal(t, client.ClientID, got.ClientID)
+
+				return nil, nil
+			},
+		)
+
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		want   codes.Code
+	}{
+		{name: "read-scope", token: token, method: "ListNodes", want: codes.OK},
+		{name: "write-scope", token: token, method: "CreatePreAuthKey", want: codes.OK},
+		{name: "missing-scope", token: token, method: "DeleteNode", want: codes.PermissionDenied},
+		{name: "admin-method", token: token, method: "CreateApiKey", want: codes.PermissionDenied},
+		{name: "expired", token: expired, method: "ListNodes", want: codes.Unauthenticated},
+		{name: "tampered", token: token[:len(token)-2] + "AA", method: "ListNodes", want: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, status.Code(call(tt.token, tt.method)))
+		})
+	}
+
+	require.NoError(t, h.db.DestroyOAuthClient(*client))
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(token, "ListNodes")))
+}
+
+func TestCreatePreAuthKeyWithOAuthClient(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	api := newHeadscaleV1APIServer(h)
+
+	user, err := h.db.CreateUser(types.User{Name: "ci"})
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), oauthClientContextKey{}, &types.OAuthClient{
+		ClientID: "ci",
+		Tags:     []string{"tag:ci", "tag:runner"},
+	})
+
+	tests := []struct {
+		name        string
+		tags        []string
+		constraints *v1.PreAuthKeyConstraints
+		want        codes.Code
+	}{
+		{name: "owned-tags", tags: []string{"tag:ci"}, want: codes.OK},
+		{name: "untagged", tags: nil, want: codes.PermissionDenied},
+		{name: "foreign-tag", tags: []string{"tag:ci", "tag:prod"}, want: codes.PermissionDenied},
+		{
+			name:        "approved-routes",
+			tags:        []string{"tag:ci"},
+			constraints: &v1.PreAuthKeyConstraints{ApprovedRoutes: []string{"10.0.0.0/8"}},
+			want:        codes.PermissionDenied,
+		},
+		{
+			name:        "hostname-constraint",
+			tags:        []string{"tag:ci"},
+			constraints: &v1.PreAuthKeyConstraints{HostnamePattern: "ci-*"},
+			want:        codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := api.CreatePreAuthKey(ctx, &v1.CreatePreAuthKeyRequest{
+				User:        uint64(user.ID),
+				AclTags:     tt.tags,
+				Expiration:  nil,
+				Constraints: tt.constraints,
+			})
+			assert.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
@@ -22,7 +22,6 @@ import (
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/oauth2"
-	"zgo.at/zcache/v2"
 )
 
 const (
@@ -45,22 +44,23 @@ var (
 		"requested node state key expired before authorisation completed",
 	)
 	errOIDCNodeKeyMissing = errors.New("could not get node key from cache")
+	errOIDCNotAdmin       = errors.New("authenticated principal is not an admin")
 )
 
-// RegistrationInfo contains both machine key and verifier information for OIDC validation.
-type RegistrationInfo struct {
-	RegistrationID types.RegistrationID
-	Verifier       *string
-}
-
 type AuthProviderOIDC struct {
-	serverURL         string
-	cfg               *types.OIDCConfig
-	db                *db.HSDatabase
-	registrationCache *zcache.Cache[string, RegistrationInfo]
-	notifier          *notifier.Notifier
-	ipAlloc           *db.IPAllocator
-	polMan            policy.PolicyManager
+	serverURL string
+	cfg       *types.OIDCConfig
+	db        *db.HSDatabase
+	nodeStore *db.NodeStore
+	notifier  *notifier.Notifier
+	ipAlloc   *db.IPAllocator
+	polMan    policy.PolicyManager
+	hooks     *hooks
+
+	// approval and startAdminSession are set when admins can log in with
+	// OIDC to approve registrations.
+	approval          *types.RegistrationApprovalConfig
+	startAdminSession func(http.ResponseWriter, *http.Request, string, *uint64)
 
 	oidcProvider *oidc.Provider
 	oauth2Config *oauth2.Config
@@ -71,9 +71,11 @@ func NewAuthProviderOIDC(
 	serverURL string,
 	cfg *types.OIDCConfig,
 	db *db.HSDatabase,
+	nodeStore *db.NodeStore,
 	notif *notifier.Notifier,
 	ipAlloc *db.IPAllocator,
 	polMan policy.PolicyManager,
+	hooks *hooks,
 ) (*AuthProviderOIDC, error) {
 	var err error
 	// grab oidc config if it hasn't been already
@@ -93,19 +95,15 @@ func NewAuthProviderOIDC(
 		Scopes: cfg.Scope,
 	}
 
-	registrationCache := zcache.New[string, RegistrationInfo](
-		registerCacheExpiration,
-		registerCacheCleanup,
-	)
-
 	return &AuthProviderOIDC{
-		serverURL:         serverURL,
-		cfg:               cfg,
-		db:                db,
-		registrationCache: registrationCache,
-		notifier:          notif,
-		ipAlloc:           ipAlloc,
-		polMan:            polMan,
+		serverURL: serverURL,
+		cfg:       cfg,
+		db:        db,
+		nodeStore: nodeStore,
+		notifier:  notif,
+		ipAlloc:   ipAlloc,
+		polMan:    polMan,
+		hooks:     hooks,
 
 		oidcProvider: oidcProvider,
 		oauth2Config: oauth2Config,
@@ -146,6 +144,43 @@ func (a *AuthProviderOIDC) RegisterHandler(
 		return
 	}
 
+	a.redirectToProvider(writer, req, types.OIDCLogin{
+		RegistrationID: registrationId,
+	})
+}
+
+// AdminLoginHandler redirects an admin to the OIDC provider to log in to
+// approve registrations.
+// Listens in /admin/login/oidc.
+func (a *AuthProviderOIDC) AdminLoginHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	if a.startAdminSession == nil {
+		httpError(writer, NewHTTPError(http.StatusNotFound, "OIDC admin login is not enabled", nil))
+		return
+	}
+
+	a.redirectToProvider(writer, req, types.OIDCLogin{AdminLogin: true})
+}
+
+// enableAdminLogin lets admins whose claims match cfg log in with OIDC to
+// approve registrations, starting their session with startSession.
+func (a *AuthProviderOIDC) enableAdminLogin(
+	cfg *types.RegistrationApprovalConfig,
+	startSession func(http.ResponseWriter, *http.Request, string, *uint64),
+) {
+	a.approval = cfg
+	a.startAdminSession = startSession
+}
+
+// redirectToProvider redirects to the OIDC provider for authentication,
+// storing login for the callback under the oidc state param.
+func (a *AuthProviderOIDC) redirectToProvider(
+	writer http.ResponseWriter,
+	req *http.Request,
+	login types.OIDCLogin,
+) {
 	// Set the state and nonce cookies to protect against CSRF attacks
 	state, err := setCSRFCookie(writer, req, "state")
 	if err != nil {
@@ -160,16 +195,11 @@ func (a *AuthProviderOIDC) RegisterHandler(
 		return
 	}
 
-	// Initialize registration info with machine key
-	registrationInfo := RegistrationInfo{
-		RegistrationID: registrationId,
-	}
-
 	extras := make([]oauth2.AuthCodeOption, 0, len(a.cfg.ExtraParams)+defaultOAuthOptionsCount)
 	// Add PKCE verification if enabled
 	if a.cfg.PKCE.Enabled {
 		verifier := oauth2.GenerateVerifier()
-		registrationInfo.Verifier = &verifier
+		login.Verifier = &verifier
 
 		extras = append(extras, oauth2.AccessTypeOffline)
 
@@ -188,8 +218,12 @@ func (a *AuthProviderOIDC) RegisterHandler(
 	}
 	extras = append(extras, oidc.Nonce(nonce))
 
-	// Cache the registration info
-	a.registrationCache.Set(state, registrationInfo)
+	// Store the login, for the callback to be handled by any instance.
+	login.State = state
+	if err := a.db.CreateOIDCLogin(login); err != nil {
+		httpError(writer, err)
+		return
+	}
 
 	authURL := a.oauth2Config.AuthCodeURL(state, extras...)
 	log.Debug().Msgf("Redirecting to %s for authentication", authURL)
@@ -260,25 +294,55 @@ func (a *AuthProviderOIDC) OIDCCallbackHandler(
 
 	nodeExpiry := a.determineNodeExpiry(idToken.Expiry)
 
+	var invite *types.Invite
+	if login, err := a.db.GetOIDCLogin(state); err == nil {
+		if login.AdminLogin {
+			if err := a.db.DeleteOIDCLogin(state); err != nil {
+				httpError(writer, err)
+				return
+			}
+			a.handleAdminLogin(writer, req, idToken)
+
+			return
+		}
+
+		if login.InviteID != nil {
+			invite, err = a.db.GetInviteByID(*login.InviteID)
+			if err == nil {
+				// The invite may have been revoked, used or expired since
+				// the login started.
+				err = db.CheckInvite(invite)
+			}
+			if err != nil {
+				httpError(writer, inviteHTTPError(err))
+				return
+			}
+		}
+	}
+
 	var claims types.OIDCClaims
 	if err := idToken.Claims(&claims); err != nil {
 		httpError(writer, fmt.Errorf("decoding ID token claims: %w", err))
 		return
 	}
 
-	if err := validateOIDCAllowedDomains(a.cfg.AllowedDomains, &claims); err != nil {
-		httpError(writer, err)
-		return
-	}
+	// An invite for an email lets that person in even if they are not
+	// otherwise allowed, the email is checked below.
+	if invite == nil || invite.Email == "" {
+		if err := validateOIDCAllowedDomains(a.cfg.AllowedDomains, &claims); err != nil {
+			httpError(writer, err)
+			return
+		}
 
-	if err := validateOIDCAllowedGroups(a.cfg.AllowedGroups, &claims); err != nil {
-		httpError(writer, err)
-		return
-	}
+		if err := validateOIDCAllowedGroups(a.cfg.AllowedGroups, &claims); err != nil {
+			httpError(writer, err)
+			return
+		}
 
-	if err := validateOIDCAllowedUsers(a.cfg.AllowedUsers, &claims); err != nil {
-		httpError(writer, err)
-		return
+		if err := validateOIDCAllowedUsers(a.cfg.AllowedUsers, &claims); err != nil {
+			httpError(writer, err)
+			return
+		}
 	}
 
 	var userinfo *oidc.UserInfo
@@ -305,12 +369,28 @@ func (a *AuthProviderOIDC) OIDCCallbackHandler(
 		}
 	}
 
+	if invite != nil && invite.Email != "" &&
+		(!bool(claims.EmailVerified) || !strings.EqualFold(claims.Email, invite.Email)) {
+		httpError(writer, inviteHTTPError(db.ErrInviteEmail))
+		return
+	}
+
 	user, err := a.createOrUpdateUserFromClaim(&claims)
 	if err != nil {
 		httpError(writer, err)
 		return
 	}
 
+	if user.IsDisabled() {
+		httpError(writer, NewHTTPError(http.StatusForbidden, "user is disabled", db.ErrUserDisabled))
+		return
+	}
+
+	if invite != nil {
+		a.acceptInvite(writer, state, invite, user)
+		return
+	}
+
 	// TODO(kradalby): Is this comment right?
 	// If the node exists, then the node should be reauthenticated,
 	// if the node does not exist, and the machine key exists, then
@@ -320,7 +400,7 @@ func (a *AuthProviderOIDC) OIDCCallbackHandler(
 	// Register the node if it does not exist.
 	if registrationId != nil {
 		verb := "Reauthenticated"
-		newNode, err := a.handleRegistration(user, *registrationId, nodeExpiry)
+		newNode, err := a.handleRegistration(req.Context(), user, *registrationId, nodeExpiry)
 		if err != nil {
 			httpError(writer, err)
 			return
@@ -374,12 +454,16 @@ func (a *AuthProviderOIDC) getOauth2Token(
 	var exchangeOpts []oauth2.AuthCodeOption
 
 	if a.cfg.PKCE.Enabled {
-		regInfo, ok := a.registrationCache.Get(state)
-		if !ok {
-			return nil, NewHTTPError(http.StatusNotFound, "registration not found", errNoOIDCRegistrationInfo)
+		login, err := a.db.GetOIDCLogin(state)
+		if err != nil {
+			if errors.Is(err, db.ErrOIDCLoginNotFound) {
+				return nil, NewHTTPError(http.StatusNotFound, "registration not found", errNoOIDCRegistrationInfo)
+			}
+
+			return nil, err
 		}
-		if regInfo.Verifier != nil {
-			exchangeOpts = []oauth2.AuthCodeOption{oauth2.VerifierOption(*regInfo.Verifier)}
+		if login.Verifier != nil {
+			exchangeOpts = []oauth2.AuthCodeOption{oauth2.VerifierOption(*login.Verifier)}
 		}
 	}
 
@@ -460,14 +544,86 @@ func validateOIDCAllowedUsers(
 	return nil
 }
 
+// handleAdminLogin starts the session of an admin logged in with OIDC, if
+// the admin claim of the ID token holds one of the admin values.
+func (a *AuthProviderOIDC) handleAdminLogin(
+	writer http.ResponseWriter,
+	req *http.Request,
+	idToken *oidc.IDToken,
+) {
+	if a.startAdminSession == nil {
+		httpError(writer, NewHTTPError(http.StatusNotFound, "OIDC admin login is not enabled", nil))
+		return
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		httpError(writer, fmt.Errorf("decoding ID token claims: %w", err))
+		return
+	}
+
+	if !oidcClaimHoldsAny(claims[a.approval.OIDCAdminClaim], a.approval.OIDCAdminValues) {
+		httpError(writer, NewHTTPError(http.StatusForbidden, "not an admin", errOIDCNotAdmin))
+		return
+	}
+
+	email, _ := claims["email"].(string)
+	a.startAdminSession(writer, req, cmp.Or(email, idToken.Subject), nil)
+}
+
+// acceptInvite accepts the invite the OIDC login was started for, as the
+// logged in user.
+func (a *AuthProviderOIDC) acceptInvite(
+	writer http.ResponseWriter,
+	state string,
+	invite *types.Invite,
+	user *types.User,
+) {
+	if err := a.db.DeleteOIDCLogin(state); err != nil {
+		httpError(writer, err)
+		return
+	}
+
+	user, key, err := a.db.AcceptInvite(invite.ID, user)
+	if err != nil {
+		httpError(writer, inviteHTTPError(err))
+		return
+	}
+
+	log.Info().
+		Uint64("invite.id", invite.ID).
+		Uint("user.id", user.ID).
+		Str("user.name", user.Name).
+		Msg("invite accepted with OIDC")
+
+	writeInviteAccepted(writer, a.serverURL, user, key)
+}
+
+// oidcClaimHoldsAny reports whether a claim, a string or a list of strings,
+// holds one of the values.
+func oidcClaimHoldsAny(claim any, values []string) bool {
+	switch claim := claim.(type) {
+	case string:
+		return slices.Contains(values, claim)
+	case []any:
+		for _, item := range claim {
+			if str, ok := item.(string); ok && slices.Contains(values, str) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // getRegistrationIDFromState retrieves the registration ID from the state.
 func (a *AuthProviderOIDC) getRegistrationIDFromState(state string) *types.RegistrationID {
-	regInfo, ok := a.registrationCache.Get(state)
-	if !ok {
+	login, err := a.db.GetOIDCLogin(state)
+	if err != nil {
 		return nil
 	}
 
-	return &regInfo.RegistrationID
+	return &login.RegistrationID
 }
 
 func (a *AuthProviderOIDC) createOrUpdateUserFromClaim(
@@ -480,18 +636,50 @@ func (a *AuthProviderOIDC) createOrUpdateUserFromClaim(
 		return nil, fmt.Errorf("creating or updating user: %w", err)
 	}
 
+	// The first login of a user can be linked to an existing user created
+	// with the CLI, by their verified email.
+	var link *types.UserLink
+	if user == nil && a.cfg.LinkUsersByEmail && bool(claims.EmailVerified) && claims.Email != "" {
+		user, err = a.db.GetLocalUserByEmail(claims.Email)
+		if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+			return nil, fmt.Errorf("creating or updating user: %w", err)
+		}
+
+		if user != nil {
+			link = &types.UserLink{
+				UserID: user.ID,
+				Kind:   types.UserLinkOIDCEmail,
+				Email:  claims.Email,
+			}
+		}
+	}
+
 	// if the user is still not found, create a new empty user.
 	if user == nil {
 		user = &types.User{}
 	}
 
 	user.FromClaim(claims)
-	err = a.db.DB.Save(user).Error
+	if link != nil {
+		link.Source = user.ProviderIdentifier.String
+		err = a.db.LinkUser(user, *link)
+	} else {
+		err = a.db.DB.Save(user).Error
+	}
 	if err != nil {
 		return nil, fmt.Errorf("creating or updating user: %w", err)
 	}
 
-	err = usersChangedHook(a.db, a.polMan, a.notifier)
+	if link != nil {
+		log.Info().
+			Uint("user.id", user.ID).
+			Str("user.name", user.Name).
+			Str("oidc.identifier", link.Source).
+			Str("oidc.email", link.Email).
+			Msg("linked OIDC login to existing user by email")
+	}
+
+	err = usersChangedHook(a.db, a.nodeStore, a.polMan, a.notifier)
 	if err != nil {
 		return nil, fmt.Errorf("updating resources using user: %w", err)
 	}
@@ -500,62 +688,25 @@ func (a *AuthProviderOIDC) createOrUpdateUserFromClaim(
 }
 
 func (a *AuthProviderOIDC) handleRegistration(
+	ctx context.Context,
 	user *types.User,
 	registrationID types.RegistrationID,
 	expiry time.Time,
 ) (bool, error) {
-	ipv4, ipv6, err := a.ipAlloc.Next()
-	if err != nil {
-		return false, err
+	reg := registrar{
+		db:        a.db,
+		nodeStore: a.nodeStore,
+		notifier:  a.notifier,
+		ipAlloc:   a.ipAlloc,
+		polMan:    a.polMan,
+		hooks:     a.hooks,
 	}
 
-	node, newNode, err := a.db.HandleNodeFromAuthPath(
-		registrationID,
-		types.UserID(user.ID),
-		&expiry,
-		util.RegisterMethodOIDC,
-		ipv4, ipv6,
-	)
+	_, newNode, err := reg.registerFromAuthPath(ctx, registrationID, user, &expiry, util.RegisterMethodOIDC)
 	if err != nil {
 		return false, fmt.Errorf("could not register node: %w", err)
 	}
 
-	// Send an update to all nodes if this is a new node that they need to know
-	// about.
-	// If this is a refresh, just send new expiry updates.
-	updateSent, err := nodesChangedHook(a.db, a.polMan, a.notifier)
-	if err != nil {
-		return false, fmt.Errorf("updating resources using node: %w", err)
-	}
-
-	// This is a bit of a back and forth, but we have a bit of a chicken and egg
-	// dependency here.
-	// Because the way the policy manager works, we need to have the node
-	// in the database, then add it to the policy manager and then we can
-	// approve the route. This means we get this dance where the node is
-	// first added to the database, then we add it to the policy manager via
-	// nodesChangedHook and then we can auto approve the routes.
-	// As that only approves the struct object, we need to save it again and
-	// ensure we send an update.
-	// This works, but might be another good candidate for doing some sort of
-	// eventbus.
-	routesChanged := policy.AutoApproveRoutes(a.polMan, node)
-	if err := a.db.DB.Save(node).Error; err != nil {
-		return false, fmt.Errorf("saving auto approved routes to node: %w", err)
-	}
-
-	if !updateSent || routesChanged {
-		ctx := types.NotifyCtx(context.Background(), "oidc-expiry-self", node.Hostname)
-		a.notifier.NotifyByNodeID(
-			ctx,
-			types.UpdateSelf(node.ID),
-			node.ID,
-		)
-
-		ctx = types.NotifyCtx(context.Background(), "oidc-expiry-peers", node.Hostname)
-		a.notifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
-	}
-
 	return newNode, nil
 }
 
@@ -0,0 +1,87 @@
+package hscontrol
+
+import (
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuthProviderOIDC(t *testing.T, cfg types.OIDCConfig) *AuthProviderOIDC {
+	t.Helper()
+
+	h := newOAuthTestHeadscale(t)
+
+	return &AuthProviderOIDC{
+		cfg:       &cfg,
+		db:        h.db,
+		nodeStore: h.nodeStore,
+		notifier:  h.nodeNotifier,
+		polMan:    h.polMan,
+	}
+}
+
+func TestCreateOrUpdateUserFromClaimLinksByEmail(t *testing.T) {
+	claims := &types.OIDCClaims{
+		Sub:           "alice",
+		Iss:           "https://idp.example.com",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Username:      "alice",
+	}
+
+	tests := []struct {
+		name          string
+		linkByEmail   bool
+		emailVerified bool
+		wantLinked    bool
+	}{
+		{name: "linked", linkByEmail: true, emailVerified: true, wantLinked: true},
+		{name: "disabled", linkByEmail: false, emailVerified: true},
+		{name: "email-not-verified", linkByEmail: true, emailVerified: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuthProviderOIDC(t, types.OIDCConfig{LinkUsersByEmail: tt.linkByEmail})
+
+			local, err := a.db.CreateUser(types.User{Name: "alice", Email: "alice@example.com"})
+			require.NoError(t, err)
+
+			claims := *claims
+			claims.EmailVerified = types.FlexibleBoolean(tt.emailVerified)
+
+			user, err := a.createOrUpdateUserFromClaim(&claims)
+			require.NoError(t, err)
+			assert.Equal(t, util.RegisterMethodOIDC, user.Provider)
+
+			links, err := a.db.ListUserLinks(0)
+			require.NoError(t, err)
+
+			if !tt.wantLinked {
+				assert.NotEqual(t, local.ID, user.ID)
+				assert.Empty(t, links)
+
+				return
+			}
+
+			assert.Equal(t, local.ID, user.ID)
+			require.Len(t, links, 1)
+			assert.Equal(t, types.UserLinkOIDCEmail, links[0].Kind)
+			assert.Equal(t, local.ID, links[0].UserID)
+			assert.Equal(t, user.ProviderIdentifier.String, links[0].Source)
+
+			// The next login finds the user by its identifier, and is not
+			// linked again.
+			again, err := a.createOrUpdateUserFromClaim(&claims)
+			require.NoError(t, err)
+			assert.Equal(t, local.ID, again.ID)
+
+			links, err = a.db.ListUserLinks(0)
+			require.NoError(t, err)
+			assert.Len(t, links, 1)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package policy
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/deephash"
+)
+
+// nodeView is a summary of what a node can see of the tailnet
+// through the policy.
+type nodeView struct {
+	// self is the hash of the reduced packet filter and the
+	// SSH policy of the node.
+	self deephash.Sum
+
+	// peers contains a hash of the policy dependent state of every
+	// peer visible to the node, the routes the node is allowed to
+	// use and the tags of the peer.
+	peers map[types.NodeID]deephash.Sum
+}
+
+// ViewTracker keeps track of the view each node has of the tailnet so
+// a change to the policy, users or nodes can be narrowed down to the
+// nodes whose packet filter, SSH policy or peers actually changed,
+// instead of sending a full update to every node.
+type ViewTracker struct {
+	mu    sync.Mutex
+	views map[types.NodeID]nodeView
+}
+
+func NewViewTracker() *ViewTracker {
+	return &ViewTracker{
+		views: make(map[types.NodeID]nodeView),
+	}
+}
+
+// Update computes the current view of each of the viewers and returns
+// how it changed since the last update. Viewers that have not been seen
+// before are reported as needing a full update, as it is not known what
+// they have been sent. Only viewers that changed are returned.
+func (t *ViewTracker) Update(
+	pm PolicyManager,
+	nodes types.Nodes,
+	viewers []types.NodeID,
+) (map[types.NodeID]types.NodeViewChange, error) {
+	views, err := computeViews(pm, nodes, viewers)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changes := make(map[types.NodeID]types.NodeViewChange)
+	for id, view := range views {
+		prev, ok := t.views[id]
+		t.views[id] = view
+
+		if !ok {
+			changes[id] = types.NodeViewChange{Full: true}
+			continue
+		}
+
+		change := diffViews(prev, view)
+		if !change.Empty() {
+			changes[id] = change
+		}
+	}
+
+	return changes, nil
+}
+
+// Seed records the current view of the node, it is used when the node
+// connects and is sent a full map response, so the next change only
+// sends it what changed.
+func (t *ViewTracker) Seed(
+	pm PolicyManager,
+	nodes types.Nodes,
+	nodeID types.NodeID,
+) error {
+	views, err := computeViews(pm, nodes, []types.NodeID{nodeID})
+	if err != nil {
+		t.Forget(nodeID)
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if view, ok := views[nodeID]; ok {
+		t.views[nodeID] = view
+	} else {
+		delete(t.views, nodeID)
+	}
+
+	return nil
+}
+
+// computeViews computes the current view of each of the viewers.
+func computeViews(
+	pm PolicyManager,
+	nodes types.Nodes,
+	viewers []types.NodeID,
+) (map[types.NodeID]nodeView, error) {
+	filter, matchers := pm.Filter()
+
+	byID := make(map[types.NodeID]*types.Node, len(nodes))
+	peerTags := make(map[types.NodeID][]string, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+
+		tags := slices.Clone(node.ForcedTags)
+		for _, tag := range node.RequestTags() {
+			if pm.NodeCanHaveTag(node, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		slices.Sort(tags)
+		peerTags[node.ID] = slices.Compact(tags)
+	}
+
+	views := make(map[types.NodeID]nodeView, len(viewers))
+	for _, id := range viewers {
+		node, ok := byID[id]
+		if !ok {
+			continue
+		}
+
+		sshPol, err := pm.SSHPolicy(node)
+		if err != nil {
+			return nil, fmt.Errorf("compiling SSH policy for node %d: %w", id, err)
+		}
+
+		self := struct {
+			Filter []tailcfg.FilterRule
+			SSH    *tailcfg.SSHPolicy
+		}{
+			Filter: ReduceFilterRules(node, filter),
+			SSH:    sshPol,
+		}
+
+		peers := nodes
+		if len(filter) > 0 {
+			peers = ReduceNodes(node, nodes, matchers)
+		}
+
+		view := nodeView{
+			self:  deephash.Hash(&self),
+			peers: make(map[types.NodeID]deephash.Sum, len(peers)),
+		}
+		for _, peer := range peers {
+			if peer.ID == node.ID {
+				continue
+			}
+
+			peerState := struct {
+				Routes []netip.Prefix
+				Tags   []string
+			}{
+				Routes: ReduceRoutes(node, peer.SubnetRoutes(), matchers),
+				Tags:   peerTags[peer.ID],
+			}
+			view.peers[peer.ID] = deephash.Hash(&peerState)
+		}
+
+		views[id] = view
+	}
+
+	return views, nil
+}
+
+// Forget removes the view of the node, it is used when the node
+// disconnects and will receive a full update when it reconnects.
+func (t *ViewTracker) Forget(nodeID types.NodeID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.views, nodeID)
+}
+
+func diffViews(prev, curr nodeView) types.NodeViewChange {
+	change := types.NodeViewChange{
+		Self: prev.self != curr.self,
+	}
+
+	for id, sum := range curr.peers {
+		if prevSum, ok := prev.peers[id]; !ok || prevSum != sum {
+			change.PeersChanged = append(change.PeersChanged, id)
+		}
+	}
+
+	for id := range prev.peers {
+		if _, ok := curr.peers[id]; !ok {
+			change.PeersRemoved = append(change.PeersRemoved, id)
+		}
+	}
+
+	slices.Sort(change.PeersChanged)
+	slices.Sort(change.PeersRemoved)
+
+	return change
+}
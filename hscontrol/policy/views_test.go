@@ -0,0 +1,175 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+)
+
+func TestViewTracker(t *testing.T) {
+	users := []types.User{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], Hostinfo: &tailcfg.Hostinfo{}},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[0], Hostinfo: &tailcfg.Hostinfo{}},
+		{ID: 3, IPv4: ap("100.64.0.3"), User: users[0], Hostinfo: &tailcfg.Hostinfo{}},
+	}
+
+	allow1to2 := `{
+		"acls": [
+			{"action": "accept", "src": ["100.64.0.1"], "dst": ["100.64.0.2:*"]}
+		]
+	}`
+
+	allow1to3 := `{
+		"acls": [
+			{"action": "accept", "src": ["100.64.0.1"], "dst": ["100.64.0.3:*"]}
+		]
+	}`
+
+	allow1to2and3 := `{
+		"acls": [
+			{"action": "accept", "src": ["100.64.0.1"], "dst": ["100.64.0.2:*"]},
+			{"action": "accept", "src": ["100.64.0.1"], "dst": ["100.64.0.3:*"]}
+		]
+	}`
+
+	for idx, pmf := range PolicyManagerFuncsForTest([]byte(allow1to2)) {
+		pm, err := pmf(users, nodes)
+		require.NoError(t, err, "policy manager %d", idx)
+
+		tracker := NewViewTracker()
+		viewers := []types.NodeID{1, 2, 3}
+
+		// Nodes without a previous view needs a full update.
+		got, err := tracker.Update(pm, nodes, viewers)
+		require.NoError(t, err)
+		want := map[types.NodeID]types.NodeViewChange{
+			1: {Full: true},
+			2: {Full: true},
+			3: {Full: true},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("initial update unexpected result (-want +got):\n%s", diff)
+		}
+
+		// Nothing changed, nothing should be sent.
+		got, err = tracker.Update(pm, nodes, viewers)
+		require.NoError(t, err)
+		if diff := cmp.Diff(map[types.NodeID]types.NodeViewChange{}, got); diff != "" {
+			t.Errorf("unchanged update unexpected result (-want +got):\n%s", diff)
+		}
+
+		// Moving access from 2 to 3 should only affect the nodes involved.
+		_, err = pm.SetPolicy([]byte(allow1to3))
+		require.NoError(t, err)
+
+		got, err = tracker.Update(pm, nodes, viewers)
+		require.NoError(t, err)
+		want = map[types.NodeID]types.NodeViewChange{
+			1: {PeersChanged: []types.NodeID{3}, PeersRemoved: []types.NodeID{2}},
+			2: {Self: true, PeersRemoved: []types.NodeID{1}},
+			3: {Self: true, PeersChanged: []types.NodeID{1}},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("policy change unexpected result (-want +got):\n%s", diff)
+		}
+
+		// Adding access to 2 does not change anything for 3.
+		_, err = pm.SetPolicy([]byte(allow1to2and3))
+		require.NoError(t, err)
+
+		got, err = tracker.Update(pm, nodes, viewers)
+		require.NoError(t, err)
+		want = map[types.NodeID]types.NodeViewChange{
+			1: {PeersChanged: []types.NodeID{2}},
+			2: {Self: true, PeersChanged: []types.NodeID{1}},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("policy addition unexpected result (-want +got):\n%s", diff)
+		}
+
+		// A forgotten node gets a full update.
+		tracker.Forget(3)
+		got, err = tracker.Update(pm, nodes, viewers)
+		require.NoError(t, err)
+		want = map[types.NodeID]types.NodeViewChange{
+			3: {Full: true},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("forgotten node unexpected result (-want +got):\n%s", diff)
+		}
+
+		// A node seeded when it connects only gets what changed.
+		tracker.Forget(3)
+		require.NoError(t, tracker.Seed(pm, nodes, 3))
+
+		_, err = pm.SetPolicy([]byte(allow1to2))
+		require.NoError(t, err)
+
+		got, err = tracker.Update(pm, nodes, viewers)
+		require.NoError(t, err)
+		want = map[types.NodeID]types.NodeViewChange{
+			1: {PeersRemoved: []types.NodeID{3}},
+			3: {Self: true, PeersRemoved: []types.NodeID{1}},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("seeded node unexpected result (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestNodeViewChangeStateUpdates(t *testing.T) {
+	tests := []struct {
+		name   string
+		change types.NodeViewChange
+		want   []types.StateUpdate
+	}{
+		{
+			name:   "full",
+			change: types.NodeViewChange{Full: true, Self: true},
+			want:   []types.StateUpdate{types.UpdateFull()},
+		},
+		{
+			name:   "self",
+			change: types.NodeViewChange{Self: true},
+			want:   []types.StateUpdate{types.UpdateSelf(1)},
+		},
+		{
+			name:   "removed-covers-self",
+			change: types.NodeViewChange{Self: true, PeersRemoved: []types.NodeID{2}},
+			want:   []types.StateUpdate{types.UpdatePeerRemoved(2)},
+		},
+		{
+			name: "changed-and-removed",
+			change: types.NodeViewChange{
+				PeersChanged: []types.NodeID{3},
+				PeersRemoved: []types.NodeID{2},
+			},
+			want: []types.StateUpdate{
+				types.UpdatePeerRemoved(2),
+				types.UpdatePeerChanged(3),
+			},
+		},
+		{
+			name:   "empty",
+			change: types.NodeViewChange{},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.change.StateUpdates(1)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("StateUpdates() unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -9,10 +9,11 @@ import (
 	"slices"
 	"time"
 
+	"github.com/juanfont/headscale/hscontrol/db"
 	"github.com/juanfont/headscale/hscontrol/mapper"
-	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/types"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 	"github.com/sasha-s/go-deadlock"
 	xslices "golang.org/x/exp/slices"
 	"tailscale.com/net/tsaddr"
@@ -58,7 +59,7 @@ func (h *Headscale) newMapSession(
 	w http.ResponseWriter,
 	node *types.Node,
 ) *mapSession {
-	warnf, infof, tracef, errf := logPollFunc(req, node)
+	warnf, infof, tracef, errf := logPollFunc(h.logger, req, node)
 
 	var updateChan chan types.StateUpdate
 	if req.Stream {
@@ -100,17 +101,17 @@ func (m *mapSession) close() {
 	defer m.cancelChMu.Unlock()
 
 	if !m.cancelChOpen {
-		mapResponseClosed.WithLabelValues("chanclosed").Inc()
+		m.h.metrics.mapResponseClosed.WithLabelValues("chanclosed").Inc()
 		return
 	}
 
 	m.tracef("mapSession (%p) sending message on cancel chan", m)
 	select {
 	case m.cancelCh <- struct{}{}:
-		mapResponseClosed.WithLabelValues("sent").Inc()
+		m.h.metrics.mapResponseClosed.WithLabelValues("sent").Inc()
 		m.tracef("mapSession (%p) sent message on cancel chan", m)
 	case <-time.After(30 * time.Second):
-		mapResponseClosed.WithLabelValues("timeout").Inc()
+		m.h.metrics.mapResponseClosed.WithLabelValues("timeout").Inc()
 		m.tracef("mapSession (%p) timed out sending close message", m)
 	}
 }
@@ -200,17 +201,22 @@ func (m *mapSession) serveLongPoll() {
 		// in principal, it will be removed, but the client rapidly
 		// reconnects, the channel might be of another connection.
 		// In that case, it is not closed and the node is still online.
-		if m.h.nodeNotifier.RemoveNode(m.node.ID, m.ch) {
+		// In a cluster, the node might have reconnected to another instance
+		// already, it is then still online.
+		removed := m.h.nodeNotifier.RemoveNode(m.node.ID, m.ch)
+		if removed {
+			m.mapper.NodeDisconnected(m.node.ID)
+		}
+
+		if removed && (m.h.cluster == nil || !m.h.cluster.nodeDisconnected(m.node.ID)) {
 			// Failover the node's routes if any.
 			m.h.updateNodeOnlineStatus(false, m.node)
 
 			// When a node disconnects, and it causes the primary route map to change,
-			// send a full update to all nodes.
-			// TODO(kradalby): This can likely be made more effective, but likely most
-			// nodes has access to the same routes, so it might not be a big deal.
-			if m.h.primaryRoutes.SetRoutes(m.node.ID) {
+			// send the nodes that gained or lost a primary route to all nodes.
+			if affected := m.h.primaryRoutes.SetRoutesAffected(m.node.ID); len(affected) > 0 {
 				ctx := types.NotifyCtx(context.Background(), "poll-primary-change", m.node.Hostname)
-				m.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+				m.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(affected...))
 			}
 		}
 
@@ -222,9 +228,9 @@ func (m *mapSession) serveLongPoll() {
 	m.h.pollNetMapStreamWG.Add(1)
 	defer m.h.pollNetMapStreamWG.Done()
 
-	if m.h.primaryRoutes.SetRoutes(m.node.ID, m.node.SubnetRoutes()...) {
+	if affected := m.h.primaryRoutes.SetRoutesAffected(m.node.ID, m.node.SubnetRoutes()...); len(affected) > 0 {
 		ctx := types.NotifyCtx(context.Background(), "poll-primary-change", m.node.Hostname)
-		m.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+		m.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(affected...))
 	}
 
 	// Upgrade the writer to a ResponseController
@@ -240,6 +246,10 @@ func (m *mapSession) serveLongPoll() {
 	m.keepAliveTicker = time.NewTicker(m.keepAlive)
 
 	m.h.nodeNotifier.AddNode(m.node.ID, m.ch)
+	m.h.nodeNotifier.SeedView(m.h.polMan, m.h.nodeStore.ListNodes(), m.node.ID)
+	if m.h.cluster != nil {
+		m.h.cluster.nodeConnected(m.node.ID)
+	}
 	go m.h.updateNodeOnlineStatus(true, m.node)
 
 	m.infof("node has connected, mapSession: %p, chan: %p", m, m.ch)
@@ -251,12 +261,12 @@ func (m *mapSession) serveLongPoll() {
 		select {
 		case <-m.cancelCh:
 			m.tracef("poll cancelled received")
-			mapResponseEnded.WithLabelValues("cancelled").Inc()
+			m.h.metrics.mapResponseEnded.WithLabelValues("cancelled").Inc()
 			return
 
 		case <-ctx.Done():
 			m.tracef("poll context done")
-			mapResponseEnded.WithLabelValues("done").Inc()
+			m.h.metrics.mapResponseEnded.WithLabelValues("done").Inc()
 			return
 
 		// Consume updates sent to node
@@ -273,7 +283,7 @@ func (m *mapSession) serveLongPoll() {
 			}
 
 			m.tracef("received stream update: %s %s", update.Type.String(), update.Message)
-			mapResponseUpdateReceived.WithLabelValues(update.Type.String()).Inc()
+			m.h.metrics.mapResponseUpdateReceived.WithLabelValues(update.Type.String()).Inc()
 
 			var data []byte
 			var err error
@@ -282,12 +292,13 @@ func (m *mapSession) serveLongPoll() {
 			// Ensure the node object is updated, for example, there
 			// might have been a hostinfo update in a sidechannel
 			// which contains data needed to generate a map response.
-			m.node, err = m.h.db.GetNodeByID(m.node.ID)
-			if err != nil {
-				m.errf(err, "Could not get machine from db")
+			node, ok := m.h.nodeStore.GetNode(m.node.ID)
+			if !ok {
+				m.errf(db.ErrNodeNotFound, "Could not get machine from node store")
 
 				return
 			}
+			m.node = node
 
 			updateType := "full"
 			switch update.Type {
@@ -342,24 +353,24 @@ func (m *mapSession) serveLongPoll() {
 				startWrite := time.Now()
 				_, err = m.w.Write(data)
 				if err != nil {
-					mapResponseSent.WithLabelValues("error", updateType).Inc()
+					m.h.metrics.mapResponseSent.WithLabelValues("error", updateType).Inc()
 					m.errf(err, "could not write the map response(%s), for mapSession: %p", update.Type.String(), m)
 					return
 				}
 
 				err = rc.Flush()
 				if err != nil {
-					mapResponseSent.WithLabelValues("error", updateType).Inc()
+					m.h.metrics.mapResponseSent.WithLabelValues("error", updateType).Inc()
 					m.errf(err, "flushing the map response to client, for mapSession: %p", m)
 					return
 				}
 
-				log.Trace().Str("node", m.node.Hostname).TimeDiff("timeSpent", time.Now(), startWrite).Str("mkey", m.node.MachineKey.String()).Msg("finished writing mapresp to node")
+				m.h.logger.Trace().Str("node", m.node.Hostname).TimeDiff("timeSpent", time.Now(), startWrite).Str("mkey", m.node.MachineKey.String()).Msg("finished writing mapresp to node")
 
 				if debugHighCardinalityMetrics {
-					mapResponseLastSentSeconds.WithLabelValues(updateType, m.node.ID.String()).Set(float64(time.Now().Unix()))
+					m.h.metrics.mapResponseLastSentSeconds.WithLabelValues(updateType, m.node.ID.String()).Set(float64(time.Now().Unix()))
 				}
-				mapResponseSent.WithLabelValues("ok", updateType).Inc()
+				m.h.metrics.mapResponseSent.WithLabelValues("ok", updateType).Inc()
 				m.tracef("update sent")
 				m.resetKeepAlive()
 			}
@@ -368,26 +379,26 @@ func (m *mapSession) serveLongPoll() {
 			data, err := m.mapper.KeepAliveResponse(m.req, m.node)
 			if err != nil {
 				m.errf(err, "Error generating the keep alive msg")
-				mapResponseSent.WithLabelValues("error", "keepalive").Inc()
+				m.h.metrics.mapResponseSent.WithLabelValues("error", "keepalive").Inc()
 				return
 			}
 			_, err = m.w.Write(data)
 			if err != nil {
 				m.errf(err, "Cannot write keep alive message")
-				mapResponseSent.WithLabelValues("error", "keepalive").Inc()
+				m.h.metrics.mapResponseSent.WithLabelValues("error", "keepalive").Inc()
 				return
 			}
 			err = rc.Flush()
 			if err != nil {
 				m.errf(err, "flushing keep alive to client, for mapSession: %p", m)
-				mapResponseSent.WithLabelValues("error", "keepalive").Inc()
+				m.h.metrics.mapResponseSent.WithLabelValues("error", "keepalive").Inc()
 				return
 			}
 
 			if debugHighCardinalityMetrics {
-				mapResponseLastSentSeconds.WithLabelValues("keepalive", m.node.ID.String()).Set(float64(time.Now().Unix()))
+				m.h.metrics.mapResponseLastSentSeconds.WithLabelValues("keepalive", m.node.ID.String()).Set(float64(time.Now().Unix()))
 			}
-			mapResponseSent.WithLabelValues("ok", "keepalive").Inc()
+			m.h.metrics.mapResponseSent.WithLabelValues("ok", "keepalive").Inc()
 		}
 	}
 }
@@ -410,16 +421,25 @@ func (h *Headscale) updateNodeOnlineStatus(online bool, node *types.Node) {
 	}
 
 	if node.LastSeen != nil {
-		h.db.SetLastSeen(node.ID, *node.LastSeen)
+		lastSeen := *node.LastSeen
+		h.nodeStore.UpdateNode(node.ID, func(n *types.Node) {
+			n.LastSeen = &lastSeen
+		})
 	}
 
 	ctx := types.NotifyCtx(context.Background(), "poll-nodeupdate-onlinestatus", node.Hostname)
 	h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerPatch(change), node.ID)
+
+	h.hooks.nodeOnlineChanged(node, online)
 }
 
 func (m *mapSession) handleEndpointUpdate() {
 	m.tracef("received endpoint update")
 
+	hostname, givenName := m.node.Hostname, m.node.GivenName
+	nodeKey, discoKey := m.node.NodeKey, m.node.DiscoKey
+	approvedRoutes := slices.Clone(m.node.ApprovedRoutes)
+
 	change := m.node.PeerChangeFromMapRequest(m.req)
 
 	online := m.h.nodeNotifier.IsLikelyConnected(m.node.ID)
@@ -441,15 +461,40 @@ func (m *mapSession) handleEndpointUpdate() {
 	}
 	m.node.Hostinfo = m.req.Hostinfo
 
-	logTracePeerChange(m.node.Hostname, sendUpdate, &change)
+	logTracePeerChange(m.h.logger, m.node.Hostname, sendUpdate, &change)
 
 	// If there is no changes and nothing to save,
 	// return early.
 	if peerChangeEmpty(change) && !sendUpdate {
-		mapResponseEndpointUpdates.WithLabelValues("noop").Inc()
+		m.h.metrics.mapResponseEndpointUpdates.WithLabelValues("noop").Inc()
 		return
 	}
 
+	// The keys are written to the database immediately, a batch written
+	// later must not undo a re-registration with another key.
+	if m.node.NodeKey != nodeKey || m.node.DiscoKey != discoKey {
+		if err := m.h.db.DB.Model(m.node).
+			Select("node_key", "disco_key").
+			Updates(m.node).Error; err != nil {
+			m.errf(err, "Failed to persist/update node keys in the database")
+			http.Error(m.w, "", http.StatusInternalServerError)
+			m.h.metrics.mapResponseEndpointUpdates.WithLabelValues("error").Inc()
+
+			return
+		}
+	}
+
+	// The node store persists the endpoints, hostinfo and last seen to
+	// the database in batches. It is updated before the routes are
+	// evaluated as the hooks read the nodes from the store.
+	m.h.nodeStore.UpdateNode(m.node.ID, func(node *types.Node) {
+		node.NodeKey = m.node.NodeKey
+		node.DiscoKey = m.node.DiscoKey
+		node.Endpoints = slices.Clone(m.node.Endpoints)
+		node.Hostinfo = m.node.Hostinfo.Clone()
+		node.LastSeen = m.node.LastSeen
+	})
+
 	// Check if the Hostinfo of the node has changed.
 	// If it has changed, check if there has been a change to
 	// the routable IPs of the host and update them in
@@ -460,19 +505,21 @@ func (m *mapSession) handleEndpointUpdate() {
 	// hostinfo and let the function continue.
 	if routesChanged {
 		// TODO(kradalby): I am not sure if we need this?
-		nodesChangedHook(m.h.db, m.h.polMan, m.h.nodeNotifier)
+		nodesChangedHook(m.h.nodeStore, m.h.polMan, m.h.nodeNotifier)
 
 		// Approve any route that has been defined in policy as
-		// auto approved. Any change here is not important as any
-		// actual state change will be detected when the route manager
-		// is updated.
-		policy.AutoApproveRoutes(m.h.polMan, m.node)
+		// auto approved, within the route quota of the user. Any change
+		// here is not important as any actual state change will be
+		// detected when the route manager is updated.
+		if _, err := autoApproveRoutes(m.h.db.DB, m.h.polMan, m.node, m.h.db.DefaultQuota()); err != nil {
+			m.errf(err, "Failed to auto approve routes")
+		}
 
 		// Update the routes of the given node in the route manager to
 		// see if an update needs to be sent.
-		if m.h.primaryRoutes.SetRoutes(m.node.ID, m.node.SubnetRoutes()...) {
+		if affected := m.h.primaryRoutes.SetRoutesAffected(m.node.ID, m.node.SubnetRoutes()...); len(affected) > 0 {
 			ctx := types.NotifyCtx(m.ctx, "poll-primary-change", m.node.Hostname)
-			m.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+			m.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(lo.Uniq(append(affected, m.node.ID))...))
 		} else {
 			ctx := types.NotifyCtx(m.ctx, "cli-approveroutes", m.node.Hostname)
 			m.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(m.node.ID), m.node.ID)
@@ -495,12 +542,26 @@ func (m *mapSession) handleEndpointUpdate() {
 	// the hostname change.
 	m.node.ApplyHostnameFromHostInfo(m.req.Hostinfo)
 
-	if err := m.h.db.DB.Save(m.node).Error; err != nil {
-		m.errf(err, "Failed to persist/update node in the database")
-		http.Error(m.w, "", http.StatusInternalServerError)
-		mapResponseEndpointUpdates.WithLabelValues("error").Inc()
+	// Changes to the name or the approved routes are not batched
+	// and are written to the database immediately.
+	if m.node.Hostname != hostname ||
+		m.node.GivenName != givenName ||
+		!slices.Equal(m.node.ApprovedRoutes, approvedRoutes) {
+		if err := m.h.db.DB.Model(m.node).
+			Select("hostname", "given_name", "approved_routes").
+			Updates(m.node).Error; err != nil {
+			m.errf(err, "Failed to persist/update node in the database")
+			http.Error(m.w, "", http.StatusInternalServerError)
+			m.h.metrics.mapResponseEndpointUpdates.WithLabelValues("error").Inc()
 
-		return
+			return
+		}
+
+		m.h.nodeStore.UpdateNode(m.node.ID, func(node *types.Node) {
+			node.Hostname = m.node.Hostname
+			node.GivenName = m.node.GivenName
+			node.ApprovedRoutes = slices.Clone(m.node.ApprovedRoutes)
+		})
 	}
 
 	ctx := types.NotifyCtx(context.Background(), "poll-nodeupdate-peers-patch", m.node.Hostname)
@@ -511,7 +572,7 @@ func (m *mapSession) handleEndpointUpdate() {
 	)
 
 	m.w.WriteHeader(http.StatusOK)
-	mapResponseEndpointUpdates.WithLabelValues("ok").Inc()
+	m.h.metrics.mapResponseEndpointUpdates.WithLabelValues("ok").Inc()
 }
 
 func (m *mapSession) handleReadOnlyRequest() {
@@ -521,7 +582,7 @@ func (m *mapSession) handleReadOnlyRequest() {
 	if err != nil {
 		m.errf(err, "Failed to create MapResponse")
 		http.Error(m.w, "", http.StatusInternalServerError)
-		mapResponseReadOnly.WithLabelValues("error").Inc()
+		m.h.metrics.mapResponseReadOnly.WithLabelValues("error").Inc()
 		return
 	}
 
@@ -530,16 +591,16 @@ func (m *mapSession) handleReadOnlyRequest() {
 	_, err = m.w.Write(mapResp)
 	if err != nil {
 		m.errf(err, "Failed to write response")
-		mapResponseReadOnly.WithLabelValues("error").Inc()
+		m.h.metrics.mapResponseReadOnly.WithLabelValues("error").Inc()
 		return
 	}
 
 	m.w.WriteHeader(http.StatusOK)
-	mapResponseReadOnly.WithLabelValues("ok").Inc()
+	m.h.metrics.mapResponseReadOnly.WithLabelValues("ok").Inc()
 }
 
-func logTracePeerChange(hostname string, hostinfoChange bool, change *tailcfg.PeerChange) {
-	trace := log.Trace().Uint64("node.id", uint64(change.NodeID)).Str("hostname", hostname)
+func logTracePeerChange(logger zerolog.Logger, hostname string, hostinfoChange bool, change *tailcfg.PeerChange) {
+	trace := logger.Trace().Uint64("node.id", uint64(change.NodeID)).Str("hostname", hostname)
 
 	if change.Key != nil {
 		trace = trace.Str("node_key", change.Key.ShortString())
@@ -584,11 +645,12 @@ func peerChangeEmpty(chng tailcfg.PeerChange) bool {
 }
 
 func logPollFunc(
+	logger zerolog.Logger,
 	mapRequest tailcfg.MapRequest,
 	node *types.Node,
 ) (func(string, ...any), func(string, ...any), func(string, ...any), func(error, string, ...any)) {
 	return func(msg string, a ...any) {
-			log.Warn().
+			logger.Warn().
 				Caller().
 				Bool("readOnly", mapRequest.ReadOnly).
 				Bool("omitPeers", mapRequest.OmitPeers).
@@ -598,7 +660,7 @@ func logPollFunc(
 				Msgf(msg, a...)
 		},
 		func(msg string, a ...any) {
-			log.Info().
+			logger.Info().
 				Caller().
 				Bool("readOnly", mapRequest.ReadOnly).
 				Bool("omitPeers", mapRequest.OmitPeers).
@@ -608,7 +670,7 @@ func logPollFunc(
 				Msgf(msg, a...)
 		},
 		func(msg string, a ...any) {
-			log.Trace().
+			logger.Trace().
 				Caller().
 				Bool("readOnly", mapRequest.ReadOnly).
 				Bool("omitPeers", mapRequest.OmitPeers).
@@ -618,7 +680,7 @@ func logPollFunc(
 				Msgf(msg, a...)
 		},
 		func(err error, msg string, a ...any) {
-			log.Error().
+			logger.Error().
 				Caller().
 				Bool("readOnly", mapRequest.ReadOnly).
 				Bool("omitPeers", mapRequest.OmitPeers).
@@ -0,0 +1,453 @@
+package hscontrol
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/templates"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/prometheus/common/model"
+	"tailscale.com/types/ptr"
+)
+
+const (
+	adminRegistrationsPath = "/admin/registrations"
+	adminLoginPath         = "/admin/login"
+
+	adminSessionCookie = "headscale_admin"
+	// adminSessionPrefix starts every admin session, which is signed with
+	// the key of the OAuth access tokens, so neither can pass for the other.
+	adminSessionPrefix     = "hsas_"
+	adminSessionExpiration = 12 * time.Hour
+)
+
+var (
+	errAdminSessionInvalid  = errors.New("invalid admin session")
+	errRegistrationNotFound = errors.New("registration not found")
+)
+
+type adminSession struct {
+	ID      uint64 `json:"sid"`
+	Subject string `json:"sub"`
+	Expiry  int64  `json:"exp"`
+}
+
+// startAdminSession logs the admin in with a signed session cookie, and
+// redirects to the pending registrations. apiKeyID is the API key the
+// admin logged in with, the session ends with it.
+func (h *Headscale) startAdminSession(
+	writer http.ResponseWriter,
+	req *http.Request,
+	subject string,
+	apiKeyID *uint64,
+) {
+	expiry := time.Now().Add(adminSessionExpiration)
+
+	session, err := h.db.CreateAdminSession(subject, apiKeyID, expiry)
+	if err != nil {
+		httpError(writer, err)
+		return
+	}
+
+	content, err := json.Marshal(adminSession{
+		ID:      session.ID,
+		Subject: subject,
+		Expiry:  expiry.Unix(),
+	})
+	if err != nil {
+		httpError(writer, fmt.Errorf("encoding admin session: %w", err))
+		return
+	}
+
+	payload := adminSessionPrefix + base64.RawURLEncoding.EncodeToString(content)
+	signature := base64.RawURLEncoding.EncodeToString(h.signOAuthAccessToken(payload))
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     adminSessionCookie,
+		Value:    payload + "." + signature,
+		Path:     "/admin",
+		MaxAge:   int(adminSessionExpiration.Seconds()),
+		Secure:   req.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	h.logger.Info().Str("admin", subject).Msg("admin logged in to approve registrations")
+
+	http.Redirect(writer, req, adminRegistrationsPath, http.StatusSeeOther)
+}
+
+// validateAdminSession checks the signature and expiry of a session cookie,
+// and that the session has not been ended, e.g. by logging out or removing
+// its API key.
+func (h *Headscale) validateAdminSession(cookie string) (*adminSession, error) {
+	payload, signature, found := strings.Cut(cookie, ".")
+	if !found || !strings.HasPrefix(payload, adminSessionPrefix) {
+		return nil, errAdminSessionInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, h.signOAuthAccessToken(payload)) {
+		return nil, errAdminSessionInvalid
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(payload, adminSessionPrefix))
+	if err != nil {
+		return nil, errAdminSessionInvalid
+	}
+
+	var session adminSession
+	if err := json.Unmarshal(content, &session); err != nil {
+		return nil, errAdminSessionInvalid
+	}
+
+	if time.Now().After(time.Unix(session.Expiry, 0)) {
+		return nil, errAdminSessionInvalid
+	}
+
+	if _, err := h.db.GetAdminSession(session.ID); err != nil {
+		if errors.Is(err, db.ErrAdminSessionInvalid) {
+			return nil, errAdminSessionInvalid
+		}
+
+		return nil, fmt.Errorf("looking up admin session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// adminCSRFToken returns the token the forms of a session must post back,
+// derived from the session cookie.
+func (h *Headscale) adminCSRFToken(cookie string) string {
+	return base64.RawURLEncoding.EncodeToString(h.signOAuthAccessToken("csrf:" + cookie))
+}
+
+// requireAdmin returns the admin making the request, logged in with a
+// session cookie or giving an API key as bearer token. Forms posted with a
+// session cookie must carry its CSRF token. Otherwise the response is
+// written, and false returned.
+func (h *Headscale) requireAdmin(writer http.ResponseWriter, req *http.Request) (string, bool) {
+	if authHeader := req.Header.Get("Authorization"); strings.HasPrefix(authHeader, AuthPrefix) {
+		valid, err := h.db.ValidateAPIKey(strings.TrimPrefix(authHeader, AuthPrefix))
+		if !valid {
+			httpError(writer, NewHTTPError(http.StatusUnauthorized, "Unauthorized", err))
+			return "", false
+		}
+
+		return "api key", true
+	}
+
+	cookie, err := req.Cookie(adminSessionCookie)
+	if err == nil {
+		var session *adminSession
+		session, err = h.validateAdminSession(cookie.Value)
+		if err == nil {
+			if req.Method == http.MethodPost &&
+				!hmac.Equal([]byte(req.PostFormValue("csrf")), []byte(h.adminCSRFToken(cookie.Value))) {
+				httpError(writer, NewHTTPError(http.StatusForbidden, "invalid form, reload the page", nil))
+				return "", false
+			}
+
+			return session.Subject, true
+		}
+	}
+
+	if req.Method == http.MethodGet {
+		http.Redirect(writer, req, adminLoginPath, http.StatusSeeOther)
+		return "", false
+	}
+
+	httpError(writer, NewHTTPError(http.StatusUnauthorized, "Unauthorized", err))
+
+	return "", false
+}
+
+// AdminLoginHandler shows the login page of the admins approving
+// registrations, and logs them in with an API key.
+// Listens in /admin/login.
+func (h *Headscale) AdminLoginHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	_, oidcLogin := h.authProvider.(*AuthProviderOIDC)
+	oidcLogin = oidcLogin && len(h.cfg.RegistrationApproval.OIDCAdminValues) > 0
+
+	if req.Method == http.MethodPost {
+		apiKey := req.PostFormValue("api_key")
+		valid, err := h.db.ValidateAPIKey(apiKey)
+		if valid {
+			prefix, _, _ := strings.Cut(apiKey, ".")
+			key, err := h.db.GetAPIKey(prefix)
+			if err != nil {
+				httpError(writer, err)
+				return
+			}
+
+			h.startAdminSession(writer, req, "api key", &key.ID)
+
+			return
+		}
+
+		h.logger.Warn().Err(err).Str("client_address", req.RemoteAddr).Msg("admin login with invalid API key")
+		writeHTML(writer, http.StatusUnauthorized, templates.AdminLogin(oidcLogin, "Invalid API key.").Render())
+
+		return
+	}
+
+	writeHTML(writer, http.StatusOK, templates.AdminLogin(oidcLogin, "").Render())
+}
+
+// AdminLogoutHandler ends the session of an admin.
+// Listens in /admin/logout.
+func (h *Headscale) AdminLogoutHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	if _, ok := h.requireAdmin(writer, req); !ok {
+		return
+	}
+
+	if cookie, err := req.Cookie(adminSessionCookie); err == nil {
+		if session, err := h.validateAdminSession(cookie.Value); err == nil {
+			if err := h.db.DestroyAdminSession(session.ID); err != nil {
+				httpError(writer, err)
+				return
+			}
+		}
+	}
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     adminSessionCookie,
+		Path:     "/admin",
+		MaxAge:   -1,
+		Secure:   req.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	http.Redirect(writer, req, adminLoginPath, http.StatusSeeOther)
+}
+
+// PendingRegistrationsHandler lists the nodes waiting for an interactive
+// login, for an admin to approve or reject them.
+// Listens in /admin/registrations.
+func (h *Headscale) PendingRegistrationsHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	if _, ok := h.requireAdmin(writer, req); !ok {
+		return
+	}
+
+	regs, err := h.db.ListPendingRegistrations()
+	if err != nil {
+		httpError(writer, err)
+		return
+	}
+
+	var pending []templates.PendingRegistration
+	for _, reg := range regs {
+		node := reg.Node
+
+		var os string
+		if node.Hostinfo != nil {
+			os = strings.TrimSpace(node.Hostinfo.OS + " " + node.Hostinfo.OSVersion)
+		}
+
+		pending = append(pending, templates.PendingRegistration{
+			ID:         reg.ID.String(),
+			Hostname:   node.Hostname,
+			OS:         os,
+			MachineKey: node.MachineKey.ShortString(),
+		})
+	}
+
+	slices.SortFunc(pending, func(a, b templates.PendingRegistration) int {
+		return cmp.Or(cmp.Compare(a.Hostname, b.Hostname), cmp.Compare(a.ID, b.ID))
+	})
+
+	users, err := h.db.ListUsers()
+	if err != nil {
+		httpError(writer, err)
+		return
+	}
+
+	adminUsers := make([]templates.AdminUser, 0, len(users))
+	for _, user := range users {
+		adminUsers = append(adminUsers, templates.AdminUser{
+			ID:   strconv.FormatUint(uint64(user.ID), util.Base10),
+			Name: user.Display(),
+		})
+	}
+
+	var csrf string
+	if cookie, err := req.Cookie(adminSessionCookie); err == nil {
+		csrf = h.adminCSRFToken(cookie.Value)
+	}
+
+	writeHTML(writer, http.StatusOK, templates.PendingRegistrations(pending, adminUsers, csrf).Render())
+}
+
+// ApproveRegistrationHandler registers a waiting node to the user, with the
+// tags and expiry chosen by the admin, and wakes up the client.
+// Listens in /admin/registrations/:registration_id/approve.
+func (h *Headscale) ApproveRegistrationHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	admin, ok := h.requireAdmin(writer, req)
+	if !ok {
+		return
+	}
+
+	registrationID, err := types.RegistrationIDFromString(mux.Vars(req)["registration_id"])
+	if err != nil {
+		httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid registration id", err))
+		return
+	}
+
+	userID, err := strconv.ParseUint(req.PostFormValue("user"), util.Base10, 64)
+	if err != nil {
+		httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid user", err))
+		return
+	}
+
+	user, err := h.db.GetUserByID(types.UserID(userID))
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			httpError(writer, NewHTTPError(http.StatusBadRequest, "user not found", err))
+			return
+		}
+
+		httpError(writer, err)
+		return
+	}
+
+	var tags []string
+	for tag := range strings.SplitSeq(req.PostFormValue("tags"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(tag, "tag:") {
+			httpError(writer, NewHTTPError(http.StatusBadRequest, fmt.Sprintf("tag %q does not begin with 'tag:'", tag), nil))
+			return
+		}
+
+		tags = append(tags, tag)
+	}
+
+	var expiry *time.Time
+	if value := strings.TrimSpace(req.PostFormValue("expiry")); value != "" {
+		duration, err := model.ParseDuration(value)
+		if err != nil {
+			httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid expiry, e.g. 90d or 12h", err))
+			return
+		}
+
+		expiry = ptr.To(time.Now().Add(time.Duration(duration)))
+	}
+
+	reg, err := h.db.GetPendingRegistration(registrationID)
+	if err != nil {
+		pendingRegistrationError(writer, err)
+		return
+	}
+
+	reg.Node.ForcedTags = tags
+	if err := h.db.SavePendingRegistrationNode(registrationID, reg.Node); err != nil {
+		pendingRegistrationError(writer, err)
+		return
+	}
+
+	node, err := h.registerFromAuthPath(req.Context(), registrationID, user, expiry, util.RegisterMethodCLI)
+	if err != nil {
+		if errors.Is(err, db.ErrDifferentRegisteredUser) {
+			httpError(writer, NewHTTPError(http.StatusBadRequest, "machine is registered to another user", err))
+			return
+		}
+
+		httpError(writer, err)
+		return
+	}
+
+	h.logger.Info().
+		Str("admin", admin).
+		Str("registration_id", registrationID.String()).
+		Uint64("node.id", node.ID.Uint64()).
+		Str("user", user.Username()).
+		Msg("registration approved")
+
+	http.Redirect(writer, req, adminRegistrationsPath, http.StatusSeeOther)
+}
+
+// RejectRegistrationHandler removes a waiting node, failing the login of
+// its client.
+// Listens in /admin/registrations/:registration_id/reject.
+func (h *Headscale) RejectRegistrationHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	admin, ok := h.requireAdmin(writer, req)
+	if !ok {
+		return
+	}
+
+	registrationID, err := types.RegistrationIDFromString(mux.Vars(req)["registration_id"])
+	if err != nil {
+		httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid registration id", err))
+		return
+	}
+
+	reg, err := h.db.GetPendingRegistration(registrationID)
+	if err != nil {
+		pendingRegistrationError(writer, err)
+		return
+	}
+
+	// Let the client waiting for the registration know that it is over.
+	if err := h.db.RejectPendingRegistration(registrationID, ""); err != nil {
+		pendingRegistrationError(writer, err)
+		return
+	}
+
+	h.logger.Info().
+		Str("admin", admin).
+		Str("registration_id", registrationID.String()).
+		Str("hostname", reg.Node.Hostname).
+		Msg("registration rejected")
+
+	http.Redirect(writer, req, adminRegistrationsPath, http.StatusSeeOther)
+}
+
+func writeHTML(writer http.ResponseWriter, code int, content string) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(code)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		util.LogErr(err, "Failed to write response")
+	}
+}
+
+// pendingRegistrationError writes the error of looking up or updating a
+// pending registration.
+func pendingRegistrationError(writer http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrNodeNotFoundRegistrationCache) {
+		httpError(writer, NewHTTPError(http.StatusNotFound, errRegistrationNotFound.Error(), nil))
+		return
+	}
+
+	httpError(writer, err)
+}
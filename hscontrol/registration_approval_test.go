@@ -0,0 +1,184 @@
+package hscontrol
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	grpcRuntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+func addPendingRegistration(t *testing.T, h *Headscale, hostname string) types.RegistrationID {
+	t.Helper()
+
+	id, err := types.NewRegistrationID()
+	require.NoError(t, err)
+
+	err = h.db.CreatePendingRegistration(id, types.Node{
+		Hostname:   hostname,
+		MachineKey: key.NewMachine().Public(),
+		NodeKey:    key.NewNode().Public(),
+		Hostinfo:   &tailcfg.Hostinfo{Hostname: hostname, OS: "linux"},
+	})
+	require.NoError(t, err)
+
+	return id
+}
+
+func TestRegistrationApproval(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	h.cfg.RegistrationApproval.Enabled = true
+	router := h.createRouter(grpcRuntime.NewServeMux())
+
+	serve := func(method, target string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	user, err := h.db.CreateUser(types.User{Name: "alice"})
+	require.NoError(t, err)
+
+	expiration := time.Now().Add(time.Hour)
+	apiKey, _, err := h.db.CreateAPIKey(&expiration)
+	require.NoError(t, err)
+
+	rec := serve(http.MethodGet, adminRegistrationsPath, nil, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, adminLoginPath, rec.Header().Get("Location"))
+
+	rec = serve(http.MethodPost, adminLoginPath, url.Values{"api_key": {"invalid.key"}}, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodPost, adminLoginPath, url.Values{"api_key": {apiKey}}, nil)
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	session := cookies[0]
+
+	id := addPendingRegistration(t, h, "<script>laptop")
+
+	rec = serve(http.MethodGet, adminRegistrationsPath, nil, session)
+	require.Equal(t, http.StatusOK, rec.Code)
+	page := rec.Body.String()
+	assert.Contains(t, page, "&lt;script&gt;laptop")
+	assert.NotContains(t, page, "<script>")
+	assert.Contains(t, page, id.String())
+
+	csrf := regexp.MustCompile(`name="csrf"[^>]*value="([^"]+)"`).FindStringSubmatch(page)
+	require.Len(t, csrf, 2)
+
+	approve := url.Values{
+		"user":   {strconv.FormatUint(uint64(user.ID), 10)},
+		"tags":   {"tag:server, tag:prod"},
+		"expiry": {"1h"},
+	}
+
+	rec = serve(http.MethodPost, adminRegistrationsPath+"/"+id.String()+"/approve", approve, session)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "approving without the CSRF token")
+
+	approve.Set("csrf", csrf[1])
+	rec = serve(http.MethodPost, adminRegistrationsPath+"/"+id.String()+"/approve", approve, session)
+	require.Equal(t, http.StatusSeeOther, rec.Code, rec.Body.String())
+
+	node, err := h.db.WaitForRegistration(t.Context(), id)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, node.UserID)
+	assert.Equal(t, []string{"tag:server", "tag:prod"}, node.ForcedTags)
+	require.NotNil(t, node.Expiry)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *node.Expiry, time.Minute)
+
+	_, err = h.db.GetPendingRegistration(id)
+	assert.ErrorIs(t, err, db.ErrNodeNotFoundRegistrationCache)
+
+	id = addPendingRegistration(t, h, "rejected")
+
+	req := httptest.NewRequest(http.MethodPost, adminRegistrationsPath+"/"+id.String()+"/reject", nil)
+	req.Header.Set("Authorization", AuthPrefix+apiKey)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+
+	_, err = h.db.WaitForRegistration(t.Context(), id)
+	assert.ErrorIs(t, err, db.ErrRegistrationRejected)
+
+	rec = serve(http.MethodGet, adminRegistrationsPath, nil, session)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), id.String())
+
+	// The session ends with the API key it was started with.
+	prefix, _, _ := strings.Cut(apiKey, ".")
+	key, err := h.db.GetAPIKey(prefix)
+	require.NoError(t, err)
+	require.NoError(t, h.db.DestroyAPIKey(*key))
+
+	rec = serve(http.MethodGet, adminRegistrationsPath, nil, session)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, adminLoginPath, rec.Header().Get("Location"))
+}
+
+func TestAdminLogoutEndsSession(t *testing.T) {
+	h := newOAuthTestHeadscale(t)
+	h.cfg.RegistrationApproval.Enabled = true
+	router := h.createRouter(grpcRuntime.NewServeMux())
+
+	// Sessions of admins logged in with OIDC have no API key.
+	rec := httptest.NewRecorder()
+	h.startAdminSession(rec, httptest.NewRequest(http.MethodGet, adminLoginPath, nil), "admin@example.com", nil)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	session := cookies[0]
+
+	serve := func(method, target string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(session)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec = serve(http.MethodGet, adminRegistrationsPath, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	csrf := regexp.MustCompile(`name="csrf"[^>]*value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	require.Len(t, csrf, 2)
+
+	rec = serve(http.MethodPost, "/admin/logout", url.Values{"csrf": {csrf[1]}})
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+
+	// The old cookie can not be used anymore.
+	rec = serve(http.MethodGet, adminRegistrationsPath, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, adminLoginPath, rec.Header().Get("Location"))
+}
+
+func TestOIDCClaimHoldsAny(t *testing.T) {
+	admins := []string{"headscale-admins"}
+
+	assert.True(t, oidcClaimHoldsAny("headscale-admins", admins))
+	assert.True(t, oidcClaimHoldsAny([]any{"users", "headscale-admins"}, admins))
+	assert.False(t, oidcClaimHoldsAny([]any{"users"}, admins))
+	assert.False(t, oidcClaimHoldsAny(nil, admins))
+	assert.False(t, oidcClaimHoldsAny(true, admins))
+}
@@ -36,19 +36,21 @@ func New() *PrimaryRoutes {
 }
 
 // updatePrimaryLocked recalculates the primary routes and updates the internal state.
-// It returns true if the primary routes have changed.
+// It returns the nodes that gained or lost a primary route, if the primary routes
+// have not changed, the list is empty.
 // It is assumed that the caller holds the lock.
 // The algorthm is as follows:
 // 1. Reset the primaries map.
 // 2. Iterate over the routes and count the number of times a prefix is advertised.
 // 3. If a prefix is advertised by at least two nodes, it is a primary route.
-// 4. If the primary routes have changed, update the internal state and return true.
-// 5. Otherwise, return false.
-func (pr *PrimaryRoutes) updatePrimaryLocked() bool {
+// 4. If the primary routes have changed, update the internal state and return
+// the nodes that were affected.
+// 5. Otherwise, return an empty list.
+func (pr *PrimaryRoutes) updatePrimaryLocked() []types.NodeID {
 	// reset the primaries map, as we are going to recalculate it.
 	allPrimaries := make(map[netip.Prefix][]types.NodeID)
 	pr.isPrimary = make(map[types.NodeID]bool)
-	changed := false
+	var changed set.Slice[types.NodeID]
 
 	// sort the node ids so we can iterate over them in a deterministic order.
 	// this is important so the same node is chosen two times in a row
@@ -74,23 +76,26 @@ func (pr *PrimaryRoutes) updatePrimaryLocked() bool {
 	// If the current primary is still available, continue.
 	// If the current primary is not available, select a new one.
 	for prefix, nodes := range allPrimaries {
-		if node, ok := pr.primaries[prefix]; ok {
+		node, ok := pr.primaries[prefix]
+		if ok {
 			// If the current primary is still available, continue.
 			if slices.Contains(nodes, node) {
 				continue
 			}
+
+			changed.Add(node)
 		}
 		if len(nodes) >= 1 {
 			pr.primaries[prefix] = nodes[0]
-			changed = true
+			changed.Add(nodes[0])
 		}
 	}
 
 	// Clean up any remaining primaries that are no longer valid.
-	for prefix := range pr.primaries {
+	for prefix, node := range pr.primaries {
 		if _, ok := allPrimaries[prefix]; !ok {
 			delete(pr.primaries, prefix)
-			changed = true
+			changed.Add(node)
 		}
 	}
 
@@ -99,7 +104,10 @@ func (pr *PrimaryRoutes) updatePrimaryLocked() bool {
 		pr.isPrimary[nodeID] = true
 	}
 
-	return changed
+	affected := changed.Slice().AsSlice()
+	slices.Sort(affected)
+
+	return affected
 }
 
 // SetRoutes sets the routes for a given Node ID and recalculates the primary routes
@@ -107,6 +115,13 @@ func (pr *PrimaryRoutes) updatePrimaryLocked() bool {
 // It returns true if there was a change in primary routes.
 // All exit routes are ignored as they are not used in primary route context.
 func (pr *PrimaryRoutes) SetRoutes(node types.NodeID, prefixes ...netip.Prefix) bool {
+	return len(pr.SetRoutesAffected(node, prefixes...)) > 0
+}
+
+// SetRoutesAffected sets the routes for a given Node ID like SetRoutes, but
+// returns the IDs of the nodes that gained or lost a primary route. Only these
+// nodes, and not the whole tailnet, need to be sent to the peers.
+func (pr *PrimaryRoutes) SetRoutesAffected(node types.NodeID, prefixes ...netip.Prefix) []types.NodeID {
 	pr.mu.Lock()
 	defer pr.mu.Unlock()
 
@@ -117,7 +132,7 @@ func (pr *PrimaryRoutes) SetRoutes(node types.NodeID, prefixes ...netip.Prefix)
 			return pr.updatePrimaryLocked()
 		}
 
-		return false
+		return nil
 	}
 
 	rs := make(set.Set[netip.Prefix], len(prefixes))
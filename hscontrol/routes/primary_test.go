@@ -466,3 +466,31 @@ func TestPrimaryRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestPrimaryRoutesAffected(t *testing.T) {
+	pr := New()
+
+	got := pr.SetRoutesAffected(1, mp("192.168.1.0/24"))
+	if diff := cmp.Diff([]types.NodeID{1}, got); diff != "" {
+		t.Errorf("first primary mismatch (-want +got):\n%s", diff)
+	}
+
+	// A second node announcing the same route does not take over.
+	got = pr.SetRoutesAffected(2, mp("192.168.1.0/24"))
+	if len(got) != 0 {
+		t.Errorf("backup route should not affect any node, got %v", got)
+	}
+
+	// Node 3 has nothing to do with the failover and is not affected.
+	pr.SetRoutesAffected(3, mp("10.0.0.0/8"))
+
+	got = pr.SetRoutesAffected(1)
+	if diff := cmp.Diff([]types.NodeID{1, 2}, got); diff != "" {
+		t.Errorf("failover mismatch (-want +got):\n%s", diff)
+	}
+
+	got = pr.SetRoutesAffected(2)
+	if diff := cmp.Diff([]types.NodeID{2}, got); diff != "" {
+		t.Errorf("removal mismatch (-want +got):\n%s", diff)
+	}
+}
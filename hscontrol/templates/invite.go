@@ -0,0 +1,88 @@
+package templates
+
+import (
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+)
+
+func externalLink(href, label string) *elem.Element {
+	return elem.A(attrs.Props{
+		attrs.Href:   href,
+		attrs.Rel:    "noreferrer noopener",
+		attrs.Target: "_blank",
+	}, elem.Text(label))
+}
+
+// Invite is the landing page of an invite link. It tells the invited
+// person how to install Tailscale, and has a button to accept the invite,
+// by logging in with OIDC when oidc is set.
+func Invite(email string, oidc bool, action string) *elem.Element {
+	greeting := "You have been invited to join this headscale network."
+	if email != "" {
+		greeting = fmt.Sprintf("You have been invited to join this headscale network as %s.", email)
+	}
+
+	accept := "Accept the invite to get a key to connect your devices with."
+	if oidc {
+		accept = "Log in to accept the invite and get a key to connect your devices with."
+	}
+
+	return HtmlStructure(
+		elem.Title(nil, elem.Text("Invite - Headscale")),
+		elem.Body(attrs.Props{attrs.Style: bodyStyle.ToInline()},
+			headerOne("headscale"),
+			headerTwo("You are invited"),
+			elem.P(nil, text(greeting)),
+			headerThree("1. Install Tailscale"),
+			elem.Ul(nil,
+				elem.Li(nil, externalLink("https://tailscale.com/download/linux", "Linux")),
+				elem.Li(nil, externalLink("https://tailscale.com/download/windows", "Windows")),
+				elem.Li(nil, externalLink("https://tailscale.com/download/mac", "macOS")),
+				elem.Li(nil, externalLink("https://apps.apple.com/app/tailscale/id1470499037", "iOS and tvOS")),
+				elem.Li(nil, externalLink("https://play.google.com/store/apps/details?id=com.tailscale.ipn", "Android")),
+			),
+			headerThree("2. Accept the invite"),
+			elem.P(nil, elem.Text(accept)),
+			elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: html.EscapeString(action)},
+				elem.Button(attrs.Props{attrs.Type: "submit"}, elem.Text("Accept invite")),
+			),
+			elem.P(nil, elem.Text("The invite can only be accepted once.")),
+		),
+	)
+}
+
+// InviteAccepted shows the pre-auth key given with an accepted invite, and
+// how to connect each OS to headscale with it.
+func InviteAccepted(url, user, authKey string, expiration time.Time) *elem.Element {
+	command := fmt.Sprintf("tailscale up --login-server %s --authkey %s", url, authKey)
+
+	return HtmlStructure(
+		elem.Title(nil, elem.Text("Invite accepted - Headscale")),
+		elem.Body(attrs.Props{attrs.Style: bodyStyle.ToInline()},
+			headerOne("headscale"),
+			headerTwo("Welcome, "+html.EscapeString(user)),
+			elem.P(nil,
+				text(fmt.Sprintf(
+					"Connect your devices with the key below. It can be used for several devices until %s, and is only shown once.",
+					expiration.UTC().Format(time.RFC1123),
+				)),
+			),
+			elem.Pre(nil, elem.Code(nil, text(authKey))),
+			headerThree("Linux and macOS"),
+			elem.P(nil, elem.Text("Open a terminal and run:")),
+			elem.Pre(nil, elem.Code(nil, text("sudo "+command))),
+			headerThree("Windows"),
+			elem.Div(nil, windowsSteps(html.EscapeString(command))...),
+			headerThree("iOS, tvOS and the macOS app"),
+			elem.P(nil,
+				elem.Text("The apps log in with the browser rather than with a key. Point them to headscale as described in the "),
+				elem.A(attrs.Props{attrs.Href: "/apple"}, elem.Text("Apple configuration")),
+				elem.Text(", then log in."),
+			),
+		),
+	)
+}
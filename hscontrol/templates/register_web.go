@@ -16,7 +16,9 @@ var codeStyleRegisterWebAPI = styles.Props{
 	styles.BackgroundColor: "#eee",
 }
 
-func RegisterWeb(registrationID types.RegistrationID) *elem.Element {
+// RegisterWeb tells the user how to get the machine registered. If
+// approvalURL is set, admins can also approve it on that page.
+func RegisterWeb(registrationID types.RegistrationID, approvalURL string) *elem.Element {
 	return HtmlStructure(
 		elem.Title(nil, elem.Text("Registration - Headscale")),
 		elem.Body(attrs.Props{
@@ -30,6 +32,14 @@ func RegisterWeb(registrationID types.RegistrationID) *elem.Element {
 			elem.Code(attrs.Props{attrs.Style: codeStyleRegisterWebAPI.ToInline()},
 				elem.Text(fmt.Sprintf("headscale nodes register --key %s --user USERNAME", registrationID.String())),
 			),
+			elem.If[elem.Node](approvalURL != "",
+				elem.P(nil,
+					elem.Text("Or ask an admin to approve this machine on "),
+					elem.A(attrs.Props{attrs.Href: approvalURL}, elem.Text(approvalURL)),
+					elem.Text("."),
+				),
+				elem.None(),
+			),
 		),
 	)
 }
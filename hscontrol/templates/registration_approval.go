@@ -0,0 +1,139 @@
+package templates
+
+import (
+	"html"
+
+	"github.com/chasefleming/elem-go"
+	"github.com/chasefleming/elem-go/attrs"
+	"github.com/chasefleming/elem-go/styles"
+)
+
+// PendingRegistration is a node waiting for an interactive login, as shown
+// on the approval page. Fields set by the node are escaped when rendered.
+type PendingRegistration struct {
+	ID         string
+	Hostname   string
+	OS         string
+	MachineKey string
+}
+
+// AdminUser is a user nodes can be approved to.
+type AdminUser struct {
+	ID   string
+	Name string
+}
+
+var tableStyle = styles.Props{
+	styles.Width:          "100%",
+	styles.BorderCollapse: "collapse",
+}
+
+var cellStyle = styles.Props{
+	styles.Padding:      "6px",
+	styles.BorderBottom: "1px solid #ddd",
+	styles.TextAlign:    "left",
+}
+
+func text(s string) elem.TextNode {
+	return elem.Text(html.EscapeString(s))
+}
+
+func hiddenInput(name, value string) *elem.Element {
+	return elem.Input(attrs.Props{
+		attrs.Type:  "hidden",
+		attrs.Name:  name,
+		attrs.Value: html.EscapeString(value),
+	})
+}
+
+// AdminLogin asks an admin for an API key, or to log in with OIDC.
+func AdminLogin(oidc bool, message string) *elem.Element {
+	return HtmlStructure(
+		elem.Title(nil, elem.Text("Admin login - Headscale")),
+		elem.Body(attrs.Props{attrs.Style: bodyStyle.ToInline()},
+			headerOne("headscale"),
+			headerTwo("Admin login"),
+			elem.If[elem.Node](message != "", elem.P(nil, text(message)), elem.None()),
+			elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/admin/login"},
+				elem.Label(nil, elem.Text("API key ")),
+				elem.Input(attrs.Props{
+					attrs.Type: "password",
+					attrs.Name: "api_key",
+				}),
+				elem.Text(" "),
+				elem.Button(attrs.Props{attrs.Type: "submit"}, elem.Text("Log in")),
+			),
+			elem.If[elem.Node](oidc,
+				elem.P(nil, elem.A(attrs.Props{attrs.Href: "/admin/login/oidc"}, elem.Text("Log in with OIDC"))),
+				elem.None(),
+			),
+		),
+	)
+}
+
+// PendingRegistrations lists the nodes waiting for an interactive login,
+// each with a form to approve it to a user, with tags and an expiry, or to
+// reject it.
+func PendingRegistrations(pending []PendingRegistration, users []AdminUser, csrf string) *elem.Element {
+	userOptions := make([]elem.Node, 0, len(users))
+	for _, user := range users {
+		userOptions = append(userOptions,
+			elem.Option(attrs.Props{attrs.Value: html.EscapeString(user.ID)}, text(user.Name)))
+	}
+
+	rows := []elem.Node{
+		elem.Tr(nil,
+			elem.Th(attrs.Props{attrs.Style: cellStyle.ToInline()}, elem.Text("Hostname")),
+			elem.Th(attrs.Props{attrs.Style: cellStyle.ToInline()}, elem.Text("OS")),
+			elem.Th(attrs.Props{attrs.Style: cellStyle.ToInline()}, elem.Text("Machine key")),
+			elem.Th(attrs.Props{attrs.Style: cellStyle.ToInline()}, elem.Text("Approve")),
+		),
+	}
+
+	for _, reg := range pending {
+		action := "/admin/registrations/" + html.EscapeString(reg.ID)
+		rows = append(rows, elem.Tr(nil,
+			elem.Td(attrs.Props{attrs.Style: cellStyle.ToInline()}, text(reg.Hostname)),
+			elem.Td(attrs.Props{attrs.Style: cellStyle.ToInline()}, text(reg.OS)),
+			elem.Td(attrs.Props{attrs.Style: cellStyle.ToInline()}, elem.Code(nil, text(reg.MachineKey))),
+			elem.Td(attrs.Props{attrs.Style: cellStyle.ToInline()},
+				elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: action + "/approve"},
+					hiddenInput("csrf", csrf),
+					elem.Select(attrs.Props{attrs.Name: "user"}, userOptions...),
+					elem.Input(attrs.Props{
+						attrs.Type:        "text",
+						attrs.Name:        "tags",
+						attrs.Placeholder: "tag:server,tag:prod",
+					}),
+					elem.Input(attrs.Props{
+						attrs.Type:        "text",
+						attrs.Name:        "expiry",
+						attrs.Placeholder: "expiry, e.g. 90d",
+						attrs.Size:        "12",
+					}),
+					elem.Button(attrs.Props{attrs.Type: "submit"}, elem.Text("Approve")),
+					elem.Button(attrs.Props{
+						attrs.Type:   "submit",
+						"formaction": action + "/reject",
+					}, elem.Text("Reject")),
+				),
+			),
+		))
+	}
+
+	return HtmlStructure(
+		elem.Title(nil, elem.Text("Pending registrations - Headscale")),
+		elem.Body(attrs.Props{attrs.Style: bodyStyle.ToInline()},
+			headerOne("headscale"),
+			headerTwo("Pending registrations"),
+			elem.If(len(pending) == 0,
+				elem.P(nil, elem.Text("No machines are waiting to be registered.")),
+				elem.Table(attrs.Props{attrs.Style: tableStyle.ToInline()}, rows...),
+			),
+			elem.Form(attrs.Props{attrs.Method: "post", attrs.Action: "/admin/logout"},
+				hiddenInput("csrf", csrf),
+				elem.Button(attrs.Props{attrs.Type: "submit"}, elem.Text("Log out")),
+			),
+		),
+	)
+}
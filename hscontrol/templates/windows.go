@@ -15,25 +15,35 @@ func Windows(url string) *elem.Element {
 		elem.Body(attrs.Props{
 			attrs.Style: bodyStyle.ToInline(),
 		},
-			headerOne("headscale: Windows configuration"),
-			elem.P(nil,
-				elem.Text("Download "),
-				elem.A(attrs.Props{
-					attrs.Href:   "https://tailscale.com/download/windows",
-					attrs.Rel:    "noreferrer noopener",
-					attrs.Target: "_blank",
-				},
-					elem.Text("Tailscale for Windows ")),
-				elem.Text("and install it."),
-			),
-			elem.P(nil,
-				elem.Text("Open a Command Prompt or Powershell and use Tailscale's login command to connect with headscale: "),
-			),
-			elem.Pre(nil,
-				elem.Code(nil,
-					elem.Text(fmt.Sprintf(`tailscale login --login-server %s`, url)),
-				),
-			),
+			append(
+				[]elem.Node{headerOne("headscale: Windows configuration")},
+				windowsSteps(fmt.Sprintf(`tailscale login --login-server %s`, url))...,
+			)...,
 		),
 	)
 }
+
+// windowsSteps tells how to install Tailscale for Windows and connect it
+// to headscale with command.
+func windowsSteps(command string) []elem.Node {
+	return []elem.Node{
+		elem.P(nil,
+			elem.Text("Download "),
+			elem.A(attrs.Props{
+				attrs.Href:   "https://tailscale.com/download/windows",
+				attrs.Rel:    "noreferrer noopener",
+				attrs.Target: "_blank",
+			},
+				elem.Text("Tailscale for Windows ")),
+			elem.Text("and install it."),
+		),
+		elem.P(nil,
+			elem.Text("Open a Command Prompt or Powershell and use Tailscale's login command to connect with headscale: "),
+		),
+		elem.Pre(nil,
+			elem.Code(nil,
+				elem.Text(command),
+			),
+		),
+	}
+}
@@ -0,0 +1,18 @@
+package types
+
+import "time"
+
+// AdminSession is the login of an admin approving registrations on the
+// web. The session cookie only carries its ID, so deleting the session
+// logs the admin out.
+type AdminSession struct {
+	ID      uint64 `gorm:"primary_key"`
+	Subject string
+
+	// APIKeyID is the API key the admin logged in with, if any. The
+	// session ends when the key is removed or expires.
+	APIKeyID *uint64
+
+	CreatedAt  *time.Time
+	Expiration time.Time
+}
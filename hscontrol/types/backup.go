@@ -0,0 +1,45 @@
+package types
+
+import (
+	"errors"
+	"time"
+)
+
+// BackupVersion is the version of the backup format written by this
+// version of headscale.
+const BackupVersion = 1
+
+var (
+	ErrBackupVersion   = errors.New("unsupported backup version")
+	ErrBackupMigration = errors.New("backup schema does not match the database schema")
+	ErrBackupNotEmpty  = errors.New("database is not empty")
+
+	ErrBackupPrivateKey = errors.New("private key file differs from the backup")
+)
+
+// Backup is the content of a backup archive. It holds the state of the
+// database, independent of the database backend, and the private keys of
+// the server.
+type Backup struct {
+	Version          int       `json:"version"`
+	CreatedAt        time.Time `json:"created_at"`
+	HeadscaleVersion string    `json:"headscale_version"`
+
+	// Migration is the ID of the last schema migration of the database
+	// the backup was created from. A backup can only be restored to a
+	// database at the same migration.
+	Migration string `json:"migration"`
+
+	NoisePrivateKey string `json:"noise_private_key"`
+	DERPPrivateKey  string `json:"derp_private_key,omitempty"`
+
+	Users        []User        `json:"users"`
+	PreAuthKeys  []PreAuthKey  `json:"pre_auth_keys"`
+	Nodes        []Node        `json:"nodes"`
+	APIKeys      []APIKey      `json:"api_keys"`
+	OAuthClients []OAuthClient `json:"oauth_clients"`
+	DNSRecords   []DNSRecord   `json:"dns_records"`
+	UserLinks    []UserLink    `json:"user_links"`
+	Invites      []Invite      `json:"invites,omitempty"`
+	Policy       string        `json:"policy,omitempty"`
+}
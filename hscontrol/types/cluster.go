@@ -0,0 +1,20 @@
+package types
+
+import "time"
+
+// NodeConnection records that a node has a poll session open on a headscale
+// instance, so the instances sharing the database know which nodes are
+// online. UpdatedAt is refreshed by the instance while it is running.
+type NodeConnection struct {
+	NodeID    NodeID    `gorm:"primaryKey;autoIncrement:false"`
+	Instance  string    `gorm:"primaryKey"`
+	UpdatedAt time.Time `gorm:"index"`
+}
+
+// IPReservation reserves an address handed out to a node being registered,
+// so another headscale instance sharing the database does not hand it out
+// before the node is stored.
+type IPReservation struct {
+	IP         string    `gorm:"primaryKey"`
+	Expiration time.Time `gorm:"index"`
+}
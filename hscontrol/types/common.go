@@ -148,6 +148,54 @@ func UpdateExpire(nodeID NodeID, expiry time.Time) StateUpdate {
 	}
 }
 
+// NodeViewChange describes how the view a node has of the tailnet, its
+// packet filter, SSH policy and visible peers, changed after an update
+// to the policy, users or nodes.
+type NodeViewChange struct {
+	// Full is set if the change could not be determined and the node
+	// needs a full update.
+	Full bool
+
+	// Self is set if the packet filter or SSH policy of the node changed.
+	Self bool
+
+	// PeersChanged contains the peers that became visible to the node
+	// or changed in a way that is only visible through the policy,
+	// like their allowed routes.
+	PeersChanged []NodeID
+
+	// PeersRemoved contains the peers that are no longer visible to the node.
+	PeersRemoved []NodeID
+}
+
+// Empty reports if the view of the node did not change.
+func (c NodeViewChange) Empty() bool {
+	return !c.Full && !c.Self && len(c.PeersChanged) == 0 && len(c.PeersRemoved) == 0
+}
+
+// StateUpdates returns the updates that needs to be sent to nodeID to
+// bring it up to date with the change.
+func (c NodeViewChange) StateUpdates(nodeID NodeID) []StateUpdate {
+	if c.Full {
+		return []StateUpdate{UpdateFull()}
+	}
+
+	var updates []StateUpdate
+	if len(c.PeersRemoved) > 0 {
+		updates = append(updates, UpdatePeerRemoved(c.PeersRemoved...))
+	}
+
+	// Both peer updates carry the packet filter and SSH policy, only
+	// send a self update if the peers did not change.
+	if len(c.PeersChanged) > 0 {
+		updates = append(updates, UpdatePeerChanged(c.PeersChanged...))
+	} else if c.Self && len(updates) == 0 {
+		updates = append(updates, UpdateSelf(nodeID))
+	}
+
+	return updates
+}
+
 var (
 	NotifyOriginKey   = ctxkey.New("notify.origin", "")
 	NotifyHostnameKey = ctxkey.New("notify.hostname", "")
@@ -192,7 +240,37 @@ func (r RegistrationID) String() string {
 	return string(r)
 }
 
-type RegisterNode struct {
-	Node       Node
-	Registered chan *Node
+// PendingRegistration is a node waiting for an interactive login. It is
+// stored in the database, so the login can be completed on any headscale
+// instance and survives restarts. RegisteredNodeID or Rejected record the
+// outcome for the client waiting for it, until the registration expires.
+type PendingRegistration struct {
+	ID               RegistrationID `gorm:"primaryKey"`
+	Node             Node           `gorm:"serializer:json"`
+	RegisteredNodeID *uint64
+	Rejected         bool
+	// RejectReason tells the client why the registration is rejected.
+	RejectReason string
+	CreatedAt    time.Time
+	Expiration   time.Time `gorm:"index"`
+}
+
+// IsOpen reports whether the registration still waits for a login.
+func (r *PendingRegistration) IsOpen() bool {
+	return r.RegisteredNodeID == nil && !r.Rejected && time.Now().Before(r.Expiration)
+}
+
+// OIDCLogin is an OIDC login in progress, found by the state the OIDC
+// provider passes back to the callback, on any headscale instance.
+type OIDCLogin struct {
+	State          string `gorm:"primaryKey"`
+	RegistrationID RegistrationID
+	Verifier       *string
+	// AdminLogin is set when an admin logs in to approve registrations,
+	// rather than a node registering.
+	AdminLogin bool
+	// InviteID is set when an invited person logs in to accept an
+	// invite, rather than a node registering.
+	InviteID   *uint64
+	Expiration time.Time `gorm:"index"`
 }
@@ -17,6 +17,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"go4.org/netipx"
+	"tailscale.com/envknob"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/dnstype"
@@ -69,6 +70,14 @@ type Config struct {
 
 	Database DatabaseConfig
 
+	Cluster ClusterConfig
+
+	Backup BackupConfig
+
+	// Quota is the default quota of the users, which can be overridden
+	// for each user.
+	Quota Quota
+
 	DERP DERPConfig
 
 	TLS TLSConfig
@@ -90,6 +99,10 @@ type Config struct {
 
 	OIDC OIDCConfig
 
+	WorkloadIdentity WorkloadIdentityConfig
+
+	RegistrationApproval RegistrationApprovalConfig
+
 	LogTail             LogTailConfig
 	RandomizeClientPort bool
 
@@ -98,6 +111,12 @@ type Config struct {
 	Policy PolicyConfig
 
 	Tuning Tuning
+
+	Debug DebugConfig
+
+	// Hooks are set by applications embedding Headscale, they can not
+	// be configured from the configuration file.
+	Hooks Hooks
 }
 
 type DNSConfig struct {
@@ -185,6 +204,146 @@ type OIDCConfig struct {
 	Expiry                     time.Duration
 	UseExpiryFromToken         bool
 	PKCE                       PKCEConfig
+
+	// LinkUsersByEmail links the first OIDC login of a user to the
+	// existing user without OIDC identity with the same verified email,
+	// instead of creating a new user.
+	LinkUsersByEmail bool
+}
+
+// ClusterConfig lets several headscale instances share one PostgreSQL
+// database, propagating changes and node online state between them.
+type ClusterConfig struct {
+	Enabled bool
+
+	// InstanceID names the instance among the instances sharing the
+	// database. When empty, the hostname with a random suffix is used.
+	InstanceID string
+
+	// HeartbeatInterval is how often the instance records that its nodes
+	// are still connected. The connections of an instance that has not
+	// done so for three intervals are considered gone.
+	HeartbeatInterval time.Duration
+}
+
+// BackupConfig configures the backups headscale writes on a schedule.
+type BackupConfig struct {
+	// Interval between two backups, backups are disabled when zero.
+	Interval time.Duration
+
+	// Directory the backups are written to.
+	Directory string
+
+	// Retention is the number of backups kept in the directory, the
+	// oldest are removed. Zero keeps all backups.
+	Retention int
+}
+
+// RegistrationApprovalConfig configures the web page on which admins
+// approve or reject the nodes waiting for an interactive login.
+type RegistrationApprovalConfig struct {
+	Enabled bool
+
+	// OIDCAdminClaim and OIDCAdminValues let users log in to the page with
+	// OIDC, when the claim of their ID token holds one of the values. The
+	// page can always be used with an API key.
+	OIDCAdminClaim  string
+	OIDCAdminValues []string
+}
+
+// WorkloadIdentityConfig lists the issuers of OIDC tokens, e.g. CI systems
+// or Kubernetes, which nodes can register with instead of a pre auth key.
+type WorkloadIdentityConfig struct {
+	Issuers []WorkloadIdentityIssuer `mapstructure:"issuers"`
+}
+
+// WorkloadIdentityIssuer describes which tokens of an issuer are accepted,
+// and how the nodes registering with them are registered. An issuer can be
+// listed several times, the first entry matching a token is used.
+type WorkloadIdentityIssuer struct {
+	// Issuer is the URL of the issuer, as found in the iss claim.
+	Issuer string `mapstructure:"issuer"`
+
+	// JWKSURL is the URL of the keys of the issuer, it is discovered from
+	// the issuer if empty.
+	JWKSURL string `mapstructure:"jwks_url"`
+
+	// Audience must be in the aud claim of the token.
+	Audience string `mapstructure:"audience"`
+
+	// Subject is a pattern the sub claim of the token must match, where
+	// "*" matches any characters.
+	Subject string `mapstructure:"subject"`
+
+	// Claims are patterns that other claims of the token must match.
+	Claims map[string]string `mapstructure:"claims"`
+
+	// User is the name of the user owning the nodes, it is created if it
+	// does not exist.
+	User string `mapstructure:"user"`
+
+	// Tags are forced on the nodes.
+	Tags []string `mapstructure:"tags"`
+
+	// Ephemeral nodes are removed when they go offline.
+	Ephemeral bool `mapstructure:"ephemeral"`
+
+	// NodeExpiry is the longest the nodes are valid before they have to
+	// register again, they do not expire if zero.
+	NodeExpiry time.Duration `mapstructure:"node_expiry"`
+}
+
+// Validate returns an error if the issuer can not be used.
+func (i *WorkloadIdentityIssuer) Validate() error {
+	if i.Issuer == "" {
+		return errors.New("workload identity issuer: issuer is required")
+	}
+
+	if i.Audience == "" {
+		return fmt.Errorf("workload identity issuer %q: audience is required", i.Issuer)
+	}
+
+	if i.User == "" {
+		return fmt.Errorf("workload identity issuer %q: user is required", i.Issuer)
+	}
+
+	// Without patterns, every token of the issuer for the audience would
+	// be accepted, e.g. from any repository on GitHub Actions.
+	if i.Subject == "" && len(i.Claims) == 0 {
+		return fmt.Errorf("workload identity issuer %q: a subject or claims are required", i.Issuer)
+	}
+
+	for _, tag := range i.Tags {
+		if !strings.HasPrefix(tag, "tag:") {
+			return fmt.Errorf("workload identity issuer %q: tag %q does not begin with 'tag:'", i.Issuer, tag)
+		}
+	}
+
+	if i.NodeExpiry < 0 {
+		return fmt.Errorf("workload identity issuer %q: node expiry must not be negative", i.Issuer)
+	}
+
+	return nil
+}
+
+func workloadIdentityConfig() (WorkloadIdentityConfig, error) {
+	var cfg WorkloadIdentityConfig
+
+	if !viper.IsSet("workload_identity.issuers") {
+		return cfg, nil
+	}
+
+	if err := viper.UnmarshalKey("workload_identity.issuers", &cfg.Issuers); err != nil {
+		return cfg, fmt.Errorf("unmarshalling workload identity issuers: %w", err)
+	}
+
+	for _, issuer := range cfg.Issuers {
+		if err := issuer.Validate(); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, nil
 }
 
 type DERPConfig struct {
@@ -227,15 +386,35 @@ func (p *PolicyConfig) IsEmpty() bool {
 type LogConfig struct {
 	Format string
 	Level  zerolog.Level
+
+	// Logger is the logger of the Headscale instance, the global logger
+	// is used if nil. Level is applied on top of it.
+	Logger *zerolog.Logger
+}
+
+// DebugConfig holds the debugging options of a Headscale instance. They
+// are set from the HEADSCALE_DEBUG_* environment variables when the
+// configuration is loaded with LoadServerConfig.
+type DebugConfig struct {
+	// Profiling runs a CPU profile while the server is serving. Only one
+	// profile can run in a process at a time.
+	Profiling     bool
+	ProfilingPath string
+
+	// DumpConfig prints the configuration when the server starts.
+	DumpConfig bool
 }
 
 type Tuning struct {
 	NotifierSendTimeout            time.Duration
+	NotifierQueueSize              int
 	BatchChangeDelay               time.Duration
 	NodeMapSessionBufferedChanSize int
+	NodeStorePersistInterval       time.Duration
 }
 
-func validatePKCEMethod(method string) error {
+// ValidatePKCEMethod returns an error if method is not a supported PKCE method.
+func ValidatePKCEMethod(method string) error {
 	if method != PKCEMethodPlain && method != PKCEMethodS256 {
 		return errInvalidPKCEMethod
 	}
@@ -321,6 +500,21 @@ func LoadConfig(path string, isFile bool) error {
 	viper.SetDefault("oidc.use_expiry_from_token", false)
 	viper.SetDefault("oidc.pkce.enabled", false)
 	viper.SetDefault("oidc.pkce.method", "S256")
+	viper.SetDefault("oidc.link_users_by_email", false)
+
+	viper.SetDefault("cluster.enabled", false)
+	viper.SetDefault("cluster.heartbeat_interval", "10s")
+
+	viper.SetDefault("backup.interval", "0s")
+	viper.SetDefault("backup.retention", 7)
+
+	viper.SetDefault("quota.max_nodes", 0)
+	viper.SetDefault("quota.max_ephemeral_nodes", 0)
+	viper.SetDefault("quota.max_pre_auth_keys", 0)
+	viper.SetDefault("quota.max_routes", 0)
+
+	viper.SetDefault("registration_approval.enabled", false)
+	viper.SetDefault("registration_approval.oidc_admin_claim", "groups")
 
 	viper.SetDefault("logtail.enabled", false)
 	viper.SetDefault("randomize_client_port", false)
@@ -328,8 +522,10 @@ func LoadConfig(path string, isFile bool) error {
 	viper.SetDefault("ephemeral_node_inactivity_timeout", "120s")
 
 	viper.SetDefault("tuning.notifier_send_timeout", "800ms")
+	viper.SetDefault("tuning.notifier_queue_size", 1000)
 	viper.SetDefault("tuning.batch_change_delay", "800ms")
 	viper.SetDefault("tuning.node_mapsession_buffered_chan_size", 30)
+	viper.SetDefault("tuning.node_store_persist_interval", "1s")
 
 	viper.SetDefault("prefixes.allocation", string(IPAllocationStrategySequential))
 
@@ -369,7 +565,7 @@ func validateServerConfig() error {
 	depr.fatal("oidc.map_legacy_users")
 
 	if viper.GetBool("oidc.enabled") {
-		if err := validatePKCEMethod(viper.GetString("oidc.pkce.method")); err != nil {
+		if err := ValidatePKCEMethod(viper.GetString("oidc.pkce.method")); err != nil {
 			return err
 		}
 	}
@@ -420,6 +616,39 @@ func validateServerConfig() error {
 		)
 	}
 
+	if viper.GetBool("cluster.enabled") {
+		if viper.GetString("database.type") != DatabasePostgres {
+			errorText += "Fatal config error: cluster requires database.type to be postgres\n"
+		}
+
+		if viper.GetDuration("cluster.heartbeat_interval") <= 0 {
+			errorText += "Fatal config error: cluster.heartbeat_interval must be positive\n"
+		}
+	}
+
+	if viper.GetDuration("backup.interval") < 0 {
+		errorText += "Fatal config error: backup.interval must not be negative\n"
+	}
+
+	if viper.GetDuration("backup.interval") > 0 && viper.GetString("backup.directory") == "" {
+		errorText += "Fatal config error: backup.directory must be set when backup.interval is set\n"
+	}
+
+	if viper.GetInt("backup.retention") < 0 {
+		errorText += "Fatal config error: backup.retention must not be negative\n"
+	}
+
+	for _, key := range []string{
+		"quota.max_nodes",
+		"quota.max_ephemeral_nodes",
+		"quota.max_pre_auth_keys",
+		"quota.max_routes",
+	} {
+		if viper.GetInt(key) < 0 {
+			errorText += fmt.Sprintf("Fatal config error: %s must not be negative\n", key)
+		}
+	}
+
 	if viper.GetBool("dns.override_local_dns") {
 		if global := viper.GetStringSlice("dns.nameservers.global"); len(global) == 0 {
 			errorText += "Fatal config error: dns.nameservers.global must be set when dns.override_local_dns is true\n"
@@ -823,7 +1052,6 @@ func LoadServerConfig() (*Config, error) {
 	}
 
 	logConfig := logConfig()
-	zerolog.SetGlobalLevel(logConfig.Level)
 
 	prefix4, err := prefixV4()
 	if err != nil {
@@ -877,6 +1105,11 @@ func LoadServerConfig() (*Config, error) {
 		oidcClientSecret = strings.TrimSpace(string(secretBytes))
 	}
 
+	workloadIdentity, err := workloadIdentityConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	serverURL := viper.GetString("server_url")
 
 	// BaseDomain cannot be the same as the server URL.
@@ -887,7 +1120,7 @@ func LoadServerConfig() (*Config, error) {
 	// - Control plane runs on login.tailscale.com/controlplane.tailscale.com
 	// - MagicDNS (BaseDomain) for users is on a *.ts.net domain per tailnet (e.g. tail-scale.ts.net)
 	if dnsConfig.BaseDomain != "" {
-		if err := isSafeServerURL(serverURL, dnsConfig.BaseDomain); err != nil {
+		if err := IsSafeServerURL(serverURL, dnsConfig.BaseDomain); err != nil {
 			return nil, err
 		}
 	}
@@ -960,6 +1193,36 @@ func LoadServerConfig() (*Config, error) {
 				Enabled: viper.GetBool("oidc.pkce.enabled"),
 				Method:  viper.GetString("oidc.pkce.method"),
 			},
+			LinkUsersByEmail: viper.GetBool("oidc.link_users_by_email"),
+		},
+
+		Cluster: ClusterConfig{
+			Enabled:           viper.GetBool("cluster.enabled"),
+			InstanceID:        viper.GetString("cluster.instance_id"),
+			HeartbeatInterval: viper.GetDuration("cluster.heartbeat_interval"),
+		},
+
+		Backup: BackupConfig{
+			Interval: viper.GetDuration("backup.interval"),
+			Directory: util.AbsolutePathFromConfigPath(
+				viper.GetString("backup.directory"),
+			),
+			Retention: viper.GetInt("backup.retention"),
+		},
+
+		Quota: Quota{
+			MaxNodes:          viper.GetInt("quota.max_nodes"),
+			MaxEphemeralNodes: viper.GetInt("quota.max_ephemeral_nodes"),
+			MaxPreAuthKeys:    viper.GetInt("quota.max_pre_auth_keys"),
+			MaxRoutes:         viper.GetInt("quota.max_routes"),
+		},
+
+		WorkloadIdentity: workloadIdentity,
+
+		RegistrationApproval: RegistrationApprovalConfig{
+			Enabled:         viper.GetBool("registration_approval.enabled"),
+			OIDCAdminClaim:  viper.GetString("registration_approval.oidc_admin_claim"),
+			OIDCAdminValues: viper.GetStringSlice("registration_approval.oidc_admin_values"),
 		},
 
 		LogTail:             logTailConfig,
@@ -979,22 +1242,32 @@ func LoadServerConfig() (*Config, error) {
 		// TODO(kradalby): Document these settings when more stable
 		Tuning: Tuning{
 			NotifierSendTimeout: viper.GetDuration("tuning.notifier_send_timeout"),
+			NotifierQueueSize:   viper.GetInt("tuning.notifier_queue_size"),
 			BatchChangeDelay:    viper.GetDuration("tuning.batch_change_delay"),
 			NodeMapSessionBufferedChanSize: viper.GetInt(
 				"tuning.node_mapsession_buffered_chan_size",
 			),
+			NodeStorePersistInterval: viper.GetDuration(
+				"tuning.node_store_persist_interval",
+			),
+		},
+
+		Debug: DebugConfig{
+			Profiling:     envknob.Bool("HEADSCALE_DEBUG_PROFILING_ENABLED"),
+			ProfilingPath: envknob.String("HEADSCALE_DEBUG_PROFILING_PATH"),
+			DumpConfig:    envknob.Bool("HEADSCALE_DEBUG_DUMP_CONFIG"),
 		},
 	}, nil
 }
 
-// BaseDomain cannot be a suffix of the server URL.
+// IsSafeServerURL checks that BaseDomain is not a suffix of the server URL.
 // This is because Tailscale takes over the domain in BaseDomain,
 // causing the headscale server and DERP to be unreachable.
 // For Tailscale upstream, the following is true:
 // - DERP run on their own domains.
 // - Control plane runs on login.tailscale.com/controlplane.tailscale.com.
 // - MagicDNS (BaseDomain) for users is on a *.ts.net domain per tailnet (e.g. tail-scale.ts.net).
-func isSafeServerURL(serverURL, baseDomain string) error {
+func IsSafeServerURL(serverURL, baseDomain string) error {
 	server, err := url.Parse(serverURL)
 	if err != nil {
 		return err
@@ -456,7 +456,7 @@ func TestSafeServerURL(t *testing.T) {
 	for _, tt := range tests {
 		testName := fmt.Sprintf("server=%s domain=%s", tt.serverURL, tt.baseDomain)
 		t.Run(testName, func(t *testing.T) {
-			err := isSafeServerURL(tt.serverURL, tt.baseDomain)
+			err := IsSafeServerURL(tt.serverURL, tt.baseDomain)
 			if tt.wantErr != "" {
 				assert.EqualError(t, err, tt.wantErr)
 
@@ -466,3 +466,31 @@ func TestSafeServerURL(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkloadIdentityIssuerValidate(t *testing.T) {
+	valid := func() WorkloadIdentityIssuer {
+		return WorkloadIdentityIssuer{
+			Issuer:   "https://token.actions.githubusercontent.com",
+			Audience: "headscale",
+			Subject:  "repo:example/infra:*",
+			User:     "ci",
+			Tags:     []string{"tag:ci"},
+		}
+	}
+
+	issuer := valid()
+	require.NoError(t, issuer.Validate())
+
+	issuer = valid()
+	issuer.Subject = ""
+	issuer.Claims = map[string]string{"repository_owner": "example"}
+	require.NoError(t, issuer.Validate())
+
+	issuer = valid()
+	issuer.Subject = ""
+	assert.ErrorContains(t, issuer.Validate(), "a subject or claims are required")
+
+	issuer = valid()
+	issuer.Tags = []string{"ci"}
+	assert.Error(t, issuer.Validate())
+}
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"tailscale.com/tailcfg"
+)
+
+var ErrDNSRecordInvalid = errors.New("invalid DNS record")
+
+// DNSRecord is an extra DNS record managed through the API. The records are
+// served to the nodes in addition to the extra records of the configuration.
+type DNSRecord struct {
+	ID    uint64 `gorm:"primary_key"`
+	Name  string `gorm:"uniqueIndex:idx_dns_records_name_type_value"`
+	Type  string `gorm:"uniqueIndex:idx_dns_records_name_type_value"`
+	Value string `gorm:"uniqueIndex:idx_dns_records_name_type_value"`
+}
+
+// Validate returns an error if the record is not an A or AAAA record with
+// an address of the same family as its value.
+func (r DNSRecord) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("%w: name is empty", ErrDNSRecordInvalid)
+	}
+
+	addr, err := netip.ParseAddr(r.Value)
+	if err != nil {
+		return fmt.Errorf("%w: %s: value %q is not an IP address", ErrDNSRecordInvalid, r.Name, r.Value)
+	}
+
+	switch r.Type {
+	case "A":
+		if !addr.Is4() {
+			return fmt.Errorf("%w: %s: A record with IPv6 address %s", ErrDNSRecordInvalid, r.Name, r.Value)
+		}
+	case "AAAA":
+		if !addr.Is6() {
+			return fmt.Errorf("%w: %s: AAAA record with IPv4 address %s", ErrDNSRecordInvalid, r.Name, r.Value)
+		}
+	default:
+		return fmt.Errorf("%w: %s: type %q is not A or AAAA", ErrDNSRecordInvalid, r.Name, r.Type)
+	}
+
+	return nil
+}
+
+func (r DNSRecord) Tailcfg() tailcfg.DNSRecord {
+	return tailcfg.DNSRecord{
+		Name:  r.Name,
+		Type:  r.Type,
+		Value: r.Value,
+	}
+}
+
+func (r DNSRecord) Proto() *v1.DNSRecord {
+	return &v1.DNSRecord{
+		Name:  r.Name,
+		Type:  r.Type,
+		Value: r.Value,
+	}
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// Hooks are the extension points for applications embedding Headscale.
+// All of them are optional.
+//
+// The lifecycle callbacks are called synchronously, from the goroutine
+// making the change, so they must return quickly and must not call back
+// into Headscale.
+type Hooks struct {
+	// Registration is asked to admit every new node before it is
+	// registered.
+	Registration RegistrationHook
+
+	// NodeAdded is called after a node has been registered.
+	NodeAdded func(node *v1.Node)
+
+	// NodeRemoved is called after a node has been deleted, including
+	// ephemeral nodes removed after being disconnected.
+	NodeRemoved func(node *v1.Node)
+
+	// NodeOnline and NodeOffline are called when a node connects to, or
+	// disconnects from, the control plane.
+	NodeOnline  func(node *v1.Node)
+	NodeOffline func(node *v1.Node)
+
+	// PolicyChanged is called with the new policy when the ACL policy
+	// has been changed, through the API or by reloading the policy file.
+	PolicyChanged func(policy string)
+}
+
+// RegistrationRequest describes a node asking to be registered, as seen
+// by a RegistrationHook.
+type RegistrationRequest struct {
+	MachineKey key.MachinePublic
+	NodeKey    key.NodePublic
+	Hostinfo   *tailcfg.Hostinfo
+
+	// User is the user the node will be registered to.
+	User *v1.User
+
+	// AuthMethod is how the node authenticated, one of "authkey",
+	// "oidc" or "cli".
+	AuthMethod string
+
+	// Hostname, Tags and Expiry are what the node would be registered
+	// with if the hook does not change them.
+	Hostname string
+	Tags     []string
+	Expiry   *time.Time
+}
+
+// RegistrationDecision is the answer of a RegistrationHook. A nil decision
+// admits the node unchanged.
+type RegistrationDecision struct {
+	// Deny rejects the registration, Reason is sent back to the client.
+	Deny   bool
+	Reason string
+
+	// Hostname replaces the hostname of the node, if set.
+	Hostname string
+
+	// Tags replaces the forced tags of the node, if not nil.
+	Tags []string
+
+	// Expiry replaces the expiry of the node, if set.
+	Expiry *time.Time
+}
+
+// RegistrationHook decides whether a new node may be registered, and can
+// change how it is registered. Returning an error fails the registration.
+type RegistrationHook interface {
+	AdmitRegistration(ctx context.Context, req *RegistrationRequest) (*RegistrationDecision, error)
+}
+
+// RegistrationHookFunc adapts a function to a RegistrationHook.
+type RegistrationHookFunc func(ctx context.Context, req *RegistrationRequest) (*RegistrationDecision, error)
+
+// AdmitRegistration calls f(ctx, req).
+func (f RegistrationHookFunc) AdmitRegistration(ctx context.Context, req *RegistrationRequest) (*RegistrationDecision, error) {
+	return f(ctx, req)
+}
@@ -0,0 +1,97 @@
+package types
+
+import (
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Statuses of an Invite.
+const (
+	InviteStatusPending  = "pending"
+	InviteStatusAccepted = "accepted"
+	InviteStatusRevoked  = "revoked"
+	InviteStatusExpired  = "expired"
+)
+
+// Invite is a one-time link to onboard a user. Opening it lets the
+// invited person log in with OIDC, or creates a local user, and gives them
+// a pre-auth key with the tags of the invite.
+type Invite struct {
+	ID     uint64 `gorm:"primary_key"`
+	Prefix string `gorm:"uniqueIndex"`
+	Hash   []byte
+
+	// Email is the email of the invited person. An OIDC login accepting
+	// the invite must have this verified email, a local user is created
+	// with it.
+	Email string
+	Tags  []string `gorm:"serializer:json"`
+
+	CreatedAt  *time.Time
+	Expiration *time.Time
+	RevokedAt  *time.Time
+
+	// AcceptedAt, UserID and PreAuthKeyID are set when the invite is
+	// accepted, to the user it was accepted as and the key given to them.
+	AcceptedAt   *time.Time
+	UserID       *uint
+	PreAuthKeyID *uint64
+}
+
+// IsExpired returns whether the Invite has expired.
+func (i *Invite) IsExpired() bool {
+	return i.Expiration != nil && !i.Expiration.IsZero() && i.Expiration.Before(time.Now())
+}
+
+// Status returns whether the Invite is pending, accepted, revoked or
+// expired.
+func (i *Invite) Status() string {
+	switch {
+	case i.RevokedAt != nil:
+		return InviteStatusRevoked
+	case i.AcceptedAt != nil:
+		return InviteStatusAccepted
+	case i.IsExpired():
+		return InviteStatusExpired
+	default:
+		return InviteStatusPending
+	}
+}
+
+func (i *Invite) Proto() *v1.Invite {
+	protoInvite := v1.Invite{
+		Id:     i.ID,
+		Prefix: i.Prefix,
+		Email:  i.Email,
+		Tags:   i.Tags,
+		Status: i.Status(),
+	}
+
+	if i.CreatedAt != nil {
+		protoInvite.CreatedAt = timestamppb.New(*i.CreatedAt)
+	}
+
+	if i.Expiration != nil {
+		protoInvite.Expiration = timestamppb.New(*i.Expiration)
+	}
+
+	if i.AcceptedAt != nil {
+		protoInvite.AcceptedAt = timestamppb.New(*i.AcceptedAt)
+	}
+
+	if i.RevokedAt != nil {
+		protoInvite.RevokedAt = timestamppb.New(*i.RevokedAt)
+	}
+
+	if i.UserID != nil {
+		protoInvite.UserId = uint64(*i.UserID)
+	}
+
+	if i.PreAuthKeyID != nil {
+		protoInvite.PreAuthKeyId = *i.PreAuthKeyID
+	}
+
+	return &protoInvite
+}
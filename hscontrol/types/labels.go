@@ -0,0 +1,33 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var ErrNodeLabelInvalid = errors.New("invalid node label")
+
+var (
+	// nodeLabelKeyRegex matches label keys: 1 to 63 letters, digits,
+	// '-', '_', '.' and '/', starting and ending with a letter or digit.
+	nodeLabelKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._/-]{0,61}[a-zA-Z0-9])?$`)
+
+	// nodeLabelValueRegex matches label values, which can be used in
+	// node filters without quoting.
+	nodeLabelValueRegex = regexp.MustCompile(`^[a-zA-Z0-9._:/@-]{0,255}$`)
+)
+
+// ValidateNodeLabel returns an error if the key or value of a node label
+// is invalid.
+func ValidateNodeLabel(key, value string) error {
+	if !nodeLabelKeyRegex.MatchString(key) {
+		return fmt.Errorf("%w: key %q must be 1 to 63 letters, digits, '-', '_', '.' or '/', starting and ending with a letter or digit", ErrNodeLabelInvalid, key)
+	}
+
+	if !nodeLabelValueRegex.MatchString(value) {
+		return fmt.Errorf("%w: value %q of %q must be up to 255 letters, digits, '-', '_', '.', ':', '/' or '@'", ErrNodeLabelInvalid, value, key)
+	}
+
+	return nil
+}
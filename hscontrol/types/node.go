@@ -87,6 +87,10 @@ type Node struct {
 	// ForcedTags are _always_ applied to the node.
 	ForcedTags []string `gorm:"column:forced_tags;serializer:json"`
 
+	// Labels are arbitrary key/value pairs set by CLI/API, to organise
+	// and filter nodes. They have no effect on the network.
+	Labels map[string]string `gorm:"column:labels;serializer:json"`
+
 	// When a node has been created with a PreAuthKey, we need to
 	// prevent the preauthkey from being deleted before the node.
 	// The preauthkey can define "tags" of the node so we need it
@@ -94,6 +98,10 @@ type Node struct {
 	AuthKeyID *uint64 `sql:"DEFAULT:NULL"`
 	AuthKey   *PreAuthKey
 
+	// Ephemeral is set for ephemeral nodes registered without a
+	// PreAuthKey, with a workload identity token.
+	Ephemeral bool `gorm:"default:false"`
+
 	Expiry *time.Time
 
 	// LastSeen is when the node was last in contact with
@@ -135,7 +143,7 @@ func (node Node) IsExpired() bool {
 // IsEphemeral returns if the node is registered as an Ephemeral node.
 // https://tailscale.com/kb/1111/ephemeral-nodes/
 func (node *Node) IsEphemeral() bool {
-	return node.AuthKey != nil && node.AuthKey.Ephemeral
+	return node.Ephemeral || (node.AuthKey != nil && node.AuthKey.Ephemeral)
 }
 
 func (node *Node) IPs() []netip.Addr {
@@ -342,6 +350,7 @@ func (node *Node) Proto() *v1.Node {
 		GivenName:   node.GivenName,
 		User:        node.User.Proto(),
 		ForcedTags:  node.ForcedTags,
+		Labels:      node.Labels,
 
 		// Only ApprovedRoutes and AvailableRoutes is set here. SubnetRoutes has
 		// to be populated manually with PrimaryRoute, to ensure it includes the
@@ -354,6 +363,11 @@ func (node *Node) Proto() *v1.Node {
 		CreatedAt: timestamppb.New(node.CreatedAt),
 	}
 
+	if node.Hostinfo != nil {
+		nodeProto.Os = node.Hostinfo.OS
+		nodeProto.ClientVersion = node.Hostinfo.IPNVersion
+	}
+
 	if node.AuthKey != nil {
 		nodeProto.PreAuthKey = node.AuthKey.Proto()
 	}
@@ -481,6 +495,8 @@ func (node *Node) RegisterMethodToV1Enum() v1.RegisterMethod {
 		return v1.RegisterMethod_REGISTER_METHOD_OIDC
 	case "cli":
 		return v1.RegisterMethod_REGISTER_METHOD_CLI
+	case "workload_identity":
+		return v1.RegisterMethod_REGISTER_METHOD_WORKLOAD_IDENTITY
 	default:
 		return v1.RegisterMethod_REGISTER_METHOD_UNSPECIFIED
 	}
@@ -560,6 +576,16 @@ func (nodes Nodes) IDMap() map[NodeID]*Node {
 	return ret
 }
 
+func (nodes Nodes) IDs() []NodeID {
+	ret := make([]NodeID, len(nodes))
+
+	for index, node := range nodes {
+		ret[index] = node.ID
+	}
+
+	return ret
+}
+
 func (nodes Nodes) DebugString() string {
 	var sb strings.Builder
 	sb.WriteString("Nodes:\n")
@@ -0,0 +1,115 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Scopes an OAuthClient can be granted. Every scope also has a read-only
+// variant, suffixed with OAuthScopeReadSuffix, and a scope grants its
+// read-only variant.
+const (
+	OAuthScopeAll      = "all"
+	OAuthScopeUsers    = "users"
+	OAuthScopeNodes    = "nodes"
+	OAuthScopeAuthKeys = "auth_keys"
+	OAuthScopePolicy   = "policy"
+
+	OAuthScopeReadSuffix = ":read"
+)
+
+var oauthScopes = []string{
+	OAuthScopeAll,
+	OAuthScopeUsers,
+	OAuthScopeNodes,
+	OAuthScopeAuthKeys,
+	OAuthScopePolicy,
+}
+
+var ErrOAuthScopeInvalid = errors.New("invalid OAuth scope")
+
+// OAuthClient describes an OAuth 2.0 client, which exchanges its client ID
+// and secret for short-lived access tokens to the API.
+type OAuthClient struct {
+	ID       uint64 `gorm:"primary_key"`
+	ClientID string `gorm:"uniqueIndex"`
+	Hash     []byte
+
+	// Scopes are the parts of the API the client can access.
+	Scopes []string `gorm:"serializer:json"`
+
+	// Tags are the tags the client can give to the pre-auth keys it
+	// creates.
+	Tags []string `gorm:"serializer:json"`
+
+	Description string
+
+	CreatedAt  *time.Time
+	Expiration *time.Time
+	LastSeen   *time.Time
+}
+
+// ValidateOAuthScopes returns an error if one of the scopes is unknown.
+func ValidateOAuthScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(oauthScopes, strings.TrimSuffix(scope, OAuthScopeReadSuffix)) {
+			return fmt.Errorf("%w: %q", ErrOAuthScopeInvalid, scope)
+		}
+	}
+
+	return nil
+}
+
+// OAuthScopesAllow reports whether the granted scopes include the required
+// scope.
+func OAuthScopesAllow(granted []string, required string) bool {
+	base, readOnly := strings.CutSuffix(required, OAuthScopeReadSuffix)
+
+	for _, scope := range granted {
+		switch scope {
+		case required, OAuthScopeAll, base:
+			return true
+		case OAuthScopeAll + OAuthScopeReadSuffix:
+			if readOnly {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsExpired returns whether the OAuthClient has expired.
+func (c *OAuthClient) IsExpired() bool {
+	return c.Expiration != nil && !c.Expiration.IsZero() && c.Expiration.Before(time.Now())
+}
+
+func (c *OAuthClient) Proto() *v1.OAuthClient {
+	protoClient := v1.OAuthClient{
+		Id:          c.ID,
+		ClientId:    c.ClientID,
+		Scopes:      c.Scopes,
+		Tags:        c.Tags,
+		Description: c.Description,
+	}
+
+	if c.Expiration != nil {
+		protoClient.Expiration = timestamppb.New(*c.Expiration)
+	}
+
+	if c.CreatedAt != nil {
+		protoClient.CreatedAt = timestamppb.New(*c.CreatedAt)
+	}
+
+	if c.LastSeen != nil {
+		protoClient.LastSeen = timestamppb.New(*c.LastSeen)
+	}
+
+	return &protoClient
+}
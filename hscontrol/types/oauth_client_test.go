@@ -0,0 +1,77 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuthScopesAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required string
+		want     bool
+	}{
+		{
+			name:     "same-scope",
+			granted:  []string{"nodes"},
+			required: "nodes",
+			want:     true,
+		},
+		{
+			name:     "write-grants-read",
+			granted:  []string{"nodes"},
+			required: "nodes:read",
+			want:     true,
+		},
+		{
+			name:     "read-does-not-grant-write",
+			granted:  []string{"nodes:read"},
+			required: "nodes",
+			want:     false,
+		},
+		{
+			name:     "other-scope",
+			granted:  []string{"users", "policy"},
+			required: "nodes:read",
+			want:     false,
+		},
+		{
+			name:     "all",
+			granted:  []string{"all"},
+			required: "auth_keys",
+			want:     true,
+		},
+		{
+			name:     "all-read",
+			granted:  []string{"all:read"},
+			required: "policy:read",
+			want:     true,
+		},
+		{
+			name:     "all-read-does-not-grant-write",
+			granted:  []string{"all:read"},
+			required: "policy",
+			want:     false,
+		},
+		{
+			name:     "none",
+			granted:  nil,
+			required: "users:read",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, OAuthScopesAllow(tt.granted, tt.required))
+		})
+	}
+}
+
+func TestValidateOAuthScopes(t *testing.T) {
+	assert.NoError(t, ValidateOAuthScopes([]string{"all", "nodes:read", "auth_keys", "policy:read"}))
+	assert.ErrorIs(t, ValidateOAuthScopes([]string{"devices"}), ErrOAuthScopeInvalid)
+	assert.ErrorIs(t, ValidateOAuthScopes([]string{"nodes:write"}), ErrOAuthScopeInvalid)
+}
@@ -1,41 +1,149 @@
 package types
 
 import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
 	"time"
 
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"tailscale.com/tailcfg"
+)
+
+var (
+	ErrPreAuthKeyHostnameNotAllowed = errors.New("hostname not allowed by authkey")
+	ErrPreAuthKeyOSNotAllowed       = errors.New("operating system not allowed by authkey")
 )
 
 // PreAuthKey describes a pre-authorization key usable in a particular user.
 type PreAuthKey struct {
-	ID        uint64 `gorm:"primary_key"`
-	Key       string
+	ID uint64 `gorm:"primary_key"`
+
+	// Prefix is the first characters of the key, used to look it up,
+	// the rest of the key is only stored hashed.
+	Prefix string `gorm:"uniqueIndex"`
+	Hash   []byte
+
+	// Key is the full key, it is only known when the key is created.
+	Key string `gorm:"-"`
+
 	UserID    uint
 	User      User `gorm:"constraint:OnDelete:SET NULL;"`
 	Reusable  bool
 	Ephemeral bool `gorm:"default:false"`
 	Used      bool `gorm:"default:false"`
 
+	Description string
+
+	// MaxUses is the number of nodes the key can register, whether it is
+	// reusable or not. Zero means once for keys that are not reusable,
+	// and without limit for reusable keys.
+	MaxUses  uint `gorm:"default:0"`
+	UseCount uint `gorm:"default:0"`
+
 	// Tags are always applied to the node and is one of
 	// the sources of tags a node might have. They are copied
 	// from the PreAuthKey when the node logs in the first time,
 	// and ignored after.
 	Tags []string `gorm:"serializer:json"`
 
+	Constraints PreAuthKeyConstraints `gorm:"embedded;embeddedPrefix:constraint_"`
+
 	CreatedAt  *time.Time
 	Expiration *time.Time
 }
 
+// PreAuthKeyConstraints limit which nodes can register with a PreAuthKey,
+// and how they are registered.
+type PreAuthKeyConstraints struct {
+	// HostnamePattern is a glob, as understood by path.Match, that the
+	// hostname of the node must match.
+	HostnamePattern string
+
+	// AllowedOS is the list of operating systems the node may run, as
+	// reported in its Hostinfo, e.g. "linux".
+	AllowedOS []string `gorm:"serializer:json"`
+
+	// NodeExpiry is the longest a node registered with the key is valid,
+	// before it has to log in again.
+	NodeExpiry time.Duration
+
+	// ApprovedRoutes are approved for the node when it registers.
+	ApprovedRoutes []netip.Prefix `gorm:"serializer:json"`
+}
+
+// Validate returns an error if the constraints can not be checked.
+func (c *PreAuthKeyConstraints) Validate() error {
+	if _, err := path.Match(c.HostnamePattern, ""); err != nil {
+		return fmt.Errorf("invalid hostname pattern %q: %w", c.HostnamePattern, err)
+	}
+
+	if c.NodeExpiry < 0 {
+		return fmt.Errorf("node expiry must not be negative, got %s", c.NodeExpiry)
+	}
+
+	return nil
+}
+
+// Allows returns an error if a node with the given Hostinfo does not meet
+// the constraints.
+func (c *PreAuthKeyConstraints) Allows(hostinfo *tailcfg.Hostinfo) error {
+	if hostinfo == nil {
+		hostinfo = &tailcfg.Hostinfo{}
+	}
+
+	if c.HostnamePattern != "" {
+		match, _ := path.Match(strings.ToLower(c.HostnamePattern), strings.ToLower(hostinfo.Hostname))
+		if !match {
+			return fmt.Errorf("%w: %q does not match %q", ErrPreAuthKeyHostnameNotAllowed, hostinfo.Hostname, c.HostnamePattern)
+		}
+	}
+
+	if len(c.AllowedOS) > 0 && !slices.ContainsFunc(c.AllowedOS, func(os string) bool {
+		return strings.EqualFold(os, hostinfo.OS)
+	}) {
+		return fmt.Errorf("%w: %q", ErrPreAuthKeyOSNotAllowed, hostinfo.OS)
+	}
+
+	return nil
+}
+
+func (c *PreAuthKeyConstraints) Proto() *v1.PreAuthKeyConstraints {
+	protoConstraints := v1.PreAuthKeyConstraints{
+		HostnamePattern: c.HostnamePattern,
+		AllowedOs:       c.AllowedOS,
+	}
+
+	if c.NodeExpiry != 0 {
+		protoConstraints.NodeExpiry = durationpb.New(c.NodeExpiry)
+	}
+
+	for _, route := range c.ApprovedRoutes {
+		protoConstraints.ApprovedRoutes = append(protoConstraints.ApprovedRoutes, route.String())
+	}
+
+	return &protoConstraints
+}
+
 func (key *PreAuthKey) Proto() *v1.PreAuthKey {
 	protoKey := v1.PreAuthKey{
-		User:      key.User.Proto(),
-		Id:        key.ID,
-		Key:       key.Key,
-		Ephemeral: key.Ephemeral,
-		Reusable:  key.Reusable,
-		Used:      key.Used,
-		AclTags:   key.Tags,
+		User:        key.User.Proto(),
+		Id:          key.ID,
+		Key:         key.Key,
+		Prefix:      key.Prefix,
+		Ephemeral:   key.Ephemeral,
+		Reusable:    key.Reusable,
+		Used:        key.Used,
+		AclTags:     key.Tags,
+		Description: key.Description,
+		MaxUses:     uint32(key.MaxUses),
+		UseCount:    uint32(key.UseCount),
+		Constraints: key.Constraints.Proto(),
 	}
 
 	if key.Expiration != nil {
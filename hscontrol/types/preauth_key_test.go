@@ -0,0 +1,67 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+)
+
+func TestPreAuthKeyConstraintsAllows(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraints PreAuthKeyConstraints
+		hostinfo    *tailcfg.Hostinfo
+		wantErr     error
+	}{
+		{
+			name:     "no-constraints",
+			hostinfo: &tailcfg.Hostinfo{Hostname: "anything", OS: "windows"},
+		},
+		{
+			name:        "hostname-matches",
+			constraints: PreAuthKeyConstraints{HostnamePattern: "web-*"},
+			hostinfo:    &tailcfg.Hostinfo{Hostname: "Web-01"},
+		},
+		{
+			name:        "hostname-does-not-match",
+			constraints: PreAuthKeyConstraints{HostnamePattern: "web-*"},
+			hostinfo:    &tailcfg.Hostinfo{Hostname: "db-01"},
+			wantErr:     ErrPreAuthKeyHostnameNotAllowed,
+		},
+		{
+			name:        "os-allowed",
+			constraints: PreAuthKeyConstraints{AllowedOS: []string{"linux", "windows"}},
+			hostinfo:    &tailcfg.Hostinfo{Hostname: "host", OS: "Linux"},
+		},
+		{
+			name:        "os-not-allowed",
+			constraints: PreAuthKeyConstraints{AllowedOS: []string{"linux"}},
+			hostinfo:    &tailcfg.Hostinfo{Hostname: "host", OS: "macOS"},
+			wantErr:     ErrPreAuthKeyOSNotAllowed,
+		},
+		{
+			name:        "no-hostinfo",
+			constraints: PreAuthKeyConstraints{AllowedOS: []string{"linux"}},
+			wantErr:     ErrPreAuthKeyOSNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.constraints.Allows(tt.hostinfo)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPreAuthKeyConstraintsValidate(t *testing.T) {
+	require.NoError(t, (&PreAuthKeyConstraints{HostnamePattern: "node-[0-9]*"}).Validate())
+	require.Error(t, (&PreAuthKeyConstraints{HostnamePattern: "node-[0-9"}).Validate())
+	require.Error(t, (&PreAuthKeyConstraints{NodeExpiry: -1}).Validate())
+}
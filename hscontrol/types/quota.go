@@ -0,0 +1,100 @@
+package types
+
+import (
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"tailscale.com/types/ptr"
+)
+
+// Quota limits the resources of a user. A limit of zero is unlimited.
+type Quota struct {
+	// MaxNodes is the number of nodes a user can have, ephemeral
+	// nodes included.
+	MaxNodes int
+
+	// MaxEphemeralNodes is the number of ephemeral nodes a user can have.
+	MaxEphemeralNodes int
+
+	// MaxPreAuthKeys is the number of pre auth keys of a user that can
+	// still be used.
+	MaxPreAuthKeys int
+
+	// MaxRoutes is the number of routes approved on the nodes of a user,
+	// an exit node counts as one route.
+	MaxRoutes int
+}
+
+// UserQuota overrides the default Quota for a user, limits that are not
+// set use the default.
+type UserQuota struct {
+	MaxNodes          *int
+	MaxEphemeralNodes *int
+	MaxPreAuthKeys    *int
+	MaxRoutes         *int
+}
+
+// QuotaUsage is how much of its Quota a user uses.
+type QuotaUsage struct {
+	Nodes          int
+	EphemeralNodes int
+	PreAuthKeys    int
+	Routes         int
+}
+
+// Override returns the quota with the limits set in o replaced.
+func (q Quota) Override(o UserQuota) Quota {
+	if o.MaxNodes != nil {
+		q.MaxNodes = *o.MaxNodes
+	}
+	if o.MaxEphemeralNodes != nil {
+		q.MaxEphemeralNodes = *o.MaxEphemeralNodes
+	}
+	if o.MaxPreAuthKeys != nil {
+		q.MaxPreAuthKeys = *o.MaxPreAuthKeys
+	}
+	if o.MaxRoutes != nil {
+		q.MaxRoutes = *o.MaxRoutes
+	}
+
+	return q
+}
+
+func (q Quota) Proto() *v1.QuotaLimits {
+	return &v1.QuotaLimits{
+		MaxNodes:          ptr.To(int32(q.MaxNodes)),
+		MaxEphemeralNodes: ptr.To(int32(q.MaxEphemeralNodes)),
+		MaxPreAuthKeys:    ptr.To(int32(q.MaxPreAuthKeys)),
+		MaxRoutes:         ptr.To(int32(q.MaxRoutes)),
+	}
+}
+
+// UserQuotaFromProto returns the UserQuota with the limits set in q.
+func UserQuotaFromProto(q *v1.QuotaLimits) UserQuota {
+	var uq UserQuota
+	if q == nil {
+		return uq
+	}
+
+	if q.MaxNodes != nil {
+		uq.MaxNodes = ptr.To(int(q.GetMaxNodes()))
+	}
+	if q.MaxEphemeralNodes != nil {
+		uq.MaxEphemeralNodes = ptr.To(int(q.GetMaxEphemeralNodes()))
+	}
+	if q.MaxPreAuthKeys != nil {
+		uq.MaxPreAuthKeys = ptr.To(int(q.GetMaxPreAuthKeys()))
+	}
+	if q.MaxRoutes != nil {
+		uq.MaxRoutes = ptr.To(int(q.GetMaxRoutes()))
+	}
+
+	return uq
+}
+
+func (u QuotaUsage) Proto() *v1.QuotaUsage {
+	return &v1.QuotaUsage{
+		Nodes:          int32(u.Nodes),
+		EphemeralNodes: int32(u.EphemeralNodes),
+		PreAuthKeys:    int32(u.PreAuthKeys),
+		Routes:         int32(u.Routes),
+	}
+}
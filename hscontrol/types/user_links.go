@@ -0,0 +1,44 @@
+package types
+
+import (
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// UserLinkMerge records a user merged into another with MergeUsers.
+	UserLinkMerge = "merge"
+
+	// UserLinkOIDCEmail records the first OIDC login of a user linked to
+	// an existing user with the same verified email.
+	UserLinkOIDCEmail = "oidc-email"
+)
+
+// UserLink records that another identity was linked to a user, so that
+// admins can tell how users were merged. The records are kept when the
+// user is deleted.
+type UserLink struct {
+	ID     uint64 `gorm:"primary_key"`
+	UserID uint   `gorm:"index"`
+	Kind   string
+
+	// Source is the identity linked to the user: the name and ID of the
+	// merged user, or the OIDC identifier of the login.
+	Source string
+	Email  string
+
+	CreatedAt time.Time
+}
+
+func (l *UserLink) Proto() *v1.UserLink {
+	return &v1.UserLink{
+		Id:        l.ID,
+		UserId:    uint64(l.UserID),
+		Kind:      l.Kind,
+		Source:    l.Source,
+		Email:     l.Email,
+		CreatedAt: timestamppb.New(l.CreatedAt),
+	}
+}
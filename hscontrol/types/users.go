@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
 	"github.com/juanfont/headscale/hscontrol/util"
@@ -68,6 +69,18 @@ type User struct {
 	Provider string
 
 	ProfilePicURL string
+
+	// DisabledAt is set when the user is disabled, the user cannot
+	// log in or register nodes until it is enabled again.
+	DisabledAt *time.Time
+
+	// Quota overrides the default quota for the user.
+	Quota UserQuota `gorm:"embedded;embeddedPrefix:quota_"`
+}
+
+// IsDisabled reports whether the user is disabled.
+func (u *User) IsDisabled() bool {
+	return u != nil && u.DisabledAt != nil
 }
 
 func (u *User) StringID() string {
@@ -137,6 +150,11 @@ func (u *User) TailscaleUserProfile() tailcfg.UserProfile {
 }
 
 func (u *User) Proto() *v1.User {
+	var disabledAt *timestamppb.Timestamp
+	if u.DisabledAt != nil {
+		disabledAt = timestamppb.New(*u.DisabledAt)
+	}
+
 	return &v1.User{
 		Id:            uint64(u.ID),
 		Name:          u.Name,
@@ -146,6 +164,7 @@ func (u *User) Proto() *v1.User {
 		ProviderId:    u.ProviderIdentifier.String,
 		Provider:      u.Provider,
 		ProfilePicUrl: u.ProfilePicURL,
+		DisabledAt:    disabledAt,
 	}
 }
 
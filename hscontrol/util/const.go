@@ -1,7 +1,8 @@
 package util
 
 const (
-	RegisterMethodAuthKey = "authkey"
-	RegisterMethodOIDC    = "oidc"
-	RegisterMethodCLI     = "cli"
+	RegisterMethodAuthKey          = "authkey"
+	RegisterMethodOIDC             = "oidc"
+	RegisterMethodCLI              = "cli"
+	RegisterMethodWorkloadIdentity = "workload_identity"
 )
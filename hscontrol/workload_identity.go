@@ -0,0 +1,262 @@
+package hscontrol
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/ptr"
+)
+
+const workloadIdentityHTTPTimeout = 10 * time.Second
+
+var errWorkloadIdentityNotAccepted = errors.New("workload identity token not accepted")
+
+// workloadIdentity verifies the OIDC tokens of workloads registering nodes
+// against the trusted issuers of the configuration.
+type workloadIdentity struct {
+	issuers []types.WorkloadIdentityIssuer
+
+	mu sync.Mutex
+	// verifiers are created when an issuer is first used, so headscale
+	// starts when an issuer can not be reached.
+	verifiers map[int]*oidc.IDTokenVerifier
+}
+
+func newWorkloadIdentity(cfg types.WorkloadIdentityConfig) *workloadIdentity {
+	return &workloadIdentity{
+		issuers:   cfg.Issuers,
+		verifiers: make(map[int]*oidc.IDTokenVerifier),
+	}
+}
+
+// isWorkloadIdentityToken reports whether an auth key is a JWT rather than a
+// pre auth key.
+func isWorkloadIdentityToken(authKey string) bool {
+	return strings.HasPrefix(authKey, "eyJ") && strings.Count(authKey, ".") == 2
+}
+
+func (w *workloadIdentity) verifier(index int) (*oidc.IDTokenVerifier, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if verifier, ok := w.verifiers[index]; ok {
+		return verifier, nil
+	}
+
+	issuer := w.issuers[index]
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: workloadIdentityHTTPTimeout})
+	config := &oidc.Config{ClientID: issuer.Audience}
+
+	var verifier *oidc.IDTokenVerifier
+	if issuer.JWKSURL != "" {
+		config.SupportedSigningAlgs = []string{
+			oidc.RS256, oidc.RS384, oidc.RS512,
+			oidc.ES256, oidc.ES384, oidc.ES512,
+			oidc.PS256, oidc.PS384, oidc.PS512,
+			oidc.EdDSA,
+		}
+		verifier = oidc.NewVerifier(issuer.Issuer, oidc.NewRemoteKeySet(ctx, issuer.JWKSURL), config)
+	} else {
+		provider, err := oidc.NewProvider(ctx, issuer.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("discovering workload identity issuer %q: %w", issuer.Issuer, err)
+		}
+		verifier = provider.Verifier(config)
+	}
+
+	w.verifiers[index] = verifier
+
+	return verifier, nil
+}
+
+// match returns the first issuer accepting the token, after checking its
+// signature, expiry and audience, and matching its claims.
+func (w *workloadIdentity) match(ctx context.Context, token string) (*types.WorkloadIdentityIssuer, error) {
+	iss, err := unverifiedIssuer(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// reason is why the last issuer did not accept the token.
+	reason := fmt.Errorf("no trusted issuer %q", iss)
+
+	for index, issuer := range w.issuers {
+		if issuer.Issuer != iss {
+			continue
+		}
+
+		verifier, err := w.verifier(index)
+		if err != nil {
+			return nil, err
+		}
+
+		idToken, err := verifier.Verify(ctx, token)
+		if err != nil {
+			reason = err
+
+			continue
+		}
+
+		var claims map[string]any
+		if err := idToken.Claims(&claims); err != nil {
+			return nil, fmt.Errorf("decoding workload identity claims: %w", err)
+		}
+
+		if matchWorkloadIdentityClaims(&issuer, idToken.Subject, claims) {
+			return &issuer, nil
+		}
+
+		reason = fmt.Errorf("claims of subject %q do not match", idToken.Subject)
+	}
+
+	return nil, fmt.Errorf("%w: %w", errWorkloadIdentityNotAccepted, reason)
+}
+
+// unverifiedIssuer returns the iss claim of a token, to find the issuers
+// to verify it with.
+func unverifiedIssuer(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errWorkloadIdentityNotAccepted
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errWorkloadIdentityNotAccepted
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errWorkloadIdentityNotAccepted
+	}
+
+	return claims.Issuer, nil
+}
+
+// matchWorkloadIdentityClaims reports whether the subject and claims of a
+// token match the patterns of the issuer.
+func matchWorkloadIdentityClaims(issuer *types.WorkloadIdentityIssuer, subject string, claims map[string]any) bool {
+	if issuer.Subject != "" && !matchClaimPattern(issuer.Subject, subject) {
+		return false
+	}
+
+	for name, pattern := range issuer.Claims {
+		value, ok := claims[name]
+		if !ok {
+			return false
+		}
+
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case bool, float64:
+			str = fmt.Sprint(v)
+		default:
+			return false
+		}
+
+		if !matchClaimPattern(pattern, str) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchClaimPattern matches a claim against a pattern, where "*" matches any
+// characters, including "/" and ":" found in subjects.
+func matchClaimPattern(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(value)
+}
+
+func (h *Headscale) handleRegisterWithWorkloadIdentity(
+	ctx context.Context,
+	regReq tailcfg.RegisterRequest,
+	machineKey key.MachinePublic,
+) (*tailcfg.RegisterResponse, error) {
+	issuer, err := h.workloadIdentity.match(ctx, regReq.Auth.AuthKey)
+	if err != nil {
+		if errors.Is(err, errWorkloadIdentityNotAccepted) {
+			return nil, NewHTTPError(http.StatusUnauthorized, errWorkloadIdentityNotAccepted.Error(), err)
+		}
+
+		return nil, err
+	}
+
+	user, err := h.db.GetUserByName(issuer.User)
+	if errors.Is(err, db.ErrUserNotFound) {
+		user, err = h.db.CreateUser(types.User{Name: issuer.User})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting workload identity user %q: %w", issuer.User, err)
+	}
+	if user.IsDisabled() {
+		return nil, NewHTTPError(http.StatusUnauthorized, "user is disabled", db.ErrUserDisabled)
+	}
+
+	nodeToRegister := types.Node{
+		Hostname:       regReq.Hostinfo.Hostname,
+		UserID:         user.ID,
+		User:           *user,
+		MachineKey:     machineKey,
+		NodeKey:        regReq.NodeKey,
+		Hostinfo:       regReq.Hostinfo,
+		LastSeen:       ptr.To(time.Now()),
+		RegisterMethod: util.RegisterMethodWorkloadIdentity,
+		ForcedTags:     issuer.Tags,
+		Ephemeral:      issuer.Ephemeral,
+	}
+
+	if !regReq.Expiry.IsZero() {
+		nodeToRegister.Expiry = &regReq.Expiry
+	}
+
+	if issuer.NodeExpiry > 0 {
+		expiry := time.Now().Add(issuer.NodeExpiry)
+		if nodeToRegister.Expiry == nil || nodeToRegister.Expiry.After(expiry) {
+			nodeToRegister.Expiry = &expiry
+		}
+	}
+
+	if err := h.hooks.admit(ctx, &nodeToRegister, user, util.RegisterMethodWorkloadIdentity); err != nil {
+		return nil, err
+	}
+
+	oldNode, _ := h.nodeStore.GetNodeByMachineKey(machineKey)
+	existing := oldNode != nil && oldNode.UserID == user.ID
+
+	node, err := h.registerNode(nodeToRegister, existing, func(*gorm.DB) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+
+	return &tailcfg.RegisterResponse{
+		MachineAuthorized: true,
+		NodeKeyExpired:    node.IsExpired(),
+		User:              *user.TailscaleUser(),
+		Login:             *user.TailscaleLogin(),
+	}, nil
+}
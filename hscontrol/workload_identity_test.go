@@ -0,0 +1,69 @@
+package hscontrol
+
+import (
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsWorkloadIdentityToken(t *testing.T) {
+	assert.True(t, isWorkloadIdentityToken("eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ4In0.c2ln"))
+	assert.False(t, isWorkloadIdentityToken("hskey-auth-abcdef-0123456789"))
+	assert.False(t, isWorkloadIdentityToken("0123456789abcdef0123456789abcdef0123456789abcdef"))
+	assert.False(t, isWorkloadIdentityToken("eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ4In0"))
+}
+
+func TestMatchClaimPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"repo:example/app:ref:refs/heads/main", "repo:example/app:ref:refs/heads/main", true},
+		{"repo:example/app:ref:refs/heads/main", "repo:example/app:ref:refs/heads/dev", false},
+		{"repo:example/*:ref:refs/heads/main", "repo:example/app:ref:refs/heads/main", true},
+		{"repo:example/*", "repo:example/app:ref:refs/tags/v1.0.0", true},
+		{"repo:example/*", "repo:other/app", false},
+		{"system:serviceaccount:ci:*", "system:serviceaccount:ci:runner", true},
+		{"a.b", "axb", false},
+		{"*", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchClaimPattern(tt.pattern, tt.value))
+		})
+	}
+}
+
+func TestMatchWorkloadIdentityClaims(t *testing.T) {
+	issuer := &types.WorkloadIdentityIssuer{
+		Subject: "repo:example/*",
+		Claims: map[string]string{
+			"environment":   "production",
+			"runner_hosted": "true",
+		},
+	}
+
+	claims := map[string]any{
+		"environment":   "production",
+		"runner_hosted": true,
+	}
+
+	assert.True(t, matchWorkloadIdentityClaims(issuer, "repo:example/app", claims))
+	assert.False(t, matchWorkloadIdentityClaims(issuer, "repo:other/app", claims))
+	assert.False(t, matchWorkloadIdentityClaims(issuer, "repo:example/app", map[string]any{
+		"environment":   "staging",
+		"runner_hosted": true,
+	}))
+	assert.False(t, matchWorkloadIdentityClaims(issuer, "repo:example/app", map[string]any{
+		"runner_hosted": true,
+	}))
+	assert.False(t, matchWorkloadIdentityClaims(issuer, "repo:example/app", map[string]any{
+		"environment":   []any{"production"},
+		"runner_hosted": true,
+	}))
+
+	assert.True(t, matchWorkloadIdentityClaims(&types.WorkloadIdentityIssuer{}, "anything", nil))
+}
@@ -321,9 +321,11 @@ func TestPreAuthKeyCommand(t *testing.T) {
 		},
 	)
 
-	assert.NotEmpty(t, listedPreAuthKeys[1].GetKey())
-	assert.NotEmpty(t, listedPreAuthKeys[2].GetKey())
-	assert.NotEmpty(t, listedPreAuthKeys[3].GetKey())
+	// Only the prefix of a key is shown after it has been created.
+	for index := 1; index < 4; index++ {
+		assert.Empty(t, listedPreAuthKeys[index].GetKey())
+		assert.Equal(t, keys[index-1].GetKey()[:12], listedPreAuthKeys[index].GetPrefix())
+	}
 
 	assert.True(t, listedPreAuthKeys[1].GetExpiration().AsTime().After(time.Now()))
 	assert.True(t, listedPreAuthKeys[2].GetExpiration().AsTime().After(time.Now()))
@@ -358,7 +360,7 @@ func TestPreAuthKeyCommand(t *testing.T) {
 			"--user",
 			"1",
 			"expire",
-			listedPreAuthKeys[1].GetKey(),
+			listedPreAuthKeys[1].GetPrefix(),
 		},
 	)
 	assertNoErr(t, err)
@@ -3,17 +3,35 @@ package controlplane
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// Errors returned by the client, wrapping the gRPC error of the server.
+// Use errors.Is to check for them.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrUnavailable      = errors.New("unavailable")
+)
+
 // client implements the ControlPlaneClient interface
 type client struct {
 	conn   *grpc.ClientConn
@@ -27,30 +45,63 @@ func NewClient(config *ClientConfig) (ControlPlaneClient, error) {
 		config = DefaultClientConfig()
 	}
 
-	// Set up connection options
-	var opts []grpc.DialOption
-
-	if config.Insecure {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	creds, err := transportCredentials(config)
+	if err != nil {
+		return nil, err
 	}
 
-	// Set timeout
-	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
-	defer cancel()
-
-	// Connect to the server
-	conn, err := grpc.DialContext(ctx, config.Address, opts...)
+	// Connect to the server, the connection is established on the first call
+	conn, err := grpc.NewClient(config.Address, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to headscale server at %s: %w", config.Address, err)
 	}
 
+	return newClient(conn, config), nil
+}
+
+// newClient creates a control plane client using an established connection
+func newClient(conn *grpc.ClientConn, config *ClientConfig) *client {
 	return &client{
 		conn:   conn,
 		client: v1.NewHeadscaleServiceClient(conn),
 		config: config,
-	}, nil
+	}
+}
+
+// transportCredentials returns the credentials used to connect to the server.
+// Unix sockets are local and always used without TLS.
+func transportCredentials(config *ClientConfig) (credentials.TransportCredentials, error) {
+	if config.Insecure || strings.HasPrefix(config.Address, "unix:") {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.ServerName,
+	}
+
+	if config.CACertPath != "" {
+		caCert, err := os.ReadFile(config.CACertPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA certificate %s", config.CACertPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ClientCertPath != "" || config.ClientKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(config.ClientCertPath, config.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
 }
 
 // Close closes the client connection
@@ -69,12 +120,99 @@ func (c *client) getContext(ctx context.Context) context.Context {
 	return ctx
 }
 
+// call runs fn with the API key and the timeout of the client. Idempotent
+// calls are retried with backoff on transient failures, as configured in
+// ClientConfig.Retry.
+func call[T any](ctx context.Context, c *client, idempotent bool, fn func(context.Context) (T, error)) (T, error) {
+	ctx = c.getContext(ctx)
+
+	attempts := 1
+	if idempotent && c.config.Retry.MaxAttempts > 1 {
+		attempts = c.config.Retry.MaxAttempts
+	}
+
+	backoff := c.config.Retry.InitialBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	maxBackoff := c.config.Retry.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := callOnce(ctx, c.config.Timeout, fn)
+		if err == nil {
+			return resp, nil
+		}
+
+		if attempt >= attempts || !isRetryable(err) || ctx.Err() != nil {
+			return resp, clientError(err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, clientError(err)
+		case <-timer.C:
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// callOnce runs fn once, with the given timeout if set
+func callOnce[T any](ctx context.Context, timeout time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return fn(ctx)
+}
+
+// isRetryable returns true if the call failed with a transient error
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// clientError wraps a gRPC error with the matching error of the package
+func clientError(err error) error {
+	var sentinel error
+	switch status.Code(err) {
+	case codes.NotFound:
+		sentinel = ErrNotFound
+	case codes.AlreadyExists:
+		sentinel = ErrAlreadyExists
+	case codes.InvalidArgument:
+		sentinel = ErrInvalidArgument
+	case codes.Unauthenticated:
+		sentinel = ErrUnauthenticated
+	case codes.PermissionDenied:
+		sentinel = ErrPermissionDenied
+	case codes.Unavailable:
+		sentinel = ErrUnavailable
+	default:
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
+
 // User Management
 
 func (c *client) CreateUser(ctx context.Context, name string) (*v1.User, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.CreateUser(ctx, &v1.CreateUserRequest{
-		Name: name,
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.CreateUserResponse, error) {
+		return c.client.CreateUser(ctx, &v1.CreateUserRequest{
+			Name: name,
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
@@ -83,8 +221,9 @@ func (c *client) CreateUser(ctx context.Context, name string) (*v1.User, error)
 }
 
 func (c *client) ListUsers(ctx context.Context) ([]*v1.User, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.ListUsers(ctx, &v1.ListUsersRequest{})
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListUsersResponse, error) {
+		return c.client.ListUsers(ctx, &v1.ListUsersRequest{})
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
@@ -92,9 +231,17 @@ func (c *client) ListUsers(ctx context.Context) ([]*v1.User, error) {
 }
 
 func (c *client) DeleteUser(ctx context.Context, userID uint64) error {
-	ctx = c.getContext(ctx)
-	_, err := c.client.DeleteUser(ctx, &v1.DeleteUserRequest{
-		Id: userID,
+	return c.DeleteUserWithOptions(ctx, userID, DeleteUserOptions{})
+}
+
+func (c *client) DeleteUserWithOptions(ctx context.Context, userID uint64, opts DeleteUserOptions) error {
+	_, err := call(ctx, c, false, func(ctx context.Context) (*v1.DeleteUserResponse, error) {
+		return c.client.DeleteUser(ctx, &v1.DeleteUserRequest{
+			Id:          userID,
+			TransferTo:  opts.TransferTo,
+			DeleteNodes: opts.DeleteNodes,
+			ExpireNodes: opts.ExpireNodes,
+		})
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
@@ -102,11 +249,49 @@ func (c *client) DeleteUser(ctx context.Context, userID uint64) error {
 	return nil
 }
 
+func (c *client) DisableUser(ctx context.Context, userID uint64) (*v1.User, error) {
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.DisableUserResponse, error) {
+		return c.client.DisableUser(ctx, &v1.DisableUserRequest{
+			Id: userID,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to disable user: %w", err)
+	}
+	return resp.User, nil
+}
+
+func (c *client) EnableUser(ctx context.Context, userID uint64) (*v1.User, error) {
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.EnableUserResponse, error) {
+		return c.client.EnableUser(ctx, &v1.EnableUserRequest{
+			Id: userID,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable user: %w", err)
+	}
+	return resp.User, nil
+}
+
+func (c *client) SetUserQuota(ctx context.Context, userID uint64, quota *v1.QuotaLimits) (*v1.User, error) {
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.SetUserQuotaResponse, error) {
+		return c.client.SetUserQuota(ctx, &v1.SetUserQuotaRequest{
+			Id:    userID,
+			Quota: quota,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set user quota: %w", err)
+	}
+	return resp.User, nil
+}
+
 func (c *client) RenameUser(ctx context.Context, userID uint64, newName string) (*v1.User, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.RenameUser(ctx, &v1.RenameUserRequest{
-		OldId:   userID,
-		NewName: newName,
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.RenameUserResponse, error) {
+		return c.client.RenameUser(ctx, &v1.RenameUserRequest{
+			OldId:   userID,
+			NewName: newName,
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to rename user: %w", err)
@@ -114,31 +299,52 @@ func (c *client) RenameUser(ctx context.Context, userID uint64, newName string)
 	return resp.User, nil
 }
 
-// Node Management
-
-func (c *client) ListNodes(ctx context.Context, userID uint64) ([]*v1.Node, error) {
-	ctx = c.getContext(ctx)
+func (c *client) MergeUsers(ctx context.Context, fromID, intoID uint64) (*v1.User, error) {
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.MergeUsersResponse, error) {
+		return c.client.MergeUsers(ctx, &v1.MergeUsersRequest{
+			FromId: fromID,
+			IntoId: intoID,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge users: %w", err)
+	}
+	return resp.User, nil
+}
 
-	// First get the user name from ID
-	users, err := c.ListUsers(ctx)
+func (c *client) ListUserLinks(ctx context.Context, userID uint64) ([]*v1.UserLink, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListUserLinksResponse, error) {
+		return c.client.ListUserLinks(ctx, &v1.ListUserLinksRequest{
+			UserId: userID,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get users: %w", err)
+		return nil, fmt.Errorf("failed to list user links: %w", err)
 	}
+	return resp.Links, nil
+}
 
-	var userName string
-	for _, user := range users {
-		if user.Id == userID {
-			userName = user.Name
-			break
-		}
+// Node Management
+
+func (c *client) ListNodes(ctx context.Context, userID uint64) ([]*v1.Node, error) {
+	if userID == 0 {
+		return nil, fmt.Errorf("failed to list nodes: %w: user ID is required", ErrInvalidArgument)
 	}
 
-	if userName == "" {
-		return nil, fmt.Errorf("user with ID %d not found", userID)
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListNodesResponse, error) {
+		return c.client.ListNodes(ctx, &v1.ListNodesRequest{
+			UserId: userID,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
 	}
+	return resp.Nodes, nil
+}
 
-	resp, err := c.client.ListNodes(ctx, &v1.ListNodesRequest{
-		User: userName,
+func (c *client) ListAllNodes(ctx context.Context) ([]*v1.Node, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListNodesResponse, error) {
+		return c.client.ListNodes(ctx, &v1.ListNodesRequest{})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list nodes: %w", err)
@@ -146,10 +352,27 @@ func (c *client) ListNodes(ctx context.Context, userID uint64) ([]*v1.Node, erro
 	return resp.Nodes, nil
 }
 
+func (c *client) ListNodesWithOptions(ctx context.Context, opts ListNodesOptions) ([]*v1.Node, string, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListNodesResponse, error) {
+		return c.client.ListNodes(ctx, &v1.ListNodesRequest{
+			UserId:    opts.UserID,
+			Filter:    opts.Filter,
+			OrderBy:   opts.OrderBy,
+			PageSize:  opts.PageSize,
+			PageToken: opts.PageToken,
+		})
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return resp.Nodes, resp.NextPageToken, nil
+}
+
 func (c *client) GetNode(ctx context.Context, nodeID uint64) (*v1.Node, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.GetNode(ctx, &v1.GetNodeRequest{
-		NodeId: nodeID,
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.GetNodeResponse, error) {
+		return c.client.GetNode(ctx, &v1.GetNodeRequest{
+			NodeId: nodeID,
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node: %w", err)
@@ -158,9 +381,10 @@ func (c *client) GetNode(ctx context.Context, nodeID uint64) (*v1.Node, error) {
 }
 
 func (c *client) DeleteNode(ctx context.Context, nodeID uint64) error {
-	ctx = c.getContext(ctx)
-	_, err := c.client.DeleteNode(ctx, &v1.DeleteNodeRequest{
-		NodeId: nodeID,
+	_, err := call(ctx, c, false, func(ctx context.Context) (*v1.DeleteNodeResponse, error) {
+		return c.client.DeleteNode(ctx, &v1.DeleteNodeRequest{
+			NodeId: nodeID,
+		})
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete node: %w", err)
@@ -169,9 +393,10 @@ func (c *client) DeleteNode(ctx context.Context, nodeID uint64) error {
 }
 
 func (c *client) ExpireNode(ctx context.Context, nodeID uint64) (*v1.Node, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.ExpireNode(ctx, &v1.ExpireNodeRequest{
-		NodeId: nodeID,
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.ExpireNodeResponse, error) {
+		return c.client.ExpireNode(ctx, &v1.ExpireNodeRequest{
+			NodeId: nodeID,
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to expire node: %w", err)
@@ -180,10 +405,11 @@ func (c *client) ExpireNode(ctx context.Context, nodeID uint64) (*v1.Node, error
 }
 
 func (c *client) RenameNode(ctx context.Context, nodeID uint64, newName string) (*v1.Node, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.RenameNode(ctx, &v1.RenameNodeRequest{
-		NodeId:  nodeID,
-		NewName: newName,
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.RenameNodeResponse, error) {
+		return c.client.RenameNode(ctx, &v1.RenameNodeRequest{
+			NodeId:  nodeID,
+			NewName: newName,
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to rename node: %w", err)
@@ -192,10 +418,11 @@ func (c *client) RenameNode(ctx context.Context, nodeID uint64, newName string)
 }
 
 func (c *client) MoveNode(ctx context.Context, nodeID uint64, userID uint64) (*v1.Node, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.MoveNode(ctx, &v1.MoveNodeRequest{
-		NodeId: nodeID,
-		User:   userID,
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.MoveNodeResponse, error) {
+		return c.client.MoveNode(ctx, &v1.MoveNodeRequest{
+			NodeId: nodeID,
+			User:   userID,
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to move node: %w", err)
@@ -204,32 +431,81 @@ func (c *client) MoveNode(ctx context.Context, nodeID uint64, userID uint64) (*v
 }
 
 func (c *client) RegisterNode(ctx context.Context, userID uint64, key string) (*v1.Node, error) {
-	ctx = c.getContext(ctx)
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.RegisterNodeResponse, error) {
+		return c.client.RegisterNode(ctx, &v1.RegisterNodeRequest{
+			UserId: userID,
+			Key:    key,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register node: %w", err)
+	}
+	return resp.Node, nil
+}
 
-	// First get the user name from ID
-	users, err := c.ListUsers(ctx)
+func (c *client) SetTags(ctx context.Context, nodeID uint64, tags []string) (*v1.Node, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.SetTagsResponse, error) {
+		return c.client.SetTags(ctx, &v1.SetTagsRequest{
+			NodeId: nodeID,
+			Tags:   tags,
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get users: %w", err)
+		return nil, fmt.Errorf("failed to set tags: %w", err)
 	}
+	return resp.Node, nil
+}
 
-	var userName string
-	for _, user := range users {
-		if user.Id == userID {
-			userName = user.Name
-			break
-		}
+func (c *client) LabelNode(ctx context.Context, nodeID uint64, labels map[string]string, remove []string) (*v1.Node, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.LabelNodeResponse, error) {
+		return c.client.LabelNode(ctx, &v1.LabelNodeRequest{
+			NodeId: nodeID,
+			Labels: labels,
+			Remove: remove,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to label node: %w", err)
 	}
+	return resp.Node, nil
+}
 
-	if userName == "" {
-		return nil, fmt.Errorf("user with ID %d not found", userID)
+func (c *client) SetApprovedRoutes(ctx context.Context, nodeID uint64, routes []string) (*v1.Node, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.SetApprovedRoutesResponse, error) {
+		return c.client.SetApprovedRoutes(ctx, &v1.SetApprovedRoutesRequest{
+			NodeId: nodeID,
+			Routes: routes,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set approved routes: %w", err)
 	}
+	return resp.Node, nil
+}
 
-	resp, err := c.client.RegisterNode(ctx, &v1.RegisterNodeRequest{
-		User: userName,
-		Key:  key,
+func (c *client) BackfillNodeIPs(ctx context.Context, confirmed bool) ([]string, error) {
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.BackfillNodeIPsResponse, error) {
+		return c.client.BackfillNodeIPs(ctx, &v1.BackfillNodeIPsRequest{
+			Confirmed: confirmed,
+		})
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to register node: %w", err)
+		return nil, fmt.Errorf("failed to backfill node IPs: %w", err)
+	}
+	return resp.Changes, nil
+}
+
+func (c *client) DebugCreateNode(ctx context.Context, userID uint64, key string, name string, routes []string) (*v1.Node, error) {
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.DebugCreateNodeResponse, error) {
+		return c.client.DebugCreateNode(ctx, &v1.DebugCreateNodeRequest{
+			UserId: userID,
+			Key:    key,
+			Name:   name,
+			Routes: routes,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create debug node: %w", err)
 	}
 	return resp.Node, nil
 }
@@ -237,20 +513,40 @@ func (c *client) RegisterNode(ctx context.Context, userID uint64, key string) (*
 // Pre-auth Key Management
 
 func (c *client) CreatePreAuthKey(ctx context.Context, userID uint64, reusable bool, ephemeral bool, expiration *time.Time, aclTags []string) (*v1.PreAuthKey, error) {
-	ctx = c.getContext(ctx)
+	return c.CreatePreAuthKeyWithOptions(ctx, userID, PreAuthKeyOptions{
+		Reusable:   reusable,
+		Ephemeral:  ephemeral,
+		Expiration: expiration,
+		Tags:       aclTags,
+	})
+}
 
+func (c *client) CreatePreAuthKeyWithOptions(ctx context.Context, userID uint64, opts PreAuthKeyOptions) (*v1.PreAuthKey, error) {
 	req := &v1.CreatePreAuthKeyRequest{
-		User:      userID,
-		Reusable:  reusable,
-		Ephemeral: ephemeral,
-		AclTags:   aclTags,
+		User:        userID,
+		Reusable:    opts.Reusable,
+		Ephemeral:   opts.Ephemeral,
+		AclTags:     opts.Tags,
+		Description: opts.Description,
+		MaxUses:     opts.MaxUses,
+		Constraints: &v1.PreAuthKeyConstraints{
+			HostnamePattern: opts.HostnamePattern,
+			AllowedOs:       opts.AllowedOS,
+			ApprovedRoutes:  opts.ApprovedRoutes,
+		},
 	}
 
-	if expiration != nil {
-		req.Expiration = timestamppb.New(*expiration)
+	if opts.Expiration != nil {
+		req.Expiration = timestamppb.New(*opts.Expiration)
 	}
 
-	resp, err := c.client.CreatePreAuthKey(ctx, req)
+	if opts.NodeExpiry != 0 {
+		req.Constraints.NodeExpiry = durationpb.New(opts.NodeExpiry)
+	}
+
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.CreatePreAuthKeyResponse, error) {
+		return c.client.CreatePreAuthKey(ctx, req)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pre-auth key: %w", err)
 	}
@@ -258,9 +554,10 @@ func (c *client) CreatePreAuthKey(ctx context.Context, userID uint64, reusable b
 }
 
 func (c *client) ListPreAuthKeys(ctx context.Context, userID uint64) ([]*v1.PreAuthKey, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.ListPreAuthKeys(ctx, &v1.ListPreAuthKeysRequest{
-		User: userID,
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListPreAuthKeysResponse, error) {
+		return c.client.ListPreAuthKeys(ctx, &v1.ListPreAuthKeysRequest{
+			User: userID,
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list pre-auth keys: %w", err)
@@ -269,10 +566,11 @@ func (c *client) ListPreAuthKeys(ctx context.Context, userID uint64) ([]*v1.PreA
 }
 
 func (c *client) ExpirePreAuthKey(ctx context.Context, userID uint64, key string) error {
-	ctx = c.getContext(ctx)
-	_, err := c.client.ExpirePreAuthKey(ctx, &v1.ExpirePreAuthKeyRequest{
-		User: userID,
-		Key:  key,
+	_, err := call(ctx, c, false, func(ctx context.Context) (*v1.ExpirePreAuthKeyResponse, error) {
+		return c.client.ExpirePreAuthKey(ctx, &v1.ExpirePreAuthKeyRequest{
+			User: userID,
+			Key:  key,
+		})
 	})
 	if err != nil {
 		return fmt.Errorf("failed to expire pre-auth key: %w", err)
@@ -280,17 +578,29 @@ func (c *client) ExpirePreAuthKey(ctx context.Context, userID uint64, key string
 	return nil
 }
 
+func (c *client) ListNodesByPreAuthKey(ctx context.Context, keyID uint64) ([]*v1.Node, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListNodesByPreAuthKeyResponse, error) {
+		return c.client.ListNodesByPreAuthKey(ctx, &v1.ListNodesByPreAuthKeyRequest{
+			Id: keyID,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes by pre-auth key: %w", err)
+	}
+	return resp.Nodes, nil
+}
+
 // API Key Management
 
 func (c *client) CreateAPIKey(ctx context.Context, expiration *time.Time) (string, error) {
-	ctx = c.getContext(ctx)
-
 	req := &v1.CreateApiKeyRequest{}
 	if expiration != nil {
 		req.Expiration = timestamppb.New(*expiration)
 	}
 
-	resp, err := c.client.CreateApiKey(ctx, req)
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.CreateApiKeyResponse, error) {
+		return c.client.CreateApiKey(ctx, req)
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to create API key: %w", err)
 	}
@@ -298,8 +608,9 @@ func (c *client) CreateAPIKey(ctx context.Context, expiration *time.Time) (strin
 }
 
 func (c *client) ListAPIKeys(ctx context.Context) ([]*v1.ApiKey, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.ListApiKeys(ctx, &v1.ListApiKeysRequest{})
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListApiKeysResponse, error) {
+		return c.client.ListApiKeys(ctx, &v1.ListApiKeysRequest{})
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list API keys: %w", err)
 	}
@@ -307,9 +618,10 @@ func (c *client) ListAPIKeys(ctx context.Context) ([]*v1.ApiKey, error) {
 }
 
 func (c *client) ExpireAPIKey(ctx context.Context, prefix string) error {
-	ctx = c.getContext(ctx)
-	_, err := c.client.ExpireApiKey(ctx, &v1.ExpireApiKeyRequest{
-		Prefix: prefix,
+	_, err := call(ctx, c, false, func(ctx context.Context) (*v1.ExpireApiKeyResponse, error) {
+		return c.client.ExpireApiKey(ctx, &v1.ExpireApiKeyRequest{
+			Prefix: prefix,
+		})
 	})
 	if err != nil {
 		return fmt.Errorf("failed to expire API key: %w", err)
@@ -318,9 +630,10 @@ func (c *client) ExpireAPIKey(ctx context.Context, prefix string) error {
 }
 
 func (c *client) DeleteAPIKey(ctx context.Context, prefix string) error {
-	ctx = c.getContext(ctx)
-	_, err := c.client.DeleteApiKey(ctx, &v1.DeleteApiKeyRequest{
-		Prefix: prefix,
+	_, err := call(ctx, c, false, func(ctx context.Context) (*v1.DeleteApiKeyResponse, error) {
+		return c.client.DeleteApiKey(ctx, &v1.DeleteApiKeyRequest{
+			Prefix: prefix,
+		})
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete API key: %w", err)
@@ -328,11 +641,95 @@ func (c *client) DeleteAPIKey(ctx context.Context, prefix string) error {
 	return nil
 }
 
+// OAuth Client Management
+
+func (c *client) CreateOAuthClient(ctx context.Context, opts OAuthClientOptions) (*v1.OAuthClient, string, error) {
+	req := &v1.CreateOAuthClientRequest{
+		Scopes:      opts.Scopes,
+		Tags:        opts.Tags,
+		Description: opts.Description,
+	}
+	if opts.Expiration != nil {
+		req.Expiration = timestamppb.New(*opts.Expiration)
+	}
+
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.CreateOAuthClientResponse, error) {
+		return c.client.CreateOAuthClient(ctx, req)
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create OAuth client: %w", err)
+	}
+	return resp.OauthClient, resp.ClientSecret, nil
+}
+
+func (c *client) ListOAuthClients(ctx context.Context) ([]*v1.OAuthClient, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListOAuthClientsResponse, error) {
+		return c.client.ListOAuthClients(ctx, &v1.ListOAuthClientsRequest{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OAuth clients: %w", err)
+	}
+	return resp.OauthClients, nil
+}
+
+func (c *client) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	_, err := call(ctx, c, false, func(ctx context.Context) (*v1.DeleteOAuthClientResponse, error) {
+		return c.client.DeleteOAuthClient(ctx, &v1.DeleteOAuthClientRequest{
+			ClientId: clientID,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete OAuth client: %w", err)
+	}
+	return nil
+}
+
+// Invite Management
+
+func (c *client) CreateInvite(ctx context.Context, opts InviteOptions) (*v1.Invite, string, error) {
+	req := &v1.CreateInviteRequest{
+		Email: opts.Email,
+		Tags:  opts.Tags,
+	}
+	if opts.Expiration != nil {
+		req.Expiration = timestamppb.New(*opts.Expiration)
+	}
+
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.CreateInviteResponse, error) {
+		return c.client.CreateInvite(ctx, req)
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create invite: %w", err)
+	}
+	return resp.Invite, resp.Url, nil
+}
+
+func (c *client) ListInvites(ctx context.Context) ([]*v1.Invite, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListInvitesResponse, error) {
+		return c.client.ListInvites(ctx, &v1.ListInvitesRequest{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invites: %w", err)
+	}
+	return resp.Invites, nil
+}
+
+func (c *client) RevokeInvite(ctx context.Context, id uint64) (*v1.Invite, error) {
+	resp, err := call(ctx, c, false, func(ctx context.Context) (*v1.RevokeInviteResponse, error) {
+		return c.client.RevokeInvite(ctx, &v1.RevokeInviteRequest{Id: id})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke invite: %w", err)
+	}
+	return resp.Invite, nil
+}
+
 // Policy Management
 
 func (c *client) GetPolicy(ctx context.Context) (string, error) {
-	ctx = c.getContext(ctx)
-	resp, err := c.client.GetPolicy(ctx, &v1.GetPolicyRequest{})
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.GetPolicyResponse, error) {
+		return c.client.GetPolicy(ctx, &v1.GetPolicyRequest{})
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to get policy: %w", err)
 	}
@@ -340,12 +737,37 @@ func (c *client) GetPolicy(ctx context.Context) (string, error) {
 }
 
 func (c *client) SetPolicy(ctx context.Context, policy string) error {
-	ctx = c.getContext(ctx)
-	_, err := c.client.SetPolicy(ctx, &v1.SetPolicyRequest{
-		Policy: policy,
+	_, err := call(ctx, c, true, func(ctx context.Context) (*v1.SetPolicyResponse, error) {
+		return c.client.SetPolicy(ctx, &v1.SetPolicyRequest{
+			Policy: policy,
+		})
 	})
 	if err != nil {
 		return fmt.Errorf("failed to set policy: %w", err)
 	}
 	return nil
 }
+
+// DNS Records Management
+
+func (c *client) ListDNSRecords(ctx context.Context) ([]*v1.DNSRecord, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.ListDNSRecordsResponse, error) {
+		return c.client.ListDNSRecords(ctx, &v1.ListDNSRecordsRequest{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DNS records: %w", err)
+	}
+	return resp.Records, nil
+}
+
+func (c *client) SetDNSRecords(ctx context.Context, records []*v1.DNSRecord) ([]*v1.DNSRecord, error) {
+	resp, err := call(ctx, c, true, func(ctx context.Context) (*v1.SetDNSRecordsResponse, error) {
+		return c.client.SetDNSRecords(ctx, &v1.SetDNSRecordsRequest{
+			Records: records,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set DNS records: %w", err)
+	}
+	return resp.Records, nil
+}
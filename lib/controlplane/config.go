@@ -6,31 +6,46 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/rs/zerolog"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/dnstype"
+	"tailscale.com/types/ptr"
 )
 
 // DefaultServerConfig returns a ServerConfig with sensible defaults
 func DefaultServerConfig() *ServerConfig {
 	return &ServerConfig{
-		ServerURL:         "http://localhost:8080",
-		ListenAddr:        "0.0.0.0:8080",
-		GRPCAddr:          "0.0.0.0:50443",
-		GRPCAllowInsecure: true,
+		ServerURL:            "http://localhost:8080",
+		ListenAddr:           "0.0.0.0:8080",
+		GRPCAddr:             "0.0.0.0:50443",
+		GRPCAllowInsecure:    true,
+		MetricsAddr:          "127.0.0.1:9090",
+		UnixSocket:           "/tmp/headscale.sock",
+		UnixSocketPermission: 0o770,
 		Database: DatabaseConfig{
 			Type: "sqlite",
+			Gorm: GormConfig{
+				PrepareStmt:           true,
+				ParameterizedQueries:  true,
+				SkipErrRecordNotFound: true,
+				SlowThreshold:         time.Second,
+			},
 			SQLite: SQLiteConfig{
-				Path: "/tmp/headscale.db",
+				Path:              "/tmp/headscale.db",
+				WriteAheadLog:     true,
+				WALAutoCheckPoint: 1000,
 			},
 		},
 		NoisePrivateKeyPath: "/tmp/headscale_noise_private.key",
 		BaseDomain:          "headscale.local",
 		IPv4Prefix:          "100.64.0.0/10",
 		IPv6Prefix:          "fd7a:115c:a1e0::/48",
+		IPAllocation:        string(types.IPAllocationStrategySequential),
 		DERP: DERPConfig{
 			ServerEnabled:                      true,
 			AutomaticallyAddEmbeddedDerpRegion: true,
@@ -39,17 +54,49 @@ func DefaultServerConfig() *ServerConfig {
 			ServerRegionName:                   "Headscale Embedded DERP",
 			ServerPrivateKeyPath:               "/tmp/headscale_derp_private.key",
 			STUNAddr:                           "0.0.0.0:3478",
+			UpdateFrequency:                    24 * time.Hour,
+		},
+		TLS: TLSConfig{
+			LetsEncryptChallengeType: types.HTTP01ChallengeType,
 		},
 		DNS: DNSConfig{
 			BaseDomain:    "headscale.local",
 			Nameservers:   []string{"1.1.1.1", "8.8.8.8"},
 			SearchDomains: []string{},
 		},
+		Policy: PolicyConfig{
+			Mode: types.PolicyModeFile,
+		},
 		LogLevel:                       "info",
+		LogFormat:                      types.TextLogFormat,
 		EphemeralNodeInactivityTimeout: time.Hour * 24 * 30, // 30 days
 	}
 }
 
+// loadConfigMu serialises LoadServerConfigFromFile, as headscale loads its
+// configuration files through the global viper instance.
+var loadConfigMu sync.Mutex
+
+// LoadServerConfigFromFile reads a headscale configuration file, like the one
+// used by the headscale binary, and returns the equivalent ServerConfig.
+// It is safe to call concurrently, the returned configuration does not
+// depend on any global state.
+func LoadServerConfigFromFile(path string) (*ServerConfig, error) {
+	loadConfigMu.Lock()
+	defer loadConfigMu.Unlock()
+
+	if err := types.LoadConfig(path, true); err != nil {
+		return nil, fmt.Errorf("loading config file %q: %w", path, err)
+	}
+
+	cfg, err := types.LoadServerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading config file %q: %w", path, err)
+	}
+
+	return fromHeadscaleConfig(cfg), nil
+}
+
 // ToHeadscaleConfig converts a ServerConfig to the internal headscale types.Config
 func (sc *ServerConfig) ToHeadscaleConfig() (*types.Config, error) {
 	// Parse IPv4 prefix
@@ -72,12 +119,22 @@ func (sc *ServerConfig) ToHeadscaleConfig() (*types.Config, error) {
 		prefixV6 = &prefix
 	}
 
+	ipAllocation, err := parseIPAllocation(sc.IPAllocation)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert log level
 	logLevel, err := parseLogLevel(sc.LogLevel)
 	if err != nil {
 		return nil, fmt.Errorf("invalid log level %q: %w", sc.LogLevel, err)
 	}
 
+	logFormat, err := parseLogFormat(sc.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build database config
 	dbConfig, err := sc.buildDatabaseConfig()
 	if err != nil {
@@ -85,7 +142,10 @@ func (sc *ServerConfig) ToHeadscaleConfig() (*types.Config, error) {
 	}
 
 	// Build DERP config
-	derpConfig := sc.buildDERPConfig()
+	derpConfig, err := sc.buildDERPConfig()
+	if err != nil {
+		return nil, fmt.Errorf("building DERP config: %w", err)
+	}
 
 	// Build TLS config
 	tlsConfig := sc.buildTLSConfig()
@@ -93,39 +153,90 @@ func (sc *ServerConfig) ToHeadscaleConfig() (*types.Config, error) {
 	// Build DNS config
 	dnsConfig := sc.buildDNSConfig()
 
+	// Build OIDC config
+	oidcConfig, err := sc.buildOIDCConfig()
+	if err != nil {
+		return nil, fmt.Errorf("building OIDC config: %w", err)
+	}
+
+	registrationApproval := sc.RegistrationApproval
+	if registrationApproval.OIDCAdminClaim == "" {
+		registrationApproval.OIDCAdminClaim = "groups"
+	}
+
+	cluster := sc.Cluster
+	if cluster.HeartbeatInterval == 0 {
+		cluster.HeartbeatInterval = 10 * time.Second
+	}
+
+	policyMode := types.PolicyMode(sc.Policy.Mode)
+	if policyMode == "" {
+		policyMode = types.PolicyModeFile
+	}
+
+	unixSocket := sc.UnixSocket
+	if unixSocket == "" {
+		unixSocket = "/tmp/headscale.sock"
+	}
+
+	unixSocketPermission := sc.UnixSocketPermission
+	if unixSocketPermission == 0 {
+		unixSocketPermission = 0o770
+	}
+
+	ephemeralNodeInactivityTimeout := sc.EphemeralNodeInactivityTimeout
+	if ephemeralNodeInactivityTimeout == 0 {
+		ephemeralNodeInactivityTimeout = 120 * time.Second
+	}
+
 	config := &types.Config{
 		ServerURL:                      sc.ServerURL,
 		Addr:                           sc.ListenAddr,
+		MetricsAddr:                    sc.MetricsAddr,
 		GRPCAddr:                       sc.GRPCAddr,
 		GRPCAllowInsecure:              sc.GRPCAllowInsecure,
 		NoisePrivateKeyPath:            sc.NoisePrivateKeyPath,
 		BaseDomain:                     sc.BaseDomain,
 		PrefixV4:                       prefixV4,
 		PrefixV6:                       prefixV6,
-		IPAllocation:                   types.IPAllocationStrategySequential,
-		EphemeralNodeInactivityTimeout: sc.EphemeralNodeInactivityTimeout,
+		IPAllocation:                   ipAllocation,
+		EphemeralNodeInactivityTimeout: ephemeralNodeInactivityTimeout,
 		Database:                       dbConfig,
+		Cluster:                        cluster,
+		Backup:                         sc.Backup,
+		Quota:                          sc.Quota,
 		DERP:                           derpConfig,
 		TLS:                            tlsConfig,
+		ACMEURL:                        sc.TLS.ACMEURL,
+		ACMEEmail:                      sc.TLS.ACMEEmail,
 		DNSConfig:                      dnsConfig,
 		TailcfgDNSConfig:               dnsToTailcfgDNS(dnsConfig),
-		UnixSocket:                     "/tmp/headscale.sock",
-		UnixSocketPermission:           0o770,
+		UnixSocket:                     unixSocket,
+		UnixSocketPermission:           unixSocketPermission,
+		OIDC:                           oidcConfig,
+		WorkloadIdentity:               types.WorkloadIdentityConfig{Issuers: sc.WorkloadIdentity},
+		RegistrationApproval:           registrationApproval,
 		DisableUpdateCheck:             true,
-		RandomizeClientPort:            false,
+		LogTail: types.LogTailConfig{
+			Enabled: sc.LogTailEnabled,
+		},
+		RandomizeClientPort: sc.RandomizeClientPort,
 		Log: types.LogConfig{
-			Format: "text",
+			Format: logFormat,
 			Level:  logLevel,
+			Logger: sc.Logger,
 		},
 		Policy: types.PolicyConfig{
-			Mode: types.PolicyModeFile,
-			Path: "",
+			Mode: policyMode,
+			Path: sc.Policy.Path,
 		},
 		CLI: types.CLIConfig{
 			Address:  sc.GRPCAddr,
 			Insecure: sc.GRPCAllowInsecure,
 			Timeout:  30 * time.Second,
 		},
+		Tuning: sc.buildTuning(),
+		Hooks:  sc.Hooks,
 	}
 
 	return config, nil
@@ -133,17 +244,31 @@ func (sc *ServerConfig) ToHeadscaleConfig() (*types.Config, error) {
 
 // buildDatabaseConfig converts the database configuration
 func (sc *ServerConfig) buildDatabaseConfig() (types.DatabaseConfig, error) {
+	gorm := types.GormConfig{
+		Debug:                 sc.Database.Debug,
+		SlowThreshold:         sc.Database.Gorm.SlowThreshold,
+		SkipErrRecordNotFound: sc.Database.Gorm.SkipErrRecordNotFound,
+		ParameterizedQueries:  sc.Database.Gorm.ParameterizedQueries,
+		PrepareStmt:           sc.Database.Gorm.PrepareStmt,
+	}
+
 	switch sc.Database.Type {
-	case "sqlite":
+	case "sqlite", types.DatabaseSqlite:
 		return types.DatabaseConfig{
-			Type: "sqlite",
+			Type:  types.DatabaseSqlite,
+			Debug: sc.Database.Debug,
+			Gorm:  gorm,
 			Sqlite: types.SqliteConfig{
-				Path: sc.Database.SQLite.Path,
+				Path:              sc.Database.SQLite.Path,
+				WriteAheadLog:     sc.Database.SQLite.WriteAheadLog,
+				WALAutoCheckPoint: sc.Database.SQLite.WALAutoCheckPoint,
 			},
 		}, nil
-	case "postgres":
+	case types.DatabasePostgres:
 		return types.DatabaseConfig{
-			Type: "postgres",
+			Type:  types.DatabasePostgres,
+			Debug: sc.Database.Debug,
+			Gorm:  gorm,
 			Postgres: types.PostgresConfig{
 				Host:                sc.Database.Postgres.Host,
 				Port:                sc.Database.Postgres.Port,
@@ -162,16 +287,21 @@ func (sc *ServerConfig) buildDatabaseConfig() (types.DatabaseConfig, error) {
 }
 
 // buildDERPConfig converts the DERP configuration
-func (sc *ServerConfig) buildDERPConfig() types.DERPConfig {
+func (sc *ServerConfig) buildDERPConfig() (types.DERPConfig, error) {
 	var serverUrls []url.URL
 	for _, urlStr := range sc.DERP.URLs {
 		url, err := url.Parse(urlStr)
 		if err != nil {
-			continue
+			return types.DERPConfig{}, fmt.Errorf("invalid DERP URL %q: %w", urlStr, err)
 		}
 		serverUrls = append(serverUrls, *url)
 	}
 
+	updateFrequency := sc.DERP.UpdateFrequency
+	if updateFrequency == 0 {
+		updateFrequency = 24 * time.Hour
+	}
+
 	return types.DERPConfig{
 		ServerEnabled:                      sc.DERP.ServerEnabled,
 		AutomaticallyAddEmbeddedDerpRegion: sc.DERP.AutomaticallyAddEmbeddedDerpRegion,
@@ -182,56 +312,331 @@ func (sc *ServerConfig) buildDERPConfig() types.DERPConfig {
 		STUNAddr:                           sc.DERP.STUNAddr,
 		URLs:                               serverUrls,
 		Paths:                              sc.DERP.Paths,
-		AutoUpdate:                         false,
-		UpdateFrequency:                    24 * time.Hour,
-	}
+		AutoUpdate:                         sc.DERP.AutoUpdate,
+		UpdateFrequency:                    updateFrequency,
+		IPv4:                               sc.DERP.IPv4,
+		IPv6:                               sc.DERP.IPv6,
+	}, nil
 }
 
 // buildTLSConfig converts the TLS configuration
 func (sc *ServerConfig) buildTLSConfig() types.TLSConfig {
+	challengeType := sc.TLS.LetsEncryptChallengeType
+	if challengeType == "" {
+		challengeType = types.HTTP01ChallengeType
+	}
+
 	return types.TLSConfig{
 		CertPath: sc.TLS.CertPath,
 		KeyPath:  sc.TLS.KeyPath,
 		LetsEncrypt: types.LetsEncryptConfig{
 			Hostname:      sc.TLS.LetsEncryptHostname,
-			Listen:        "", // Not exposed in our simplified config
+			Listen:        sc.TLS.LetsEncryptListen,
 			CacheDir:      sc.TLS.LetsEncryptCacheDir,
-			ChallengeType: sc.TLS.LetsEncryptChallengeType,
+			ChallengeType: challengeType,
 		},
 	}
 }
 
 // buildDNSConfig converts the DNS configuration
 func (sc *ServerConfig) buildDNSConfig() types.DNSConfig {
+	split := sc.DNS.SplitNameservers
+	if split == nil {
+		split = map[string][]string{}
+	}
+
+	extraRecords := make([]tailcfg.DNSRecord, 0, len(sc.DNS.ExtraRecords))
+	for _, record := range sc.DNS.ExtraRecords {
+		extraRecords = append(extraRecords, tailcfg.DNSRecord{
+			Name:  record.Name,
+			Type:  record.Type,
+			Value: record.Value,
+		})
+	}
+
 	return types.DNSConfig{
-		MagicDNS:         true,
+		MagicDNS:         sc.DNS.magicDNS(),
 		BaseDomain:       sc.DNS.BaseDomain,
-		OverrideLocalDNS: true,
+		OverrideLocalDNS: sc.DNS.overrideLocalDNS(),
 		Nameservers: types.Nameservers{
 			Global: sc.DNS.Nameservers,
-			Split:  map[string][]string{},
+			Split:  split,
+		},
+		SearchDomains:    sc.DNS.SearchDomains,
+		ExtraRecords:     extraRecords,
+		ExtraRecordsPath: sc.DNS.ExtraRecordsPath,
+	}
+}
+
+// magicDNS returns whether MagicDNS is enabled, defaulting to true
+func (dc *DNSConfig) magicDNS() bool {
+	return dc.MagicDNS == nil || *dc.MagicDNS
+}
+
+// overrideLocalDNS returns whether the local DNS is overridden, defaulting to true
+func (dc *DNSConfig) overrideLocalDNS() bool {
+	return dc.OverrideLocalDNS == nil || *dc.OverrideLocalDNS
+}
+
+// buildOIDCConfig converts the OIDC configuration, reading the client
+// secret from ClientSecretPath if set
+func (sc *ServerConfig) buildOIDCConfig() (types.OIDCConfig, error) {
+	if sc.OIDC.ClientSecret != "" && sc.OIDC.ClientSecretPath != "" {
+		return types.OIDCConfig{}, fmt.Errorf("OIDC.ClientSecret and OIDC.ClientSecretPath are mutually exclusive")
+	}
+
+	clientSecret := sc.OIDC.ClientSecret
+	if sc.OIDC.ClientSecretPath != "" {
+		secret, err := os.ReadFile(os.ExpandEnv(sc.OIDC.ClientSecretPath))
+		if err != nil {
+			return types.OIDCConfig{}, fmt.Errorf("reading OIDC client secret: %w", err)
+		}
+		clientSecret = strings.TrimSpace(string(secret))
+	}
+
+	scope := sc.OIDC.Scope
+	if len(scope) == 0 {
+		scope = []string{"openid", "profile", "email"}
+	}
+
+	expiry := sc.OIDC.Expiry
+	if expiry == 0 {
+		expiry = 180 * 24 * time.Hour
+	}
+
+	pkceMethod := sc.OIDC.PKCEMethod
+	if pkceMethod == "" {
+		pkceMethod = types.PKCEMethodS256
+	}
+
+	return types.OIDCConfig{
+		OnlyStartIfOIDCIsAvailable: sc.OIDC.OnlyStartIfOIDCIsAvailable,
+		Issuer:                     sc.OIDC.Issuer,
+		ClientID:                   sc.OIDC.ClientID,
+		ClientSecret:               clientSecret,
+		Scope:                      scope,
+		ExtraParams:                sc.OIDC.ExtraParams,
+		AllowedDomains:             sc.OIDC.AllowedDomains,
+		AllowedUsers:               sc.OIDC.AllowedUsers,
+		AllowedGroups:              sc.OIDC.AllowedGroups,
+		Expiry:                     expiry,
+		UseExpiryFromToken:         sc.OIDC.UseExpiryFromToken,
+		PKCE: types.PKCEConfig{
+			Enabled: sc.OIDC.PKCEEnabled,
+			Method:  pkceMethod,
+		},
+		LinkUsersByEmail: sc.OIDC.LinkUsersByEmail,
+	}, nil
+}
+
+// buildTuning converts the tuning configuration, using the headscale
+// defaults for unset values
+func (sc *ServerConfig) buildTuning() types.Tuning {
+	tuning := types.Tuning{
+		NotifierSendTimeout:            800 * time.Millisecond,
+		NotifierQueueSize:              1000,
+		BatchChangeDelay:               800 * time.Millisecond,
+		NodeMapSessionBufferedChanSize: 30,
+		NodeStorePersistInterval:       time.Second,
+	}
+
+	if sc.Tuning.NotifierSendTimeout != 0 {
+		tuning.NotifierSendTimeout = sc.Tuning.NotifierSendTimeout
+	}
+	if sc.Tuning.NotifierQueueSize != 0 {
+		tuning.NotifierQueueSize = sc.Tuning.NotifierQueueSize
+	}
+	if sc.Tuning.BatchChangeDelay != 0 {
+		tuning.BatchChangeDelay = sc.Tuning.BatchChangeDelay
+	}
+	if sc.Tuning.NodeMapSessionBufferedChanSize != 0 {
+		tuning.NodeMapSessionBufferedChanSize = sc.Tuning.NodeMapSessionBufferedChanSize
+	}
+	if sc.Tuning.NodeStorePersistInterval != 0 {
+		tuning.NodeStorePersistInterval = sc.Tuning.NodeStorePersistInterval
+	}
+
+	return tuning
+}
+
+// fromHeadscaleConfig converts the internal headscale types.Config to a ServerConfig
+func fromHeadscaleConfig(cfg *types.Config) *ServerConfig {
+	sc := &ServerConfig{
+		ServerURL:            cfg.ServerURL,
+		ListenAddr:           cfg.Addr,
+		GRPCAddr:             cfg.GRPCAddr,
+		GRPCAllowInsecure:    cfg.GRPCAllowInsecure,
+		MetricsAddr:          cfg.MetricsAddr,
+		UnixSocket:           cfg.UnixSocket,
+		UnixSocketPermission: cfg.UnixSocketPermission,
+		Database: DatabaseConfig{
+			Type:  cfg.Database.Type,
+			Debug: cfg.Database.Debug,
+			Gorm: GormConfig{
+				PrepareStmt:           cfg.Database.Gorm.PrepareStmt,
+				ParameterizedQueries:  cfg.Database.Gorm.ParameterizedQueries,
+				SkipErrRecordNotFound: cfg.Database.Gorm.SkipErrRecordNotFound,
+				SlowThreshold:         cfg.Database.Gorm.SlowThreshold,
+			},
+			SQLite: SQLiteConfig{
+				Path:              cfg.Database.Sqlite.Path,
+				WriteAheadLog:     cfg.Database.Sqlite.WriteAheadLog,
+				WALAutoCheckPoint: cfg.Database.Sqlite.WALAutoCheckPoint,
+			},
+			Postgres: PostgresConfig{
+				Host:                cfg.Database.Postgres.Host,
+				Port:                cfg.Database.Postgres.Port,
+				Database:            cfg.Database.Postgres.Name,
+				Username:            cfg.Database.Postgres.User,
+				Password:            cfg.Database.Postgres.Pass,
+				SSL:                 cfg.Database.Postgres.Ssl,
+				MaxOpenConns:        cfg.Database.Postgres.MaxOpenConnections,
+				MaxIdleConns:        cfg.Database.Postgres.MaxIdleConnections,
+				ConnMaxIdleTimeSecs: cfg.Database.Postgres.ConnMaxIdleTimeSecs,
+			},
+		},
+		NoisePrivateKeyPath: cfg.NoisePrivateKeyPath,
+		BaseDomain:          cfg.BaseDomain,
+		IPAllocation:        string(cfg.IPAllocation),
+		DERP: DERPConfig{
+			ServerEnabled:                      cfg.DERP.ServerEnabled,
+			AutomaticallyAddEmbeddedDerpRegion: cfg.DERP.AutomaticallyAddEmbeddedDerpRegion,
+			ServerRegionID:                     cfg.DERP.ServerRegionID,
+			ServerRegionCode:                   cfg.DERP.ServerRegionCode,
+			ServerRegionName:                   cfg.DERP.ServerRegionName,
+			ServerPrivateKeyPath:               cfg.DERP.ServerPrivateKeyPath,
+			STUNAddr:                           cfg.DERP.STUNAddr,
+			Paths:                              cfg.DERP.Paths,
+			AutoUpdate:                         cfg.DERP.AutoUpdate,
+			UpdateFrequency:                    cfg.DERP.UpdateFrequency,
+			IPv4:                               cfg.DERP.IPv4,
+			IPv6:                               cfg.DERP.IPv6,
+		},
+		TLS: TLSConfig{
+			CertPath:                 cfg.TLS.CertPath,
+			KeyPath:                  cfg.TLS.KeyPath,
+			LetsEncryptHostname:      cfg.TLS.LetsEncrypt.Hostname,
+			LetsEncryptCacheDir:      cfg.TLS.LetsEncrypt.CacheDir,
+			LetsEncryptChallengeType: cfg.TLS.LetsEncrypt.ChallengeType,
+			LetsEncryptListen:        cfg.TLS.LetsEncrypt.Listen,
+			ACMEURL:                  cfg.ACMEURL,
+			ACMEEmail:                cfg.ACMEEmail,
 		},
-		SearchDomains: sc.DNS.SearchDomains,
-		ExtraRecords:  []tailcfg.DNSRecord{}, // Convert if needed
+		DNS: DNSConfig{
+			MagicDNS:         ptr.To(cfg.DNSConfig.MagicDNS),
+			BaseDomain:       cfg.DNSConfig.BaseDomain,
+			OverrideLocalDNS: ptr.To(cfg.DNSConfig.OverrideLocalDNS),
+			Nameservers:      cfg.DNSConfig.Nameservers.Global,
+			SplitNameservers: cfg.DNSConfig.Nameservers.Split,
+			SearchDomains:    cfg.DNSConfig.SearchDomains,
+			ExtraRecordsPath: cfg.DNSConfig.ExtraRecordsPath,
+		},
+		OIDC: OIDCConfig{
+			Issuer:                     cfg.OIDC.Issuer,
+			ClientID:                   cfg.OIDC.ClientID,
+			ClientSecret:               cfg.OIDC.ClientSecret,
+			Scope:                      cfg.OIDC.Scope,
+			ExtraParams:                cfg.OIDC.ExtraParams,
+			AllowedDomains:             cfg.OIDC.AllowedDomains,
+			AllowedUsers:               cfg.OIDC.AllowedUsers,
+			AllowedGroups:              cfg.OIDC.AllowedGroups,
+			Expiry:                     cfg.OIDC.Expiry,
+			UseExpiryFromToken:         cfg.OIDC.UseExpiryFromToken,
+			OnlyStartIfOIDCIsAvailable: cfg.OIDC.OnlyStartIfOIDCIsAvailable,
+			PKCEEnabled:                cfg.OIDC.PKCE.Enabled,
+			PKCEMethod:                 cfg.OIDC.PKCE.Method,
+			LinkUsersByEmail:           cfg.OIDC.LinkUsersByEmail,
+		},
+		Cluster:              cfg.Cluster,
+		Backup:               cfg.Backup,
+		Quota:                cfg.Quota,
+		WorkloadIdentity:     cfg.WorkloadIdentity.Issuers,
+		RegistrationApproval: cfg.RegistrationApproval,
+		Policy: PolicyConfig{
+			Mode: string(cfg.Policy.Mode),
+			Path: cfg.Policy.Path,
+		},
+		LogLevel:                       cfg.Log.Level.String(),
+		LogFormat:                      cfg.Log.Format,
+		LogTailEnabled:                 cfg.LogTail.Enabled,
+		RandomizeClientPort:            cfg.RandomizeClientPort,
+		EphemeralNodeInactivityTimeout: cfg.EphemeralNodeInactivityTimeout,
+		Tuning: TuningConfig{
+			NotifierSendTimeout:            cfg.Tuning.NotifierSendTimeout,
+			NotifierQueueSize:              cfg.Tuning.NotifierQueueSize,
+			BatchChangeDelay:               cfg.Tuning.BatchChangeDelay,
+			NodeMapSessionBufferedChanSize: cfg.Tuning.NodeMapSessionBufferedChanSize,
+			NodeStorePersistInterval:       cfg.Tuning.NodeStorePersistInterval,
+		},
+	}
+
+	if cfg.Database.Type == types.DatabaseSqlite {
+		sc.Database.Type = "sqlite"
+	}
+
+	if cfg.PrefixV4 != nil {
+		sc.IPv4Prefix = cfg.PrefixV4.String()
+	}
+	if cfg.PrefixV6 != nil {
+		sc.IPv6Prefix = cfg.PrefixV6.String()
+	}
+
+	for _, u := range cfg.DERP.URLs {
+		sc.DERP.URLs = append(sc.DERP.URLs, u.String())
+	}
+
+	for _, record := range cfg.DNSConfig.ExtraRecords {
+		sc.DNS.ExtraRecords = append(sc.DNS.ExtraRecords, DNSRecord{
+			Name:  record.Name,
+			Type:  record.Type,
+			Value: record.Value,
+		})
+	}
+
+	return sc
+}
+
+// parseIPAllocation converts string allocation strategy to types.IPAllocationStrategy
+func parseIPAllocation(strategy string) (types.IPAllocationStrategy, error) {
+	switch strategy {
+	case "", string(types.IPAllocationStrategySequential):
+		return types.IPAllocationStrategySequential, nil
+	case string(types.IPAllocationStrategyRandom):
+		return types.IPAllocationStrategyRandom, nil
+	default:
+		return "", fmt.Errorf(
+			"IPAllocation %q is not a valid strategy, allowed options: %s, %s",
+			strategy,
+			types.IPAllocationStrategySequential,
+			types.IPAllocationStrategyRandom,
+		)
+	}
+}
+
+// parseLogFormat validates the log format, defaulting to text
+func parseLogFormat(format string) (string, error) {
+	switch format {
+	case "", types.TextLogFormat:
+		return types.TextLogFormat, nil
+	case types.JSONLogFormat:
+		return types.JSONLogFormat, nil
+	default:
+		return "", fmt.Errorf("LogFormat %q is not valid, allowed options: %s, %s", format, types.TextLogFormat, types.JSONLogFormat)
 	}
 }
 
 // parseLogLevel converts string log level to zerolog level
 func parseLogLevel(level string) (zerolog.Level, error) {
-	switch level {
-	case "trace":
-		return zerolog.TraceLevel, nil
-	case "debug":
-		return zerolog.DebugLevel, nil
-	case "info":
+	if level == "" {
 		return zerolog.InfoLevel, nil
-	case "warn":
-		return zerolog.WarnLevel, nil
-	case "error":
-		return zerolog.ErrorLevel, nil
-	default:
+	}
+
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil {
 		return zerolog.InfoLevel, fmt.Errorf("unknown log level: %s", level)
 	}
+
+	return parsed, nil
 }
 
 // dnsToTailcfgDNS converts DNS config to tailcfg format using the actual headscale implementation
@@ -338,7 +743,7 @@ func (sc *ServerConfig) EnsureDirectories() error {
 		filepath.Dir(sc.DERP.ServerPrivateKeyPath),
 	}
 
-	if sc.Database.Type == "sqlite" {
+	if sc.Database.Type == "sqlite" || sc.Database.Type == types.DatabaseSqlite {
 		dirs = append(dirs, filepath.Dir(sc.Database.SQLite.Path))
 	}
 
@@ -379,7 +784,7 @@ func (sc *ServerConfig) Validate() error {
 		return fmt.Errorf("Database.Type is required")
 	}
 
-	if sc.Database.Type == "sqlite" && sc.Database.SQLite.Path == "" {
+	if (sc.Database.Type == "sqlite" || sc.Database.Type == types.DatabaseSqlite) && sc.Database.SQLite.Path == "" {
 		return fmt.Errorf("Database.SQLite.Path is required when using SQLite")
 	}
 
@@ -395,6 +800,122 @@ func (sc *ServerConfig) Validate() error {
 		}
 	}
 
+	if !strings.HasPrefix(sc.ServerURL, "http://") &&
+		!strings.HasPrefix(sc.ServerURL, "https://") {
+		return fmt.Errorf("ServerURL must start with https:// or http://")
+	}
+
+	// BaseDomain cannot be the same as, or a suffix of, the server URL,
+	// as the clients would take over the domain, making headscale and
+	// DERP unreachable.
+	if sc.DNS.BaseDomain != "" {
+		if err := types.IsSafeServerURL(sc.ServerURL, sc.DNS.BaseDomain); err != nil {
+			return err
+		}
+	}
+
+	if _, err := parseIPAllocation(sc.IPAllocation); err != nil {
+		return err
+	}
+
+	if sc.Cluster.Enabled && sc.Database.Type != types.DatabasePostgres {
+		return fmt.Errorf("Cluster requires a postgres database")
+	}
+
+	if sc.Cluster.HeartbeatInterval < 0 {
+		return fmt.Errorf("Cluster.HeartbeatInterval must not be negative")
+	}
+
+	if sc.Backup.Interval < 0 {
+		return fmt.Errorf("Backup.Interval must not be negative")
+	}
+
+	if sc.Backup.Interval > 0 && sc.Backup.Directory == "" {
+		return fmt.Errorf("Backup.Directory is required when Backup.Interval is set")
+	}
+
+	if sc.Backup.Retention < 0 {
+		return fmt.Errorf("Backup.Retention must not be negative")
+	}
+
+	if sc.Quota.MaxNodes < 0 || sc.Quota.MaxEphemeralNodes < 0 ||
+		sc.Quota.MaxPreAuthKeys < 0 || sc.Quota.MaxRoutes < 0 {
+		return fmt.Errorf("Quota limits must not be negative")
+	}
+
+	for i := range sc.WorkloadIdentity {
+		if err := sc.WorkloadIdentity[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := parseLogLevel(sc.LogLevel); err != nil {
+		return err
+	}
+
+	if _, err := parseLogFormat(sc.LogFormat); err != nil {
+		return err
+	}
+
+	if sc.TLS.LetsEncryptHostname != "" && (sc.TLS.CertPath != "" || sc.TLS.KeyPath != "") {
+		return fmt.Errorf("set either TLS.LetsEncryptHostname or TLS.CertPath/TLS.KeyPath, not both")
+	}
+
+	switch sc.TLS.LetsEncryptChallengeType {
+	case "", types.HTTP01ChallengeType, types.TLSALPN01ChallengeType:
+	default:
+		return fmt.Errorf("TLS.LetsEncryptChallengeType must be either %s or %s", types.HTTP01ChallengeType, types.TLSALPN01ChallengeType)
+	}
+
+	// Minimum inactivity time out is keepalive timeout (60s) plus a few seconds
+	// to avoid races
+	minInactivityTimeout := 65 * time.Second
+	if sc.EphemeralNodeInactivityTimeout != 0 && sc.EphemeralNodeInactivityTimeout <= minInactivityTimeout {
+		return fmt.Errorf(
+			"EphemeralNodeInactivityTimeout (%s) is set too low, must be more than %s",
+			sc.EphemeralNodeInactivityTimeout,
+			minInactivityTimeout,
+		)
+	}
+
+	if sc.DNS.overrideLocalDNS() && len(sc.DNS.Nameservers) == 0 {
+		return fmt.Errorf("DNS.Nameservers must be set when DNS.OverrideLocalDNS is true")
+	}
+
+	if len(sc.DNS.ExtraRecords) > 0 && sc.DNS.ExtraRecordsPath != "" {
+		return fmt.Errorf("DNS.ExtraRecords and DNS.ExtraRecordsPath are mutually exclusive")
+	}
+
+	if sc.DERP.ServerEnabled && sc.DERP.STUNAddr == "" {
+		return fmt.Errorf("DERP.STUNAddr must be set when DERP.ServerEnabled is true")
+	}
+
+	if sc.DERP.ServerEnabled && !sc.DERP.AutomaticallyAddEmbeddedDerpRegion && len(sc.DERP.Paths) == 0 {
+		return fmt.Errorf("disabling DERP.AutomaticallyAddEmbeddedDerpRegion requires the DERP server to be configured in DERP.Paths")
+	}
+
+	for _, urlStr := range sc.DERP.URLs {
+		if _, err := url.Parse(urlStr); err != nil {
+			return fmt.Errorf("invalid DERP URL %q: %w", urlStr, err)
+		}
+	}
+
+	if sc.OIDC.ClientSecret != "" && sc.OIDC.ClientSecretPath != "" {
+		return fmt.Errorf("OIDC.ClientSecret and OIDC.ClientSecretPath are mutually exclusive")
+	}
+
+	if sc.OIDC.Issuer != "" && sc.OIDC.PKCEMethod != "" {
+		if err := types.ValidatePKCEMethod(sc.OIDC.PKCEMethod); err != nil {
+			return err
+		}
+	}
+
+	switch sc.Policy.Mode {
+	case "", types.PolicyModeFile, types.PolicyModeDB:
+	default:
+		return fmt.Errorf("Policy.Mode must be either %s or %s", types.PolicyModeFile, types.PolicyModeDB)
+	}
+
 	return nil
 }
 
@@ -404,5 +925,10 @@ func DefaultClientConfig() *ClientConfig {
 		Address:  "localhost:50443",
 		Insecure: true,
 		Timeout:  30 * time.Second,
+		Retry: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     5 * time.Second,
+		},
 	}
 }
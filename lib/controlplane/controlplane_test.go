@@ -1,12 +1,27 @@
 package controlplane
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/ptr"
 )
 
 func TestDefaultConfigs(t *testing.T) {
@@ -68,6 +83,109 @@ func TestServerConfigValidation(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "at least one of IPv4Prefix or IPv6Prefix is required")
 	})
+
+	tests := []struct {
+		name    string
+		modify  func(*ServerConfig)
+		wantErr string
+	}{
+		{
+			name:    "ServerURLScheme",
+			modify:  func(c *ServerConfig) { c.ServerURL = "headscale.example.com" },
+			wantErr: "ServerURL must start with https:// or http://",
+		},
+		{
+			name: "BaseDomainInServerURL",
+			modify: func(c *ServerConfig) {
+				c.ServerURL = "https://headscale.tailnet.example.com"
+				c.DNS.BaseDomain = "tailnet.example.com"
+			},
+			wantErr: "server_url cannot be part of base_domain",
+		},
+		{
+			name:    "InvalidIPAllocation",
+			modify:  func(c *ServerConfig) { c.IPAllocation = "spread" },
+			wantErr: "is not a valid strategy",
+		},
+		{
+			name: "LetsEncryptAndCertificate",
+			modify: func(c *ServerConfig) {
+				c.TLS.LetsEncryptHostname = "headscale.example.com"
+				c.TLS.CertPath = "/etc/headscale/cert.pem"
+			},
+			wantErr: "set either TLS.LetsEncryptHostname or TLS.CertPath/TLS.KeyPath, not both",
+		},
+		{
+			name:    "InvalidChallengeType",
+			modify:  func(c *ServerConfig) { c.TLS.LetsEncryptChallengeType = "DNS-01" },
+			wantErr: "TLS.LetsEncryptChallengeType must be either HTTP-01 or TLS-ALPN-01",
+		},
+		{
+			name:    "EphemeralTimeoutTooLow",
+			modify:  func(c *ServerConfig) { c.EphemeralNodeInactivityTimeout = time.Minute },
+			wantErr: "EphemeralNodeInactivityTimeout (1m0s) is set too low",
+		},
+		{
+			name:    "OverrideLocalDNSWithoutNameservers",
+			modify:  func(c *ServerConfig) { c.DNS.Nameservers = nil },
+			wantErr: "DNS.Nameservers must be set when DNS.OverrideLocalDNS is true",
+		},
+		{
+			name: "ExtraRecordsAndPath",
+			modify: func(c *ServerConfig) {
+				c.DNS.ExtraRecords = []DNSRecord{{Name: "a.headscale.local", Type: "A", Value: "100.64.0.1"}}
+				c.DNS.ExtraRecordsPath = "/etc/headscale/records.json"
+			},
+			wantErr: "DNS.ExtraRecords and DNS.ExtraRecordsPath are mutually exclusive",
+		},
+		{
+			name:    "DERPServerWithoutSTUN",
+			modify:  func(c *ServerConfig) { c.DERP.STUNAddr = "" },
+			wantErr: "DERP.STUNAddr must be set when DERP.ServerEnabled is true",
+		},
+		{
+			name:    "DERPServerWithoutRegion",
+			modify:  func(c *ServerConfig) { c.DERP.AutomaticallyAddEmbeddedDerpRegion = false },
+			wantErr: "requires the DERP server to be configured in DERP.Paths",
+		},
+		{
+			name: "OIDCSecretAndPath",
+			modify: func(c *ServerConfig) {
+				c.OIDC.ClientSecret = "secret"
+				c.OIDC.ClientSecretPath = "/etc/headscale/oidc_secret"
+			},
+			wantErr: "OIDC.ClientSecret and OIDC.ClientSecretPath are mutually exclusive",
+		},
+		{
+			name: "OIDCInvalidPKCEMethod",
+			modify: func(c *ServerConfig) {
+				c.OIDC.Issuer = "https://idp.example.com"
+				c.OIDC.PKCEMethod = "S512"
+			},
+			wantErr: "pkce.method must be either 'plain' or 'S256'",
+		},
+		{
+			name:    "InvalidPolicyMode",
+			modify:  func(c *ServerConfig) { c.Policy.Mode = "remote" },
+			wantErr: "Policy.Mode must be either file or database",
+		},
+		{
+			name:    "InvalidLogFormat",
+			modify:  func(c *ServerConfig) { c.LogFormat = "xml" },
+			wantErr: "LogFormat \"xml\" is not valid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultServerConfig()
+			tt.modify(config)
+
+			err := config.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
 }
 
 func TestServerConfigToHeadscaleConfig(t *testing.T) {
@@ -83,6 +201,128 @@ func TestServerConfigToHeadscaleConfig(t *testing.T) {
 	assert.Equal(t, config.GRPCAllowInsecure, hsConfig.GRPCAllowInsecure)
 	assert.Equal(t, config.NoisePrivateKeyPath, hsConfig.NoisePrivateKeyPath)
 	assert.Equal(t, config.BaseDomain, hsConfig.BaseDomain)
+	assert.Equal(t, types.DatabaseSqlite, hsConfig.Database.Type)
+	assert.Equal(t, 800*time.Millisecond, hsConfig.Tuning.BatchChangeDelay)
+
+	t.Run("FullConfig", func(t *testing.T) {
+		secretPath := filepath.Join(t.TempDir(), "secret")
+		require.NoError(t, os.WriteFile(secretPath, []byte("oidc-secret\n"), 0o600))
+
+		config := DefaultServerConfig()
+		config.MetricsAddr = "127.0.0.1:9191"
+		config.UnixSocket = "/run/headscale/headscale.sock"
+		config.UnixSocketPermission = 0o700
+		config.IPAllocation = "random"
+		config.LogFormat = "json"
+		config.LogTailEnabled = true
+		config.RandomizeClientPort = true
+		config.Policy = PolicyConfig{Mode: "database"}
+		config.DERP.URLs = []string{"https://controlplane.tailscale.com/derpmap/default"}
+		config.DERP.AutoUpdate = true
+		config.DERP.IPv4 = "192.0.2.1"
+		config.DNS.MagicDNS = ptr.To(false)
+		config.DNS.SplitNameservers = map[string][]string{"corp.example.com": {"10.0.0.1"}}
+		config.DNS.ExtraRecords = []DNSRecord{{Name: "grafana.headscale.local", Type: "AAAA", Value: "fd7a::1"}}
+		config.OIDC = OIDCConfig{
+			Issuer:           "https://idp.example.com",
+			ClientID:         "headscale",
+			ClientSecretPath: secretPath,
+			PKCEEnabled:      true,
+		}
+		config.Tuning.NotifierQueueSize = 10
+
+		require.NoError(t, config.Validate())
+		hsConfig, err := config.ToHeadscaleConfig()
+		require.NoError(t, err)
+
+		assert.Equal(t, "127.0.0.1:9191", hsConfig.MetricsAddr)
+		assert.Equal(t, "/run/headscale/headscale.sock", hsConfig.UnixSocket)
+		assert.Equal(t, fs.FileMode(0o700), hsConfig.UnixSocketPermission)
+		assert.Equal(t, types.IPAllocationStrategyRandom, hsConfig.IPAllocation)
+		assert.Equal(t, types.JSONLogFormat, hsConfig.Log.Format)
+		assert.True(t, hsConfig.LogTail.Enabled)
+		assert.True(t, hsConfig.RandomizeClientPort)
+		assert.Equal(t, types.PolicyMode(types.PolicyModeDB), hsConfig.Policy.Mode)
+		require.Len(t, hsConfig.DERP.URLs, 1)
+		assert.Equal(t, "controlplane.tailscale.com", hsConfig.DERP.URLs[0].Host)
+		assert.True(t, hsConfig.DERP.AutoUpdate)
+		assert.Equal(t, "192.0.2.1", hsConfig.DERP.IPv4)
+		assert.False(t, hsConfig.DNSConfig.MagicDNS)
+		assert.True(t, hsConfig.DNSConfig.OverrideLocalDNS)
+		assert.Contains(t, hsConfig.TailcfgDNSConfig.Routes, "corp.example.com")
+		assert.Equal(t, []tailcfg.DNSRecord{{Name: "grafana.headscale.local", Type: "AAAA", Value: "fd7a::1"}}, hsConfig.TailcfgDNSConfig.ExtraRecords)
+		assert.Equal(t, "oidc-secret", hsConfig.OIDC.ClientSecret)
+		assert.Equal(t, types.PKCEMethodS256, hsConfig.OIDC.PKCE.Method)
+		assert.Equal(t, 180*24*time.Hour, hsConfig.OIDC.Expiry)
+		assert.Equal(t, 10, hsConfig.Tuning.NotifierQueueSize)
+		assert.Equal(t, time.Second, hsConfig.Tuning.NodeStorePersistInterval)
+	})
+
+	t.Run("InvalidDERPURL", func(t *testing.T) {
+		config := DefaultServerConfig()
+		config.DERP.URLs = []string{"://invalid"}
+
+		_, err := config.ToHeadscaleConfig()
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadServerConfigFromFile(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+server_url: https://headscale.example.com
+listen_addr: 127.0.0.1:8080
+metrics_listen_addr: 127.0.0.1:9090
+noise:
+  private_key_path: `+filepath.Join(tempDir, "noise.key")+`
+prefixes:
+  v4: 100.64.0.0/10
+  allocation: random
+database:
+  type: sqlite
+  sqlite:
+    path: `+filepath.Join(tempDir, "db.sqlite")+`
+derp:
+  urls:
+    - https://controlplane.tailscale.com/derpmap/default
+dns:
+  base_domain: tailnet.example.com
+  nameservers:
+    global:
+      - 1.1.1.1
+  extra_records:
+    - name: grafana.tailnet.example.com
+      type: A
+      value: 100.64.0.3
+policy:
+  mode: database
+`), 0o600))
+
+	config, err := LoadServerConfigFromFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://headscale.example.com", config.ServerURL)
+	assert.Equal(t, "127.0.0.1:9090", config.MetricsAddr)
+	assert.Equal(t, "100.64.0.0/10", config.IPv4Prefix)
+	assert.Empty(t, config.IPv6Prefix)
+	assert.Equal(t, "random", config.IPAllocation)
+	assert.Equal(t, "sqlite", config.Database.Type)
+	assert.True(t, config.Database.SQLite.WriteAheadLog)
+	assert.Equal(t, []string{"https://controlplane.tailscale.com/derpmap/default"}, config.DERP.URLs)
+	assert.Equal(t, []DNSRecord{{Name: "grafana.tailnet.example.com", Type: "A", Value: "100.64.0.3"}}, config.DNS.ExtraRecords)
+	assert.Equal(t, "database", config.Policy.Mode)
+	assert.Equal(t, "info", config.LogLevel)
+	assert.Equal(t, 120*time.Second, config.EphemeralNodeInactivityTimeout)
+
+	// The loaded configuration is valid, and converts back to the
+	// same headscale configuration.
+	require.NoError(t, config.Validate())
+	hsConfig, err := config.ToHeadscaleConfig()
+	require.NoError(t, err)
+	assert.Equal(t, types.IPAllocationStrategyRandom, hsConfig.IPAllocation)
+	assert.Equal(t, types.DatabaseSqlite, hsConfig.Database.Type)
+	assert.Equal(t, "tailnet.example.com", hsConfig.DNSConfig.BaseDomain)
 }
 
 func TestServerCreation(t *testing.T) {
@@ -117,6 +357,366 @@ func TestServerCreation(t *testing.T) {
 	})
 }
 
+func TestServerInProcessClient(t *testing.T) {
+	tempDir := t.TempDir()
+
+	config := DefaultServerConfig()
+	config.Database.SQLite.Path = filepath.Join(tempDir, "test.db")
+	config.NoisePrivateKeyPath = filepath.Join(tempDir, "noise.key")
+	config.DERP.ServerPrivateKeyPath = filepath.Join(tempDir, "derp.key")
+	config.DERP.STUNAddr = "127.0.0.1:0"
+	config.UnixSocket = filepath.Join(tempDir, "headscale.sock")
+	config.ListenAddr = "127.0.0.1:0"
+	config.MetricsAddr = "127.0.0.1:0"
+	config.GRPCAddr = "" // Only in-process access
+
+	server, err := NewServer(config)
+	require.NoError(t, err)
+
+	_, err = server.Client()
+	assert.Error(t, err, "client of a server not running")
+
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := server.Client()
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	user, err := client.CreateUser(ctx, "in-process")
+	require.NoError(t, err)
+	assert.Equal(t, "in-process", user.GetName())
+
+	users, err := client.ListUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, user.GetId(), users[0].GetId())
+
+	_, err = client.CreateUser(ctx, "in-process")
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	_, err = client.GetNode(ctx, 1234)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = client.ListNodes(ctx, 1234)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	nodes, err := client.ListNodes(ctx, user.GetId())
+	require.NoError(t, err)
+	assert.Empty(t, nodes)
+
+	nodes, err = client.ListAllNodes(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, nodes)
+
+	changes, err := client.BackfillNodeIPs(ctx, true)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestServerHooks(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var (
+		mu       sync.Mutex
+		requests []*RegistrationRequest
+		added    []uint64
+		removed  []uint64
+		policies []string
+	)
+
+	config := DefaultServerConfig()
+	config.Database.SQLite.Path = filepath.Join(tempDir, "test.db")
+	config.NoisePrivateKeyPath = filepath.Join(tempDir, "noise.key")
+	config.DERP.ServerPrivateKeyPath = filepath.Join(tempDir, "derp.key")
+	config.DERP.STUNAddr = "127.0.0.1:0"
+	config.UnixSocket = filepath.Join(tempDir, "headscale.sock")
+	config.ListenAddr = "127.0.0.1:0"
+	config.MetricsAddr = "127.0.0.1:0"
+	config.GRPCAddr = ""
+	config.Policy.Mode = "database"
+	config.Hooks = Hooks{
+		Registration: RegistrationHookFunc(func(_ context.Context, req *RegistrationRequest) (*RegistrationDecision, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, req)
+
+			if req.Hostname == "denied" {
+				return &RegistrationDecision{Deny: true, Reason: "hostname not allowed"}, nil
+			}
+
+			return &RegistrationDecision{
+				Hostname: "hooked-" + req.Hostname,
+				Tags:     []string{"tag:hooked"},
+			}, nil
+		}),
+		NodeAdded: func(node *v1.Node) {
+			mu.Lock()
+			defer mu.Unlock()
+			added = append(added, node.GetId())
+		},
+		NodeRemoved: func(node *v1.Node) {
+			mu.Lock()
+			defer mu.Unlock()
+			removed = append(removed, node.GetId())
+		},
+		PolicyChanged: func(policy string) {
+			mu.Lock()
+			defer mu.Unlock()
+			policies = append(policies, policy)
+		},
+	}
+
+	server, err := NewServer(config)
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := server.Client()
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+
+	user, err := client.CreateUser(ctx, "hooks")
+	require.NoError(t, err)
+
+	deniedKey := types.MustRegistrationID().String()
+	_, err = client.DebugCreateNode(ctx, user.GetId(), deniedKey, "denied", nil)
+	require.NoError(t, err)
+
+	_, err = client.RegisterNode(ctx, user.GetId(), deniedKey)
+	require.ErrorIs(t, err, ErrPermissionDenied)
+	assert.Contains(t, err.Error(), "hostname not allowed")
+
+	allowedKey := types.MustRegistrationID().String()
+	_, err = client.DebugCreateNode(ctx, user.GetId(), allowedKey, "allowed", nil)
+	require.NoError(t, err)
+
+	node, err := client.RegisterNode(ctx, user.GetId(), allowedKey)
+	require.NoError(t, err)
+	assert.Equal(t, "hooked-allowed", node.GetName())
+	assert.Equal(t, []string{"tag:hooked"}, node.GetForcedTags())
+
+	policy := `{"acls": [{"action": "accept", "src": ["*"], "dst": ["*:*"]}]}`
+	require.NoError(t, client.SetPolicy(ctx, policy))
+
+	require.NoError(t, client.DeleteNode(ctx, node.GetId()))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "cli", requests[1].AuthMethod)
+	assert.Equal(t, "hooks", requests[1].User.GetName())
+	assert.Equal(t, []uint64{node.GetId()}, added)
+	assert.Equal(t, []uint64{node.GetId()}, removed)
+	assert.Equal(t, []string{policy}, policies)
+}
+
+// syncBuffer is a buffer safe to write and read concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestMultipleServers(t *testing.T) {
+	type instance struct {
+		name   string
+		level  string
+		logs   *syncBuffer
+		server ControlPlaneServer
+		client ControlPlaneClient
+	}
+
+	instances := []*instance{
+		{name: "first", level: "info"},
+		{name: "second", level: "error"},
+	}
+
+	for _, inst := range instances {
+		tempDir := t.TempDir()
+
+		inst.logs = new(syncBuffer)
+		logger := zerolog.New(inst.logs)
+
+		config := DefaultServerConfig()
+		config.Database.SQLite.Path = filepath.Join(tempDir, "test.db")
+		config.NoisePrivateKeyPath = filepath.Join(tempDir, "noise.key")
+		config.DERP.ServerPrivateKeyPath = filepath.Join(tempDir, "derp.key")
+		config.DERP.STUNAddr = "127.0.0.1:0"
+		config.UnixSocket = filepath.Join(tempDir, "headscale.sock")
+		config.ListenAddr = "127.0.0.1:0"
+		config.MetricsAddr = "127.0.0.1:0"
+		config.GRPCAddr = ""
+		config.LogLevel = inst.level
+		config.Logger = &logger
+
+		server, err := NewServer(config)
+		require.NoError(t, err)
+		inst.server = server
+	}
+
+	var wg sync.WaitGroup
+	for _, inst := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, inst.server.Start(), inst.name)
+		}()
+	}
+	wg.Wait()
+
+	ctx := context.Background()
+	for _, inst := range instances {
+		defer inst.server.Stop()
+
+		client, err := inst.server.Client()
+		require.NoError(t, err)
+		defer client.Close()
+		inst.client = client
+
+		_, err = client.CreateUser(ctx, "same-name")
+		require.NoError(t, err, "users of one server must not conflict with the other")
+	}
+
+	// Register a node on the first server only, it must not show up in
+	// the nodes or the metrics of the second one.
+	user, err := instances[0].client.ListUsers(ctx)
+	require.NoError(t, err)
+	regID, err := types.NewRegistrationID()
+	require.NoError(t, err)
+	_, err = instances[0].client.DebugCreateNode(ctx, user[0].GetId(), regID.String(), "node", nil)
+	require.NoError(t, err)
+	_, err = instances[0].client.RegisterNode(ctx, user[0].GetId(), regID.String())
+	require.NoError(t, err)
+
+	for i, inst := range instances {
+		nodes, err := inst.client.ListAllNodes(ctx)
+		require.NoError(t, err)
+		assert.Len(t, nodes, 1-i, inst.name)
+
+		rec := httptest.NewRecorder()
+		inst.server.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), fmt.Sprintf("headscale_nodestore_nodes %d\n", 1-i), inst.name)
+	}
+
+	// Each server logs through its own logger, at its own level.
+	assert.Contains(t, instances[0].logs.String(), "Control plane server started")
+	assert.NotContains(t, instances[1].logs.String(), "Control plane server started")
+}
+
+func TestClientRetry(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+
+	tests := []struct {
+		name       string
+		idempotent bool
+		errs       []error
+		wantCalls  int
+		wantErr    error
+	}{
+		{
+			name:       "idempotent-retried",
+			idempotent: true,
+			errs:       []error{unavailable, unavailable, nil},
+			wantCalls:  3,
+		},
+		{
+			name:       "idempotent-attempts-exhausted",
+			idempotent: true,
+			errs:       []error{unavailable, unavailable, unavailable, nil},
+			wantCalls:  3,
+			wantErr:    ErrUnavailable,
+		},
+		{
+			name:      "not-idempotent",
+			errs:      []error{unavailable, nil},
+			wantCalls: 1,
+			wantErr:   ErrUnavailable,
+		},
+		{
+			name:       "not-retryable",
+			idempotent: true,
+			errs:       []error{status.Error(codes.NotFound, "node not found"), nil},
+			wantCalls:  1,
+			wantErr:    ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &client{config: &ClientConfig{
+				Timeout: time.Second,
+				Retry: RetryConfig{
+					MaxAttempts:    3,
+					InitialBackoff: time.Millisecond,
+					MaxBackoff:     time.Millisecond,
+				},
+			}}
+
+			calls := 0
+			_, err := call(context.Background(), c, tt.idempotent, func(ctx context.Context) (struct{}, error) {
+				_, hasDeadline := ctx.Deadline()
+				assert.True(t, hasDeadline, "call without timeout")
+
+				err := tt.errs[calls]
+				calls++
+
+				return struct{}{}, err
+			})
+
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClientTransportCredentials(t *testing.T) {
+	creds, err := transportCredentials(&ClientConfig{Address: "unix:///var/run/headscale/headscale.sock"})
+	require.NoError(t, err)
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	creds, err = transportCredentials(&ClientConfig{Address: "headscale.example.com:50443"})
+	require.NoError(t, err)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+
+	_, err = transportCredentials(&ClientConfig{
+		Address:    "headscale.example.com:50443",
+		CACertPath: filepath.Join(t.TempDir(), "missing.pem"),
+	})
+	assert.Error(t, err)
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caPath, []byte("not a certificate"), 0o600))
+	_, err = transportCredentials(&ClientConfig{
+		Address:    "headscale.example.com:50443",
+		CACertPath: caPath,
+	})
+	assert.ErrorContains(t, err, "failed to parse CA certificate")
+}
+
 func TestEnsureDirectories(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -0,0 +1,250 @@
+// Package controlplanetest runs an isolated headscale control plane in the
+// test process, with in-process tailnet clients, to test ACLs, routes and
+// connectivity with plain `go test`, without Docker.
+//
+// The embedded DERP server is served over plain HTTP on loopback, which
+// requires the TS_DEBUG_USE_DERP_HTTP knob of the Tailscale client to be set.
+// New sets it for the whole process.
+package controlplanetest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/lib/controlplane"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/envknob"
+)
+
+// DefaultTimeout is how long the helpers wait for the tailnet to converge.
+const DefaultTimeout = 60 * time.Second
+
+// Harness is a headscale control plane running in the test process.
+type Harness struct {
+	t testing.TB
+
+	// URL is the URL of the control plane, used by the nodes.
+	URL string
+
+	// Config is the configuration the control plane was started with.
+	Config *controlplane.ServerConfig
+
+	// Server is the control plane server.
+	Server controlplane.ControlPlaneServer
+
+	// Client is an in-process client of the control plane.
+	Client controlplane.ControlPlaneClient
+
+	dir string
+
+	mu    sync.Mutex
+	users map[string]*v1.User
+	nodes []*Node
+}
+
+type options struct {
+	policy    string
+	configure []func(*controlplane.ServerConfig)
+}
+
+// Option configures the harness.
+type Option func(*options)
+
+// WithPolicy sets the ACL policy of the control plane before any node joins.
+func WithPolicy(policy string) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// WithConfig modifies the server configuration before the control plane is
+// started.
+func WithConfig(fn func(*controlplane.ServerConfig)) Option {
+	return func(o *options) {
+		o.configure = append(o.configure, fn)
+	}
+}
+
+// New starts a control plane with a temporary SQLite database, listening on
+// random loopback ports, with the embedded DERP server enabled. It is
+// stopped, together with all its nodes, when the test finishes.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	envknob.Setenv("TS_DEBUG_USE_DERP_HTTP", "true")
+
+	dir := t.TempDir()
+	httpPort := freePort(t, "tcp")
+	stunPort := freePort(t, "udp")
+
+	config := controlplane.DefaultServerConfig()
+	config.ServerURL = fmt.Sprintf("http://127.0.0.1:%d", httpPort)
+	config.ListenAddr = fmt.Sprintf("127.0.0.1:%d", httpPort)
+	config.MetricsAddr = "127.0.0.1:0"
+	config.GRPCAddr = ""
+	config.UnixSocket = filepath.Join(dir, "headscale.sock")
+	config.Database.SQLite.Path = filepath.Join(dir, "headscale.db")
+	config.NoisePrivateKeyPath = filepath.Join(dir, "noise_private.key")
+	config.DERP.ServerPrivateKeyPath = filepath.Join(dir, "derp_private.key")
+	config.DERP.STUNAddr = fmt.Sprintf("127.0.0.1:%d", stunPort)
+	config.DERP.IPv4 = "127.0.0.1"
+	config.DNS.BaseDomain = "tailnet.test"
+	config.Policy.Mode = "database"
+	config.LogLevel = "warn"
+
+	for _, fn := range o.configure {
+		fn(config)
+	}
+
+	server, err := controlplane.NewServer(config)
+	require.NoError(t, err, "creating control plane")
+	require.NoError(t, server.Start(), "starting control plane")
+
+	client, err := server.Client()
+	require.NoError(t, err, "creating control plane client")
+
+	h := &Harness{
+		t:      t,
+		URL:    config.ServerURL,
+		Config: config,
+		Server: server,
+		Client: client,
+		dir:    dir,
+		users:  make(map[string]*v1.User),
+	}
+	t.Cleanup(h.close)
+
+	h.waitForHealthy()
+
+	if o.policy != "" {
+		require.NoError(t, client.SetPolicy(context.Background(), o.policy), "setting policy")
+	}
+
+	return h
+}
+
+// close stops all the nodes and the control plane.
+func (h *Harness) close() {
+	h.mu.Lock()
+	nodes := h.nodes
+	h.nodes = nil
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node.Server.Close()
+		}()
+	}
+	wg.Wait()
+
+	h.Client.Close()
+	assert.NoError(h.t, h.Server.Stop(), "stopping control plane")
+
+	// The control plane has shut down, nothing listens on its port anymore.
+	conn, err := net.DialTimeout("tcp", h.Config.ListenAddr, time.Second)
+	if err == nil {
+		conn.Close()
+	}
+	assert.Error(h.t, err, "control plane still listening on %s after it stopped", h.Config.ListenAddr)
+}
+
+// waitForHealthy waits until the control plane answers HTTP requests.
+func (h *Harness) waitForHealthy() {
+	h.t.Helper()
+
+	require.EventuallyWithT(h.t, func(c *assert.CollectT) {
+		resp, err := http.Get(h.URL + "/health")
+		if !assert.NoError(c, err) {
+			return
+		}
+		resp.Body.Close()
+		assert.Equal(c, http.StatusOK, resp.StatusCode)
+	}, DefaultTimeout, 50*time.Millisecond, "control plane did not become healthy")
+}
+
+// User returns the user with the given name, creating it if needed.
+func (h *Harness) User(name string) *v1.User {
+	h.t.Helper()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if user, ok := h.users[name]; ok {
+		return user
+	}
+
+	user, err := h.Client.CreateUser(context.Background(), name)
+	require.NoError(h.t, err, "creating user %q", name)
+	h.users[name] = user
+
+	return user
+}
+
+// Nodes returns all the nodes attached to the control plane.
+func (h *Harness) Nodes() []*Node {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]*Node(nil), h.nodes...)
+}
+
+// WaitForNetmaps waits until every node sees every other node as a peer.
+// It is only suited for policies allowing all nodes to reach each other.
+func (h *Harness) WaitForNetmaps() {
+	h.t.Helper()
+
+	nodes := h.Nodes()
+	for _, node := range nodes {
+		var peers []*Node
+		for _, peer := range nodes {
+			if peer != node {
+				peers = append(peers, peer)
+			}
+		}
+		node.WaitForPeers(h.t, peers...)
+	}
+}
+
+// freePort returns a port on loopback that is free at the time of the call.
+func freePort(t testing.TB, network string) int {
+	t.Helper()
+
+	var addr net.Addr
+	switch network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+		addr = conn.LocalAddr()
+	default:
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		addr = listener.Addr()
+	}
+
+	_, port, err := net.SplitHostPort(addr.String())
+	require.NoError(t, err)
+
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	return p
+}
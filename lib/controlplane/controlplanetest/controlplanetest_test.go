@@ -0,0 +1,308 @@
+package controlplanetest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/lib/controlplane"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessPing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in-process tailnet test in short mode")
+	}
+
+	h := New(t)
+	nodes := h.AddNodes(2)
+	h.WaitForNetmaps()
+
+	AssertCanSee(t, nodes[0], nodes[1])
+	AssertCanPing(t, nodes[0], nodes[1])
+	AssertCanPing(t, nodes[1], nodes[0])
+}
+
+func TestHarnessPolicy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in-process tailnet test in short mode")
+	}
+
+	h := New(t, WithPolicy(`{
+		"acls": [
+			{"action": "accept", "src": ["alice@"], "dst": ["bob@:*"]}
+		]
+	}`))
+
+	alice := h.AddNode("alice-laptop", WithUser("alice"))
+	bob := h.AddNode("bob-server", WithUser("bob"))
+	mallory := h.AddNode("mallory-laptop", WithUser("mallory"))
+
+	alice.WaitForPeers(t, bob)
+	bob.WaitForPeers(t, alice)
+	mallory.WaitForPeers(t)
+
+	AssertCannotSee(t, mallory, alice)
+	AssertCanPing(t, alice, bob)
+
+	nodes, err := h.Client.ListAllNodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, nodes, 3)
+}
+
+func TestHarnessHooks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in-process tailnet test in short mode")
+	}
+
+	var (
+		mu      sync.Mutex
+		methods []string
+		online  = map[uint64]bool{}
+	)
+
+	h := New(t, WithConfig(func(c *controlplane.ServerConfig) {
+		c.Hooks = controlplane.Hooks{
+			Registration: controlplane.RegistrationHookFunc(
+				func(_ context.Context, req *controlplane.RegistrationRequest) (*controlplane.RegistrationDecision, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					methods = append(methods, req.AuthMethod)
+
+					return &controlplane.RegistrationDecision{Tags: []string{"tag:hooked"}}, nil
+				},
+			),
+			NodeOnline: func(node *v1.Node) {
+				mu.Lock()
+				defer mu.Unlock()
+				online[node.GetId()] = true
+			},
+		}
+	}))
+
+	h.AddNode("hooked")
+	h.WaitForNetmaps()
+
+	nodes, err := h.Client.ListAllNodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, []string{"tag:hooked"}, nodes[0].GetForcedTags())
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return online[nodes[0].GetId()]
+	}, 10*time.Second, 50*time.Millisecond, "node online hook not called")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{"authkey"}, methods)
+}
+
+func TestHarnessPreAuthKeyConstraints(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in-process tailnet test in short mode")
+	}
+
+	h := New(t)
+	ctx := context.Background()
+
+	user := h.User("fleet")
+	expiration := time.Now().Add(time.Hour)
+	key, err := h.Client.CreatePreAuthKeyWithOptions(ctx, user.GetId(), controlplane.PreAuthKeyOptions{
+		Expiration:      &expiration,
+		Description:     "fleet enrollment",
+		MaxUses:         2,
+		HostnamePattern: "fleet-*",
+		AllowedOS:       []string{runtime.GOOS},
+		NodeExpiry:      24 * time.Hour,
+		ApprovedRoutes:  []string{"10.10.0.0/24"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "fleet enrollment", key.GetDescription())
+
+	h.AddNode("fleet-1", WithUser("fleet"), WithAuthKey(key.GetKey()))
+	h.AddNode("fleet-2", WithUser("fleet"), WithAuthKey(key.GetKey()))
+
+	nodes, err := h.Client.ListNodesByPreAuthKey(ctx, key.GetId())
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+
+	for _, node := range nodes {
+		assert.Equal(t, []string{"10.10.0.0/24"}, node.GetApprovedRoutes())
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), node.GetExpiry().AsTime(), time.Minute)
+	}
+
+	keys, err := h.Client.ListPreAuthKeys(ctx, user.GetId())
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, uint32(2), keys[0].GetUseCount())
+	assert.True(t, keys[0].GetUsed())
+	assert.Empty(t, keys[0].GetKey())
+}
+
+func TestHarnessOAuthClient(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in-process tailnet test in short mode")
+	}
+
+	h := New(t)
+	ctx := context.Background()
+	user := h.User("ci")
+
+	oauthClient, secret, err := h.Client.CreateOAuthClient(ctx, controlplane.OAuthClientOptions{
+		Scopes: []string{"auth_keys", "nodes:read"},
+		Tags:   []string{"tag:ci"},
+	})
+	require.NoError(t, err)
+
+	resp, err := http.PostForm(h.URL+"/oauth/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {oauthClient.GetClientId()},
+		"client_secret": {secret},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&token))
+
+	api := func(method, path, body string) int {
+		req, err := http.NewRequest(method, h.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, api(http.MethodGet, "/api/v1/node", ""))
+	assert.Equal(t, http.StatusForbidden, api(http.MethodPost, "/api/v1/user", `{"name": "mallory"}`))
+	assert.Equal(t, http.StatusForbidden, api(http.MethodPost, "/api/v1/preauthkey",
+		fmt.Sprintf(`{"user": %d}`, user.GetId())))
+	assert.Equal(t, http.StatusOK, api(http.MethodPost, "/api/v1/preauthkey",
+		fmt.Sprintf(`{"user": %d, "aclTags": ["tag:ci"]}`, user.GetId())))
+
+	require.NoError(t, h.Client.DeleteOAuthClient(ctx, oauthClient.GetClientId()))
+	assert.Equal(t, http.StatusUnauthorized, api(http.MethodGet, "/api/v1/node", ""))
+}
+
+func TestHarnessWorkloadIdentity(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in-process tailnet test in short mode")
+	}
+
+	issuer := newTestIssuer(t)
+
+	h := New(t, WithConfig(func(c *controlplane.ServerConfig) {
+		c.WorkloadIdentity = []controlplane.WorkloadIdentityIssuer{{
+			Issuer:   issuer.URL,
+			Audience: "headscale",
+			Subject:  "repo:example/*:ref:refs/heads/main",
+			Claims:   map[string]string{"environment": "ci"},
+			User:     "ci",
+			Tags:     []string{"tag:ci"},
+		}}
+	}))
+
+	token := issuer.sign(t, map[string]any{
+		"aud":         "headscale",
+		"sub":         "repo:example/app:ref:refs/heads/main",
+		"environment": "ci",
+	})
+
+	h.AddNode("runner", WithUser("ci"), WithAuthKey(token))
+
+	nodes, err := h.Client.ListAllNodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "ci", nodes[0].GetUser().GetName())
+	assert.Equal(t, []string{"tag:ci"}, nodes[0].GetForcedTags())
+	assert.Equal(t, v1.RegisterMethod_REGISTER_METHOD_WORKLOAD_IDENTITY, nodes[0].GetRegisterMethod())
+}
+
+// testIssuer is an OIDC issuer serving its discovery document and keys,
+// signing tokens with RS256.
+type testIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	issuer := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                issuer.URL,
+			"jwks_uri":                              issuer.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	return issuer
+}
+
+func (i *testIssuer) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	claims["iss"] = i.URL
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
@@ -0,0 +1,295 @@
+package controlplanetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/client/local"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tsnet"
+	"tailscale.com/types/logger"
+)
+
+// Node is an in-process tailnet client attached to the control plane.
+type Node struct {
+	// Name is the hostname of the node.
+	Name string
+
+	// User is the user the node is registered to.
+	User *v1.User
+
+	// Server is the embedded Tailscale client.
+	Server *tsnet.Server
+
+	// LocalClient talks to the Tailscale client, e.g. to read its status.
+	LocalClient *local.Client
+}
+
+type nodeOptions struct {
+	user      string
+	tags      []string
+	routes    []netip.Prefix
+	ephemeral bool
+	authKey   string
+	logf      logger.Logf
+}
+
+// NodeOption configures a node.
+type NodeOption func(*nodeOptions)
+
+// WithUser registers the node to the given user, created if needed.
+// Nodes are registered to the "test" user by default.
+func WithUser(name string) NodeOption {
+	return func(o *nodeOptions) {
+		o.user = name
+	}
+}
+
+// WithTags registers the node with a pre-auth key carrying the given tags.
+func WithTags(tags ...string) NodeOption {
+	return func(o *nodeOptions) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+// WithRoutes makes the node advertise the given routes.
+func WithRoutes(routes ...netip.Prefix) NodeOption {
+	return func(o *nodeOptions) {
+		o.routes = append(o.routes, routes...)
+	}
+}
+
+// WithEphemeral registers the node as an ephemeral node.
+func WithEphemeral() NodeOption {
+	return func(o *nodeOptions) {
+		o.ephemeral = true
+	}
+}
+
+// WithAuthKey registers the node with the given pre-auth key, instead of
+// a pre-auth key created for the node. The key must belong to the user of
+// the node.
+func WithAuthKey(key string) NodeOption {
+	return func(o *nodeOptions) {
+		o.authKey = key
+	}
+}
+
+// WithLogs sends the logs of the Tailscale client to the test log.
+func WithLogs() NodeOption {
+	return func(o *nodeOptions) {
+		o.logf = nil
+	}
+}
+
+// AddNode starts an in-process Tailscale client with the given hostname,
+// registers it with a pre-auth key, and waits until it is running.
+func (h *Harness) AddNode(name string, opts ...NodeOption) *Node {
+	h.t.Helper()
+
+	o := nodeOptions{
+		user: "test",
+		logf: logger.Discard,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logf == nil {
+		o.logf = h.t.Logf
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	user := h.User(o.user)
+	if o.authKey == "" {
+		expiration := time.Now().Add(time.Hour)
+		key, err := h.Client.CreatePreAuthKey(ctx, user.GetId(), false, o.ephemeral, &expiration, o.tags)
+		require.NoError(h.t, err, "creating pre-auth key for %q", name)
+
+		o.authKey = key.GetKey()
+	}
+
+	srv := &tsnet.Server{
+		Dir:        filepath.Join(h.dir, "nodes", name),
+		Hostname:   name,
+		ControlURL: h.URL,
+		AuthKey:    o.authKey,
+		Ephemeral:  o.ephemeral,
+		Logf:       o.logf,
+		UserLogf:   o.logf,
+	}
+
+	node := &Node{
+		Name:   name,
+		User:   user,
+		Server: srv,
+	}
+
+	h.mu.Lock()
+	h.nodes = append(h.nodes, node)
+	h.mu.Unlock()
+
+	_, err := srv.Up(ctx)
+	require.NoError(h.t, err, "starting node %q", name)
+
+	node.LocalClient, err = srv.LocalClient()
+	require.NoError(h.t, err, "connecting to node %q", name)
+
+	if len(o.routes) > 0 {
+		_, err := node.LocalClient.EditPrefs(ctx, &ipn.MaskedPrefs{
+			Prefs: ipn.Prefs{
+				AdvertiseRoutes: o.routes,
+			},
+			AdvertiseRoutesSet: true,
+		})
+		require.NoError(h.t, err, "advertising routes of node %q", name)
+	}
+
+	return node
+}
+
+// AddNodes starts count nodes named node-1, node-2, etc, numbered after
+// the nodes already attached.
+func (h *Harness) AddNodes(count int, opts ...NodeOption) []*Node {
+	h.t.Helper()
+
+	first := len(h.Nodes()) + 1
+	nodes := make([]*Node, 0, count)
+	for i := range count {
+		nodes = append(nodes, h.AddNode(fmt.Sprintf("node-%d", first+i), opts...))
+	}
+
+	return nodes
+}
+
+// IPv4 returns the Tailscale IPv4 address of the node.
+func (n *Node) IPv4() netip.Addr {
+	ip4, _ := n.Server.TailscaleIPs()
+	return ip4
+}
+
+// IPv6 returns the Tailscale IPv6 address of the node.
+func (n *Node) IPv6() netip.Addr {
+	_, ip6 := n.Server.TailscaleIPs()
+	return ip6
+}
+
+// Status returns the current status of the node, including its peers.
+func (n *Node) Status(ctx context.Context) (*ipnstate.Status, error) {
+	return n.LocalClient.Status(ctx)
+}
+
+// Peers returns the names of the peers in the current netmap of the node.
+func (n *Node) Peers(ctx context.Context) ([]string, error) {
+	status, err := n.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]string, 0, len(status.Peer))
+	for _, peer := range status.Peer {
+		peers = append(peers, peer.HostName)
+	}
+	slices.Sort(peers)
+
+	return peers, nil
+}
+
+// CanSee returns true if peer is in the current netmap of the node.
+func (n *Node) CanSee(ctx context.Context, peer *Node) (bool, error) {
+	peers, err := n.Peers(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(peers, peer.Name), nil
+}
+
+// WaitForPeers waits until the netmap of the node contains exactly the
+// given peers.
+func (n *Node) WaitForPeers(t testing.TB, peers ...*Node) {
+	t.Helper()
+
+	want := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		want = append(want, peer.Name)
+	}
+	slices.Sort(want)
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		got, err := n.Peers(context.Background())
+		if assert.NoError(c, err) {
+			assert.Equal(c, want, got)
+		}
+	}, DefaultTimeout, 100*time.Millisecond, "netmap of %q did not converge", n.Name)
+}
+
+// Ping sends a disco ping to peer, going over DERP or a direct path on
+// loopback, and returns an error if it is not answered.
+func (n *Node) Ping(ctx context.Context, peer *Node) error {
+	result, err := n.LocalClient.Ping(ctx, peer.IPv4(), tailcfg.PingDisco)
+	if err != nil {
+		return err
+	}
+
+	if result.Err != "" {
+		return errors.New(result.Err)
+	}
+
+	return nil
+}
+
+// Dial opens a TCP connection to the given port of peer over the tailnet,
+// subject to the ACL policy.
+func (n *Node) Dial(ctx context.Context, peer *Node, port uint16) (net.Conn, error) {
+	return n.Server.Dial(ctx, "tcp", net.JoinHostPort(peer.IPv4().String(), strconv.Itoa(int(port))))
+}
+
+// AssertCanSee asserts that peer is, or eventually becomes, visible to from.
+func AssertCanSee(t testing.TB, from, peer *Node) {
+	t.Helper()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		ok, err := from.CanSee(context.Background(), peer)
+		if assert.NoError(c, err) {
+			assert.True(c, ok)
+		}
+	}, DefaultTimeout, 100*time.Millisecond, "%q cannot see %q", from.Name, peer.Name)
+}
+
+// AssertCannotSee asserts that peer is not visible to from. The netmap of
+// from should be up to date, e.g. by waiting for it with WaitForPeers.
+func AssertCannotSee(t testing.TB, from, peer *Node) {
+	t.Helper()
+
+	ok, err := from.CanSee(context.Background(), peer)
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "%q can see %q", from.Name, peer.Name)
+	}
+}
+
+// AssertCanPing asserts that from can, or eventually can, ping peer.
+func AssertCanPing(t testing.TB, from, peer *Node) {
+	t.Helper()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		assert.NoError(c, from.Ping(ctx, peer))
+	}, DefaultTimeout, 100*time.Millisecond, "%q cannot ping %q", from.Name, peer.Name)
+}
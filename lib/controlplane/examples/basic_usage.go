@@ -85,7 +85,7 @@ func main() {
 	}
 	fmt.Printf("Pre-auth keys for user %s: %d\n", user.Name, len(keys))
 	for _, key := range keys {
-		fmt.Printf("  - %s (Used: %t, Reusable: %t)\n", key.Key, key.Used, key.Reusable)
+		fmt.Printf("  - %s (Used: %t, Reusable: %t)\n", key.Prefix, key.Used, key.Reusable)
 	}
 
 	// Create an API key
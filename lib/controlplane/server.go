@@ -3,19 +3,38 @@ package controlplane
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"sync"
 
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
 	"github.com/juanfont/headscale/hscontrol"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
 )
 
+// localBufferSize is the buffer size of the in-memory connection used by
+// in-process clients
+const localBufferSize = 1024 * 1024
+
 // server implements the ControlPlaneServer interface
 type server struct {
 	config    *ServerConfig
+	logger    zerolog.Logger
 	headscale *hscontrol.Headscale
 	running   bool
 	mu        sync.RWMutex
-	stopCh    chan struct{}
+
+	// cancel stops headscale, done is closed once it has shut down
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// local serves the headscale API in-process for clients created with Client
+	local         *grpc.Server
+	localListener *bufconn.Listener
 }
 
 // NewServer creates a new control plane server with the given configuration
@@ -34,9 +53,18 @@ func NewServer(config *ServerConfig) (ControlPlaneServer, error) {
 		return nil, fmt.Errorf("failed to create directories: %w", err)
 	}
 
+	logger := log.Logger
+	if config.Logger != nil {
+		logger = *config.Logger
+	}
+	level, err := parseLogLevel(config.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	return &server{
 		config: config,
-		stopCh: make(chan struct{}),
+		logger: logger.Level(level),
 	}, nil
 }
 
@@ -61,16 +89,31 @@ func (s *server) Start() error {
 		return fmt.Errorf("failed to create headscale instance: %w", err)
 	}
 
+	// Serve the API in-process, for clients created with Client
+	s.localListener = bufconn.Listen(localBufferSize)
+	s.local = grpc.NewServer(grpc.UnaryInterceptor(hscontrol.UnaryErrorInterceptor))
+	v1.RegisterHeadscaleServiceServer(s.local, s.headscale.APIServer())
+	go func(local *grpc.Server, listener net.Listener) {
+		if err := local.Serve(listener); err != nil {
+			s.logger.Error().Err(err).Msg("In-process gRPC server error")
+		}
+	}(s.local, s.localListener)
+
 	// Start the server in a goroutine
-	go func() {
-		log.Info().Msg("Starting headscale control plane server")
-		if err := s.headscale.Serve(); err != nil {
-			log.Error().Err(err).Msg("Headscale server error")
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go func(headscale *hscontrol.Headscale, done chan struct{}) {
+		defer close(done)
+
+		s.logger.Info().Msg("Starting headscale control plane server")
+		if err := headscale.Serve(ctx); err != nil {
+			s.logger.Error().Err(err).Msg("Headscale server error")
 		}
-	}()
+	}(s.headscale, s.done)
 
 	s.running = true
-	log.Info().
+	s.logger.Info().
 		Str("grpc_addr", s.config.GRPCAddr).
 		Str("http_addr", s.config.ListenAddr).
 		Msg("Control plane server started")
@@ -87,19 +130,23 @@ func (s *server) Stop() error {
 		return fmt.Errorf("server is not running")
 	}
 
-	log.Info().Msg("Stopping headscale control plane server")
+	s.logger.Info().Msg("Stopping headscale control plane server")
 
-	// Signal stop
-	close(s.stopCh)
+	// Stop the in-process clients before the database is closed
+	s.local.Stop()
+	s.local = nil
+	s.localListener = nil
 
-	// Note: headscale doesn't have a clean shutdown method in the current version
-	// This is a limitation of the current headscale implementation
-	// In a production environment, you might want to implement proper shutdown handling
+	// Shut headscale down gracefully and wait for it
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+	s.done = nil
 
 	s.running = false
 	s.headscale = nil
 
-	log.Info().Msg("Control plane server stopped")
+	s.logger.Info().Msg("Control plane server stopped")
 	return nil
 }
 
@@ -117,6 +164,52 @@ func (s *server) IsRunning() bool {
 	return s.running
 }
 
+// Client returns a client connected to the server in-process, without going
+// through the network or requiring an API key. The client must be closed when
+// no longer used, and stops working when the server is stopped.
+func (s *server) Client() (ControlPlaneClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.running {
+		return nil, fmt.Errorf("server is not running")
+	}
+
+	listener := s.localListener
+	conn, err := grpc.NewClient(
+		"passthrough:///in-process",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create in-process client: %w", err)
+	}
+
+	config := DefaultClientConfig()
+	config.Address = ""
+
+	return newClient(conn, config), nil
+}
+
+// MetricsHandler serves the Prometheus metrics of the server. Every server
+// has its own metrics, so several servers can run in one process.
+func (s *server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		headscale := s.headscale
+		s.mu.RUnlock()
+
+		if headscale == nil {
+			http.Error(w, "server is not running", http.StatusServiceUnavailable)
+			return
+		}
+
+		headscale.MetricsHandler().ServeHTTP(w, r)
+	})
+}
+
 // GetConfig returns the server configuration
 func (s *server) GetConfig() *ServerConfig {
 	s.mu.RLock()
@@ -131,13 +224,7 @@ func (s *server) WaitForReady(ctx context.Context) error {
 	}
 
 	// Create a simple client to test connectivity
-	clientConfig := &ClientConfig{
-		Address:  s.GetGRPCAddress(),
-		Insecure: s.config.GRPCAllowInsecure,
-		Timeout:  s.config.EphemeralNodeInactivityTimeout,
-	}
-
-	client, err := NewClient(clientConfig)
+	client, err := s.Client()
 	if err != nil {
 		return fmt.Errorf("failed to create test client: %w", err)
 	}
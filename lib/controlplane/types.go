@@ -2,9 +2,13 @@ package controlplane
 
 import (
 	"context"
+	"io/fs"
+	"net/http"
 	"time"
 
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog"
 )
 
 // ControlPlaneServer represents a headscale control plane server instance
@@ -20,6 +24,15 @@ type ControlPlaneServer interface {
 
 	// IsRunning returns true if the server is currently running
 	IsRunning() bool
+
+	// Client returns a client connected to the server in-process, without
+	// the gRPC listener or an API key
+	Client() (ControlPlaneClient, error)
+
+	// MetricsHandler serves the Prometheus metrics of this server, also
+	// served on MetricsAddr, e.g. to mount them on an application's own
+	// HTTP server
+	MetricsHandler() http.Handler
 }
 
 // ControlPlaneClient provides a high-level interface for managing the control plane
@@ -28,21 +41,36 @@ type ControlPlaneClient interface {
 	CreateUser(ctx context.Context, name string) (*v1.User, error)
 	ListUsers(ctx context.Context) ([]*v1.User, error)
 	DeleteUser(ctx context.Context, userID uint64) error
+	DeleteUserWithOptions(ctx context.Context, userID uint64, opts DeleteUserOptions) error
+	DisableUser(ctx context.Context, userID uint64) (*v1.User, error)
+	EnableUser(ctx context.Context, userID uint64) (*v1.User, error)
+	SetUserQuota(ctx context.Context, userID uint64, quota *v1.QuotaLimits) (*v1.User, error)
 	RenameUser(ctx context.Context, userID uint64, newName string) (*v1.User, error)
+	MergeUsers(ctx context.Context, fromID, intoID uint64) (*v1.User, error)
+	ListUserLinks(ctx context.Context, userID uint64) ([]*v1.UserLink, error)
 
 	// Node Management
 	ListNodes(ctx context.Context, userID uint64) ([]*v1.Node, error)
+	ListAllNodes(ctx context.Context) ([]*v1.Node, error)
+	ListNodesWithOptions(ctx context.Context, opts ListNodesOptions) ([]*v1.Node, string, error)
 	GetNode(ctx context.Context, nodeID uint64) (*v1.Node, error)
 	DeleteNode(ctx context.Context, nodeID uint64) error
 	ExpireNode(ctx context.Context, nodeID uint64) (*v1.Node, error)
 	RenameNode(ctx context.Context, nodeID uint64, newName string) (*v1.Node, error)
 	MoveNode(ctx context.Context, nodeID uint64, userID uint64) (*v1.Node, error)
 	RegisterNode(ctx context.Context, userID uint64, key string) (*v1.Node, error)
+	SetTags(ctx context.Context, nodeID uint64, tags []string) (*v1.Node, error)
+	LabelNode(ctx context.Context, nodeID uint64, labels map[string]string, remove []string) (*v1.Node, error)
+	SetApprovedRoutes(ctx context.Context, nodeID uint64, routes []string) (*v1.Node, error)
+	BackfillNodeIPs(ctx context.Context, confirmed bool) ([]string, error)
+	DebugCreateNode(ctx context.Context, userID uint64, key string, name string, routes []string) (*v1.Node, error)
 
 	// Pre-auth Key Management
 	CreatePreAuthKey(ctx context.Context, userID uint64, reusable bool, ephemeral bool, expiration *time.Time, aclTags []string) (*v1.PreAuthKey, error)
+	CreatePreAuthKeyWithOptions(ctx context.Context, userID uint64, opts PreAuthKeyOptions) (*v1.PreAuthKey, error)
 	ListPreAuthKeys(ctx context.Context, userID uint64) ([]*v1.PreAuthKey, error)
 	ExpirePreAuthKey(ctx context.Context, userID uint64, key string) error
+	ListNodesByPreAuthKey(ctx context.Context, keyID uint64) ([]*v1.Node, error)
 
 	// API Key Management
 	CreateAPIKey(ctx context.Context, expiration *time.Time) (string, error)
@@ -50,14 +78,119 @@ type ControlPlaneClient interface {
 	ExpireAPIKey(ctx context.Context, prefix string) error
 	DeleteAPIKey(ctx context.Context, prefix string) error
 
+	// OAuth Client Management
+	CreateOAuthClient(ctx context.Context, opts OAuthClientOptions) (*v1.OAuthClient, string, error)
+	ListOAuthClients(ctx context.Context) ([]*v1.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, clientID string) error
+
+	// Invite Management
+	CreateInvite(ctx context.Context, opts InviteOptions) (*v1.Invite, string, error)
+	ListInvites(ctx context.Context) ([]*v1.Invite, error)
+	RevokeInvite(ctx context.Context, id uint64) (*v1.Invite, error)
+
 	// Policy Management
 	GetPolicy(ctx context.Context) (string, error)
 	SetPolicy(ctx context.Context, policy string) error
 
+	// DNS Records Management
+	ListDNSRecords(ctx context.Context) ([]*v1.DNSRecord, error)
+	SetDNSRecords(ctx context.Context, records []*v1.DNSRecord) ([]*v1.DNSRecord, error)
+
 	// Connection Management
 	Close() error
 }
 
+// DeleteUserOptions tells DeleteUserWithOptions what to do with the nodes
+// of the user, a user with nodes is not deleted without options
+type DeleteUserOptions struct {
+	// TransferTo is the ID of the user the nodes and pre-auth keys move to
+	TransferTo uint64
+
+	// DeleteNodes deletes the nodes of the user
+	DeleteNodes bool
+
+	// ExpireNodes expires the nodes moved with TransferTo
+	ExpireNodes bool
+}
+
+// PreAuthKeyOptions describes a pre-auth key to create
+type PreAuthKeyOptions struct {
+	Reusable   bool
+	Ephemeral  bool
+	Expiration *time.Time
+	Tags       []string
+
+	// Description is a free-text description of the key
+	Description string
+
+	// MaxUses is the number of nodes the key can register, zero means once,
+	// or without limit for reusable keys
+	MaxUses uint32
+
+	// HostnamePattern is a glob the hostname of the nodes must match
+	HostnamePattern string
+
+	// AllowedOS lists the operating systems the nodes may run (e.g. "linux")
+	AllowedOS []string
+
+	// NodeExpiry is the longest the nodes are valid before logging in again
+	NodeExpiry time.Duration
+
+	// ApprovedRoutes are approved for the nodes when they register
+	ApprovedRoutes []string
+}
+
+// OAuthClientOptions describes an OAuth client to create with
+// CreateOAuthClient
+type OAuthClientOptions struct {
+	// Scopes are the parts of the API the client can access: "all",
+	// "users", "nodes", "auth_keys" or "policy", optionally suffixed with
+	// ":read" for read-only access
+	Scopes []string
+
+	// Tags are the tags the client can give to the pre-auth keys it creates
+	Tags []string
+
+	// Description is a free-text description of the client
+	Description string
+
+	// Expiration is when the client stops working, it never expires if nil
+	Expiration *time.Time
+}
+
+// ListNodesOptions describes the nodes to list with ListNodesWithOptions
+type ListNodesOptions struct {
+	// UserID only lists the nodes of the user, if not zero
+	UserID uint64
+
+	// Filter is a filter expression, e.g. "tag:db && !online"
+	Filter string
+
+	// OrderBy is the sort order, e.g. "last_seen desc"
+	OrderBy string
+
+	// PageSize is the maximum number of nodes returned, all nodes are
+	// returned if zero
+	PageSize int32
+
+	// PageToken is the token of the page to return, as returned by the
+	// previous call
+	PageToken string
+}
+
+// InviteOptions describes an invite to create with CreateInvite
+type InviteOptions struct {
+	// Email is the email of the invited person, required when the server
+	// does not use OIDC
+	Email string
+
+	// Tags are the tags of the pre-auth key given with the invite
+	Tags []string
+
+	// Expiration is when the invite stops working, it never expires if nil
+	Expiration *time.Time
+}
+
 // ServerConfig contains the configuration needed to start a headscale control plane server
 type ServerConfig struct {
 	// ServerURL is the public URL of the headscale server (e.g., "https://headscale.example.com")
@@ -66,15 +199,34 @@ type ServerConfig struct {
 	// ListenAddr is the address to listen on for HTTP traffic (default: "0.0.0.0:8080")
 	ListenAddr string
 
-	// GRPCAddr is the address to listen on for gRPC traffic (default: "0.0.0.0:50443")
+	// GRPCAddr is the address to listen on for gRPC traffic (default: "0.0.0.0:50443"),
+	// the gRPC listener is disabled if empty, leaving only in-process and unix socket access
 	GRPCAddr string
 
 	// GRPCAllowInsecure allows insecure gRPC connections (default: false)
 	GRPCAllowInsecure bool
 
+	// MetricsAddr is the address to serve metrics and debug endpoints on (e.g., "127.0.0.1:9090")
+	MetricsAddr string
+
+	// UnixSocket is the path of the unix socket the gRPC API is served on for local clients
+	UnixSocket string
+
+	// UnixSocketPermission is the file mode of the unix socket (default: 0o770)
+	UnixSocketPermission fs.FileMode
+
 	// DatabaseConfig specifies the database configuration
 	Database DatabaseConfig
 
+	// Cluster lets several servers share one PostgreSQL database
+	Cluster ClusterConfig
+
+	// Backup writes backups of the server to a directory on a schedule
+	Backup BackupConfig
+
+	// Quota is the default limit on the resources of each user
+	Quota QuotaConfig
+
 	// NoisePrivateKeyPath is the path to the Noise protocol private key file
 	NoisePrivateKeyPath string
 
@@ -87,6 +239,9 @@ type ServerConfig struct {
 	// IPv6Prefix is the IPv6 prefix for the tailnet (e.g., "fd7a:115c:a1e0::/48")
 	IPv6Prefix string
 
+	// IPAllocation is the strategy used to allocate IPs to nodes ("sequential" or "random", default: "sequential")
+	IPAllocation string
+
 	// DERP configuration
 	DERP DERPConfig
 
@@ -96,18 +251,100 @@ type ServerConfig struct {
 	// DNS configuration
 	DNS DNSConfig
 
+	// OIDC configuration, OIDC is enabled if an issuer is set
+	OIDC OIDCConfig
+
+	// WorkloadIdentity are the trusted issuers of the OIDC tokens which
+	// workloads can register nodes with, in place of a pre auth key
+	WorkloadIdentity []WorkloadIdentityIssuer
+
+	// RegistrationApproval enables the web page on which admins approve
+	// the nodes waiting for an interactive login
+	RegistrationApproval RegistrationApprovalConfig
+
+	// Policy configuration
+	Policy PolicyConfig
+
 	// LogLevel sets the logging level (trace, debug, info, warn, error)
 	LogLevel string
 
-	// EphemeralNodeInactivityTimeout is the timeout for ephemeral nodes
+	// LogFormat sets the logging format ("text" or "json", default: "text")
+	LogFormat string
+
+	// Logger is the logger of this server, filtered by LogLevel. If nil, the
+	// global zerolog logger is used. Each server only logs through its own
+	// logger, so several servers in one process can be told apart.
+	Logger *zerolog.Logger
+
+	// LogTailEnabled enables uploading of client logs to Tailscale
+	LogTailEnabled bool
+
+	// RandomizeClientPort makes clients use a random port for WireGuard traffic
+	RandomizeClientPort bool
+
+	// EphemeralNodeInactivityTimeout is the timeout for ephemeral nodes (default: 120s)
 	EphemeralNodeInactivityTimeout time.Duration
+
+	// Tuning contains advanced settings, zero values use the defaults of headscale
+	Tuning TuningConfig
+
+	// Hooks are called by the server to admit new nodes and to report
+	// changes to nodes and the policy
+	Hooks Hooks
 }
 
+// Hooks are the extension points of the server. The lifecycle callbacks are
+// called synchronously, so they must return quickly and must not call back
+// into the server.
+type Hooks = types.Hooks
+
+// RegistrationHook decides whether a new node may join the tailnet, and can
+// change its hostname, tags and expiry. Nodes registered interactively are
+// admitted when they are approved, through RegisterNode or OIDC.
+type RegistrationHook = types.RegistrationHook
+
+// RegistrationHookFunc adapts a function to a RegistrationHook
+type RegistrationHookFunc = types.RegistrationHookFunc
+
+// RegistrationRequest describes the node asking to be registered
+type RegistrationRequest = types.RegistrationRequest
+
+// RegistrationDecision is the answer of a RegistrationHook, a nil decision
+// admits the node unchanged
+type RegistrationDecision = types.RegistrationDecision
+
+// WorkloadIdentityIssuer is a trusted issuer of workload identity tokens,
+// and the user and tags of the nodes registered with its tokens
+type WorkloadIdentityIssuer = types.WorkloadIdentityIssuer
+
+// RegistrationApprovalConfig configures the page at /admin/registrations,
+// and which OIDC users can log in to it
+type RegistrationApprovalConfig = types.RegistrationApprovalConfig
+
+// ClusterConfig lets several servers share one PostgreSQL database,
+// propagating changes and node online state between them (default
+// HeartbeatInterval: 10s)
+type ClusterConfig = types.ClusterConfig
+
+// BackupConfig configures scheduled backups, disabled when Interval is
+// zero. A Retention of zero keeps all backups
+type BackupConfig = types.BackupConfig
+
+// QuotaConfig limits the nodes, ephemeral nodes, active pre-auth keys and
+// approved routes of a user, a limit of zero is unlimited
+type QuotaConfig = types.Quota
+
 // DatabaseConfig specifies database connection parameters
 type DatabaseConfig struct {
 	// Type is the database type ("sqlite" or "postgres")
 	Type string
 
+	// Debug enables logging of all database queries
+	Debug bool
+
+	// Gorm configuration
+	Gorm GormConfig
+
 	// SQLite configuration (used when Type is "sqlite")
 	SQLite SQLiteConfig
 
@@ -119,6 +356,27 @@ type DatabaseConfig struct {
 type SQLiteConfig struct {
 	// Path is the path to the SQLite database file
 	Path string
+
+	// WriteAheadLog enables WAL mode for SQLite
+	WriteAheadLog bool
+
+	// WALAutoCheckPoint is the number of WAL frames before an automatic checkpoint
+	WALAutoCheckPoint int
+}
+
+// GormConfig contains the configuration of the database ORM
+type GormConfig struct {
+	// PrepareStmt enables prepared statements
+	PrepareStmt bool
+
+	// ParameterizedQueries enables parameterized queries
+	ParameterizedQueries bool
+
+	// SkipErrRecordNotFound skips logging "record not found" errors
+	SkipErrRecordNotFound bool
+
+	// SlowThreshold is the duration after which a query is logged as slow
+	SlowThreshold time.Duration
 }
 
 // PostgresConfig contains PostgreSQL-specific configuration
@@ -179,6 +437,18 @@ type DERPConfig struct {
 
 	// Paths are paths to DERP map files
 	Paths []string
+
+	// AutoUpdate enables periodic refresh of the DERP maps from URLs
+	AutoUpdate bool
+
+	// UpdateFrequency is how often the DERP maps are refreshed (default: 24h)
+	UpdateFrequency time.Duration
+
+	// IPv4 is the public IPv4 address of the embedded DERP server
+	IPv4 string
+
+	// IPv6 is the public IPv6 address of the embedded DERP server
+	IPv6 string
 }
 
 // TLSConfig contains TLS configuration
@@ -195,43 +465,177 @@ type TLSConfig struct {
 	// LetsEncryptCacheDir is the cache directory for Let's Encrypt certificates
 	LetsEncryptCacheDir string
 
-	// LetsEncryptChallengeType is the challenge type for Let's Encrypt
+	// LetsEncryptChallengeType is the challenge type for Let's Encrypt ("HTTP-01" or "TLS-ALPN-01", default: "HTTP-01")
 	LetsEncryptChallengeType string
+
+	// LetsEncryptListen is the address to listen on for the HTTP-01 challenge
+	LetsEncryptListen string
+
+	// ACMEURL is the directory URL of the ACME server
+	ACMEURL string
+
+	// ACMEEmail is the email used to register with the ACME server
+	ACMEEmail string
 }
 
 // DNSConfig contains DNS configuration
 type DNSConfig struct {
+	// MagicDNS enables MagicDNS (default: true)
+	MagicDNS *bool
+
 	// BaseDomain is the base domain for DNS resolution
 	BaseDomain string
 
+	// OverrideLocalDNS makes clients use the Nameservers instead of their local DNS (default: true)
+	OverrideLocalDNS *bool
+
 	// Nameservers are the DNS nameservers to use
 	Nameservers []string
 
+	// SplitNameservers are nameservers to use for specific domains
+	SplitNameservers map[string][]string
+
 	// SearchDomains are the DNS search domains
 	SearchDomains []string
 
 	// ExtraRecords are additional DNS records
 	ExtraRecords []DNSRecord
+
+	// ExtraRecordsPath is the path to a JSON file of additional DNS records,
+	// it is watched for changes and cannot be used with ExtraRecords
+	ExtraRecordsPath string
 }
 
 // DNSRecord represents a DNS record
 type DNSRecord struct {
-	Name  string
-	Type  string
+	Name string
+
+	// Type is the record type ("A" or "AAAA")
+	Type string
+
 	Value string
 }
 
+// OIDCConfig contains OpenID Connect configuration
+type OIDCConfig struct {
+	// Issuer is the URL of the OIDC issuer
+	Issuer string
+
+	// ClientID is the OIDC client ID
+	ClientID string
+
+	// ClientSecret is the OIDC client secret
+	ClientSecret string
+
+	// ClientSecretPath is the path to a file containing the client secret,
+	// it cannot be used with ClientSecret
+	ClientSecretPath string
+
+	// Scope are the scopes requested (default: "openid", "profile", "email")
+	Scope []string
+
+	// ExtraParams are extra parameters sent to the authorization endpoint
+	ExtraParams map[string]string
+
+	// AllowedDomains restricts login to users with an email in these domains
+	AllowedDomains []string
+
+	// AllowedUsers restricts login to these users
+	AllowedUsers []string
+
+	// AllowedGroups restricts login to members of these groups
+	AllowedGroups []string
+
+	// Expiry is the expiry of nodes registered through OIDC (default: 180 days)
+	Expiry time.Duration
+
+	// UseExpiryFromToken uses the expiry of the OIDC token for nodes
+	UseExpiryFromToken bool
+
+	// OnlyStartIfOIDCIsAvailable fails startup if the issuer cannot be reached
+	OnlyStartIfOIDCIsAvailable bool
+
+	// PKCEEnabled enables PKCE
+	PKCEEnabled bool
+
+	// PKCEMethod is the PKCE method ("plain" or "S256", default: "S256")
+	PKCEMethod string
+
+	// LinkUsersByEmail links the first OIDC login of a user to the existing
+	// user without OIDC identity with the same verified email
+	LinkUsersByEmail bool
+}
+
+// PolicyConfig contains the ACL policy configuration
+type PolicyConfig struct {
+	// Mode is where the policy is stored ("file" or "database", default: "file")
+	Mode string
+
+	// Path is the path to the policy file when Mode is "file"
+	Path string
+}
+
+// TuningConfig contains advanced settings of the control plane
+type TuningConfig struct {
+	// NotifierSendTimeout is how long updates can be pending for a node
+	// before its session is considered lagging (default: 800ms)
+	NotifierSendTimeout time.Duration
+
+	// NotifierQueueSize is the number of pending changes for a node before
+	// they are replaced by a full update (default: 1000)
+	NotifierQueueSize int
+
+	// BatchChangeDelay is how long changes are batched before being sent (default: 800ms)
+	BatchChangeDelay time.Duration
+
+	// NodeMapSessionBufferedChanSize is the buffer size of the update channel of a session (default: 30)
+	NodeMapSessionBufferedChanSize int
+
+	// NodeStorePersistInterval is how often node changes are written to the database (default: 1s)
+	NodeStorePersistInterval time.Duration
+}
+
 // ClientConfig contains configuration for connecting to a headscale control plane
 type ClientConfig struct {
-	// Address is the gRPC address of the headscale server
+	// Address is the gRPC address of the headscale server, or "unix:///path/to/headscale.sock"
+	// for the local unix socket
 	Address string
 
-	// APIKey is the API key for authentication (optional if using insecure connection)
+	// APIKey is the API key, or OAuth access token, for authentication
+	// (optional if using insecure connection)
 	APIKey string
 
 	// Insecure allows insecure connections (default: false)
 	Insecure bool
 
-	// Timeout is the connection timeout
+	// CACertPath is the path to a PEM CA bundle to verify the server with, instead of the system roots
+	CACertPath string
+
+	// ClientCertPath is the path to a PEM client certificate for mutual TLS
+	ClientCertPath string
+
+	// ClientKeyPath is the path to the PEM key of the client certificate
+	ClientKeyPath string
+
+	// ServerName overrides the name used to verify the server certificate
+	ServerName string
+
+	// Timeout is the timeout of each call to the server, zero disables it
 	Timeout time.Duration
+
+	// Retry configures the retries of idempotent calls
+	Retry RetryConfig
+}
+
+// RetryConfig configures the retries of idempotent calls failing with a
+// transient error, like the server being unavailable
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts of a call, including the first one (default: 1, no retries)
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry, doubled for each following retry (default: 100ms)
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum wait between retries (default: 5s)
+	MaxBackoff time.Duration
 }